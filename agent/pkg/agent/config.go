@@ -61,6 +61,7 @@ const (
 	EndpointHealth     = "/health"
 	EndpointLogs       = "/logs"
 	EndpointSystemInfo = "/system_info"
+	EndpointSystemd    = "/systemd"
 
 	AgentHost = common.CertsDNSName
 
@@ -55,6 +55,8 @@ func NewAgentHandler() http.Handler {
 	})
 	mux.HandleEndpoint("GET", agent.EndpointHealth, CheckHealth)
 	mux.HandleEndpoint("GET", agent.EndpointSystemInfo, metricsHandler.ServeHTTP)
+	mux.HandleEndpoint("GET", agent.EndpointSystemd+"/{unit}", SystemdUnitState)
+	mux.HandleEndpoint("POST", agent.EndpointSystemd+"/{unit}/{action}", SystemdUnitAction)
 	mux.ServeMux.HandleFunc("/", socketproxy.DockerSocketHandler(env.DockerSocket))
 
 	// ServeMux canonicalizes paths containing repeated slashes before dispatch
@@ -83,7 +83,7 @@ func ProxyHTTP(w http.ResponseWriter, r *http.Request) {
 	rp.ServeHTTP(w, r)
 }
 
-// cachedReverseProxy retrieves or creates a reverse proxy for the specified configuration and target URL, caching the result for reuse. It returns an error if the configuration cannot be serialized or its TLS configuration cannot be built.
+// cachedReverseProxy retrieves or creates a reverse proxy for the specified configuration and target URL, caching the result for reuse. It returns an error if the configuration cannot be serialized or its transport or TLS configuration cannot be built.
 func cachedReverseProxy(cfg agentproxy.Config, targetURL *url.URL) (*reverseproxy.ReverseProxy, error) {
 	key, err := strutils.MarshalString(cfg)
 	if err != nil {
@@ -98,11 +98,8 @@ func cachedReverseProxy(cfg agentproxy.Config, targetURL *url.URL) (*reverseprox
 	}
 
 	transport := NewTransport()
-	if cfg.ResponseHeaderTimeout > 0 {
-		transport.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
-	}
-	if cfg.DisableCompression {
-		transport.DisableCompression = true
+	if err := cfg.ConfigureTransport(transport, cfg.Scheme); err != nil {
+		return nil, err
 	}
 	transport.TLSClientConfig, err = cfg.BuildTLSConfig(targetURL)
 	if err != nil {
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/yusing/godoxy/internal/systemd"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+var systemdClient = sync.OnceValue(func() *systemd.Client {
+	return systemd.NewClient("")
+})
+
+// SystemdUnitState returns the systemd.UnitState of the unit as JSON.
+func SystemdUnitState(w http.ResponseWriter, r *http.Request) {
+	state, err := systemdClient().UnitState(r.Context(), r.PathValue("unit"))
+	if err != nil {
+		writeSystemdError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	strutils.NewJSONEncoder(w).Encode(state)
+}
+
+// SystemdUnitAction runs start, stop, kill, freeze or thaw on the unit.
+//
+// kill takes the signal number from the "signal" query parameter.
+func SystemdUnitAction(w http.ResponseWriter, r *http.Request) {
+	client := systemdClient()
+	ctx := r.Context()
+	unit := r.PathValue("unit")
+
+	var err error
+	switch r.PathValue("action") {
+	case "start":
+		err = client.StartUnit(ctx, unit)
+	case "stop":
+		err = client.StopUnit(ctx, unit)
+	case "kill":
+		signal, parseErr := strconv.ParseInt(r.URL.Query().Get("signal"), 10, 32)
+		if parseErr != nil || signal <= 0 {
+			http.Error(w, "invalid signal", http.StatusBadRequest)
+			return
+		}
+		err = client.KillUnit(ctx, unit, int32(signal))
+	case "freeze":
+		err = client.FreezeUnit(ctx, unit)
+	case "thaw":
+		err = client.ThawUnit(ctx, unit)
+	default:
+		http.Error(w, "invalid action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		writeSystemdError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeSystemdError(w http.ResponseWriter, err error) {
+	var dbusErr *systemd.Error
+	if errors.As(err, &dbusErr) {
+		// errors from systemd itself, e.g. no such unit or access denied
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
@@ -326,6 +326,14 @@ func paramBodyValue(p Param, raw any) (any, error) {
 	case *bool:
 		return *v, nil
 	case *stringSliceFlag:
+		// arrays of objects, e.g. --rule-tests, are passed as a JSON array
+		if raw := strings.Join(v.v, ","); strings.HasPrefix(raw, "[") {
+			var decoded []any
+			if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+				return nil, fmt.Errorf("invalid JSON for --%s: %w", p.FlagName, err)
+			}
+			return decoded, nil
+		}
 		return v.v, nil
 	default:
 		return nil, fmt.Errorf("unsupported body flag type for %s", p.FlagName)
@@ -355,6 +363,11 @@ func execHTTP(ep Endpoint, reqURL string, body []byte) error {
 	if err != nil {
 		return err
 	}
+	if resp.StatusCode == http.StatusExpectationFailed && len(payload) > 0 {
+		// validation failures, e.g. failed rule tests of route validate
+		printJSON(payload)
+		return fmt.Errorf("%s %s failed: %s", ep.Method, ep.Path, resp.Status)
+	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		if len(payload) == 0 {
 			return fmt.Errorf("%s %s failed: %s", ep.Method, ep.Path, resp.Status)
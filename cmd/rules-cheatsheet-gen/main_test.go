@@ -112,9 +112,9 @@ func TestBuildCommandSectionIncludesMutationTargets(t *testing.T) {
 	}
 
 	wantTargets := map[string]string{
-		"add":    "the target to add, can be header, resp_header, query, cookie, body, resp_body, status",
-		"remove": "the target to remove, can be header, resp_header, query, cookie, body, resp_body, status",
-		"set":    "the target to set, can be header, resp_header, query, cookie, body, resp_body, status",
+		"add":    "the target to add, can be header, resp_header, query, cookie, body, resp_body, json_body, resp_json_body, status",
+		"remove": "the target to remove, can be header, resp_header, query, cookie, body, resp_body, json_body, resp_json_body, status",
+		"set":    "the target to set, can be header, resp_header, query, cookie, body, resp_body, json_body, resp_json_body, status",
 	}
 	for command, want := range wantTargets {
 		item, ok := entries[command]
@@ -129,3 +129,35 @@ func TestBuildCommandSectionIncludesMutationTargets(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildMatcherSectionIncludesScheduleMatchers(t *testing.T) {
+	rulesDir := filepath.Join("..", "..", "internal", "route", "rules")
+	ex, err := parseRulesDir(rulesDir)
+	if err != nil {
+		t.Fatalf("parseRulesDir: %v", err)
+	}
+
+	section := ex.buildMatcherSection()
+	entries := map[string]entry{}
+	for _, item := range section.Entries {
+		entries[item.Name] = item
+	}
+
+	wantSyntax := map[string]string{
+		"time":    "time <ranges> [<timezone>]",
+		"weekday": "weekday <days> [<timezone>]",
+		"date":    "date <dates> [<timezone>]",
+	}
+	for matcher, want := range wantSyntax {
+		item, ok := entries[matcher]
+		if !ok {
+			t.Fatalf("missing %s entry", matcher)
+		}
+		if item.Syntax != want {
+			t.Fatalf("unexpected %s syntax %q", matcher, item.Syntax)
+		}
+		if len(item.Examples) == 0 {
+			t.Fatalf("%s entry has no examples", matcher)
+		}
+	}
+}
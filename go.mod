@@ -25,6 +25,7 @@ require (
 	github.com/fsnotify/fsnotify v1.10.1 // file watcher
 	github.com/gin-gonic/gin v1.12.0 // api server
 	github.com/go-acme/lego/v5 v5.3.1 // acme client
+	github.com/go-jose/go-jose/v4 v4.1.4 // JWS verification for the local CA ACME server
 	github.com/go-playground/validator/v10 v10.30.3 // validator
 	github.com/gobwas/glob v0.2.3 // glob matcher for route rules
 	github.com/goccy/go-yaml v1.19.2 // yaml parsing for different config files
@@ -39,6 +40,7 @@ require (
 	github.com/rs/zerolog v1.35.1 // logging
 	github.com/shirou/gopsutil/v4 v4.26.7 // system information
 	github.com/stretchr/testify v1.12.1 // testing framework
+	github.com/tetratelabs/wazero v1.12.0 // pure Go WebAssembly runtime for the wasm middleware
 	github.com/valyala/fasthttp v1.73.0 // fast http for health check
 	github.com/vincent-petithory/dataurl v1.0.0 // data url for fav icon
 	github.com/yusing/ds v0.4.1 // data structures and algorithms
@@ -52,7 +54,7 @@ require (
 	github.com/yusing/goutils/server v0.0.0-20260820173542-8bf1c1478f55
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.70.0
 	go.uber.org/atomic v1.11.0
-	golang.org/x/crypto v0.55.0 // encrypting password with bcrypt
+	golang.org/x/crypto v0.55.0 // encrypting password with bcrypt, OCSP stapling
 	golang.org/x/net v0.58.0 // HTTP header utilities
 	golang.org/x/oauth2 v0.36.0 // oauth2 authentication
 	golang.org/x/sync v0.22.0 // errgroup and singleflight for concurrent operations
@@ -97,7 +99,6 @@ require (
 	github.com/felixge/httpsnoop v1.1.0 // indirect
 	github.com/gabriel-vasile/mimetype v1.4.15 // indirect
 	github.com/gin-contrib/sse v1.1.1 // indirect
-	github.com/go-jose/go-jose/v4 v4.1.4 // indirect
 	github.com/go-logr/logr v1.4.4 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/go-ole/go-ole v1.3.0 // indirect
@@ -279,10 +279,11 @@ func (c *Config) logNotifyLoop(parent task.Parent) {
 				i++
 			}
 			c.notifier.Notify(&notif.LogMessage{
-				Level: zerolog.InfoLevel,
-				Title: "ACL Summary for last " + strutils.FormatDuration(c.Notify.Interval),
-				Body:  fieldsBody,
-				To:    c.Notify.To,
+				Level:  zerolog.InfoLevel,
+				Title:  "ACL Summary for last " + strutils.FormatDuration(c.Notify.Interval),
+				Body:   fieldsBody,
+				Source: notif.SourceACL,
+				To:     c.Notify.To,
 			})
 			clear(c.allowedCount)
 			clear(c.blockedCount)
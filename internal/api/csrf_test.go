@@ -270,6 +270,14 @@ func (p *stubAutocertProvider) GetCertInfos() ([]autocert.CertInfo, error) {
 	return nil, nil
 }
 
+func (p *stubAutocertProvider) GetCertInventory() []autocert.CertInventoryItem {
+	return nil
+}
+
+func (p *stubAutocertProvider) CertPreflight() []autocert.CertPreflightResult {
+	return nil
+}
+
 func (p *stubAutocertProvider) ScheduleRenewalAll(task.Parent) {}
 
 func (p *stubAutocertProvider) ObtainCertAll(context.Context) error {
@@ -17,6 +17,7 @@ import (
 	fileApi "github.com/yusing/godoxy/internal/api/v1/file"
 	homepageApi "github.com/yusing/godoxy/internal/api/v1/homepage"
 	metricsApi "github.com/yusing/godoxy/internal/api/v1/metrics"
+	notificationApi "github.com/yusing/godoxy/internal/api/v1/notification"
 	proxmoxApi "github.com/yusing/godoxy/internal/api/v1/proxmox"
 	routeApi "github.com/yusing/godoxy/internal/api/v1/route"
 	webuiApi "github.com/yusing/godoxy/internal/api/v1/webui"
@@ -89,7 +90,11 @@ func NewHandler(requireAuth bool) *gin.Engine {
 			route.GET("/list", routeApi.Routes)
 			route.GET("/:which", routeApi.Route)
 			route.GET("/providers", routeApi.Providers)
+			route.GET("/conn_stats", routeApi.ConnStats)
 			route.GET("/by_provider", routeApi.ByProvider)
+			route.GET("/rule_presets", routeApi.RulePresets)
+			route.POST("/trace", routeApi.NewTraceToken)
+			route.GET("/trace/:id", routeApi.Trace)
 			route.POST("/playground", routeApi.Playground)
 			route.GET("/validate", routeApi.Validate) // websocket
 			route.POST("/validate", routeApi.Validate)
@@ -128,6 +133,9 @@ func NewHandler(requireAuth bool) *gin.Engine {
 		{
 			cert.GET("/info", certApi.Info)
 			cert.GET("/renew", certApi.Renew)
+			cert.GET("/local_ca", certApi.LocalCA)
+			cert.GET("/inventory", certApi.Inventory)
+			cert.GET("/preflight", certApi.Preflight)
 		}
 
 		agent := v1.Group("/agent")
@@ -144,6 +152,13 @@ func NewHandler(requireAuth bool) *gin.Engine {
 			metrics.GET("/uptime", metricsApi.Uptime)
 		}
 
+		notification := v1.Group("/notification")
+		{
+			notification.GET("/silences", notificationApi.Silences)
+			notification.POST("/silences/create", notificationApi.CreateSilence)
+			notification.POST("/silences/delete", notificationApi.DeleteSilence)
+		}
+
 		docker := v1.Group("/docker")
 		{
 			docker.GET("/container/:id", dockerApi.GetContainer)
@@ -0,0 +1,51 @@
+package certapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	autocertctx "github.com/yusing/godoxy/internal/autocert/types"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"inventory"
+// @BasePath		/api/v1
+// @Summary		Get cert inventory
+// @Description	Get every certificate of the main, extra and on-demand providers and the inbound mTLS profiles, with the routes using each one
+// @Tags			cert
+// @Produce		json
+// @Success		200	{array}	  autocert.CertInventoryItem
+// @Failure		403	{object}	apitypes.ErrorResponse "Unauthorized"
+// @Failure		404	{object}	apitypes.ErrorResponse "Autocert is not enabled"
+// @Router		/cert/inventory [get]
+func Inventory(c *gin.Context) {
+	provider := autocertctx.FromCtx(c.Request.Context())
+	if provider == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("autocert is not enabled"))
+		return
+	}
+	c.JSON(http.StatusOK, provider.GetCertInventory())
+}
+
+// @x-id				"preflight"
+// @BasePath		/api/v1
+// @Summary		Check route hostnames against certs
+// @Description	List the route hostnames not covered by any certificate, and what their handshakes get instead
+// @Tags			cert
+// @Produce		json
+// @Success		200	{array}	  autocert.CertPreflightResult
+// @Failure		403	{object}	apitypes.ErrorResponse "Unauthorized"
+// @Failure		404	{object}	apitypes.ErrorResponse "Autocert is not enabled"
+// @Router		/cert/preflight [get]
+func Preflight(c *gin.Context) {
+	provider := autocertctx.FromCtx(c.Request.Context())
+	if provider == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("autocert is not enabled"))
+		return
+	}
+	results := provider.CertPreflight()
+	if results == nil {
+		results = []autocertctx.CertPreflightResult{}
+	}
+	c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,30 @@
+package certapi
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/autocert/localca"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"localCa"
+// @BasePath		/api/v1
+// @Summary		Download local CA root
+// @Description	Download the root certificate of the local CA, for clients to trust
+// @Tags			cert
+// @Produce		application/x-pem-file
+// @Success		200	{string}	string	"PEM encoded root certificate"
+// @Failure		403	{object}	apitypes.ErrorResponse "Unauthorized"
+// @Failure		404	{object}	apitypes.ErrorResponse "Local CA is not enabled"
+// @Router		/cert/local_ca [get]
+func LocalCA(c *gin.Context) {
+	ca := localca.Active()
+	if ca == nil {
+		c.JSON(http.StatusNotFound, apitypes.Error("local CA is not enabled"))
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="godoxy-local-ca.crt"`)
+	c.Data(http.StatusOK, "application/x-pem-file", ca.RootPEM())
+}
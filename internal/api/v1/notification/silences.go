@@ -0,0 +1,116 @@
+package notificationapi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/yusing/godoxy/internal/notif"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type (
+	CreateSilenceRequest struct {
+		Match    notif.NotificationMatcher `json:"match"`
+		StartsAt time.Time                 `json:"starts_at,omitzero" extensions:"x-omitempty"` // defaults to now
+		EndsAt   time.Time                 `json:"ends_at,omitzero" extensions:"x-omitempty"`
+		// Duration is used when EndsAt is not set, e.g. "2h"
+		Duration string `json:"duration,omitempty" extensions:"x-omitempty"`
+		Comment  string `json:"comment,omitempty" extensions:"x-omitempty"`
+	} // @name CreateNotificationSilenceRequest
+
+	DeleteSilenceRequest struct {
+		ID string `json:"id" binding:"required"`
+	} // @name DeleteNotificationSilenceRequest
+)
+
+// @x-id				"silences"
+// @BasePath		/api/v1
+// @Summary		List notification silences
+// @Description	List notification silences that have not ended
+// @Tags			notification
+// @Produce		json
+// @Success		200	{array}		notif.Silence
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/notification/silences [get]
+func Silences(c *gin.Context) {
+	c.JSON(http.StatusOK, notif.Silences())
+}
+
+// @x-id				"create-silence"
+// @BasePath		/api/v1
+// @Summary		Create notification silence
+// @Description	Mute matching notifications for a time window, e.g. during maintenance
+// @Tags			notification
+// @Accept			json
+// @Produce		json
+// @Param			request	body		CreateSilenceRequest	true	"Request"
+// @Success		200	{object}	notif.Silence
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/notification/silences/create [post]
+func CreateSilence(c *gin.Context) {
+	var req CreateSilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+
+	silence := &notif.Silence{
+		Match:    req.Match,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+		Comment:  req.Comment,
+	}
+	if silence.EndsAt.IsZero() {
+		if req.Duration == "" {
+			c.JSON(http.StatusBadRequest, apitypes.Error("ends_at or duration is required"))
+			return
+		}
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apitypes.Error("invalid duration", err))
+			return
+		}
+		if duration <= 0 {
+			c.JSON(http.StatusBadRequest, apitypes.Error("duration must be positive"))
+			return
+		}
+		if silence.StartsAt.IsZero() {
+			silence.StartsAt = time.Now()
+		}
+		silence.EndsAt = silence.StartsAt.Add(duration)
+	}
+
+	if err := notif.AddSilence(silence); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid silence", err))
+		return
+	}
+	c.JSON(http.StatusOK, silence)
+}
+
+// @x-id				"delete-silence"
+// @BasePath		/api/v1
+// @Summary		Delete notification silence
+// @Description	Delete notification silence by id
+// @Tags			notification
+// @Accept			json
+// @Produce		json
+// @Param			request	body		DeleteSilenceRequest	true	"Request"
+// @Success		200	{object}	apitypes.SuccessResponse
+// @Failure		400	{object}	apitypes.ErrorResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse	"Silence not found"
+// @Router			/notification/silences/delete [post]
+func DeleteSilence(c *gin.Context) {
+	var req DeleteSilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	if !notif.DeleteSilence(req.ID) {
+		c.JSON(http.StatusNotFound, apitypes.Error("silence not found"))
+		return
+	}
+	c.JSON(http.StatusOK, apitypes.Success("silence deleted"))
+}
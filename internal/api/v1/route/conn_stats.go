@@ -0,0 +1,33 @@
+package routeApi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	gphttp "github.com/yusing/godoxy/internal/net/gphttp"
+	"github.com/yusing/goutils/http/httpheaders"
+	"github.com/yusing/goutils/http/websocket"
+
+	_ "github.com/yusing/goutils/apitypes"
+)
+
+// @x-id				"conn_stats"
+// @BasePath		/api/v1
+// @Summary		Get upstream connection stats
+// @Description	Get upstream connection reuse stats of reverse proxy routes, by route name
+// @Tags			route,websocket
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	map[string]gphttp.ConnStatsSnapshot
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Router			/route/conn_stats [get]
+func ConnStats(c *gin.Context) {
+	if httpheaders.IsWebsocket(c.Request.Header) {
+		websocket.PeriodicWrite(c, 5*time.Second, func() (any, error) {
+			return gphttp.AllConnStats(), nil
+		})
+	} else {
+		c.JSON(http.StatusOK, gphttp.AllConnStats())
+	}
+}
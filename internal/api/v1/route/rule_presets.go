@@ -0,0 +1,46 @@
+package routeApi
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	entrypoint "github.com/yusing/godoxy/internal/entrypoint"
+	"github.com/yusing/godoxy/internal/route"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type RulePresetUsage map[string][]string // @name RulePresetUsage
+
+// @x-id				"rulePresets"
+// @BasePath		/api/v1
+// @Summary		List rule preset usage
+// @Description	List the rule presets used by routes, with the aliases of the routes using them
+// @Tags			route
+// @Accept			json
+// @Produce		json
+// @Success		200	{object}	RulePresetUsage
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		500	{object}	apitypes.ErrorResponse
+// @Router			/route/rule_presets [get]
+func RulePresets(c *gin.Context) {
+	ep := entrypoint.FromCtx(c.Request.Context())
+	if ep == nil { // impossible, but just in case
+		c.JSON(http.StatusInternalServerError, apitypes.Error("entrypoint not initialized"))
+		return
+	}
+	usage := make(RulePresetUsage)
+	for r := range ep.IterRoutes {
+		base, ok := r.(interface{ Base() *route.Route })
+		if !ok {
+			continue
+		}
+		for _, preset := range base.Base().RulePresets {
+			usage[preset] = append(usage[preset], r.Name())
+		}
+	}
+	for _, aliases := range usage {
+		slices.Sort(aliases)
+	}
+	c.JSON(http.StatusOK, usage)
+}
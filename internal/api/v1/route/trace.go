@@ -0,0 +1,127 @@
+package routeApi
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	entrypoint "github.com/yusing/godoxy/internal/entrypoint"
+	"github.com/yusing/godoxy/internal/route/rules"
+	apitypes "github.com/yusing/goutils/apitypes"
+)
+
+type NewTraceTokenRequest struct {
+	Route string `json:"route" binding:"required"`
+	TTL   string `json:"ttl"` // duration, default 5m, max 1h
+} // @name NewTraceTokenRequest
+
+type NewTraceTokenResponse struct {
+	Header    string    `json:"header"` // request header to send the token with
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+} // @name NewTraceTokenResponse
+
+type RuleTraceResponse struct {
+	ID           string             `json:"id"`
+	Route        string             `json:"route"`
+	Time         time.Time          `json:"time"`
+	Method       string             `json:"method"`
+	Host         string             `json:"host"`
+	URI          string             `json:"uri"`
+	Status       int                `json:"status"`
+	ParsedRules  []ParsedRule       `json:"parsedRules"`
+	MatchedRules []string           `json:"matchedRules"`
+	Events       []rules.TraceEvent `json:"events"`
+	Truncated    bool               `json:"truncated"`
+} // @name RuleTraceResponse
+
+const defaultTraceTTL = 5 * time.Minute
+
+// @x-id				"newTraceToken"
+// @BasePath		/api/v1
+// @Summary		Create rules trace token
+// @Description	Create a short-lived token that traces the rules of the route on requests with the X-GoDoxy-Rules-Trace header.
+// @Description	Traced responses have the X-GoDoxy-Rules-Trace-Id header, get the trace with /route/trace/{id}.
+// @Tags			route
+// @Accept			json
+// @Produce		json
+// @Param			request	body		NewTraceTokenRequest	true	"Trace token request"
+// @Success		200		{object}	NewTraceTokenResponse
+// @Failure		400		{object}	apitypes.ErrorResponse
+// @Failure		403		{object}	apitypes.ErrorResponse
+// @Failure		404		{object}	apitypes.ErrorResponse
+// @Failure		500		{object}	apitypes.ErrorResponse
+// @Router			/route/trace [post]
+func NewTraceToken(c *gin.Context) {
+	var request NewTraceTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid request", err))
+		return
+	}
+	ttl := defaultTraceTTL
+	if request.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(request.TTL); err != nil {
+			c.JSON(http.StatusBadRequest, apitypes.Error("invalid ttl", err))
+			return
+		}
+	}
+
+	ep := entrypoint.FromCtx(c.Request.Context())
+	if ep == nil { // impossible, but just in case
+		c.JSON(http.StatusInternalServerError, apitypes.Error("entrypoint not initialized"))
+		return
+	}
+	if _, ok := ep.GetRoute(request.Route); !ok {
+		c.JSON(http.StatusNotFound, apitypes.Error("route not found"))
+		return
+	}
+
+	token, expires, err := rules.NewTraceToken(request.Route, ttl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apitypes.Error("invalid ttl", err))
+		return
+	}
+	c.JSON(http.StatusOK, NewTraceTokenResponse{
+		Header:    rules.TraceHeader,
+		Token:     token,
+		ExpiresAt: expires,
+	})
+}
+
+// @x-id				"trace"
+// @BasePath		/api/v1
+// @Summary		Get rules trace
+// @Description	Get the rules trace of a traced request, traces are kept for 15 minutes.
+// @Tags			route
+// @Produce		json
+// @Param			id	path		string	true	"Trace ID"
+// @Success		200	{object}	RuleTraceResponse
+// @Failure		403	{object}	apitypes.ErrorResponse
+// @Failure		404	{object}	apitypes.ErrorResponse
+// @Router			/route/trace/{id} [get]
+func Trace(c *gin.Context) {
+	trace, ok := rules.GetTrace(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, apitypes.Error("trace not found"))
+		return
+	}
+
+	parsedRules := make([]ParsedRule, len(trace.Rules))
+	for i, rule := range trace.Rules {
+		parsedRules[i] = ParsedRule{Name: rule.Name, On: rule.On, Do: rule.Do}
+	}
+	c.JSON(http.StatusOK, RuleTraceResponse{
+		ID:           trace.ID,
+		Route:        trace.Route,
+		Time:         trace.Time,
+		Method:       trace.Method,
+		Host:         trace.Host,
+		URI:          trace.URI,
+		Status:       trace.Status,
+		ParsedRules:  parsedRules,
+		MatchedRules: trace.MatchedRules,
+		Events:       trace.Events,
+		Truncated:    trace.Truncated,
+	})
+}
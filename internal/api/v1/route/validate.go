@@ -7,6 +7,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/goccy/go-yaml"
 	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/route/rules"
 	"github.com/yusing/godoxy/internal/serialization"
 	apitypes "github.com/yusing/goutils/apitypes"
 	"github.com/yusing/goutils/http/httpheaders"
@@ -15,18 +16,30 @@ import (
 
 type _ = route.Route
 
+type ValidateRouteResponse struct {
+	Message string             `json:"message"`
+	Tests   []rules.TestResult `json:"tests"`
+} // @name ValidateRouteResponse
+
+type ValidateRouteFailedResponse struct {
+	Error error              `json:"error"` // we need the structured error, not the plain string
+	Tests []rules.TestResult `json:"tests"`
+} // @name ValidateRouteFailedResponse
+
 // @x-id			"validate"
 // @BasePath	/api/v1
 // @Summary		Validate route
-// @Description	Validate route,
+// @Description	Validate route, with tests=true the rule tests are run and their results returned.
+// @Description	A failed rule test fails the validation, so the CLI exits non-zero.
 // @Tags			route,websocket
 // @Accept		application/yaml
 // @Produce		json
 // @Param			route body route.Route true "Route"
-// @Success		200		{object}	apitypes.SuccessResponse "Route validated"
+// @Param			tests query bool false "Run the rule tests and return their results"
+// @Success		200		{object}	apitypes.SuccessResponse "Route validated, ValidateRouteResponse with tests=true"
 // @Failure		400		{object}	apitypes.ErrorResponse "Bad request"
 // @Failure		403		{object}	apitypes.ErrorResponse "Forbidden"
-// @Failure		417		{object}	any "Validation failed"
+// @Failure		417		{object}	any "Validation failed, ValidateRouteFailedResponse when rule tests failed with tests=true"
 // @Failure		500		{object}	apitypes.ErrorResponse "Internal server error"
 // @Router		/route/validate [get]
 // @Router		/route/validate [post]
@@ -40,7 +53,16 @@ func Validate(c *gin.Context) {
 		c.JSON(http.StatusExpectationFailed, err)
 		return
 	}
-	c.JSON(http.StatusOK, apitypes.Success("route validated"))
+	if c.Query("tests") != "true" {
+		c.JSON(http.StatusOK, apitypes.Success("route validated"))
+		return
+	}
+	results, err := request.Rules.RunTests(request.RuleTests)
+	if err != nil {
+		c.JSON(http.StatusExpectationFailed, ValidateRouteFailedResponse{Error: err, Tests: results})
+		return
+	}
+	c.JSON(http.StatusOK, ValidateRouteResponse{Message: "route validated", Tests: results})
 }
 
 func ValidateWS(c *gin.Context) {
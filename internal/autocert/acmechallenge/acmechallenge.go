@@ -0,0 +1,235 @@
+// Package acmechallenge solves the http-01 and tls-alpn-01 ACME challenges
+// on the entrypoint listeners instead of standalone challenge servers.
+//
+// Pending challenges are process-wide, so they keep being answered
+// by the entrypoint that owns the listeners during a config reload.
+package acmechallenge
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v5/challenge"
+	"github.com/go-acme/lego/v5/challenge/http01"
+	"github.com/go-acme/lego/v5/challenge/tlsalpn01"
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// ACMETLS1Protocol is the ALPN protocol of tls-alpn-01 validation requests.
+const ACMETLS1Protocol = tlsalpn01.ACMETLS1Protocol
+
+type (
+	httpProvider    struct{}
+	tlsALPNProvider struct{}
+
+	httpToken struct {
+		domain  string
+		keyAuth string
+	}
+
+	listenerState struct {
+		once  sync.Once
+		ready chan struct{}
+	}
+)
+
+var (
+	// HTTP01Provider answers http-01 challenges through ServeHTTP.
+	HTTP01Provider challenge.Provider = httpProvider{}
+	// TLSALPN01Provider answers tls-alpn-01 challenges through GetCertificate.
+	TLSALPN01Provider challenge.Provider = tlsALPNProvider{}
+)
+
+var (
+	httpTokens   = xsync.NewMap[string, httpToken]()        // token -> key authorization
+	tlsALPNCerts = xsync.NewMap[string, *tls.Certificate]() // domain -> challenge certificate
+
+	httpListener  = newListenerState()
+	httpsListener = newListenerState()
+)
+
+// listenerWaitTimeout bounds how long Present waits for the entrypoint to listen,
+// e.g. when no route has been loaded yet.
+const listenerWaitTimeout = time.Minute
+
+var ErrNoChallenge = errors.New("no pending tls-alpn-01 challenge")
+
+func newListenerState() *listenerState {
+	return &listenerState{ready: make(chan struct{})}
+}
+
+func (l *listenerState) set() {
+	l.once.Do(func() { close(l.ready) })
+}
+
+func (l *listenerState) wait(ctx context.Context, name string) error {
+	select {
+	case <-l.ready:
+		return nil
+	default:
+	}
+	timer := time.NewTimer(listenerWaitTimeout)
+	defer timer.Stop()
+	select {
+	case <-l.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return fmt.Errorf("entrypoint %s listener is not started", name)
+	}
+}
+
+// HTTPListenerStarted marks the entrypoint HTTP listener as ready for http-01 challenges.
+func HTTPListenerStarted() {
+	httpListener.set()
+}
+
+// HTTPSListenerStarted marks the entrypoint HTTPS listener as ready for tls-alpn-01 challenges.
+func HTTPSListenerStarted() {
+	httpsListener.set()
+}
+
+// Ready reports whether the entrypoint listener answering challengeType has started.
+func Ready(challengeType challenge.Type) bool {
+	l := listenerFor(challengeType)
+	if l == nil {
+		return false
+	}
+	select {
+	case <-l.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// WaitReady waits until the entrypoint listener answering challengeType has started.
+func WaitReady(ctx context.Context, challengeType challenge.Type) error {
+	l := listenerFor(challengeType)
+	if l == nil {
+		return fmt.Errorf("challenge %s is not solved by the entrypoint", challengeType)
+	}
+	select {
+	case <-l.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Present implements challenge.Provider.
+func (httpProvider) Present(ctx context.Context, domain, token, keyAuth string) error {
+	if err := httpListener.wait(ctx, "http"); err != nil {
+		return err
+	}
+	httpTokens.Store(token, httpToken{domain: domain, keyAuth: keyAuth})
+	return nil
+}
+
+// CleanUp implements challenge.Provider.
+func (httpProvider) CleanUp(_ context.Context, _, token, _ string) error {
+	httpTokens.Delete(token)
+	return nil
+}
+
+// Present implements challenge.Provider.
+func (tlsALPNProvider) Present(ctx context.Context, domain, _, keyAuth string) error {
+	if err := httpsListener.wait(ctx, "https"); err != nil {
+		return err
+	}
+	cert, err := tlsalpn01.ChallengeCert(domain, keyAuth)
+	if err != nil {
+		return err
+	}
+	tlsALPNCerts.Store(strings.ToLower(domain), cert)
+	return nil
+}
+
+// CleanUp implements challenge.Provider.
+func (tlsALPNProvider) CleanUp(_ context.Context, domain, _, _ string) error {
+	tlsALPNCerts.Delete(strings.ToLower(domain))
+	return nil
+}
+
+// ServeHTTP answers the request if it is for a pending http-01 challenge,
+// and reports whether it did.
+//
+// Other requests under /.well-known/acme-challenge/ are left to the routes,
+// e.g. for upstreams running their own ACME client.
+func ServeHTTP(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.URL.Path, http01.PathPrefix)
+	if !ok {
+		return false
+	}
+	pending, ok := httpTokens.Load(token)
+	if !ok {
+		return false
+	}
+	// validate the host to prevent DNS rebinding attacks
+	if r.Method != http.MethodGet || !strings.EqualFold(hostname(r.Host), pending.domain) {
+		log.Warn().
+			Str("host", r.Host).
+			Str("method", r.Method).
+			Str("domain", pending.domain).
+			Msg("acme: http-01 challenge request does not match the domain")
+		http.NotFound(w, r)
+		return true
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(pending.keyAuth))
+	log.Debug().Str("domain", pending.domain).Msg("acme: served http-01 challenge")
+	return true
+}
+
+// IsTLSALPN01 reports whether hello is a tls-alpn-01 validation request.
+func IsTLSALPN01(hello *tls.ClientHelloInfo) bool {
+	return hello != nil && len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == ACMETLS1Protocol
+}
+
+// GetCertificate returns the challenge certificate for a tls-alpn-01 validation request.
+func GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cert, ok := tlsALPNCerts.Load(strings.ToLower(hello.ServerName))
+	if !ok {
+		return nil, fmt.Errorf("%w for %q", ErrNoChallenge, hello.ServerName)
+	}
+	log.Debug().Str("domain", hello.ServerName).Msg("acme: served tls-alpn-01 challenge")
+	return cert, nil
+}
+
+// WithNextProto returns cfg with the ACME TLS ALPN protocol added to its NextProtos.
+func WithNextProto(cfg *tls.Config) *tls.Config {
+	if slices.Contains(cfg.NextProtos, ACMETLS1Protocol) {
+		return cfg
+	}
+	cfg = cfg.Clone()
+	cfg.NextProtos = append(slices.Clip(cfg.NextProtos), ACMETLS1Protocol)
+	return cfg
+}
+
+func listenerFor(challengeType challenge.Type) *listenerState {
+	switch challengeType {
+	case challenge.HTTP01:
+		return httpListener
+	case challenge.TLSALPN01:
+		return httpsListener
+	default:
+		return nil
+	}
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
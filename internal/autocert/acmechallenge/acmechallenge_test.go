@@ -0,0 +1,119 @@
+package acmechallenge
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/asn1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHTTP(t *testing.T) {
+	HTTPListenerStarted()
+	ctx := t.Context()
+	require.NoError(t, HTTP01Provider.Present(ctx, "example.com", "token1", "token1.thumbprint"))
+
+	serve := func(method, host, path string) (*httptest.ResponseRecorder, bool) {
+		req := httptest.NewRequest(method, "http://"+host+path, nil)
+		rec := httptest.NewRecorder()
+		return rec, ServeHTTP(rec, req)
+	}
+
+	rec, ok := serve(http.MethodGet, "example.com", "/.well-known/acme-challenge/token1")
+	require.True(t, ok)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "token1.thumbprint", rec.Body.String())
+
+	rec, ok = serve(http.MethodGet, "EXAMPLE.com:80", "/.well-known/acme-challenge/token1")
+	require.True(t, ok)
+	require.Equal(t, "token1.thumbprint", rec.Body.String())
+
+	rec, ok = serve(http.MethodGet, "other.com", "/.well-known/acme-challenge/token1")
+	require.True(t, ok, "mismatched host must not reach the routes")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	_, ok = serve(http.MethodGet, "example.com", "/.well-known/acme-challenge/unknown")
+	require.False(t, ok, "unknown tokens are left to the routes")
+
+	_, ok = serve(http.MethodGet, "example.com", "/")
+	require.False(t, ok)
+
+	require.NoError(t, HTTP01Provider.CleanUp(ctx, "example.com", "token1", "token1.thumbprint"))
+	_, ok = serve(http.MethodGet, "example.com", "/.well-known/acme-challenge/token1")
+	require.False(t, ok)
+}
+
+func TestPresentWaitsForListener(t *testing.T) {
+	l := newListenerState()
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+	require.ErrorIs(t, l.wait(ctx, "http"), context.Canceled)
+
+	l.set()
+	l.set() // idempotent
+	require.NoError(t, l.wait(ctx, "http"))
+}
+
+func TestTLSALPN01Handshake(t *testing.T) {
+	HTTPSListenerStarted()
+	ctx := t.Context()
+	require.NoError(t, TLSALPN01Provider.Present(ctx, "Example.com", "token", "token.thumbprint"))
+	t.Cleanup(func() {
+		_ = TLSALPN01Provider.CleanUp(ctx, "Example.com", "token", "token.thumbprint")
+	})
+
+	defaultCert := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		t.Error("default certificate must not be used for validation requests")
+		return nil, ErrNoChallenge
+	}
+	serverCfg := WithNextProto(&tls.Config{
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if IsTLSALPN01(hello) {
+				return GetCertificate(hello)
+			}
+			return defaultCert(hello)
+		},
+	})
+	require.Equal(t, []string{"h2", "http/1.1", ACMETLS1Protocol}, serverCfg.NextProtos)
+
+	clientConn, serverConn := net.Pipe()
+	defer clientConn.Close()
+	defer serverConn.Close()
+
+	go func() {
+		_ = tls.Server(serverConn, serverCfg).HandshakeContext(ctx)
+	}()
+
+	client := tls.Client(clientConn, &tls.Config{
+		ServerName:         "example.com",
+		NextProtos:         []string{ACMETLS1Protocol},
+		InsecureSkipVerify: true,
+	})
+	require.NoError(t, client.HandshakeContext(ctx))
+
+	state := client.ConnectionState()
+	require.Equal(t, ACMETLS1Protocol, state.NegotiatedProtocol)
+	require.Len(t, state.PeerCertificates, 1)
+
+	var found bool
+	for _, ext := range state.PeerCertificates[0].Extensions {
+		if ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}) {
+			found = true
+			require.True(t, ext.Critical)
+		}
+	}
+	require.True(t, found, "acmeIdentifier extension")
+}
+
+func TestGetCertificateWithoutChallenge(t *testing.T) {
+	_, err := GetCertificate(&tls.ClientHelloInfo{ServerName: "none.example.com"})
+	require.ErrorIs(t, err, ErrNoChallenge)
+
+	require.False(t, IsTLSALPN01(&tls.ClientHelloInfo{SupportedProtos: []string{"h2", ACMETLS1Protocol}}))
+	require.False(t, IsTLSALPN01(nil))
+}
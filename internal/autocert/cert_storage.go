@@ -0,0 +1,69 @@
+package autocert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yusing/godoxy/internal/autocert/storage"
+	"github.com/yusing/godoxy/internal/common"
+)
+
+// storageWatchInterval is how often the stored certificate is checked
+// for a renewal by another instance sharing the storage.
+const storageWatchInterval = 1 * time.Minute
+
+var defaultStorage storage.Storage = storage.NewFile()
+
+// getStorage returns the configured storage, the file storage by default.
+func (cfg *Config) getStorage() storage.Storage {
+	if cfg.storage == nil {
+		return defaultStorage
+	}
+	return cfg.storage
+}
+
+// skipStorage reports whether writes should be skipped,
+// tests do not touch the certs directory unless they set a storage.
+func (cfg *Config) skipStorage() bool {
+	return common.IsTest && cfg.storage == nil
+}
+
+// lockCert blocks until this instance is the only one issuing the certificate.
+func (p *Provider) lockCert(ctx context.Context) (unlock func(), err error) {
+	if p.cfg.skipStorage() {
+		return func() {}, nil
+	}
+	unlock, err = p.cfg.getStorage().Lock(ctx, p.cfg.CertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock certificate in %s: %w", p.cfg.getStorage(), err)
+	}
+	return unlock, nil
+}
+
+// syncCert reloads the certificate if another instance stored a new one,
+// and reports whether it did.
+func (p *Provider) syncCert(ctx context.Context) (bool, error) {
+	version, err := p.cfg.getStorage().Version(ctx, p.cfg.CertPath)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	p.mu.RLock()
+	unchanged := version == p.certVersion
+	p.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	if err := p.loadCert(); err != nil {
+		return false, err
+	}
+	p.rebuildSNIMatcher()
+	p.triggerOCSPRefresh()
+	return true, nil
+}
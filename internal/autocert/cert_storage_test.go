@@ -0,0 +1,120 @@
+package autocert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/autocert/storage"
+)
+
+func newTestStorageProvider(t *testing.T, store storage.Storage) *Provider {
+	t.Helper()
+	p, err := NewProvider(&Config{
+		Provider: ProviderCustom,
+		Domains:  []string{"example.com"},
+		CertPath: "certs/cert.crt",
+		KeyPath:  "certs/priv.key",
+		storage:  store,
+	}, &User{}, nil)
+	require.NoError(t, err)
+	return p
+}
+
+// storeTestCert stores a certificate for example.com as another instance would, and returns its serial.
+func storeTestCert(t *testing.T, store storage.Storage) *big.Int {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 90),
+	}, &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test CA"}}, key.Public(), key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	ctx := t.Context()
+	require.NoError(t, store.Store(ctx, "certs/priv.key", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), true))
+	require.NoError(t, store.Store(ctx, "certs/cert.crt", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), false))
+	return serial
+}
+
+func TestObtainCertAdoptsCertFromOtherInstance(t *testing.T) {
+	store := storage.NewMemory()
+	p := newTestStorageProvider(t, store)
+
+	// another instance is issuing
+	unlock, err := store.Lock(t.Context(), p.cfg.CertPath)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.ObtainCert(t.Context())
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("ObtainCert did not wait for the lock: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	serial := storeTestCert(t, store)
+	unlock()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ObtainCert did not return after the lock was released")
+	}
+	require.NotNil(t, p.getTLSCert())
+	require.Zero(t, serial.Cmp(p.getTLSCert().Leaf.SerialNumber))
+	require.Equal(t, CertStateValid, p.certState())
+}
+
+func TestSyncCert(t *testing.T) {
+	store := storage.NewMemory()
+	p := newTestStorageProvider(t, store)
+
+	synced, err := p.syncCert(t.Context())
+	require.NoError(t, err)
+	require.False(t, synced, "nothing stored")
+
+	storeTestCert(t, store)
+	require.NoError(t, p.loadCert())
+	synced, err = p.syncCert(t.Context())
+	require.NoError(t, err)
+	require.False(t, synced, "loaded cert is current")
+
+	// renewed by another instance
+	serial := storeTestCert(t, store)
+	synced, err = p.syncCert(t.Context())
+	require.NoError(t, err)
+	require.True(t, synced)
+	require.Zero(t, serial.Cmp(p.getTLSCert().Leaf.SerialNumber))
+	require.Same(t, p, p.getSNIMatcher().match("example.com"))
+}
+
+func TestDefaultDomainFromStorage(t *testing.T) {
+	store := storage.NewMemory()
+	p := newTestStorageProvider(t, store)
+	require.Empty(t, p.DefaultDomain(), "no cert loaded")
+
+	// the cert is only in the storage, not at the local cert path
+	storeTestCert(t, store)
+	require.NoError(t, p.loadCert())
+	require.Equal(t, "example.com", p.DefaultDomain())
+}
@@ -1,6 +1,7 @@
 package autocert
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -19,7 +20,8 @@ import (
 	"github.com/go-acme/lego/v5/challenge/dns01"
 	"github.com/go-acme/lego/v5/lego"
 	"github.com/rs/zerolog/log"
-	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/autocert/localca"
+	"github.com/yusing/godoxy/internal/autocert/storage"
 	gperr "github.com/yusing/goutils/errs"
 	strutils "github.com/yusing/goutils/strings"
 )
@@ -36,6 +38,24 @@ type (
 		Provider    string                       `json:"provider,omitempty"`
 		Options     map[string]strutils.Redacted `json:"options,omitempty"`
 
+		// Challenge is the ACME challenge type: dns-01 (default), http-01 or tls-alpn-01.
+		// http-01 and tls-alpn-01 are answered by the entrypoint on port 80 and 443.
+		Challenge string `json:"challenge,omitempty"`
+
+		// OnDemand obtains a certificate per hostname at its first TLS handshake
+		// when no configured certificate covers it. Requires http-01 or tls-alpn-01.
+		OnDemand *OnDemandConfig `json:"on_demand,omitempty"`
+
+		// LocalCA issues certificates for internal domains from a local root.
+		LocalCA *localca.Config `json:"local_ca,omitempty"`
+
+		// ExpiryAlertDays notifies when a certificate expires within these numbers of days, default 14, 7 and 1.
+		ExpiryAlertDays []int `json:"expiry_alert_days,omitempty"`
+
+		// Storage is where certificates, keys and the ACME account are kept, default file.
+		// Instances sharing a storage take turns to issue, the others reload what was stored.
+		Storage *storage.Config `json:"storage,omitempty"`
+
 		Resolvers []string `json:"resolvers,omitempty"`
 
 		// Custom ACME CA
@@ -55,8 +75,10 @@ type (
 
 		challengeProvider challenge.Provider
 		certKeyType       certcrypto.KeyType // parsed CertificateKeyType, set by validate
+		storage           storage.Storage    // nil for the default file storage
 
-		idx int // 0: main, 1+: extra[i]
+		idx          int    // 0: main, 1+: extra[i]
+		onDemandHost string // hostname of an on-demand provider
 	}
 )
 
@@ -66,6 +88,7 @@ var (
 	ErrInvalidDomain             = gperr.New("invalid domain")
 	ErrUnknownProvider           = gperr.New("unknown provider")
 	ErrInvalidCertificateKeyType = gperr.New("invalid certificate_key_type")
+	ErrInvalidChallenge          = gperr.New("invalid challenge")
 )
 
 // Allowed certificate_key_type values (ACME-issued cert key): EC256, EC384, RSA2048, RSA3072, RSA4096, RSA8192,
@@ -78,6 +101,15 @@ const (
 	ProviderLocal  = "local"
 	ProviderPseudo = "pseudo"
 	ProviderCustom = "custom"
+	// ProviderACME uses the default ACME CA without a DNS provider,
+	// for the http-01 and tls-alpn-01 challenges.
+	ProviderACME = "acme"
+)
+
+const (
+	ChallengeDNS01     = "dns-01"
+	ChallengeHTTP01    = "http-01"
+	ChallengeTLSALPN01 = "tls-alpn-01"
 )
 
 var domainOrWildcardRE = regexp.MustCompile(`^\*?([^.]+\.)+[^.]+$`)
@@ -98,7 +130,11 @@ func (cfg *ConfigExtra) AsConfig() *Config {
 
 func (cfg *Config) validate(seenPaths map[string]int) error {
 	if cfg.Provider == "" {
-		cfg.Provider = ProviderLocal
+		if cfg.solvedByEntrypoint() {
+			cfg.Provider = ProviderACME
+		} else {
+			cfg.Provider = ProviderLocal
+		}
 	}
 	if cfg.CertPath == "" {
 		cfg.CertPath = CertFileDefault
@@ -110,6 +146,10 @@ func (cfg *Config) validate(seenPaths map[string]int) error {
 		cfg.ACMEKeyPath = acmeKeyPath(cfg.CADirURL)
 	}
 
+	if cfg.Storage != nil {
+		cfg.storage = cfg.Storage.Storage
+	}
+
 	b := gperr.NewBuilder("certificate error")
 
 	// check if cert_path is unique
@@ -131,7 +171,7 @@ func (cfg *Config) validate(seenPaths map[string]int) error {
 	}
 
 	if cfg.Provider != ProviderLocal && cfg.Provider != ProviderPseudo {
-		if len(cfg.Domains) == 0 {
+		if len(cfg.Domains) == 0 && cfg.OnDemand == nil {
 			b.Add(ErrMissingField.Subject("domains"))
 		}
 		if cfg.Email == "" {
@@ -144,12 +184,29 @@ func (cfg *Config) validate(seenPaths map[string]int) error {
 				}
 			}
 		}
+		if err := cfg.validateChallenge(); err != nil {
+			b.Add(err)
+		}
+	}
+
+	if cfg.LocalCA != nil {
+		if err := cfg.LocalCA.Validate(); err != nil {
+			b.AddSubjectf(err, "local_ca")
+		}
+	}
+
+	if err := cfg.validateExpiryAlertDays(); err != nil {
+		b.Add(err)
+	}
+
+	if cfg.OnDemand != nil && !cfg.solvedByEntrypoint() {
+		b.Add(ErrInvalidChallenge.Subject("on_demand").Withf("requires %s or %s", ChallengeHTTP01, ChallengeTLSALPN01))
 	}
 
 	// check if provider is implemented
 	providerConstructor, ok := Providers[cfg.Provider]
 	if !ok {
-		if cfg.Provider != ProviderCustom {
+		if cfg.Provider != ProviderCustom && cfg.Provider != ProviderACME {
 			b.Add(ErrUnknownProvider.
 				Subject(cfg.Provider).
 				With(gperr.DoYouMeanField(cfg.Provider, Providers)))
@@ -186,6 +243,43 @@ func (cfg *Config) validate(seenPaths map[string]int) error {
 	return b.Error()
 }
 
+func (cfg *Config) validateChallenge() error {
+	if cfg.Challenge == "" {
+		if cfg.Provider == ProviderACME {
+			cfg.Challenge = ChallengeHTTP01
+		} else {
+			cfg.Challenge = ChallengeDNS01
+		}
+	}
+
+	switch cfg.Challenge {
+	case ChallengeDNS01:
+		if cfg.Provider == ProviderACME {
+			return ErrInvalidChallenge.Subject(cfg.Challenge).Withf("provider %s does not solve it, set a DNS provider", ProviderACME)
+		}
+		return nil
+	case ChallengeHTTP01, ChallengeTLSALPN01:
+	default:
+		return ErrInvalidChallenge.Subject(cfg.Challenge).Withf("use one of %v", []string{ChallengeDNS01, ChallengeHTTP01, ChallengeTLSALPN01})
+	}
+
+	if cfg.Provider != ProviderACME && cfg.Provider != ProviderCustom {
+		return ErrInvalidChallenge.Subject(cfg.Challenge).Withf("DNS provider %s only solves %s, use provider %s", cfg.Provider, ChallengeDNS01, ProviderACME)
+	}
+	var b gperr.Builder
+	for i, d := range cfg.Domains {
+		if strings.HasPrefix(d, "*.") {
+			b.Add(ErrInvalidDomain.Subjectf("domains[%d]", i).Withf("wildcard domains require %s", ChallengeDNS01))
+		}
+	}
+	return b.Error()
+}
+
+// solvedByEntrypoint reports whether the challenge is answered by the entrypoint listeners.
+func (cfg *Config) solvedByEntrypoint() bool {
+	return cfg.Challenge == ChallengeHTTP01 || cfg.Challenge == ChallengeTLSALPN01
+}
+
 // applyResolvers installs the configured recursive nameservers as lego's default
 // DNS client, used for the dns-01 propagation checks.
 //
@@ -304,12 +398,20 @@ func cloneHTTPClient(client *http.Client) *http.Client {
 func MergeExtraConfig(mainCfg *Config, extraCfg *ConfigExtra) ConfigExtra {
 	merged := ConfigExtra(*mainCfg)
 	merged.Extra = nil
+	merged.OnDemand = nil // main provider only
+	merged.LocalCA = nil
+	// NOTE: Using same storage as main provider
 	merged.CertPath = extraCfg.CertPath
 	merged.KeyPath = extraCfg.KeyPath
 	// NOTE: Using same ACME key as main provider
 
 	if extraCfg.Provider != "" {
 		merged.Provider = extraCfg.Provider
+		// the challenge of the main provider may not apply to this one
+		merged.Challenge = extraCfg.Challenge
+	}
+	if extraCfg.Challenge != "" {
+		merged.Challenge = extraCfg.Challenge
 	}
 	if extraCfg.Email != "" {
 		merged.Email = extraCfg.Email
@@ -345,10 +447,10 @@ func MergeExtraConfig(mainCfg *Config, extraCfg *ConfigExtra) ConfigExtra {
 }
 
 func (cfg *Config) LoadACMEKey() (*ecdsa.PrivateKey, error) {
-	if common.IsTest {
+	if cfg.skipStorage() {
 		return nil, os.ErrNotExist
 	}
-	data, err := os.ReadFile(cfg.ACMEKeyPath)
+	data, err := cfg.getStorage().Load(context.Background(), cfg.ACMEKeyPath)
 	if err != nil {
 		return nil, err
 	}
@@ -356,14 +458,14 @@ func (cfg *Config) LoadACMEKey() (*ecdsa.PrivateKey, error) {
 }
 
 func (cfg *Config) SaveACMEKey(key *ecdsa.PrivateKey) error {
-	if common.IsTest {
+	if cfg.skipStorage() {
 		return nil
 	}
 	data, err := x509.MarshalECPrivateKey(key)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(cfg.ACMEKeyPath, data, 0o600)
+	return cfg.getStorage().Store(context.Background(), cfg.ACMEKeyPath, data, true)
 }
 
 // acmeKeyPath returns the path to the ACME key file based on the CA directory URL.
@@ -155,3 +155,86 @@ func TestCertificateKeyType(t *testing.T) {
 		require.Equal(t, certcrypto.RSA4096, extra.CertKeyType())
 	})
 }
+
+func TestChallenge(t *testing.T) {
+	dnsproviders.InitProviders()
+
+	t.Run("http-01 without provider uses acme", func(t *testing.T) {
+		cfg := &autocert.Config{Challenge: autocert.ChallengeHTTP01, Email: "a@example.com", Domains: []string{"example.com"}}
+		require.NoError(t, cfg.Validate())
+		require.Equal(t, autocert.ProviderACME, cfg.Provider)
+	})
+
+	t.Run("acme defaults to http-01", func(t *testing.T) {
+		cfg := &autocert.Config{Provider: autocert.ProviderACME, Email: "a@example.com", Domains: []string{"example.com"}}
+		require.NoError(t, cfg.Validate())
+		require.Equal(t, autocert.ChallengeHTTP01, cfg.Challenge)
+	})
+
+	t.Run("custom CA defaults to dns-01", func(t *testing.T) {
+		cfg := &autocert.Config{Provider: autocert.ProviderCustom, CADirURL: "https://ca.example.com/directory", Email: "a@example.com", Domains: []string{"example.com"}}
+		require.NoError(t, cfg.Validate())
+		require.Equal(t, autocert.ChallengeDNS01, cfg.Challenge)
+	})
+
+	t.Run("tls-alpn-01 rejects wildcard domains", func(t *testing.T) {
+		cfg := &autocert.Config{Challenge: autocert.ChallengeTLSALPN01, Email: "a@example.com", Domains: []string{"*.example.com"}}
+		require.ErrorContains(t, cfg.Validate(), "wildcard domains require dns-01")
+	})
+
+	t.Run("dns provider with http-01 rejected", func(t *testing.T) {
+		cfg := &autocert.Config{Provider: "duckdns", Challenge: autocert.ChallengeHTTP01, Email: "a@example.com", Domains: []string{"example.com"}}
+		require.ErrorContains(t, cfg.Validate(), autocert.ErrInvalidChallenge.Error())
+	})
+
+	t.Run("unknown challenge rejected", func(t *testing.T) {
+		cfg := &autocert.Config{Provider: autocert.ProviderACME, Challenge: "smtp-01", Email: "a@example.com", Domains: []string{"example.com"}}
+		require.ErrorContains(t, cfg.Validate(), autocert.ErrInvalidChallenge.Error())
+	})
+
+	t.Run("extra with another provider does not inherit http-01", func(t *testing.T) {
+		cfg := &autocert.Config{
+			Challenge: autocert.ChallengeHTTP01,
+			Email:     "a@example.com",
+			Domains:   []string{"example.com"},
+			Extra: []autocert.ConfigExtra{{
+				Provider: autocert.ProviderCustom,
+				CADirURL: "https://ca.example.com/directory",
+				Domains:  []string{"*.example.com"},
+				CertPath: "x.crt",
+				KeyPath:  "x.key",
+			}},
+		}
+		require.NoError(t, cfg.Validate())
+		require.Equal(t, autocert.ChallengeDNS01, cfg.Extra[0].Challenge)
+	})
+}
+
+func TestOnDemand(t *testing.T) {
+	dnsproviders.InitProviders()
+
+	t.Run("domains are optional", func(t *testing.T) {
+		cfg := &autocert.Config{Provider: autocert.ProviderACME, Email: "a@example.com", OnDemand: &autocert.OnDemandConfig{}}
+		require.NoError(t, cfg.Validate())
+	})
+
+	t.Run("requires a challenge solved by the entrypoint", func(t *testing.T) {
+		cfg := &autocert.Config{Provider: "duckdns", Email: "a@example.com", Domains: []string{"*.example.com"}, OnDemand: &autocert.OnDemandConfig{}}
+		require.ErrorContains(t, cfg.Validate(), "requires http-01 or tls-alpn-01")
+	})
+
+	t.Run("not inherited by extra providers", func(t *testing.T) {
+		cfg := &autocert.Config{
+			Provider: autocert.ProviderACME,
+			Email:    "a@example.com",
+			OnDemand: &autocert.OnDemandConfig{RateLimit: 5},
+			Extra: []autocert.ConfigExtra{{
+				Domains:  []string{"example.com"},
+				CertPath: "x.crt",
+				KeyPath:  "x.key",
+			}},
+		}
+		require.NoError(t, cfg.Validate())
+		require.Nil(t, cfg.Extra[0].OnDemand)
+	})
+}
@@ -0,0 +1,151 @@
+package autocert
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+	"github.com/yusing/godoxy/internal/notif"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+	"github.com/yusing/goutils/task"
+)
+
+const expiryCheckInterval = time.Hour
+
+// defaultExpiryAlertDays alerts well after a failed renewal, certificates are renewed 30 days before expiry.
+var defaultExpiryAlertDays = []int{14, 7, 1}
+
+var ErrInvalidExpiryAlertDays = gperr.New("invalid expiry_alert_days")
+
+func (cfg *Config) validateExpiryAlertDays() error {
+	for i, days := range cfg.ExpiryAlertDays {
+		if days <= 0 {
+			return ErrInvalidExpiryAlertDays.Subjectf("expiry_alert_days[%d]", i).Withf("must be positive, got %d", days)
+		}
+	}
+	return nil
+}
+
+// expiryAlertDays returns the alert thresholds, largest first.
+func (cfg *Config) expiryAlertDays() []int {
+	days := cfg.ExpiryAlertDays
+	if len(days) == 0 {
+		days = defaultExpiryAlertDays
+	}
+	days = slices.Clone(days)
+	slices.Sort(days)
+	slices.Reverse(days)
+	return slices.Compact(days)
+}
+
+// ScheduleExpiryCheck notifies when a certificate in the inventory is about to expire,
+// once per threshold in expiry_alert_days, and once more when it expired.
+func (p *Provider) ScheduleExpiryCheck(parent task.Parent) {
+	task := parent.Subtask("cert-expiry-checker", true)
+	notifier := notif.FromCtx(parent.Context())
+
+	go func() {
+		defer task.Finish(nil)
+
+		ticker := time.NewTicker(expiryCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			for _, msg := range p.checkExpiry(time.Now()) {
+				notifier.Notify(msg)
+			}
+			select {
+			case <-task.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkExpiry returns the alerts for certificates that crossed a threshold since the last check.
+// It is only called by the expiry checker.
+func (p *Provider) checkExpiry(now time.Time) []*notif.LogMessage {
+	thresholds := p.cfg.expiryAlertDays()
+	alerted := make(map[string]int, len(p.expiryAlerted))
+
+	var msgs []*notif.LogMessage
+	for _, item := range p.GetCertInventory() {
+		if item.Error != "" {
+			continue
+		}
+		key := item.Name + "/" + item.SerialNumber
+		notAfter := time.Unix(item.NotAfter, 0)
+		left := notAfter.Sub(now)
+
+		level := -1 // smallest threshold crossed in days, 0 when expired
+		if left <= 0 {
+			level = 0
+		} else {
+			for _, days := range thresholds {
+				if left <= time.Duration(days)*24*time.Hour {
+					level = days
+				}
+			}
+		}
+		if level < 0 {
+			continue
+		}
+
+		last, ok := p.expiryAlerted[key]
+		alerted[key] = level
+		if ok && last <= level {
+			continue
+		}
+		msgs = append(msgs, expiryMessage(&item, left, notAfter))
+	}
+	// forget renewed and removed certificates
+	p.expiryAlerted = alerted
+	return msgs
+}
+
+func expiryMessage(item *autocert.CertInventoryItem, left time.Duration, notAfter time.Time) *notif.LogMessage {
+	var fields notif.FieldsBody
+	fields.Add("Subject", item.Subject)
+	if len(item.DNSNames) > 0 {
+		fields.Add("DNS Names", strings.Join(item.DNSNames, ", "))
+	}
+	fields.Add("Issuer", item.Issuer)
+	fields.Add("Expires", strutils.FormatTime(notAfter))
+	if item.CertPath != "" {
+		fields.Add("Path", item.CertPath)
+	}
+	if len(item.Routes) > 0 {
+		fields.Add("Routes", strings.Join(item.Routes, ", "))
+	}
+	if item.LastFailure != 0 {
+		fields.Add("Last Renewal Failure", strutils.FormatTime(time.Unix(item.LastFailure, 0)))
+	}
+
+	msg := &notif.LogMessage{
+		Level:  zerolog.WarnLevel,
+		Body:   fields,
+		Source: notif.SourceAutocert,
+	}
+	if left <= 0 {
+		msg.Level = zerolog.ErrorLevel
+		msg.Title = "SSL certificate expired for " + item.Name
+	} else {
+		msg.Title = fmt.Sprintf("SSL certificate for %s expires in %s", item.Name, formatTimeLeft(left))
+	}
+	return msg
+}
+
+func formatTimeLeft(d time.Duration) string {
+	if days := int(d.Hours() / 24); days > 1 {
+		return fmt.Sprintf("%d days", days)
+	}
+	if hours := int(d.Hours()); hours > 1 {
+		return fmt.Sprintf("%d hours", hours)
+	}
+	return "less than an hour"
+}
@@ -0,0 +1,235 @@
+package autocert
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+)
+
+// RouteHostnames describes an HTTP route for the certificate inventory.
+type RouteHostnames struct {
+	Name      string
+	Hostnames []string
+	// InboundMTLSProfile is the inbound mTLS profile verifying its clients, if any.
+	InboundMTLSProfile string
+}
+
+// SetRoutesFunc sets the source of the routes listed in the certificate inventory and preflight.
+func (p *Provider) SetRoutesFunc(routes func() []RouteHostnames) {
+	p.routes.Store(&routes)
+}
+
+// SetInboundMTLSCAs sets the CA certificates of the inbound mTLS profiles, by profile name,
+// so they are listed in the certificate inventory and checked for expiry.
+func (p *Provider) SetInboundMTLSCAs(cas map[string][]*x509.Certificate) {
+	p.inboundMTLSCAs.Store(&cas)
+}
+
+func (p *Provider) getRoutes() []RouteHostnames {
+	routes := p.routes.Load()
+	if routes == nil {
+		return nil
+	}
+	return (*routes)()
+}
+
+// GetCertInventory returns every certificate of this provider, its extra and on-demand providers,
+// and the CA certificates of the inbound mTLS profiles.
+func (p *Provider) GetCertInventory() []autocert.CertInventoryItem {
+	routes := p.getRoutes()
+	routesByProvider := p.routesByProvider(routes)
+
+	allProviders := append(p.allProviders(), p.onDemandProviders()...)
+	items := make([]autocert.CertInventoryItem, 0, len(allProviders))
+	for _, provider := range allProviders {
+		items = append(items, provider.inventoryItem(routesByProvider[provider]))
+	}
+
+	if cas := p.inboundMTLSCAs.Load(); cas != nil {
+		for _, name := range slices.Sorted(maps.Keys(*cas)) {
+			var profileRoutes []string
+			for _, r := range routes {
+				if r.InboundMTLSProfile == name {
+					profileRoutes = append(profileRoutes, r.Name)
+				}
+			}
+			for _, cert := range (*cas)[name] {
+				item := autocert.CertInventoryItem{
+					Name: "inbound_mtls[" + name + "]",
+					Kind: autocert.CertKindClientCA,
+				}
+				fillCertInventoryItem(&item, cert)
+				item.ChainValid, item.ChainError = verifyCA(cert)
+				item.Routes = nonNilStrings(profileRoutes)
+				items = append(items, item)
+			}
+		}
+	}
+	return items
+}
+
+// CertPreflight returns the route hostnames not covered by any certificate.
+func (p *Provider) CertPreflight() []autocert.CertPreflightResult {
+	matcher := p.getSNIMatcher()
+	var results []autocert.CertPreflightResult
+	for _, r := range p.getRoutes() {
+		for _, host := range r.Hostnames {
+			if matcher.match(host) != nil {
+				continue
+			}
+			results = append(results, autocert.CertPreflightResult{
+				Route:    r.Name,
+				Hostname: host,
+				Fallback: p.certFallback(host),
+			})
+		}
+	}
+	return results
+}
+
+// certFallback returns what a handshake for host gets when no certificate matches it, like GetCert.
+func (p *Provider) certFallback(host string) string {
+	host = normalizeServerName(host)
+	switch {
+	case p.localCA != nil && p.localCA.Matches(host):
+		return autocert.CertFallbackLocalCA
+	case p.onDemand != nil && !strings.HasPrefix(host, "*."):
+		return autocert.CertFallbackOnDemand
+	case p.getTLSCert() != nil:
+		return autocert.CertFallbackMain
+	default:
+		return autocert.CertFallbackNone
+	}
+}
+
+// routesByProvider returns the routes served with the certificate of each provider, sorted by name.
+func (p *Provider) routesByProvider(routes []RouteHostnames) map[*Provider][]string {
+	matcher := p.getSNIMatcher()
+	byProvider := make(map[*Provider][]string)
+	for _, r := range routes {
+		seen := make(map[*Provider]struct{})
+		for _, host := range r.Hostnames {
+			provider := matcher.match(host)
+			if provider == nil {
+				continue
+			}
+			if _, ok := seen[provider]; ok {
+				continue
+			}
+			seen[provider] = struct{}{}
+			byProvider[provider] = append(byProvider[provider], r.Name)
+		}
+	}
+	for _, names := range byProvider {
+		slices.Sort(names)
+	}
+	return byProvider
+}
+
+func (p *Provider) inventoryItem(routes []string) autocert.CertInventoryItem {
+	item := autocert.CertInventoryItem{
+		Name:     p.GetName(),
+		Kind:     autocert.CertKindServer,
+		CertPath: p.cfg.CertPath,
+		Routes:   nonNilStrings(routes),
+	}
+	if lastFailure, err := p.GetLastFailure(); err == nil && !lastFailure.IsZero() {
+		item.LastFailure = lastFailure.Unix()
+	}
+
+	cert := p.getTLSCert()
+	if cert == nil || cert.Leaf == nil {
+		item.Error = ErrNoCertificates.Error()
+		return item
+	}
+	fillCertInventoryItem(&item, cert.Leaf)
+	item.ChainValid, item.ChainError = verifyChain(cert)
+
+	status, nextUpdate := p.OCSPStatus()
+	item.OCSPStatus = string(status)
+	if !nextUpdate.IsZero() {
+		item.OCSPNextUpdate = nextUpdate.Unix()
+	}
+	if p.cfg.Provider != ProviderLocal && p.cfg.Provider != ProviderPseudo {
+		item.RenewAt = p.ShouldRenewOn().Unix()
+	}
+	if start, end, _ := p.RenewalWindow(); !start.IsZero() {
+		item.RenewalWindowStart = start.Unix()
+		item.RenewalWindowEnd = end.Unix()
+	}
+	return item
+}
+
+func fillCertInventoryItem(item *autocert.CertInventoryItem, cert *x509.Certificate) {
+	item.Subject = cert.Subject.CommonName
+	item.Issuer = cert.Issuer.CommonName
+	item.SerialNumber = cert.SerialNumber.Text(16)
+	item.NotBefore = cert.NotBefore.Unix()
+	item.NotAfter = cert.NotAfter.Unix()
+	item.DNSNames = nonNilStrings(cert.DNSNames)
+	item.IPAddresses = make([]string, len(cert.IPAddresses))
+	for i, ip := range cert.IPAddresses {
+		item.IPAddresses[i] = ip.String()
+	}
+	item.EmailAddresses = nonNilStrings(cert.EmailAddresses)
+	item.KeyType = keyTypeString(cert.PublicKey)
+}
+
+// verifyChain verifies the certificate against the system roots, with the intermediates it is served with.
+func verifyChain(cert *tls.Certificate) (valid bool, errMsg string) {
+	intermediates := x509.NewCertPool()
+	for _, der := range cert.Certificate[1:] {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return false, fmt.Sprintf("invalid intermediate certificate: %v", err)
+		}
+		intermediates.AddCert(c)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{Intermediates: intermediates}); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+// verifyCA checks that a client CA certificate may issue certificates and is within its validity.
+func verifyCA(cert *x509.Certificate) (valid bool, errMsg string) {
+	now := time.Now()
+	switch {
+	case !cert.IsCA:
+		return false, "not a CA certificate"
+	case now.Before(cert.NotBefore):
+		return false, "not valid before " + cert.NotBefore.UTC().Format(time.RFC3339)
+	case now.After(cert.NotAfter):
+		return false, "expired at " + cert.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return true, ""
+}
+
+func keyTypeString(pub any) string {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		return "ECDSA " + pub.Curve.Params().Name
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", pub.N.BitLen())
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return "unknown"
+	}
+}
+
+func nonNilStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -0,0 +1,129 @@
+package autocert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/autocert/storage"
+	autocert "github.com/yusing/godoxy/internal/autocert/types"
+)
+
+func newTestInventoryProvider(t *testing.T) *Provider {
+	t.Helper()
+	store := storage.NewMemory()
+	p := newTestStorageProvider(t, store)
+	storeTestCert(t, store)
+	require.NoError(t, p.loadCert())
+	p.rebuildSNIMatcher()
+	p.SetRoutesFunc(func() []RouteHostnames {
+		return []RouteHostnames{
+			{Name: "app", Hostnames: []string{"example.com"}, InboundMTLSProfile: "clients"},
+			{Name: "other", Hostnames: []string{"other.example.org"}},
+		}
+	})
+	return p
+}
+
+func TestGetCertInventory(t *testing.T) {
+	p := newTestInventoryProvider(t)
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: "client CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	p.SetInboundMTLSCAs(map[string][]*x509.Certificate{"clients": {ca}})
+
+	items := p.GetCertInventory()
+	require.Len(t, items, 2)
+
+	server := items[0]
+	require.Equal(t, autocert.CertKindServer, server.Kind)
+	require.Equal(t, "certs/cert.crt", server.CertPath)
+	require.Equal(t, "example.com", server.Subject)
+	require.Equal(t, []string{"example.com"}, server.DNSNames)
+	require.Equal(t, "ECDSA P-256", server.KeyType)
+	require.False(t, server.ChainValid, "issued by an untrusted CA")
+	require.NotEmpty(t, server.ChainError)
+	require.Equal(t, []string{"app"}, server.Routes)
+	require.Empty(t, server.Error)
+
+	client := items[1]
+	require.Equal(t, autocert.CertKindClientCA, client.Kind)
+	require.Equal(t, "inbound_mtls[clients]", client.Name)
+	require.Equal(t, "client CA", client.Subject)
+	require.True(t, client.ChainValid, client.ChainError)
+	require.Equal(t, []string{"app"}, client.Routes)
+}
+
+func TestGetCertInventoryNoCert(t *testing.T) {
+	p := newTestStorageProvider(t, storage.NewMemory())
+	items := p.GetCertInventory()
+	require.Len(t, items, 1)
+	require.Equal(t, ErrNoCertificates.Error(), items[0].Error)
+	require.Empty(t, items[0].Routes)
+}
+
+func TestCertPreflight(t *testing.T) {
+	p := newTestInventoryProvider(t)
+	require.Equal(t, []autocert.CertPreflightResult{
+		{Route: "other", Hostname: "other.example.org", Fallback: autocert.CertFallbackMain},
+	}, p.CertPreflight())
+}
+
+func TestCheckExpiry(t *testing.T) {
+	p := newTestInventoryProvider(t)
+	notAfter := p.getTLSCert().Leaf.NotAfter
+
+	require.Empty(t, p.checkExpiry(notAfter.AddDate(0, 0, -30)))
+
+	msgs := p.checkExpiry(notAfter.AddDate(0, 0, -10))
+	require.Len(t, msgs, 1)
+	require.Equal(t, zerolog.WarnLevel, msgs[0].Level)
+	require.Equal(t, "SSL certificate for "+p.GetName()+" expires in 10 days", msgs[0].Title)
+	require.Empty(t, p.checkExpiry(notAfter.AddDate(0, 0, -9)), "already alerted for this threshold")
+
+	// skipped thresholds alert once
+	msgs = p.checkExpiry(notAfter.Add(-6 * time.Hour))
+	require.Len(t, msgs, 1)
+	require.Equal(t, "SSL certificate for "+p.GetName()+" expires in 6 hours", msgs[0].Title)
+
+	msgs = p.checkExpiry(notAfter.Add(time.Minute))
+	require.Len(t, msgs, 1)
+	require.Equal(t, zerolog.ErrorLevel, msgs[0].Level)
+	require.Empty(t, p.checkExpiry(notAfter.Add(time.Hour)))
+
+	// renewed, the new certificate alerts again
+	storeTestCert(t, p.cfg.getStorage())
+	require.NoError(t, p.loadCert())
+	require.Len(t, p.checkExpiry(p.getTLSCert().Leaf.NotAfter.AddDate(0, 0, -1)), 1)
+}
+
+func TestExpiryAlertDays(t *testing.T) {
+	cfg := &Config{}
+	require.Equal(t, []int{14, 7, 1}, cfg.expiryAlertDays())
+
+	cfg.ExpiryAlertDays = []int{3, 30, 3, 10}
+	require.Equal(t, []int{30, 10, 3}, cfg.expiryAlertDays())
+	require.NoError(t, cfg.validateExpiryAlertDays())
+
+	cfg.ExpiryAlertDays = []int{7, 0}
+	require.ErrorIs(t, cfg.validateExpiryAlertDays(), ErrInvalidExpiryAlertDays)
+}
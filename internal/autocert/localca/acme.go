@@ -0,0 +1,838 @@
+package localca
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/rs/zerolog/log"
+)
+
+// acmeServer is a minimal RFC 8555 ACME server backed by the local CA.
+//
+// It supports accounts, orders and the http-01 challenge.
+// Key rollover, revocation and external account binding are not supported.
+type acmeServer struct {
+	ca           *CA
+	accountsFile string
+	httpClient   *http.Client
+
+	mu       sync.Mutex
+	nonces   map[string]time.Time          // nonce -> expiry
+	accounts map[string]*acmeAccount       // id -> account
+	orders   map[string]*acmeOrder         // id -> order
+	authzs   map[string]*acmeAuthorization // id -> authorization
+	certs    map[string]*acmeIssuedCert    // id -> certificate
+}
+
+type (
+	acmeAccount struct {
+		ID         string           `json:"id"`
+		Key        *jose.JSONWebKey `json:"key"`
+		Contact    []string         `json:"contact,omitempty"`
+		Thumbprint string           `json:"-"`
+	}
+	acmeIdentifier struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	acmeOrder struct {
+		id        string
+		accountID string
+		status    string
+		expires   time.Time
+		idents    []acmeIdentifier
+		authzIDs  []string
+		certID    string
+		err       *acmeProblem
+	}
+	acmeAuthorization struct {
+		id        string
+		accountID string
+		orderID   string
+		ident     acmeIdentifier
+		status    string
+		expires   time.Time
+		token     string
+		chStatus  string
+		validated time.Time
+		err       *acmeProblem
+	}
+	acmeIssuedCert struct {
+		accountID string
+		expires   time.Time
+		pem       []byte
+	}
+	acmeProblem struct {
+		Type   string `json:"type"`
+		Detail string `json:"detail"`
+		Status int    `json:"status"`
+	}
+)
+
+const (
+	acmePathPrefix = "/acme/"
+
+	acmeStatusPending    = "pending"
+	acmeStatusProcessing = "processing"
+	acmeStatusReady      = "ready"
+	acmeStatusValid      = "valid"
+	acmeStatusInvalid    = "invalid"
+
+	acmeChallengeHTTP01 = "http-01"
+
+	acmeOrderLifetime  = time.Hour
+	acmeNonceLifetime  = time.Hour
+	acmeMaxNonces      = 10000
+	acmeMaxRequestBody = 64 << 10
+	acmeValidationTime = 10 * time.Second
+
+	acmeAccountsFile = "acme_accounts.json"
+)
+
+var acmeSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+func newACMEServer(ca *CA) (*acmeServer, error) {
+	s := &acmeServer{
+		ca:           ca,
+		accountsFile: filepath.Join(ca.dir, acmeAccountsFile),
+		httpClient: &http.Client{
+			Timeout: acmeValidationTime,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 10 {
+					return errors.New("too many redirects")
+				}
+				return nil
+			},
+		},
+		nonces:   make(map[string]time.Time),
+		accounts: make(map[string]*acmeAccount),
+		orders:   make(map[string]*acmeOrder),
+		authzs:   make(map[string]*acmeAuthorization),
+		certs:    make(map[string]*acmeIssuedCert),
+	}
+	if err := s.loadAccounts(); err != nil {
+		return nil, fmt.Errorf("failed to load local CA ACME accounts: %w", err)
+	}
+	return s, nil
+}
+
+// ServeACME serves r if it is for the ACME directory, and reports whether it did.
+func (ca *CA) ServeACME(w http.ResponseWriter, r *http.Request) bool {
+	if ca.acme == nil || r.TLS == nil || !strings.HasPrefix(r.URL.Path, acmePathPrefix) {
+		return false
+	}
+	if !ca.IsACMEHost(strings.ToLower(hostname(r.Host))) {
+		return false
+	}
+	ca.acme.ServeHTTP(w, r)
+	return true
+}
+
+func (s *acmeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	base := "https://" + r.Host + acmePathPrefix
+	if r.URL.Path != acmePathPrefix+"directory" {
+		w.Header().Set("Link", "<"+base+"directory>;rel=\"index\"")
+	}
+
+	endpoint, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, acmePathPrefix), "/")
+	switch endpoint {
+	case "directory":
+		if r.Method != http.MethodGet {
+			s.writeProblem(w, acmeMalformed("method not allowed", http.StatusMethodNotAllowed))
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"newNonce":   base + "new-nonce",
+			"newAccount": base + "new-account",
+			"newOrder":   base + "new-order",
+			"meta": map[string]any{
+				"externalAccountRequired": false,
+			},
+		})
+		return
+	case "new-nonce":
+		w.Header().Set("Replay-Nonce", s.newNonce())
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		return
+	}
+
+	w.Header().Set("Replay-Nonce", s.newNonce())
+	if r.Method != http.MethodPost {
+		s.writeProblem(w, acmeMalformed("method not allowed", http.StatusMethodNotAllowed))
+		return
+	}
+
+	req, prob := s.verify(r, base, endpoint == "new-account")
+	if prob != nil {
+		s.writeProblem(w, prob)
+		return
+	}
+
+	switch endpoint {
+	case "new-account":
+		s.newAccount(w, req)
+	case "account":
+		s.account(w, req, id)
+	case "new-order":
+		s.newOrder(w, req)
+	case "order":
+		s.order(w, req, id)
+	case "authz":
+		s.authorization(w, req, id)
+	case "chall":
+		s.challenge(w, req, id)
+	case "finalize":
+		s.finalize(w, req, id)
+	case "cert":
+		s.certificate(w, req, id)
+	default:
+		s.writeProblem(w, acmeMalformed("unknown endpoint", http.StatusNotFound))
+	}
+}
+
+// acmeRequest is a verified JWS request.
+type acmeRequest struct {
+	base    string
+	payload []byte
+	jwk     *jose.JSONWebKey // set for new-account
+	account *acmeAccount     // set for other endpoints
+}
+
+func (req *acmeRequest) postAsGet() bool {
+	return len(req.payload) == 0
+}
+
+// verify verifies the JWS of r, its nonce and url.
+func (s *acmeServer) verify(r *http.Request, base string, withJWK bool) (*acmeRequest, *acmeProblem) {
+	if ct := r.Header.Get("Content-Type"); ct != "application/jose+json" {
+		return nil, acmeMalformed("content type must be application/jose+json", http.StatusUnsupportedMediaType)
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, acmeMaxRequestBody+1))
+	if err != nil {
+		return nil, acmeMalformed("failed to read request body", http.StatusBadRequest)
+	}
+	if len(body) > acmeMaxRequestBody {
+		return nil, acmeMalformed("request body too large", http.StatusRequestEntityTooLarge)
+	}
+	jws, err := jose.ParseSignedJSON(string(body), acmeSignatureAlgorithms)
+	if err != nil {
+		return nil, acmeMalformed("invalid JWS: "+err.Error(), http.StatusBadRequest)
+	}
+	if len(jws.Signatures) != 1 {
+		return nil, acmeMalformed("JWS must have exactly one signature", http.StatusBadRequest)
+	}
+	hdr := jws.Signatures[0].Protected
+
+	if !s.useNonce(hdr.Nonce) {
+		return nil, &acmeProblem{Type: "urn:ietf:params:acme:error:badNonce", Detail: "invalid or expired nonce", Status: http.StatusBadRequest}
+	}
+	if url, _ := hdr.ExtraHeaders["url"].(string); url != "https://"+r.Host+r.URL.Path {
+		return nil, acmeUnauthorized("JWS url does not match the request")
+	}
+
+	req := &acmeRequest{base: base}
+	var key any
+	if withJWK {
+		if hdr.JSONWebKey == nil || hdr.KeyID != "" {
+			return nil, acmeMalformed("new-account must be signed with jwk", http.StatusBadRequest)
+		}
+		if !hdr.JSONWebKey.Valid() || !hdr.JSONWebKey.IsPublic() {
+			return nil, acmeMalformed("invalid jwk", http.StatusBadRequest)
+		}
+		req.jwk = hdr.JSONWebKey
+		key = hdr.JSONWebKey
+	} else {
+		if hdr.KeyID == "" || hdr.JSONWebKey != nil {
+			return nil, acmeMalformed("request must be signed with kid", http.StatusBadRequest)
+		}
+		id, ok := strings.CutPrefix(hdr.KeyID, base+"account/")
+		if !ok {
+			return nil, &acmeProblem{Type: "urn:ietf:params:acme:error:accountDoesNotExist", Detail: "unknown kid", Status: http.StatusBadRequest}
+		}
+		s.mu.Lock()
+		req.account = s.accounts[id]
+		s.mu.Unlock()
+		if req.account == nil {
+			return nil, &acmeProblem{Type: "urn:ietf:params:acme:error:accountDoesNotExist", Detail: "unknown kid", Status: http.StatusBadRequest}
+		}
+		key = req.account.Key
+	}
+
+	payload, err := jws.Verify(key)
+	if err != nil {
+		return nil, acmeUnauthorized("invalid JWS signature")
+	}
+	req.payload = payload
+	return req, nil
+}
+
+func (s *acmeServer) newAccount(w http.ResponseWriter, req *acmeRequest) {
+	var payload struct {
+		Contact            []string `json:"contact"`
+		OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		s.writeProblem(w, acmeMalformed("invalid payload", http.StatusBadRequest))
+		return
+	}
+	thumbprint, err := jwkThumbprint(req.jwk)
+	if err != nil {
+		s.writeProblem(w, acmeMalformed("invalid jwk", http.StatusBadRequest))
+		return
+	}
+
+	s.mu.Lock()
+	var acct *acmeAccount
+	for _, a := range s.accounts {
+		if a.Thumbprint == thumbprint {
+			acct = a
+			break
+		}
+	}
+	status := http.StatusOK
+	if acct == nil {
+		if payload.OnlyReturnExisting {
+			s.mu.Unlock()
+			s.writeProblem(w, &acmeProblem{Type: "urn:ietf:params:acme:error:accountDoesNotExist", Detail: "no account for this key", Status: http.StatusBadRequest})
+			return
+		}
+		acct = &acmeAccount{ID: randomID(), Key: req.jwk, Contact: payload.Contact, Thumbprint: thumbprint}
+		s.accounts[acct.ID] = acct
+		status = http.StatusCreated
+		if err := s.saveAccountsLocked(); err != nil {
+			log.Err(err).Msg("local CA: failed to save ACME accounts")
+		}
+	}
+	s.mu.Unlock()
+
+	w.Header().Set("Location", req.base+"account/"+acct.ID)
+	writeJSON(w, status, s.accountJSON(req.base, acct))
+}
+
+func (s *acmeServer) account(w http.ResponseWriter, req *acmeRequest, id string) {
+	if id != req.account.ID {
+		s.writeProblem(w, acmeUnauthorized("account does not match the kid"))
+		return
+	}
+	w.Header().Set("Location", req.base+"account/"+id)
+	writeJSON(w, http.StatusOK, s.accountJSON(req.base, req.account))
+}
+
+func (s *acmeServer) accountJSON(base string, acct *acmeAccount) map[string]any {
+	return map[string]any{
+		"status":  acmeStatusValid,
+		"contact": acct.Contact,
+		"orders":  base + "account/" + acct.ID + "/orders",
+	}
+}
+
+func (s *acmeServer) newOrder(w http.ResponseWriter, req *acmeRequest) {
+	var payload struct {
+		Identifiers []acmeIdentifier `json:"identifiers"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil || len(payload.Identifiers) == 0 {
+		s.writeProblem(w, acmeMalformed("invalid payload", http.StatusBadRequest))
+		return
+	}
+	idents := make([]acmeIdentifier, 0, len(payload.Identifiers))
+	for _, ident := range payload.Identifiers {
+		ident.Value = strings.ToLower(ident.Value)
+		if ident.Type != "dns" {
+			s.writeProblem(w, &acmeProblem{Type: "urn:ietf:params:acme:error:unsupportedIdentifier", Detail: "only dns identifiers are supported", Status: http.StatusBadRequest})
+			return
+		}
+		if !s.ca.Matches(ident.Value) {
+			s.writeProblem(w, &acmeProblem{Type: "urn:ietf:params:acme:error:rejectedIdentifier", Detail: fmt.Sprintf("%s is not under %v", ident.Value, s.ca.cfg.Domains), Status: http.StatusBadRequest})
+			return
+		}
+		if !slices.Contains(idents, ident) {
+			idents = append(idents, ident)
+		}
+	}
+
+	now := time.Now()
+	order := &acmeOrder{
+		id:        randomID(),
+		accountID: req.account.ID,
+		status:    acmeStatusPending,
+		expires:   now.Add(acmeOrderLifetime),
+		idents:    idents,
+	}
+
+	s.mu.Lock()
+	s.gcLocked(now)
+	for _, ident := range idents {
+		authz := &acmeAuthorization{
+			id:        randomID(),
+			accountID: req.account.ID,
+			orderID:   order.id,
+			ident:     ident,
+			status:    acmeStatusPending,
+			expires:   order.expires,
+			token:     randomID(),
+			chStatus:  acmeStatusPending,
+		}
+		s.authzs[authz.id] = authz
+		order.authzIDs = append(order.authzIDs, authz.id)
+	}
+	s.orders[order.id] = order
+	body := s.orderJSONLocked(req.base, order)
+	s.mu.Unlock()
+
+	w.Header().Set("Location", req.base+"order/"+order.id)
+	writeJSON(w, http.StatusCreated, body)
+}
+
+func (s *acmeServer) order(w http.ResponseWriter, req *acmeRequest, id string) {
+	s.mu.Lock()
+	order, prob := s.getOrderLocked(req, id)
+	var body map[string]any
+	if prob == nil {
+		body = s.orderJSONLocked(req.base, order)
+	}
+	s.mu.Unlock()
+	if prob != nil {
+		s.writeProblem(w, prob)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *acmeServer) authorization(w http.ResponseWriter, req *acmeRequest, id string) {
+	s.mu.Lock()
+	authz, prob := s.getAuthzLocked(req, id)
+	var body map[string]any
+	if prob == nil {
+		body = s.authzJSONLocked(req.base, authz)
+	}
+	s.mu.Unlock()
+	if prob != nil {
+		s.writeProblem(w, prob)
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *acmeServer) challenge(w http.ResponseWriter, req *acmeRequest, id string) {
+	s.mu.Lock()
+	authz, prob := s.getAuthzLocked(req, id)
+	if prob != nil {
+		s.mu.Unlock()
+		s.writeProblem(w, prob)
+		return
+	}
+	// an empty JSON object starts the validation, POST-as-GET only reads the challenge
+	if !req.postAsGet() && authz.chStatus == acmeStatusPending {
+		authz.chStatus = acmeStatusProcessing
+		keyAuth := authz.token + "." + req.account.Thumbprint
+		go s.validate(authz, keyAuth)
+	}
+	body := s.challengeJSONLocked(req.base, authz)
+	processing := authz.chStatus == acmeStatusProcessing
+	s.mu.Unlock()
+
+	w.Header().Set("Link", "<"+req.base+"authz/"+authz.id+">;rel=\"up\"")
+	if processing {
+		// validation usually completes within a second, poll sooner than the client default
+		w.Header().Set("Retry-After", "1")
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+// validate fetches the http-01 key authorization from the identifier on port 80.
+func (s *acmeServer) validate(authz *acmeAuthorization, keyAuth string) {
+	ctx, cancel := context.WithTimeout(context.Background(), acmeValidationTime)
+	defer cancel()
+
+	err := s.fetchKeyAuth(ctx, authz.ident.Value, authz.token, keyAuth)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		authz.chStatus = acmeStatusInvalid
+		authz.status = acmeStatusInvalid
+		authz.err = &acmeProblem{Type: "urn:ietf:params:acme:error:incorrectResponse", Detail: err.Error(), Status: http.StatusForbidden}
+		log.Info().Err(err).Str("domain", authz.ident.Value).Msg("local CA: http-01 validation failed")
+	} else {
+		authz.chStatus = acmeStatusValid
+		authz.status = acmeStatusValid
+		authz.validated = time.Now()
+	}
+
+	order, ok := s.orders[authz.orderID]
+	if !ok || order.status != acmeStatusPending {
+		return
+	}
+	if authz.status == acmeStatusInvalid {
+		order.status = acmeStatusInvalid
+		order.err = authz.err
+		return
+	}
+	for _, authzID := range order.authzIDs {
+		if a, ok := s.authzs[authzID]; !ok || a.status != acmeStatusValid {
+			return
+		}
+	}
+	order.status = acmeStatusReady
+}
+
+func (s *acmeServer) fetchKeyAuth(ctx context.Context, domain, token, keyAuth string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+domain+"/.well-known/acme-challenge/"+token, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != keyAuth {
+		return errors.New("key authorization mismatch")
+	}
+	return nil
+}
+
+func (s *acmeServer) finalize(w http.ResponseWriter, req *acmeRequest, id string) {
+	var payload struct {
+		CSR string `json:"csr"`
+	}
+	if err := json.Unmarshal(req.payload, &payload); err != nil {
+		s.writeProblem(w, acmeMalformed("invalid payload", http.StatusBadRequest))
+		return
+	}
+	csrDER, err := base64.RawURLEncoding.DecodeString(payload.CSR)
+	if err != nil {
+		s.writeProblem(w, acmeBadCSR("invalid csr encoding"))
+		return
+	}
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	if err != nil || csr.CheckSignature() != nil {
+		s.writeProblem(w, acmeBadCSR("invalid csr"))
+		return
+	}
+
+	s.mu.Lock()
+	order, prob := s.getOrderLocked(req, id)
+	if prob == nil && order.status != acmeStatusReady {
+		prob = &acmeProblem{Type: "urn:ietf:params:acme:error:orderNotReady", Detail: "order is " + order.status, Status: http.StatusForbidden}
+	}
+	if prob != nil {
+		s.mu.Unlock()
+		s.writeProblem(w, prob)
+		return
+	}
+	names := make([]string, 0, len(order.idents))
+	for _, ident := range order.idents {
+		names = append(names, ident.Value)
+	}
+	s.mu.Unlock()
+
+	if !csrMatches(csr, names) {
+		s.writeProblem(w, acmeBadCSR(fmt.Sprintf("csr names must be exactly %v", names)))
+		return
+	}
+	// only the validated names are taken from the csr
+	cert, der, err := s.ca.sign(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: names[0]},
+		DNSNames:    names,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, csr.PublicKey)
+	if err != nil {
+		log.Err(err).Msg("local CA: failed to sign ACME certificate")
+		s.writeProblem(w, &acmeProblem{Type: "urn:ietf:params:acme:error:serverInternal", Detail: "failed to sign certificate", Status: http.StatusInternalServerError})
+		return
+	}
+
+	s.mu.Lock()
+	certID := randomID()
+	s.certs[certID] = &acmeIssuedCert{
+		accountID: req.account.ID,
+		expires:   cert.NotAfter,
+		pem:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+	order.certID = certID
+	order.status = acmeStatusValid
+	body := s.orderJSONLocked(req.base, order)
+	s.mu.Unlock()
+
+	log.Info().Strs("domains", names).Time("not_after", cert.NotAfter).Msg("local CA: issued ACME certificate")
+	w.Header().Set("Location", req.base+"order/"+order.id)
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (s *acmeServer) certificate(w http.ResponseWriter, req *acmeRequest, id string) {
+	s.mu.Lock()
+	cert, ok := s.certs[id]
+	s.mu.Unlock()
+	if !ok {
+		s.writeProblem(w, acmeMalformed("certificate not found", http.StatusNotFound))
+		return
+	}
+	if cert.accountID != req.account.ID {
+		s.writeProblem(w, acmeUnauthorized("certificate belongs to another account"))
+		return
+	}
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(cert.pem)
+}
+
+func (s *acmeServer) getOrderLocked(req *acmeRequest, id string) (*acmeOrder, *acmeProblem) {
+	order, ok := s.orders[id]
+	if !ok {
+		return nil, acmeMalformed("order not found", http.StatusNotFound)
+	}
+	if order.accountID != req.account.ID {
+		return nil, acmeUnauthorized("order belongs to another account")
+	}
+	if order.status != acmeStatusValid && order.status != acmeStatusInvalid && time.Now().After(order.expires) {
+		order.status = acmeStatusInvalid
+	}
+	return order, nil
+}
+
+func (s *acmeServer) getAuthzLocked(req *acmeRequest, id string) (*acmeAuthorization, *acmeProblem) {
+	authz, ok := s.authzs[id]
+	if !ok {
+		return nil, acmeMalformed("authorization not found", http.StatusNotFound)
+	}
+	if authz.accountID != req.account.ID {
+		return nil, acmeUnauthorized("authorization belongs to another account")
+	}
+	return authz, nil
+}
+
+func (s *acmeServer) orderJSONLocked(base string, order *acmeOrder) map[string]any {
+	authzURLs := make([]string, len(order.authzIDs))
+	for i, id := range order.authzIDs {
+		authzURLs[i] = base + "authz/" + id
+	}
+	body := map[string]any{
+		"status":         order.status,
+		"expires":        order.expires.UTC().Format(time.RFC3339),
+		"identifiers":    order.idents,
+		"authorizations": authzURLs,
+		"finalize":       base + "finalize/" + order.id,
+	}
+	if order.certID != "" {
+		body["certificate"] = base + "cert/" + order.certID
+	}
+	if order.err != nil {
+		body["error"] = order.err
+	}
+	return body
+}
+
+func (s *acmeServer) authzJSONLocked(base string, authz *acmeAuthorization) map[string]any {
+	return map[string]any{
+		"identifier": authz.ident,
+		"status":     authz.status,
+		"expires":    authz.expires.UTC().Format(time.RFC3339),
+		"challenges": []map[string]any{s.challengeJSONLocked(base, authz)},
+	}
+}
+
+func (s *acmeServer) challengeJSONLocked(base string, authz *acmeAuthorization) map[string]any {
+	body := map[string]any{
+		"type":   acmeChallengeHTTP01,
+		"url":    base + "chall/" + authz.id,
+		"token":  authz.token,
+		"status": authz.chStatus,
+	}
+	if !authz.validated.IsZero() {
+		body["validated"] = authz.validated.UTC().Format(time.RFC3339)
+	}
+	if authz.err != nil {
+		body["error"] = authz.err
+	}
+	return body
+}
+
+// gcLocked removes expired orders, authorizations and certificates.
+func (s *acmeServer) gcLocked(now time.Time) {
+	for id, order := range s.orders {
+		if !now.After(order.expires) {
+			continue
+		}
+		// keep the order while its certificate can be downloaded
+		if cert, ok := s.certs[order.certID]; ok && !now.After(cert.expires) {
+			continue
+		}
+		delete(s.orders, id)
+	}
+	for id, authz := range s.authzs {
+		if now.After(authz.expires) {
+			delete(s.authzs, id)
+		}
+	}
+	for id, cert := range s.certs {
+		if now.After(cert.expires) {
+			delete(s.certs, id)
+		}
+	}
+}
+
+func (s *acmeServer) newNonce() string {
+	nonce := randomID()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.nonces) >= acmeMaxNonces {
+		for n, expires := range s.nonces {
+			if now.After(expires) || len(s.nonces) >= acmeMaxNonces {
+				delete(s.nonces, n)
+			}
+		}
+	}
+	s.nonces[nonce] = now.Add(acmeNonceLifetime)
+	return nonce
+}
+
+func (s *acmeServer) useNonce(nonce string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.nonces[nonce]
+	if !ok {
+		return false
+	}
+	delete(s.nonces, nonce)
+	return time.Now().Before(expires)
+}
+
+func (s *acmeServer) loadAccounts() error {
+	data, err := os.ReadFile(s.accountsFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	var accounts []*acmeAccount
+	if err := json.Unmarshal(data, &accounts); err != nil {
+		return err
+	}
+	for _, acct := range accounts {
+		if acct.Key == nil || !acct.Key.Valid() {
+			continue
+		}
+		if acct.Thumbprint, err = jwkThumbprint(acct.Key); err != nil {
+			continue
+		}
+		s.accounts[acct.ID] = acct
+	}
+	return nil
+}
+
+func (s *acmeServer) saveAccountsLocked() error {
+	accounts := make([]*acmeAccount, 0, len(s.accounts))
+	for _, acct := range s.accounts {
+		accounts = append(accounts, acct)
+	}
+	slices.SortFunc(accounts, func(a, b *acmeAccount) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	data, err := json.Marshal(accounts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.accountsFile, data, 0o600)
+}
+
+func (s *acmeServer) writeProblem(w http.ResponseWriter, prob *acmeProblem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(prob.Status)
+	_ = json.NewEncoder(w).Encode(prob)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func acmeMalformed(detail string, status int) *acmeProblem {
+	return &acmeProblem{Type: "urn:ietf:params:acme:error:malformed", Detail: detail, Status: status}
+}
+
+func acmeUnauthorized(detail string) *acmeProblem {
+	return &acmeProblem{Type: "urn:ietf:params:acme:error:unauthorized", Detail: detail, Status: http.StatusForbidden}
+}
+
+func acmeBadCSR(detail string) *acmeProblem {
+	return &acmeProblem{Type: "urn:ietf:params:acme:error:badCSR", Detail: detail, Status: http.StatusBadRequest}
+}
+
+// csrMatches reports whether the names of csr are exactly names.
+func csrMatches(csr *x509.CertificateRequest, names []string) bool {
+	if len(csr.IPAddresses) > 0 || len(csr.EmailAddresses) > 0 || len(csr.URIs) > 0 {
+		return false
+	}
+	csrNames := make([]string, 0, len(csr.DNSNames)+1)
+	for _, name := range csr.DNSNames {
+		csrNames = append(csrNames, strings.ToLower(name))
+	}
+	if cn := strings.ToLower(csr.Subject.CommonName); cn != "" && !slices.Contains(csrNames, cn) {
+		csrNames = append(csrNames, cn)
+	}
+	slices.Sort(csrNames)
+	csrNames = slices.Compact(csrNames)
+	want := slices.Sorted(slices.Values(names))
+	return slices.Equal(csrNames, want)
+}
+
+func jwkThumbprint(key *jose.JSONWebKey) (string, error) {
+	sum, err := key.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(sum), nil
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
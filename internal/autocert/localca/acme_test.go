@@ -0,0 +1,146 @@
+package localca
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-acme/lego/v5/acme"
+	"github.com/go-acme/lego/v5/certcrypto"
+	"github.com/go-acme/lego/v5/certificate"
+	"github.com/go-acme/lego/v5/lego"
+	"github.com/go-acme/lego/v5/registration"
+	"github.com/stretchr/testify/require"
+)
+
+type testACMEUser struct {
+	key crypto.Signer
+	reg *acme.ExtendedAccount
+}
+
+func (u *testACMEUser) GetEmail() string                       { return "" }
+func (u *testACMEUser) GetRegistration() *acme.ExtendedAccount { return u.reg }
+func (u *testACMEUser) GetPrivateKey() crypto.Signer           { return u.key }
+
+// testHTTP01Provider serves the key authorizations for the local CA to validate.
+type testHTTP01Provider struct {
+	tokens sync.Map // token -> key authorization
+}
+
+func (p *testHTTP01Provider) Present(_ context.Context, _, token, keyAuth string) error {
+	p.tokens.Store(token, keyAuth)
+	return nil
+}
+
+func (p *testHTTP01Provider) CleanUp(_ context.Context, _, token, _ string) error {
+	p.tokens.Delete(token)
+	return nil
+}
+
+func (p *testHTTP01Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	keyAuth, ok := p.tokens.Load(strings.TrimPrefix(r.URL.Path, "/.well-known/acme-challenge/"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	_, _ = w.Write([]byte(keyAuth.(string)))
+}
+
+// newTestACME returns a lego client of the ACME server of ca,
+// with the http-01 validation requests of ca sent to challenges.
+func newTestACME(t *testing.T, ca *CA, challenges http.Handler) (*lego.Client, *testACMEUser) {
+	t.Helper()
+	challengeSrv := httptest.NewServer(challenges)
+	t.Cleanup(challengeSrv.Close)
+	ca.acme.httpClient.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, challengeSrv.Listener.Addr().String())
+		},
+	}
+
+	acmeSrv := httptest.NewTLSServer(ca.acme)
+	t.Cleanup(acmeSrv.Close)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	user := &testACMEUser{key: key}
+	cfg := lego.NewConfig(user)
+	cfg.CADirURL = acmeSrv.URL + acmePathPrefix + "directory"
+	cfg.HTTPClient = acmeSrv.Client()
+	client, err := lego.NewClient(cfg)
+	require.NoError(t, err)
+	return client, user
+}
+
+func TestACMEObtain(t *testing.T) {
+	ca := newTestCA(t, &Config{ACME: &ACMEConfig{Host: "ca.lan"}})
+	challenges := new(testHTTP01Provider)
+	client, user := newTestACME(t, ca, challenges)
+	require.NoError(t, client.Challenge.SetHTTP01Provider(challenges))
+
+	ctx := t.Context()
+	reg, err := client.Registration.Register(ctx, registration.RegisterOptions{TermsOfServiceAgreed: true})
+	require.NoError(t, err)
+	user.reg = reg
+
+	res, err := client.Certificate.Obtain(ctx, certificate.ObtainRequest{
+		Domains: []string{"app.lan", "www.app.lan"},
+		KeyType: certcrypto.EC256,
+	})
+	require.NoError(t, err)
+
+	cert, err := certcrypto.ParsePEMCertificate(res.Certificate)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"app.lan", "www.app.lan"}, cert.DNSNames)
+	require.Equal(t, "CN=app.lan", cert.Subject.String(), "subject is built from the validated names")
+	_, err = cert.Verify(x509.VerifyOptions{DNSName: "www.app.lan", Roots: ca.RootPool(x509.NewCertPool())})
+	require.NoError(t, err)
+
+	// accounts survive restarts
+	reloaded, err := newACMEServer(ca)
+	require.NoError(t, err)
+	require.Contains(t, reloaded.accounts, path.Base(reg.Location))
+}
+
+func TestACMERejects(t *testing.T) {
+	ca := newTestCA(t, &Config{ACME: &ACMEConfig{Host: "ca.lan"}})
+	client, user := newTestACME(t, ca, http.NotFoundHandler())
+	require.NoError(t, client.Challenge.SetHTTP01Provider(new(testHTTP01Provider)))
+
+	ctx := t.Context()
+	reg, err := client.Registration.Register(ctx, registration.RegisterOptions{TermsOfServiceAgreed: true})
+	require.NoError(t, err)
+	user.reg = reg
+
+	_, err = client.Certificate.Obtain(ctx, certificate.ObtainRequest{Domains: []string{"app.example.com"}, KeyType: certcrypto.EC256})
+	require.ErrorContains(t, err, "rejectedIdentifier")
+
+	_, err = client.Certificate.Obtain(ctx, certificate.ObtainRequest{Domains: []string{"app.lan"}, KeyType: certcrypto.EC256})
+	require.ErrorContains(t, err, "incorrectResponse")
+}
+
+func TestServeACMERequiresHost(t *testing.T) {
+	ca := newTestCA(t, &Config{ACME: &ACMEConfig{Host: "ca.lan"}})
+
+	req := httptest.NewRequest(http.MethodGet, "https://app.lan/acme/directory", nil)
+	require.False(t, ca.ServeACME(httptest.NewRecorder(), req))
+
+	req = httptest.NewRequest(http.MethodGet, "http://ca.lan/acme/directory", nil)
+	require.False(t, ca.ServeACME(httptest.NewRecorder(), req), "plain HTTP")
+
+	req = httptest.NewRequest(http.MethodGet, "https://ca.lan:8443/acme/directory", nil)
+	rec := httptest.NewRecorder()
+	require.True(t, ca.ServeACME(rec, req))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), `"newNonce":"https://ca.lan:8443/acme/new-nonce"`)
+}
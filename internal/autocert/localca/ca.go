@@ -0,0 +1,351 @@
+// Package localca is a local certificate authority for internal domains
+// (e.g. .lan, .internal) that public ACME CAs cannot issue certificates for.
+//
+// The root is generated once and persisted, leaf certificates are issued on demand
+// and rotated after two thirds of their lifetime. An optional ACME server lets
+// other services obtain certificates from it.
+package localca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/puzpuzpuz/xsync/v4"
+	"github.com/rs/zerolog/log"
+)
+
+type CA struct {
+	cfg *Config
+	dir string
+
+	root    *x509.Certificate
+	rootKey crypto.Signer
+	rootPEM []byte
+
+	leaves     *xsync.Map[string, *tls.Certificate] // hostname -> leaf
+	clientCert atomic.Pointer[tls.Certificate]
+	issue      sync.Mutex
+
+	acme *acmeServer // nil if disabled
+}
+
+const (
+	rootCertFile = "root.crt"
+	rootKeyFile  = "root.key"
+
+	rootLifetime = 10 * 365 * 24 * time.Hour
+	// warn when the root expires within a year
+	rootExpiryWarning = 365 * 24 * time.Hour
+
+	rootCommonName   = "GoDoxy Local CA"
+	clientCommonName = "GoDoxy"
+)
+
+var ErrNotCovered = errors.New("hostname is not covered by the local CA")
+
+var active atomic.Pointer[CA]
+
+// SetActive sets the local CA of the running config, nil if disabled.
+func SetActive(ca *CA) {
+	active.Store(ca)
+}
+
+// Active returns the local CA of the running config, or nil if disabled.
+func Active() *CA {
+	return active.Load()
+}
+
+// New loads the root from dir, generating one if it does not exist.
+//
+// cfg must be validated.
+func New(dir string, cfg *Config) (*CA, error) {
+	ca := &CA{
+		cfg:    cfg,
+		dir:    dir,
+		leaves: xsync.NewMap[string, *tls.Certificate](),
+	}
+	if err := ca.loadRoot(); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to load local CA root: %w", err)
+		}
+		if err := ca.generateRoot(); err != nil {
+			return nil, fmt.Errorf("failed to generate local CA root: %w", err)
+		}
+		log.Info().Str("path", ca.rootCertPath()).Msg("local CA: generated root certificate")
+	} else if !slices.Equal(ca.root.PermittedDNSDomains, cfg.permittedDNSDomains()) {
+		// leaves outside the name constraints of the root do not verify
+		if err := ca.generateRoot(); err != nil {
+			return nil, fmt.Errorf("failed to generate local CA root: %w", err)
+		}
+		log.Warn().Str("path", ca.rootCertPath()).Msg("local CA: domains changed, generated a new root certificate, clients must trust it again")
+	}
+	if time.Until(ca.root.NotAfter) < rootExpiryWarning {
+		log.Warn().Time("not_after", ca.root.NotAfter).Msgf("local CA: root certificate expires soon, remove %s to generate a new one", ca.dir)
+	}
+	if cfg.ACME != nil {
+		acme, err := newACMEServer(ca)
+		if err != nil {
+			return nil, err
+		}
+		ca.acme = acme
+	}
+	return ca, nil
+}
+
+// Matches reports whether the local CA issues certificates for host.
+func (ca *CA) Matches(host string) bool {
+	return ca.cfg.matches(host)
+}
+
+// IsACMEHost reports whether host serves the ACME directory.
+func (ca *CA) IsACMEHost(host string) bool {
+	return ca.acme != nil && host == ca.cfg.ACME.Host
+}
+
+// RootPEM returns the PEM encoded root certificate, for clients to trust.
+func (ca *CA) RootPEM() []byte {
+	return ca.rootPEM
+}
+
+// Root returns the root certificate.
+func (ca *CA) Root() *x509.Certificate {
+	return ca.root
+}
+
+// GetCertificate returns the leaf certificate of host, issuing a new one
+// if there is none or the current one is due for rotation.
+func (ca *CA) GetCertificate(host string) (*tls.Certificate, error) {
+	if !ca.Matches(host) {
+		return nil, ErrNotCovered
+	}
+	if leaf, ok := ca.leaves.Load(host); ok && !ca.shouldRotate(leaf.Leaf) {
+		return leaf, nil
+	}
+
+	ca.issue.Lock()
+	defer ca.issue.Unlock()
+
+	if leaf, ok := ca.leaves.Load(host); ok && !ca.shouldRotate(leaf.Leaf) {
+		return leaf, nil
+	}
+	leaf, err := ca.newTLSCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: host},
+		DNSNames:    []string{host},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ca.leaves.Store(host, leaf)
+	log.Debug().Str("host", host).Time("not_after", leaf.Leaf.NotAfter).Msg("local CA: issued certificate")
+	return leaf, nil
+}
+
+// ClientCertificate returns a client certificate issued by the local CA,
+// for upstreams that verify clients against it.
+//
+// It implements the tls.Config.GetClientCertificate signature.
+func (ca *CA) ClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := ca.clientCert.Load(); cert != nil && !ca.shouldRotate(cert.Leaf) {
+		return cert, nil
+	}
+
+	ca.issue.Lock()
+	defer ca.issue.Unlock()
+
+	if cert := ca.clientCert.Load(); cert != nil && !ca.shouldRotate(cert.Leaf) {
+		return cert, nil
+	}
+	cert, err := ca.newTLSCert(&x509.Certificate{
+		Subject:     pkix.Name{CommonName: clientCommonName},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ca.clientCert.Store(cert)
+	return cert, nil
+}
+
+// RootPool returns pool with the root certificate added,
+// or the system pool with it if pool is nil.
+func (ca *CA) RootPool(pool *x509.CertPool) *x509.CertPool {
+	if pool == nil {
+		var err error
+		if pool, err = x509.SystemCertPool(); err != nil {
+			pool = x509.NewCertPool()
+		}
+	} else {
+		pool = pool.Clone()
+	}
+	pool.AddCert(ca.root)
+	return pool
+}
+
+// shouldRotate reports whether leaf passed two thirds of its lifetime.
+func (ca *CA) shouldRotate(leaf *x509.Certificate) bool {
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return time.Now().After(leaf.NotBefore.Add(lifetime * 2 / 3))
+}
+
+func (ca *CA) newTLSCert(tmpl *x509.Certificate) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leaf, der, err := ca.sign(tmpl, key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// sign issues a certificate from tmpl for pub, filling in the serial number,
+// validity and key usage.
+func (ca *CA) sign(tmpl *x509.Certificate, pub crypto.PublicKey) (*x509.Certificate, []byte, error) {
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = now.Add(-time.Minute) // tolerate clock skew
+	tmpl.NotAfter = now.Add(ca.cfg.LeafLifetime)
+	if tmpl.NotAfter.After(ca.root.NotAfter) {
+		tmpl.NotAfter = ca.root.NotAfter
+	}
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := pub.(*rsa.PublicKey); ok {
+		tmpl.KeyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.root, pub, ca.rootKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, der, nil
+}
+
+func (ca *CA) rootCertPath() string {
+	return filepath.Join(ca.dir, rootCertFile)
+}
+
+func (ca *CA) rootKeyPath() string {
+	return filepath.Join(ca.dir, rootKeyFile)
+}
+
+func (ca *CA) loadRoot() error {
+	certPEM, err := os.ReadFile(ca.rootCertPath())
+	if err != nil {
+		return err
+	}
+	keyPEM, err := os.ReadFile(ca.rootKeyPath())
+	if err != nil {
+		return err
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return errors.New("root key is not a signer")
+	}
+	if !pair.Leaf.IsCA {
+		return errors.New("root certificate is not a CA")
+	}
+	ca.root = pair.Leaf
+	ca.rootKey = key
+	ca.rootPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: pair.Leaf.Raw})
+	return nil
+}
+
+func (ca *CA) generateRoot() error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   rootCommonName,
+			Organization: []string{"GoDoxy"},
+		},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(rootLifetime),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		// clients trusting the root must not trust it for other domains
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         ca.cfg.permittedDNSDomains(),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return err
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(ca.dir, 0o700); err != nil {
+		return err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(ca.rootKeyPath(), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(ca.rootCertPath(), certPEM, 0o644); err != nil {
+		return err
+	}
+
+	ca.root = root
+	ca.rootKey = key
+	ca.rootPEM = certPEM
+	return nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128) // 128-bit random number
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serialNumber, nil
+}
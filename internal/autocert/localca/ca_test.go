@@ -0,0 +1,128 @@
+package localca
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestCA(t *testing.T, cfg *Config) *CA {
+	t.Helper()
+	require.NoError(t, cfg.Validate())
+	ca, err := New(t.TempDir(), cfg)
+	require.NoError(t, err)
+	return ca
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := &Config{}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, []string{".internal", ".lan", ".home.arpa"}, cfg.Domains)
+	require.Equal(t, DefaultLeafLifetime, cfg.LeafLifetime)
+
+	cfg = &Config{Domains: []string{"LAN", ".corp.internal"}, ACME: &ACMEConfig{Host: "CA.lan"}}
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, []string{".lan", ".corp.internal"}, cfg.Domains)
+	require.Equal(t, "ca.lan", cfg.ACME.Host)
+
+	require.ErrorContains(t, (&Config{Domains: []string{"*.lan"}}).Validate(), ErrInvalidDomain.Error())
+	require.ErrorContains(t, (&Config{LeafLifetime: time.Minute}).Validate(), ErrInvalidLeafLifetime.Error())
+	require.ErrorContains(t, (&Config{ACME: &ACMEConfig{Host: "ca.example.com"}}).Validate(), ErrInvalidDomain.Error())
+}
+
+func TestRootPersisted(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{}
+	require.NoError(t, cfg.Validate())
+
+	ca, err := New(dir, cfg)
+	require.NoError(t, err)
+	require.True(t, ca.Root().IsCA)
+	require.Equal(t, rootCommonName, ca.Root().Subject.CommonName)
+
+	reloaded, err := New(dir, cfg)
+	require.NoError(t, err)
+	require.Equal(t, ca.RootPEM(), reloaded.RootPEM())
+
+	changed := &Config{Domains: []string{".lan", ".corp"}}
+	require.NoError(t, changed.Validate())
+	regenerated, err := New(dir, changed)
+	require.NoError(t, err)
+	require.NotEqual(t, ca.RootPEM(), regenerated.RootPEM(), "domains changed")
+	require.Equal(t, []string{"corp", "lan"}, regenerated.Root().PermittedDNSDomains)
+}
+
+func TestRootNameConstraints(t *testing.T) {
+	ca := newTestCA(t, &Config{})
+	require.True(t, ca.Root().PermittedDNSDomainsCritical)
+	require.Equal(t, []string{"home.arpa", "internal", "lan"}, ca.Root().PermittedDNSDomains)
+
+	// a leaf for a name outside the domains does not verify, even if the root signs it
+	leaf, err := ca.newTLSCert(&x509.Certificate{
+		DNSNames:    []string{"bank.example.com"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	require.NoError(t, err)
+	_, err = leaf.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "bank.example.com",
+		Roots:   ca.RootPool(x509.NewCertPool()),
+	})
+	var invalid x509.CertificateInvalidError
+	require.ErrorAs(t, err, &invalid)
+	require.Equal(t, x509.CANotAuthorizedForThisName, invalid.Reason)
+}
+
+func TestGetCertificate(t *testing.T) {
+	ca := newTestCA(t, &Config{})
+
+	_, err := ca.GetCertificate("app.example.com")
+	require.ErrorIs(t, err, ErrNotCovered)
+	_, err = ca.GetCertificate("lan")
+	require.ErrorIs(t, err, ErrNotCovered)
+
+	cert, err := ca.GetCertificate("app.lan")
+	require.NoError(t, err)
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "app.lan",
+		Roots:   ca.RootPool(x509.NewCertPool()),
+	})
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now().Add(DefaultLeafLifetime), cert.Leaf.NotAfter, time.Minute)
+
+	cached, err := ca.GetCertificate("app.lan")
+	require.NoError(t, err)
+	require.Same(t, cert, cached)
+}
+
+func TestRotation(t *testing.T) {
+	ca := newTestCA(t, &Config{})
+	now := time.Now()
+	require.False(t, ca.shouldRotate(&x509.Certificate{NotBefore: now.Add(-time.Hour), NotAfter: now.Add(2 * time.Hour)}))
+	require.True(t, ca.shouldRotate(&x509.Certificate{NotBefore: now.Add(-2 * time.Hour), NotAfter: now.Add(time.Hour - time.Second)}))
+
+	cert, err := ca.GetCertificate("app.lan")
+	require.NoError(t, err)
+	// due for rotation
+	cert.Leaf.NotBefore = now.Add(-2 * time.Hour)
+	cert.Leaf.NotAfter = now.Add(30 * time.Minute)
+	rotated, err := ca.GetCertificate("app.lan")
+	require.NoError(t, err)
+	require.NotSame(t, cert, rotated)
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := newTestCA(t, &Config{})
+	cert, err := ca.ClientCertificate(nil)
+	require.NoError(t, err)
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		Roots:     ca.RootPool(x509.NewCertPool()),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	require.NoError(t, err)
+
+	cached, err := ca.ClientCertificate(nil)
+	require.NoError(t, err)
+	require.Same(t, cert, cached)
+}
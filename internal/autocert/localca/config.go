@@ -0,0 +1,115 @@
+package localca
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	Config struct {
+		// Domains are the domain suffixes certificates are issued for,
+		// default .internal, .lan and .home.arpa.
+		Domains []string `json:"domains,omitempty"`
+		// LeafLifetime is the lifetime of issued certificates, default 7 days.
+		// They are rotated after two thirds of it.
+		LeafLifetime time.Duration `json:"leaf_lifetime,omitempty" swaggertype:"primitive,integer"`
+		// ACME serves an ACME directory for other services to obtain certificates.
+		ACME *ACMEConfig `json:"acme,omitempty"`
+	}
+	ACMEConfig struct {
+		// Host is the hostname of the ACME directory on the entrypoint, e.g. ca.lan.
+		// It must be under Domains.
+		Host string `json:"host"`
+	}
+)
+
+const (
+	DefaultLeafLifetime = 7 * 24 * time.Hour
+	minLeafLifetime     = time.Hour
+	maxLeafLifetime     = 397 * 24 * time.Hour
+)
+
+var defaultDomains = []string{".internal", ".lan", ".home.arpa"}
+
+var (
+	ErrInvalidLeafLifetime = gperr.New("invalid leaf_lifetime")
+	ErrInvalidDomain       = gperr.New("invalid domain")
+)
+
+// Validate implements the serialization.CustomValidator interface.
+func (cfg *Config) Validate() error {
+	if len(cfg.Domains) == 0 {
+		cfg.Domains = defaultDomains
+	}
+	if cfg.LeafLifetime == 0 {
+		cfg.LeafLifetime = DefaultLeafLifetime
+	}
+
+	var b gperr.Builder
+	domains := make([]string, 0, len(cfg.Domains))
+	for i, d := range cfg.Domains {
+		d = "." + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), ".")
+		if d == "." || strings.Contains(d, "*") || !validHostname(d[1:]) {
+			b.Add(ErrInvalidDomain.Subjectf("domains[%d]", i))
+			continue
+		}
+		domains = append(domains, d)
+	}
+	cfg.Domains = domains
+
+	if cfg.LeafLifetime < minLeafLifetime || cfg.LeafLifetime > maxLeafLifetime {
+		b.Add(ErrInvalidLeafLifetime.Subject(cfg.LeafLifetime.String()).Withf("must be between %s and %s", minLeafLifetime, maxLeafLifetime))
+	}
+
+	if cfg.ACME != nil {
+		cfg.ACME.Host = strings.ToLower(strings.TrimSpace(cfg.ACME.Host))
+		if !cfg.matches(cfg.ACME.Host) {
+			b.Add(ErrInvalidDomain.Subject("acme.host").Withf("must be under one of %v", cfg.Domains))
+		}
+	}
+	return b.Error()
+}
+
+// matches reports whether host is a valid hostname under one of the configured domains.
+func (cfg *Config) matches(host string) bool {
+	if !validHostname(host) {
+		return false
+	}
+	for _, d := range cfg.Domains {
+		if strings.HasSuffix(host, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// permittedDNSDomains returns the name constraints of the root, the configured domains without the leading dot, sorted.
+func (cfg *Config) permittedDNSDomains() []string {
+	domains := make([]string, len(cfg.Domains))
+	for i, d := range cfg.Domains {
+		domains[i] = strings.TrimPrefix(d, ".")
+	}
+	slices.Sort(domains)
+	return slices.Compact(domains)
+}
+
+// validHostname reports whether host is a lowercase DNS hostname that is also safe as a file name.
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for label := range strings.SplitSeq(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, c := range []byte(label) {
+			if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,296 @@
+package autocert
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/yusing/godoxy/internal/notif"
+	strutils "github.com/yusing/goutils/strings"
+	"github.com/yusing/goutils/task"
+	"golang.org/x/crypto/ocsp"
+)
+
+type OCSPStatus string
+
+const (
+	OCSPStatusNone    OCSPStatus = ""        // no staple, e.g. the certificate has no OCSP responder
+	OCSPStatusGood    OCSPStatus = "good"    // a valid staple is served
+	OCSPStatusRevoked OCSPStatus = "revoked" // the certificate is revoked, it is renewed
+)
+
+const (
+	// refresh when no certificate or no OCSP responder, the certificate may change on renewal
+	ocspIdleInterval = 24 * time.Hour
+	// retry after the responder failed or answered unknown
+	ocspRetryInterval = 10 * time.Minute
+	// refresh responses without NextUpdate after this, they expire after twice this
+	ocspDefaultValidity = time.Hour
+	// refresh no more often than this, even if the responder suggests so
+	ocspMinRefreshInterval = time.Minute
+
+	ocspFetchTimeout   = 30 * time.Second
+	ocspMaxResponseLen = 1 << 20
+)
+
+var ocspHTTPClient = &http.Client{Timeout: ocspFetchTimeout}
+
+// OCSPStatus returns the OCSP status of the certificate and the time the staple expires.
+func (p *Provider) OCSPStatus() (status OCSPStatus, nextUpdate time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.ocspResp == nil {
+		return OCSPStatusNone, time.Time{}
+	}
+	if p.ocspResp.Status == ocsp.Revoked {
+		return OCSPStatusRevoked, time.Time{}
+	}
+	return OCSPStatusGood, ocspNextUpdate(p.ocspResp)
+}
+
+func ocspFileFor(certPath string) string {
+	return certPath + ".ocsp"
+}
+
+// scheduleOCSPRefresh keeps the OCSP staple of a local certificate fresh.
+// ACME providers refresh theirs in the renewal scheduler.
+//
+// Local certificates never change, so those without an OCSP responder are skipped.
+func (p *Provider) scheduleOCSPRefresh(parent task.Parent) {
+	if !hasOCSPResponder(p.getTLSCert()) {
+		return
+	}
+
+	task := parent.Subtask("ocsp-refresher:"+filepath.Base(p.cfg.CertPath), true)
+	go func() {
+		defer task.Finish(nil)
+
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-task.Context().Done():
+				return
+			case <-timer.C:
+				timer.Reset(p.refreshOCSP(task.Context()))
+			}
+		}
+	}()
+}
+
+// triggerOCSPRefresh refreshes the staple after the certificate changed.
+func (p *Provider) triggerOCSPRefresh() {
+	select {
+	case p.ocspRefreshCh <- struct{}{}:
+	default:
+	}
+}
+
+// refreshOCSP fetches a new OCSP response if the current one is due for refresh,
+// and returns when to check again.
+func (p *Provider) refreshOCSP(ctx context.Context) time.Duration {
+	cert := p.getTLSCert()
+	if !hasOCSPResponder(cert) {
+		return ocspIdleInterval
+	}
+
+	p.mu.RLock()
+	current := p.ocspResp
+	p.mu.RUnlock()
+	if current != nil && current.Status == ocsp.Good {
+		if refreshAt := ocspRefreshTime(current); time.Now().Before(refreshAt) {
+			return time.Until(refreshAt)
+		}
+	}
+
+	issuer, err := ocspIssuer(ctx, cert)
+	if err == nil {
+		var raw []byte
+		var resp *ocsp.Response
+		raw, resp, err = fetchOCSP(ctx, cert.Leaf, issuer)
+		if err == nil {
+			return p.handleOCSPResponse(ctx, cert, raw, resp)
+		}
+	}
+
+	logger := p.logger.With().Str("responder", cert.Leaf.OCSPServer[0]).Logger()
+	if current != nil && time.Now().After(ocspNextUpdate(current)) && p.setOCSPStaple(cert, nil, nil) {
+		// clients reject expired staples, serving none is better
+		logger.Warn().Err(err).Msg("OCSP responder unavailable, staple expired and removed")
+	} else {
+		logger.Debug().Err(err).Msg("OCSP responder unavailable, keeping current staple")
+	}
+	return ocspRetryInterval
+}
+
+func (p *Provider) handleOCSPResponse(ctx context.Context, cert *tls.Certificate, raw []byte, resp *ocsp.Response) time.Duration {
+	switch resp.Status {
+	case ocsp.Good:
+		if !p.setOCSPStaple(cert, raw, resp) {
+			return 0 // certificate changed, refresh for the new one
+		}
+		p.saveOCSPStaple(raw)
+		p.logger.Debug().Time("next_update", ocspNextUpdate(resp)).Msg("OCSP staple updated")
+		return max(time.Until(ocspRefreshTime(resp)), ocspMinRefreshInterval)
+	case ocsp.Revoked:
+		p.mu.RLock()
+		wasRevoked := p.ocspResp != nil && p.ocspResp.Status == ocsp.Revoked
+		p.mu.RUnlock()
+		if !p.setOCSPStaple(cert, nil, resp) {
+			return 0
+		}
+		if !wasRevoked {
+			action := "renewing"
+			if p.cfg.Provider == ProviderLocal {
+				action = "replace it"
+			}
+			p.logger.Error().Time("revoked_at", resp.RevokedAt).Msg("certificate revoked, " + action)
+			notif.FromCtx(ctx).Notify(&notif.LogMessage{
+				Level:  zerolog.ErrorLevel,
+				Title:  "SSL certificate revoked for " + p.GetName(),
+				Body:   notif.MessageBody("revoked at " + strutils.FormatTime(resp.RevokedAt) + ", " + action),
+				Source: notif.SourceAutocert,
+			})
+		}
+		// retried until renewed, at the pace of the renewal cooldown
+		select {
+		case p.renewCh <- struct{}{}:
+		default:
+		}
+		return renewalCooldownDuration
+	default:
+		p.logger.Debug().Msg("OCSP responder does not know the certificate yet")
+		return ocspRetryInterval
+	}
+}
+
+// setOCSPStaple replaces the staple of cert, returning false if cert is no longer current.
+func (p *Provider) setOCSPStaple(cert *tls.Certificate, staple []byte, resp *ocsp.Response) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tlsCert != cert {
+		return false
+	}
+	stapled := *cert
+	stapled.OCSPStaple = staple
+	p.tlsCert = &stapled
+	p.ocspResp = resp
+	return true
+}
+
+// loadOCSPStaple staples the cached OCSP response of the certificate if it is still valid.
+func (p *Provider) loadOCSPStaple() {
+	cert := p.getTLSCert()
+	if !hasOCSPResponder(cert) {
+		return
+	}
+	raw, err := p.cfg.getStorage().Load(context.Background(), ocspFileFor(p.cfg.CertPath))
+	if err != nil {
+		return
+	}
+	issuer, err := ocspIssuerFromChain(cert)
+	if err != nil {
+		return
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, cert.Leaf, issuer)
+	if err != nil || resp.Status != ocsp.Good || time.Now().After(ocspNextUpdate(resp)) {
+		return
+	}
+	p.setOCSPStaple(cert, raw, resp)
+}
+
+func (p *Provider) saveOCSPStaple(raw []byte) {
+	if p.cfg.skipStorage() {
+		return
+	}
+	if err := p.cfg.getStorage().Store(context.Background(), ocspFileFor(p.cfg.CertPath), raw, false); err != nil {
+		p.logger.Debug().Err(err).Msg("failed to cache OCSP staple")
+	}
+}
+
+func hasOCSPResponder(cert *tls.Certificate) bool {
+	return cert != nil && cert.Leaf != nil && len(cert.Leaf.OCSPServer) > 0
+}
+
+// ocspNextUpdate returns when resp expires.
+func ocspNextUpdate(resp *ocsp.Response) time.Time {
+	if resp.NextUpdate.IsZero() {
+		return resp.ThisUpdate.Add(2 * ocspDefaultValidity)
+	}
+	return resp.NextUpdate
+}
+
+// ocspRefreshTime returns halfway through the validity of resp.
+func ocspRefreshTime(resp *ocsp.Response) time.Time {
+	if resp.NextUpdate.IsZero() {
+		return resp.ThisUpdate.Add(ocspDefaultValidity)
+	}
+	return resp.ThisUpdate.Add(resp.NextUpdate.Sub(resp.ThisUpdate) / 2)
+}
+
+func ocspIssuerFromChain(cert *tls.Certificate) (*x509.Certificate, error) {
+	if len(cert.Certificate) < 2 {
+		return nil, errors.New("no issuer certificate in chain")
+	}
+	return x509.ParseCertificate(cert.Certificate[1])
+}
+
+// ocspIssuer returns the issuer of cert from its chain, or from its issuing certificate URL.
+func ocspIssuer(ctx context.Context, cert *tls.Certificate) (*x509.Certificate, error) {
+	if issuer, err := ocspIssuerFromChain(cert); err == nil {
+		return issuer, nil
+	}
+	if len(cert.Leaf.IssuingCertificateURL) == 0 {
+		return nil, errors.New("no issuer certificate in chain and no issuing certificate URL")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cert.Leaf.IssuingCertificateURL[0], nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := doOCSPRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch issuer certificate: %w", err)
+	}
+	return x509.ParseCertificate(body)
+}
+
+func fetchOCSP(ctx context.Context, leaf, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	ocspReq, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(ocspReq))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	raw, err := doOCSPRequest(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, nil, err
+	}
+	return raw, resp, nil
+}
+
+func doOCSPRequest(req *http.Request) ([]byte, error) {
+	resp, err := ocspHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, ocspMaxResponseLen))
+}
@@ -0,0 +1,191 @@
+package autocert
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testOCSPResponder answers OCSP requests for certificates issued by its issuer.
+type testOCSPResponder struct {
+	issuer    *x509.Certificate
+	issuerKey crypto.Signer
+
+	status     atomic.Int32 // ocsp.Good, ocsp.Revoked, or -1 to fail
+	nextUpdate time.Duration
+	requests   atomic.Int32
+}
+
+func (r *testOCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	status := int(r.status.Load())
+	if status < 0 {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	ocspReq, err := ocsp.ParseRequest(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	now := time.Now()
+	resp, err := ocsp.CreateResponse(r.issuer, r.issuer, ocsp.Response{
+		Status:       status,
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   now.Add(-time.Minute),
+		NextUpdate:   now.Add(r.nextUpdate),
+		RevokedAt:    now.Add(-time.Minute),
+	}, r.issuerKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(resp)
+}
+
+// newTestOCSPProvider returns a provider with a certificate whose OCSP responder is responder.
+func newTestOCSPProvider(t *testing.T) (*Provider, *testOCSPResponder) {
+	t.Helper()
+	issuerKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	issuerDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "Test CA"}}, issuerKey.Public(), issuerKey)
+	require.NoError(t, err)
+	issuer, err := x509.ParseCertificate(issuerDER)
+	require.NoError(t, err)
+
+	responder := &testOCSPResponder{issuer: issuer, issuerKey: issuerKey, nextUpdate: time.Hour}
+	srv := httptest.NewServer(responder)
+	t.Cleanup(srv.Close)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "app.example.com"},
+		DNSNames:     []string{"app.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 90),
+		OCSPServer:   []string{srv.URL},
+	}, issuer, leafKey.Public(), issuerKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafDER)
+	require.NoError(t, err)
+
+	p := &Provider{
+		cfg:     &Config{Provider: ProviderACME, CertPath: t.TempDir() + "/cert.crt"},
+		renewCh: make(chan struct{}, 1),
+		tlsCert: &tls.Certificate{Certificate: [][]byte{leafDER, issuerDER}, PrivateKey: leafKey, Leaf: leaf},
+		certExpiries: CertExpiries{
+			"app.example.com": leaf.NotAfter,
+		},
+	}
+	return p, responder
+}
+
+func TestOCSPStaple(t *testing.T) {
+	p, responder := newTestOCSPProvider(t)
+
+	next := p.refreshOCSP(t.Context())
+	require.NotEmpty(t, p.getTLSCert().OCSPStaple)
+	status, nextUpdate := p.OCSPStatus()
+	require.Equal(t, OCSPStatusGood, status)
+	require.WithinDuration(t, time.Now().Add(time.Hour), nextUpdate, time.Minute)
+	require.InDelta(t, 29*time.Minute, next, float64(time.Minute), "refreshed halfway through the validity")
+
+	// not refreshed before halfway
+	p.refreshOCSP(t.Context())
+	require.EqualValues(t, 1, responder.requests.Load())
+}
+
+func TestOCSPResponderUnavailable(t *testing.T) {
+	p, responder := newTestOCSPProvider(t)
+	p.refreshOCSP(t.Context())
+	staple := p.getTLSCert().OCSPStaple
+	require.NotEmpty(t, staple)
+
+	responder.status.Store(-1)
+	p.mu.Lock()
+	p.ocspResp.ThisUpdate = time.Now().Add(-time.Hour) // due for refresh
+	p.mu.Unlock()
+	require.Equal(t, ocspRetryInterval, p.refreshOCSP(t.Context()))
+	require.Equal(t, staple, p.getTLSCert().OCSPStaple, "valid staple is kept")
+
+	p.mu.Lock()
+	p.ocspResp.NextUpdate = time.Now().Add(-time.Second)
+	p.mu.Unlock()
+	p.refreshOCSP(t.Context())
+	require.Empty(t, p.getTLSCert().OCSPStaple, "expired staple is removed")
+	status, _ := p.OCSPStatus()
+	require.Equal(t, OCSPStatusNone, status)
+}
+
+func TestOCSPResponderUnavailableWithoutNextUpdate(t *testing.T) {
+	p, responder := newTestOCSPProvider(t)
+	p.refreshOCSP(t.Context())
+	staple := p.getTLSCert().OCSPStaple
+	require.NotEmpty(t, staple)
+
+	responder.status.Store(-1)
+	p.mu.Lock()
+	p.ocspResp.NextUpdate = time.Time{}
+	p.ocspResp.ThisUpdate = time.Now().Add(-ocspDefaultValidity) // due for refresh
+	p.mu.Unlock()
+	p.refreshOCSP(t.Context())
+	require.Equal(t, staple, p.getTLSCert().OCSPStaple, "valid staple is kept")
+	_, nextUpdate := p.OCSPStatus()
+	require.WithinDuration(t, time.Now().Add(ocspDefaultValidity), nextUpdate, time.Minute)
+
+	p.mu.Lock()
+	p.ocspResp.ThisUpdate = time.Now().Add(-2 * ocspDefaultValidity)
+	p.mu.Unlock()
+	p.refreshOCSP(t.Context())
+	require.Empty(t, p.getTLSCert().OCSPStaple, "expired staple is removed")
+}
+
+func TestOCSPRevoked(t *testing.T) {
+	p, responder := newTestOCSPProvider(t)
+	responder.status.Store(ocsp.Revoked)
+
+	p.refreshOCSP(t.Context())
+	require.Empty(t, p.getTLSCert().OCSPStaple)
+	status, _ := p.OCSPStatus()
+	require.Equal(t, OCSPStatusRevoked, status)
+	require.Equal(t, CertStateRevoked, p.certState())
+	require.Len(t, p.renewCh, 1, "renewal is triggered")
+
+	// a new certificate drops the revoked status
+	p.setTLSCert(&tls.Certificate{}, nil, "")
+	status, _ = p.OCSPStatus()
+	require.Equal(t, OCSPStatusNone, status)
+}
+
+func TestOCSPStapleCertChanged(t *testing.T) {
+	p, _ := newTestOCSPProvider(t)
+	cert := p.getTLSCert()
+	p.setTLSCert(&tls.Certificate{}, nil, "")
+	require.False(t, p.setOCSPStaple(cert, []byte("staple"), &ocsp.Response{Status: ocsp.Good}))
+	require.Empty(t, p.getTLSCert().OCSPStaple)
+}
@@ -0,0 +1,346 @@
+package autocert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-acme/lego/v5/lego"
+	"github.com/puzpuzpuz/xsync/v4"
+	"golang.org/x/net/publicsuffix"
+	"golang.org/x/time/rate"
+)
+
+type (
+	// OnDemandConfig enables obtaining a certificate per hostname at its first TLS handshake,
+	// for hostnames served by a route but not covered by the configured certificates.
+	OnDemandConfig struct {
+		// RateLimit is the maximum number of certificates obtained per hour for each registered domain.
+		RateLimit int `json:"rate_limit,omitempty"`
+	}
+
+	onDemand struct {
+		main       *Provider
+		perHour    int
+		lookupHost func(ctx context.Context, host string) ([]string, error)
+
+		providers *xsync.Map[string, *Provider] // hostname -> provider
+
+		mu       sync.Mutex
+		limiters map[string]*rate.Limiter // registered domain -> limiter
+		pending  map[string]*onDemandRequest
+		failures map[string]time.Time // hostname -> last failed attempt
+	}
+
+	onDemandRequest struct {
+		done chan struct{}
+		cert *tls.Certificate
+		err  error
+	}
+)
+
+const (
+	onDemandCertDir           = certBasePath + "on_demand/"
+	onDemandDefaultRateLimit  = 10
+	onDemandRetryAfter        = 10 * time.Minute
+	onDemandObtainTimeout     = 2 * time.Minute
+	onDemandMaxPendingObtains = 16
+	onDemandLookupTimeout     = 5 * time.Second
+	onDemandMaxLimiters       = 1024
+)
+
+var (
+	ErrOnDemandNotAllowed  = errors.New("hostname is not served by any route")
+	ErrOnDemandRateLimited = errors.New("on-demand certificate rate limit exceeded")
+	ErrOnDemandRetryLater  = errors.New("on-demand certificate recently failed")
+	ErrOnDemandInvalidHost = errors.New("invalid hostname for on-demand certificate")
+	ErrOnDemandNoDNS       = errors.New("hostname does not resolve")
+)
+
+// onDemandHostRE matches hostnames that are also safe as file names.
+var onDemandHostRE = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9-]{2,63}$`)
+
+func (cfg *OnDemandConfig) rateLimit() int {
+	if cfg.RateLimit <= 0 {
+		return onDemandDefaultRateLimit
+	}
+	return cfg.RateLimit
+}
+
+func newOnDemand(main *Provider) *onDemand {
+	return &onDemand{
+		main:       main,
+		perHour:    main.cfg.OnDemand.rateLimit(),
+		lookupHost: net.DefaultResolver.LookupHost,
+		providers:  xsync.NewMap[string, *Provider](),
+		limiters:   make(map[string]*rate.Limiter),
+		pending:    make(map[string]*onDemandRequest),
+		failures:   make(map[string]time.Time),
+	}
+}
+
+// limiterLocked returns the rate limiter of the registered domain of host, e.g. example.com for app.example.com,
+// so hostnames of one domain cannot use up the budget of the others.
+//
+// It must be called with od.mu held.
+func (od *onDemand) limiterLocked(host string) *rate.Limiter {
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		domain = host
+	}
+	if limiter, ok := od.limiters[domain]; ok {
+		return limiter
+	}
+	if len(od.limiters) >= onDemandMaxLimiters {
+		// a full limiter is the same as a new one
+		for domain, limiter := range od.limiters {
+			if limiter.Tokens() >= float64(limiter.Burst()) {
+				delete(od.limiters, domain)
+			}
+		}
+	}
+	limiter := rate.NewLimiter(rate.Every(time.Hour/time.Duration(od.perHour)), od.perHour)
+	od.limiters[domain] = limiter
+	return limiter
+}
+
+// SetOnDemandAllowFunc sets the check of whether a hostname may get an on-demand
+// or local CA certificate, e.g. whether a route serves it.
+// No hostname is allowed until it is set.
+func (p *Provider) SetOnDemandAllowFunc(allow func(host string) bool) {
+	p.allowHost.Store(&allow)
+}
+
+func (p *Provider) onDemandAllowed(host string) bool {
+	allow := p.allowHost.Load()
+	return allow != nil && (*allow)(host)
+}
+
+// onDemandProviders returns the providers of on-demand certificates, ordered by hostname.
+func (p *Provider) onDemandProviders() []*Provider {
+	if p.onDemand == nil {
+		return nil
+	}
+	providers := make([]*Provider, 0, p.onDemand.providers.Size())
+	for _, provider := range p.onDemand.providers.Range {
+		providers = append(providers, provider)
+	}
+	slices.SortFunc(providers, func(a, b *Provider) int {
+		return strings.Compare(a.cfg.onDemandHost, b.cfg.onDemandHost)
+	})
+	return providers
+}
+
+// setupOnDemand loads the on-demand certificates obtained before.
+func (p *Provider) setupOnDemand() error {
+	if p.cfg.OnDemand == nil {
+		return nil
+	}
+	p.onDemand = newOnDemand(p)
+
+	keys, err := p.cfg.getStorage().List(context.Background(), onDemandCertDir)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		host, ok := strings.CutSuffix(strings.TrimPrefix(key, onDemandCertDir), ".crt")
+		if !ok || !onDemandHostRE.MatchString(host) {
+			continue
+		}
+		provider, err := p.onDemand.newProvider(host)
+		if err != nil {
+			p.logger.Warn().Err(err).Str("host", host).Msg("failed to setup on-demand cert")
+			continue
+		}
+		if err := provider.loadCert(); err != nil {
+			p.logger.Warn().Err(err).Str("host", host).Msg("failed to load on-demand cert")
+			continue
+		}
+		p.onDemand.providers.Store(host, provider)
+	}
+	return nil
+}
+
+// newProvider returns a provider for host, sharing the ACME account of the main provider.
+func (od *onDemand) newProvider(host string) (*Provider, error) {
+	main := od.main
+
+	cfg := *main.cfg
+	cfg.Extra = nil
+	cfg.OnDemand = nil
+	cfg.LocalCA = nil
+	cfg.Domains = []string{host}
+	cfg.CertPath = filepath.Join(onDemandCertDir, host+".crt")
+	cfg.KeyPath = filepath.Join(onDemandCertDir, host+".key")
+	cfg.onDemandHost = host
+
+	main.mu.RLock()
+	user := &User{
+		Email:        main.user.Email,
+		Registration: main.user.Registration,
+		Key:          main.user.Key,
+	}
+	main.mu.RUnlock()
+
+	legoCfg := lego.NewConfig(user)
+	legoCfg.CADirURL = main.legoCfg.CADirURL
+	legoCfg.HTTPClient = cloneHTTPClient(main.legoCfg.HTTPClient)
+
+	provider, err := NewProvider(&cfg, user, legoCfg)
+	if err != nil {
+		return nil, err
+	}
+	provider.parent = main
+	return provider, nil
+}
+
+// getCert returns the on-demand certificate of the hostname in hello,
+// obtaining it if the hostname is allowed.
+func (od *onDemand) getCert(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := normalizeServerName(hello.ServerName)
+	if provider, ok := od.providers.Load(host); ok {
+		if cert := provider.getTLSCert(); cert != nil {
+			return cert, nil
+		}
+	}
+	if net.ParseIP(host) != nil || !onDemandHostRE.MatchString(host) {
+		return nil, ErrOnDemandInvalidHost
+	}
+
+	ctx := hello.Context()
+	if ctx == nil { // not from a handshake
+		ctx = context.Background()
+	}
+	req, err := od.request(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handshake may give up earlier, the certificate is obtained anyway
+	select {
+	case <-req.done:
+		return req.cert, req.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// request returns the pending request of host, or starts one
+// if host is allowed and resolves in DNS.
+func (od *onDemand) request(ctx context.Context, host string) (*onDemandRequest, error) {
+	od.mu.Lock()
+	if req, ok := od.pending[host]; ok {
+		od.mu.Unlock()
+		return req, nil
+	}
+	if err := od.checkLocked(host); err != nil {
+		od.mu.Unlock()
+		return nil, err
+	}
+	od.mu.Unlock()
+
+	// a name without DNS records cannot pass the challenge, do not spend a token on it
+	lookupCtx, cancel := context.WithTimeout(ctx, onDemandLookupTimeout)
+	_, err := od.lookupHost(lookupCtx, host)
+	cancel()
+
+	od.mu.Lock()
+	defer od.mu.Unlock()
+
+	if req, ok := od.pending[host]; ok {
+		return req, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		od.failures[host] = time.Now()
+		return nil, fmt.Errorf("%w: %w", ErrOnDemandNoDNS, err)
+	}
+	if err := od.checkLocked(host); err != nil {
+		return nil, err
+	}
+	if len(od.pending) >= onDemandMaxPendingObtains || !od.limiterLocked(host).Allow() {
+		return nil, ErrOnDemandRateLimited
+	}
+
+	req := &onDemandRequest{done: make(chan struct{})}
+	od.pending[host] = req
+	go od.obtain(host, req)
+	return req, nil
+}
+
+// checkLocked returns an error if host recently failed or is not allowed.
+//
+// It must be called with od.mu held.
+func (od *onDemand) checkLocked(host string) error {
+	if failedAt, ok := od.failures[host]; ok {
+		if time.Since(failedAt) < onDemandRetryAfter {
+			return ErrOnDemandRetryLater
+		}
+		delete(od.failures, host)
+	}
+	if !od.main.onDemandAllowed(host) {
+		return ErrOnDemandNotAllowed
+	}
+	return nil
+}
+
+func (od *onDemand) obtain(host string, req *onDemandRequest) {
+	defer close(req.done)
+
+	req.cert, req.err = od.obtainCert(host)
+
+	od.mu.Lock()
+	delete(od.pending, host)
+	if req.err != nil {
+		od.failures[host] = time.Now()
+	}
+	od.mu.Unlock()
+
+	if req.err != nil {
+		od.main.logger.Warn().Err(req.err).Str("host", host).Msg("failed to obtain on-demand cert")
+		return
+	}
+	od.main.logger.Info().Str("host", host).Msg("obtained on-demand cert")
+}
+
+func (od *onDemand) obtainCert(host string) (*tls.Certificate, error) {
+	provider, err := od.newProvider(host)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	if parent := od.main.getRenewalParent(); parent != nil {
+		ctx = parent.Context()
+	}
+	ctx, cancel := context.WithTimeout(ctx, onDemandObtainTimeout)
+	defer cancel()
+
+	if err := provider.ObtainCert(ctx); err != nil {
+		return nil, err
+	}
+	cert := provider.getTLSCert()
+	if cert == nil {
+		return nil, fmt.Errorf("no certificate obtained for %s", host)
+	}
+
+	od.providers.Store(host, provider)
+	od.main.rebuildSNIMatcher()
+	// read after storing the provider, or ScheduleRenewalAll may miss it
+	if parent := od.main.getRenewalParent(); parent != nil {
+		provider.scheduleRenewalOnce.Do(func() {
+			provider.scheduleRenewal(parent)
+		})
+	}
+	return cert, nil
+}
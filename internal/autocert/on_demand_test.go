@@ -0,0 +1,90 @@
+package autocert
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOnDemand(t *testing.T, rateLimit int, allowed ...string) *onDemand {
+	t.Helper()
+	od := newOnDemand(&Provider{cfg: &Config{OnDemand: &OnDemandConfig{RateLimit: rateLimit}}})
+	allow := func(host string) bool {
+		for _, h := range allowed {
+			if h == host {
+				return true
+			}
+		}
+		return false
+	}
+	od.main.SetOnDemandAllowFunc(allow)
+	od.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		return []string{"192.0.2.1"}, nil
+	}
+	return od
+}
+
+func TestOnDemandInvalidHost(t *testing.T) {
+	od := newTestOnDemand(t, 0)
+	for _, host := range []string{"", "localhost", "127.0.0.1", "::1", "a_b.example.com", "../example.com", "-a.example.com"} {
+		_, err := od.getCert(&tls.ClientHelloInfo{ServerName: host})
+		require.ErrorIs(t, err, ErrOnDemandInvalidHost, host)
+	}
+}
+
+func TestOnDemandRequest(t *testing.T) {
+	t.Run("not allowed", func(t *testing.T) {
+		od := newTestOnDemand(t, 0, "app.example.com")
+		_, err := od.request(t.Context(), "other.example.com")
+		require.ErrorIs(t, err, ErrOnDemandNotAllowed)
+
+		od.main.allowHost.Store(nil)
+		_, err = od.request(t.Context(), "app.example.com")
+		require.ErrorIs(t, err, ErrOnDemandNotAllowed, "nothing is allowed without an allow func")
+	})
+
+	t.Run("rate limited", func(t *testing.T) {
+		od := newTestOnDemand(t, 1, "app.example.com")
+		require.True(t, od.limiterLocked("api.example.com").Allow())
+		_, err := od.request(t.Context(), "app.example.com")
+		require.ErrorIs(t, err, ErrOnDemandRateLimited, "hostnames of a registered domain share the limit")
+		require.True(t, od.limiterLocked("app.example.org").Allow(), "other domains have their own limit")
+	})
+
+	t.Run("not resolving", func(t *testing.T) {
+		od := newTestOnDemand(t, 1, "app.example.com")
+		od.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+			return nil, errors.New("no such host")
+		}
+		_, err := od.request(t.Context(), "app.example.com")
+		require.ErrorIs(t, err, ErrOnDemandNoDNS)
+		require.Contains(t, od.failures, "app.example.com")
+		require.True(t, od.limiterLocked("app.example.com").Allow(), "no token is spent")
+	})
+
+	t.Run("pending requests are shared", func(t *testing.T) {
+		od := newTestOnDemand(t, 0, "app.example.com")
+		pending := &onDemandRequest{done: make(chan struct{})}
+		od.pending["app.example.com"] = pending
+		req, err := od.request(t.Context(), "app.example.com")
+		require.NoError(t, err)
+		require.Same(t, pending, req)
+	})
+
+	t.Run("retry after failure", func(t *testing.T) {
+		od := newTestOnDemand(t, 1, "app.example.com")
+		od.failures["app.example.com"] = time.Now()
+		_, err := od.request(t.Context(), "app.example.com")
+		require.ErrorIs(t, err, ErrOnDemandRetryLater)
+
+		od.failures["app.example.com"] = time.Now().Add(-onDemandRetryAfter)
+		require.True(t, od.limiterLocked("app.example.com").Allow()) // expire the backoff without obtaining
+		_, err = od.request(t.Context(), "app.example.com")
+		require.ErrorIs(t, err, ErrOnDemandRateLimited)
+		require.NotContains(t, od.failures, "app.example.com")
+	})
+}
@@ -4,4 +4,5 @@ const (
 	certBasePath    = "certs/"
 	CertFileDefault = certBasePath + "cert.crt"
 	KeyFileDefault  = certBasePath + "priv.key"
+	localCADir      = certBasePath + "local_ca/"
 )
@@ -9,7 +9,6 @@ import (
 	"fmt"
 	"io/fs"
 	"maps"
-	"os"
 	"path/filepath"
 	"slices"
 	"strings"
@@ -18,16 +17,19 @@ import (
 	"time"
 
 	"github.com/go-acme/lego/v5/certificate"
+	"github.com/go-acme/lego/v5/challenge"
 	"github.com/go-acme/lego/v5/lego"
 	"github.com/go-acme/lego/v5/registration"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/autocert/acmechallenge"
+	"github.com/yusing/godoxy/internal/autocert/localca"
 	autocert "github.com/yusing/godoxy/internal/autocert/types"
-	"github.com/yusing/godoxy/internal/common"
 	"github.com/yusing/godoxy/internal/notif"
 	gperr "github.com/yusing/goutils/errs"
 	strutils "github.com/yusing/goutils/strings"
 	"github.com/yusing/goutils/task"
+	"golang.org/x/crypto/ocsp"
 )
 
 type (
@@ -48,12 +50,27 @@ type (
 		legoCert     *certificate.Resource
 		tlsCert      *tls.Certificate
 		certExpiries CertExpiries
+		certVersion  string         // storage version of the loaded certificate
+		ocspResp     *ocsp.Response // response of the current staple, nil if none
+		renewalInfo  *renewalInfo   // nil if the CA does not support ARI
 
 		extraProviders []*Provider
+		parent         *Provider // main provider of an extra or on-demand provider
 		sniMatcher     sniMatcher
 
+		onDemand      *onDemand   // nil if on-demand certificates are disabled
+		renewalParent task.Parent // set by ScheduleRenewalAll, for on-demand providers
+		localCA       *localca.CA // nil if the local CA is disabled
+		allowHost     atomic.Pointer[func(host string) bool]
+
+		routes         atomic.Pointer[func() []RouteHostnames]
+		inboundMTLSCAs atomic.Pointer[map[string][]*x509.Certificate]
+		expiryAlerted  map[string]int // cert name/serial -> smallest threshold alerted, owned by the expiry checker
+
 		forceRenewalCh     chan struct{}
-		forceRenewalDoneCh atomic.Value // chan struct{}
+		forceRenewalDoneCh atomic.Value  // chan struct{}
+		renewCh            chan struct{} // renew if needed, e.g. after revocation
+		ocspRefreshCh      chan struct{}
 
 		scheduleRenewalOnce sync.Once
 	}
@@ -84,38 +101,63 @@ func NewProvider(cfg *Config, user *User, legoCfg *lego.Config) (*Provider, erro
 		legoCfg:         legoCfg,
 		lastFailureFile: lastFailureFileFor(cfg.CertPath, cfg.KeyPath),
 		forceRenewalCh:  make(chan struct{}, 1),
+		renewCh:         make(chan struct{}, 1),
+		ocspRefreshCh:   make(chan struct{}, 1),
 	}
 	p.forceRenewalDoneCh.Store(emptyForceRenewalDoneCh)
 
-	if cfg.idx == 0 {
-		p.logger = log.With().Str("provider", "main").Logger()
-	} else {
-		p.logger = log.With().Str("provider", fmt.Sprintf("extra[%d]", cfg.idx)).Logger()
-	}
+	p.logger = log.With().Str("provider", p.GetName()).Logger()
 	if err := p.setupExtraProviders(); err != nil {
 		return nil, err
 	}
+	if err := p.setupOnDemand(); err != nil {
+		return nil, p.fmtError(err)
+	}
+	if cfg.LocalCA != nil {
+		ca, err := localca.New(localCADir, cfg.LocalCA)
+		if err != nil {
+			return nil, p.fmtError(err)
+		}
+		p.localCA = ca
+	}
 	return p, nil
 }
 
 func (p *Provider) GetCert(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if acmechallenge.IsTLSALPN01(hello) {
+		return acmechallenge.GetCertificate(hello)
+	}
+	if hello != nil && hello.ServerName != "" {
+		if prov := p.getSNIMatcher().match(hello.ServerName); prov != nil {
+			if cert := prov.getTLSCert(); cert != nil {
+				return cert, nil
+			}
+		}
+		if host := normalizeServerName(hello.ServerName); p.localCA != nil && p.localCA.Matches(host) {
+			if p.onDemandAllowed(host) || p.localCA.IsACMEHost(host) {
+				return p.localCA.GetCertificate(host)
+			}
+			p.logger.Debug().Str("host", hello.ServerName).Msg("local CA cert denied, hostname is not served by any route")
+		} else if p.onDemand != nil {
+			cert, err := p.onDemand.getCert(hello)
+			if err == nil {
+				return cert, nil
+			}
+			// obtain failures are logged once by the on-demand obtainer
+			p.logger.Debug().Err(err).Str("host", hello.ServerName).Msg("on-demand cert unavailable")
+		}
+	}
+	// the main cert may not exist yet while extra providers have theirs,
+	// e.g. when it is obtained after the entrypoint started
 	tlsCert := p.getTLSCert()
 	if tlsCert == nil {
 		return nil, ErrNoCertificates
 	}
-	if hello == nil || hello.ServerName == "" {
-		return tlsCert, nil
-	}
-	if prov := p.getSNIMatcher().match(hello.ServerName); prov != nil {
-		if cert := prov.getTLSCert(); cert != nil {
-			return cert, nil
-		}
-	}
 	return tlsCert, nil
 }
 
 func (p *Provider) GetCertInfos() ([]autocert.CertInfo, error) {
-	allProviders := p.allProviders()
+	allProviders := append(p.allProviders(), p.onDemandProviders()...)
 	certInfos := make([]autocert.CertInfo, 0, len(allProviders))
 	for _, provider := range allProviders {
 		tlsCert := provider.getTLSCert()
@@ -139,6 +181,9 @@ func (p *Provider) GetCertInfos() ([]autocert.CertInfo, error) {
 }
 
 func (p *Provider) GetName() string {
+	if p.cfg.onDemandHost != "" {
+		return "on_demand[" + p.cfg.onDemandHost + "]"
+	}
 	if p.cfg.idx == 0 {
 		return "main"
 	}
@@ -149,6 +194,34 @@ func (p *Provider) fmtError(err error) error {
 	return gperr.PrependSubject(err, "provider: "+p.GetName())
 }
 
+// LocalCA returns the local CA, or nil if it is disabled.
+func (p *Provider) LocalCA() *localca.CA {
+	return p.localCA
+}
+
+// DefaultDomain returns the domain of the loaded certificate, its common name or first DNS name
+// without the wildcard, or empty when no certificate is loaded.
+func (p *Provider) DefaultDomain() string {
+	cert := p.getTLSCert()
+	if cert == nil || len(cert.Certificate) == 0 {
+		return ""
+	}
+	leaf := cert.Leaf
+	if leaf == nil {
+		var err error
+		if leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return ""
+		}
+	}
+	domain := leaf.Subject.CommonName
+	if domain == "" && len(leaf.DNSNames) > 0 {
+		domain = leaf.DNSNames[0]
+	}
+	domain = strings.TrimSpace(domain)
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.ToLower(domain)
+}
+
 func (p *Provider) GetCertPath() string {
 	return p.cfg.CertPath
 }
@@ -164,7 +237,7 @@ func (p *Provider) GetExpiries() CertExpiries {
 }
 
 func (p *Provider) GetLastFailure() (time.Time, error) {
-	if common.IsTest {
+	if p.cfg.skipStorage() {
 		return time.Time{}, nil
 	}
 
@@ -173,9 +246,9 @@ func (p *Provider) GetLastFailure() (time.Time, error) {
 	p.mu.RUnlock()
 
 	if lastFailure.IsZero() {
-		data, err := os.ReadFile(p.lastFailureFile)
+		data, err := p.cfg.getStorage().Load(context.Background(), p.lastFailureFile)
 		if err != nil {
-			if !os.IsNotExist(err) {
+			if !errors.Is(err, fs.ErrNotExist) {
 				return time.Time{}, err
 			}
 		} else {
@@ -190,28 +263,24 @@ func (p *Provider) GetLastFailure() (time.Time, error) {
 }
 
 func (p *Provider) UpdateLastFailure() error {
-	if common.IsTest {
+	if p.cfg.skipStorage() {
 		return nil
 	}
 	t := time.Now()
 	p.mu.Lock()
 	p.lastFailure = t
 	p.mu.Unlock()
-	return os.WriteFile(p.lastFailureFile, t.AppendFormat(nil, time.RFC3339), 0o600)
+	return p.cfg.getStorage().Store(context.Background(), p.lastFailureFile, t.AppendFormat(nil, time.RFC3339), true)
 }
 
 func (p *Provider) ClearLastFailure() error {
-	if common.IsTest {
+	if p.cfg.skipStorage() {
 		return nil
 	}
 	p.mu.Lock()
 	p.lastFailure = time.Time{}
 	p.mu.Unlock()
-	err := os.Remove(p.lastFailureFile)
-	if err != nil && !errors.Is(err, fs.ErrNotExist) {
-		return err
-	}
-	return nil
+	return p.cfg.getStorage().Delete(context.Background(), p.lastFailureFile)
 }
 
 // allProviders returns all providers including this provider and all extra providers.
@@ -262,6 +331,18 @@ func (p *Provider) obtainCertIfNotExists(ctx context.Context) error {
 		return err
 	}
 
+	// only on-demand certificates are obtained
+	if len(p.cfg.Domains) == 0 {
+		return nil
+	}
+
+	// entrypoint listeners start after the config is loaded,
+	// the renewal scheduler obtains the cert once they are up
+	if p.cfg.solvedByEntrypoint() && !acmechallenge.Ready(challenge.Type(p.cfg.Challenge)) {
+		p.logger.Info().Str("challenge", p.cfg.Challenge).Msg("cert not found, obtaining after entrypoint started")
+		return nil
+	}
+
 	// check last failure
 	lastFailure, err := p.GetLastFailure()
 	if err != nil {
@@ -310,6 +391,20 @@ func (p *Provider) ObtainCert(ctx context.Context) error {
 		return nil
 	}
 
+	unlock, err := p.lockCert(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// another instance may have issued it while we waited for the lock
+	if synced, err := p.syncCert(ctx); err != nil {
+		p.logger.Warn().Err(err).Msg("failed to load cert from storage")
+	} else if synced && p.certState() == CertStateValid {
+		p.logger.Info().Msg("cert was renewed by another instance")
+		return nil
+	}
+
 	p.mu.RLock()
 	client := p.client
 	userRegistered := p.user.Registration != nil
@@ -339,7 +434,6 @@ func (p *Provider) ObtainCert(ctx context.Context) error {
 	}
 
 	var cert *certificate.Resource
-	var err error
 
 	if legoCert != nil {
 		cert, err = client.Certificate.Renew(ctx, *legoCert, &certificate.RenewOptions{
@@ -358,17 +452,26 @@ func (p *Provider) ObtainCert(ctx context.Context) error {
 	}
 
 	if cert == nil {
-		cert, err = client.Certificate.Obtain(ctx, certificate.ObtainRequest{
-			Domains: p.cfg.Domains,
-			Bundle:  true,
-			KeyType: p.cfg.CertKeyType(),
-		})
+		req := certificate.ObtainRequest{
+			Domains:        p.cfg.Domains,
+			Bundle:         true,
+			KeyType:        p.cfg.CertKeyType(),
+			ReplacesCertID: p.replacesCertID(),
+		}
+		cert, err = client.Certificate.Obtain(ctx, req)
+		if err != nil && req.ReplacesCertID != "" {
+			// e.g. the certificate was already replaced
+			log.Err(err).Msg("cert obtain with ARI replacement failed, retrying without")
+			req.ReplacesCertID = ""
+			cert, err = client.Certificate.Obtain(ctx, req)
+		}
 		if err != nil {
 			return err
 		}
 	}
 
-	if err = p.saveCert(cert); err != nil {
+	version, err := p.saveCert(ctx, cert)
+	if err != nil {
 		return err
 	}
 
@@ -381,11 +484,9 @@ func (p *Provider) ObtainCert(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	p.mu.Lock()
-	p.tlsCert = &tlsCert
-	p.certExpiries = expiries
-	p.mu.Unlock()
+	p.setTLSCert(&tlsCert, expiries, version)
 	p.rebuildSNIMatcher()
+	p.triggerOCSPRefresh()
 
 	if err := p.ClearLastFailure(); err != nil {
 		return fmt.Errorf("failed to clear last failure: %w", err)
@@ -405,7 +506,23 @@ func (p *Provider) LoadCertAll() error {
 }
 
 func (p *Provider) loadCert() error {
-	cert, err := tls.LoadX509KeyPair(p.cfg.CertPath, p.cfg.KeyPath)
+	ctx := context.Background()
+	store := p.cfg.getStorage()
+
+	// read before the certificate, so a renewal stored meanwhile is not missed
+	version, err := store.Version(ctx, p.cfg.CertPath)
+	if err != nil {
+		return err
+	}
+	certPEM, err := store.Load(ctx, p.cfg.CertPath)
+	if err != nil {
+		return err
+	}
+	keyPEM, err := store.Load(ctx, p.cfg.KeyPath)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
 	if err != nil {
 		return err
 	}
@@ -415,27 +532,39 @@ func (p *Provider) loadCert() error {
 		return err
 	}
 
+	p.setTLSCert(&cert, expiries, version)
+	p.loadOCSPStaple()
+	return nil
+}
+
+// setTLSCert replaces the certificate, dropping the staple and renewal info of the previous one.
+func (p *Provider) setTLSCert(cert *tls.Certificate, expiries CertExpiries, version string) {
 	p.mu.Lock()
-	p.tlsCert = &cert
+	defer p.mu.Unlock()
+	p.tlsCert = cert
 	p.certExpiries = expiries
-	p.mu.Unlock()
-
-	return nil
+	p.certVersion = version
+	p.ocspResp = nil
+	p.renewalInfo = nil
 }
 
 // PrintCertExpiriesAll prints the certificate expiries for this provider and all extra providers.
 func (p *Provider) PrintCertExpiriesAll() {
-	for _, provider := range p.allProviders() {
+	for _, provider := range append(p.allProviders(), p.onDemandProviders()...) {
 		for domain, expiry := range provider.GetExpiries() {
 			p.logger.Info().Str("domain", domain).Msgf("certificate expire on %s", strutils.FormatTime(expiry))
 		}
 	}
 }
 
-// ShouldRenewOn returns the time at which the certificate should be renewed.
+// ShouldRenewOn returns the time at which the certificate should be renewed,
+// within the renewal window suggested by the CA if it supports ARI.
 func (p *Provider) ShouldRenewOn() time.Time {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
+	if p.renewalInfo != nil {
+		return p.renewalInfo.renewAt
+	}
 	for _, expiry := range p.certExpiries {
 		return expiry.AddDate(0, -1, 0) // 1 month before
 	}
@@ -492,25 +621,43 @@ func (p *Provider) WaitRenewalDone(ctx context.Context) bool {
 
 // ScheduleRenewalAll schedules the renewal of the certificate for this provider and all extra providers.
 func (p *Provider) ScheduleRenewalAll(parent task.Parent) {
+	p.mu.Lock()
+	p.renewalParent = parent
+	p.mu.Unlock()
+
 	p.scheduleRenewalOnce.Do(func() {
 		p.scheduleRenewal(parent)
 	})
-	for _, ep := range p.extraProviders {
+	for _, ep := range slices.Concat(p.extraProviders, p.onDemandProviders()) {
 		ep.scheduleRenewalOnce.Do(func() {
 			ep.scheduleRenewal(parent)
 		})
 	}
 }
 
+func (p *Provider) getRenewalParent() task.Parent {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.renewalParent
+}
+
 var emptyForceRenewalDoneCh any = chan struct{}(nil)
 
 // scheduleRenewal schedules the renewal of the certificate for this provider.
 func (p *Provider) scheduleRenewal(parent task.Parent) {
-	if p.cfg.Provider == ProviderLocal || p.cfg.Provider == ProviderPseudo {
+	switch p.cfg.Provider {
+	case ProviderPseudo:
+		return
+	case ProviderLocal:
+		p.scheduleOCSPRefresh(parent)
 		return
 	}
 
 	timer := time.NewTimer(time.Until(p.ShouldRenewOn()))
+	ocspTimer := time.NewTimer(0)
+	ariTimer := time.NewTimer(0)
+	ariSupported := true
+	watchTicker := time.NewTicker(storageWatchInterval)
 	task := parent.Subtask("cert-renew-scheduler:"+filepath.Base(p.cfg.CertPath), true)
 	notifier := notif.FromCtx(parent.Context())
 
@@ -525,9 +672,10 @@ func (p *Provider) scheduleRenewal(parent task.Parent) {
 		if err != nil {
 			log.Warn().Err(p.fmtError(err)).Msg("autocert: cert renew failed")
 			notifier.Notify(&notif.LogMessage{
-				Level: zerolog.ErrorLevel,
-				Title: "SSL certificate renewal failed for " + p.GetName(),
-				Body:  notif.ErrorBody(err),
+				Level:  zerolog.ErrorLevel,
+				Title:  "SSL certificate renewal failed for " + p.GetName(),
+				Body:   notif.ErrorBody(err),
+				Source: notif.SourceAutocert,
 			})
 			return
 		}
@@ -535,9 +683,10 @@ func (p *Provider) scheduleRenewal(parent task.Parent) {
 			p.rebuildSNIMatcher()
 
 			notifier.Notify(&notif.LogMessage{
-				Level: zerolog.InfoLevel,
-				Title: "SSL certificate renewed for " + p.GetName(),
-				Body:  notif.ListBody(p.cfg.Domains),
+				Level:  zerolog.InfoLevel,
+				Title:  "SSL certificate renewed for " + p.GetName(),
+				Body:   notif.ListBody(p.cfg.Domains),
+				Source: notif.SourceAutocert,
 			})
 
 			// Reset on success
@@ -545,13 +694,39 @@ func (p *Provider) scheduleRenewal(parent task.Parent) {
 				log.Warn().Err(p.fmtError(err)).Msg("autocert: failed to clear last failure")
 			}
 			timer.Reset(time.Until(p.ShouldRenewOn()))
+			// renewal info and staple of the new certificate
+			if ariSupported {
+				ariTimer.Reset(0)
+			}
 		}
 	}
 
 	go func() {
 		defer timer.Stop()
+		defer ocspTimer.Stop()
+		defer ariTimer.Stop()
+		defer watchTicker.Stop()
 		defer task.Finish(nil)
 
+		// obtain the cert skipped by obtainCertIfNotExists once the entrypoint listens
+		if p.getTLSCert() == nil && p.cfg.solvedByEntrypoint() {
+			if acmechallenge.WaitReady(task.Context(), challenge.Type(p.cfg.Challenge)) != nil {
+				return
+			}
+			if err := p.obtainCertIfNotExists(task.Context()); err != nil {
+				log.Warn().Err(p.fmtError(err)).Msg("autocert: cert obtain failed")
+				notifier.Notify(&notif.LogMessage{
+					Level:  zerolog.ErrorLevel,
+					Title:  "SSL certificate request failed for " + p.GetName(),
+					Body:   notif.ErrorBody(err),
+					Source: notif.SourceAutocert,
+				})
+				timer.Reset(renewalCooldownDuration)
+			} else {
+				timer.Reset(time.Until(p.ShouldRenewOn()))
+			}
+		}
+
 		for {
 			select {
 			case <-task.Context().Done():
@@ -560,6 +735,29 @@ func (p *Provider) scheduleRenewal(parent task.Parent) {
 				renew(renewModeForce)
 			case <-timer.C:
 				renew(renewModeIfNeeded)
+			case <-p.renewCh:
+				renew(renewModeIfNeeded)
+			case <-ariTimer.C:
+				var next time.Duration
+				if next, ariSupported = p.updateRenewalInfo(task.Context()); ariSupported {
+					ariTimer.Reset(next)
+					timer.Reset(time.Until(p.ShouldRenewOn()))
+				}
+			case <-watchTicker.C:
+				synced, err := p.syncCert(task.Context())
+				if err != nil {
+					log.Warn().Err(p.fmtError(err)).Msg("autocert: failed to load cert from storage")
+				} else if synced {
+					p.logger.Info().Msg("reloaded cert renewed by another instance")
+					timer.Reset(time.Until(p.ShouldRenewOn()))
+					if ariSupported {
+						ariTimer.Reset(0)
+					}
+				}
+			case <-p.ocspRefreshCh:
+				ocspTimer.Reset(p.refreshOCSP(task.Context()))
+			case <-ocspTimer.C:
+				ocspTimer.Reset(p.refreshOCSP(task.Context()))
 			}
 		}
 	}()
@@ -573,7 +771,14 @@ func (p *Provider) initClient() error {
 
 	p.cfg.applyResolvers()
 
-	err = legoClient.Challenge.SetDNS01Provider(p.cfg.challengeProvider)
+	switch p.cfg.Challenge {
+	case ChallengeHTTP01:
+		err = legoClient.Challenge.SetHTTP01Provider(acmechallenge.HTTP01Provider)
+	case ChallengeTLSALPN01:
+		err = legoClient.Challenge.SetTLSALPN01Provider(acmechallenge.TLSALPN01Provider)
+	default:
+		err = legoClient.Challenge.SetDNS01Provider(p.cfg.challengeProvider)
+	}
 	if err != nil {
 		return err
 	}
@@ -619,38 +824,29 @@ func (p *Provider) registerACME(ctx context.Context) error {
 	return nil
 }
 
-func (p *Provider) saveCert(cert *certificate.Resource) error {
-	if common.IsTest {
-		return nil
-	}
-	/* This should have been done in setup
-	but double check is always a good choice.*/
-	_, err := os.Stat(filepath.Dir(p.cfg.CertPath))
-	if err != nil {
-		if os.IsNotExist(err) {
-			if err = os.MkdirAll(filepath.Dir(p.cfg.CertPath), 0o755); err != nil {
-				return err
-			}
-		} else {
-			return err
-		}
+// saveCert stores the key and then the certificate, and returns the storage version of the certificate.
+func (p *Provider) saveCert(ctx context.Context, cert *certificate.Resource) (version string, err error) {
+	if p.cfg.skipStorage() {
+		return "", nil
 	}
-	err = os.WriteFile(p.cfg.KeyPath, cert.PrivateKey, 0o600) // -rw-------
-	if err != nil {
-		return err
+	store := p.cfg.getStorage()
+	if err := store.Store(ctx, p.cfg.KeyPath, cert.PrivateKey, true); err != nil {
+		return "", err
 	}
-
-	err = os.WriteFile(p.cfg.CertPath, cert.Certificate, 0o644) // -rw-r--r--
-	if err != nil {
-		return err
+	if err := store.Store(ctx, p.cfg.CertPath, cert.Certificate, false); err != nil {
+		return "", err
 	}
-	return nil
+	return store.Version(ctx, p.cfg.CertPath)
 }
 
 func (p *Provider) certState() CertState {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
+	if p.ocspResp != nil && p.ocspResp.Status == ocsp.Revoked {
+		return CertStateRevoked
+	}
+
 	if time.Now().After(p.ShouldRenewOn()) {
 		return CertStateExpired
 	}
@@ -694,6 +890,8 @@ func (p *Provider) renew(ctx context.Context, mode RenewMode) (renewed bool, err
 			log.Info().Msg("certs expired, renewing")
 		case CertStateMismatch:
 			log.Info().Msg("cert domains mismatch with config, renewing")
+		case CertStateRevoked:
+			log.Info().Msg("cert revoked, renewing")
 		default:
 			return false, nil
 		}
@@ -734,7 +932,8 @@ func lastFailureFileFor(certPath, keyPath string) string {
 }
 
 func (p *Provider) rebuildSNIMatcher() {
-	if p.cfg.idx != 0 { // only main provider has extra providers
+	if p.parent != nil { // the main provider matches the certs of its extra providers
+		p.parent.rebuildSNIMatcher()
 		return
 	}
 
@@ -743,6 +942,9 @@ func (p *Provider) rebuildSNIMatcher() {
 	for _, ep := range p.extraProviders {
 		matcher.addProvider(ep)
 	}
+	for _, odp := range p.onDemandProviders() {
+		matcher.addProvider(odp)
+	}
 
 	p.mu.Lock()
 	p.sniMatcher = matcher
@@ -6,15 +6,18 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"math/big"
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/yusing/godoxy/internal/autocert"
+	"github.com/yusing/godoxy/internal/autocert/acmechallenge"
 )
 
 func writeSelfSignedCert(t *testing.T, dir string, dnsNames []string) (string, string) {
@@ -414,3 +417,40 @@ func TestGetCertBySNI(t *testing.T) {
 		require.Contains(t, leaf3.DNSNames, "*.test.com")
 	})
 }
+
+func TestGetCertTLSALPN01(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeSelfSignedCert(t, dir, []string{"example.com"})
+
+	cfg := &autocert.Config{
+		Provider: autocert.ProviderLocal,
+		CertPath: certPath,
+		KeyPath:  keyPath,
+	}
+	require.NoError(t, cfg.Validate())
+
+	p, err := autocert.NewProvider(cfg, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, p.LoadCertAll())
+
+	acmechallenge.HTTPSListenerStarted()
+	require.NoError(t, acmechallenge.TLSALPN01Provider.Present(t.Context(), "example.com", "token", "token.thumbprint"))
+	t.Cleanup(func() {
+		_ = acmechallenge.TLSALPN01Provider.CleanUp(t.Context(), "example.com", "token", "token.thumbprint")
+	})
+
+	hello := &tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{acmechallenge.ACMETLS1Protocol}}
+	cert, err := p.GetCert(hello)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.True(t, slices.ContainsFunc(leaf.Extensions, func(ext pkix.Extension) bool {
+		return ext.Id.Equal(asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31})
+	}), "challenge cert carries the acmeIdentifier extension")
+
+	cert, err = p.GetCert(&tls.ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{"h2", "http/1.1"}})
+	require.NoError(t, err)
+	leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	require.Equal(t, "example.com", leaf.Subject.CommonName)
+}
@@ -0,0 +1,116 @@
+package autocert
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/go-acme/lego/v5/acme"
+	"github.com/go-acme/lego/v5/acme/api"
+)
+
+// renewalInfo is the ACME Renewal Information (RFC 9773) of the current certificate.
+type renewalInfo struct {
+	window         acme.Window
+	renewAt        time.Time // selected once per window
+	explanationURL string
+}
+
+const (
+	// poll interval when the CA does not send Retry-After
+	ariDefaultInterval = 6 * time.Hour
+	ariMinInterval     = time.Hour
+	ariMaxInterval     = 24 * time.Hour
+	// retry after the renewal info request failed
+	ariRetryInterval = time.Hour
+)
+
+// RenewalWindow returns the renewal window suggested by the CA,
+// and the time selected within it. They are zero if the CA does not support ARI.
+func (p *Provider) RenewalWindow() (start, end, renewAt time.Time) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.renewalInfo == nil {
+		return
+	}
+	return p.renewalInfo.window.Start, p.renewalInfo.window.End, p.renewalInfo.renewAt
+}
+
+// updateRenewalInfo fetches the renewal info of the certificate,
+// and returns when to check again, or false if the CA does not support ARI.
+func (p *Provider) updateRenewalInfo(ctx context.Context) (next time.Duration, ok bool) {
+	cert := p.getTLSCert()
+	if cert == nil || cert.Leaf == nil {
+		return ariDefaultInterval, true
+	}
+
+	p.mu.RLock()
+	client := p.client
+	p.mu.RUnlock()
+	if client == nil {
+		if err := p.initClient(); err != nil {
+			p.logger.Debug().Err(err).Msg("failed to init client for renewal info")
+			return ariRetryInterval, true
+		}
+		p.mu.RLock()
+		client = p.client
+		p.mu.RUnlock()
+	}
+
+	info, err := client.Certificate.GetRenewalInfo(ctx, cert.Leaf)
+	if err != nil {
+		if errors.Is(err, api.ErrNoARI) {
+			return 0, false
+		}
+		p.logger.Debug().Err(err).Msg("failed to get renewal info")
+		return ariRetryInterval, true
+	}
+
+	window := info.SuggestedWindow
+	p.mu.Lock()
+	if p.tlsCert != nil && p.tlsCert.Leaf == cert.Leaf &&
+		(p.renewalInfo == nil || !p.renewalInfo.window.Start.Equal(window.Start) || !p.renewalInfo.window.End.Equal(window.End)) {
+		p.renewalInfo = &renewalInfo{
+			window:         window,
+			renewAt:        selectRenewalTime(window),
+			explanationURL: info.ExplanationURL,
+		}
+		logger := p.logger.Info()
+		if info.ExplanationURL != "" {
+			logger = logger.Str("explanation", info.ExplanationURL)
+		}
+		logger.Time("renew_at", p.renewalInfo.renewAt).Msg("renewal window updated by CA")
+	}
+	p.mu.Unlock()
+
+	if info.RetryAfter <= 0 {
+		return ariDefaultInterval, true
+	}
+	return min(max(info.RetryAfter, ariMinInterval), ariMaxInterval), true
+}
+
+// replacesCertID returns the ARI certificate ID of the current certificate,
+// for the new order to replace it. It is empty if the CA does not support ARI.
+func (p *Provider) replacesCertID() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.renewalInfo == nil || p.tlsCert == nil || p.tlsCert.Leaf == nil {
+		return ""
+	}
+	certID, err := api.MakeARICertID(p.tlsCert.Leaf)
+	if err != nil {
+		return ""
+	}
+	return certID
+}
+
+// selectRenewalTime selects a uniform random time within window as RFC 9773 recommends,
+// spreading renewals of many clients across it.
+func selectRenewalTime(window acme.Window) time.Time {
+	renewAt := window.Start
+	if d := window.End.Sub(window.Start); d > 0 {
+		renewAt = renewAt.Add(rand.N(d))
+	}
+	return renewAt
+}
@@ -0,0 +1,111 @@
+package autocert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-acme/lego/v5/acme"
+	"github.com/go-acme/lego/v5/acme/api"
+	"github.com/go-acme/lego/v5/lego"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestARIServer returns an ACME server whose renewalInfo endpoint suggests window,
+// or without renewalInfo if window is nil.
+func newTestARIServer(t *testing.T, window *atomic.Pointer[acme.Window]) (srv *httptest.Server, requests *atomic.Int32) {
+	t.Helper()
+	requests = new(atomic.Int32)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", func(w http.ResponseWriter, r *http.Request) {
+		dir := acme.Directory{NewNonceURL: srv.URL + "/nonce", NewAccountURL: srv.URL + "/account", NewOrderURL: srv.URL + "/order"}
+		if window != nil {
+			dir.RenewalInfo = srv.URL + "/renewal-info"
+		}
+		_ = json.NewEncoder(w).Encode(dir)
+	})
+	mux.HandleFunc("/renewal-info/", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", "21600")
+		_ = json.NewEncoder(w).Encode(acme.RenewalInfo{SuggestedWindow: *window.Load()})
+	})
+	srv = httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, requests
+}
+
+func newTestARIProvider(t *testing.T, srv *httptest.Server) *Provider {
+	t.Helper()
+	p, _ := newTestOCSPProvider(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	legoCfg := lego.NewConfig(&User{Key: key})
+	legoCfg.CADirURL = srv.URL + "/directory"
+	legoCfg.HTTPClient = srv.Client()
+	client, err := lego.NewClient(legoCfg)
+	require.NoError(t, err)
+	p.client = client
+	return p
+}
+
+func TestRenewalInfo(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	window := &acme.Window{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}
+	var suggested atomic.Pointer[acme.Window]
+	suggested.Store(window)
+	srv, requests := newTestARIServer(t, &suggested)
+	p := newTestARIProvider(t, srv)
+
+	expiryBased := p.ShouldRenewOn()
+	next, ok := p.updateRenewalInfo(t.Context())
+	require.True(t, ok)
+	require.Equal(t, ariDefaultInterval, next, "Retry-After of the CA")
+
+	renewAt := p.ShouldRenewOn()
+	require.NotEqual(t, expiryBased, renewAt)
+	require.False(t, renewAt.Before(window.Start))
+	require.False(t, renewAt.After(window.End))
+	start, end, selected := p.RenewalWindow()
+	require.True(t, start.Equal(window.Start))
+	require.True(t, end.Equal(window.End))
+	require.Equal(t, renewAt, selected)
+	require.NotEmpty(t, p.replacesCertID())
+
+	// the selected time is kept while the window is unchanged
+	_, ok = p.updateRenewalInfo(t.Context())
+	require.True(t, ok)
+	require.Equal(t, renewAt, p.ShouldRenewOn())
+	require.EqualValues(t, 2, requests.Load())
+
+	// e.g. mass revocation, the window moves to the past
+	suggested.Store(&acme.Window{Start: now.Add(-2 * time.Hour), End: now.Add(-time.Hour)})
+	_, ok = p.updateRenewalInfo(t.Context())
+	require.True(t, ok)
+	require.Equal(t, CertStateExpired, p.certState())
+}
+
+func TestRenewalInfoUnsupported(t *testing.T) {
+	srv, _ := newTestARIServer(t, nil)
+	p := newTestARIProvider(t, srv)
+
+	expiryBased := p.ShouldRenewOn()
+	_, ok := p.updateRenewalInfo(t.Context())
+	require.False(t, ok)
+	require.Equal(t, expiryBased, p.ShouldRenewOn())
+	require.Empty(t, p.replacesCertID())
+}
+
+func TestReplacesCertID(t *testing.T) {
+	p, _ := newTestOCSPProvider(t)
+	p.renewalInfo = &renewalInfo{}
+	certID, err := api.MakeARICertID(p.tlsCert.Leaf)
+	require.NoError(t, err)
+	require.Equal(t, certID, p.replacesCertID())
+	require.Contains(t, certID, ".")
+}
@@ -24,6 +24,7 @@ func (p *Provider) setupExtraProviders() error {
 			errs.Add(p.fmtError(err))
 			continue
 		}
+		ep.parent = p
 		p.extraProviders = append(p.extraProviders, ep)
 	}
 	return errs.Error()
@@ -6,4 +6,5 @@ const (
 	CertStateValid CertState = iota
 	CertStateExpired
 	CertStateMismatch
+	CertStateRevoked
 )
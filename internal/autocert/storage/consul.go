@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Consul stores values in the Consul KV store.
+//
+// Locks are KV entries acquired by a session with the lock TTL,
+// the entry is deleted when the session is destroyed or expires.
+type Consul struct {
+	// Address is the Consul HTTP API URL, e.g. http://consul:8500.
+	Address string            `json:"address" validate:"required,url"`
+	Token   strutils.Redacted `json:"token,omitempty"`
+	Prefix  string            `json:"prefix,omitempty"` // default godoxy/
+}
+
+const kvDefaultPrefix = "godoxy/"
+
+// Validate implements the serialization.CustomValidator interface.
+func (c *Consul) Validate() error {
+	if c.Prefix == "" {
+		c.Prefix = kvDefaultPrefix
+	}
+	c.Address = strings.TrimSuffix(c.Address, "/")
+	return nil
+}
+
+func (c *Consul) String() string {
+	return "consul://" + strings.TrimPrefix(strings.TrimPrefix(c.Address, "http://"), "https://") + "/" + c.Prefix
+}
+
+func (c *Consul) Load(ctx context.Context, key string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, "/v1/kv/"+objectKey(c.Prefix, key), url.Values{"raw": {""}}, nil)
+}
+
+func (c *Consul) Store(ctx context.Context, key string, value []byte, _ bool) error {
+	_, err := c.do(ctx, http.MethodPut, "/v1/kv/"+objectKey(c.Prefix, key), nil, value)
+	return err
+}
+
+func (c *Consul) Delete(ctx context.Context, key string) error {
+	_, err := c.do(ctx, http.MethodDelete, "/v1/kv/"+objectKey(c.Prefix, key), nil, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (c *Consul) List(ctx context.Context, prefix string) ([]string, error) {
+	body, err := c.do(ctx, http.MethodGet, "/v1/kv/"+objectKey(c.Prefix, prefix), url.Values{"keys": {""}}, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, err
+	}
+	for i, key := range keys {
+		keys[i] = strings.TrimPrefix(key, c.Prefix)
+	}
+	return keys, nil
+}
+
+func (c *Consul) Version(ctx context.Context, key string) (string, error) {
+	body, err := c.do(ctx, http.MethodGet, "/v1/kv/"+objectKey(c.Prefix, key), nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var entries []struct {
+		ModifyIndex uint64
+	}
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", ErrNotExist
+	}
+	return strconv.FormatUint(entries[0].ModifyIndex, 10), nil
+}
+
+func (c *Consul) Lock(ctx context.Context, key string) (func(), error) {
+	body, err := c.do(ctx, http.MethodPut, "/v1/session/create", nil, fmt.Appendf(nil,
+		`{"Name":"godoxy-lock","TTL":"%ds","Behavior":"delete","LockDelay":"1s"}`, int(LockTTL.Seconds())))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	var session struct{ ID string }
+	if err := json.Unmarshal(body, &session); err != nil {
+		return nil, err
+	}
+	destroy := func(ctx context.Context) error {
+		_, err := c.do(ctx, http.MethodPut, "/v1/session/destroy/"+session.ID, nil, nil)
+		return err
+	}
+
+	lockPath := "/v1/kv/" + objectKey(c.Prefix, lockKey(key))
+	err = acquireLock(ctx, key, func(ctx context.Context) (bool, error) {
+		body, err := c.do(ctx, http.MethodPut, lockPath, url.Values{"acquire": {session.ID}}, []byte(session.ID))
+		if err != nil {
+			return false, err
+		}
+		return string(bytes.TrimSpace(body)) == "true", nil
+	})
+	if err != nil {
+		_ = destroy(context.Background())
+		return nil, err
+	}
+	return keepLockAlive(key, func(ctx context.Context) error {
+		_, err := c.do(ctx, http.MethodPut, "/v1/session/renew/"+session.ID, nil, nil)
+		return err
+	}, destroy), nil
+}
+
+func (c *Consul) do(ctx context.Context, method, path string, query url.Values, body []byte) ([]byte, error) {
+	u := c.Address + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token.String())
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxValueSize))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrNotExist
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("consul: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return data, nil
+}
@@ -0,0 +1,258 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Etcd stores values in etcd v3 through its JSON gateway.
+//
+// Locks are keys created in a transaction only if they do not exist,
+// attached to a lease with the lock TTL.
+type Etcd struct {
+	// Endpoint is the etcd client URL, e.g. http://etcd:2379.
+	Endpoint string            `json:"endpoint" validate:"required,url"`
+	Username string            `json:"username,omitempty"`
+	Password strutils.Redacted `json:"password,omitempty"`
+	Prefix   string            `json:"prefix,omitempty"` // default godoxy/
+
+	mu    sync.Mutex
+	token string
+}
+
+// etcdKV is a key-value pair from the gateway, bytes fields are base64 encoded in JSON.
+type etcdKV struct {
+	Key         []byte `json:"key"`
+	Value       []byte `json:"value"`
+	ModRevision string `json:"mod_revision"`
+}
+
+// Validate implements the serialization.CustomValidator interface.
+func (e *Etcd) Validate() error {
+	if e.Prefix == "" {
+		e.Prefix = kvDefaultPrefix
+	}
+	e.Endpoint = strings.TrimSuffix(e.Endpoint, "/")
+	return nil
+}
+
+func (e *Etcd) String() string {
+	return "etcd://" + strings.TrimPrefix(strings.TrimPrefix(e.Endpoint, "http://"), "https://") + "/" + e.Prefix
+}
+
+func (e *Etcd) Load(ctx context.Context, key string) ([]byte, error) {
+	kv, err := e.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return kv.Value, nil
+}
+
+func (e *Etcd) Store(ctx context.Context, key string, value []byte, _ bool) error {
+	return e.do(ctx, "/v3/kv/put", map[string]any{"key": []byte(objectKey(e.Prefix, key)), "value": value}, nil)
+}
+
+func (e *Etcd) Delete(ctx context.Context, key string) error {
+	return e.do(ctx, "/v3/kv/deleterange", map[string]any{"key": []byte(objectKey(e.Prefix, key))}, nil)
+}
+
+func (e *Etcd) List(ctx context.Context, prefix string) ([]string, error) {
+	start := []byte(objectKey(e.Prefix, prefix))
+	var resp struct {
+		KVs []etcdKV `json:"kvs"`
+	}
+	err := e.do(ctx, "/v3/kv/range", map[string]any{
+		"key":       start,
+		"range_end": etcdPrefixEnd(start),
+		"keys_only": true,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, len(resp.KVs))
+	for i, kv := range resp.KVs {
+		keys[i] = strings.TrimPrefix(string(kv.Key), e.Prefix)
+	}
+	return keys, nil
+}
+
+func (e *Etcd) Version(ctx context.Context, key string) (string, error) {
+	kv, err := e.get(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return kv.ModRevision, nil
+}
+
+func (e *Etcd) Lock(ctx context.Context, key string) (func(), error) {
+	var lease struct {
+		ID string `json:"ID"`
+	}
+	if err := e.do(ctx, "/v3/lease/grant", map[string]any{"TTL": int(LockTTL.Seconds())}, &lease); err != nil {
+		return nil, fmt.Errorf("failed to grant lease: %w", err)
+	}
+	revoke := func(ctx context.Context) error {
+		// deletes the lock key attached to it
+		return e.do(ctx, "/v3/lease/revoke", map[string]any{"ID": lease.ID}, nil)
+	}
+
+	lockName := []byte(objectKey(e.Prefix, lockKey(key)))
+	err := acquireLock(ctx, key, func(ctx context.Context) (bool, error) {
+		var txn struct {
+			Succeeded bool `json:"succeeded"`
+		}
+		err := e.do(ctx, "/v3/kv/txn", map[string]any{
+			"compare": []map[string]any{{
+				"key":             lockName,
+				"result":          "EQUAL",
+				"target":          "CREATE",
+				"create_revision": "0",
+			}},
+			"success": []map[string]any{{
+				"request_put": map[string]any{"key": lockName, "value": []byte(lease.ID), "lease": lease.ID},
+			}},
+		}, &txn)
+		return txn.Succeeded, err
+	})
+	if err != nil {
+		_ = revoke(context.Background())
+		return nil, err
+	}
+	return keepLockAlive(key, func(ctx context.Context) error {
+		var resp struct {
+			Result struct {
+				TTL string `json:"TTL"`
+			} `json:"result"`
+		}
+		if err := e.do(ctx, "/v3/lease/keepalive", map[string]any{"ID": lease.ID}, &resp); err != nil {
+			return err
+		}
+		if resp.Result.TTL == "" || resp.Result.TTL == "0" {
+			return errors.New("lease expired")
+		}
+		return nil
+	}, revoke), nil
+}
+
+func (e *Etcd) get(ctx context.Context, key string) (*etcdKV, error) {
+	var resp struct {
+		KVs []etcdKV `json:"kvs"`
+	}
+	if err := e.do(ctx, "/v3/kv/range", map[string]any{"key": []byte(objectKey(e.Prefix, key))}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.KVs) == 0 {
+		return nil, ErrNotExist
+	}
+	return &resp.KVs[0], nil
+}
+
+// do posts req to the gateway endpoint at path, authenticating first if credentials are set.
+func (e *Etcd) do(ctx context.Context, path string, req, resp any) error {
+	err := e.post(ctx, path, req, resp)
+	if errors.Is(err, errEtcdUnauthenticated) && e.Username != "" {
+		// the token expired, authenticate again
+		e.mu.Lock()
+		e.token = ""
+		e.mu.Unlock()
+		err = e.post(ctx, path, req, resp)
+	}
+	return err
+}
+
+var errEtcdUnauthenticated = errors.New("etcd: unauthenticated")
+
+func (e *Etcd) post(ctx context.Context, path string, reqBody, respBody any) error {
+	token, err := e.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 2*maxValueSize)) // values are base64 encoded
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var gwErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &gwErr)
+		if resp.StatusCode == http.StatusUnauthorized || strings.Contains(gwErr.Message, "invalid auth token") {
+			return errEtcdUnauthenticated
+		}
+		return fmt.Errorf("etcd: %s: %s", resp.Status, gwErr.Message)
+	}
+	if respBody == nil {
+		return nil
+	}
+	return json.Unmarshal(data, respBody)
+}
+
+func (e *Etcd) authenticate(ctx context.Context) (string, error) {
+	if e.Username == "" {
+		return "", nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.token != "" {
+		return e.token, nil
+	}
+	body, _ := json.Marshal(map[string]string{"name": e.Username, "password": e.Password.String()})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint+"/v3/auth/authenticate", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("etcd: authentication failed: %s", resp.Status)
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&auth); err != nil {
+		return "", err
+	}
+	e.token = auth.Token
+	return e.token, nil
+}
+
+// etcdPrefixEnd returns the range end covering all keys with prefix.
+func etcdPrefixEnd(prefix []byte) []byte {
+	end := bytes.Clone(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	return []byte{0} // all keys
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File stores values as files, keys are paths relative to the working directory.
+type File struct{}
+
+func NewFile() *File {
+	return &File{}
+}
+
+func (*File) String() string {
+	return TypeFile
+}
+
+func (*File) Load(_ context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.FromSlash(key))
+}
+
+// Store writes value to a temporary file and renames it,
+// so readers never see a partially written value.
+func (*File) Store(_ context.Context, key string, value []byte, private bool) error {
+	path := filepath.FromSlash(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	perm := os.FileMode(0o644) // -rw-r--r--
+	if private {
+		perm = 0o600 // -rw-------
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (*File) Delete(_ context.Context, key string) error {
+	err := os.Remove(filepath.FromSlash(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (*File) List(_ context.Context, prefix string) ([]string, error) {
+	dir := filepath.FromSlash(prefix)
+	if !strings.HasSuffix(prefix, "/") {
+		dir = filepath.Dir(dir)
+	}
+	var keys []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if key := filepath.ToSlash(path); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return keys, err
+}
+
+func (*File) Version(_ context.Context, key string) (string, error) {
+	info, err := os.Stat(filepath.FromSlash(key))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d-%d", info.ModTime().UnixNano(), info.Size()), nil
+}
+
+// Lock creates a lock file beside key, for instances sharing the directory, e.g. over NFS.
+// A lock file not refreshed within LockTTL is considered stale and taken over.
+func (f *File) Lock(ctx context.Context, key string) (func(), error) {
+	path := filepath.FromSlash(lockKey(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	err := acquireLock(ctx, key, func(context.Context) (bool, error) {
+		lockFile, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_, err = lockFile.WriteString(strconv.Itoa(os.Getpid()))
+			return true, errors.Join(err, lockFile.Close())
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return false, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return false, nil //nolint:nilerr // released meanwhile, retry
+		}
+		if time.Since(info.ModTime()) > LockTTL {
+			// stale, the holder died
+			_ = os.Remove(path)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keepLockAlive(key, func(context.Context) error {
+		now := time.Now()
+		return os.Chtimes(path, now, now)
+	}, func(ctx context.Context) error {
+		return f.Delete(ctx, lockKey(key))
+	}), nil
+}
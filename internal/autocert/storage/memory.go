@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Memory is an in-memory storage for tests.
+// Instances sharing a Memory behave like GoDoxy instances sharing a remote storage.
+type Memory struct {
+	mu      sync.Mutex
+	values  map[string]memoryValue
+	version int
+	locks   map[string]chan struct{} // closed on release
+}
+
+type memoryValue struct {
+	data    []byte
+	version int
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		values: make(map[string]memoryValue),
+		locks:  make(map[string]chan struct{}),
+	}
+}
+
+func (*Memory) String() string {
+	return "memory"
+}
+
+func (m *Memory) Load(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	if !ok {
+		return nil, ErrNotExist
+	}
+	return slices.Clone(v.data), nil
+}
+
+func (m *Memory) Store(_ context.Context, key string, value []byte, _ bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.version++
+	m.values[key] = memoryValue{data: slices.Clone(value), version: m.version}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.values, key)
+	return nil
+}
+
+func (m *Memory) List(_ context.Context, prefix string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []string
+	for _, key := range slices.Sorted(maps.Keys(m.values)) {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *Memory) Version(_ context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	if !ok {
+		return "", ErrNotExist
+	}
+	return strconv.Itoa(v.version), nil
+}
+
+func (m *Memory) Lock(ctx context.Context, key string) (func(), error) {
+	for {
+		m.mu.Lock()
+		released, held := m.locks[key]
+		if !held {
+			released = make(chan struct{})
+			m.locks[key] = released
+			m.mu.Unlock()
+			return func() {
+				m.mu.Lock()
+				delete(m.locks, key)
+				m.mu.Unlock()
+				close(released)
+			}, nil
+		}
+		m.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-released:
+		}
+	}
+}
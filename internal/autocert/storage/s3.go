@@ -0,0 +1,340 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// S3 stores values as objects in an S3-compatible bucket (AWS S3, MinIO, R2, ...).
+//
+// Locks are objects created with conditional writes (If-None-Match / If-Match),
+// which the provider must support.
+type S3 struct {
+	// Endpoint is the S3 API URL, e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000.
+	// Buckets are addressed path-style.
+	Endpoint  string            `json:"endpoint" validate:"required,url"`
+	Region    string            `json:"region,omitempty"` // default us-east-1
+	Bucket    string            `json:"bucket" validate:"required"`
+	AccessKey string            `json:"access_key" validate:"required"`
+	SecretKey strutils.Redacted `json:"secret_key" validate:"required"`
+	Prefix    string            `json:"prefix,omitempty"` // prepended to keys, e.g. godoxy/
+
+	now func() time.Time // for tests
+}
+
+const s3DefaultRegion = "us-east-1"
+
+// Validate implements the serialization.CustomValidator interface.
+func (s *S3) Validate() error {
+	if s.Region == "" {
+		s.Region = s3DefaultRegion
+	}
+	s.Endpoint = strings.TrimSuffix(s.Endpoint, "/")
+	return nil
+}
+
+func (s *S3) String() string {
+	return "s3://" + s.Bucket + "/" + s.Prefix
+}
+
+func (s *S3) Load(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.do(ctx, http.MethodGet, objectKey(s.Prefix, key), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, maxValueSize))
+}
+
+func (s *S3) Store(ctx context.Context, key string, value []byte, _ bool) error {
+	resp, err := s.do(ctx, http.MethodPut, objectKey(s.Prefix, key), nil, nil, value)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	resp, err := s.do(ctx, http.MethodDelete, objectKey(s.Prefix, key), nil, nil, nil)
+	if errors.Is(err, ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *S3) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {objectKey(s.Prefix, prefix)}}
+	for {
+		resp, err := s.do(ctx, http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(io.LimitReader(resp.Body, maxValueSize)).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode list result: %w", err)
+		}
+		for _, obj := range result.Contents {
+			keys = append(keys, strings.TrimPrefix(obj.Key, s.Prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func (s *S3) Version(ctx context.Context, key string) (string, error) {
+	resp, err := s.do(ctx, http.MethodHead, objectKey(s.Prefix, key), nil, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+// Lock creates the lock object if it does not exist, or replaces it if it expired.
+// The holder refreshes it with If-Match on the ETag it got, so a taken over lock is noticed.
+func (s *S3) Lock(ctx context.Context, key string) (func(), error) {
+	lockObj := objectKey(s.Prefix, lockKey(key))
+	var etag string
+	put := func(ctx context.Context, cond http.Header) (bool, error) {
+		expires := strconv.FormatInt(s.clock().Add(LockTTL).Unix(), 10)
+		resp, err := s.do(ctx, http.MethodPut, lockObj, nil, cond, []byte(expires))
+		if err != nil {
+			if isS3PreconditionFailed(err) {
+				return false, nil
+			}
+			return false, err
+		}
+		resp.Body.Close()
+		etag = resp.Header.Get("ETag")
+		return true, nil
+	}
+
+	err := acquireLock(ctx, key, func(ctx context.Context) (bool, error) {
+		if ok, err := put(ctx, http.Header{"If-None-Match": {"*"}}); ok || err != nil {
+			return ok, err
+		}
+		resp, err := s.do(ctx, http.MethodGet, lockObj, nil, nil, nil)
+		if errors.Is(err, ErrNotExist) {
+			return false, nil // released meanwhile, retry
+		}
+		if err != nil {
+			return false, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 64))
+		resp.Body.Close()
+		if err != nil {
+			return false, err
+		}
+		expires, _ := strconv.ParseInt(string(body), 10, 64)
+		if s.clock().Unix() <= expires {
+			return false, nil
+		}
+		// stale, the holder died
+		return put(ctx, http.Header{"If-Match": {resp.Header.Get("ETag")}})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keepLockAlive(key, func(ctx context.Context) error {
+		ok, err := put(ctx, http.Header{"If-Match": {etag}})
+		if err == nil && !ok {
+			err = errors.New("lock was taken over")
+		}
+		return err
+	}, func(ctx context.Context) error {
+		version, err := s.Version(ctx, lockKey(key))
+		if err != nil || version != etag {
+			return nil //nolint:nilerr // released or taken over
+		}
+		return s.Delete(ctx, lockKey(key))
+	}), nil
+}
+
+type s3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: unexpected status code %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.Code, e.Message)
+}
+
+func (e *s3Error) Unwrap() error {
+	if e.StatusCode == http.StatusNotFound {
+		return ErrNotExist
+	}
+	return nil
+}
+
+func isS3PreconditionFailed(err error) bool {
+	var s3Err *s3Error
+	// 409 ConditionalRequestConflict: a concurrent conditional write won
+	return errors.As(err, &s3Err) && (s3Err.StatusCode == http.StatusPreconditionFailed || s3Err.StatusCode == http.StatusConflict)
+}
+
+func (s *S3) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// do sends a signed request for object (the bucket itself if empty).
+func (s *S3) do(ctx context.Context, method, object string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	u.Path += "/" + s.Bucket
+	if object != "" {
+		u.Path += "/" + object
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, body)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	s3Err := &s3Error{StatusCode: resp.StatusCode}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(s3Err)
+	return nil, s3Err
+}
+
+// sign adds AWS Signature Version 4 headers to req.
+func (s *S3) sign(req *http.Request, body []byte) {
+	now := s.clock().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\n" +
+			"x-amz-content-sha256:" + payloadHash + "\n" +
+			"x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey.String()), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// s3EscapePath escapes each path segment as SigV4 requires.
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = s3Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		for _, v := range query[k] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(s3Escape(k))
+			b.WriteByte('=')
+			b.WriteString(s3Escape(v))
+		}
+	}
+	return b.String()
+}
+
+// s3Escape percent-encodes everything except the RFC 3986 unreserved characters.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testS3Server is an in-memory S3 bucket supporting the requests S3 sends.
+type testS3Server struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string][]byte
+}
+
+func (srv *testS3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	path, ok := strings.CutPrefix(r.URL.Path, "/"+srv.bucket)
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(path, "/")
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	if key == "" && r.URL.Query().Get("list-type") == "2" {
+		type content struct {
+			Key string `xml:"Key"`
+		}
+		var result struct {
+			XMLName  xml.Name  `xml:"ListBucketResult"`
+			Contents []content `xml:"Contents"`
+		}
+		prefix := r.URL.Query().Get("prefix")
+		for k := range srv.objects {
+			if strings.HasPrefix(k, prefix) {
+				result.Contents = append(result.Contents, content{k})
+			}
+		}
+		slices.SortFunc(result.Contents, func(a, b content) int { return strings.Compare(a.Key, b.Key) })
+		_ = xml.NewEncoder(w).Encode(result)
+		return
+	}
+
+	obj, exists := srv.objects[key]
+	etag := ""
+	if exists {
+		sum := md5.Sum(obj)
+		etag = `"` + hex.EncodeToString(sum[:]) + `"`
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		_, _ = w.Write(obj)
+	case http.MethodPut:
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if match := r.Header.Get("If-Match"); match != "" && match != etag {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		srv.objects[key] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case http.MethodDelete:
+		delete(srv.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func newTestS3(t *testing.T) (*S3, *testS3Server) {
+	t.Helper()
+	srv := &testS3Server{bucket: "certs", objects: make(map[string][]byte)}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+
+	s := &S3{
+		Endpoint:  ts.URL,
+		Bucket:    "certs",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Prefix:    "godoxy/",
+	}
+	require.NoError(t, s.Validate())
+	return s, srv
+}
+
+func TestS3(t *testing.T) {
+	s, srv := newTestS3(t)
+	testStorage(t, s, "")
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	for key := range srv.objects {
+		require.True(t, strings.HasPrefix(key, "godoxy/"), key)
+	}
+}
+
+func TestS3StaleLock(t *testing.T) {
+	s, _ := newTestS3(t)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	_, err := s.Lock(t.Context(), "certs/cert.crt")
+	require.NoError(t, err)
+
+	// the holder died without releasing it
+	now = now.Add(LockTTL + time.Second)
+	unlock, err := s.Lock(t.Context(), "certs/cert.crt")
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestS3Sign(t *testing.T) {
+	s := &S3{
+		Endpoint:  "https://s3.us-east-1.amazonaws.com",
+		Region:    "us-east-1",
+		Bucket:    "certs",
+		AccessKey: "access",
+		SecretKey: "secret",
+		now:       func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) },
+	}
+	sign := func() string {
+		req := httptest.NewRequest(http.MethodGet, "https://s3.us-east-1.amazonaws.com/certs/a%20b.crt?list-type=2", nil)
+		s.sign(req, nil)
+		require.Equal(t, "20250102T030405Z", req.Header.Get("X-Amz-Date"))
+		return req.Header.Get("Authorization")
+	}
+	auth := sign()
+	require.True(t, strings.HasPrefix(auth,
+		"AWS4-HMAC-SHA256 Credential=access/20250102/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="), auth)
+	require.Equal(t, auth, sign(), "deterministic")
+
+	s.SecretKey = "other"
+	require.NotEqual(t, auth, sign())
+}
+
+func TestObjectKey(t *testing.T) {
+	require.Equal(t, "godoxy/certs/cert.crt", objectKey("godoxy/", "certs/cert.crt"))
+	require.Equal(t, "godoxy/app/certs/cert.crt", objectKey("godoxy/", "/app/certs/cert.crt"))
+}
@@ -0,0 +1,166 @@
+// Package storage stores certificates, keys and ACME accounts,
+// and provides the lock that keeps GoDoxy instances sharing them from issuing at the same time.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/serialization"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// Storage is a key-value store for certificates.
+// Keys are slash separated paths, e.g. certs/cert.crt.
+type Storage interface {
+	// Load returns the value of key, or an error matching fs.ErrNotExist.
+	Load(ctx context.Context, key string) ([]byte, error)
+	// Store writes value to key. Private values are only readable by the owner where supported.
+	Store(ctx context.Context, key string, value []byte, private bool) error
+	// Delete removes key, it is not an error if key does not exist.
+	Delete(ctx context.Context, key string) error
+	// List returns the keys starting with prefix.
+	List(ctx context.Context, prefix string) ([]string, error)
+	// Version returns an opaque value that changes whenever key is stored,
+	// or an error matching fs.ErrNotExist.
+	Version(ctx context.Context, key string) (string, error)
+	// Lock blocks until it holds the lock named key or ctx is done.
+	// The lock is kept alive until unlock is called, and expires after LockTTL if the holder dies.
+	Lock(ctx context.Context, key string) (unlock func(), err error)
+	// String describes the storage for logs.
+	String() string
+}
+
+type Config struct {
+	Type    string  `json:"type"`
+	Storage Storage `json:"-"`
+}
+
+const (
+	TypeFile   = "file"
+	TypeS3     = "s3"
+	TypeConsul = "consul"
+	TypeEtcd   = "etcd"
+)
+
+var AvailableTypes = []string{TypeFile, TypeS3, TypeConsul, TypeEtcd}
+
+const (
+	// LockTTL is how long a lock outlives its holder.
+	LockTTL = 2 * time.Minute
+	// lockRefreshInterval keeps the lock alive while held
+	lockRefreshInterval = LockTTL / 3
+	// lockRetryInterval is the poll interval while another instance holds the lock
+	lockRetryInterval = 2 * time.Second
+
+	requestTimeout = 30 * time.Second
+	// maxValueSize limits values read from remote storage
+	maxValueSize = 1 << 20
+)
+
+// ErrNotExist is returned for keys that do not exist.
+var ErrNotExist = fs.ErrNotExist
+
+var (
+	ErrMissingStorageType = errors.New("missing storage type")
+	ErrUnknownStorageType = errors.New("unknown storage type")
+)
+
+var httpClient = &http.Client{Timeout: requestTimeout}
+
+// UnmarshalMap implements MapUnmarshaler.
+func (cfg *Config) UnmarshalMap(m map[string]any) error {
+	storageType, ok := m["type"].(string)
+	if !ok || storageType == "" {
+		return ErrMissingStorageType
+	}
+	delete(m, "type")
+	cfg.Type = storageType
+
+	switch cfg.Type {
+	case TypeFile:
+		cfg.Storage = NewFile()
+		for k := range m {
+			return gperr.PrependSubject(serialization.ErrUnknownField, k).Withf("file storage has no options")
+		}
+		return nil
+	case TypeS3:
+		cfg.Storage = &S3{}
+	case TypeConsul:
+		cfg.Storage = &Consul{}
+	case TypeEtcd:
+		cfg.Storage = &Etcd{}
+	default:
+		return gperr.PrependSubject(ErrUnknownStorageType, cfg.Type).
+			Withf("expect %s", strings.Join(AvailableTypes, ", "))
+	}
+	return serialization.MapUnmarshalValidate(m, cfg.Storage)
+}
+
+// acquireLock polls tryLock until it acquires the lock or ctx is done.
+func acquireLock(ctx context.Context, key string, tryLock func(ctx context.Context) (bool, error)) error {
+	logged := false
+	for {
+		ok, err := tryLock(ctx)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return nil
+		}
+		if !logged {
+			log.Info().Str("lock", key).Msg("waiting for another instance to release the lock")
+			logged = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// keepLockAlive refreshes a held lock until the returned function is called,
+// which then releases it.
+func keepLockAlive(key string, refresh, release func(ctx context.Context) error) (unlock func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(lockRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := refresh(ctx); err != nil && ctx.Err() == nil {
+					log.Warn().Err(err).Str("lock", key).Msg("failed to refresh lock, another instance may take it over")
+				}
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		if err := release(ctx); err != nil {
+			log.Warn().Err(err).Str("lock", key).Msg("failed to release lock, it expires after the lock TTL")
+		}
+	}
+}
+
+func lockKey(key string) string {
+	return key + ".lock"
+}
+
+// objectKey returns the key in remote storages, absolute paths are stored relative to prefix.
+func objectKey(prefix, key string) string {
+	return prefix + strings.TrimLeft(key, "/")
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testStorage runs the behaviour every storage must have, keys are prefixed with base.
+func testStorage(t *testing.T, s Storage, base string) {
+	t.Helper()
+	ctx := t.Context()
+	certKey := base + "certs/cert.crt"
+	keyKey := base + "certs/priv.key"
+
+	t.Run("load missing", func(t *testing.T) {
+		_, err := s.Load(ctx, certKey)
+		require.ErrorIs(t, err, ErrNotExist)
+		_, err = s.Version(ctx, certKey)
+		require.ErrorIs(t, err, ErrNotExist)
+	})
+
+	t.Run("store and load", func(t *testing.T) {
+		require.NoError(t, s.Store(ctx, certKey, []byte("cert1"), false))
+		require.NoError(t, s.Store(ctx, keyKey, []byte("key1"), true))
+
+		data, err := s.Load(ctx, certKey)
+		require.NoError(t, err)
+		require.Equal(t, "cert1", string(data))
+		data, err = s.Load(ctx, keyKey)
+		require.NoError(t, err)
+		require.Equal(t, "key1", string(data))
+	})
+
+	t.Run("version changes on store", func(t *testing.T) {
+		v1, err := s.Version(ctx, certKey)
+		require.NoError(t, err)
+		v2, err := s.Version(ctx, certKey)
+		require.NoError(t, err)
+		require.Equal(t, v1, v2)
+
+		time.Sleep(10 * time.Millisecond) // mtime resolution of the file storage
+		require.NoError(t, s.Store(ctx, certKey, []byte("cert2"), false))
+		v3, err := s.Version(ctx, certKey)
+		require.NoError(t, err)
+		require.NotEqual(t, v1, v3)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		require.NoError(t, s.Store(ctx, base+"certs/on_demand/a.example.com.crt", []byte("a"), false))
+		require.NoError(t, s.Store(ctx, base+"certs/on_demand/b.example.com.crt", []byte("b"), false))
+
+		keys, err := s.List(ctx, base+"certs/on_demand/")
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{
+			base + "certs/on_demand/a.example.com.crt",
+			base + "certs/on_demand/b.example.com.crt",
+		}, keys)
+
+		keys, err = s.List(ctx, base+"missing/")
+		require.NoError(t, err)
+		require.Empty(t, keys)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, s.Delete(ctx, certKey))
+		_, err := s.Load(ctx, certKey)
+		require.ErrorIs(t, err, ErrNotExist)
+		require.NoError(t, s.Delete(ctx, certKey), "deleting a missing key")
+	})
+
+	t.Run("lock", func(t *testing.T) {
+		unlock, err := s.Lock(ctx, certKey)
+		require.NoError(t, err)
+
+		waitCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		_, err = s.Lock(waitCtx, certKey)
+		cancel()
+		require.ErrorIs(t, err, context.DeadlineExceeded, "lock is held")
+
+		acquired := make(chan func())
+		go func() {
+			unlock, err := s.Lock(ctx, certKey)
+			if err == nil {
+				acquired <- unlock
+			}
+		}()
+		unlock()
+		select {
+		case unlock := <-acquired:
+			unlock()
+		case <-time.After(lockRetryInterval + 5*time.Second):
+			t.Fatal("lock was not acquired after release")
+		}
+	})
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewMemory(), "")
+}
+
+func TestFile(t *testing.T) {
+	testStorage(t, NewFile(), filepath.ToSlash(t.TempDir())+"/")
+}
+
+func TestFileStaleLock(t *testing.T) {
+	key := filepath.ToSlash(t.TempDir()) + "/cert.crt"
+	s := NewFile()
+	_, err := s.Lock(t.Context(), key)
+	require.NoError(t, err)
+
+	// the holder died without releasing it
+	stale := time.Now().Add(-LockTTL - time.Minute)
+	require.NoError(t, os.Chtimes(filepath.FromSlash(lockKey(key)), stale, stale))
+
+	unlock, err := s.Lock(t.Context(), key)
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestConfigUnmarshal(t *testing.T) {
+	var cfg Config
+	require.ErrorIs(t, cfg.UnmarshalMap(map[string]any{}), ErrMissingStorageType)
+
+	cfg = Config{}
+	require.ErrorIs(t, cfg.UnmarshalMap(map[string]any{"type": "redis"}), ErrUnknownStorageType)
+
+	cfg = Config{}
+	require.NoError(t, cfg.UnmarshalMap(map[string]any{"type": TypeFile}))
+	require.IsType(t, &File{}, cfg.Storage)
+
+	cfg = Config{}
+	err := cfg.UnmarshalMap(map[string]any{"type": TypeFile, "bucket": "certs"})
+	require.Error(t, err)
+	require.False(t, errors.Is(err, ErrUnknownStorageType))
+}
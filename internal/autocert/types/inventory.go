@@ -0,0 +1,49 @@
+package autocert
+
+const (
+	CertKindServer   = "server"    // served on the HTTPS entrypoint
+	CertKindClientCA = "client_ca" // trusted by an inbound mTLS profile
+)
+
+type CertInventoryItem struct {
+	Name     string `json:"name"` // main, extra[1], on_demand[host] or inbound_mtls[profile]
+	Kind     string `json:"kind" enums:"server,client_ca"`
+	CertPath string `json:"cert_path,omitempty"`
+	// Error is set when the certificate is not loaded, the fields below are then empty
+	Error string `json:"error,omitempty"`
+
+	Subject        string   `json:"subject"`
+	Issuer         string   `json:"issuer"`
+	SerialNumber   string   `json:"serial_number"`
+	NotBefore      int64    `json:"not_before"`
+	NotAfter       int64    `json:"not_after"`
+	DNSNames       []string `json:"dns_names"`
+	IPAddresses    []string `json:"ip_addresses"`
+	EmailAddresses []string `json:"email_addresses"`
+	KeyType        string   `json:"key_type"` // e.g. ECDSA P-256, RSA 2048
+	ChainValid     bool     `json:"chain_valid"`
+	ChainError     string   `json:"chain_error,omitempty"`
+
+	OCSPStatus         string `json:"ocsp_status,omitempty"` // good or revoked, empty if not stapled
+	OCSPNextUpdate     int64  `json:"ocsp_next_update,omitempty"`
+	RenewAt            int64  `json:"renew_at,omitempty"`
+	RenewalWindowStart int64  `json:"renewal_window_start,omitempty"` // suggested by the CA (ARI)
+	RenewalWindowEnd   int64  `json:"renewal_window_end,omitempty"`
+	LastFailure        int64  `json:"last_failure,omitempty"` // last failed renewal
+
+	Routes []string `json:"routes"` // routes served with this certificate, or verifying clients with this CA
+} // @name CertInventoryItem
+
+type CertPreflightResult struct {
+	Route    string `json:"route"`
+	Hostname string `json:"hostname"`
+	// Fallback is what the handshake gets instead of a matching certificate
+	Fallback string `json:"fallback" enums:"on_demand,local_ca,main,none"`
+} // @name CertPreflightResult
+
+const (
+	CertFallbackOnDemand = "on_demand"
+	CertFallbackLocalCA  = "local_ca"
+	CertFallbackMain     = "main" // the main certificate, clients reject it
+	CertFallbackNone     = "none" // no certificate at all, the handshake fails
+)
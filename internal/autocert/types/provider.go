@@ -10,6 +10,8 @@ import (
 type Provider interface {
 	GetCert(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
 	GetCertInfos() ([]CertInfo, error)
+	GetCertInventory() []CertInventoryItem
+	CertPreflight() []CertPreflightResult
 	ScheduleRenewalAll(parent task.Parent)
 	ObtainCertAll(ctx context.Context) error
 	ForceExpiryAll() bool
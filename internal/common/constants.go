@@ -13,6 +13,8 @@ const (
 	NamespaceHomepageOverrides = ".homepage"
 
 	MiddlewareComposeBasePath = ConfigBasePath + "/middlewares"
+	WasmPluginsBasePath       = ConfigBasePath + "/plugins"
+	RulePresetsBasePath       = ConfigBasePath + "/rule_presets"
 
 	ErrorPagesBasePath = "error_pages"
 )
@@ -22,6 +24,7 @@ var RequiredDirectories = []string{
 	DataDir,
 	ErrorPagesBasePath,
 	MiddlewareComposeBasePath,
+	RulePresetsBasePath,
 }
 
 const DockerHostFromEnv = "$DOCKER_HOST"
@@ -48,6 +48,9 @@ var (
 
 	DebugDisableAuth = env.GetEnvBool("DEBUG_DISABLE_AUTH", false)
 
+	// secret of signed rules trace headers, signed headers are rejected when empty
+	RulesTraceSecret = decodeJWTKey(env.GetEnvString("RULES_TRACE_SECRET", ""))
+
 	// OIDC Configuration.
 	OIDCIssuerURL       = env.GetEnvString("OIDC_ISSUER_URL", "")
 	OIDCClientID        = env.GetEnvString("OIDC_CLIENT_ID", "")
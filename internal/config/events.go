@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -37,9 +38,10 @@ func logNotify(level zerolog.Level, action string, err error) {
 
 	log.WithLevel(level).Err(err).Msg("config " + action)
 	notif.FromCtx(ctx).Notify(&notif.LogMessage{
-		Level: level,
-		Title: fmt.Sprintf("Config %s", action),
-		Body:  notif.ErrorBody(err),
+		Level:  level,
+		Title:  fmt.Sprintf("Config %s", action),
+		Body:   notif.ErrorBody(err),
+		Source: notif.SourceConfig,
 	})
 	eventLevel := events.LevelWarn
 	if level >= zerolog.ErrorLevel {
@@ -62,6 +64,21 @@ func WatchChanges() {
 	eventQueue := eventqueue.New(t, opts)
 	stream := cfgWatcher.Watch(t)
 	eventQueue.Start(stream.Events, stream.Errors)
+
+	// routes resolve rule presets on load, reload them when a preset changes
+	if _, err := os.Stat(common.RulePresetsBasePath); err == nil {
+		opts.OnFlush = OnRulePresetChange
+		stream := watcher.NewDirectoryWatcher(t, common.RulePresetsBasePath).Watch(t)
+		eventqueue.New(t, opts).Start(stream.Events, stream.Errors)
+	}
+}
+
+func OnRulePresetChange(ev []watcherEvents.Event) {
+	if len(ev) == 0 {
+		return
+	}
+	log.Info().Str("preset", ev[len(ev)-1].ActorName).Msg("rule preset changed, reloading config")
+	reloadConfig()
 }
 
 func OnConfigChange(ev []watcherEvents.Event) {
@@ -317,9 +317,10 @@ func (manager *RuntimeManager) report(ctx context.Context, result configtypes.Re
 
 	if combinedErr != nil && ctx != nil {
 		notif.FromCtx(ctx).Notify(&notif.LogMessage{
-			Level: notifLevel,
-			Title: fmt.Sprintf("Configuration lifecycle %s", result.Health),
-			Body:  notif.ErrorBody(combinedErr),
+			Level:  notifLevel,
+			Title:  fmt.Sprintf("Configuration lifecycle %s", result.Health),
+			Body:   notif.ErrorBody(combinedErr),
+			Source: notif.SourceConfig,
 		})
 	}
 	return result
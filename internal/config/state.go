@@ -3,7 +3,6 @@ package config
 import (
 	"cmp"
 	"context"
-	"crypto/tls"
 	"crypto/x509"
 	"errors"
 	"fmt"
@@ -25,6 +24,7 @@ import (
 	"github.com/yusing/godoxy/internal/agentpool"
 	"github.com/yusing/godoxy/internal/api"
 	"github.com/yusing/godoxy/internal/autocert"
+	"github.com/yusing/godoxy/internal/autocert/localca"
 	autocertctx "github.com/yusing/godoxy/internal/autocert/types"
 	"github.com/yusing/godoxy/internal/common"
 	config "github.com/yusing/godoxy/internal/config/types"
@@ -40,6 +40,7 @@ import (
 	routeimpl "github.com/yusing/godoxy/internal/route"
 	provider "github.com/yusing/godoxy/internal/route/provider"
 	"github.com/yusing/godoxy/internal/route/rules"
+	rulemaps "github.com/yusing/godoxy/internal/route/rules/maps"
 	rulepresets "github.com/yusing/godoxy/internal/route/rules/presets"
 	"github.com/yusing/godoxy/internal/routing"
 
@@ -142,6 +143,7 @@ func (state *state) Init(data []byte) error {
 		{name: "maxmind", init: state.initMaxMind},
 		{name: "proxmox", init: state.initProxmox},
 		{name: "autocert", init: state.initAutoCert},
+		{name: "rule_maps", init: state.initRuleMaps},
 	}
 	optionalResults := make([]error, len(optionalComponents))
 	var wg sync.WaitGroup
@@ -472,9 +474,38 @@ func (state *state) initEntrypoint() error {
 	}
 
 	if state.autocertProvider != nil {
-		if domain := getAutoCertDefaultDomain(state.autocertProvider); domain != "" {
+		domain := state.autocertProvider.DefaultDomain()
+		if domain != "" {
 			state.entrypoint.ShortLinkMatcher().SetDefaultDomainSuffix("." + domain)
 		}
+		// on-demand certificates are only obtained for the exact hostnames of routes
+		ep := state.entrypoint
+		state.autocertProvider.SetOnDemandAllowFunc(func(host string) bool {
+			return ep.ServesHostname(host, domain)
+		})
+		state.autocertProvider.SetRoutesFunc(func() []autocert.RouteHostnames {
+			routes := make([]autocert.RouteHostnames, 0, ep.HTTPRoutes().Size())
+			for alias, r := range ep.HTTPRoutes().Iter {
+				profile := r.InboundMTLSProfileRef()
+				if epCfg.InboundMTLSProfile != "" {
+					profile = epCfg.InboundMTLSProfile
+				}
+				routes = append(routes, autocert.RouteHostnames{
+					Name:               alias,
+					Hostnames:          ep.RouteHostnames(alias, domain),
+					InboundMTLSProfile: profile,
+				})
+			}
+			return routes
+		})
+		// errors are reported by SetInboundMTLSProfiles below
+		cas := make(map[string][]*x509.Certificate, len(state.Config.InboundMTLSProfiles))
+		for name, profile := range state.Config.InboundMTLSProfiles {
+			if certs, err := profile.CACerts(); err == nil {
+				cas[name] = certs
+			}
+		}
+		state.autocertProvider.SetInboundMTLSCAs(cas)
 	}
 
 	entrypointctx.SetCtx(state.task, state.entrypoint)
@@ -496,30 +527,6 @@ func proxyProtocolDeprecationWarning(cfg entrypoint.Config) string {
 	return "entrypoint.support_proxy_protocol is deprecated and ignored because entrypoint.proxy_protocol is configured; remove the deprecated setting"
 }
 
-func getAutoCertDefaultDomain(p *autocert.Provider) string {
-	if p == nil {
-		return ""
-	}
-	cert, err := tls.LoadX509KeyPair(p.GetCertPath(), p.GetKeyPath())
-	if err != nil || len(cert.Certificate) == 0 {
-		return ""
-	}
-	x509Cert, err := x509.ParseCertificate(cert.Certificate[0])
-	if err != nil {
-		return ""
-	}
-
-	domain := x509Cert.Subject.CommonName
-	if domain == "" && len(x509Cert.DNSNames) > 0 {
-		domain = x509Cert.DNSNames[0]
-	}
-	domain = strings.TrimSpace(domain)
-	if after, ok := strings.CutPrefix(domain, "*."); ok {
-		domain = after
-	}
-	return strings.ToLower(domain)
-}
-
 func (state *state) initMaxMind() error {
 	maxmindCfg := state.Providers.MaxMind
 	if maxmindCfg == nil {
@@ -534,6 +541,17 @@ func (state *state) initMaxMind() error {
 	return nil
 }
 
+func (state *state) initRuleMaps() error {
+	if len(state.RuleMaps) == 0 {
+		return nil
+	}
+
+	// maps are set even with errors, those failed to load their files still have their inline values
+	maps, err := rulemaps.New(state.task, state.RuleMaps)
+	rulemaps.SetCtx(state.task, maps)
+	return err
+}
+
 func (state *state) initNotification() error {
 	notifCfg := state.Providers.Notification
 	if len(notifCfg) == 0 {
@@ -544,7 +562,12 @@ func (state *state) initNotification() error {
 	for _, notifier := range notifCfg {
 		dispatcher.RegisterProvider(notifier)
 	}
+	// invalid routing degrades to sending everything to all providers
+	err := dispatcher.SetRouting(state.Providers.NotificationRouting)
 	notif.SetCtx(state.task, dispatcher)
+	if err != nil {
+		return gperr.PrependSubject(err, "notification_routing")
+	}
 	return nil
 }
 
@@ -570,10 +593,13 @@ func (state *state) initAutoCert() error {
 	}
 
 	p.ScheduleRenewalAll(state.task)
+	p.ScheduleExpiryCheck(state.task)
 	p.PrintCertExpiriesAll()
 
 	state.autocertProvider = p
 	autocertctx.SetCtx(state.task, p)
+	// routes built from this config verify upstreams with its local CA
+	localca.SetActive(p.LocalCA())
 	return nil
 }
 
@@ -14,6 +14,7 @@ import (
 	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	"github.com/yusing/godoxy/internal/notif"
 	"github.com/yusing/godoxy/internal/proxmox"
+	rulemaps "github.com/yusing/godoxy/internal/route/rules/maps"
 	"github.com/yusing/godoxy/internal/serialization"
 	"github.com/yusing/godoxy/internal/types"
 )
@@ -26,6 +27,7 @@ type (
 		InboundMTLSProfiles map[string]types.InboundMTLSProfile `json:"inbound_mtls_profiles"`
 		Providers           Providers                           `json:"providers"`
 		MatchDomains        []string                            `json:"match_domains" validate:"domain_name"`
+		RuleMaps            map[string]*rulemaps.Config         `json:"rule_maps"`
 		Homepage            homepage.Config                     `json:"homepage"`
 		WebUI               WebUIConfig                         `json:"webui"`
 		Defaults            Defaults                            `json:"defaults"`
@@ -35,12 +37,13 @@ type (
 		HealthCheck health.HealthCheckConfig `json:"healthcheck"`
 	}
 	Providers struct {
-		Files        []string                              `json:"include" yaml:"include,omitempty" validate:"dive,filepath"`
-		Docker       map[string]types.DockerProviderConfig `json:"docker" yaml:"docker,omitempty" validate:"non_empty_docker_keys"`
-		Agents       []*agent.AgentConfig                  `json:"agents" yaml:"agents,omitempty"`
-		Notification []*notif.NotificationConfig           `json:"notification" yaml:"notification,omitempty"`
-		Proxmox      []*proxmox.Config                     `json:"proxmox" yaml:"proxmox,omitempty"`
-		MaxMind      *maxmind.Config                       `json:"maxmind" yaml:"maxmind,omitempty"`
+		Files               []string                              `json:"include" yaml:"include,omitempty" validate:"dive,filepath"`
+		Docker              map[string]types.DockerProviderConfig `json:"docker" yaml:"docker,omitempty" validate:"non_empty_docker_keys"`
+		Agents              []*agent.AgentConfig                  `json:"agents" yaml:"agents,omitempty"`
+		Notification        []*notif.NotificationConfig           `json:"notification" yaml:"notification,omitempty"`
+		NotificationRouting *notif.RoutingConfig                  `json:"notification_routing" yaml:"notification_routing,omitempty"`
+		Proxmox             []*proxmox.Config                     `json:"proxmox" yaml:"proxmox,omitempty"`
+		MaxMind             *maxmind.Config                       `json:"maxmind" yaml:"maxmind,omitempty"`
 	}
 )
 
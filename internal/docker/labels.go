@@ -15,6 +15,10 @@ const (
 	LabelStartEndpoint = NSProxy + ".start_endpoint"
 	LabelDependsOn     = NSProxy + ".depends_on"
 	LabelNoLoadingPage = NSProxy + ".no_loading_page" // No loading page when using idlewatcher
+	LabelIdleSchedule  = NSProxy + ".idle_schedule"
+	LabelIdleKeepalive = NSProxy + ".idle_keepalive"
+	LabelIdleQueue     = NSProxy + ".idle_queue"
+	LabelIdleProbe     = NSProxy + ".idle_stream_probe"
 	LabelNetwork       = NSProxy + ".network"
 )
 
@@ -28,4 +32,8 @@ var idlewatcherLabels = map[string]string{
 	LabelStartEndpoint: "start_endpoint",
 	LabelDependsOn:     "depends_on",
 	LabelNoLoadingPage: "no_loading_page",
+	LabelIdleSchedule:  "schedule",
+	LabelIdleKeepalive: "keepalive",
+	LabelIdleQueue:     "queue",
+	LabelIdleProbe:     "stream_probe",
 }
@@ -1,7 +1,6 @@
 package entrypoint
 
 import (
-	"crypto/x509"
 	"maps"
 	"net"
 	"net/http"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
 	"github.com/yusing/godoxy/internal/logging/accesslog"
 	"github.com/yusing/godoxy/internal/net/gphttp/middleware"
 	"github.com/yusing/godoxy/internal/route/rules"
@@ -37,6 +37,7 @@ type Entrypoint struct {
 	accessLogger     accesslog.AccessLogger
 	findRouteFunc    findRouteFunc
 	findRouteKeyFunc findRouteKeyFunc
+	findRouteDomains []string // match domains, with a leading dot
 	shortLinkMatcher *ShortLinkMatcher
 
 	streamRoutes   *pool.Pool[routing.StreamRoute]
@@ -49,7 +50,7 @@ type Entrypoint struct {
 
 	sni *sniRouter
 
-	inboundMTLSProfiles map[string]*x509.CertPool
+	inboundMTLSProfiles map[string]*inboundMTLSProfile
 }
 
 var _ routing.Entrypoint = &Entrypoint{}
@@ -70,7 +71,7 @@ func NewEntrypoint(parent task.Parent, cfg *Config) *Entrypoint {
 		streamRoutes:        pool.New[routing.StreamRoute]("stream_routes", "stream_routes"),
 		excludedRoutes:      pool.New[routing.Route]("excluded_routes", "excluded_routes"),
 		servers:             xsync.NewMap[string, *httpServer](),
-		inboundMTLSProfiles: make(map[string]*x509.CertPool),
+		inboundMTLSProfiles: make(map[string]*inboundMTLSProfile),
 	}
 	history := events.FromCtx(parent.Context())
 	ep.streamRoutes.SetEventHistory(history)
@@ -124,7 +125,17 @@ func (ep *Entrypoint) GetServer(addr string) (HTTPServer, bool) {
 	return ep.servers.Load(addr)
 }
 
+// FindHTTPRoute returns the route served on the HTTPS entrypoint for host, or nil if none.
+func (ep *Entrypoint) FindHTTPRoute(host string) routing.HTTPRoute {
+	srv, ok := ep.servers.Load(common.ProxyHTTPSAddr)
+	if !ok {
+		return nil
+	}
+	return srv.FindRoute(host)
+}
+
 func (ep *Entrypoint) SetFindRouteDomains(domains []string) {
+	ep.findRouteDomains = domains
 	if len(domains) == 0 {
 		ep.findRouteFunc = findRouteAnyDomain
 		ep.findRouteKeyFunc = findRouteKeyAnyDomain
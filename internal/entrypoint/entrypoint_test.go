@@ -151,6 +151,17 @@ func TestFindRouteByDomains(t *testing.T) {
 	run(t, ep, tests, testsNoMatch)
 }
 
+func TestRouteHostnames(t *testing.T) {
+	ep := NewTestEntrypoint(t, nil)
+	require.Equal(t, []string{"app.example.com"}, ep.RouteHostnames("app", "example.com"))
+	require.Equal(t, []string{"app.other.com"}, ep.RouteHostnames("app.other.com", "example.com"))
+	require.Empty(t, ep.RouteHostnames("app", ""))
+
+	ep.SetFindRouteDomains([]string{".domain.com", "sub.domain.com"})
+	require.Equal(t, []string{"app.domain.com", "app.sub.domain.com"}, ep.RouteHostnames("app", "example.com"))
+	require.Equal(t, []string{"app.other.com.domain.com", "app.other.com.sub.domain.com", "app.other.com"}, ep.RouteHostnames("app.other.com", ""))
+}
+
 func TestFindRouteByDomainsExactMatch(t *testing.T) {
 	ep := NewTestEntrypoint(t, nil)
 	ep.SetFindRouteDomains([]string{
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -12,6 +13,8 @@ import (
 	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/rs/zerolog/log"
 	acl "github.com/yusing/godoxy/internal/acl/types"
+	"github.com/yusing/godoxy/internal/autocert/acmechallenge"
+	"github.com/yusing/godoxy/internal/autocert/localca"
 	autocert "github.com/yusing/godoxy/internal/autocert/types"
 	"github.com/yusing/godoxy/internal/common"
 	"github.com/yusing/godoxy/internal/logging/accesslog"
@@ -131,12 +134,28 @@ func (srv *httpServer) listen(addr string, proto HTTPProto, listener net.Listene
 	}
 	srv.stopFunc = task.FinishAndWait
 	srv.addr = addr
+	markACMEChallengeListener(addr, proto)
 	srv.routes = pool.New[routing.HTTPRoute](fmt.Sprintf("[%s] %s", proto, addr), "http_routes")
 	srv.routes.SetEventHistory(events.FromCtx(srv.ep.task.Context()))
 	srv.routes.DisableLog(srv.ep.httpPoolDisableLog.Load())
 	return nil
 }
 
+// markACMEChallengeListener marks the listener ready for ACME challenges
+// when it is on the default HTTP or HTTPS port.
+func markACMEChallengeListener(addr string, proto HTTPProto) {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return
+	}
+	switch {
+	case proto == HTTPProtoHTTP && port == strconv.Itoa(common.ProxyHTTPPort):
+		acmechallenge.HTTPListenerStarted()
+	case proto == HTTPProtoHTTPS && port == strconv.Itoa(common.ProxyHTTPSPort):
+		acmechallenge.HTTPSListenerStarted()
+	}
+}
+
 func (srv *httpServer) Close() {
 	if srv.stopFunc == nil {
 		return
@@ -175,6 +194,15 @@ func (srv *httpServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}()
 	}
 
+	// answer pending http-01 challenges before route lookup
+	if acmechallenge.ServeHTTP(w, r) {
+		return
+	}
+	// the local CA ACME directory has no route
+	if ca := localca.Active(); ca != nil && ca.ServeACME(w, r) {
+		return
+	}
+
 	route, err := srv.resolveRequestRoute(r)
 	switch {
 	case errors.Is(err, errSecureRouteRequiresSNI), errors.Is(err, errSecureRouteMisdirected):
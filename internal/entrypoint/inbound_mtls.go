@@ -8,17 +8,24 @@ import (
 	"os"
 
 	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/autocert/acmechallenge"
+	"github.com/yusing/godoxy/internal/net/clientcert"
 	"github.com/yusing/godoxy/internal/routing"
 	"github.com/yusing/godoxy/internal/types"
 	gperr "github.com/yusing/goutils/errs"
 )
 
-func compileInboundMTLSProfiles(profiles map[string]types.InboundMTLSProfile) (map[string]*x509.CertPool, error) {
+type inboundMTLSProfile struct {
+	pool       *x509.CertPool
+	revocation *clientcert.RevocationChecker // nil without revocation check
+}
+
+func compileInboundMTLSProfiles(profiles map[string]types.InboundMTLSProfile) (map[string]*inboundMTLSProfile, error) {
 	if len(profiles) == 0 {
-		return map[string]*x509.CertPool{}, nil
+		return map[string]*inboundMTLSProfile{}, nil
 	}
 
-	compiled := make(map[string]*x509.CertPool, len(profiles))
+	compiled := make(map[string]*inboundMTLSProfile, len(profiles))
 	errs := gperr.NewBuilder("inbound mTLS profiles error")
 
 	for name, profile := range profiles {
@@ -32,7 +39,15 @@ func compileInboundMTLSProfiles(profiles map[string]types.InboundMTLSProfile) (m
 			errs.AddSubjectf(err, "profiles.%s", name)
 			continue
 		}
-		compiled[name] = pool
+		compiledProfile := &inboundMTLSProfile{pool: pool}
+		if rev := profile.Revocation; rev != nil {
+			compiledProfile.revocation, err = clientcert.NewRevocationChecker(rev.CRLFiles, rev.OCSP, rev.SoftFail)
+			if err != nil {
+				errs.AddSubjectf(err, "profiles.%s.revocation", name)
+				continue
+			}
+		}
+		compiled[name] = compiledProfile
 	}
 
 	if err := errs.Error(); err != nil {
@@ -86,33 +101,50 @@ func (srv *httpServer) mutateServerTLSConfig(base *tls.Config) *tls.Config {
 	if base == nil {
 		return base
 	}
+	base = acmechallenge.WithNextProto(base)
 
-	pool, enabled, err := srv.resolveInboundMTLSProfileForGlobal()
+	profile, enabled, err := srv.resolveInboundMTLSProfileForGlobal()
 	switch {
 	case err != nil:
 		log.Err(err).Msg("inbound mTLS: failed to resolve global profile, falling back to per-route mTLS")
 	case enabled:
-		return applyInboundMTLSProfile(base, pool)
+		cfg := applyInboundMTLSProfile(base, profile)
+		// ACME validation servers do not present client certificates
+		cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			if acmechallenge.IsTLSALPN01(hello) {
+				return cloneTLSConfig(base), nil
+			}
+			return nil, nil
+		}
+		return cfg
 	}
 
 	cfg := base.Clone()
 	cfg.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
-		pool, enabled, err := srv.resolveInboundMTLSProfileForServerName(hello.ServerName, false)
+		if acmechallenge.IsTLSALPN01(hello) {
+			return cloneTLSConfig(base), nil
+		}
+		profile, enabled, err := srv.resolveInboundMTLSProfileForServerName(hello.ServerName, false)
 		if err != nil {
 			return nil, err
 		}
 		if enabled {
-			return applyInboundMTLSProfile(base, pool), nil
+			return applyInboundMTLSProfile(base, profile), nil
 		}
 		return cloneTLSConfig(base), nil
 	}
 	return cfg
 }
 
-func applyInboundMTLSProfile(base *tls.Config, pool *x509.CertPool) *tls.Config {
+func applyInboundMTLSProfile(base *tls.Config, profile *inboundMTLSProfile) *tls.Config {
 	cfg := cloneTLSConfig(base)
 	cfg.ClientAuth = tls.RequireAndVerifyClientCert
-	cfg.ClientCAs = pool
+	cfg.ClientCAs = profile.pool
+	if profile.revocation != nil {
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return profile.revocation.Check(cs.VerifiedChains)
+		}
+	}
 	return cfg
 }
 
@@ -135,7 +167,7 @@ func ValidateInboundMTLSProfileRef(profileRef, globalProfile string, profiles ma
 	return nil
 }
 
-func (srv *httpServer) resolveInboundMTLSProfileForServerName(serverName string, allowGlobal bool) (pool *x509.CertPool, enabled bool, err error) {
+func (srv *httpServer) resolveInboundMTLSProfileForServerName(serverName string, allowGlobal bool) (profile *inboundMTLSProfile, enabled bool, err error) {
 	if serverName == "" {
 		if allowGlobal {
 			return srv.resolveInboundMTLSProfileForGlobal()
@@ -143,17 +175,17 @@ func (srv *httpServer) resolveInboundMTLSProfileForServerName(serverName string,
 		return nil, false, nil
 	}
 
-	pool, enabled, err = srv.resolveInboundMTLSProfileForRoute(srv.FindRoute(serverName))
+	profile, enabled, err = srv.resolveInboundMTLSProfileForRoute(srv.FindRoute(serverName))
 	if err != nil {
 		return nil, false, err
 	}
 	if enabled || !allowGlobal {
-		return pool, enabled, nil
+		return profile, enabled, nil
 	}
 	return srv.resolveInboundMTLSProfileForGlobal()
 }
 
-func (srv *httpServer) resolveInboundMTLSProfileForRoute(route routing.HTTPRoute) (pool *x509.CertPool, enabled bool, err error) {
+func (srv *httpServer) resolveInboundMTLSProfileForRoute(route routing.HTTPRoute) (profile *inboundMTLSProfile, enabled bool, err error) {
 	if route == nil {
 		return nil, false, nil
 	}
@@ -166,7 +198,7 @@ func (srv *httpServer) resolveInboundMTLSProfileForRoute(route routing.HTTPRoute
 	return nil, false, nil
 }
 
-func (srv *httpServer) resolveInboundMTLSProfileForGlobal() (pool *x509.CertPool, enabled bool, err error) {
+func (srv *httpServer) resolveInboundMTLSProfileForGlobal() (profile *inboundMTLSProfile, enabled bool, err error) {
 	if globalRef := srv.ep.cfg.InboundMTLSProfile; globalRef != "" {
 		if p, ok := srv.lookupInboundMTLSProfile(globalRef); ok {
 			return p, true, nil
@@ -176,10 +208,10 @@ func (srv *httpServer) resolveInboundMTLSProfileForGlobal() (pool *x509.CertPool
 	return nil, false, nil
 }
 
-func (srv *httpServer) lookupInboundMTLSProfile(ref string) (*x509.CertPool, bool) {
+func (srv *httpServer) lookupInboundMTLSProfile(ref string) (*inboundMTLSProfile, bool) {
 	if len(srv.ep.inboundMTLSProfiles) == 0 { // nil or empty map
 		return nil, false
 	}
-	pool, ok := srv.ep.inboundMTLSProfiles[ref]
-	return pool, ok
+	profile, ok := srv.ep.inboundMTLSProfiles[ref]
+	return profile, ok
 }
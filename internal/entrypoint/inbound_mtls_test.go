@@ -17,6 +17,7 @@ import (
 	"github.com/stretchr/testify/require"
 	agentcert "github.com/yusing/godoxy/agent/pkg/agent"
 	"github.com/yusing/godoxy/internal/agentpool"
+	"github.com/yusing/godoxy/internal/autocert/acmechallenge"
 	autocert "github.com/yusing/godoxy/internal/autocert/types"
 	"github.com/yusing/godoxy/internal/common"
 	"github.com/yusing/godoxy/internal/docker"
@@ -135,7 +136,21 @@ func TestMutateServerTLSConfigWithGlobalProfile(t *testing.T) {
 
 	require.Equal(t, tls.RequireAndVerifyClientCert, mutated.ClientAuth)
 	require.NotNil(t, mutated.ClientCAs)
-	require.Nil(t, mutated.GetConfigForClient)
+	require.Contains(t, mutated.NextProtos, acmechallenge.ACMETLS1Protocol)
+
+	cfg, err := mutated.GetConfigForClient(&tls.ClientHelloInfo{ServerName: "app.example.com"})
+	require.NoError(t, err)
+	require.Nil(t, cfg, "regular clients use the global profile")
+
+	// ACME validation servers do not present client certificates
+	cfg, err = mutated.GetConfigForClient(&tls.ClientHelloInfo{
+		ServerName:      "app.example.com",
+		SupportedProtos: []string{acmechallenge.ACMETLS1Protocol},
+	})
+	require.NoError(t, err)
+	require.Zero(t, cfg.ClientAuth)
+	require.Nil(t, cfg.ClientCAs)
+	require.Nil(t, cfg.GetConfigForClient)
 }
 
 func TestMutateServerTLSConfigWithoutProfilesKeepsTLSOpen(t *testing.T) {
@@ -191,6 +206,14 @@ func TestMutateServerTLSConfigWithRouteProfiles(t *testing.T) {
 	require.Zero(t, unknownCfg.ClientAuth)
 	require.Nil(t, unknownCfg.ClientCAs)
 	require.Nil(t, unknownCfg.GetConfigForClient)
+
+	acmeCfg, err := mutated.GetConfigForClient(&tls.ClientHelloInfo{
+		ServerName:      "secure-app.example.com",
+		SupportedProtos: []string{acmechallenge.ACMETLS1Protocol},
+	})
+	require.NoError(t, err)
+	require.Zero(t, acmeCfg.ClientAuth, "tls-alpn-01 validation must not require client certs")
+	require.Nil(t, acmeCfg.ClientCAs)
 }
 
 func TestMutateServerTLSConfigFallsBackToRouteProfilesAfterGlobalLookupError(t *testing.T) {
@@ -198,8 +221,8 @@ func TestMutateServerTLSConfigFallsBackToRouteProfilesAfterGlobalLookupError(t *
 	ep.SetFindRouteDomains([]string{".example.com"})
 	srv := newTestHTTPServer(t, ep)
 	srv.AddRoute(newFakeHTTPRoute(t, "secure-app", "route"))
-	ep.inboundMTLSProfiles = map[string]*x509.CertPool{
-		"route": x509.NewCertPool(),
+	ep.inboundMTLSProfiles = map[string]*inboundMTLSProfile{
+		"route": {pool: x509.NewCertPool()},
 	}
 
 	base := &tls.Config{MinVersion: tls.VersionTLS12}
@@ -248,6 +271,28 @@ func TestCompileInboundMTLSProfilesReturnsNilMapOnError(t *testing.T) {
 	require.ErrorContains(t, err, "missing.pem")
 }
 
+func TestCompileInboundMTLSProfilesRevocation(t *testing.T) {
+	compiled, err := compileInboundMTLSProfiles(map[string]types.InboundMTLSProfile{
+		"plain": {UseSystemCAs: true},
+		"ocsp":  {UseSystemCAs: true, Revocation: &types.InboundMTLSRevocation{OCSP: true}},
+	})
+	require.NoError(t, err)
+	require.Nil(t, applyInboundMTLSProfile(&tls.Config{}, compiled["plain"]).VerifyConnection)
+	require.NotNil(t, applyInboundMTLSProfile(&tls.Config{}, compiled["ocsp"]).VerifyConnection)
+
+	_, err = compileInboundMTLSProfiles(map[string]types.InboundMTLSProfile{
+		"bad": {UseSystemCAs: true, Revocation: &types.InboundMTLSRevocation{
+			CRLFiles: []string{filepath.Join(t.TempDir(), "missing.crl")},
+		}},
+	})
+	require.ErrorContains(t, err, "missing.crl")
+
+	_, err = compileInboundMTLSProfiles(map[string]types.InboundMTLSProfile{
+		"empty": {UseSystemCAs: true, Revocation: &types.InboundMTLSRevocation{}},
+	})
+	require.ErrorContains(t, err, "revocation requires crl_files or ocsp")
+}
+
 func TestMutateServerTLSConfigRejectsUnknownRouteProfile(t *testing.T) {
 	ep := NewTestEntrypoint(t, nil)
 	ep.SetFindRouteDomains([]string{".example.com"})
@@ -555,6 +600,12 @@ func (p *staticCertProvider) GetCert(*tls.ClientHelloInfo) (*tls.Certificate, er
 	return p.cert, nil
 }
 func (p *staticCertProvider) GetCertInfos() ([]autocert.CertInfo, error) { return nil, nil }
+func (p *staticCertProvider) GetCertInventory() []autocert.CertInventoryItem {
+	return nil
+}
+func (p *staticCertProvider) CertPreflight() []autocert.CertPreflightResult {
+	return nil
+}
 func (p *staticCertProvider) ScheduleRenewalAll(task.Parent) {
 	// no-op: test stub
 }
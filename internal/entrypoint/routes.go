@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/yusing/godoxy/internal/common"
 	"github.com/yusing/godoxy/internal/routing"
@@ -28,6 +30,37 @@ func (ep *Entrypoint) IterRoutes(yield func(r routing.Route) bool) {
 	}
 }
 
+// RouteHostnames returns the hostnames an HTTP route alias is served on.
+// Without match domains, aliases without a dot are assumed to be served under defaultDomain.
+func (ep *Entrypoint) RouteHostnames(alias, defaultDomain string) []string {
+	if len(ep.findRouteDomains) == 0 {
+		switch {
+		case strings.Contains(alias, "."):
+			return []string{alias}
+		case defaultDomain != "":
+			return []string{alias + "." + defaultDomain}
+		default:
+			return nil
+		}
+	}
+	hostnames := make([]string, 0, len(ep.findRouteDomains)+1)
+	for _, domain := range ep.findRouteDomains {
+		hostnames = append(hostnames, alias+domain)
+	}
+	if strings.Contains(alias, ".") {
+		// matched exactly as well
+		hostnames = append(hostnames, alias)
+	}
+	return hostnames
+}
+
+// ServesHostname reports whether host is one of the RouteHostnames of an HTTP route.
+// Unlike FindHTTPRoute, it does not match the first label of any domain or wildcard aliases.
+func (ep *Entrypoint) ServesHostname(host, defaultDomain string) bool {
+	r := ep.FindHTTPRoute(host)
+	return r != nil && slices.Contains(ep.RouteHostnames(r.Key(), defaultDomain), host)
+}
+
 func (ep *Entrypoint) NumRoutes() int {
 	return ep.HTTPRoutes().Size() + ep.streamRoutes.Size() + ep.excludedRoutes.Size()
 }
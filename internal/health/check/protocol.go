@@ -0,0 +1,225 @@
+package healthcheck
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusing/godoxy/internal/health"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DialFunc dials the target of a protocol probe, e.g. directly or through an agent.
+type DialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+const (
+	ProtocolSSH       = "ssh"
+	ProtocolMinecraft = "minecraft"
+	ProtocolDNS       = "dns"
+)
+
+var ErrUnknownProtocol = errors.New("unknown protocol probe")
+
+// maxMinecraftStatusSize bounds the status JSON, which may embed a base64 favicon.
+const maxMinecraftStatusSize = 1 << 20
+
+// Protocol dials target.Host over target.Scheme and checks that the server speaks
+// the given protocol, i.e. it is ready to serve clients rather than only
+// accepting connections.
+//
+// Dial and probe failures are reported as unhealthy results.
+func Protocol(ctx context.Context, protocol string, dial DialFunc, target *url.URL, timeout time.Duration) (health.HealthCheckResult, error) {
+	var probe func(net.Conn, *url.URL) error
+	switch protocol {
+	case ProtocolSSH:
+		probe = probeSSH
+	case ProtocolMinecraft:
+		probe = probeMinecraft
+	case ProtocolDNS:
+		probe = probeDNS
+	default:
+		return health.HealthCheckResult{}, fmt.Errorf("%w: %q", ErrUnknownProtocol, protocol)
+	}
+
+	if result, invalid := invalidTargetURL(target); invalid {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if dial == nil {
+		dialer := net.Dialer{FallbackDelay: -1}
+		dial = dialer.DialContext
+	}
+
+	start := time.Now()
+	conn, err := dial(ctx, target.Scheme, target.Host)
+	if err != nil {
+		return health.HealthCheckResult{
+			Latency: time.Since(start),
+			Detail:  err.Error(),
+		}, nil
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	err = probe(conn, target)
+	lat := time.Since(start)
+	if err != nil {
+		return health.HealthCheckResult{
+			Latency: lat,
+			Detail:  protocol + ": " + err.Error(),
+		}, nil
+	}
+	return health.HealthCheckResult{
+		Latency: lat,
+		Healthy: true,
+	}, nil
+}
+
+// probeSSH waits for the SSH identification string.
+// Servers may send other lines before it (RFC 4253 section 4.2).
+func probeSSH(conn net.Conn, _ *url.URL) error {
+	r := bufio.NewReaderSize(conn, 256)
+	for range 16 {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			return err
+		}
+		if bytes.HasPrefix(line, []byte("SSH-")) {
+			return nil
+		}
+	}
+	return errors.New("no identification string received")
+}
+
+// probeMinecraft performs a Server List Ping (handshake with next state
+// "status", then a status request) and expects a JSON status response.
+func probeMinecraft(conn net.Conn, url *url.URL) error {
+	port, err := strconv.ParseUint(url.Port(), 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q", url.Port())
+	}
+
+	handshake := binary.AppendUvarint(nil, 0x00)                // packet id: handshake
+	handshake = binary.AppendUvarint(handshake, math.MaxUint32) // protocol version -1: version query
+	handshake = appendMinecraftString(handshake, url.Hostname())
+	handshake = binary.BigEndian.AppendUint16(handshake, uint16(port))
+	handshake = binary.AppendUvarint(handshake, 1) // next state: status
+
+	req := binary.AppendUvarint(nil, uint64(len(handshake)))
+	req = append(req, handshake...)
+	req = append(req, 0x01, 0x00) // status request
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	if _, err := binary.ReadUvarint(r); err != nil { // packet length
+		return err
+	}
+	packetID, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if packetID != 0x00 {
+		return fmt.Errorf("unexpected packet id %#x", packetID)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if size == 0 || size > maxMinecraftStatusSize {
+		return fmt.Errorf("invalid status size %d", size)
+	}
+	status := make([]byte, size)
+	if _, err := io.ReadFull(r, status); err != nil {
+		return err
+	}
+	if !json.Valid(status) {
+		return errors.New("invalid status response")
+	}
+	return nil
+}
+
+func appendMinecraftString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// probeDNS sends a root NS query and accepts any response to it,
+// including errors such as REFUSED, as the server is answering.
+func probeDNS(conn net.Conn, url *url.URL) error {
+	id := uint16(rand.Uint32())
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("."),
+			Type:  dnsmessage.TypeNS,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	query, err := msg.Pack()
+	if err != nil {
+		return err
+	}
+
+	// DNS over TCP messages are length-prefixed (RFC 1035 section 4.2.2)
+	if strings.HasPrefix(url.Scheme, "tcp") {
+		query = append(binary.BigEndian.AppendUint16(nil, uint16(len(query))), query...)
+		if _, err := conn.Write(query); err != nil {
+			return err
+		}
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return err
+		}
+		resp := make([]byte, size)
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return err
+		}
+		return checkDNSResponse(resp, id)
+	}
+
+	if _, err := conn.Write(query); err != nil {
+		return err
+	}
+	resp := make([]byte, 4096)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return err
+		}
+		// ignore stray datagrams, e.g. late answers to a previous probe
+		if err := checkDNSResponse(resp[:n], id); err == nil {
+			return nil
+		}
+	}
+}
+
+func checkDNSResponse(resp []byte, id uint16) error {
+	var p dnsmessage.Parser
+	header, err := p.Start(resp)
+	if err != nil {
+		return err
+	}
+	if !header.Response || header.ID != id {
+		return errors.New("unexpected response")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package healthcheck
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestProtocolSSH(t *testing.T) {
+	addr := serveTCP(t, func(conn net.Conn) {
+		_, _ = io.WriteString(conn, "please wait\r\nSSH-2.0-OpenSSH_9.6\r\n")
+	})
+	result, err := Protocol(t.Context(), ProtocolSSH, nil, &url.URL{Scheme: "tcp", Host: addr}, time.Second)
+	require.NoError(t, err)
+	require.True(t, result.Healthy, result.Detail)
+
+	addr = serveTCP(t, func(conn net.Conn) {
+		_, _ = io.WriteString(conn, "HTTP/1.1 400 Bad Request\r\n")
+	})
+	result, err = Protocol(t.Context(), ProtocolSSH, nil, &url.URL{Scheme: "tcp", Host: addr}, 100*time.Millisecond)
+	require.NoError(t, err)
+	require.False(t, result.Healthy)
+}
+
+func TestProtocolMinecraft(t *testing.T) {
+	handshake := make(chan []byte, 1)
+	addr := serveTCP(t, func(conn net.Conn) {
+		r := bufio.NewReader(conn)
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return
+		}
+		packet := make([]byte, size)
+		if _, err := io.ReadFull(r, packet); err != nil {
+			return
+		}
+		handshake <- packet
+		statusRequest := make([]byte, 2)
+		if _, err := io.ReadFull(r, statusRequest); err != nil {
+			return
+		}
+
+		status := []byte(`{"version":{"name":"1.21","protocol":767}}`)
+		body := binary.AppendUvarint(nil, 0x00)
+		body = binary.AppendUvarint(body, uint64(len(status)))
+		body = append(body, status...)
+		_, _ = conn.Write(append(binary.AppendUvarint(nil, uint64(len(body))), body...))
+	})
+
+	target := &url.URL{Scheme: "tcp", Host: addr}
+	result, err := Protocol(t.Context(), ProtocolMinecraft, nil, target, time.Second)
+	require.NoError(t, err)
+	require.True(t, result.Healthy, result.Detail)
+
+	packet := <-handshake
+	require.Equal(t, byte(0x00), packet[0])
+	require.Equal(t, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}, packet[1:6])
+	require.Equal(t, byte(1), packet[len(packet)-1])
+	port := binary.BigEndian.Uint16(packet[len(packet)-3:])
+	require.Equal(t, target.Port(), strconv.Itoa(int(port)))
+}
+
+func TestProtocolDNS(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = pc.Close() })
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var msg dnsmessage.Message
+			if err := msg.Unpack(buf[:n]); err != nil {
+				continue
+			}
+			msg.Response = true
+			msg.RCode = dnsmessage.RCodeRefused
+			resp, _ := msg.Pack()
+			_, _ = pc.WriteTo(resp, addr)
+		}
+	}()
+
+	result, err := Protocol(t.Context(), ProtocolDNS, nil, &url.URL{Scheme: "udp", Host: pc.LocalAddr().String()}, time.Second)
+	require.NoError(t, err)
+	require.True(t, result.Healthy, result.Detail)
+}
+
+func TestProtocolDNSOverTCP(t *testing.T) {
+	addr := serveTCP(t, func(conn net.Conn) {
+		var size uint16
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		query := make([]byte, size)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(query); err != nil {
+			return
+		}
+		msg.Response = true
+		resp, _ := msg.Pack()
+		_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+	})
+
+	result, err := Protocol(t.Context(), ProtocolDNS, nil, &url.URL{Scheme: "tcp", Host: addr}, time.Second)
+	require.NoError(t, err)
+	require.True(t, result.Healthy, result.Detail)
+}
+
+func TestProtocolConnectionRefusedIsUnhealthy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	result, err := Protocol(t.Context(), ProtocolSSH, nil, &url.URL{Scheme: "tcp", Host: addr}, time.Second)
+	require.NoError(t, err)
+	require.False(t, result.Healthy)
+	require.NotEmpty(t, result.Detail)
+}
+
+func TestProtocolUnknown(t *testing.T) {
+	_, err := Protocol(t.Context(), "gopher", nil, &url.URL{Scheme: "tcp", Host: "127.0.0.1:70"}, time.Second)
+	require.ErrorIs(t, err, ErrUnknownProtocol)
+}
+
+func serveTCP(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
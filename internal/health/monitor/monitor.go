@@ -24,6 +24,7 @@ type (
 	HealthCheckFunc func(url *url.URL) (result health.HealthCheckResult, err error)
 	monitor         struct {
 		service string
+		alias   string // route alias for notification routing
 		config  health.HealthCheckConfig
 		url     synk.Value[*url.URL]
 
@@ -89,7 +90,8 @@ func (mon *monitor) Start(parent task.Parent) error {
 		mon.notifyFunc = notif.FromCtx(parent.Context()).Notify
 	}
 
-	mon.service = parent.Name()
+	mon.alias = parent.Name()
+	mon.service = mon.alias
 	if displayName, ok := parent.GetValue(health.DisplayNameKey{}).(string); ok {
 		mon.service = displayName
 	}
@@ -282,10 +284,12 @@ func (mon *monitor) notifyServiceUp(logger *zerolog.Logger, result *health.Healt
 	extras := mon.buildNotificationExtras(result)
 	extras.Add("Ping", fmt.Sprintf("%d ms", result.Latency.Milliseconds()))
 	mon.notifyFunc(&notif.LogMessage{
-		Level: zerolog.InfoLevel,
-		Title: "✅ Service is up ✅",
-		Body:  extras,
-		Color: notif.ColorSuccess,
+		Level:  zerolog.InfoLevel,
+		Title:  "✅ Service is up ✅",
+		Body:   extras,
+		Color:  notif.ColorSuccess,
+		Source: notif.SourceHealth,
+		Route:  mon.alias,
 	})
 	if mon.task != nil {
 		if history := events.FromCtx(mon.task.Context()); history != nil {
@@ -299,10 +303,12 @@ func (mon *monitor) notifyServiceDown(logger *zerolog.Logger, result *health.Hea
 	extras := mon.buildNotificationExtras(result)
 	extras.Add("Last Seen", strutils.FormatLastSeen(GetLastSeen(mon.service)))
 	mon.notifyFunc(&notif.LogMessage{
-		Level: zerolog.WarnLevel,
-		Title: "❌ Service went down ❌",
-		Body:  extras,
-		Color: notif.ColorError,
+		Level:  zerolog.WarnLevel,
+		Title:  "❌ Service went down ❌",
+		Body:   extras,
+		Color:  notif.ColorError,
+		Source: notif.SourceHealth,
+		Route:  mon.alias,
 	})
 	if mon.task != nil {
 		if history := events.FromCtx(mon.task.Context()); history != nil {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/rs/zerolog/log"
 	"github.com/yusing/godoxy/internal/homepage/icons"
@@ -27,6 +28,8 @@ func (w *Watcher) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	case <-r.Context().Done():
 		return
 	default:
+		w.inflight.Add(1)
+		defer w.inflight.Add(-1)
 		w.rp.ServeHTTP(rw, r)
 	}
 }
@@ -152,39 +155,28 @@ func (w *Watcher) wakeFromHTTP(rw http.ResponseWriter, r *http.Request) (shouldN
 		return false
 	}
 
-	accept := httputils.GetAccept(r.Header)
-	acceptHTML := (r.Method == http.MethodGet && accept.AcceptHTML() || r.RequestURI == "/" && accept.IsEmpty())
-
-	if acceptHTML && !w.cfg.NoLoadingPage {
-		w.wakeForLoadingPage()
-
-		// Send the loading response before provider startup or dependency health waits complete.
-		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if until, sleeping := w.scheduledSleepUntil(); sleeping {
+		rw.Header().Set("Retry-After", strconv.Itoa(retryAfter(until)))
 		setNoStoreHeaders(rw.Header())
-		rw.Header().Add("Connection", "close")
-		_ = w.writeLoadingPage(rw)
+		http.Error(rw, w.cfg.ContainerName()+" is sleeping as scheduled until "+until.Format(time.DateTime), http.StatusServiceUnavailable)
 		return false
 	}
 
-	// request cancelling should not abort wake
-	// avoid partial wake state
-	err := w.Wake(context.Background())
-	if err != nil {
-		log.Err(err).Msg("Failed to wake container")
-		if !acceptHTML {
-			http.Error(rw, "Failed to wake container", http.StatusInternalServerError)
-			return false
-		}
-	}
+	accept := httputils.GetAccept(r.Header)
+	acceptHTML := (r.Method == http.MethodGet && accept.AcceptHTML() || r.RequestURI == "/" && accept.IsEmpty())
 
-	// send a continue response to prevent client wait-header timeout
-	rw.WriteHeader(http.StatusContinue)
-	ready := w.waitForReady(r.Context())
-	if !ready {
-		serveStaticContent(rw, http.StatusInternalServerError, "text/plain", []byte("Timeout waiting for container to become ready"))
-		return false
+	if w.shouldQueue(rw, r, acceptHTML) {
+		return w.holdUntilReady(rw, r)
 	}
-	return true
+
+	w.wakeForLoadingPage()
+
+	// Send the loading response before provider startup or dependency health waits complete.
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	setNoStoreHeaders(rw.Header())
+	rw.Header().Add("Connection", "close")
+	_ = w.writeLoadingPage(rw)
+	return false
 }
 
 func (w *Watcher) wakeForLoadingPage() {
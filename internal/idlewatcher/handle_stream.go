@@ -2,6 +2,7 @@ package idlewatcher
 
 import (
 	"context"
+	"errors"
 	"net"
 
 	nettypes "github.com/yusing/godoxy/internal/net/types"
@@ -10,6 +11,11 @@ import (
 var _ nettypes.Stream = (*Watcher)(nil)
 var _ nettypes.ConnProxy = (*Watcher)(nil)
 
+var (
+	errStreamQueueFull   = errors.New("too many connections waiting for wake")
+	errStreamWakeTimeout = errors.New("timeout waiting for container to become ready")
+)
+
 // ListenAndServe implements nettypes.Stream.
 func (w *Watcher) ListenAndServe(ctx context.Context, predial, onRead nettypes.HookFunc) error {
 	return w.stream.ListenAndServe(ctx, func(ctx context.Context) error {
@@ -67,6 +73,10 @@ func (w *Watcher) onRead(ctx context.Context, onRead nettypes.HookFunc) error {
 	return nil
 }
 
+// wakeFromStream holds a new TCP connection or UDP session until the
+// container is ready, bounded by the queue size and timeout. Held TCP clients
+// are not read from and UDP datagrams are buffered by the stream, so data sent
+// meanwhile is forwarded once this returns.
 func (w *Watcher) wakeFromStream(ctx context.Context) error {
 	w.resetIdleTimer()
 
@@ -74,20 +84,25 @@ func (w *Watcher) wakeFromStream(ctx context.Context) error {
 		return nil
 	}
 
+	q := w.queueConfig()
+	queued := w.queued.Add(1)
+	defer w.queued.Add(-1)
+	if q.Size > 0 && queued > int64(q.Size) {
+		return w.newWatcherError(errStreamQueueFull)
+	}
+
+	ctx, cancel := context.WithTimeoutCause(ctx, q.Timeout, errStreamWakeTimeout)
+	defer cancel()
+
 	w.l.Debug().Msg("wake signal received")
 	err := w.Wake(ctx)
 	if err != nil {
 		return err
 	}
 
-	// Wait for route to be started
-	if !w.waitStarted(ctx) {
-		return nil
-	}
-
-	// Wait for container to become ready
-	if !w.waitForReady(ctx) {
-		return nil // canceled or failed
+	// Wait for route to be started, then for container to become ready
+	if !w.waitStarted(ctx) || !w.waitForReady(ctx) {
+		return w.newWatcherError(context.Cause(ctx))
 	}
 
 	// Container is ready
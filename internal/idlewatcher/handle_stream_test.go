@@ -3,6 +3,7 @@ package idlewatcher
 import (
 	"context"
 	"net"
+	"net/url"
 	"sync"
 	"testing"
 	"time"
@@ -67,6 +68,63 @@ func TestWakeFromStreamReadyRequestBypassesWakeSingleflight(t *testing.T) {
 	require.NoError(t, (<-sharedResult).Err)
 }
 
+func TestWakeFromStreamQueueFull(t *testing.T) {
+	w, provider := newBlockingWakeWatcher(t)
+	close(provider.release)
+	w.cfg.Queue = &idlewatchertypes.QueueConfig{Size: 1, Timeout: time.Second}
+	w.queued.Store(1)
+
+	err := w.wakeFromStream(t.Context())
+	require.ErrorIs(t, err, errStreamQueueFull)
+	require.Zero(t, provider.starts.Load())
+	require.EqualValues(t, 1, w.queued.Load())
+}
+
+func TestWakeFromStreamTimeout(t *testing.T) {
+	w, provider := newBlockingWakeWatcher(t)
+	w.route = newIdlewatcherTestRoute("app", nil, w.cfg)
+	close(provider.release)
+	w.cfg.Queue = &idlewatchertypes.QueueConfig{Size: 1, Timeout: 50 * time.Millisecond}
+
+	err := w.wakeFromStream(t.Context())
+	require.ErrorIs(t, err, errStreamWakeTimeout)
+	require.Zero(t, w.queued.Load())
+}
+
+func TestCheckHealthUsesStreamProbe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	banner := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte(<-banner))
+			_ = conn.Close()
+		}
+	}()
+
+	w := newTestWatcher(t)
+	w.route = newIdlewatcherTestRoute("app", nil, w.cfg)
+	w.stream = &testConnProxyStream{}
+	w.hc = &unhealthyHealthChecker{targetURL: &url.URL{Scheme: "tcp", Host: l.Addr().String()}}
+	w.cfg.StreamProbe = idlewatchertypes.StreamProbeSSH
+
+	// accepting connections is not enough
+	banner <- "booting\r\n"
+	result, err := w.checkHealth()
+	require.NoError(t, err)
+	require.False(t, result.Healthy)
+
+	banner <- "SSH-2.0-OpenSSH_9.6\r\n"
+	result, err = w.checkHealth()
+	require.NoError(t, err)
+	require.True(t, result.Healthy, result.Detail)
+}
+
 type testConnProxyStream struct {
 	readDone chan struct{}
 }
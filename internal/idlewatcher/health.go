@@ -1,10 +1,14 @@
 package idlewatcher
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/yusing/godoxy/internal/health"
+	healthcheck "github.com/yusing/godoxy/internal/health/check"
 	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
 	"github.com/yusing/goutils/task"
 )
@@ -137,7 +141,7 @@ func (w *Watcher) checkUpdateState() (ready bool, err error) {
 		}
 	}
 
-	res, err := w.hc.CheckHealth()
+	res, err := w.checkHealth()
 	if err != nil {
 		w.l.Debug().Err(err).Msg("health check error")
 		w.setError(err)
@@ -177,3 +181,24 @@ func (w *Watcher) checkUpdateState() (ready bool, err error) {
 
 	return false, nil
 }
+
+// checkHealth runs the configured protocol probe for stream routes, or the
+// route health check otherwise.
+func (w *Watcher) checkHealth() (health.HealthCheckResult, error) {
+	probe := w.cfg.StreamProbe
+	if w.stream == nil || probe == "" || probe == idlewatcher.StreamProbeTCP {
+		return w.hc.CheckHealth()
+	}
+	return healthcheck.Protocol(w.task.Context(), string(probe), w.dialProbe, w.hc.URL(), idleWakerCheckTimeout)
+}
+
+func (w *Watcher) dialProbe(ctx context.Context, network, address string) (net.Conn, error) {
+	if agent := w.route.GetAgent(); agent != nil {
+		if strings.HasPrefix(network, "udp") {
+			return agent.NewUDPClient(address)
+		}
+		return agent.NewTCPClient(address)
+	}
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, address)
+}
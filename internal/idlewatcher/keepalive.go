@@ -0,0 +1,103 @@
+package idlewatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/net/gphttp"
+	nettypes "github.com/yusing/godoxy/internal/net/types"
+)
+
+var keepaliveClient = &http.Client{
+	Timeout:   reqTimeout,
+	Transport: gphttp.NewTransport(),
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// keepAwakeReason reports why the container must stay awake when the idle timeout fires.
+//
+// It returns an empty string if nothing keeps the container awake.
+func (w *Watcher) keepAwakeReason(ctx context.Context) string {
+	if sched := w.cfg.Schedule; sched != nil && sched.InAwakeWindow(timeNow()) {
+		return "scheduled awake window"
+	}
+
+	ka := w.cfg.Keepalive
+	if ka == nil {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, reqTimeout)
+	defer cancel()
+
+	if ka.Sessions {
+		if n := w.activeSessions(); n > 0 {
+			return strconv.Itoa(n) + " active sessions"
+		}
+	}
+	if ka.BusyEndpoint != "" {
+		busy, err := w.checkBusyEndpoint(ctx, ka.BusyEndpoint)
+		if err != nil {
+			w.l.Debug().Err(err).Str("endpoint", ka.BusyEndpoint).Msg("busy endpoint check failed")
+		} else if busy {
+			return "busy endpoint reported busy"
+		}
+	}
+	if ka.CPUThreshold > 0 {
+		if sp, ok := w.provider.Load().(idlewatcher.StatsProvider); ok {
+			usage, err := sp.CPUUsage(ctx)
+			if err != nil {
+				w.l.Debug().Err(err).Msg("failed to get cpu usage")
+			} else if usage >= ka.CPUThreshold {
+				return fmt.Sprintf("cpu usage %.1f%% >= %.1f%%", usage, ka.CPUThreshold)
+			}
+		}
+	}
+	return ""
+}
+
+// activeSessions returns the number of in-flight HTTP requests and open stream sessions.
+func (w *Watcher) activeSessions() int {
+	n := int(w.inflight.Load())
+	if counter, ok := w.stream.(nettypes.SessionCounter); ok {
+		n += counter.ActiveSessions()
+	}
+	return n
+}
+
+// checkBusyEndpoint reports whether the upstream busy endpoint responds with 2xx.
+//
+// Relative endpoints are resolved against the health check URL, absolute endpoints are used as is.
+func (w *Watcher) checkBusyEndpoint(ctx context.Context, endpoint string) (bool, error) {
+	ref, err := url.Parse(endpoint)
+	if err != nil {
+		return false, err
+	}
+	if !ref.IsAbs() {
+		var target *url.URL
+		if w.hc != nil {
+			target = w.hc.URL()
+		}
+		if target == nil || target.Host == "" {
+			return false, errors.New("relative busy endpoint without a health check URL")
+		}
+		ref = target.ResolveReference(ref)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ref.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := keepaliveClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300, nil
+}
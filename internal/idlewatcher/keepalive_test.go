@@ -0,0 +1,111 @@
+package idlewatcher
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	idlewatchertypes "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+)
+
+func TestKeepAwakeReasonSessions(t *testing.T) {
+	w := newTestWatcher(t)
+	w.cfg.Keepalive = &idlewatchertypes.KeepaliveConfig{Sessions: true}
+
+	require.Empty(t, w.keepAwakeReason(t.Context()))
+	w.inflight.Add(1)
+	require.Equal(t, "1 active sessions", w.keepAwakeReason(t.Context()))
+	w.inflight.Add(-1)
+	require.Empty(t, w.keepAwakeReason(t.Context()))
+}
+
+func TestKeepAwakeReasonBusyEndpoint(t *testing.T) {
+	var busy atomic.Bool
+	busy.Store(true)
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/busy" || !busy.Load() {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+	targetURL, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	w := newTestWatcher(t)
+	w.hc = &unhealthyHealthChecker{targetURL: targetURL}
+	w.cfg.Keepalive = &idlewatchertypes.KeepaliveConfig{BusyEndpoint: "/api/busy"}
+
+	require.NotEmpty(t, w.keepAwakeReason(t.Context()))
+	busy.Store(false)
+	require.Empty(t, w.keepAwakeReason(t.Context()))
+
+	// absolute endpoints need no health check URL
+	busy.Store(true)
+	w.hc = &unhealthyHealthChecker{}
+	w.cfg.Keepalive.BusyEndpoint = upstream.URL + "/api/busy"
+	require.NotEmpty(t, w.keepAwakeReason(t.Context()))
+
+	_, err = w.checkBusyEndpoint(t.Context(), "/api/busy")
+	require.Error(t, err, "relative endpoints need a health check URL")
+}
+
+func TestKeepAwakeReasonCPUThreshold(t *testing.T) {
+	w := newTestWatcher(t)
+	provider := &cpuUsageProvider{usage: 35}
+	w.provider.Store(provider)
+	w.cfg.Keepalive = &idlewatchertypes.KeepaliveConfig{CPUThreshold: 30}
+
+	require.NotEmpty(t, w.keepAwakeReason(t.Context()))
+	provider.usage = 5
+	require.Empty(t, w.keepAwakeReason(t.Context()))
+}
+
+func TestKeepAwakeReasonAwakeWindow(t *testing.T) {
+	var window idlewatchertypes.ScheduleWindow
+	require.NoError(t, window.Parse("00:00-24:00"))
+	w := newTestWatcher(t)
+	w.cfg.Schedule = &idlewatchertypes.Schedule{Awake: []idlewatchertypes.ScheduleWindow{window}}
+	require.NoError(t, w.cfg.Schedule.Validate())
+
+	require.Equal(t, "scheduled awake window", w.keepAwakeReason(t.Context()))
+}
+
+func TestServeHTTPScheduledSleepRefusesWake(t *testing.T) {
+	var window idlewatchertypes.ScheduleWindow
+	require.NoError(t, window.Parse("00:00-24:00"))
+	w, provider := newBlockingWakeWatcher(t)
+	w.cfg.Schedule = &idlewatchertypes.Schedule{Sleep: []idlewatchertypes.ScheduleWindow{window}}
+	require.NoError(t, w.cfg.Schedule.Validate())
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/", nil)
+	req.Header.Set("Accept", "text/html")
+	w.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+	select {
+	case <-provider.started:
+		t.Fatal("container was started inside a scheduled sleep window")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.ErrorIs(t, w.Wake(t.Context()), ErrScheduledSleep)
+}
+
+type cpuUsageProvider struct {
+	watchUntilDestroyProvider
+
+	usage float64
+}
+
+func (p *cpuUsageProvider) CPUUsage(context.Context) (float64, error) {
+	return p.usage, nil
+}
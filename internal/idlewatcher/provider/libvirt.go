@@ -0,0 +1,161 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/libvirt"
+	"github.com/yusing/godoxy/internal/watcher"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+)
+
+type LibvirtProvider struct {
+	client *libvirt.Client
+	domain libvirt.Domain
+
+	stateCheckInterval time.Duration
+}
+
+const (
+	libvirtStateCheckInterval = 1 * time.Second
+	// libvirtCPUSampleInterval is the interval between the two CPU time samples of CPUUsage.
+	libvirtCPUSampleInterval = 1 * time.Second
+)
+
+func NewLibvirtProvider(ctx context.Context, cfg *idlewatcher.LibvirtConfig) (idlewatcher.Provider, error) {
+	if cfg.Domain == "" {
+		return nil, errors.New("domain is required")
+	}
+	client, err := libvirt.NewClient(cfg.Address, cfg.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+
+	domain, err := client.LookupDomain(ctx, cfg.Domain)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &LibvirtProvider{client: client, domain: domain}, nil
+}
+
+func (p *LibvirtProvider) ContainerPause(ctx context.Context) error {
+	return p.client.DomainSuspend(ctx, p.domain)
+}
+
+func (p *LibvirtProvider) ContainerUnpause(ctx context.Context) error {
+	return p.client.DomainResume(ctx, p.domain)
+}
+
+func (p *LibvirtProvider) ContainerStart(ctx context.Context) error {
+	return p.client.DomainCreate(ctx, p.domain)
+}
+
+// ContainerStop requests an ACPI shutdown and destroys the domain
+// if it is still running after timeout seconds, it is not destroyed when ctx is cancelled.
+func (p *LibvirtProvider) ContainerStop(ctx context.Context, _ idlewatcher.ContainerSignal, timeout int) error {
+	if err := p.client.DomainShutdown(ctx, p.domain); err != nil {
+		return err
+	}
+
+	interval := p.stateCheckInterval
+	if interval == 0 {
+		interval = libvirtStateCheckInterval
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err := p.ContainerStatus(waitCtx)
+		if err == nil && status == idlewatcher.ContainerStatusStopped {
+			return nil
+		}
+		select {
+		case <-waitCtx.Done():
+			// cancelled, e.g. on shutdown or by a newer stop, leave the guest shutting down
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+				return waitCtx.Err()
+			}
+			// guest ignored the shutdown request, power it off
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+			defer cancel()
+			return p.client.DomainDestroy(ctx, p.domain)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *LibvirtProvider) ContainerKill(ctx context.Context, _ idlewatcher.ContainerSignal) error {
+	return p.client.DomainDestroy(ctx, p.domain)
+}
+
+func (p *LibvirtProvider) ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error) {
+	info, err := p.client.DomainInfo(ctx, p.domain)
+	if err != nil {
+		return idlewatcher.ContainerStatusError, err
+	}
+	switch info.State {
+	case libvirt.DomainRunning, libvirt.DomainBlocked:
+		return idlewatcher.ContainerStatusRunning, nil
+	case libvirt.DomainPaused, libvirt.DomainPMSuspended:
+		return idlewatcher.ContainerStatusPaused, nil
+	case libvirt.DomainShutdown, libvirt.DomainShutoff, libvirt.DomainCrashed:
+		return idlewatcher.ContainerStatusStopped, nil
+	}
+	return idlewatcher.ContainerStatusError, fmt.Errorf("%w: %s", idlewatcher.ErrUnexpectedContainerStatus, info.State)
+}
+
+// CPUUsage implements idlewatcher.StatsProvider.
+//
+// Like `docker stats`, 100% means one fully used vCPU.
+func (p *LibvirtProvider) CPUUsage(ctx context.Context) (float64, error) {
+	first, err := p.client.DomainInfo(ctx, p.domain)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+
+	timer := time.NewTimer(libvirtCPUSampleInterval)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case <-timer.C:
+	}
+
+	second, err := p.client.DomainInfo(ctx, p.domain)
+	if err != nil {
+		return 0, err
+	}
+	elapsed := time.Since(start)
+	if second.CPUTime < first.CPUTime || elapsed <= 0 {
+		return 0, nil // restarted in between
+	}
+	return float64(second.CPUTime-first.CPUTime) / float64(elapsed.Nanoseconds()) * 100, nil
+}
+
+func (p *LibvirtProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan error) {
+	interval := p.stateCheckInterval
+	if interval == 0 {
+		interval = libvirtStateCheckInterval
+	}
+	return watchStatus(ctx, interval, watcher.Event{
+		Type:      watcherEvents.EventTypeDocker,
+		ActorID:   p.domain.Name,
+		ActorName: p.domain.Name,
+	}, p.ContainerStatus)
+}
+
+func (p *LibvirtProvider) Close() {
+	p.client.Close()
+}
@@ -0,0 +1,76 @@
+package provider
+
+import (
+	"context"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/watcher"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+)
+
+// watchStatus polls status every interval and emits an event on each status change,
+// for providers whose backend has no event stream.
+//
+// Status errors are sent to errCh and polling continues.
+func watchStatus(
+	ctx context.Context,
+	interval time.Duration,
+	event watcher.Event,
+	status func(ctx context.Context) (idlewatcher.ContainerStatus, error),
+) (<-chan watcher.Event, <-chan error) {
+	eventCh := make(chan watcher.Event)
+	errCh := make(chan error)
+
+	go func() {
+		defer close(eventCh)
+		defer close(errCh)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var last idlewatcher.ContainerStatus
+		for {
+			cur, err := status(ctx)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+					return
+				case errCh <- err:
+				}
+			} else {
+				if last != "" && cur != last {
+					event.Action = statusChangeAction(last, cur)
+					select {
+					case <-ctx.Done():
+						return
+					case eventCh <- event:
+					}
+				}
+				last = cur
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return eventCh, errCh
+}
+
+func statusChangeAction(from, to idlewatcher.ContainerStatus) watcherEvents.Action {
+	switch to {
+	case idlewatcher.ContainerStatusRunning:
+		if from == idlewatcher.ContainerStatusPaused {
+			return watcherEvents.ActionContainerUnpause
+		}
+		return watcherEvents.ActionContainerStart
+	case idlewatcher.ContainerStatusPaused:
+		return watcherEvents.ActionContainerPause
+	default:
+		return watcherEvents.ActionContainerStop
+	}
+}
@@ -18,7 +18,6 @@ type ProxmoxProvider struct {
 
 	vmid               uint64
 	lxcName            string
-	running            bool
 	stateCheckInterval time.Duration
 }
 
@@ -78,64 +77,21 @@ func (p *ProxmoxProvider) ContainerStatus(ctx context.Context) (idlewatcher.Cont
 	return idlewatcher.ContainerStatusError, fmt.Errorf("%w: %s", idlewatcher.ErrUnexpectedContainerStatus, string(status))
 }
 
+// CPUUsage implements idlewatcher.StatsProvider.
+func (p *ProxmoxProvider) CPUUsage(ctx context.Context) (float64, error) {
+	return p.LXCCPUUsage(ctx, p.vmid)
+}
+
 func (p *ProxmoxProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan error) {
-	eventCh := make(chan watcher.Event)
-	errCh := make(chan error)
-
-	go func() {
-		defer close(eventCh)
-		defer close(errCh)
-
-		interval := p.stateCheckInterval
-		if interval == 0 {
-			interval = proxmoxStateCheckInterval
-		}
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-
-		event := watcher.Event{
-			Type:      watcherEvents.EventTypeDocker,
-			ActorID:   strconv.FormatUint(p.vmid, 10),
-			ActorName: p.lxcName,
-		}
-		initialized := false
-		for {
-			status, err := p.ContainerStatus(ctx)
-			if err != nil {
-				select {
-				case <-ctx.Done():
-					return
-				case errCh <- err:
-				}
-			} else {
-				running := status == idlewatcher.ContainerStatusRunning
-				if !initialized {
-					p.running = running
-					initialized = true
-				} else if p.running != running {
-					p.running = running
-					if running {
-						event.Action = watcherEvents.ActionContainerStart
-					} else {
-						event.Action = watcherEvents.ActionContainerStop
-					}
-					select {
-					case <-ctx.Done():
-						return
-					case eventCh <- event:
-					}
-				}
-			}
-
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-			}
-		}
-	}()
-
-	return eventCh, errCh
+	interval := p.stateCheckInterval
+	if interval == 0 {
+		interval = proxmoxStateCheckInterval
+	}
+	return watchStatus(ctx, interval, watcher.Event{
+		Type:      watcherEvents.EventTypeDocker,
+		ActorID:   strconv.FormatUint(p.vmid, 10),
+		ActorName: p.lxcName,
+	}, p.ContainerStatus)
 }
 
 func (p *ProxmoxProvider) Close() {
@@ -64,10 +64,10 @@ func TestProxmoxWatchRecoversFromTransientStatusError(t *testing.T) {
 	}
 
 	cancel()
-	waitForProxmoxWatchStreamsToClose(t, eventCh, errCh)
+	waitForWatchStreamsToClose(t, eventCh, errCh)
 }
 
-func waitForProxmoxWatchStreamsToClose(
+func waitForWatchStreamsToClose(
 	t *testing.T,
 	eventCh <-chan watcherEvents.Event,
 	errCh <-chan error,
@@ -87,7 +87,7 @@ func waitForProxmoxWatchStreamsToClose(
 				errCh = nil
 			}
 		case <-timeout.C:
-			t.Fatal("Proxmox watcher streams did not close after cancellation")
+			t.Fatal("watcher streams did not close after cancellation")
 		}
 	}
 }
@@ -0,0 +1,213 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	agentPkg "github.com/yusing/godoxy/agent/pkg/agent"
+	"github.com/yusing/godoxy/internal/agentpool"
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/systemd"
+	"github.com/yusing/godoxy/internal/watcher"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+)
+
+// unitManager manages systemd units, locally over D-Bus or through an agent.
+type unitManager interface {
+	StartUnit(ctx context.Context, unit string) error
+	StopUnit(ctx context.Context, unit string) error
+	KillUnit(ctx context.Context, unit string, signal int32) error
+	FreezeUnit(ctx context.Context, unit string) error
+	ThawUnit(ctx context.Context, unit string) error
+	UnitState(ctx context.Context, unit string) (systemd.UnitState, error)
+	Close()
+}
+
+type SystemdProvider struct {
+	units              unitManager
+	unit               string
+	stateCheckInterval time.Duration
+}
+
+const systemdStateCheckInterval = 1 * time.Second
+
+var signalNumbers = map[idlewatcher.ContainerSignal]int32{
+	"SIGHUP":  1,
+	"SIGINT":  2,
+	"SIGQUIT": 3,
+	"SIGKILL": 9,
+	"SIGTERM": 15,
+}
+
+func NewSystemdProvider(ctx context.Context, cfg *idlewatcher.SystemdConfig) (idlewatcher.Provider, error) {
+	if cfg.Unit == "" {
+		return nil, errors.New("unit is required")
+	}
+	if cfg.Agent == "" {
+		return &SystemdProvider{units: systemd.NewClient(cfg.BusAddress), unit: cfg.Unit}, nil
+	}
+
+	agent, err := agentFromCtx(ctx, cfg.Agent)
+	if err != nil {
+		return nil, err
+	}
+	return &SystemdProvider{units: &agentUnitManager{agent}, unit: cfg.Unit}, nil
+}
+
+// agentFromCtx returns the agent with the given name or address.
+func agentFromCtx(ctx context.Context, nameOrAddr string) (*agentpool.Agent, error) {
+	pool := agentpool.FromCtx(ctx)
+	if pool == nil {
+		return nil, errors.New("agent pool not initialized")
+	}
+	agent, ok := pool.GetAgent(nameOrAddr)
+	if !ok {
+		agent, ok = pool.Get(nameOrAddr)
+	}
+	if !ok {
+		return nil, fmt.Errorf("agent %q not found", nameOrAddr)
+	}
+	return agent, nil
+}
+
+func (p *SystemdProvider) ContainerPause(ctx context.Context) error {
+	return p.units.FreezeUnit(ctx, p.unit)
+}
+
+func (p *SystemdProvider) ContainerUnpause(ctx context.Context) error {
+	return p.units.ThawUnit(ctx, p.unit)
+}
+
+func (p *SystemdProvider) ContainerStart(ctx context.Context) error {
+	return p.units.StartUnit(ctx, p.unit)
+}
+
+// ContainerStop stops the unit, the stop signal and timeout are defined by
+// KillSignal= and TimeoutStopSec= of the unit.
+func (p *SystemdProvider) ContainerStop(ctx context.Context, _ idlewatcher.ContainerSignal, _ int) error {
+	return p.units.StopUnit(ctx, p.unit)
+}
+
+func (p *SystemdProvider) ContainerKill(ctx context.Context, signal idlewatcher.ContainerSignal) error {
+	return p.units.KillUnit(ctx, p.unit, signalNumber(signal))
+}
+
+func (p *SystemdProvider) ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error) {
+	state, err := p.units.UnitState(ctx, p.unit)
+	if err != nil {
+		return idlewatcher.ContainerStatusError, err
+	}
+	switch state.FreezerState {
+	case "frozen", "freezing":
+		return idlewatcher.ContainerStatusPaused, nil
+	}
+	switch state.ActiveState {
+	case "active", "activating", "reloading":
+		return idlewatcher.ContainerStatusRunning, nil
+	case "inactive", "failed", "deactivating":
+		return idlewatcher.ContainerStatusStopped, nil
+	}
+	return idlewatcher.ContainerStatusError, fmt.Errorf("%w: %s", idlewatcher.ErrUnexpectedContainerStatus, state.ActiveState)
+}
+
+func (p *SystemdProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan error) {
+	interval := p.stateCheckInterval
+	if interval == 0 {
+		interval = systemdStateCheckInterval
+	}
+	return watchStatus(ctx, interval, watcher.Event{
+		Type:      watcherEvents.EventTypeDocker,
+		ActorID:   p.unit,
+		ActorName: p.unit,
+	}, p.ContainerStatus)
+}
+
+func (p *SystemdProvider) Close() {
+	p.units.Close()
+}
+
+// signalNumber returns the signal number of a stop signal, SIGKILL if unset.
+func signalNumber(signal idlewatcher.ContainerSignal) int32 {
+	if signal == "" {
+		return signalNumbers["SIGKILL"]
+	}
+	if !strings.HasPrefix(string(signal), "SIG") {
+		signal = "SIG" + signal
+	}
+	if n, ok := signalNumbers[signal]; ok {
+		return n
+	}
+	return signalNumbers["SIGKILL"]
+}
+
+// agentUnitManager manages units on the agent host through its systemd endpoints.
+type agentUnitManager struct {
+	agent *agentpool.Agent
+}
+
+func (m *agentUnitManager) action(ctx context.Context, unit, action string, query url.Values) error {
+	endpoint := agentPkg.EndpointSystemd + "/" + url.PathEscape(unit) + "/" + action
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	resp, err := m.agent.Do(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return agentResponseError(resp)
+}
+
+func (m *agentUnitManager) StartUnit(ctx context.Context, unit string) error {
+	return m.action(ctx, unit, "start", nil)
+}
+
+func (m *agentUnitManager) StopUnit(ctx context.Context, unit string) error {
+	return m.action(ctx, unit, "stop", nil)
+}
+
+func (m *agentUnitManager) KillUnit(ctx context.Context, unit string, signal int32) error {
+	return m.action(ctx, unit, "kill", url.Values{"signal": {strconv.Itoa(int(signal))}})
+}
+
+func (m *agentUnitManager) FreezeUnit(ctx context.Context, unit string) error {
+	return m.action(ctx, unit, "freeze", nil)
+}
+
+func (m *agentUnitManager) ThawUnit(ctx context.Context, unit string) error {
+	return m.action(ctx, unit, "thaw", nil)
+}
+
+func (m *agentUnitManager) UnitState(ctx context.Context, unit string) (systemd.UnitState, error) {
+	var state systemd.UnitState
+	resp, err := m.agent.Do(ctx, http.MethodGet, agentPkg.EndpointSystemd+"/"+url.PathEscape(unit), nil)
+	if err != nil {
+		return state, err
+	}
+	defer resp.Body.Close()
+	if err := agentResponseError(resp); err != nil {
+		return state, err
+	}
+	err = json.NewDecoder(resp.Body).Decode(&state)
+	return state, err
+}
+
+func (m *agentUnitManager) Close() {
+	// noop
+}
+
+func agentResponseError(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("agent returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
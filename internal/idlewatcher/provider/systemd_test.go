@@ -0,0 +1,133 @@
+package provider
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/systemd"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+)
+
+type fakeUnitManager struct {
+	mu     sync.Mutex
+	state  systemd.UnitState
+	signal int32
+}
+
+func (m *fakeUnitManager) set(active, freezer string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.state = systemd.UnitState{ActiveState: active, FreezerState: freezer}
+}
+
+func (m *fakeUnitManager) StartUnit(context.Context, string) error {
+	m.set("active", "running")
+	return nil
+}
+
+func (m *fakeUnitManager) StopUnit(context.Context, string) error {
+	m.set("inactive", "running")
+	return nil
+}
+
+func (m *fakeUnitManager) KillUnit(_ context.Context, _ string, signal int32) error {
+	m.mu.Lock()
+	m.signal = signal
+	m.mu.Unlock()
+	m.set("failed", "running")
+	return nil
+}
+
+func (m *fakeUnitManager) FreezeUnit(context.Context, string) error {
+	m.set("active", "frozen")
+	return nil
+}
+
+func (m *fakeUnitManager) ThawUnit(context.Context, string) error {
+	m.set("active", "running")
+	return nil
+}
+
+func (m *fakeUnitManager) UnitState(context.Context, string) (systemd.UnitState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state, nil
+}
+
+func (m *fakeUnitManager) Close() {}
+
+func TestSystemdProviderStatus(t *testing.T) {
+	units := &fakeUnitManager{}
+	units.set("inactive", "running")
+	p := &SystemdProvider{units: units, unit: "game.service"}
+	ctx := t.Context()
+
+	steps := []struct {
+		do   func(context.Context) error
+		want idlewatcher.ContainerStatus
+	}{
+		{p.ContainerStart, idlewatcher.ContainerStatusRunning},
+		{p.ContainerPause, idlewatcher.ContainerStatusPaused},
+		{p.ContainerUnpause, idlewatcher.ContainerStatusRunning},
+		{func(ctx context.Context) error { return p.ContainerStop(ctx, "", 10) }, idlewatcher.ContainerStatusStopped},
+		{func(ctx context.Context) error { return p.ContainerKill(ctx, "TERM") }, idlewatcher.ContainerStatusStopped},
+	}
+	for _, step := range steps {
+		require.NoError(t, step.do(ctx))
+		status, err := p.ContainerStatus(ctx)
+		require.NoError(t, err)
+		require.Equal(t, step.want, status)
+	}
+	require.EqualValues(t, 15, units.signal)
+
+	units.set("maintenance", "")
+	_, err := p.ContainerStatus(ctx)
+	require.ErrorIs(t, err, idlewatcher.ErrUnexpectedContainerStatus)
+}
+
+func TestSystemdProviderWatch(t *testing.T) {
+	units := &fakeUnitManager{}
+	units.set("inactive", "running")
+	p := &SystemdProvider{units: units, unit: "game.service", stateCheckInterval: time.Millisecond}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	eventCh, errCh := p.Watch(ctx)
+
+	expectAction := func(action watcherEvents.Action) {
+		t.Helper()
+		select {
+		case event := <-eventCh:
+			require.Equal(t, action, event.Action)
+			require.Equal(t, "game.service", event.ActorName)
+		case err := <-errCh:
+			t.Fatalf("unexpected error: %v", err)
+		case <-time.After(time.Second):
+			t.Fatalf("no %s event", action)
+		}
+	}
+
+	// let the watcher observe the initial state first
+	time.Sleep(10 * time.Millisecond)
+	require.NoError(t, p.ContainerStart(ctx))
+	expectAction(watcherEvents.ActionContainerStart)
+	require.NoError(t, p.ContainerPause(ctx))
+	expectAction(watcherEvents.ActionContainerPause)
+	require.NoError(t, p.ContainerUnpause(ctx))
+	expectAction(watcherEvents.ActionContainerUnpause)
+	require.NoError(t, p.ContainerStop(ctx, "", 10))
+	expectAction(watcherEvents.ActionContainerStop)
+
+	cancel()
+	waitForWatchStreamsToClose(t, eventCh, errCh)
+}
+
+func TestSignalNumber(t *testing.T) {
+	require.EqualValues(t, 9, signalNumber(""))
+	require.EqualValues(t, 15, signalNumber("SIGTERM"))
+	require.EqualValues(t, 2, signalNumber("INT"))
+	require.EqualValues(t, 1, signalNumber("HUP"))
+}
@@ -0,0 +1,219 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/watcher"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+	"github.com/yusing/godoxy/internal/wol"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// WakeOnLANProvider wakes a physical machine with a magic packet
+// and considers it running while its probe address accepts connections.
+type WakeOnLANProvider struct {
+	mac       net.HardwareAddr
+	broadcast string
+	probe     string
+	// sleep puts the machine to sleep.
+	sleep func(ctx context.Context) error
+
+	stateCheckInterval time.Duration
+}
+
+const (
+	wolStateCheckInterval = 5 * time.Second
+	wolProbeTimeout       = 2 * time.Second
+	// magic packets are sent over UDP, send a few in case one is dropped.
+	wolPacketCount = 3
+
+	defaultSleepTarget  = "suspend.target"
+	defaultSleepCommand = "systemctl suspend"
+)
+
+func NewWakeOnLANProvider(ctx context.Context, cfg *idlewatcher.WakeOnLANConfig) (idlewatcher.Provider, error) {
+	mac, err := wol.ParseMAC(cfg.MAC)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Probe == "" {
+		return nil, errors.New("probe address is required")
+	}
+	p := &WakeOnLANProvider{
+		mac:       mac,
+		broadcast: cfg.Broadcast,
+		probe:     cfg.Probe,
+	}
+
+	switch sleep := cfg.Sleep; {
+	case sleep == nil:
+		// wake only, the machine sleeps on its own and the probe reports it stopped.
+		p.sleep = func(context.Context) error { return nil }
+	case sleep.Agent != "":
+		agent, err := agentFromCtx(ctx, sleep.Agent)
+		if err != nil {
+			return nil, err
+		}
+		target := sleep.Target
+		if target == "" {
+			target = defaultSleepTarget
+		}
+		units := &agentUnitManager{agent}
+		p.sleep = func(ctx context.Context) error {
+			return units.StartUnit(ctx, target)
+		}
+	case sleep.SSH != nil:
+		sshCfg := *sleep.SSH
+		if sshCfg.Host == "" {
+			host, _, err := net.SplitHostPort(cfg.Probe)
+			if err != nil {
+				return nil, err
+			}
+			sshCfg.Host = host
+		}
+		if _, _, err := net.SplitHostPort(sshCfg.Host); err != nil {
+			sshCfg.Host = net.JoinHostPort(sshCfg.Host, "22")
+		}
+		if sshCfg.Command == "" {
+			sshCfg.Command = defaultSleepCommand
+		}
+		p.sleep = func(ctx context.Context) error {
+			return runSSHCommand(ctx, &sshCfg)
+		}
+	default:
+		return nil, idlewatcher.ErrInvalidSleepConfig
+	}
+	return p, nil
+}
+
+func (p *WakeOnLANProvider) ContainerPause(ctx context.Context) error {
+	return p.sleep(ctx)
+}
+
+func (p *WakeOnLANProvider) ContainerUnpause(ctx context.Context) error {
+	return p.ContainerStart(ctx)
+}
+
+func (p *WakeOnLANProvider) ContainerStart(ctx context.Context) error {
+	for range wolPacketCount {
+		if err := wol.Send(ctx, p.mac, p.broadcast); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *WakeOnLANProvider) ContainerStop(ctx context.Context, _ idlewatcher.ContainerSignal, _ int) error {
+	return p.sleep(ctx)
+}
+
+func (p *WakeOnLANProvider) ContainerKill(ctx context.Context, _ idlewatcher.ContainerSignal) error {
+	return p.sleep(ctx)
+}
+
+// ContainerStatus reports running if the probe address accepts connections, stopped otherwise.
+func (p *WakeOnLANProvider) ContainerStatus(ctx context.Context) (idlewatcher.ContainerStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, wolProbeTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", p.probe)
+	if err != nil {
+		return idlewatcher.ContainerStatusStopped, nil //nolint:nilerr
+	}
+	conn.Close()
+	return idlewatcher.ContainerStatusRunning, nil
+}
+
+func (p *WakeOnLANProvider) Watch(ctx context.Context) (<-chan watcher.Event, <-chan error) {
+	interval := p.stateCheckInterval
+	if interval == 0 {
+		interval = wolStateCheckInterval
+	}
+	return watchStatus(ctx, interval, watcher.Event{
+		Type:      watcherEvents.EventTypeDocker,
+		ActorID:   p.mac.String(),
+		ActorName: p.probe,
+	}, p.ContainerStatus)
+}
+
+func (p *WakeOnLANProvider) Close() {
+	// noop
+}
+
+// runSSHCommand runs cfg.Command on cfg.Host.
+//
+// A connection closed before the exit status arrives is not an error,
+// since the machine may suspend before the command returns.
+func runSSHCommand(ctx context.Context, cfg *idlewatcher.SSHCommandConfig) error {
+	hostKeyCallback, err := knownhosts.New(cfg.KnownHosts)
+	if err != nil {
+		return fmt.Errorf("known_hosts: %w", err)
+	}
+	var auth []ssh.AuthMethod
+	if cfg.KeyFile != "" {
+		key, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return err
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return fmt.Errorf("key_file: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password.String()))
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", cfg.Host)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, cfg.Host, &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+	})
+	if err != nil {
+		conn.Close()
+		return contextCause(ctx, err)
+	}
+	client := ssh.NewClient(sshConn, chans, reqs)
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return contextCause(ctx, err)
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(cfg.Command)
+	var exitMissing *ssh.ExitMissingError
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err == nil, errors.As(err, &exitMissing):
+		return nil
+	default:
+		return fmt.Errorf("%w: %s", err, out)
+	}
+}
+
+func contextCause(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
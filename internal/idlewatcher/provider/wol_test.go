@@ -0,0 +1,207 @@
+package provider
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/wol"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestWakeOnLANProviderStartAndStatus(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { udp.Close() })
+
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	probeAddr := probe.Addr().String()
+	probe.Close()
+
+	p, err := NewWakeOnLANProvider(t.Context(), &idlewatcher.WakeOnLANConfig{
+		MAC:       "00:11:22:33:44:55",
+		Broadcast: udp.LocalAddr().String(),
+		Probe:     probeAddr,
+		Sleep: &idlewatcher.WakeOnLANSleepConfig{
+			SSH: &idlewatcher.SSHCommandConfig{User: "root", Password: "hunter2"},
+		},
+	})
+	require.NoError(t, err)
+
+	status, err := p.ContainerStatus(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, idlewatcher.ContainerStatusStopped, status)
+
+	require.NoError(t, p.ContainerStart(t.Context()))
+	buf := make([]byte, 256)
+	require.NoError(t, udp.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := udp.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, wol.MagicPacket(net.HardwareAddr{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}), buf[:n])
+
+	// machine is up
+	probe, err = net.Listen("tcp", probeAddr)
+	require.NoError(t, err)
+	t.Cleanup(func() { probe.Close() })
+	status, err = p.ContainerStatus(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, idlewatcher.ContainerStatusRunning, status)
+}
+
+func TestWakeOnLANProviderWakeOnly(t *testing.T) {
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { probe.Close() })
+
+	p, err := NewWakeOnLANProvider(t.Context(), &idlewatcher.WakeOnLANConfig{
+		MAC:   "00:11:22:33:44:55",
+		Probe: probe.Addr().String(),
+	})
+	require.NoError(t, err)
+
+	// idle stops are no-ops, the machine keeps being reported running
+	require.NoError(t, p.ContainerStop(t.Context(), "", 0))
+	require.NoError(t, p.ContainerPause(t.Context()))
+	status, err := p.ContainerStatus(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, idlewatcher.ContainerStatusRunning, status)
+
+	// until it sleeps on its own
+	probe.Close()
+	status, err = p.ContainerStatus(t.Context())
+	require.NoError(t, err)
+	require.Equal(t, idlewatcher.ContainerStatusStopped, status)
+}
+
+func TestWakeOnLANProviderSleepSSH(t *testing.T) {
+	addr, knownHostsFile, commands := newTestSSHServer(t, "root", "hunter2")
+
+	p, err := NewWakeOnLANProvider(t.Context(), &idlewatcher.WakeOnLANConfig{
+		MAC:   "00:11:22:33:44:55",
+		Probe: "127.0.0.1:1",
+		Sleep: &idlewatcher.WakeOnLANSleepConfig{
+			SSH: &idlewatcher.SSHCommandConfig{
+				Host:       addr,
+				User:       "root",
+				Password:   "hunter2",
+				KnownHosts: knownHostsFile,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, p.ContainerStop(t.Context(), "", 10))
+	select {
+	case cmd := <-commands:
+		require.Equal(t, defaultSleepCommand, cmd)
+	case <-time.After(time.Second):
+		t.Fatal("sleep command not run")
+	}
+}
+
+func TestWakeOnLANProviderSleepSSHUnknownHost(t *testing.T) {
+	addr, _, _ := newTestSSHServer(t, "root", "hunter2")
+
+	knownHostsFile := filepath.Join(t.TempDir(), "known_hosts")
+	require.NoError(t, os.WriteFile(knownHostsFile, nil, 0o600))
+
+	p, err := NewWakeOnLANProvider(t.Context(), &idlewatcher.WakeOnLANConfig{
+		MAC:   "00:11:22:33:44:55",
+		Probe: "127.0.0.1:1",
+		Sleep: &idlewatcher.WakeOnLANSleepConfig{
+			SSH: &idlewatcher.SSHCommandConfig{
+				Host:       addr,
+				User:       "root",
+				Password:   "hunter2",
+				KnownHosts: knownHostsFile,
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	var keyErr *knownhosts.KeyError
+	require.ErrorAs(t, p.ContainerStop(t.Context(), "", 10), &keyErr)
+}
+
+// newTestSSHServer starts an SSH server accepting password auth that
+// records exec commands and exits with status 0.
+func newTestSSHServer(t *testing.T, user, password string) (addr, knownHostsFile string, commands <-chan string) {
+	t.Helper()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(priv)
+	require.NoError(t, err)
+
+	cfg := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if conn.User() == user && string(pass) == password {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	cfg.AddHostKey(hostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	cmdCh := make(chan string, 1)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSH(conn, cfg, cmdCh)
+		}
+	}()
+
+	addr = l.Addr().String()
+	knownHostsFile = filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostKey.PublicKey())
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600))
+	return addr, knownHostsFile, cmdCh
+}
+
+func serveTestSSH(conn net.Conn, cfg *ssh.ServerConfig, commands chan<- string) {
+	defer conn.Close()
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			_ = newChan.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		ch, chReqs, err := newChan.Accept()
+		if err != nil {
+			return
+		}
+		for req := range chReqs {
+			if req.Type != "exec" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			var payload struct{ Command string }
+			_ = ssh.Unmarshal(req.Payload, &payload)
+			_ = req.Reply(true, nil)
+			commands <- payload.Command
+			_, _ = ch.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, 0))
+			ch.Close()
+			break
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package idlewatcher
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/godoxy/internal/route/rules"
+)
+
+// queueRetryAfter is the Retry-After hint sent when a held request is rejected.
+const queueRetryAfter = 10 * time.Second
+
+func (w *Watcher) queueConfig() idlewatcher.QueueConfig {
+	if q := w.cfg.Queue; q != nil {
+		return *q
+	}
+	return idlewatcher.QueueConfig{
+		Size:    idlewatcher.QueueSizeDefault,
+		Timeout: w.cfg.WakeTimeout,
+	}
+}
+
+func (w *Watcher) setQueueMatcher(q *idlewatcher.QueueConfig) error {
+	if q == nil || q.On == "" {
+		w.queueOn.Store(nil)
+		return nil
+	}
+	var on rules.RuleOn
+	if err := on.Parse(q.On); err != nil {
+		return err
+	}
+	w.queueOn.Store(&on)
+	return nil
+}
+
+// shouldQueue reports whether the request should be held until the container
+// is ready instead of receiving the loading page.
+func (w *Watcher) shouldQueue(rw http.ResponseWriter, r *http.Request, acceptHTML bool) bool {
+	if !acceptHTML || w.cfg.NoLoadingPage {
+		return true
+	}
+	on := w.queueOn.Load()
+	return on != nil && on.Check(rw, r)
+}
+
+// holdUntilReady wakes the container and holds the request until it becomes
+// ready, the queue timeout elapses, or the client goes away.
+func (w *Watcher) holdUntilReady(rw http.ResponseWriter, r *http.Request) (shouldNext bool) {
+	q := w.queueConfig()
+
+	queued := w.queued.Add(1)
+	defer w.queued.Add(-1)
+	if q.Size > 0 && queued > int64(q.Size) {
+		rejectQueued(rw, "Too many requests waiting for "+w.cfg.ContainerName()+" to wake")
+		return false
+	}
+
+	deadline := time.Now().Add(q.Timeout)
+
+	// request cancelling should not abort wake
+	// avoid partial wake state
+	wakeCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	err := w.Wake(wakeCtx)
+	if err != nil {
+		if wakeCtx.Err() != nil {
+			rejectQueued(rw, "Timeout waiting for "+w.cfg.ContainerName()+" to wake")
+			return false
+		}
+		log.Err(err).Msg("Failed to wake container")
+		http.Error(rw, "Failed to wake container", http.StatusInternalServerError)
+		return false
+	}
+
+	// send a continue response to prevent client wait-header timeout
+	rw.WriteHeader(http.StatusContinue)
+
+	ctx, cancelWait := context.WithDeadline(r.Context(), deadline)
+	defer cancelWait()
+	if w.waitForReady(ctx) {
+		return true
+	}
+	if r.Context().Err() != nil { // client is gone
+		return false
+	}
+	rejectQueued(rw, "Timeout waiting for "+w.cfg.ContainerName()+" to become ready")
+	return false
+}
+
+func rejectQueued(rw http.ResponseWriter, msg string) {
+	rw.Header().Set("Retry-After", strconv.Itoa(int(queueRetryAfter/time.Second)))
+	setNoStoreHeaders(rw.Header())
+	http.Error(rw, msg, http.StatusServiceUnavailable)
+}
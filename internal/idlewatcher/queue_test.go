@@ -0,0 +1,138 @@
+package idlewatcher
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	idlewatchertypes "github.com/yusing/godoxy/internal/idlewatcher/runtime"
+	"github.com/yusing/goutils/http/reverseproxy"
+)
+
+func TestServeHTTPQueueFullRejectsWithRetryAfter(t *testing.T) {
+	w, provider := newBlockingWakeWatcher(t)
+	close(provider.release)
+	w.cfg.Queue = &idlewatchertypes.QueueConfig{Size: 1, Timeout: time.Second}
+	w.queued.Store(1)
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "http://example.com/api", nil))
+
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+	require.Zero(t, provider.starts.Load())
+	require.EqualValues(t, 1, w.queued.Load())
+}
+
+func TestServeHTTPQueueWakeTimeoutRejectsWithRetryAfter(t *testing.T) {
+	w, provider := newBlockingWakeWatcher(t)
+	t.Cleanup(func() { close(provider.release) })
+	w.cfg.Queue = &idlewatchertypes.QueueConfig{Size: 1, Timeout: 50 * time.Millisecond}
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "http://example.com/api", nil))
+
+	require.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	require.NotEmpty(t, rec.Header().Get("Retry-After"))
+	require.Zero(t, w.queued.Load())
+}
+
+func TestServeHTTPQueueReadyTimeoutRejectsAfterContinue(t *testing.T) {
+	w, provider := newBlockingWakeWatcher(t)
+	close(provider.release)
+	w.cfg.Queue = &idlewatchertypes.QueueConfig{Size: 1, Timeout: 50 * time.Millisecond}
+
+	var continued atomic.Bool
+	req, err := http.NewRequest(http.MethodPost, "/api", nil)
+	require.NoError(t, err)
+	resp, body := serveQueued(t, w, req, func() { continued.Store(true) })
+
+	require.True(t, continued.Load(), "100 Continue should be sent while waiting")
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "10", resp.Header.Get("Retry-After"))
+	require.Contains(t, body, "Timeout waiting for")
+}
+
+func TestServeHTTPQueueOnHoldsMatchingNavigation(t *testing.T) {
+	w, provider := newBlockingWakeWatcher(t)
+	close(provider.release)
+	w.cfg.Queue = &idlewatchertypes.QueueConfig{On: "path /api", Size: 1, Timeout: time.Second}
+	require.NoError(t, w.setQueueMatcher(w.cfg.Queue))
+	go func() { // both requests wake the container
+		for {
+			select {
+			case <-provider.started:
+			case <-t.Context().Done():
+				return
+			}
+		}
+	}()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		_, _ = rw.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(upstream.Close)
+	targetURL, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+	w.rp = reverseproxy.NewReverseProxy("idlewatcher-queue-test", targetURL, upstream.Client().Transport)
+
+	// not matched, gets the loading page
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "http://example.com/app", nil)
+	req.Header.Set("Accept", "text/html")
+	w.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	// matched, held until ready and proxied
+	req, err = http.NewRequest(http.MethodGet, "/api", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "text/html")
+	resp, body := serveQueued(t, w, req, w.setReady)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Equal(t, `{"ok":true}`, body)
+}
+
+// serveQueued sends the request to the watcher through a real server and returns the final response,
+// onContinue is called when the client receives 100 Continue.
+func serveQueued(t *testing.T, w *Watcher, req *http.Request, onContinue func()) (*http.Response, string) {
+	t.Helper()
+	srv := httptest.NewServer(w)
+	t.Cleanup(srv.Close)
+
+	u, err := url.Parse(srv.URL + req.URL.Path)
+	require.NoError(t, err)
+	req.URL, req.Host = u, u.Host
+	req = req.WithContext(httptrace.WithClientTrace(t.Context(), &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+			if code == http.StatusContinue {
+				onContinue()
+			}
+			return nil
+		},
+	}))
+
+	resp, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return resp, string(body)
+}
+
+func TestSetQueueMatcherRejectsInvalidRule(t *testing.T) {
+	w := newTestWatcher(t)
+	require.Error(t, w.setQueueMatcher(&idlewatchertypes.QueueConfig{On: "unknown_matcher x"}))
+	require.Nil(t, w.queueOn.Load())
+}
@@ -2,19 +2,26 @@ package runtime
 
 import (
 	"errors"
+	"net"
 	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/yusing/godoxy/internal/types"
+	"github.com/yusing/godoxy/internal/wol"
 	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
 )
 
 type (
 	IdlewatcherProviderConfig struct {
 		Proxmox *ProxmoxConfig `json:"proxmox,omitempty"`
 		Docker  *DockerConfig  `json:"docker,omitempty"`
+		Libvirt *LibvirtConfig `json:"libvirt,omitempty" extensions:"x-nullable"`
+		Systemd *SystemdConfig `json:"systemd,omitempty" extensions:"x-nullable"`
+		// Physical machine woken with Wake-on-LAN.
+		WakeOnLAN *WakeOnLANConfig `json:"wake_on_lan,omitempty" extensions:"x-nullable"`
 	} // @name IdlewatcherProviderConfig
 	IdlewatcherConfigBase struct {
 		// 0: no idle watcher.
@@ -30,14 +37,20 @@ type (
 		IdlewatcherProviderConfig
 		IdlewatcherConfigBase
 
-		StartEndpoint string   `json:"start_endpoint,omitempty"` // Optional path that must be hit to start container
-		DependsOn     []string `json:"depends_on,omitempty"`
-		NoLoadingPage bool     `json:"no_loading_page,omitempty"`
+		StartEndpoint string                      `json:"start_endpoint,omitempty"` // Optional path that must be hit to start container
+		DependsOn     []string                    `json:"depends_on,omitempty"`
+		NoLoadingPage bool                        `json:"no_loading_page,omitempty"`
+		Schedule      *IdlewatcherSchedule        `json:"schedule,omitempty" extensions:"x-nullable"`
+		Keepalive     *IdlewatcherKeepaliveConfig `json:"keepalive,omitempty" extensions:"x-nullable"`
+		Queue         *IdlewatcherQueueConfig     `json:"queue,omitempty" extensions:"x-nullable"`
+		// Readiness probe for TCP/UDP routes, checked instead of a plain connect before held connections are forwarded.
+		StreamProbe StreamProbe `json:"stream_probe,omitempty"`
 
 		valErr error
 	} // @name IdlewatcherConfig
 	ContainerStopMethod string // @name ContainerStopMethod
 	ContainerSignal     string // @name ContainerSignal
+	StreamProbe         string // @name IdlewatcherStreamProbe
 
 	DockerConfig struct {
 		DockerCfg     types.DockerProviderConfig `json:"docker_cfg" validate:"required"`
@@ -48,41 +61,152 @@ type (
 		Node string `json:"node" validate:"required"`
 		VMID uint64 `json:"vmid" validate:"required"`
 	} // @name IdlewatcherProxmoxNodeConfig
+	LibvirtConfig struct {
+		// libvirtd socket path, unix:///path or tcp://host[:port]. Defaults to /var/run/libvirt/libvirt-sock.
+		Address string `json:"address,omitempty"`
+		// Hypervisor URI. Defaults to qemu:///system.
+		URI    string `json:"uri,omitempty"`
+		Domain string `json:"domain" validate:"required"`
+	} // @name IdlewatcherLibvirtConfig
+	SystemdConfig struct {
+		// Unit name, ".service" is appended if it has no suffix.
+		Unit string `json:"unit" validate:"required"`
+		// Agent name or address to manage the unit on. Empty means the GoDoxy host.
+		Agent string `json:"agent,omitempty"`
+		// D-Bus address of the local system bus. Defaults to $DBUS_SYSTEM_BUS_ADDRESS or /run/dbus/system_bus_socket.
+		BusAddress string `json:"bus_address,omitempty"`
+	} // @name IdlewatcherSystemdConfig
+	WakeOnLANConfig struct {
+		MAC string `json:"mac" validate:"required"`
+		// Broadcast address (host[:port]) the magic packet is sent to. Defaults to 255.255.255.255:9.
+		Broadcast string `json:"broadcast,omitempty"`
+		// Address (host:port) dialed to check whether the machine is awake. Defaults to the route target.
+		Probe string `json:"probe,omitempty"`
+		// How to put the machine to sleep when idle.
+		// Without it, the machine is only woken up and sleeps on its own, e.g. by its OS power settings.
+		Sleep *WakeOnLANSleepConfig `json:"sleep,omitempty" extensions:"x-nullable"`
+	} // @name IdlewatcherWakeOnLANConfig
+	WakeOnLANSleepConfig struct {
+		// Agent name or address on the machine, which starts Target through systemd.
+		Agent string `json:"agent,omitempty"`
+		// systemd target started through the agent. Defaults to suspend.target.
+		Target string `json:"target,omitempty"`
+		// Command run over SSH.
+		SSH *SSHCommandConfig `json:"ssh,omitempty" extensions:"x-nullable"`
+	} // @name IdlewatcherWakeOnLANSleepConfig
+	SSHCommandConfig struct {
+		// SSH server address (host[:port]). Defaults to the probe host on port 22.
+		Host     string            `json:"host,omitempty"`
+		User     string            `json:"user" validate:"required"`
+		Password strutils.Redacted `json:"password,omitempty"`
+		KeyFile  string            `json:"key_file,omitempty"`
+		// known_hosts file used to verify the host key.
+		KnownHosts string `json:"known_hosts" validate:"required"`
+		// Defaults to "systemctl suspend".
+		Command string `json:"command,omitempty"`
+	} // @name IdlewatcherSSHCommandConfig
+
+	// IdlewatcherKeepaliveConfig defines activity signals, other than HTTP requests,
+	// that postpone sleeping when the idle timeout expires.
+	IdlewatcherKeepaliveConfig struct {
+		// Keep awake while HTTP requests are in flight or stream sessions are open.
+		Sessions bool `json:"sessions,omitempty"`
+		// Path on the upstream (or absolute URL) that responds 2xx while busy.
+		BusyEndpoint string `json:"busy_endpoint,omitempty"`
+		// Keep awake while CPU usage (percent) is at or above this value. 0 disables it.
+		CPUThreshold float64 `json:"cpu_threshold,omitempty" validate:"gte=0"`
+	} // @name IdlewatcherKeepaliveConfig
+
+	// IdlewatcherQueueConfig controls how requests that do not get the loading page
+	// are held while the container wakes, and forwarded once it is ready.
+	IdlewatcherQueueConfig struct {
+		// Rule matcher (rules `on` syntax) for requests held instead of getting
+		// the loading page, e.g. `path glob(/api/*)`. Requests that do not accept HTML are always held.
+		On string `json:"on,omitempty"`
+		// Maximum number of held requests, more get 503. Defaults to 100.
+		Size int `json:"size,omitempty" validate:"gte=0"`
+		// Maximum time a request is held before getting 503. Defaults to wake_timeout.
+		Timeout time.Duration `json:"timeout,omitempty"`
+	} // @name IdlewatcherQueueConfig
 )
 
 type (
-	Config         = IdlewatcherConfig
-	ConfigBase     = IdlewatcherConfigBase
-	ProviderConfig = IdlewatcherProviderConfig
-	StopMethod     = ContainerStopMethod
-	Signal         = ContainerSignal
+	Config          = IdlewatcherConfig
+	ConfigBase      = IdlewatcherConfigBase
+	ProviderConfig  = IdlewatcherProviderConfig
+	Schedule        = IdlewatcherSchedule
+	KeepaliveConfig = IdlewatcherKeepaliveConfig
+	QueueConfig     = IdlewatcherQueueConfig
+	StopMethod      = ContainerStopMethod
+	Signal          = ContainerSignal
 )
 
 const (
 	ContainerWakeTimeoutDefault = 3 * time.Minute
 	ContainerStopTimeoutDefault = 1 * time.Minute
+	QueueSizeDefault            = 100
 
 	ContainerStopMethodPause ContainerStopMethod = "pause"
 	ContainerStopMethodStop  ContainerStopMethod = "stop"
 	ContainerStopMethodKill  ContainerStopMethod = "kill"
+
+	StreamProbeTCP       StreamProbe = "tcp"
+	StreamProbeSSH       StreamProbe = "ssh"
+	StreamProbeMinecraft StreamProbe = "minecraft"
+	StreamProbeDNS       StreamProbe = "dns"
 )
 
 var (
-	ErrMissingProviderConfig = errors.New("missing idlewatcher provider config")
-	ErrInvalidStopMethod     = errors.New("invalid stop method")
-	ErrInvalidStopSignal     = errors.New("invalid stop signal")
-	ErrEmptyStartEndpoint    = errors.New("start endpoint must not be empty if defined")
+	ErrMissingProviderConfig  = errors.New("missing idlewatcher provider config")
+	ErrMultipleProviderConfig = errors.New("only one idlewatcher provider can be configured")
+	ErrAgentWithBusAddress    = errors.New("agent and bus_address cannot both be set")
+	ErrInvalidSleepConfig     = errors.New("exactly one of agent or ssh must be set")
+	ErrMissingSSHAuth         = errors.New("password or key_file is required")
+	ErrInvalidStopMethod      = errors.New("invalid stop method")
+	ErrInvalidStopSignal      = errors.New("invalid stop signal")
+	ErrInvalidStreamProbe     = errors.New("invalid stream probe")
+	ErrEmptyStartEndpoint     = errors.New("start endpoint must not be empty if defined")
+	ErrInvalidBusyEndpoint    = errors.New("busy endpoint must be an absolute path or an http(s) URL")
 )
 
+func (c *IdlewatcherProviderConfig) HasProvider() bool {
+	return c.Docker != nil || c.Proxmox != nil || c.HasExplicitProvider()
+}
+
+// HasExplicitProvider reports whether a provider that cannot be inferred
+// from the route (libvirt, systemd or Wake-on-LAN) is configured.
+func (c *IdlewatcherProviderConfig) HasExplicitProvider() bool {
+	return c.Libvirt != nil || c.Systemd != nil || c.WakeOnLAN != nil
+}
+
 func (c *IdlewatcherConfig) Key() string {
-	if c.Docker != nil {
+	switch {
+	case c.Libvirt != nil:
+		return "libvirt:" + c.Libvirt.Address + "/" + c.Libvirt.Domain
+	case c.Systemd != nil:
+		return "systemd:" + c.Systemd.Agent + "/" + c.Systemd.Unit
+	case c.WakeOnLAN != nil:
+		return "wol:" + c.WakeOnLAN.MAC
+	case c.Docker != nil:
 		return c.Docker.ContainerID
 	}
 	return c.Proxmox.Node + ":" + strconv.FormatUint(c.Proxmox.VMID, 10)
 }
 
 func (c *IdlewatcherConfig) ContainerName() string {
-	if c.Docker != nil {
+	switch {
+	case c.Libvirt != nil:
+		return c.Libvirt.Domain
+	case c.Systemd != nil:
+		return c.Systemd.Unit
+	case c.WakeOnLAN != nil:
+		if c.WakeOnLAN.Probe != "" {
+			if host, _, err := net.SplitHostPort(c.WakeOnLAN.Probe); err == nil {
+				return host
+			}
+		}
+		return c.WakeOnLAN.MAC
+	case c.Docker != nil:
 		return c.Docker.ContainerName
 	}
 	return "lxc-" + strconv.FormatUint(c.Proxmox.VMID, 10)
@@ -93,7 +217,7 @@ func (c *IdlewatcherConfig) Validate() error {
 }
 
 // ValidateResolved validates the config after its route has resolved a
-// Docker or Proxmox provider.
+// Docker or Proxmox provider, or one is configured explicitly.
 func (c *IdlewatcherConfig) ValidateResolved() error {
 	return c.validate(true)
 }
@@ -112,7 +236,12 @@ func (c *IdlewatcherConfig) validate(requireProvider bool) error {
 		c.validateTimeouts(),
 		c.validateStopMethod(),
 		c.validateStopSignal(),
+		c.validateStreamProbe(),
 		c.validateStartEndpoint(),
+		c.validateSchedule(),
+		c.validateKeepalive(),
+		c.validateSystemd(),
+		c.validateWakeOnLAN(),
 	)
 	c.valErr = errs.Error()
 	return c.valErr
@@ -123,9 +252,34 @@ func (c *IdlewatcherConfig) ValErr() error {
 }
 
 func (c *IdlewatcherConfig) validateProvider() error {
-	if c.Docker == nil && c.Proxmox == nil {
+	if !c.HasProvider() {
 		return ErrMissingProviderConfig
 	}
+	// explicit providers take precedence over the docker or proxmox config
+	// inferred from the route, but only one of them can be set
+	n := 0
+	for _, set := range []bool{c.Libvirt != nil, c.Systemd != nil, c.WakeOnLAN != nil} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		return ErrMultipleProviderConfig
+	}
+	return nil
+}
+
+func (c *IdlewatcherConfig) validateSystemd() error {
+	if c.Systemd == nil {
+		return nil
+	}
+	if c.Systemd.Agent != "" && c.Systemd.BusAddress != "" {
+		return gperr.PrependSubject(ErrAgentWithBusAddress, "systemd")
+	}
+	// same as systemctl
+	if c.Systemd.Unit != "" && !strings.Contains(c.Systemd.Unit, ".") {
+		c.Systemd.Unit += ".service"
+	}
 	return nil
 }
 
@@ -136,6 +290,14 @@ func (c *IdlewatcherConfig) validateTimeouts() error { //nolint:unparam
 	if c.StopTimeout == 0 {
 		c.StopTimeout = ContainerStopTimeoutDefault
 	}
+	if c.Queue != nil {
+		if c.Queue.Size == 0 {
+			c.Queue.Size = QueueSizeDefault
+		}
+		if c.Queue.Timeout <= 0 {
+			c.Queue.Timeout = c.WakeTimeout
+		}
+	}
 	return nil
 }
 
@@ -160,6 +322,15 @@ func (c *IdlewatcherConfig) validateStopSignal() error {
 	}
 }
 
+func (c *IdlewatcherConfig) validateStreamProbe() error {
+	switch c.StreamProbe {
+	case "", StreamProbeTCP, StreamProbeSSH, StreamProbeMinecraft, StreamProbeDNS:
+		return nil
+	default:
+		return gperr.PrependSubject(ErrInvalidStreamProbe, string(c.StreamProbe))
+	}
+}
+
 func (c *IdlewatcherConfig) validateStartEndpoint() error {
 	if c.StartEndpoint == "" {
 		return nil
@@ -175,3 +346,58 @@ func (c *IdlewatcherConfig) validateStartEndpoint() error {
 	_, err := url.ParseRequestURI(c.StartEndpoint)
 	return err
 }
+
+func (c *IdlewatcherConfig) validateSchedule() error {
+	if c.Schedule == nil {
+		return nil
+	}
+	if err := c.Schedule.Validate(); err != nil {
+		return gperr.PrependSubject(err, "schedule")
+	}
+	return nil
+}
+
+func (c *IdlewatcherConfig) validateKeepalive() error {
+	if c.Keepalive == nil || c.Keepalive.BusyEndpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(c.Keepalive.BusyEndpoint)
+	if err != nil {
+		return gperr.PrependSubject(err, "keepalive.busy_endpoint")
+	}
+	switch {
+	case u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/"):
+		return nil
+	case (u.Scheme == "http" || u.Scheme == "https") && u.Host != "":
+		return nil
+	default:
+		return gperr.PrependSubject(ErrInvalidBusyEndpoint, c.Keepalive.BusyEndpoint)
+	}
+}
+
+func (c *IdlewatcherConfig) validateWakeOnLAN() error {
+	cfg := c.WakeOnLAN
+	if cfg == nil {
+		return nil
+	}
+	var errs gperr.Builder
+	mac, err := wol.ParseMAC(cfg.MAC)
+	if err != nil {
+		errs.Add(gperr.PrependSubject(err, "wake_on_lan.mac"))
+	} else {
+		cfg.MAC = mac.String() // normalize for Key()
+	}
+	if cfg.Probe != "" {
+		if _, _, err := net.SplitHostPort(cfg.Probe); err != nil {
+			errs.Add(gperr.PrependSubject(err, "wake_on_lan.probe"))
+		}
+	}
+	switch sleep := cfg.Sleep; {
+	case sleep == nil: // wake only
+	case (sleep.Agent == "") == (sleep.SSH == nil):
+		errs.Add(gperr.PrependSubject(ErrInvalidSleepConfig, "wake_on_lan.sleep"))
+	case sleep.SSH != nil && sleep.SSH.Password == "" && sleep.SSH.KeyFile == "":
+		errs.Add(gperr.PrependSubject(ErrMissingSSHAuth, "wake_on_lan.sleep.ssh"))
+	}
+	return errs.Error()
+}
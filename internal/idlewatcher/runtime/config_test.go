@@ -3,6 +3,7 @@ package runtime
 import (
 	"testing"
 
+	"github.com/yusing/godoxy/internal/wol"
 	expect "github.com/yusing/goutils/testing"
 )
 
@@ -47,3 +48,102 @@ func TestValidateStartEndpoint(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSystemd(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	cfg.Systemd = &SystemdConfig{Unit: "jupyter"}
+	expect.NoError(t, cfg.validateSystemd())
+	expect.Equal(t, cfg.Systemd.Unit, "jupyter.service")
+	expect.Equal(t, cfg.Key(), "systemd:/jupyter.service")
+	expect.Equal(t, cfg.ContainerName(), "jupyter.service")
+
+	cfg.Systemd = &SystemdConfig{Unit: "backup.timer", Agent: "nas"}
+	expect.NoError(t, cfg.validateSystemd())
+	expect.Equal(t, cfg.Systemd.Unit, "backup.timer")
+	expect.Equal(t, cfg.Key(), "systemd:nas/backup.timer")
+
+	cfg.Systemd.BusAddress = "unix:path=/run/dbus/system_bus_socket"
+	expect.ErrorIs(t, ErrAgentWithBusAddress, cfg.validateSystemd())
+}
+
+func TestValidateProviderPrecedence(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	expect.ErrorIs(t, ErrMissingProviderConfig, cfg.validateProvider())
+
+	// inferred docker config does not override an explicit libvirt config
+	cfg.Docker = &DockerConfig{ContainerID: "abc", ContainerName: "app"}
+	cfg.Libvirt = &LibvirtConfig{Domain: "win11"}
+	expect.NoError(t, cfg.validateProvider())
+	expect.Equal(t, cfg.Key(), "libvirt:/win11")
+	expect.Equal(t, cfg.ContainerName(), "win11")
+
+	cfg.Systemd = &SystemdConfig{Unit: "app.service"}
+	expect.ErrorIs(t, ErrMultipleProviderConfig, cfg.validateProvider())
+}
+
+func TestValidateWakeOnLAN(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     WakeOnLANConfig
+		wantErr error
+	}{
+		{
+			name: "agent sleep",
+			cfg:  WakeOnLANConfig{MAC: "00-11-22-AA-BB-CC", Sleep: &WakeOnLANSleepConfig{Agent: "nas"}},
+		},
+		{
+			name: "wake only",
+			cfg:  WakeOnLANConfig{MAC: "00:11:22:aa:bb:cc"},
+		},
+		{
+			name:    "invalid mac",
+			cfg:     WakeOnLANConfig{MAC: "00:11:22"},
+			wantErr: wol.ErrInvalidMAC,
+		},
+		{
+			name:    "agent and ssh",
+			cfg:     WakeOnLANConfig{MAC: "00:11:22:aa:bb:cc", Sleep: &WakeOnLANSleepConfig{Agent: "nas", SSH: &SSHCommandConfig{User: "root", KeyFile: "/key"}}},
+			wantErr: ErrInvalidSleepConfig,
+		},
+		{
+			name:    "no sleep action",
+			cfg:     WakeOnLANConfig{MAC: "00:11:22:aa:bb:cc", Sleep: &WakeOnLANSleepConfig{}},
+			wantErr: ErrInvalidSleepConfig,
+		},
+		{
+			name:    "ssh without auth",
+			cfg:     WakeOnLANConfig{MAC: "00:11:22:aa:bb:cc", Sleep: &WakeOnLANSleepConfig{SSH: &SSHCommandConfig{User: "root"}}},
+			wantErr: ErrMissingSSHAuth,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := new(IdlewatcherConfig)
+			cfg.WakeOnLAN = &tc.cfg
+			err := cfg.validateWakeOnLAN()
+			if tc.wantErr != nil {
+				expect.ErrorIs(t, tc.wantErr, err)
+				return
+			}
+			expect.NoError(t, err)
+			expect.Equal(t, cfg.Key(), "wol:00:11:22:aa:bb:cc")
+		})
+	}
+}
+
+func TestValidateQueueDefaults(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	cfg.Queue = &QueueConfig{On: "path /api"}
+	expect.NoError(t, cfg.validateTimeouts())
+	expect.Equal(t, cfg.Queue.Size, QueueSizeDefault)
+	expect.Equal(t, cfg.Queue.Timeout, ContainerWakeTimeoutDefault)
+}
+
+func TestValidateStreamProbe(t *testing.T) {
+	cfg := new(IdlewatcherConfig)
+	cfg.StreamProbe = StreamProbeMinecraft
+	expect.NoError(t, cfg.validateStreamProbe())
+
+	cfg.StreamProbe = "gopher"
+	expect.ErrorIs(t, ErrInvalidStreamProbe, cfg.validateStreamProbe())
+}
@@ -16,3 +16,10 @@ type Provider interface {
 	Watch(ctx context.Context) (eventCh <-chan watcherEvents.Event, errCh <-chan error)
 	Close()
 }
+
+// StatsProvider is implemented by providers that can report resource usage,
+// used by CPU-based keepalive.
+type StatsProvider interface {
+	// CPUUsage returns the current CPU usage in percent.
+	CPUUsage(ctx context.Context) (float64, error)
+}
@@ -0,0 +1,281 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yusing/godoxy/internal/timeofday"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	// IdlewatcherSchedule overrides idle-based sleep with fixed time windows.
+	//
+	// All times are evaluated in Timezone (local time if empty).
+	IdlewatcherSchedule struct {
+		Timezone string           `json:"timezone,omitempty"`
+		Awake    []ScheduleWindow `json:"awake,omitempty"`   // wake at window start and never idle-sleep inside
+		Sleep    []ScheduleWindow `json:"sleep,omitempty"`   // sleep at window start and refuse wake requests inside
+		Prewarm  []ScheduleTime   `json:"prewarm,omitempty"` // wake at these times, then idle as usual
+
+		loc *time.Location
+	} // @name IdlewatcherSchedule
+
+	// ScheduleWindow is a daily time range on selected weekdays,
+	// e.g. "mon-fri 08:00-18:00" or "22:00-06:00".
+	//
+	// A window that ends before it starts crosses midnight,
+	// and belongs to the weekday it starts on.
+	ScheduleWindow struct {
+		Days  Weekdays
+		Start int // minutes since midnight
+		End   int // minutes since midnight, exclusive; 1440 means end of day
+	} // @name IdlewatcherScheduleWindow
+
+	// ScheduleTime is a time of day on selected weekdays, e.g. "mon-fri 07:45".
+	ScheduleTime struct {
+		Days Weekdays
+		At   int // minutes since midnight
+	} // @name IdlewatcherScheduleTime
+
+	// Weekdays is a bit set of time.Weekday.
+	Weekdays uint8
+)
+
+const AllWeekdays = Weekdays(timeofday.AllWeekdays)
+
+var (
+	ErrInvalidScheduleWindow = errors.New("invalid schedule window, expect \"[days] HH:MM-HH:MM\"")
+	ErrInvalidScheduleTime   = errors.New("invalid schedule time, expect \"[days] HH:MM\"")
+)
+
+// Validate implements serialization.CustomValidator.
+func (s *IdlewatcherSchedule) Validate() error {
+	if s.Timezone == "" {
+		s.loc = time.Local
+		return nil
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return gperr.PrependSubject(err, "timezone")
+	}
+	s.loc = loc
+	return nil
+}
+
+// Location returns the timezone that windows are evaluated in.
+func (s *IdlewatcherSchedule) Location() *time.Location {
+	if s.loc == nil {
+		return time.Local
+	}
+	return s.loc
+}
+
+// InAwakeWindow reports whether t is inside any awake window.
+func (s *IdlewatcherSchedule) InAwakeWindow(t time.Time) bool {
+	t = t.In(s.Location())
+	for _, w := range s.Awake {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// SleepUntil reports whether t is inside a sleep window,
+// and if so, when the latest overlapping sleep window ends.
+func (s *IdlewatcherSchedule) SleepUntil(t time.Time) (until time.Time, ok bool) {
+	t = t.In(s.Location())
+	for _, w := range s.Sleep {
+		if !w.Contains(t) {
+			continue
+		}
+		if end := w.EndAfter(t); end.After(until) {
+			until = end
+		}
+		ok = true
+	}
+	return until, ok
+}
+
+// PrewarmBetween reports whether any prewarm time falls in (from, to].
+func (s *IdlewatcherSchedule) PrewarmBetween(from, to time.Time) bool {
+	if !to.After(from) {
+		return false
+	}
+	loc := s.Location()
+	from, to = from.In(loc), to.In(loc)
+	// only look back a day to avoid replaying stale prewarms after a long pause
+	if to.Sub(from) > 24*time.Hour {
+		from = to.Add(-24 * time.Hour)
+	}
+	for day := startOfDay(from); !day.After(to); day = day.AddDate(0, 0, 1) {
+		for _, p := range s.Prewarm {
+			if !p.Days.Has(day.Weekday()) {
+				continue
+			}
+			at := day.Add(time.Duration(p.At) * time.Minute)
+			if at.After(from) && !at.After(to) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Contains reports whether t (already in the schedule timezone) is inside the window.
+func (w ScheduleWindow) Contains(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.Start < w.End {
+		return w.Days.Has(day) && w.Start <= m && m < w.End
+	}
+	// crosses midnight
+	return (w.Days.Has(day) && m >= w.Start) || (w.Days.Has(prevWeekday(day)) && m < w.End)
+}
+
+// EndAfter returns the end of the window occurrence containing t.
+func (w ScheduleWindow) EndAfter(t time.Time) time.Time {
+	day := startOfDay(t)
+	m := t.Hour()*60 + t.Minute()
+	if w.Start >= w.End && m >= w.Start { // crosses midnight, ends tomorrow
+		day = day.AddDate(0, 0, 1)
+	}
+	return day.Add(time.Duration(w.End) * time.Minute)
+}
+
+// Parse implements strutils.Parser.
+func (w *ScheduleWindow) Parse(v string) error {
+	days, spec, err := splitDays(v)
+	if err != nil {
+		return err
+	}
+	startStr, endStr, ok := strings.Cut(spec, "-")
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidScheduleWindow, v)
+	}
+	start, err := timeofday.Parse(startStr, false)
+	if err != nil {
+		return err
+	}
+	end, err := timeofday.Parse(endStr, true)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("%w: %q is empty", ErrInvalidScheduleWindow, v)
+	}
+	w.Days = days
+	w.Start = start
+	w.End = end
+	return nil
+}
+
+func (w ScheduleWindow) String() string {
+	return w.Days.String() + " " + timeofday.Format(w.Start) + "-" + timeofday.Format(w.End)
+}
+
+func (w ScheduleWindow) MarshalText() ([]byte, error) {
+	return []byte(w.String()), nil
+}
+
+// Parse implements strutils.Parser.
+func (t *ScheduleTime) Parse(v string) error {
+	days, spec, err := splitDays(v)
+	if err != nil {
+		return err
+	}
+	if strings.Contains(spec, "-") {
+		return fmt.Errorf("%w: %q", ErrInvalidScheduleTime, v)
+	}
+	at, err := timeofday.Parse(spec, false)
+	if err != nil {
+		return err
+	}
+	t.Days = days
+	t.At = at
+	return nil
+}
+
+func (t ScheduleTime) String() string {
+	return t.Days.String() + " " + timeofday.Format(t.At)
+}
+
+func (t ScheduleTime) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// Has reports whether d is in the set.
+func (d Weekdays) Has(day time.Weekday) bool {
+	return timeofday.Weekdays(d).Has(day)
+}
+
+func (d Weekdays) String() string {
+	if d == AllWeekdays {
+		return "*"
+	}
+	names := make([]string, 0, 7)
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if d.Has(day) {
+			names = append(names, strings.ToLower(day.String()[:3]))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Parse implements strutils.Parser.
+//
+// Accepts "*", "daily", "weekdays", "weekends",
+// comma separated names and ranges, e.g. "mon-fri", "sat,sun", "fri-mon".
+func (d *Weekdays) Parse(v string) error {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch v {
+	case "", "*", "daily":
+		*d = AllWeekdays
+		return nil
+	case "weekdays":
+		*d = Weekdays(timeofday.WeekdayRange(time.Monday, time.Friday))
+		return nil
+	case "weekends":
+		*d = 1<<time.Saturday | 1<<time.Sunday
+		return nil
+	}
+	var days Weekdays
+	for part := range strings.SplitSeq(v, ",") {
+		partDays, err := timeofday.ParseWeekdays(strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		days |= Weekdays(partDays)
+	}
+	*d = days
+	return nil
+}
+
+func prevWeekday(day time.Weekday) time.Weekday {
+	return (day + 6) % 7
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// splitDays splits "[days] spec" into the weekday set and the remaining spec.
+func splitDays(v string) (Weekdays, string, error) {
+	fields := strings.Fields(v)
+	switch len(fields) {
+	case 1:
+		return AllWeekdays, fields[0], nil
+	case 2:
+		var days Weekdays
+		if err := days.Parse(fields[0]); err != nil {
+			return 0, "", err
+		}
+		return days, fields[1], nil
+	default:
+		return 0, "", fmt.Errorf("%w: %q", ErrInvalidScheduleWindow, v)
+	}
+}
@@ -0,0 +1,119 @@
+package runtime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseWindow(t *testing.T, v string) ScheduleWindow {
+	t.Helper()
+	var w ScheduleWindow
+	require.NoError(t, w.Parse(v))
+	return w
+}
+
+func TestScheduleWindowParse(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "08:00-18:00", want: "* 08:00-18:00"},
+		{input: "mon-fri 08:00-18:00", want: "mon,tue,wed,thu,fri 08:00-18:00"},
+		{input: "weekends 00:00-24:00", want: "sun,sat 00:00-24:00"},
+		{input: "fri-mon 22:00-06:00", want: "sun,mon,fri,sat 22:00-06:00"},
+		{input: "sat,sun 10:30-11:00", want: "sun,sat 10:30-11:00"},
+		{input: "08:00", wantErr: true},
+		{input: "08:00-08:00", wantErr: true},
+		{input: "24:00-08:00", wantErr: true},
+		{input: "08:60-09:00", wantErr: true},
+		{input: "funday 08:00-09:00", wantErr: true},
+		{input: "mon fri 08:00-09:00", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			var w ScheduleWindow
+			err := w.Parse(tc.input)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, w.String())
+		})
+	}
+}
+
+func TestScheduleWindowContains(t *testing.T) {
+	// 2026-10-16 is a Friday
+	at := func(day int, hhmm string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04", "2026-10-"+time.Date(2026, 10, day, 0, 0, 0, 0, time.UTC).Format("02")+" "+hhmm, time.UTC)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	business := mustParseWindow(t, "mon-fri 08:00-18:00")
+	require.True(t, business.Contains(at(16, "08:00")))
+	require.True(t, business.Contains(at(16, "17:59")))
+	require.False(t, business.Contains(at(16, "18:00")))
+	require.False(t, business.Contains(at(17, "12:00"))) // saturday
+
+	night := mustParseWindow(t, "fri 22:00-06:00")
+	require.True(t, night.Contains(at(16, "23:00")))
+	require.True(t, night.Contains(at(17, "05:59"))) // saturday morning belongs to friday night
+	require.False(t, night.Contains(at(17, "23:00")))
+	require.False(t, night.Contains(at(16, "05:00"))) // thursday night is not included
+	require.Equal(t, at(17, "06:00"), night.EndAfter(at(16, "23:00")))
+	require.Equal(t, at(17, "06:00"), night.EndAfter(at(17, "01:00")))
+}
+
+func TestSchedulePrewarmBetween(t *testing.T) {
+	var prewarm ScheduleTime
+	require.NoError(t, prewarm.Parse("mon-fri 07:45"))
+	sched := &IdlewatcherSchedule{Timezone: "UTC", Prewarm: []ScheduleTime{prewarm}}
+	require.NoError(t, sched.Validate())
+
+	friday := time.Date(2026, 10, 16, 7, 45, 0, 0, time.UTC)
+	require.True(t, sched.PrewarmBetween(friday.Add(-30*time.Second), friday))
+	require.False(t, sched.PrewarmBetween(friday, friday.Add(30*time.Second)))
+	saturday := friday.AddDate(0, 0, 1)
+	require.False(t, sched.PrewarmBetween(saturday.Add(-30*time.Second), saturday))
+}
+
+func TestScheduleSleepUntil(t *testing.T) {
+	sched := &IdlewatcherSchedule{
+		Timezone: "UTC",
+		Sleep:    []ScheduleWindow{mustParseWindow(t, "00:00-06:00"), mustParseWindow(t, "05:00-07:00")},
+	}
+	require.NoError(t, sched.Validate())
+
+	until, ok := sched.SleepUntil(time.Date(2026, 10, 16, 5, 30, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.Equal(t, time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC), until)
+
+	_, ok = sched.SleepUntil(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC))
+	require.False(t, ok)
+}
+
+func TestScheduleValidateTimezone(t *testing.T) {
+	require.Error(t, (&IdlewatcherSchedule{Timezone: "Nowhere/Invalid"}).Validate())
+	require.NoError(t, (&IdlewatcherSchedule{Timezone: "Europe/London"}).Validate())
+}
+
+func TestValidateKeepaliveBusyEndpoint(t *testing.T) {
+	for endpoint, wantErr := range map[string]bool{
+		"/api/busy":                 false,
+		"http://10.0.0.2:8080/busy": false,
+		"https://app.internal/busy": false,
+		"api/busy":                  true,
+		"ftp://example.com/busy":    true,
+	} {
+		cfg := &IdlewatcherConfig{Keepalive: &IdlewatcherKeepaliveConfig{BusyEndpoint: endpoint}}
+		err := cfg.validateKeepalive()
+		require.Equal(t, wantErr, err != nil, endpoint)
+	}
+}
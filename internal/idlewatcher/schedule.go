@@ -0,0 +1,102 @@
+package idlewatcher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const scheduleCheckInterval = 30 * time.Second
+
+var timeNow = time.Now
+
+var ErrScheduledSleep = errors.New("sleeping as scheduled")
+
+type scheduledSleepError struct {
+	until time.Time
+}
+
+func (e *scheduledSleepError) Error() string {
+	return fmt.Sprintf("%s until %s", ErrScheduledSleep, e.until.Format(time.DateTime))
+}
+
+func (e *scheduledSleepError) Unwrap() error {
+	return ErrScheduledSleep
+}
+
+// scheduleState remembers which windows were active on the previous check,
+// so actions only fire on window transitions.
+type scheduleState struct {
+	lastCheck time.Time
+	awake     bool
+	sleeping  bool
+}
+
+// scheduledSleepUntil reports whether wake requests must be refused now,
+// and when the sleep window ends.
+func (w *Watcher) scheduledSleepUntil() (time.Time, bool) {
+	sched := w.cfg.Schedule
+	if sched == nil {
+		return time.Time{}, false
+	}
+	return sched.SleepUntil(timeNow())
+}
+
+// startSchedule starts the schedule loop once per watcher if a schedule is configured.
+func (w *Watcher) startSchedule() {
+	if w.cfg.Schedule == nil || w.scheduleStarted.Swap(true) {
+		return
+	}
+	go w.runSchedule()
+}
+
+func (w *Watcher) runSchedule() {
+	ticker := time.NewTicker(scheduleCheckInterval)
+	defer ticker.Stop()
+
+	state := scheduleState{lastCheck: timeNow()}
+	w.checkSchedule(&state, state.lastCheck)
+	for {
+		select {
+		case <-w.task.Context().Done():
+			return
+		case <-ticker.C:
+			w.checkSchedule(&state, timeNow())
+		}
+	}
+}
+
+func (w *Watcher) checkSchedule(state *scheduleState, now time.Time) {
+	sched := w.cfg.Schedule
+	if sched == nil { // removed on reload
+		state.lastCheck = now
+		return
+	}
+
+	_, sleeping := sched.SleepUntil(now)
+	awake := sched.InAwakeWindow(now)
+	prewarm := sched.PrewarmBetween(state.lastCheck, now)
+
+	switch {
+	case sleeping:
+		if !state.sleeping && w.running() {
+			w.l.Info().Msg("entering scheduled sleep window")
+			w.sleep("scheduled sleep")
+		}
+	case awake && !state.awake:
+		w.l.Info().Msg("entering scheduled awake window")
+		w.startWake()
+	case prewarm:
+		w.l.Info().Msg("scheduled prewarm")
+		w.startWake()
+	}
+
+	state.sleeping = sleeping
+	state.awake = awake
+	state.lastCheck = now
+}
+
+// retryAfter returns the Retry-After value in seconds for a scheduled sleep ending at until.
+func retryAfter(until time.Time) int {
+	return max(int(until.Sub(timeNow()).Seconds()), 1)
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/yusing/godoxy/internal/idlewatcher/provider"
 	idlewatcher "github.com/yusing/godoxy/internal/idlewatcher/runtime"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
+	"github.com/yusing/godoxy/internal/route/rules"
 	"github.com/yusing/godoxy/internal/routing"
 	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
 	gperr "github.com/yusing/goutils/errs"
@@ -78,6 +79,11 @@ type (
 		dependenciesMu    sync.RWMutex
 		dependsOn         []*dependency
 		dependenciesCache synk.Value[*dependencyCache]
+
+		inflight        atomic.Int64 // in-flight HTTP requests, for session keepalive
+		queued          atomic.Int64 // requests held while waking
+		queueOn         atomic.Pointer[rules.RuleOn]
+		scheduleStarted atomic.Bool
 	}
 
 	dependency struct {
@@ -106,6 +112,9 @@ var (
 
 	newDockerProvider  = provider.NewDockerProvider
 	newProxmoxProvider = provider.NewProxmoxProvider
+	newLibvirtProvider = provider.NewLibvirtProvider
+	newSystemdProvider = provider.NewSystemdProvider
+	newWOLProvider     = provider.NewWakeOnLANProvider
 )
 
 const (
@@ -136,6 +145,9 @@ func NewWatcher(parent task.Parent, r routing.Route, cfg *Config) (*Watcher, err
 	if exists {
 		if cfg.IdleTimeout > 0 {
 			w.cfg.IdlewatcherConfigBase = cfg.IdlewatcherConfigBase
+			w.cfg.Schedule = cfg.Schedule
+			w.cfg.Keepalive = cfg.Keepalive
+			w.cfg.Queue = cfg.Queue
 		}
 		cfg = w.cfg
 		w.resetIdleTimer()
@@ -230,7 +242,7 @@ func NewWatcher(parent task.Parent, r routing.Route, cfg *Config) (*Watcher, err
 			continue
 		}
 
-		if depCfg.Docker == nil && depCfg.Proxmox == nil {
+		if !depCfg.HasProvider() {
 			depCont := depRoute.ContainerInfo()
 			if depCont != nil {
 				depCfg.Docker = &idlewatcher.DockerConfig{
@@ -251,6 +263,9 @@ func NewWatcher(parent task.Parent, r routing.Route, cfg *Config) (*Watcher, err
 		}
 
 		depCfg.IdleTimeout = neverTick // disable auto sleep for dependencies
+		// dependencies follow the lifecycle of their dependents
+		depCfg.Schedule = nil
+		depCfg.Keepalive = nil
 
 		depSpecs = append(depSpecs, dependencySpec{
 			route:       depRoute,
@@ -263,10 +278,28 @@ func NewWatcher(parent task.Parent, r routing.Route, cfg *Config) (*Watcher, err
 		return nil, depErrors.Error()
 	}
 
+	if err := w.setQueueMatcher(cfg.Queue); err != nil {
+		return nil, gperr.PrependSubject(err, "queue.on")
+	}
+
 	var p idlewatcher.Provider
 	var err error
 	var kind string
 	switch {
+	case cfg.Libvirt != nil:
+		p, err = newLibvirtProvider(parent.Context(), cfg.Libvirt)
+		kind = "libvirt"
+	case cfg.Systemd != nil:
+		p, err = newSystemdProvider(parent.Context(), cfg.Systemd)
+		kind = "systemd"
+	case cfg.WakeOnLAN != nil:
+		if cfg.WakeOnLAN.Probe == "" {
+			if targetURL := r.TargetURL(); targetURL != nil {
+				cfg.WakeOnLAN.Probe = targetURL.Host
+			}
+		}
+		p, err = newWOLProvider(parent.Context(), cfg.WakeOnLAN)
+		kind = "wol"
 	case cfg.Docker != nil:
 		p, err = newDockerProvider(parent.Context(), cfg.Docker.DockerCfg, cfg.Docker.ContainerID)
 		kind = "docker"
@@ -389,6 +422,7 @@ func NewWatcher(parent task.Parent, r routing.Route, cfg *Config) (*Watcher, err
 	}
 
 	r.SetHealthMonitor(w)
+	w.startSchedule()
 
 	w.l = w.l.With().Strs("deps", cfg.DependsOn).Logger()
 	if exists {
@@ -448,6 +482,10 @@ func (w *Watcher) wake(ctx context.Context) error {
 		return nil
 	}
 
+	if until, sleeping := w.scheduledSleepUntil(); sleeping {
+		return &scheduledSleepError{until: until}
+	}
+
 	// A completed attempt's events, including terminal errors, must not be
 	// replayed as the status of this new attempt.
 	w.clearEventHistory()
@@ -729,24 +767,33 @@ func (w *Watcher) watchUntilDestroy() (returnCause error) {
 		case <-w.idleTicker.C:
 			w.idleTicker.Stop()
 			if w.running() {
-				err := w.stopByMethod()
-				switch {
-				case errors.Is(err, context.Canceled):
+				if reason := w.keepAwakeReason(w.task.Context()); reason != "" {
+					w.l.Debug().Str("reason", reason).Msg("idle timeout postponed")
+					w.resetIdleTimer()
 					continue
-				case err != nil:
-					if errors.Is(err, context.DeadlineExceeded) {
-						err = errors.New("timeout waiting for container to stop, please set a higher value for `stop_timeout`")
-					}
-					w.l.Err(err).Msgf("container stop with method %q failed", w.cfg.StopMethod)
-					w.emitIdleActivity(gevents.LevelError, IdleEventActionError, w.cfg.ContainerName()+" failed to sleep", err)
-				default:
-					w.l.Info().Msg("idle timeout")
 				}
+				w.sleep("idle timeout")
 			}
 		}
 	}
 }
 
+// sleep stops the container according to the stop method and logs the result.
+func (w *Watcher) sleep(reason string) {
+	err := w.stopByMethod()
+	switch {
+	case errors.Is(err, context.Canceled):
+	case err != nil:
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = errors.New("timeout waiting for container to stop, please set a higher value for `stop_timeout`")
+		}
+		w.l.Err(err).Msgf("container stop with method %q failed", w.cfg.StopMethod)
+		w.emitIdleActivity(gevents.LevelError, IdleEventActionError, w.cfg.ContainerName()+" failed to sleep", err)
+	default:
+		w.l.Info().Msg(reason)
+	}
+}
+
 func (w *Watcher) dedupDependencies() {
 	// remove from dependencies if the dependency is also a dependency of another dependency, or have duplicates.
 	directDependencies := w.directDependencies()
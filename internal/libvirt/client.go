@@ -0,0 +1,412 @@
+package libvirt
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultSocket is the read-write socket of the system libvirtd.
+	DefaultSocket = "/var/run/libvirt/libvirt-sock"
+	// DefaultURI is the hypervisor URI passed on connect open.
+	DefaultURI = "qemu:///system"
+	// DefaultTCPPort is the port libvirtd listens on with listen_tcp enabled.
+	DefaultTCPPort = "16509"
+
+	program        = 0x20008086
+	programVersion = 1
+	headerSize     = 24
+	maxPacketSize  = 4 << 20
+	dialTimeout    = 3 * time.Second
+)
+
+// remote procedure numbers, from libvirt's remote_protocol.x
+const (
+	procConnectOpen        = 1
+	procConnectClose       = 2
+	procDomainCreate       = 9
+	procDomainDestroy      = 12
+	procDomainGetInfo      = 16
+	procDomainLookupByName = 23
+	procDomainResume       = 28
+	procDomainShutdown     = 33
+	procDomainSuspend      = 34
+)
+
+const (
+	messageCall  = 0
+	messageReply = 1
+
+	statusOK    = 0
+	statusError = 1
+)
+
+// DomainState is the state of a domain (virDomainState).
+type DomainState int32
+
+const (
+	DomainNoState DomainState = iota
+	DomainRunning
+	DomainBlocked
+	DomainPaused
+	DomainShutdown
+	DomainShutoff
+	DomainCrashed
+	DomainPMSuspended
+)
+
+var domainStateNames = [...]string{
+	DomainNoState:     "nostate",
+	DomainRunning:     "running",
+	DomainBlocked:     "blocked",
+	DomainPaused:      "paused",
+	DomainShutdown:    "shutdown",
+	DomainShutoff:     "shutoff",
+	DomainCrashed:     "crashed",
+	DomainPMSuspended: "pmsuspended",
+}
+
+func (s DomainState) String() string {
+	if s >= 0 && int(s) < len(domainStateNames) {
+		return domainStateNames[s]
+	}
+	return fmt.Sprintf("unknown(%d)", int32(s))
+}
+
+type (
+	// Domain identifies a domain (remote_nonnull_domain).
+	Domain struct {
+		Name string
+		UUID [16]byte
+		ID   int32 // -1 if the domain is not running
+	}
+
+	// DomainInfo is the reply of virDomainGetInfo.
+	DomainInfo struct {
+		State     DomainState
+		MaxMem    uint64 // KiB
+		Memory    uint64 // KiB
+		NrVirtCPU uint16
+		CPUTime   uint64 // nanoseconds
+	}
+
+	// Error is an error returned by libvirtd.
+	Error struct {
+		Code    int32
+		Domain  int32
+		Message string
+	}
+
+	// Client talks to libvirtd with the remote protocol.
+	//
+	// The connection is established lazily and re-established after I/O errors.
+	Client struct {
+		network, addr string
+		uri           string
+
+		mu     sync.Mutex
+		conn   net.Conn
+		serial uint32
+	}
+)
+
+var (
+	ErrUnsupportedAddress = errors.New("libvirt: unsupported address")
+	ErrUnexpectedReply    = errors.New("libvirt: unexpected reply")
+	ErrPacketTooLarge     = errors.New("libvirt: packet too large")
+)
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("libvirt error %d: %s", e.Code, e.Message)
+}
+
+// NewClient returns a client for the libvirtd at address, connecting to the hypervisor uri.
+//
+// The address is a socket path, unix:///path/to/sock or tcp://host[:port].
+// An empty address means DefaultSocket and an empty uri means DefaultURI.
+func NewClient(address, uri string) (*Client, error) {
+	network, addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	if uri == "" {
+		uri = DefaultURI
+	}
+	return &Client{network: network, addr: addr, uri: uri}, nil
+}
+
+func parseAddress(address string) (network, addr string, err error) {
+	if address == "" {
+		return "unix", DefaultSocket, nil
+	}
+	if strings.HasPrefix(address, "/") {
+		return "unix", address, nil
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %w", ErrUnsupportedAddress, err)
+	}
+	switch u.Scheme {
+	case "unix":
+		if u.Path == "" {
+			return "", "", fmt.Errorf("%w: %s", ErrUnsupportedAddress, address)
+		}
+		return "unix", u.Path, nil
+	case "tcp":
+		if u.Hostname() == "" {
+			return "", "", fmt.Errorf("%w: %s", ErrUnsupportedAddress, address)
+		}
+		port := u.Port()
+		if port == "" {
+			port = DefaultTCPPort
+		}
+		return "tcp", net.JoinHostPort(u.Hostname(), port), nil
+	}
+	return "", "", fmt.Errorf("%w: %s", ErrUnsupportedAddress, address)
+}
+
+// LookupDomain returns the domain with the given name.
+func (c *Client) LookupDomain(ctx context.Context, name string) (Domain, error) {
+	var args encoder
+	args.string(name)
+	reply, err := c.call(ctx, procDomainLookupByName, args.buf)
+	if err != nil {
+		return Domain{}, err
+	}
+	d := decoder{buf: reply}
+	dom := d.domain()
+	if d.err != nil {
+		return Domain{}, fmt.Errorf("%w: %w", ErrUnexpectedReply, d.err)
+	}
+	return dom, nil
+}
+
+// DomainCreate starts a defined domain like `virsh start`.
+func (c *Client) DomainCreate(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, procDomainCreate, dom)
+}
+
+// DomainShutdown requests a graceful (ACPI) shutdown like `virsh shutdown`.
+func (c *Client) DomainShutdown(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, procDomainShutdown, dom)
+}
+
+// DomainDestroy powers off a domain immediately like `virsh destroy`.
+func (c *Client) DomainDestroy(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, procDomainDestroy, dom)
+}
+
+// DomainSuspend pauses all vCPUs of a domain like `virsh suspend`.
+func (c *Client) DomainSuspend(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, procDomainSuspend, dom)
+}
+
+// DomainResume resumes a suspended domain like `virsh resume`.
+func (c *Client) DomainResume(ctx context.Context, dom Domain) error {
+	return c.domainCall(ctx, procDomainResume, dom)
+}
+
+// DomainInfo returns the state and resource usage of a domain.
+func (c *Client) DomainInfo(ctx context.Context, dom Domain) (DomainInfo, error) {
+	var args encoder
+	args.domain(dom)
+	reply, err := c.call(ctx, procDomainGetInfo, args.buf)
+	if err != nil {
+		return DomainInfo{}, err
+	}
+	d := decoder{buf: reply}
+	info := DomainInfo{
+		State:     DomainState(d.uint32()),
+		MaxMem:    d.uint64(),
+		Memory:    d.uint64(),
+		NrVirtCPU: uint16(d.uint32()),
+		CPUTime:   d.uint64(),
+	}
+	if d.err != nil {
+		return DomainInfo{}, fmt.Errorf("%w: %w", ErrUnexpectedReply, d.err)
+	}
+	return info, nil
+}
+
+func (c *Client) domainCall(ctx context.Context, proc uint32, dom Domain) error {
+	var args encoder
+	args.domain(dom)
+	_, err := c.call(ctx, proc, args.buf)
+	return err
+}
+
+func (c *Client) call(ctx context.Context, proc uint32, args []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(ctx, proc, args)
+	var libvirtErr *Error
+	if err != nil && !errors.As(err, &libvirtErr) {
+		// connection is in an unknown state, redial on next call
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, c.network, c.addr)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+
+	var args encoder
+	args.optString(c.uri)
+	args.uint32(0) // flags
+	if _, err := c.roundTrip(ctx, procConnectOpen, args.buf); err != nil {
+		conn.Close()
+		c.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (c *Client) roundTrip(ctx context.Context, proc uint32, args []byte) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+	} else {
+		_ = c.conn.SetDeadline(time.Time{})
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = c.conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	c.serial++
+	serial := c.serial
+	if err := WritePacket(c.conn, Header{Procedure: proc, Type: messageCall, Serial: serial}, args); err != nil {
+		return nil, contextErr(ctx, err)
+	}
+	for {
+		hdr, payload, err := ReadPacket(c.conn)
+		if err != nil {
+			return nil, contextErr(ctx, err)
+		}
+		// skip events and stale replies
+		if hdr.Type != messageReply || hdr.Serial != serial {
+			continue
+		}
+		if hdr.Procedure != proc {
+			return nil, fmt.Errorf("%w: procedure %d for call %d", ErrUnexpectedReply, hdr.Procedure, proc)
+		}
+		if hdr.Status == statusError {
+			return nil, decodeError(payload)
+		}
+		return payload, nil
+	}
+}
+
+func contextErr(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
+func decodeError(payload []byte) error {
+	d := decoder{buf: payload}
+	e := &Error{
+		Code:   d.int32(),
+		Domain: d.int32(),
+	}
+	e.Message = d.optString()
+	if d.err != nil {
+		return fmt.Errorf("%w: malformed error: %w", ErrUnexpectedReply, d.err)
+	}
+	return e
+}
+
+// Close closes the connection to libvirtd, if any.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	_, _ = c.roundTrip(ctx, procConnectClose, nil)
+	cancel()
+	c.conn.Close()
+	c.conn = nil
+}
+
+// Header is the header of a remote protocol packet.
+type Header struct {
+	Program   uint32
+	Version   uint32
+	Procedure uint32
+	Type      uint32
+	Serial    uint32
+	Status    uint32
+}
+
+// WritePacket writes a remote protocol packet.
+// Zero Program and Version are set to the remote program.
+func WritePacket(w io.Writer, hdr Header, payload []byte) error {
+	if hdr.Program == 0 {
+		hdr.Program = program
+		hdr.Version = programVersion
+	}
+	size := 4 + headerSize + len(payload)
+	if size > maxPacketSize {
+		return ErrPacketTooLarge
+	}
+	buf := make([]byte, 0, size)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(size))
+	for _, v := range [...]uint32{hdr.Program, hdr.Version, hdr.Procedure, hdr.Type, hdr.Serial, hdr.Status} {
+		buf = binary.BigEndian.AppendUint32(buf, v)
+	}
+	buf = append(buf, payload...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// ReadPacket reads a remote protocol packet.
+func ReadPacket(r io.Reader) (Header, []byte, error) {
+	var hdr Header
+	var lenBuf [4]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return hdr, nil, err
+	}
+	size := binary.BigEndian.Uint32(lenBuf[:])
+	if size > maxPacketSize {
+		return hdr, nil, ErrPacketTooLarge
+	}
+	if size < 4+headerSize {
+		return hdr, nil, fmt.Errorf("%w: packet of %d bytes", ErrUnexpectedReply, size)
+	}
+	buf := make([]byte, size-4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return hdr, nil, err
+	}
+	d := decoder{buf: buf}
+	hdr = Header{
+		Program:   d.uint32(),
+		Version:   d.uint32(),
+		Procedure: d.uint32(),
+		Type:      d.uint32(),
+		Serial:    d.uint32(),
+		Status:    d.uint32(),
+	}
+	return hdr, d.buf, nil
+}
@@ -0,0 +1,228 @@
+package libvirt
+
+import (
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLibvirtd is a minimal libvirtd that implements the procedures used by Client.
+type fakeLibvirtd struct {
+	mu      sync.Mutex
+	uri     string
+	domains map[string]*DomainInfo
+}
+
+func newFakeLibvirtd(t *testing.T, domains ...string) (*fakeLibvirtd, string) {
+	t.Helper()
+
+	fake := &fakeLibvirtd{domains: make(map[string]*DomainInfo)}
+	for _, name := range domains {
+		fake.domains[name] = &DomainInfo{State: DomainShutoff, NrVirtCPU: 2}
+	}
+
+	sock := filepath.Join(t.TempDir(), "libvirt-sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+	return fake, sock
+}
+
+func (f *fakeLibvirtd) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		hdr, payload, err := ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		reply, libvirtErr := f.handle(hdr.Procedure, payload)
+		hdr.Type = messageReply
+		if libvirtErr != nil {
+			hdr.Status = statusError
+			var e encoder
+			e.int32(libvirtErr.Code)
+			e.int32(libvirtErr.Domain)
+			e.optString(libvirtErr.Message)
+			reply = e.buf
+		}
+		if err := WritePacket(conn, hdr, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeLibvirtd) handle(proc uint32, payload []byte) ([]byte, *Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	d := decoder{buf: payload}
+	var reply encoder
+	switch proc {
+	case procConnectOpen:
+		f.uri = d.optString()
+		return nil, nil
+	case procConnectClose:
+		return nil, nil
+	case procDomainLookupByName:
+		name := d.string()
+		if _, ok := f.domains[name]; !ok {
+			return nil, &Error{Code: 42, Domain: 10, Message: "Domain not found: " + name}
+		}
+		reply.domain(Domain{Name: name, UUID: [16]byte{1, 2, 3}, ID: -1})
+		return reply.buf, nil
+	}
+
+	dom := d.domain()
+	info, ok := f.domains[dom.Name]
+	if !ok || dom.UUID != [16]byte{1, 2, 3} {
+		return nil, &Error{Code: 42, Domain: 10, Message: "Domain not found"}
+	}
+	switch proc {
+	case procDomainCreate:
+		info.State = DomainRunning
+	case procDomainShutdown, procDomainDestroy:
+		info.State = DomainShutoff
+	case procDomainSuspend:
+		info.State = DomainPaused
+	case procDomainResume:
+		info.State = DomainRunning
+	case procDomainGetInfo:
+		info.CPUTime += 1e9
+		reply.uint32(uint32(info.State))
+		reply.uint64(info.MaxMem)
+		reply.uint64(info.Memory)
+		reply.uint32(uint32(info.NrVirtCPU))
+		reply.uint64(info.CPUTime)
+		return reply.buf, nil
+	default:
+		return nil, &Error{Code: 1, Message: "unsupported procedure"}
+	}
+	return nil, nil
+}
+
+func TestClientDomainLifecycle(t *testing.T) {
+	fake, sock := newFakeLibvirtd(t, "gpu-vm")
+	c, err := NewClient("unix://"+sock, "")
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	ctx := t.Context()
+
+	dom, err := c.LookupDomain(ctx, "gpu-vm")
+	require.NoError(t, err)
+	require.Equal(t, "gpu-vm", dom.Name)
+	require.Equal(t, DefaultURI, fake.uri)
+
+	steps := []struct {
+		do   func() error
+		want DomainState
+	}{
+		{func() error { return c.DomainCreate(ctx, dom) }, DomainRunning},
+		{func() error { return c.DomainSuspend(ctx, dom) }, DomainPaused},
+		{func() error { return c.DomainResume(ctx, dom) }, DomainRunning},
+		{func() error { return c.DomainShutdown(ctx, dom) }, DomainShutoff},
+		{func() error { return c.DomainCreate(ctx, dom) }, DomainRunning},
+		{func() error { return c.DomainDestroy(ctx, dom) }, DomainShutoff},
+	}
+	for _, step := range steps {
+		require.NoError(t, step.do())
+		info, err := c.DomainInfo(ctx, dom)
+		require.NoError(t, err)
+		require.Equal(t, step.want, info.State)
+		require.EqualValues(t, 2, info.NrVirtCPU)
+	}
+}
+
+func TestClientErrorReply(t *testing.T) {
+	_, sock := newFakeLibvirtd(t)
+	c, err := NewClient(sock, "qemu:///session")
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+
+	_, err = c.LookupDomain(t.Context(), "missing")
+	var libvirtErr *Error
+	require.ErrorAs(t, err, &libvirtErr)
+	require.EqualValues(t, 42, libvirtErr.Code)
+	require.Equal(t, "Domain not found: missing", libvirtErr.Message)
+
+	// error replies keep the connection usable
+	require.NotNil(t, c.conn)
+}
+
+func TestClientReconnect(t *testing.T) {
+	_, sock := newFakeLibvirtd(t, "vm")
+	c, err := NewClient(sock, "")
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+
+	dom, err := c.LookupDomain(t.Context(), "vm")
+	require.NoError(t, err)
+
+	c.conn.Close()
+	_, err = c.DomainInfo(t.Context(), dom)
+	require.Error(t, err)
+	require.Nil(t, c.conn)
+
+	_, err = c.DomainInfo(t.Context(), dom)
+	require.NoError(t, err)
+}
+
+func TestXDRString(t *testing.T) {
+	var e encoder
+	e.string("abcde")
+	e.optString("")
+	e.optString("x")
+	require.Len(t, e.buf, 4+8+4+4+4+4)
+
+	d := decoder{buf: e.buf}
+	require.Equal(t, "abcde", d.string())
+	require.Empty(t, d.optString())
+	require.Equal(t, "x", d.optString())
+	require.NoError(t, d.err)
+	require.Empty(t, d.buf)
+
+	d = decoder{buf: []byte{0, 0, 0, 9, 'a'}}
+	d.string()
+	require.ErrorIs(t, d.err, errShortBuffer)
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		addr    string
+		wantErr bool
+	}{
+		{address: "", network: "unix", addr: DefaultSocket},
+		{address: "/run/libvirt/libvirt-sock", network: "unix", addr: "/run/libvirt/libvirt-sock"},
+		{address: "unix:///run/libvirt/libvirt-sock", network: "unix", addr: "/run/libvirt/libvirt-sock"},
+		{address: "tcp://10.0.0.5", network: "tcp", addr: "10.0.0.5:16509"},
+		{address: "tcp://kvm.lan:1234", network: "tcp", addr: "kvm.lan:1234"},
+		{address: "tls://kvm.lan", wantErr: true},
+		{address: "tcp://", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.address, func(t *testing.T) {
+			network, addr, err := parseAddress(tc.address)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrUnsupportedAddress)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.network, network)
+			require.Equal(t, tc.addr, addr)
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package libvirt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var errShortBuffer = errors.New("libvirt: short buffer")
+
+// encoder writes XDR (RFC 4506) values.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.buf = binary.BigEndian.AppendUint32(e.buf, v)
+}
+
+func (e *encoder) int32(v int32) {
+	e.uint32(uint32(v))
+}
+
+func (e *encoder) uint64(v uint64) {
+	e.buf = binary.BigEndian.AppendUint64(e.buf, v)
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.uint32(1)
+	} else {
+		e.uint32(0)
+	}
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf = append(e.buf, s...)
+	e.pad(len(s))
+}
+
+// optString writes an optional string (remote_string), empty means absent.
+func (e *encoder) optString(s string) {
+	e.bool(s != "")
+	if s != "" {
+		e.string(s)
+	}
+}
+
+func (e *encoder) fixed(b []byte) {
+	e.buf = append(e.buf, b...)
+	e.pad(len(b))
+}
+
+func (e *encoder) pad(n int) {
+	for n%4 != 0 {
+		e.buf = append(e.buf, 0)
+		n++
+	}
+}
+
+func (e *encoder) domain(d Domain) {
+	e.string(d.Name)
+	e.fixed(d.UUID[:])
+	e.int32(d.ID)
+}
+
+// decoder reads XDR values, the first error sticks.
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = errShortBuffer
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) uint32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (d *decoder) int32() int32 {
+	return int32(d.uint32())
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) bool() bool {
+	return d.uint32() != 0
+}
+
+func (d *decoder) string() string {
+	n := int(d.uint32())
+	if d.err == nil && n > len(d.buf) {
+		d.err = fmt.Errorf("%w: string of length %d", errShortBuffer, n)
+		return ""
+	}
+	b := d.next(n)
+	d.next(padLen(n))
+	return string(b)
+}
+
+func (d *decoder) optString() string {
+	if !d.bool() {
+		return ""
+	}
+	return d.string()
+}
+
+func (d *decoder) fixed(dst []byte) {
+	copy(dst, d.next(len(dst)))
+	d.next(padLen(len(dst)))
+}
+
+func (d *decoder) domain() Domain {
+	var dom Domain
+	dom.Name = d.string()
+	d.fixed(dom.UUID[:])
+	dom.ID = d.int32()
+	return dom
+}
+
+func padLen(n int) int {
+	return (4 - n%4) % 4
+}
@@ -50,6 +50,10 @@ type (
 		Headers FieldConfig `json:"headers,omitzero" aliases:"header"`
 		Query   FieldConfig `json:"query,omitzero" aliases:"queries"`
 		Cookies FieldConfig `json:"cookies,omitzero" aliases:"cookie"`
+		// Geo adds the client country, continent, city, ASN and time zone from MaxMind to JSON and console logs.
+		Geo bool `json:"geo,omitempty"`
+		// Vars adds the request variables set by the rules setvar command to JSON and console logs.
+		Vars bool `json:"vars,omitempty"`
 	}
 )
 
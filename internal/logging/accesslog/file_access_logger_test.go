@@ -6,10 +6,12 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/yusing/godoxy/internal/logging/accesslog"
+	"github.com/yusing/godoxy/internal/route/routes"
 	"github.com/yusing/goutils/mockable"
 	"github.com/yusing/goutils/task"
 	expect "github.com/yusing/goutils/testing"
@@ -155,6 +157,29 @@ func TestAccessLoggerJSON(t *testing.T) {
 	expect.Equal(t, len(entry.Cookies), 0)
 }
 
+func TestAccessLoggerJSONVars(t *testing.T) {
+	config := DefaultRequestLoggerConfig()
+	config.Format = FormatJSON
+	config.Fields.Vars = true
+
+	r := routes.WithRouteContext(req.Clone(t.Context()), nil)
+	routes.SetRequestVar(r, "tenant", "acme")
+	routes.SetRequestVar(r, "plan", "pro")
+
+	var buf bytes.Buffer
+	newMockAccessLogger(testTask, config).(RequestFormatter).AppendRequestLog(&buf, r, resp)
+	var entry struct {
+		Vars map[string]string `json:"vars"`
+	}
+	expect.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	expect.Equal(t, entry.Vars, map[string]string{"tenant": "acme", "plan": "pro"})
+
+	// no vars object without variables
+	buf.Reset()
+	newMockAccessLogger(testTask, config).(RequestFormatter).AppendRequestLog(&buf, req, resp)
+	expect.False(t, strings.Contains(buf.String(), `"vars"`))
+}
+
 func BenchmarkAccessLoggerJSON(b *testing.B) {
 	config := DefaultRequestLoggerConfig()
 	config.Format = FormatJSON
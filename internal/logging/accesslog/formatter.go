@@ -3,12 +3,16 @@ package accesslog
 import (
 	"bytes"
 	"iter"
+	"maps"
 	"net"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/rs/zerolog"
+	geoip "github.com/yusing/godoxy/internal/maxmind"
 	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
+	"github.com/yusing/godoxy/internal/route/routes"
 	"github.com/yusing/goutils/mockable"
 )
 
@@ -123,6 +127,12 @@ func (f JSONFormatter) LogRequestZeroLog(logger *zerolog.Logger, req *http.Reque
 		Object("query", query).
 		Object("headers", headers).
 		Object("cookies", cookies)
+	if f.cfg.Geo {
+		appendGeoFields(event, req)
+	}
+	if f.cfg.Vars {
+		appendRequestVars(event, req)
+	}
 
 	// NOTE: zerolog will append a newline to the buffer
 	event.Send()
@@ -140,11 +150,48 @@ func (f ConsoleFormatter) LogRequestZeroLog(logger *zerolog.Logger, req *http.Re
 		Str("type", contentType).
 		Int64("size", res.ContentLength).
 		Str("useragent", req.UserAgent())
+	if f.cfg.Geo {
+		appendGeoFields(event, req)
+	}
+	if f.cfg.Vars {
+		appendRequestVars(event, req)
+	}
 
 	// NOTE: zerolog will append a newline to the buffer
 	event.Msgf("[%d] %s %s://%s from %s", res.StatusCode, req.Method, scheme(req), req.Host, clientIP(req))
 }
 
+// appendGeoFields adds the non-empty geo fields of the request client, looked up once per request.
+func appendGeoFields(event *zerolog.Event, req *http.Request) {
+	for _, field := range [...]struct {
+		key string
+		get func(*http.Request) string
+	}{
+		{"geo_country", geoip.RequestCountry},
+		{"geo_continent", geoip.RequestContinent},
+		{"geo_city", geoip.RequestCityName},
+		{"geo_asn", geoip.RequestASNumber},
+		{"geo_tz", geoip.RequestTimeZone},
+	} {
+		if v := field.get(req); v != "" {
+			event.Str(field.key, v)
+		}
+	}
+}
+
+// appendRequestVars adds the request variables as a "vars" object, sorted by name.
+func appendRequestVars(event *zerolog.Event, req *http.Request) {
+	vars := routes.RequestVars(req)
+	if len(vars) == 0 {
+		return
+	}
+	dict := zerolog.Dict()
+	for _, name := range slices.Sorted(maps.Keys(vars)) {
+		dict.Str(name, vars[name])
+	}
+	event.Dict("vars", dict)
+}
+
 func (f ACLLogFormatter) AppendACLLog(line *bytes.Buffer, info *maxmind.IPInfo, blocked bool) {
 	logger := zerolog.New(line)
 	f.LogACLZeroLog(&logger, info, blocked)
@@ -9,6 +9,7 @@ import (
 	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	"github.com/yusing/godoxy/internal/notif"
 	"github.com/yusing/goutils/cache"
 	"github.com/yusing/goutils/task"
@@ -17,6 +18,7 @@ import (
 
 var (
 	warnOnce               sync.Once
+	asnWarnOnce            sync.Once
 	errLogRateLimiter      = rate.NewLimiter(rate.Every(3*time.Second), 1)
 	errLogSuppressedCounts = xsync.NewMap[string, *atomic.Int64](xsync.WithPresize(32))
 )
@@ -24,10 +26,11 @@ var (
 func warnNotConfigured(ctx context.Context) {
 	log.Warn().Msg("MaxMind not configured, geo lookup will fail")
 	notif.FromCtx(ctx).Notify(&notif.LogMessage{
-		Level: zerolog.WarnLevel,
-		Title: "MaxMind not configured",
-		Body:  notif.MessageBody("MaxMind is not configured, geo lookup will fail"),
-		Color: notif.ColorError,
+		Level:  zerolog.WarnLevel,
+		Title:  "MaxMind not configured",
+		Body:   notif.MessageBody("MaxMind is not configured, geo lookup will fail"),
+		Color:  notif.ColorError,
+		Source: notif.SourceMaxMind,
 	})
 }
 
@@ -39,6 +42,16 @@ func New(parent task.Parent, cfg *Config) (*MaxMind, error) {
 	if err := instance.LoadMaxMindDB(parent); err != nil {
 		return nil, err
 	}
+	if cfg.ASN {
+		asn := &MaxMind{Config: cfg, edition: maxmind.EditionASN}
+		instance.lookupASN = cache.NewKeyFunc(func(_ context.Context, ip string) (*ASN, error) {
+			return asn.lookupASNReal(ip)
+		}).WithMaxEntries(1000).Build()
+		if err := asn.LoadMaxMindDB(parent); err != nil {
+			return nil, err
+		}
+		instance.asn = asn
+	}
 	return instance, nil
 }
 
@@ -62,6 +75,31 @@ func LookupCity(ctx context.Context, ip *IPInfo) (*City, bool) {
 	return city, true
 }
 
+// LookupASN looks up the autonomous system of an IP, it fails unless the ASN database is enabled.
+func LookupASN(ctx context.Context, ip *IPInfo) (*ASN, bool) {
+	if ip.ASN != nil {
+		return ip.ASN, false
+	}
+
+	instance := FromCtx(ctx)
+	if instance == nil {
+		warnOnce.Do(func() { warnNotConfigured(ctx) })
+		return nil, false
+	}
+	if instance.asn == nil {
+		asnWarnOnce.Do(func() { log.Warn().Msg("MaxMind ASN database not enabled, ASN lookup will fail") })
+		return nil, false
+	}
+
+	asn, err := instance.lookupASN(ctx, ip.Str)
+	if err != nil {
+		logLookupError("failed to lookup ASN", ip.Str, err)
+		return nil, false
+	}
+	ip.ASN = asn
+	return asn, true
+}
+
 func lookupCityErrorKey(err error) string {
 	return err.Error()
 }
@@ -83,6 +121,10 @@ func flushSuppressedLookupCityError(err error) int64 {
 }
 
 func logLookupCityError(ipStr string, err error) {
+	logLookupError("failed to lookup city", ipStr, err)
+}
+
+func logLookupError(msg, ipStr string, err error) {
 	if !errLogRateLimiter.Allow() {
 		incrementSuppressedLookupCityError(err)
 		return
@@ -92,5 +134,5 @@ func logLookupCityError(ipStr string, err error) {
 	if suppressedCount := flushSuppressedLookupCityError(err); suppressedCount > 0 {
 		event = event.Int64("suppressed_count", suppressedCount)
 	}
-	event.Msg("failed to lookup city")
+	event.Msg(msg)
 }
@@ -9,6 +9,14 @@ var ErrInvalidIP = errors.New("invalid IP address")
 var ErrDBNotLoaded = errors.New("maxmind database not loaded")
 
 func (cfg *MaxMind) lookupCityReal(ipStr string) (*City, error) {
+	return lookupReal[City](cfg, ipStr)
+}
+
+func (cfg *MaxMind) lookupASNReal(ipStr string) (*ASN, error) {
+	return lookupReal[ASN](cfg, ipStr)
+}
+
+func lookupReal[T any](cfg *MaxMind, ipStr string) (*T, error) {
 	cfg.db.RLock()
 	defer cfg.db.RUnlock()
 
@@ -16,14 +24,14 @@ func (cfg *MaxMind) lookupCityReal(ipStr string) (*City, error) {
 		return nil, ErrDBNotLoaded
 	}
 
-	city := new(City)
+	result := new(T)
 	ip := net.ParseIP(ipStr)
 	if ip == nil {
 		return nil, ErrInvalidIP
 	}
-	err := cfg.db.Lookup(ip, city)
+	err := cfg.db.Lookup(ip, result)
 	if err != nil {
 		return nil, err
 	}
-	return city, nil
+	return result, nil
 }
@@ -5,6 +5,8 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -14,6 +16,7 @@ import (
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/route/routes"
 	"github.com/yusing/goutils/cache"
 	"github.com/yusing/goutils/task"
 	"golang.org/x/time/rate"
@@ -85,3 +88,53 @@ func TestLogLookupCityErrorIncludesSuppressedCount(t *testing.T) {
 	_, hasSuppressedCount := entry["suppressed_count"]
 	assert.False(t, hasSuppressedCount)
 }
+
+func TestLookupASN(t *testing.T) {
+	parent := task.GetTestTask(t)
+
+	SetCtx(parent, &MaxMind{})
+	asn, loaded := LookupASN(parent.Context(), &IPInfo{Str: "1.1.1.1"})
+	require.False(t, loaded, "ASN database not enabled")
+	require.Nil(t, asn)
+
+	instance := &MaxMind{asn: &MaxMind{}}
+	instance.lookupASN = cache.NewKeyFunc(func(_ context.Context, ipStr string) (*ASN, error) {
+		return &ASN{Number: 13335, Organization: "CLOUDFLARENET"}, nil
+	}).Build()
+	SetCtx(parent, instance)
+
+	info := &IPInfo{Str: "1.1.1.1"}
+	asn, loaded = LookupASN(parent.Context(), info)
+	require.True(t, loaded)
+	require.Equal(t, uint(13335), asn.Number)
+	require.Same(t, asn, info.ASN)
+}
+
+func TestRequestLookupsOncePerRequest(t *testing.T) {
+	var lookups atomic.Int32
+	instance := &MaxMind{}
+	instance.lookupCity = func(_ context.Context, ipStr string) (*City, error) {
+		lookups.Add(1)
+		city := &City{}
+		city.Country.IsoCode = "GB"
+		city.Continent.Code = "EU"
+		city.Location.TimeZone = "Europe/London"
+		return city, nil
+	}
+	parent := task.GetTestTask(t)
+	SetCtx(parent, instance)
+
+	req := httptest.NewRequestWithContext(parent.Context(), http.MethodGet, "/", nil)
+	req.RemoteAddr = "81.2.69.142:4321"
+	req = routes.WithRouteContext(req, nil)
+
+	require.Equal(t, "GB", RequestCountry(req))
+	require.Equal(t, "EU", RequestContinent(req))
+	require.Equal(t, "Europe/London", RequestTimeZone(req))
+	require.Empty(t, RequestCityName(req), "country database")
+	require.Equal(t, int32(1), lookups.Load())
+
+	req.RemoteAddr = "invalid"
+	require.Empty(t, RequestCountry(req))
+	require.Equal(t, int32(1), lookups.Load())
+}
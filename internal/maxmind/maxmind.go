@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/oschwald/maxminddb-golang"
+	"github.com/rs/zerolog"
 	"github.com/yusing/godoxy/internal/common"
 	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	"github.com/yusing/goutils/cache"
@@ -29,7 +30,10 @@ refactor(maxmind): switch to Country database
 
 type MaxMind struct {
 	*Config
+	edition    string // the Config edition when empty
 	lookupCity cache.CachedContextKeyFunc[*City, string]
+	lookupASN  cache.CachedContextKeyFunc[*ASN, string]
+	asn        *MaxMind // the ASN database, nil unless enabled
 
 	lastUpdate time.Time
 	db         struct {
@@ -42,6 +46,7 @@ type (
 	Config = maxmind.Config
 	IPInfo = maxmind.IPInfo
 	City   = maxmind.City
+	ASN    = maxmind.ASN
 )
 
 const (
@@ -62,18 +67,24 @@ func (cfg *MaxMind) dbPath() string {
 	return filepath.Join(dataDir, cfg.dbFilename())
 }
 
-func (cfg *MaxMind) dbURL() string {
-	if cfg.Database == maxmind.MaxMindGeoLite {
-		return "https://download.maxmind.com/geoip/databases/GeoLite2-Country/download?suffix=tar.gz"
+func (cfg *MaxMind) dbEdition() string {
+	if cfg.edition != "" {
+		return cfg.edition
 	}
-	return "https://download.maxmind.com/geoip/databases/GeoIP2-Country/download?suffix=tar.gz"
+	return cfg.Edition()
+}
+
+func (cfg *MaxMind) dbURL() string {
+	return "https://download.maxmind.com/geoip/databases/" + cfg.dbEdition() + "/download?suffix=tar.gz"
 }
 
 func (cfg *MaxMind) dbFilename() string {
-	if cfg.Database == maxmind.MaxMindGeoLite {
-		return "GeoLite2-Country.mmdb"
-	}
-	return "GeoIP2-Country.mmdb"
+	return cfg.dbEdition() + ".mmdb"
+}
+
+func (cfg *MaxMind) Logger() *zerolog.Logger {
+	l := cfg.Config.Logger().With().Str("edition", cfg.dbEdition()).Logger()
+	return &l
 }
 
 func (cfg *MaxMind) LoadMaxMindDB(parent task.Parent) error {
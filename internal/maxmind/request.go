@@ -0,0 +1,68 @@
+package maxmind
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/yusing/godoxy/internal/route/routes"
+)
+
+// RequestCity looks up the country, city and time zone of the request client, once per request.
+func RequestCity(r *http.Request) *City {
+	info := routes.ClientIPInfo(r)
+	if info == nil {
+		return nil
+	}
+	city, _ := LookupCity(r.Context(), info)
+	return city
+}
+
+// RequestASN looks up the autonomous system of the request client, once per request.
+func RequestASN(r *http.Request) *ASN {
+	info := routes.ClientIPInfo(r)
+	if info == nil {
+		return nil
+	}
+	asn, _ := LookupASN(r.Context(), info)
+	return asn
+}
+
+// RequestCountry returns the ISO country code of the request client, empty when unknown.
+func RequestCountry(r *http.Request) string {
+	if city := RequestCity(r); city != nil {
+		return city.Country.IsoCode
+	}
+	return ""
+}
+
+// RequestContinent returns the continent code of the request client, empty when unknown.
+func RequestContinent(r *http.Request) string {
+	if city := RequestCity(r); city != nil {
+		return city.Continent.Code
+	}
+	return ""
+}
+
+// RequestCityName returns the English city name of the request client, empty when unknown.
+func RequestCityName(r *http.Request) string {
+	if city := RequestCity(r); city != nil {
+		return city.CityName()
+	}
+	return ""
+}
+
+// RequestTimeZone returns the time zone of the request client, empty when unknown.
+func RequestTimeZone(r *http.Request) string {
+	if city := RequestCity(r); city != nil {
+		return city.Location.TimeZone
+	}
+	return ""
+}
+
+// RequestASNumber returns the autonomous system number of the request client, empty when unknown.
+func RequestASNumber(r *http.Request) string {
+	if asn := RequestASN(r); asn != nil && asn.Number != 0 {
+		return strconv.FormatUint(uint64(asn.Number), 10)
+	}
+	return ""
+}
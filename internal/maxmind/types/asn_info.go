@@ -0,0 +1,6 @@
+package maxmind
+
+type ASN struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
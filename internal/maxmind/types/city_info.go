@@ -7,4 +7,16 @@ type City struct {
 	Country struct {
 		IsoCode string `maxminddb:"iso_code"`
 	} `maxminddb:"country"`
+	Continent struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"continent"`
+	// City is only in the City databases.
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// CityName returns the English name of the city, empty without a City database.
+func (c *City) CityName() string {
+	return c.City.Names["en"]
 }
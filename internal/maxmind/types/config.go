@@ -12,6 +12,10 @@ type (
 		AccountID  string            `json:"account_id" validate:"required"`
 		LicenseKey strutils.Redacted `json:"license_key" validate:"required"`
 		Database   DatabaseType      `json:"database" validate:"omitempty,oneof=geolite geoip2"`
+		// City downloads the City database instead of the Country database, for city names.
+		City bool `json:"city,omitempty"`
+		// ASN also downloads the GeoLite2 ASN database, for autonomous system lookups.
+		ASN bool `json:"asn,omitempty"`
 	}
 )
 
@@ -20,6 +24,9 @@ const (
 	MaxMindGeoIP2  DatabaseType = "geoip2"
 )
 
+// EditionASN is the ASN database, also available to GeoIP2 accounts.
+const EditionASN = "GeoLite2-ASN"
+
 func (cfg *Config) Validate() error {
 	if cfg.Database == "" {
 		cfg.Database = MaxMindGeoLite
@@ -27,6 +34,18 @@ func (cfg *Config) Validate() error {
 	return nil
 }
 
+// Edition returns the MaxMind edition ID of the country or city database.
+func (cfg *Config) Edition() string {
+	prefix := "GeoLite2"
+	if cfg.Database == MaxMindGeoIP2 {
+		prefix = "GeoIP2"
+	}
+	if cfg.City {
+		return prefix + "-City"
+	}
+	return prefix + "-Country"
+}
+
 func (cfg *Config) Logger() *zerolog.Logger {
 	l := log.With().Str("database", string(cfg.Database)).Logger()
 	return &l
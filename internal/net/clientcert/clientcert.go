@@ -0,0 +1,85 @@
+// Package clientcert exposes the verified client certificate of inbound mTLS requests
+// and checks client certificates for revocation.
+package clientcert
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FromRequest returns the verified client certificate of the request, or nil without one.
+func FromRequest(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+// ChainFromRequest returns the certificates the client sent after its verified certificate.
+func ChainFromRequest(r *http.Request) []*x509.Certificate {
+	if FromRequest(r) == nil || len(r.TLS.PeerCertificates) < 2 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[1:]
+}
+
+// Subject returns the subject distinguished name, e.g. "CN=device-1,OU=fleet,O=Example".
+func Subject(cert *x509.Certificate) string {
+	return cert.Subject.String()
+}
+
+// Issuer returns the issuer distinguished name.
+func Issuer(cert *x509.Certificate) string {
+	return cert.Issuer.String()
+}
+
+// SANs returns the DNS names, email addresses, IP addresses and URIs of the certificate.
+func SANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.EmailAddresses)+len(cert.IPAddresses)+len(cert.URIs))
+	sans = append(sans, cert.DNSNames...)
+	sans = append(sans, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	return sans
+}
+
+// Fingerprint returns the lowercase hex SHA-256 of the certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Serial returns the lowercase hex serial number.
+func Serial(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// EscapedPEM returns the URL-encoded PEM of the certificate, like nginx $ssl_client_escaped_cert.
+func EscapedPEM(cert *x509.Certificate) string {
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	return strings.ReplaceAll(url.QueryEscape(string(data)), "+", "%20")
+}
+
+// RFC9440 returns the certificate as a structured field byte sequence (RFC 9440 Client-Cert).
+func RFC9440(cert *x509.Certificate) string {
+	return ":" + base64.StdEncoding.EncodeToString(cert.Raw) + ":"
+}
+
+// RFC9440Chain returns the certificates as a structured field list (RFC 9440 Client-Cert-Chain).
+func RFC9440Chain(certs []*x509.Certificate) string {
+	fields := make([]string, len(certs))
+	for i, cert := range certs {
+		fields[i] = RFC9440(cert)
+	}
+	return strings.Join(fields, ", ")
+}
@@ -0,0 +1,116 @@
+package clientcert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{cert: cert, key: key}
+}
+
+func (ca *testCA) issue(t *testing.T, serial int64, ocspServer string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:   big.NewInt(serial),
+		Subject:        pkix.Name{CommonName: "device-1", OrganizationalUnit: []string{"fleet"}, Organization: []string{"Example"}},
+		DNSNames:       []string{"device-1.fleet.example.com"},
+		EmailAddresses: []string{"ops@example.com"},
+		IPAddresses:    []net.IP{net.ParseIP("10.0.0.1")},
+		URIs:           []*url.URL{{Scheme: "spiffe", Host: "example.com", Path: "/device-1"}},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if ocspServer != "" {
+		tmpl.OCSPServer = []string{ocspServer}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestIdentity(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, 0xabc, "")
+
+	require.Equal(t, "CN=device-1,OU=fleet,O=Example", Subject(cert))
+	require.Equal(t, "CN=test CA", Issuer(cert))
+	require.Equal(t, []string{"device-1.fleet.example.com", "ops@example.com", "10.0.0.1", "spiffe://example.com/device-1"}, SANs(cert))
+	require.Equal(t, "abc", Serial(cert))
+	require.Len(t, Fingerprint(cert), 64)
+
+	decoded, err := url.QueryUnescape(EscapedPEM(cert))
+	require.NoError(t, err)
+	block, _ := pem.Decode([]byte(decoded))
+	require.NotNil(t, block)
+	require.Equal(t, cert.Raw, block.Bytes)
+	require.NotContains(t, EscapedPEM(cert), "+")
+
+	field := RFC9440(cert)
+	require.Equal(t, byte(':'), field[0])
+	require.Equal(t, byte(':'), field[len(field)-1])
+	der, err := base64.StdEncoding.DecodeString(field[1 : len(field)-1])
+	require.NoError(t, err)
+	require.Equal(t, cert.Raw, der)
+	require.Equal(t, field+", "+RFC9440(ca.cert), RFC9440Chain([]*x509.Certificate{cert, ca.cert}))
+}
+
+func TestFromRequest(t *testing.T) {
+	ca := newTestCA(t)
+	cert := ca.issue(t, 2, "")
+
+	req := httptest.NewRequest("GET", "https://example.com", nil)
+	req.TLS = nil
+	require.Nil(t, FromRequest(req))
+
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	require.Nil(t, FromRequest(req), "not verified")
+	require.Nil(t, ChainFromRequest(req))
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert, ca.cert}}
+	require.Same(t, cert, FromRequest(req))
+	require.Nil(t, ChainFromRequest(req), "no intermediates sent")
+
+	req.TLS.PeerCertificates = []*x509.Certificate{cert, ca.cert}
+	require.Equal(t, []*x509.Certificate{ca.cert}, ChainFromRequest(req))
+}
@@ -0,0 +1,290 @@
+package clientcert
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	gperr "github.com/yusing/goutils/errs"
+	"golang.org/x/crypto/ocsp"
+)
+
+var (
+	ErrRevoked            = errors.New("client certificate revoked")
+	ErrRevocationUnknown  = errors.New("client certificate revocation status unknown")
+	ErrInvalidCRL         = errors.New("invalid CRL")
+	errOCSPStatusUnknown  = errors.New("OCSP responder does not know the certificate")
+	errOCSPResponseTooBig = errors.New("OCSP response too large")
+)
+
+const (
+	// stat the CRL files for changes no more often than this
+	crlReloadInterval = time.Minute
+	// cache OCSP responses without NextUpdate for this long
+	ocspDefaultValidity = time.Hour
+	// cache OCSP responses no longer than this, revocations are picked up within it
+	ocspMaxValidity = 24 * time.Hour
+	// retry after the responder failed
+	ocspRetryInterval = time.Minute
+
+	// the fetch blocks the handshake
+	ocspFetchTimeout   = 5 * time.Second
+	ocspMaxResponseLen = 1 << 20
+)
+
+// RevocationChecker checks verified client certificates against CRL files and their OCSP responders.
+// Only the client certificate is checked, not its intermediates.
+type RevocationChecker struct {
+	ocsp     bool
+	softFail bool
+
+	client *http.Client
+	now    func() time.Time
+
+	mu            sync.Mutex
+	crls          []*crlFile
+	crlsCheckedAt time.Time
+	ocspCache     map[string]ocspEntry // by certificate fingerprint
+}
+
+type crlFile struct {
+	path    string
+	modTime time.Time
+	list    *x509.RevocationList
+	// signature check result by issuer fingerprint
+	verified map[string]bool
+}
+
+type ocspEntry struct {
+	err     error // nil when good
+	expires time.Time
+}
+
+// NewRevocationChecker loads the CRL files. With checkOCSP, certificates with an OCSP responder are checked with it.
+// With softFail, certificates whose OCSP status cannot be fetched are accepted.
+func NewRevocationChecker(crlFiles []string, checkOCSP, softFail bool) (*RevocationChecker, error) {
+	c := &RevocationChecker{
+		ocsp:      checkOCSP,
+		softFail:  softFail,
+		client:    &http.Client{Timeout: ocspFetchTimeout},
+		now:       time.Now,
+		ocspCache: make(map[string]ocspEntry),
+	}
+	errs := gperr.NewBuilder("CRL files error")
+	for _, path := range crlFiles {
+		crl := &crlFile{path: path}
+		if err := crl.load(); err != nil {
+			errs.Add(err)
+			continue
+		}
+		c.crls = append(c.crls, crl)
+	}
+	if err := errs.Error(); err != nil {
+		return nil, err
+	}
+	c.crlsCheckedAt = c.now()
+	return c, nil
+}
+
+func (crl *crlFile) load() error {
+	stat, err := os.Stat(crl.path)
+	if err != nil {
+		return gperr.PrependSubject(err, crl.path)
+	}
+	data, err := os.ReadFile(crl.path)
+	if err != nil {
+		return gperr.PrependSubject(err, crl.path)
+	}
+	list, err := parseCRL(data)
+	if err != nil {
+		return gperr.PrependSubject(err, crl.path)
+	}
+	crl.modTime = stat.ModTime()
+	crl.list = list
+	crl.verified = make(map[string]bool)
+	return nil
+}
+
+// parseCRL parses a PEM or DER encoded CRL.
+func parseCRL(data []byte) (*x509.RevocationList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN")) {
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("%w: expect a X509 CRL PEM block", ErrInvalidCRL)
+		}
+		data = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCRL, err)
+	}
+	return list, nil
+}
+
+// Check checks the verified chains of a handshake, for tls.Config.VerifyConnection.
+func (c *RevocationChecker) Check(verifiedChains [][]*x509.Certificate) error {
+	if len(verifiedChains) == 0 || len(verifiedChains[0]) < 2 {
+		// no client certificate, or a trusted certificate without issuer
+		return nil
+	}
+	leaf, issuer := verifiedChains[0][0], verifiedChains[0][1]
+	if err := c.checkCRLs(leaf, issuer); err != nil {
+		return err
+	}
+	if c.ocsp && len(leaf.OCSPServer) > 0 {
+		return c.checkOCSP(leaf, issuer)
+	}
+	return nil
+}
+
+func (c *RevocationChecker) checkCRLs(leaf, issuer *x509.Certificate) error {
+	if len(c.crls) == 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.reloadCRLs()
+	issuerFingerprint := Fingerprint(issuer)
+	for _, crl := range c.crls {
+		if !bytes.Equal(crl.list.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		verified, ok := crl.verified[issuerFingerprint]
+		if !ok {
+			verified = crl.list.CheckSignatureFrom(issuer) == nil
+			crl.verified[issuerFingerprint] = verified
+		}
+		if !verified {
+			continue
+		}
+		for _, entry := range crl.list.RevokedCertificateEntries {
+			if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+				return ErrRevoked
+			}
+		}
+	}
+	return nil
+}
+
+// reloadCRLs reloads the CRL files changed on disk, keeping the loaded one when a file became invalid.
+func (c *RevocationChecker) reloadCRLs() {
+	now := c.now()
+	if now.Sub(c.crlsCheckedAt) < crlReloadInterval {
+		return
+	}
+	c.crlsCheckedAt = now
+	for _, crl := range c.crls {
+		stat, err := os.Stat(crl.path)
+		if err != nil || stat.ModTime().Equal(crl.modTime) {
+			continue
+		}
+		reloaded := &crlFile{path: crl.path}
+		if err := reloaded.load(); err != nil {
+			log.Err(err).Msg("inbound mTLS: failed to reload CRL, keeping the previous one")
+			continue
+		}
+		*crl = *reloaded
+	}
+}
+
+func (c *RevocationChecker) checkOCSP(leaf, issuer *x509.Certificate) error {
+	key := Fingerprint(leaf)
+
+	c.mu.Lock()
+	entry, ok := c.ocspCache[key]
+	c.mu.Unlock()
+
+	if now := c.now(); !ok || now.After(entry.expires) {
+		entry = c.fetchOCSP(leaf, issuer, now)
+		c.mu.Lock()
+		c.ocspCache[key] = entry
+		for k, e := range c.ocspCache {
+			if now.After(e.expires) {
+				delete(c.ocspCache, k)
+			}
+		}
+		c.mu.Unlock()
+	}
+
+	switch {
+	case entry.err == nil:
+		return nil
+	case errors.Is(entry.err, ErrRevoked):
+		return entry.err
+	case c.softFail:
+		log.Warn().Err(entry.err).Str("subject", Subject(leaf)).Msg("inbound mTLS: OCSP check failed, accepting client certificate")
+		return nil
+	default:
+		return fmt.Errorf("%w: %w", ErrRevocationUnknown, entry.err)
+	}
+}
+
+func (c *RevocationChecker) fetchOCSP(leaf, issuer *x509.Certificate, now time.Time) ocspEntry {
+	resp, err := c.requestOCSP(leaf, issuer)
+	if err != nil {
+		return ocspEntry{err: err, expires: now.Add(ocspRetryInterval)}
+	}
+
+	expires := resp.NextUpdate
+	if expires.IsZero() {
+		expires = now.Add(ocspDefaultValidity)
+	}
+	if maxExpires := now.Add(ocspMaxValidity); expires.After(maxExpires) {
+		expires = maxExpires
+	}
+
+	switch resp.Status {
+	case ocsp.Good:
+		return ocspEntry{expires: expires}
+	case ocsp.Revoked:
+		return ocspEntry{err: ErrRevoked, expires: expires}
+	default:
+		return ocspEntry{err: errOCSPStatusUnknown, expires: now.Add(ocspRetryInterval)}
+	}
+}
+
+func (c *RevocationChecker) requestOCSP(leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	reqBody, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ocspFetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, leaf.OCSPServer[0], bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	req.Header.Set("Accept", "application/ocsp-response")
+
+	httpResp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OCSP responder returned %s", httpResp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, ocspMaxResponseLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > ocspMaxResponseLen {
+		return nil, errOCSPResponseTooBig
+	}
+	return ocsp.ParseResponseForCert(body, leaf, issuer)
+}
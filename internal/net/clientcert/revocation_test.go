@@ -0,0 +1,161 @@
+package clientcert
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+func (ca *testCA) writeCRL(t *testing.T, path string, number int64, revoked ...int64) {
+	t.Helper()
+	entries := make([]x509.RevocationListEntry, len(revoked))
+	for i, serial := range revoked {
+		entries[i] = x509.RevocationListEntry{SerialNumber: big.NewInt(serial), RevocationTime: time.Now()}
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(number),
+		ThisUpdate:                time.Now().Add(-time.Minute),
+		NextUpdate:                time.Now().Add(time.Hour),
+		RevokedCertificateEntries: entries,
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), 0o644))
+}
+
+func TestRevocationCRL(t *testing.T) {
+	ca := newTestCA(t)
+	crlPath := filepath.Join(t.TempDir(), "ca.crl")
+	ca.writeCRL(t, crlPath, 1, 3)
+
+	c, err := NewRevocationChecker([]string{crlPath}, false, false)
+	require.NoError(t, err)
+
+	good := ca.issue(t, 2, "")
+	revoked := ca.issue(t, 3, "")
+	require.NoError(t, c.Check([][]*x509.Certificate{{good, ca.cert}}))
+	require.ErrorIs(t, c.Check([][]*x509.Certificate{{revoked, ca.cert}}), ErrRevoked)
+	require.NoError(t, c.Check(nil), "no client certificate")
+
+	// a CRL of another CA with the same serial does not apply
+	other := newTestCA(t)
+	require.NoError(t, c.Check([][]*x509.Certificate{{other.issue(t, 3, ""), other.cert}}))
+
+	t.Run("reload", func(t *testing.T) {
+		now := time.Now()
+		c.now = func() time.Time { return now }
+		ca.writeCRL(t, crlPath, 2, 2)
+		mtime := now.Add(time.Second)
+		require.NoError(t, os.Chtimes(crlPath, mtime, mtime))
+
+		require.ErrorIs(t, c.Check([][]*x509.Certificate{{revoked, ca.cert}}), ErrRevoked, "not reloaded yet")
+		now = now.Add(crlReloadInterval)
+		require.ErrorIs(t, c.Check([][]*x509.Certificate{{good, ca.cert}}), ErrRevoked)
+		require.NoError(t, c.Check([][]*x509.Certificate{{revoked, ca.cert}}))
+	})
+}
+
+func TestRevocationInvalidCRL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.crl")
+	require.NoError(t, os.WriteFile(path, []byte("-----BEGIN CERTIFICATE-----\n-----END CERTIFICATE-----\n"), 0o644))
+	_, err := NewRevocationChecker([]string{path}, false, false)
+	require.ErrorIs(t, err, ErrInvalidCRL)
+
+	_, err = NewRevocationChecker([]string{filepath.Join(t.TempDir(), "missing.crl")}, false, false)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+type testOCSPResponder struct {
+	ca       *testCA
+	revoked  map[int64]bool
+	fail     atomic.Bool
+	requests atomic.Int32
+}
+
+func (r *testOCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.requests.Add(1)
+	if r.fail.Load() {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	ocspReq, err := ocsp.ParseRequest(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	status := ocsp.Good
+	if r.revoked[ocspReq.SerialNumber.Int64()] {
+		status = ocsp.Revoked
+	}
+	resp, err := ocsp.CreateResponse(r.ca.cert, r.ca.cert, ocsp.Response{
+		Status:       status,
+		SerialNumber: ocspReq.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, r.ca.key)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(resp)
+}
+
+func TestRevocationOCSP(t *testing.T) {
+	ca := newTestCA(t)
+	responder := &testOCSPResponder{ca: ca, revoked: map[int64]bool{3: true}}
+	srv := httptest.NewServer(responder)
+	t.Cleanup(srv.Close)
+
+	c, err := NewRevocationChecker(nil, true, false)
+	require.NoError(t, err)
+
+	good := ca.issue(t, 2, srv.URL)
+	revoked := ca.issue(t, 3, srv.URL)
+	require.NoError(t, c.Check([][]*x509.Certificate{{good, ca.cert}}))
+	require.ErrorIs(t, c.Check([][]*x509.Certificate{{revoked, ca.cert}}), ErrRevoked)
+	require.NoError(t, c.Check([][]*x509.Certificate{{ca.issue(t, 4, ""), ca.cert}}), "no OCSP responder")
+
+	requests := responder.requests.Load()
+	require.NoError(t, c.Check([][]*x509.Certificate{{good, ca.cert}}))
+	require.Equal(t, requests, responder.requests.Load(), "response is cached")
+
+	responder.fail.Store(true)
+	err = c.Check([][]*x509.Certificate{{ca.issue(t, 5, srv.URL), ca.cert}})
+	require.ErrorIs(t, err, ErrRevocationUnknown)
+}
+
+func TestRevocationOCSPSoftFail(t *testing.T) {
+	ca := newTestCA(t)
+	responder := &testOCSPResponder{ca: ca, revoked: map[int64]bool{3: true}}
+	responder.fail.Store(true)
+	srv := httptest.NewServer(responder)
+	t.Cleanup(srv.Close)
+
+	c, err := NewRevocationChecker(nil, true, true)
+	require.NoError(t, err)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	revoked := ca.issue(t, 3, srv.URL)
+	require.NoError(t, c.Check([][]*x509.Certificate{{revoked, ca.cert}}), "responder unavailable")
+
+	// retried after the failure expires
+	responder.fail.Store(false)
+	require.NoError(t, c.Check([][]*x509.Certificate{{revoked, ca.cert}}), "failure is cached")
+	now = now.Add(ocspRetryInterval + time.Second)
+	require.ErrorIs(t, c.Check([][]*x509.Certificate{{revoked, ca.cert}}), ErrRevoked, "revoked is never soft")
+}
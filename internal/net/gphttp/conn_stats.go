@@ -0,0 +1,97 @@
+package gphttp
+
+import (
+	"context"
+	"maps"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+)
+
+// ConnStats counts how upstream connections are acquired for the requests of a route.
+type ConnStats struct {
+	requests   atomic.Int64
+	reused     atomic.Int64
+	wasIdle    atomic.Int64
+	newConns   atomic.Int64
+	dialErrors atomic.Int64
+}
+
+type ConnStatsSnapshot struct {
+	Requests    int64   `json:"requests"`
+	ConnsReused int64   `json:"conns_reused"`
+	ConnsIdle   int64   `json:"conns_idle"` // reused connections taken from the idle pool
+	ConnsNew    int64   `json:"conns_new"`
+	DialErrors  int64   `json:"dial_errors"`
+	ReuseRatio  float64 `json:"reuse_ratio"` // reused / (reused + new)
+} // @name ConnStats
+
+// WithClientTrace returns a context counting the connection acquired for a request made with it.
+func (s *ConnStats) WithClientTrace(ctx context.Context) context.Context {
+	s.requests.Add(1)
+	// a new trace per request, httptrace.WithClientTrace composes it with the existing one in place
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				s.reused.Add(1)
+				if info.WasIdle {
+					s.wasIdle.Add(1)
+				}
+			} else {
+				s.newConns.Add(1)
+			}
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				s.dialErrors.Add(1)
+			}
+		},
+	})
+}
+
+func (s *ConnStats) Snapshot() ConnStatsSnapshot {
+	snapshot := ConnStatsSnapshot{
+		Requests:    s.requests.Load(),
+		ConnsReused: s.reused.Load(),
+		ConnsIdle:   s.wasIdle.Load(),
+		ConnsNew:    s.newConns.Load(),
+		DialErrors:  s.dialErrors.Load(),
+	}
+	if total := snapshot.ConnsReused + snapshot.ConnsNew; total > 0 {
+		snapshot.ReuseRatio = float64(snapshot.ConnsReused) / float64(total)
+	}
+	return snapshot
+}
+
+var connStats = struct {
+	sync.RWMutex
+	m map[string]*ConnStats
+}{m: make(map[string]*ConnStats)}
+
+// RegisterConnStats makes the stats available by name in AllConnStats until unregister is called.
+// A later registration with the same name replaces it.
+func RegisterConnStats(name string, s *ConnStats) (unregister func()) {
+	connStats.Lock()
+	connStats.m[name] = s
+	connStats.Unlock()
+	return func() {
+		connStats.Lock()
+		if connStats.m[name] == s {
+			delete(connStats.m, name)
+		}
+		connStats.Unlock()
+	}
+}
+
+// AllConnStats returns a snapshot of every registered stats by name.
+func AllConnStats() map[string]ConnStatsSnapshot {
+	connStats.RLock()
+	all := maps.Clone(connStats.m)
+	connStats.RUnlock()
+
+	snapshots := make(map[string]ConnStatsSnapshot, len(all))
+	for name, s := range all {
+		snapshots[name] = s.Snapshot()
+	}
+	return snapshots
+}
@@ -0,0 +1,57 @@
+package gphttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(srv.Close)
+
+	var stats ConnStats
+	client := srv.Client()
+	for range 3 {
+		req, err := http.NewRequestWithContext(stats.WithClientTrace(t.Context()), http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	req, err := http.NewRequestWithContext(stats.WithClientTrace(t.Context()), http.MethodGet, "http://127.0.0.1:1", nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.Error(t, err)
+
+	snapshot := stats.Snapshot()
+	require.Equal(t, int64(4), snapshot.Requests)
+	require.Equal(t, int64(1), snapshot.ConnsNew)
+	require.Equal(t, int64(2), snapshot.ConnsReused)
+	require.Equal(t, int64(2), snapshot.ConnsIdle)
+	require.Equal(t, int64(1), snapshot.DialErrors)
+	require.InDelta(t, 2.0/3, snapshot.ReuseRatio, 0.001)
+}
+
+func TestRegisterConnStats(t *testing.T) {
+	a, b := new(ConnStats), new(ConnStats)
+	unregisterA := RegisterConnStats("test-route", a)
+	a.requests.Add(1)
+	require.Equal(t, int64(1), AllConnStats()["test-route"].Requests)
+
+	// replaced by a reloaded route, unregistering the old one keeps the new one
+	unregisterB := RegisterConnStats("test-route", b)
+	unregisterA()
+	require.Contains(t, AllConnStats(), "test-route")
+	require.Zero(t, AllConnStats()["test-route"].Requests)
+
+	unregisterB()
+	require.NotContains(t, AllConnStats(), "test-route")
+}
@@ -134,6 +134,15 @@ func (c *checkBypass) modifyResponse(resp *http.Response) error {
 	return c.modRes.modifyResponse(resp)
 }
 
+// release implements MiddlewareWithRelease.
+func (c *checkBypass) release() {
+	if r, ok := c.modReq.(MiddlewareWithRelease); ok {
+		r.release()
+	} else if r, ok := c.modRes.(MiddlewareWithRelease); ok {
+		r.release()
+	}
+}
+
 func (m *Middleware) withCheckBypass() any {
 	if len(m.Bypass) > 0 {
 		modReq, _ := m.impl.(RequestModifier)
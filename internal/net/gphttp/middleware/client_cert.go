@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"errors"
+	"net/http"
+
+	"github.com/gobwas/glob"
+	"github.com/yusing/godoxy/internal/net/clientcert"
+	gperr "github.com/yusing/goutils/errs"
+	httpevents "github.com/yusing/goutils/events/http"
+)
+
+type (
+	clientCert struct {
+		ClientCertOpts
+
+		subjects []glob.Glob
+		sans     []glob.Glob
+		ous      []glob.Glob
+	}
+	// ClientCertOpts authorizes and forwards the client certificate verified by an inbound mTLS profile.
+	//
+	// When any allow list is set, the certificate must match an entry of one of them:
+	// subjects match the common name or the full subject, sans any SAN, ous any organizational unit.
+	// Entries are glob patterns.
+	ClientCertOpts struct {
+		AllowSubjects []string `json:"allow_subjects"`
+		AllowSANs     []string `json:"allow_sans"`
+		AllowOUs      []string `json:"allow_ous"`
+		// Forward sets the certificate in ForwardHeader: URL-encoded PEM, or RFC 9440 with the chain in <ForwardHeader>-Chain.
+		// Headers of the same names sent by the client are always removed.
+		Forward       string `json:"forward" validate:"omitempty,oneof=pem rfc9440"`
+		ForwardHeader string `json:"forward_header"`
+		StatusCode    int    `json:"status_code" aliases:"status" validate:"omitempty,status_code"`
+		Message       string
+	}
+)
+
+const (
+	ClientCertForwardPEM     = "pem"
+	ClientCertForwardRFC9440 = "rfc9440"
+)
+
+var (
+	ClientCert         = NewMiddleware[clientCert]()
+	clientCertDefaults = ClientCertOpts{
+		ForwardHeader: "X-Client-Cert",
+		StatusCode:    http.StatusForbidden,
+		Message:       "client certificate not allowed",
+	}
+)
+
+// setup implements MiddlewareWithSetup.
+func (m *clientCert) setup() {
+	m.ClientCertOpts = clientCertDefaults
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *clientCert) finalize() error {
+	if m.Forward != "" && m.ForwardHeader == "" {
+		return errors.New("forward_header is required to forward the client certificate")
+	}
+
+	var err error
+	errs := gperr.NewBuilder("invalid allow list")
+	if m.subjects, err = compileGlobs(m.AllowSubjects); err != nil {
+		errs.AddSubjectf(err, "allow_subjects")
+	}
+	if m.sans, err = compileGlobs(m.AllowSANs); err != nil {
+		errs.AddSubjectf(err, "allow_sans")
+	}
+	if m.ous, err = compileGlobs(m.AllowOUs); err != nil {
+		errs.AddSubjectf(err, "allow_ous")
+	}
+	return errs.Error()
+}
+
+func compileGlobs(patterns []string) ([]glob.Glob, error) {
+	globs := make([]glob.Glob, len(patterns))
+	for i, pattern := range patterns {
+		g, err := glob.Compile(pattern)
+		if err != nil {
+			return nil, gperr.PrependSubject(err, pattern)
+		}
+		globs[i] = g
+	}
+	return globs, nil
+}
+
+// before implements RequestModifier.
+func (m *clientCert) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	cert := clientcert.FromRequest(r)
+	if len(m.subjects)+len(m.sans)+len(m.ous) > 0 && (cert == nil || !m.allowed(cert)) {
+		defer httpevents.Blocked(r, "ClientCert", "client certificate not allowed")
+		http.Error(w, m.Message, m.StatusCode)
+		return false
+	}
+
+	if m.Forward != "" {
+		chainHeader := m.ForwardHeader + "-Chain"
+		r.Header.Del(m.ForwardHeader)
+		r.Header.Del(chainHeader)
+		if cert == nil {
+			return true
+		}
+		switch m.Forward {
+		case ClientCertForwardPEM:
+			r.Header.Set(m.ForwardHeader, clientcert.EscapedPEM(cert))
+		case ClientCertForwardRFC9440:
+			r.Header.Set(m.ForwardHeader, clientcert.RFC9440(cert))
+			if chain := clientcert.ChainFromRequest(r); len(chain) > 0 {
+				r.Header.Set(chainHeader, clientcert.RFC9440Chain(chain))
+			}
+		}
+	}
+	return true
+}
+
+func (m *clientCert) allowed(cert *x509.Certificate) bool {
+	if matchAnyGlob(m.subjects, cert.Subject.CommonName, clientcert.Subject(cert)) {
+		return true
+	}
+	if matchAnyGlob(m.sans, clientcert.SANs(cert)...) {
+		return true
+	}
+	return matchAnyGlob(m.ous, cert.Subject.OrganizationalUnit...)
+}
+
+func matchAnyGlob(globs []glob.Glob, values ...string) bool {
+	for _, g := range globs {
+		for _, v := range values {
+			if g.Match(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
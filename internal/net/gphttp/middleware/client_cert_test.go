@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/yusing/godoxy/internal/net/clientcert"
+	"github.com/yusing/godoxy/internal/serialization"
+	expect "github.com/yusing/goutils/testing"
+)
+
+func newTestClientCert(t *testing.T) (cert, ca *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expect.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "fleet CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, key.Public(), key)
+	expect.NoError(t, err)
+	ca, err = x509.ParseCertificate(der)
+	expect.NoError(t, err)
+
+	der, err = x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "device-1", OrganizationalUnit: []string{"fleet"}},
+		DNSNames:     []string{"device-1.fleet.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}, ca, key.Public(), key)
+	expect.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	expect.NoError(t, err)
+	return cert, ca
+}
+
+func serveClientCert(t *testing.T, opts OptionsRaw, cert, ca *x509.Certificate, header http.Header) (*httptest.ResponseRecorder, http.Header) {
+	t.Helper()
+	mid, err := ClientCert.New(opts)
+	expect.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "https://app.example.com/", nil)
+	if cert != nil {
+		req.TLS = &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{cert, ca},
+			VerifiedChains:   [][]*x509.Certificate{{cert, ca}},
+		}
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	var upstreamHeader http.Header
+	rec := httptest.NewRecorder()
+	mid.ServeHTTP(func(w http.ResponseWriter, r *http.Request) {
+		upstreamHeader = r.Header.Clone()
+	}, rec, req)
+	return rec, upstreamHeader
+}
+
+func TestClientCertAllowLists(t *testing.T) {
+	cert, ca := newTestClientCert(t)
+
+	tests := []struct {
+		name    string
+		opts    OptionsRaw
+		allowed bool
+	}{
+		{"no allow list", OptionsRaw{}, true},
+		{"common name", OptionsRaw{"allow_subjects": []string{"device-*"}}, true},
+		{"full subject", OptionsRaw{"allow_subjects": []string{"CN=device-1,OU=fleet"}}, true},
+		{"subject mismatch", OptionsRaw{"allow_subjects": []string{"laptop-*"}}, false},
+		{"san", OptionsRaw{"allow_sans": []string{"*.fleet.example.com"}}, true},
+		{"san mismatch", OptionsRaw{"allow_sans": []string{"*.corp.example.com"}}, false},
+		{"ou", OptionsRaw{"allow_ous": []string{"fleet"}}, true},
+		{"any list matches", OptionsRaw{"allow_subjects": []string{"laptop-*"}, "allow_ous": []string{"fleet"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec, _ := serveClientCert(t, tt.opts, cert, ca, nil)
+			if tt.allowed {
+				expect.Equal(t, rec.Code, http.StatusOK)
+			} else {
+				expect.Equal(t, rec.Code, http.StatusForbidden)
+			}
+		})
+	}
+
+	t.Run("no client certificate", func(t *testing.T) {
+		rec, _ := serveClientCert(t, OptionsRaw{"allow_ous": []string{"fleet"}}, nil, nil, nil)
+		expect.Equal(t, rec.Code, http.StatusForbidden)
+
+		rec, _ = serveClientCert(t, OptionsRaw{}, nil, nil, nil)
+		expect.Equal(t, rec.Code, http.StatusOK)
+	})
+}
+
+func TestClientCertForward(t *testing.T) {
+	cert, ca := newTestClientCert(t)
+	spoofed := http.Header{
+		"X-Client-Cert":       {"spoofed"},
+		"X-Client-Cert-Chain": {"spoofed"},
+	}
+
+	t.Run("pem", func(t *testing.T) {
+		_, header := serveClientCert(t, OptionsRaw{"forward": "pem"}, cert, ca, spoofed)
+		expect.Equal(t, header.Get("X-Client-Cert"), clientcert.EscapedPEM(cert))
+		expect.Equal(t, header.Get("X-Client-Cert-Chain"), "")
+	})
+	t.Run("rfc9440", func(t *testing.T) {
+		_, header := serveClientCert(t, OptionsRaw{"forward": "rfc9440", "forward_header": "Client-Cert"}, cert, ca, http.Header{
+			"Client-Cert": {"spoofed"},
+		})
+		expect.Equal(t, header.Get("Client-Cert"), clientcert.RFC9440(cert))
+		expect.Equal(t, header.Get("Client-Cert-Chain"), clientcert.RFC9440(ca))
+	})
+	t.Run("spoofed without client certificate", func(t *testing.T) {
+		_, header := serveClientCert(t, OptionsRaw{"forward": "pem"}, nil, nil, spoofed)
+		expect.Equal(t, header.Get("X-Client-Cert"), "")
+		expect.Equal(t, header.Get("X-Client-Cert-Chain"), "")
+	})
+	t.Run("not forwarded", func(t *testing.T) {
+		_, header := serveClientCert(t, OptionsRaw{}, cert, ca, nil)
+		expect.Equal(t, header.Get("X-Client-Cert"), "")
+	})
+}
+
+func TestClientCertValidation(t *testing.T) {
+	_, err := ClientCert.New(OptionsRaw{"forward": "der"})
+	expect.ErrorIs(t, serialization.ErrValidationError, err)
+
+	_, err = ClientCert.New(OptionsRaw{"allow_subjects": []string{"[device"}})
+	expect.HasError(t, err)
+
+	_, err = ClientCert.New(OptionsRaw{"forward": "pem", "forward_header": ""})
+	expect.HasError(t, err)
+}
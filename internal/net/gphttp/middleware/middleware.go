@@ -47,6 +47,7 @@ type (
 		name      string
 		construct ImplNewFunc
 		impl      any
+		shared    bool // loaded from a compose file, used by every route and never released
 	}
 	ByPriority []*Middleware
 
@@ -63,6 +64,8 @@ type (
 	MiddlewareFinalizerWithError interface {
 		finalize() error
 	}
+	// MiddlewareWithRelease is implemented by middlewares holding resources, e.g. WASM plugins.
+	MiddlewareWithRelease interface{ release() }
 )
 
 const DefaultPriority = 10
@@ -149,6 +152,17 @@ func (m *Middleware) New(optsRaw OptionsRaw) (*Middleware, error) {
 	return mid, nil
 }
 
+// Release releases the resources of the middleware, e.g. WASM plugins, once it is no longer used.
+// Middlewares loaded from compose files are shared and kept.
+func (m *Middleware) Release() {
+	if m.shared {
+		return
+	}
+	if r, ok := m.impl.(MiddlewareWithRelease); ok {
+		r.release()
+	}
+}
+
 func (m *Middleware) Name() string {
 	return m.name
 }
@@ -395,16 +409,16 @@ func (m *Middleware) LogError(req *http.Request) *zerolog.Event {
 		Str("path", req.URL.Path)
 }
 
-func PatchReverseProxy(rp *ReverseProxy, middlewaresMap map[string]OptionsRaw) error {
+// PatchReverseProxy applies the middlewares to rp, it returns the middleware chain to release when rp is no longer used.
+func PatchReverseProxy(rp *ReverseProxy, middlewaresMap map[string]OptionsRaw) (*Middleware, error) {
 	middlewares, err := compileMiddlewares(middlewaresMap)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	patchReverseProxy(rp, middlewares)
-	return nil
+	return patchReverseProxy(rp, middlewares), nil
 }
 
-func patchReverseProxy(rp *ReverseProxy, middlewares []*Middleware) {
+func patchReverseProxy(rp *ReverseProxy, middlewares []*Middleware) *Middleware {
 	sort.Sort(ByPriority(middlewares))
 
 	mid := NewMiddlewareChain(rp.TargetName, middlewares)
@@ -431,4 +445,5 @@ func patchReverseProxy(rp *ReverseProxy, middlewares []*Middleware) {
 			rp.ModifyResponse = mr.modifyResponse
 		}
 	}
+	return mid
 }
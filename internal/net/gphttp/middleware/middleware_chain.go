@@ -12,12 +12,15 @@ type middlewareChain struct {
 	befores    []RequestModifier
 	respHeader []ResponseModifier
 	respBody   []ResponseModifier
+
+	members []*Middleware
 }
 
 // TODO: check conflict or duplicates.
 func NewMiddlewareChain(name string, chain []*Middleware) *Middleware {
 	chainMid := &middlewareChain{}
 	m := &Middleware{name: name, impl: chainMid}
+	chainMid.members = chain
 
 	for _, comp := range chain {
 		if before, ok := comp.impl.(RequestModifier); ok {
@@ -34,6 +37,13 @@ func NewMiddlewareChain(name string, chain []*Middleware) *Middleware {
 	return m
 }
 
+// release implements MiddlewareWithRelease.
+func (m *middlewareChain) release() {
+	for _, mid := range m.members {
+		mid.Release()
+	}
+}
+
 // before implements RequestModifier.
 func (m *middlewareChain) before(w http.ResponseWriter, r *http.Request) (proceedNext bool) {
 	if len(m.befores) == 0 {
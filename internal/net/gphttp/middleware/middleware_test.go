@@ -4,13 +4,16 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
 	"github.com/yusing/godoxy/internal/net/gphttp"
+	"github.com/yusing/goutils/http/reverseproxy"
 	ioutils "github.com/yusing/goutils/io"
+	"github.com/yusing/goutils/task"
 	expect "github.com/yusing/goutils/testing"
 )
 
@@ -21,6 +24,7 @@ type testPriority struct {
 var test = NewMiddleware[testPriority]()
 var responseHeaderRewrite = NewMiddleware[testHeaderRewrite]()
 var responseBodyRewrite = NewMiddleware[testBodyRewrite]()
+var releaseTest = NewMiddleware[testRelease]()
 
 func (t testPriority) before(w http.ResponseWriter, r *http.Request) bool {
 	w.Header().Add("Test-Value", strconv.Itoa(t.Value))
@@ -50,6 +54,18 @@ func (t testBodyRewrite) modifyResponse(resp *http.Response) error {
 
 func (testBodyRewrite) isBodyResponseModifier() {}
 
+type testRelease struct {
+	released int
+}
+
+func (t *testRelease) before(w http.ResponseWriter, r *http.Request) bool {
+	return true
+}
+
+func (t *testRelease) release() {
+	t.released++
+}
+
 func TestMiddlewareChainBypassesAuthLikeMiddlewareForIconFetch(t *testing.T) {
 	t.Run("icon fetch bypasses wrapped OIDC and keeps non-auth middleware", func(t *testing.T) {
 		chain := &middlewareChain{befores: []RequestModifier{
@@ -116,6 +132,35 @@ func TestMiddlewarePriority(t *testing.T) {
 	expect.Equal(t, strings.Join(res.ResponseHeaders["Test-Value"], ","), "3,0,1,2")
 }
 
+func TestMiddlewareReleasedWithRoute(t *testing.T) {
+	newReleaseTest := func(opts OptionsRaw) (*Middleware, *testRelease) {
+		mid, err := releaseTest.New(opts)
+		require.NoError(t, err)
+		impl := mid.impl
+		if bypass, ok := impl.(*checkBypass); ok {
+			impl = bypass.modReq
+		}
+		return mid, impl.(*testRelease)
+	}
+	plain, plainImpl := newReleaseTest(nil)
+	bypassed, bypassedImpl := newReleaseTest(OptionsRaw{"bypass": []string{"path /api"}})
+	composeMember, composeImpl := newReleaseTest(nil)
+	compose := NewMiddlewareChain("compose", []*Middleware{composeMember})
+	compose.shared = true
+
+	rp := reverseproxy.NewReverseProxy("test", &url.URL{Scheme: "http", Host: "example.com"}, http.DefaultTransport)
+	mid := patchReverseProxy(rp, []*Middleware{plain, bypassed, compose})
+
+	// routes release their middlewares when their task is canceled, i.e. when removed
+	route := task.GetTestTask(t).Subtask("route", true)
+	route.OnCancel("release_middlewares", mid.Release)
+	route.FinishAndWait("route removed")
+
+	require.Equal(t, 1, plainImpl.released)
+	require.Equal(t, 1, bypassedImpl.released)
+	require.Zero(t, composeImpl.released, "compose middlewares are shared by routes")
+}
+
 func TestMiddlewareResponseRewriteGate(t *testing.T) {
 	headerOpts := OptionsRaw{
 		"status_code": 418,
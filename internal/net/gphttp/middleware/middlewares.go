@@ -38,9 +38,12 @@ var allMiddlewares = map[string]*Middleware{
 	"cloudflarerealip": CloudflareRealIP,
 
 	"cidrwhitelist": CIDRWhiteList,
+	"clientcert":    ClientCert,
 	"ratelimit":     RateLimiter,
 
 	"hcaptcha": HCaptcha,
+
+	"wasm": WASM,
 }
 
 var (
@@ -77,8 +80,10 @@ func LoadComposeFiles() {
 			name = strutils.ToLowerNoSnake(name)
 			if _, ok := allMiddlewares[name]; ok {
 				errs.AddSubject(ErrMiddlewareAlreadyExists, name)
+				m.Release()
 				continue
 			}
+			m.shared = true
 			allMiddlewares[name] = m
 			log.Info().
 				Str("src", path.Base(defFile)).
@@ -96,8 +101,10 @@ func LoadComposeFiles() {
 			name = strutils.ToLowerNoSnake(name)
 			if _, ok := allMiddlewares[name]; ok {
 				// already loaded above
+				m.Release()
 				continue
 			}
+			m.shared = true
 			allMiddlewares[name] = m
 			log.Info().
 				Str("src", path.Base(defFile)).
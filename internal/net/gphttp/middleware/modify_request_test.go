@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"slices"
 	"testing"
 
+	"github.com/yusing/godoxy/internal/route/routes"
 	expect "github.com/yusing/goutils/testing"
 )
 
@@ -142,3 +144,9 @@ func TestModifyRequest(t *testing.T) {
 		}
 	})
 }
+
+func TestModifyRequestRequestVars(t *testing.T) {
+	req := routes.WithRouteContext(httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	routes.SetRequestVar(req, "tenant", "acme")
+	expect.Equal(t, varReplace(req, nil, "$var(tenant)/$var(unset)"), "acme/")
+}
@@ -1,12 +1,15 @@
 package middleware
 
 import (
+	"crypto/x509"
 	"net"
 	"net/http"
 	"regexp"
 	"strconv"
 	"strings"
 
+	"github.com/yusing/godoxy/internal/maxmind"
+	"github.com/yusing/godoxy/internal/net/clientcert"
 	"github.com/yusing/godoxy/internal/route/routes"
 )
 
@@ -19,6 +22,7 @@ var (
 	reArg        = regexp.MustCompile(`\$arg\([\w-_]+\)`)
 	reReqHeader  = regexp.MustCompile(`\$header\([\w-]+\)`)
 	reRespHeader = regexp.MustCompile(`\$resp_header\([\w-]+\)`)
+	reReqVar     = regexp.MustCompile(`\$var\([\w-]+\)`) // set by the rules setvar command
 	reStatic     = regexp.MustCompile(`\$[\w_]+`)
 )
 
@@ -38,6 +42,19 @@ const (
 	VarRemotePort         = "$remote_port"
 	VarRemoteAddr         = "$remote_addr"
 
+	VarTLSClientSubject     = "$tls_client_subject"
+	VarTLSClientIssuer      = "$tls_client_issuer"
+	VarTLSClientSAN         = "$tls_client_san"
+	VarTLSClientFingerprint = "$tls_client_fingerprint"
+	VarTLSClientSerial      = "$tls_client_serial"
+	VarTLSClientCert        = "$tls_client_cert"
+
+	VarGeoCountry   = "$geo_country"
+	VarGeoContinent = "$geo_continent"
+	VarGeoCity      = "$geo_city"
+	VarGeoASN       = "$geo_asn"
+	VarGeoTimeZone  = "$geo_tz"
+
 	VarUpstreamName   = "$upstream_name"
 	VarUpstreamScheme = "$upstream_scheme"
 	VarUpstreamHost   = "$upstream_host"
@@ -107,13 +124,24 @@ var staticReqVarSubsMap = map[string]reqVarGetter{
 		}
 		return ""
 	},
-	VarRemoteAddr:     func(req *http.Request) string { return req.RemoteAddr },
-	VarUpstreamName:   routes.TryGetUpstreamName,
-	VarUpstreamScheme: routes.TryGetUpstreamScheme,
-	VarUpstreamHost:   routes.TryGetUpstreamHost,
-	VarUpstreamPort:   routes.TryGetUpstreamPort,
-	VarUpstreamAddr:   routes.TryGetUpstreamAddr,
-	VarUpstreamURL:    routes.TryGetUpstreamURL,
+	VarRemoteAddr:           func(req *http.Request) string { return req.RemoteAddr },
+	VarTLSClientSubject:     clientCertVar(clientcert.Subject),
+	VarTLSClientIssuer:      clientCertVar(clientcert.Issuer),
+	VarTLSClientSAN:         clientCertVar(func(cert *x509.Certificate) string { return strings.Join(clientcert.SANs(cert), ",") }),
+	VarTLSClientFingerprint: clientCertVar(clientcert.Fingerprint),
+	VarTLSClientSerial:      clientCertVar(clientcert.Serial),
+	VarTLSClientCert:        clientCertVar(clientcert.EscapedPEM),
+	VarGeoCountry:           maxmind.RequestCountry,
+	VarGeoContinent:         maxmind.RequestContinent,
+	VarGeoCity:              maxmind.RequestCityName,
+	VarGeoASN:               maxmind.RequestASNumber,
+	VarGeoTimeZone:          maxmind.RequestTimeZone,
+	VarUpstreamName:         routes.TryGetUpstreamName,
+	VarUpstreamScheme:       routes.TryGetUpstreamScheme,
+	VarUpstreamHost:         routes.TryGetUpstreamHost,
+	VarUpstreamPort:         routes.TryGetUpstreamPort,
+	VarUpstreamAddr:         routes.TryGetUpstreamAddr,
+	VarUpstreamURL:          routes.TryGetUpstreamURL,
 }
 
 var staticRespVarSubsMap = map[string]respVarGetter{
@@ -122,6 +150,16 @@ var staticRespVarSubsMap = map[string]respVarGetter{
 	VarRespStatusCode:  func(resp *http.Response) string { return strconv.Itoa(resp.StatusCode) },
 }
 
+func clientCertVar(get func(cert *x509.Certificate) string) reqVarGetter {
+	return func(req *http.Request) string {
+		cert := clientcert.FromRequest(req)
+		if cert == nil {
+			return ""
+		}
+		return get(cert)
+	}
+}
+
 func varReplace(req *http.Request, resp *http.Response, s string) string {
 	if req != nil {
 		// Replace query parameters
@@ -140,6 +178,12 @@ func varReplace(req *http.Request, resp *http.Response, s string) string {
 			header := http.CanonicalHeaderKey(match[8 : len(match)-1])
 			return req.Header.Get(header)
 		})
+
+		// Replace request variables
+		s = reReqVar.ReplaceAllStringFunc(s, func(match string) string {
+			value, _ := routes.RequestVar(req, match[5:len(match)-1])
+			return value
+		})
 	}
 
 	if resp != nil {
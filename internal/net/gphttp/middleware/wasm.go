@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"runtime"
+	"sync"
+
+	"github.com/yusing/godoxy/internal/net/gphttp/middleware/wasm"
+)
+
+type wasmMiddleware struct {
+	wasm.Config
+
+	plugin        *wasm.Plugin
+	releasePlugin func()
+}
+
+var WASM = NewMiddleware[wasmMiddleware]()
+
+// setup implements MiddlewareWithSetup.
+func (m *wasmMiddleware) setup() {
+	m.Config = wasm.DefaultConfig
+}
+
+// finalize implements MiddlewareFinalizerWithError.
+func (m *wasmMiddleware) finalize() (err error) {
+	m.plugin, err = wasm.Load(&m.Config)
+	if err != nil {
+		return err
+	}
+	m.releasePlugin = sync.OnceFunc(m.plugin.Release)
+	// routes release their middlewares when removed,
+	// the ones never served (e.g. excluded routes and validated configs) are released when collected.
+	runtime.AddCleanup(m, func(release func()) { release() }, m.releasePlugin)
+	return nil
+}
+
+// release implements MiddlewareWithRelease.
+func (m *wasmMiddleware) release() {
+	m.releasePlugin()
+}
+
+func (*wasmMiddleware) isBodyResponseModifier() {}
+
+// before implements RequestModifier.
+func (m *wasmMiddleware) before(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	return m.plugin.OnRequest(w, r)
+}
+
+// modifyResponse implements ResponseModifier.
+func (m *wasmMiddleware) modifyResponse(resp *http.Response) error {
+	return m.plugin.OnResponse(resp)
+}
@@ -0,0 +1,73 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// abi is the interface between the host and a module.
+type abi interface {
+	// init prepares a new instance, e.g. creates the proxy-wasm root context.
+	init(ctx context.Context, inst *instance) error
+	onRequest(ctx context.Context, inst *instance, ex *exchange) error
+	onResponse(ctx context.Context, inst *instance, ex *exchange) error
+	// done is called when the exchange ends, the instance is not broken.
+	done(ctx context.Context, inst *instance, ex *exchange)
+	hasResponseHooks() bool
+}
+
+var errUnsupportedProxyWasmVersion = errors.New("unsupported proxy-wasm ABI version, expect 0.2.0 or 0.2.1")
+
+func detectABI(compiled wazero.CompiledModule) (abi, error) {
+	exports := compiled.ExportedFunctions()
+	has := func(name string) bool {
+		_, ok := exports[name]
+		return ok
+	}
+	switch {
+	case has("proxy_abi_version_0_2_1"), has("proxy_abi_version_0_2_0"):
+		return newProxyWasmABI(has)
+	case has("proxy_abi_version_0_1_0"):
+		return nil, errUnsupportedProxyWasmVersion
+	case has(godoxyOnRequest), has(godoxyOnResponse):
+		return &godoxyABI{onResponseHook: has(godoxyOnResponse)}, nil
+	}
+	return nil, ErrUnknownABI
+}
+
+// instantiateHostModules defines the host functions of all ABIs in the runtime.
+func instantiateHostModules(ctx context.Context, rt wazero.Runtime) error {
+	if _, err := exportFuncs(rt.NewHostModuleBuilder(godoxyHostModule), godoxyHostFuncs).Instantiate(ctx); err != nil {
+		return err
+	}
+	_, err := exportFuncs(rt.NewHostModuleBuilder(proxyWasmHostModule), proxyWasmHostFuncs).Instantiate(ctx)
+	return err
+}
+
+func exportFuncs(b wazero.HostModuleBuilder, funcs map[string]any) wazero.HostModuleBuilder {
+	for name, fn := range funcs {
+		b.NewFunctionBuilder().WithFunc(fn).Export(name)
+	}
+	return b
+}
+
+// readBytes returns a copy of the guest memory, the memory may be reused after the call.
+func readBytes(m api.Module, ptr, size uint32) ([]byte, bool) {
+	b, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(b), true
+}
+
+func readString(m api.Module, ptr, size uint32) (string, bool) {
+	b, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return "", false
+	}
+	return string(b), true
+}
@@ -0,0 +1,202 @@
+package wasm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/tetratelabs/wazero/api"
+)
+
+// The GoDoxy ABI is a smaller alternative to proxy-wasm, see README.md.
+//
+// Modules export godoxy_on_request and/or godoxy_on_response without params and results,
+// and call the functions of the "godoxy" host module. Strings are passed as pointer and length,
+// outputs are written to a buffer of the module and return their length, or -1 when not found.
+// Nothing is written when the buffer is too small, so the module can retry with a larger one.
+const (
+	godoxyHostModule = "godoxy"
+	godoxyOnRequest  = "godoxy_on_request"
+	godoxyOnResponse = "godoxy_on_response"
+
+	godoxyKindRequest  = 0
+	godoxyKindResponse = 1
+
+	godoxyNotFound = -1
+)
+
+type godoxyABI struct {
+	onResponseHook bool
+}
+
+var errInvalidMemoryAccess = errors.New("invalid memory access")
+
+func (*godoxyABI) init(context.Context, *instance) error { return nil }
+
+func (*godoxyABI) onRequest(ctx context.Context, inst *instance, _ *exchange) error {
+	_, err := inst.call(ctx, godoxyOnRequest)
+	return err
+}
+
+func (*godoxyABI) onResponse(ctx context.Context, inst *instance, _ *exchange) error {
+	_, err := inst.call(ctx, godoxyOnResponse)
+	return err
+}
+
+func (*godoxyABI) done(context.Context, *instance, *exchange) {}
+
+func (abi *godoxyABI) hasResponseHooks() bool { return abi.onResponseHook }
+
+var godoxyHostFuncs = map[string]any{
+	"log": func(ctx context.Context, m api.Module, level, ptr, size uint32) {
+		var lvl zerolog.Level
+		switch level {
+		case 0:
+			lvl = zerolog.DebugLevel
+		case 1:
+			lvl = zerolog.InfoLevel
+		case 2:
+			lvl = zerolog.WarnLevel
+		default:
+			lvl = zerolog.ErrorLevel
+		}
+		instanceFrom(ctx).mod.plugin.logger().WithLevel(lvl).Msg(mustReadString(m, ptr, size))
+	},
+	"get_config": func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return writeOut(m, instanceFrom(ctx).mod.plugin.config, buf, bufLen)
+	},
+	"get_method": func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return writeOut(m, []byte(godoxyExchange(ctx).req.Method), buf, bufLen)
+	},
+	"set_method": func(ctx context.Context, m api.Module, ptr, size uint32) {
+		godoxyExchange(ctx).req.Method = mustReadString(m, ptr, size)
+	},
+	"get_uri": func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return writeOut(m, []byte(godoxyExchange(ctx).req.URL.RequestURI()), buf, bufLen)
+	},
+	"set_uri": func(ctx context.Context, m api.Module, ptr, size uint32) int32 {
+		if !godoxyExchange(ctx).setURI(mustReadString(m, ptr, size)) {
+			return godoxyNotFound
+		}
+		return 0
+	},
+	"get_source_addr": func(ctx context.Context, m api.Module, buf, bufLen uint32) int32 {
+		return writeOut(m, []byte(godoxyExchange(ctx).req.RemoteAddr), buf, bufLen)
+	},
+	"get_header": func(ctx context.Context, m api.Module, kind, namePtr, nameLen, buf, bufLen uint32) int32 {
+		values := godoxyHeader(ctx, kind).Values(mustReadString(m, namePtr, nameLen))
+		if len(values) == 0 {
+			return godoxyNotFound
+		}
+		return writeOut(m, []byte(strings.Join(values, "\x00")), buf, bufLen)
+	},
+	"get_header_names": func(ctx context.Context, m api.Module, kind, buf, bufLen uint32) int32 {
+		h := godoxyHeader(ctx, kind)
+		names := make([]string, 0, len(h))
+		for name := range h {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return writeOut(m, []byte(strings.Join(names, "\x00")), buf, bufLen)
+	},
+	"set_header": func(ctx context.Context, m api.Module, kind, namePtr, nameLen, valuePtr, valueLen uint32) {
+		godoxyHeader(ctx, kind).Set(mustReadString(m, namePtr, nameLen), mustReadString(m, valuePtr, valueLen))
+	},
+	"add_header": func(ctx context.Context, m api.Module, kind, namePtr, nameLen, valuePtr, valueLen uint32) {
+		godoxyHeader(ctx, kind).Add(mustReadString(m, namePtr, nameLen), mustReadString(m, valuePtr, valueLen))
+	},
+	"remove_header": func(ctx context.Context, m api.Module, kind, namePtr, nameLen uint32) {
+		godoxyHeader(ctx, kind).Del(mustReadString(m, namePtr, nameLen))
+	},
+	"get_body": func(ctx context.Context, m api.Module, kind, buf, bufLen uint32) int32 {
+		ex := godoxyExchange(ctx)
+		var data []byte
+		var ok bool
+		if kind == godoxyKindRequest {
+			data, ok = ex.requestBody()
+		} else {
+			data, ok = ex.responseBody()
+		}
+		if !ok {
+			return godoxyNotFound
+		}
+		return writeOut(m, data, buf, bufLen)
+	},
+	"set_body": func(ctx context.Context, m api.Module, kind, ptr, size uint32) int32 {
+		ex := godoxyExchange(ctx)
+		data := mustReadBytes(m, ptr, size)
+		var ok bool
+		if kind == godoxyKindRequest {
+			ok = ex.setRequestBody(data)
+		} else {
+			ok = ex.setResponseBody(data)
+		}
+		if !ok {
+			return godoxyNotFound
+		}
+		return 0
+	},
+	"get_status": func(ctx context.Context) int32 {
+		if ex := godoxyExchange(ctx); ex.resp != nil {
+			return int32(ex.resp.StatusCode)
+		}
+		return 0
+	},
+	"set_status": func(ctx context.Context, status uint32) {
+		if ex := godoxyExchange(ctx); ex.resp != nil && validStatus(status) {
+			ex.resp.StatusCode = int(status)
+		}
+	},
+	"send_response": func(ctx context.Context, m api.Module, status, bodyPtr, bodyLen uint32) {
+		if !validStatus(status) {
+			panic(errInvalidStatus)
+		}
+		godoxyExchange(ctx).sendResponse(int(status), nil, mustReadBytes(m, bodyPtr, bodyLen))
+	},
+}
+
+var errInvalidStatus = errors.New("invalid status code")
+
+func validStatus(status uint32) bool {
+	return status >= 100 && status <= 999
+}
+
+func godoxyExchange(ctx context.Context) *exchange {
+	return instanceFrom(ctx).ex
+}
+
+func godoxyHeader(ctx context.Context, kind uint32) http.Header {
+	ex := godoxyExchange(ctx)
+	if kind == godoxyKindRequest {
+		return ex.req.Header
+	}
+	return ex.responseHeader()
+}
+
+// writeOut writes data to the buffer when it fits and returns its length.
+func writeOut(m api.Module, data []byte, buf, bufLen uint32) int32 {
+	if len(data) > 0 && uint32(len(data)) <= bufLen && !m.Memory().Write(buf, data) {
+		panic(errInvalidMemoryAccess)
+	}
+	return int32(len(data))
+}
+
+// mustReadString and mustReadBytes trap the module on invalid memory access.
+func mustReadString(m api.Module, ptr, size uint32) string {
+	s, ok := readString(m, ptr, size)
+	if !ok {
+		panic(errInvalidMemoryAccess)
+	}
+	return s
+}
+
+func mustReadBytes(m api.Module, ptr, size uint32) []byte {
+	b, ok := readBytes(m, ptr, size)
+	if !ok {
+		panic(errInvalidMemoryAccess)
+	}
+	return b
+}
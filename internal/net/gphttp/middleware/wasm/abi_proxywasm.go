@@ -0,0 +1,848 @@
+package wasm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/yusing/godoxy/internal/route/routes"
+)
+
+// proxy-wasm ABI 0.2.x for HTTP filters, https://github.com/proxy-wasm/spec.
+//
+// Ticks, HTTP and gRPC calls, foreign functions and shared queues are not supported,
+// their host functions return Unimplemented.
+const (
+	proxyWasmHostModule = "env"
+	proxyRootContextID  = 1
+)
+
+// proxy-wasm status codes.
+const (
+	proxyOK                  = 0
+	proxyNotFound            = 1
+	proxyBadArgument         = 2
+	proxyInvalidMemoryAccess = 6
+	proxyCasMismatch         = 8
+	proxyInternalFailure     = 10
+	proxyUnimplemented       = 12
+)
+
+// proxy-wasm buffer types.
+const (
+	proxyBufferRequestBody         = 0
+	proxyBufferResponseBody        = 1
+	proxyBufferVMConfiguration     = 6
+	proxyBufferPluginConfiguration = 7
+)
+
+// proxy-wasm map types.
+const (
+	proxyMapRequestHeaders   = 0
+	proxyMapRequestTrailers  = 1
+	proxyMapResponseHeaders  = 2
+	proxyMapResponseTrailers = 3
+)
+
+type proxyWasmABI struct {
+	malloc                 string
+	onRequestBody          bool
+	onResponseBody         bool
+	onLog                  bool
+	onVMStart, onConfigure bool
+}
+
+var (
+	errProxyWasmNoMalloc = errors.New("proxy-wasm module does not export proxy_on_memory_allocate or malloc")
+	errProxyWasmRejected = errors.New("proxy-wasm module rejected the plugin start or configuration")
+)
+
+func newProxyWasmABI(has func(name string) bool) (*proxyWasmABI, error) {
+	abi := &proxyWasmABI{
+		onRequestBody:  has("proxy_on_request_body"),
+		onResponseBody: has("proxy_on_response_body"),
+		onLog:          has("proxy_on_log"),
+		onVMStart:      has("proxy_on_vm_start"),
+		onConfigure:    has("proxy_on_configure"),
+	}
+	switch {
+	case has("proxy_on_memory_allocate"):
+		abi.malloc = "proxy_on_memory_allocate"
+	case has("malloc"):
+		abi.malloc = "malloc"
+	default:
+		return nil, errProxyWasmNoMalloc
+	}
+	return abi, nil
+}
+
+// init creates the root context, starts the plugin and passes the plugin configuration.
+func (abi *proxyWasmABI) init(ctx context.Context, inst *instance) error {
+	if _, err := inst.call(ctx, "proxy_on_context_create", proxyRootContextID, 0); err != nil {
+		return err
+	}
+	if abi.onVMStart {
+		res, err := inst.call(ctx, "proxy_on_vm_start", proxyRootContextID, 0)
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 || api.DecodeU32(res[0]) == 0 {
+			return errProxyWasmRejected
+		}
+	}
+	if abi.onConfigure {
+		res, err := inst.call(ctx, "proxy_on_configure", proxyRootContextID, uint64(len(inst.mod.plugin.config)))
+		if err != nil {
+			return err
+		}
+		if len(res) == 0 || api.DecodeU32(res[0]) == 0 {
+			return errProxyWasmRejected
+		}
+	}
+	return nil
+}
+
+// createContext creates the http context of the exchange.
+func (abi *proxyWasmABI) createContext(ctx context.Context, inst *instance, ex *exchange) error {
+	if ex.contextID != 0 {
+		return nil
+	}
+	ex.contextID = inst.nextContextID
+	inst.nextContextID++
+	_, err := inst.call(ctx, "proxy_on_context_create", uint64(ex.contextID), proxyRootContextID)
+	return err
+}
+
+// onRequest calls proxy_on_request_headers and proxy_on_request_body with the whole body,
+// stream actions are ignored as there is nothing to pause for, the request stops when a local response is sent.
+func (abi *proxyWasmABI) onRequest(ctx context.Context, inst *instance, ex *exchange) error {
+	if err := abi.createContext(ctx, inst, ex); err != nil {
+		return err
+	}
+	hasBody := abi.onRequestBody && ex.req.Body != nil && ex.req.Body != http.NoBody && ex.req.ContentLength != 0
+	pairs, _ := ex.headerPairs(proxyMapRequestHeaders)
+	if _, err := inst.call(ctx, "proxy_on_request_headers", uint64(ex.contextID), uint64(len(pairs)), boolParam(!hasBody)); err != nil {
+		return err
+	}
+	if ex.local != nil || !hasBody {
+		return nil
+	}
+	if body, ok := ex.requestBody(); ok {
+		if _, err := inst.call(ctx, "proxy_on_request_body", uint64(ex.contextID), uint64(len(body)), boolParam(true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (abi *proxyWasmABI) onResponse(ctx context.Context, inst *instance, ex *exchange) error {
+	if err := abi.createContext(ctx, inst, ex); err != nil {
+		return err
+	}
+	hasBody := abi.onResponseBody && ex.resp.Body != nil && ex.resp.Body != http.NoBody && ex.resp.ContentLength != 0
+	pairs, _ := ex.headerPairs(proxyMapResponseHeaders)
+	if _, err := inst.call(ctx, "proxy_on_response_headers", uint64(ex.contextID), uint64(len(pairs)), boolParam(!hasBody)); err != nil {
+		return err
+	}
+	if ex.local != nil || !hasBody {
+		return nil
+	}
+	if body, ok := ex.responseBody(); ok {
+		if _, err := inst.call(ctx, "proxy_on_response_body", uint64(ex.contextID), uint64(len(body)), boolParam(true)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// done calls proxy_on_log, proxy_on_done and proxy_on_delete to end the http context.
+func (abi *proxyWasmABI) done(ctx context.Context, inst *instance, ex *exchange) {
+	if ex.contextID == 0 {
+		return
+	}
+	id := uint64(ex.contextID)
+	if abi.onLog {
+		if _, err := inst.call(ctx, "proxy_on_log", id); err != nil {
+			return
+		}
+	}
+	if _, err := inst.call(ctx, "proxy_on_done", id); err != nil {
+		return
+	}
+	inst.call(ctx, "proxy_on_delete", id) //nolint:errcheck // the instance is marked broken on failure
+}
+
+func (*proxyWasmABI) hasResponseHooks() bool { return true }
+
+func boolParam(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// returnBytes allocates data in the module and writes its pointer and size to ptrPtr and sizePtr.
+func returnBytes(ctx context.Context, m api.Module, data []byte, ptrPtr, sizePtr uint32) uint32 {
+	var ptr uint32
+	if len(data) > 0 {
+		abi := instanceFrom(ctx).mod.abi.(*proxyWasmABI)
+		res, err := m.ExportedFunction(abi.malloc).Call(ctx, uint64(len(data)))
+		if err != nil || len(res) == 0 {
+			return proxyInternalFailure
+		}
+		ptr = api.DecodeU32(res[0])
+		if !m.Memory().Write(ptr, data) {
+			return proxyInvalidMemoryAccess
+		}
+	}
+	if !m.Memory().WriteUint32Le(ptrPtr, ptr) || !m.Memory().WriteUint32Le(sizePtr, uint32(len(data))) {
+		return proxyInvalidMemoryAccess
+	}
+	return proxyOK
+}
+
+func proxyExchange(ctx context.Context) *exchange {
+	return instanceFrom(ctx).ex
+}
+
+// encodePairs serializes header pairs: the number of pairs, the key and value sizes of each pair,
+// then the null terminated keys and values.
+func encodePairs(pairs [][2]string) []byte {
+	size := 4 + len(pairs)*8
+	for _, p := range pairs {
+		size += len(p[0]) + len(p[1]) + 2
+	}
+	b := make([]byte, 0, size)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(pairs)))
+	for _, p := range pairs {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(p[0])))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(p[1])))
+	}
+	for _, p := range pairs {
+		b = append(b, p[0]...)
+		b = append(b, 0)
+		b = append(b, p[1]...)
+		b = append(b, 0)
+	}
+	return b
+}
+
+func decodePairs(b []byte) ([][2]string, bool) {
+	if len(b) < 4 {
+		return nil, len(b) == 0
+	}
+	n := binary.LittleEndian.Uint32(b)
+	if uint64(n)*8 > uint64(len(b)-4) {
+		return nil, false
+	}
+	sizes, data := b[4:4+n*8], b[4+n*8:]
+	pairs := make([][2]string, n)
+	for i := range pairs {
+		for j := range 2 {
+			size := binary.LittleEndian.Uint32(sizes[i*8+j*4:])
+			if uint64(size)+1 > uint64(len(data)) {
+				return nil, false
+			}
+			pairs[i][j] = string(data[:size])
+			data = data[size+1:]
+		}
+	}
+	return pairs, true
+}
+
+// headerPairs returns the headers of the map type with lowercase names, including the HTTP/2 style pseudo headers.
+func (ex *exchange) headerPairs(mapType uint32) ([][2]string, uint32) {
+	if ex == nil { // root context
+		return nil, proxyNotFound
+	}
+	var pairs [][2]string
+	var h http.Header
+	switch mapType {
+	case proxyMapRequestHeaders:
+		r := ex.req
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		pairs = [][2]string{{":method", r.Method}, {":path", r.URL.RequestURI()}, {":authority", r.Host}, {":scheme", scheme}}
+		h = r.Header
+	case proxyMapResponseHeaders:
+		if ex.resp == nil {
+			return nil, proxyNotFound
+		}
+		pairs = [][2]string{{":status", strconv.Itoa(ex.resp.StatusCode)}}
+		h = ex.resp.Header
+	case proxyMapRequestTrailers, proxyMapResponseTrailers:
+		return nil, proxyOK // trailers are not supported, always empty
+	default:
+		return nil, proxyBadArgument
+	}
+	for k, values := range h {
+		k = strings.ToLower(k)
+		for _, v := range values {
+			pairs = append(pairs, [2]string{k, v})
+		}
+	}
+	return pairs, proxyOK
+}
+
+// headerValue returns the values of a header joined with commas.
+func (ex *exchange) headerValue(mapType uint32, key string) (string, uint32) {
+	pairs, status := ex.headerPairs(mapType)
+	if status != proxyOK {
+		return "", status
+	}
+	key = strings.ToLower(key)
+	var values []string
+	for _, p := range pairs {
+		if p[0] == key {
+			values = append(values, p[1])
+		}
+	}
+	if len(values) == 0 {
+		return "", proxyNotFound
+	}
+	return strings.Join(values, ","), proxyOK
+}
+
+// setHeader sets, adds or removes (when value is nil) a header, pseudo headers can be set but not removed.
+func (ex *exchange) setHeader(mapType uint32, key string, value *string, add bool) uint32 {
+	if ex == nil {
+		return proxyNotFound
+	}
+	var h http.Header
+	switch mapType {
+	case proxyMapRequestHeaders:
+		h = ex.req.Header
+	case proxyMapResponseHeaders:
+		if ex.resp == nil {
+			return proxyNotFound
+		}
+		h = ex.resp.Header
+	case proxyMapRequestTrailers, proxyMapResponseTrailers:
+		return proxyOK
+	default:
+		return proxyBadArgument
+	}
+	if strings.HasPrefix(key, ":") {
+		if value == nil {
+			return proxyOK
+		}
+		return ex.setPseudoHeader(key, *value)
+	}
+	switch {
+	case value == nil:
+		h.Del(key)
+	case add:
+		h.Add(key, *value)
+	default:
+		h.Set(key, *value)
+	}
+	return proxyOK
+}
+
+func (ex *exchange) setPseudoHeader(key, value string) uint32 {
+	switch key {
+	case ":method":
+		ex.req.Method = value
+	case ":path":
+		if !ex.setURI(value) {
+			return proxyBadArgument
+		}
+	case ":authority":
+		ex.req.Host = value
+	case ":status":
+		status, err := strconv.Atoi(value)
+		if err != nil || ex.resp == nil || !validStatus(uint32(status)) {
+			return proxyBadArgument
+		}
+		ex.resp.StatusCode = status
+	default:
+		return proxyBadArgument
+	}
+	return proxyOK
+}
+
+// property returns a property of the request, integers are 64-bit little endian as in Envoy.
+func (ex *exchange) property(path string) ([]byte, bool) {
+	if v, ok := ex.properties[path]; ok {
+		return v, true
+	}
+	r := ex.req
+	switch path {
+	case "request.path":
+		return []byte(r.URL.RequestURI()), true
+	case "request.url_path":
+		return []byte(r.URL.Path), true
+	case "request.query":
+		return []byte(r.URL.RawQuery), true
+	case "request.host":
+		return []byte(r.Host), true
+	case "request.method":
+		return []byte(r.Method), true
+	case "request.scheme":
+		if r.TLS != nil {
+			return []byte("https"), true
+		}
+		return []byte("http"), true
+	case "request.protocol":
+		return []byte(r.Proto), true
+	case "request.useragent":
+		return []byte(r.UserAgent()), true
+	case "request.referer":
+		return []byte(r.Referer()), true
+	case "source.address":
+		return []byte(r.RemoteAddr), true
+	case "source.port":
+		_, port, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			return nil, false
+		}
+		n, err := strconv.ParseInt(port, 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		return binary.LittleEndian.AppendUint64(nil, uint64(n)), true
+	case "response.code":
+		if ex.resp == nil {
+			return nil, false
+		}
+		return binary.LittleEndian.AppendUint64(nil, uint64(ex.resp.StatusCode)), true
+	case "xds.route_name":
+		name := routes.TryGetUpstreamName(r)
+		return []byte(name), name != ""
+	}
+	return nil, false
+}
+
+type (
+	sharedData struct {
+		mu     sync.Mutex
+		values map[string]*sharedValue
+	}
+	sharedValue struct {
+		data []byte
+		cas  uint32
+	}
+	metrics struct {
+		mu     sync.Mutex
+		ids    map[string]uint32
+		values []uint64
+	}
+)
+
+func (d *sharedData) get(key string) ([]byte, uint32, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.values[key]
+	if !ok {
+		return nil, 0, false
+	}
+	return v.data, v.cas, true
+}
+
+func (d *sharedData) set(key string, data []byte, cas uint32) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	v, ok := d.values[key]
+	if cas != 0 && (!ok || v.cas != cas) {
+		return false
+	}
+	if d.values == nil {
+		d.values = make(map[string]*sharedValue)
+	}
+	if !ok {
+		v = &sharedValue{}
+		d.values[key] = v
+	}
+	v.data = data
+	v.cas++
+	return true
+}
+
+func (m *metrics) define(name string) uint32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id, ok := m.ids[name]; ok {
+		return id
+	}
+	if m.ids == nil {
+		m.ids = make(map[string]uint32)
+	}
+	id := uint32(len(m.values))
+	m.ids[name] = id
+	m.values = append(m.values, 0)
+	return id
+}
+
+// update applies fn to the value of the metric, it reports false when the metric is not defined.
+func (m *metrics) update(id uint32, fn func(v uint64) uint64) (uint64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id >= uint32(len(m.values)) {
+		return 0, false
+	}
+	m.values[id] = fn(m.values[id])
+	return m.values[id], true
+}
+
+var proxyWasmHostFuncs = map[string]any{
+	"proxy_log": func(ctx context.Context, m api.Module, level, ptr, size uint32) uint32 {
+		msg, ok := readString(m, ptr, size)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		lvl := zerolog.ErrorLevel
+		if level < 4 {
+			lvl = zerolog.Level(level) - 1 // trace, debug, info, warn
+		}
+		instanceFrom(ctx).mod.plugin.logger().WithLevel(lvl).Msg(msg)
+		return proxyOK
+	},
+	"proxy_get_log_level": func(ctx context.Context, m api.Module, ptr uint32) uint32 {
+		level := uint32(min(max(zerolog.GlobalLevel()+1, 0), 4))
+		if !m.Memory().WriteUint32Le(ptr, level) {
+			return proxyInvalidMemoryAccess
+		}
+		return proxyOK
+	},
+	"proxy_get_current_time_nanoseconds": func(ctx context.Context, m api.Module, ptr uint32) uint32 {
+		if !m.Memory().WriteUint64Le(ptr, uint64(time.Now().UnixNano())) {
+			return proxyInvalidMemoryAccess
+		}
+		return proxyOK
+	},
+	"proxy_set_tick_period_milliseconds": func(uint32) uint32 {
+		return proxyUnimplemented
+	},
+
+	"proxy_get_buffer_bytes": func(ctx context.Context, m api.Module, bufferType, start, maxSize, ptrPtr, sizePtr uint32) uint32 {
+		data, status := proxyBuffer(ctx, bufferType)
+		if status != proxyOK {
+			return status
+		}
+		start = min(start, uint32(len(data)))
+		end := start + min(maxSize, uint32(len(data))-start)
+		return returnBytes(ctx, m, data[start:end], ptrPtr, sizePtr)
+	},
+	"proxy_get_buffer_status": func(ctx context.Context, m api.Module, bufferType, lengthPtr, flagsPtr uint32) uint32 {
+		data, status := proxyBuffer(ctx, bufferType)
+		if status != proxyOK {
+			return status
+		}
+		if !m.Memory().WriteUint32Le(lengthPtr, uint32(len(data))) || !m.Memory().WriteUint32Le(flagsPtr, 0) {
+			return proxyInvalidMemoryAccess
+		}
+		return proxyOK
+	},
+	// proxy_set_buffer_bytes replaces size bytes from start with the data, so start 0 and size 0 prepends,
+	// start beyond the end appends, and start 0 with a size beyond the end replaces the buffer.
+	"proxy_set_buffer_bytes": func(ctx context.Context, m api.Module, bufferType, start, size, dataPtr, dataSize uint32) uint32 {
+		data, ok := readBytes(m, dataPtr, dataSize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		ex := proxyExchange(ctx)
+		if ex == nil {
+			return proxyNotFound
+		}
+		var cur []byte
+		var set func([]byte) bool
+		switch bufferType {
+		case proxyBufferRequestBody:
+			cur, ok = ex.requestBody()
+			set = ex.setRequestBody
+		case proxyBufferResponseBody:
+			cur, ok = ex.responseBody()
+			set = ex.setResponseBody
+		default:
+			return proxyBadArgument
+		}
+		if !ok {
+			return proxyNotFound
+		}
+		start = min(start, uint32(len(cur)))
+		end := start + min(size, uint32(len(cur))-start)
+		buf := make([]byte, 0, len(cur)-int(end-start)+len(data))
+		buf = append(append(append(buf, cur[:start]...), data...), cur[end:]...)
+		set(buf)
+		return proxyOK
+	},
+
+	"proxy_get_header_map_pairs": func(ctx context.Context, m api.Module, mapType, ptrPtr, sizePtr uint32) uint32 {
+		pairs, status := proxyExchange(ctx).headerPairs(mapType)
+		if status != proxyOK {
+			return status
+		}
+		return returnBytes(ctx, m, encodePairs(pairs), ptrPtr, sizePtr)
+	},
+	"proxy_set_header_map_pairs": func(ctx context.Context, m api.Module, mapType, ptr, size uint32) uint32 {
+		b, ok := m.Memory().Read(ptr, size)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		pairs, ok := decodePairs(b)
+		if !ok {
+			return proxyBadArgument
+		}
+		ex := proxyExchange(ctx)
+		current, status := ex.headerPairs(mapType)
+		if status != proxyOK {
+			return status
+		}
+		for _, p := range current {
+			if !strings.HasPrefix(p[0], ":") {
+				ex.setHeader(mapType, p[0], nil, false)
+			}
+		}
+		for _, p := range pairs {
+			if status := ex.setHeader(mapType, p[0], &p[1], true); status != proxyOK {
+				return status
+			}
+		}
+		return proxyOK
+	},
+	"proxy_get_header_map_size": func(ctx context.Context, m api.Module, mapType, sizePtr uint32) uint32 {
+		pairs, status := proxyExchange(ctx).headerPairs(mapType)
+		if status != proxyOK {
+			return status
+		}
+		if !m.Memory().WriteUint32Le(sizePtr, uint32(len(encodePairs(pairs)))) {
+			return proxyInvalidMemoryAccess
+		}
+		return proxyOK
+	},
+	"proxy_get_header_map_value": func(ctx context.Context, m api.Module, mapType, keyPtr, keySize, ptrPtr, sizePtr uint32) uint32 {
+		key, ok := readString(m, keyPtr, keySize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		value, status := proxyExchange(ctx).headerValue(mapType, key)
+		if status != proxyOK {
+			return status
+		}
+		return returnBytes(ctx, m, []byte(value), ptrPtr, sizePtr)
+	},
+	"proxy_replace_header_map_value": func(ctx context.Context, m api.Module, mapType, keyPtr, keySize, valuePtr, valueSize uint32) uint32 {
+		return proxySetHeader(ctx, m, mapType, keyPtr, keySize, valuePtr, valueSize, false)
+	},
+	"proxy_add_header_map_value": func(ctx context.Context, m api.Module, mapType, keyPtr, keySize, valuePtr, valueSize uint32) uint32 {
+		return proxySetHeader(ctx, m, mapType, keyPtr, keySize, valuePtr, valueSize, true)
+	},
+	"proxy_remove_header_map_value": func(ctx context.Context, m api.Module, mapType, keyPtr, keySize uint32) uint32 {
+		key, ok := readString(m, keyPtr, keySize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		return proxyExchange(ctx).setHeader(mapType, key, nil, false)
+	},
+
+	"proxy_get_property": func(ctx context.Context, m api.Module, pathPtr, pathSize, ptrPtr, sizePtr uint32) uint32 {
+		path, ok := readString(m, pathPtr, pathSize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		ex := proxyExchange(ctx)
+		if ex == nil {
+			return proxyNotFound
+		}
+		value, ok := ex.property(propertyPath(path))
+		if !ok {
+			return proxyNotFound
+		}
+		return returnBytes(ctx, m, value, ptrPtr, sizePtr)
+	},
+	"proxy_set_property": func(ctx context.Context, m api.Module, pathPtr, pathSize, valuePtr, valueSize uint32) uint32 {
+		path, ok := readString(m, pathPtr, pathSize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		value, ok := readBytes(m, valuePtr, valueSize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		ex := proxyExchange(ctx)
+		if ex == nil {
+			return proxyNotFound
+		}
+		if ex.properties == nil {
+			ex.properties = make(map[string][]byte)
+		}
+		ex.properties[propertyPath(path)] = value
+		return proxyOK
+	},
+
+	"proxy_send_local_response": func(ctx context.Context, m api.Module, status, detailsPtr, detailsSize, bodyPtr, bodySize, headersPtr, headersSize uint32, grpcStatus int32) uint32 {
+		if !validStatus(status) {
+			return proxyBadArgument
+		}
+		body, ok := readBytes(m, bodyPtr, bodySize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		b, ok := m.Memory().Read(headersPtr, headersSize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		pairs, ok := decodePairs(b)
+		if !ok {
+			return proxyBadArgument
+		}
+		ex := proxyExchange(ctx)
+		if ex == nil {
+			return proxyNotFound
+		}
+		header := make(http.Header, len(pairs))
+		for _, p := range pairs {
+			header.Add(p[0], p[1])
+		}
+		ex.sendResponse(int(status), header, body)
+		return proxyOK
+	},
+	"proxy_continue_stream":   func(uint32) uint32 { return proxyOK },
+	"proxy_close_stream":      func(uint32) uint32 { return proxyOK },
+	"proxy_continue_request":  func() uint32 { return proxyOK },
+	"proxy_continue_response": func() uint32 { return proxyOK },
+	"proxy_clear_route_cache": func() uint32 { return proxyOK },
+	"proxy_set_effective_context": func(uint32) uint32 {
+		return proxyOK
+	},
+	"proxy_done": func() uint32 { return proxyOK },
+
+	"proxy_get_shared_data": func(ctx context.Context, m api.Module, keyPtr, keySize, ptrPtr, sizePtr, casPtr uint32) uint32 {
+		key, ok := readString(m, keyPtr, keySize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		data, cas, ok := instanceFrom(ctx).mod.plugin.shared.get(key)
+		if !ok {
+			return proxyNotFound
+		}
+		if !m.Memory().WriteUint32Le(casPtr, cas) {
+			return proxyInvalidMemoryAccess
+		}
+		return returnBytes(ctx, m, data, ptrPtr, sizePtr)
+	},
+	"proxy_set_shared_data": func(ctx context.Context, m api.Module, keyPtr, keySize, valuePtr, valueSize, cas uint32) uint32 {
+		key, ok := readString(m, keyPtr, keySize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		value, ok := readBytes(m, valuePtr, valueSize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		if !instanceFrom(ctx).mod.plugin.shared.set(key, value, cas) {
+			return proxyCasMismatch
+		}
+		return proxyOK
+	},
+
+	"proxy_define_metric": func(ctx context.Context, m api.Module, metricType, namePtr, nameSize, idPtr uint32) uint32 {
+		name, ok := readString(m, namePtr, nameSize)
+		if !ok {
+			return proxyInvalidMemoryAccess
+		}
+		id := instanceFrom(ctx).mod.plugin.metrics.define(fmt.Sprintf("%d:%s", metricType, name))
+		if !m.Memory().WriteUint32Le(idPtr, id) {
+			return proxyInvalidMemoryAccess
+		}
+		return proxyOK
+	},
+	"proxy_increment_metric": func(ctx context.Context, id uint32, offset int64) uint32 {
+		if _, ok := instanceFrom(ctx).mod.plugin.metrics.update(id, func(v uint64) uint64 { return uint64(int64(v) + offset) }); !ok {
+			return proxyNotFound
+		}
+		return proxyOK
+	},
+	"proxy_record_metric": func(ctx context.Context, id uint32, value uint64) uint32 {
+		if _, ok := instanceFrom(ctx).mod.plugin.metrics.update(id, func(uint64) uint64 { return value }); !ok {
+			return proxyNotFound
+		}
+		return proxyOK
+	},
+	"proxy_get_metric": func(ctx context.Context, m api.Module, id, resultPtr uint32) uint32 {
+		v, ok := instanceFrom(ctx).mod.plugin.metrics.update(id, func(v uint64) uint64 { return v })
+		if !ok {
+			return proxyNotFound
+		}
+		if !m.Memory().WriteUint64Le(resultPtr, v) {
+			return proxyInvalidMemoryAccess
+		}
+		return proxyOK
+	},
+
+	"proxy_http_call": func(upstreamPtr, upstreamSize, headersPtr, headersSize, bodyPtr, bodySize, trailersPtr, trailersSize, timeout, tokenPtr uint32) uint32 {
+		return proxyUnimplemented
+	},
+	"proxy_call_foreign_function": func(namePtr, nameSize, argsPtr, argsSize, ptrPtr, sizePtr uint32) uint32 {
+		return proxyUnimplemented
+	},
+	"proxy_register_shared_queue": func(namePtr, nameSize, tokenPtr uint32) uint32 {
+		return proxyUnimplemented
+	},
+	"proxy_resolve_shared_queue": func(vmIDPtr, vmIDSize, namePtr, nameSize, tokenPtr uint32) uint32 {
+		return proxyUnimplemented
+	},
+	"proxy_dequeue_shared_queue": func(token, ptrPtr, sizePtr uint32) uint32 {
+		return proxyUnimplemented
+	},
+	"proxy_enqueue_shared_queue": func(token, dataPtr, dataSize uint32) uint32 {
+		return proxyUnimplemented
+	},
+}
+
+// proxyBuffer returns the buffer of the buffer type.
+func proxyBuffer(ctx context.Context, bufferType uint32) ([]byte, uint32) {
+	inst := instanceFrom(ctx)
+	switch bufferType {
+	case proxyBufferVMConfiguration:
+		return nil, proxyOK
+	case proxyBufferPluginConfiguration:
+		return inst.mod.plugin.config, proxyOK
+	}
+	ex := inst.ex
+	if ex == nil {
+		return nil, proxyNotFound
+	}
+	var data []byte
+	var ok bool
+	switch bufferType {
+	case proxyBufferRequestBody:
+		data, ok = ex.requestBody()
+	case proxyBufferResponseBody:
+		data, ok = ex.responseBody()
+	default:
+		return nil, proxyBadArgument
+	}
+	if !ok {
+		return nil, proxyNotFound
+	}
+	return data, proxyOK
+}
+
+func proxySetHeader(ctx context.Context, m api.Module, mapType, keyPtr, keySize, valuePtr, valueSize uint32, add bool) uint32 {
+	key, ok := readString(m, keyPtr, keySize)
+	if !ok {
+		return proxyInvalidMemoryAccess
+	}
+	value, ok := readString(m, valuePtr, valueSize)
+	if !ok {
+		return proxyInvalidMemoryAccess
+	}
+	return proxyExchange(ctx).setHeader(mapType, key, &value, add)
+}
+
+// propertyPath converts a null separated property path to a dotted one, e.g. request\0path to request.path.
+func propertyPath(path string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(path, "\x00"), "\x00", ".")
+}
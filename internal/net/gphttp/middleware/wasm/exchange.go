@@ -0,0 +1,181 @@
+package wasm
+
+import (
+	"bytes"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxBodySize is the largest body buffered for plugins, same as response modifying middlewares.
+const maxBodySize = 4 * 1024 * 1024 // 4MB
+
+type (
+	// exchange is the request and response handled by an instance.
+	exchange struct {
+		req  *http.Request
+		resp *http.Response // nil in the request phase
+
+		reqBody, respBody *body
+
+		local       *localResponse // set when the plugin sends a response
+		localHeader http.Header    // response headers set in the request phase, sent with the local response
+
+		contextID  uint32            // proxy-wasm http context, 0 when not created
+		properties map[string][]byte // set by proxy_set_property
+	}
+	body struct {
+		data    []byte
+		ok      bool // read and within maxBodySize
+		changed bool
+	}
+	localResponse struct {
+		status int
+		header http.Header
+		body   []byte
+	}
+)
+
+func newExchange(r *http.Request) *exchange {
+	return &exchange{req: r}
+}
+
+// requestBody returns the request body, it is read on first call.
+// It returns false without consuming the body when it is larger than maxBodySize.
+func (ex *exchange) requestBody() ([]byte, bool) {
+	if ex.reqBody == nil {
+		r := ex.req
+		ex.reqBody = &body{}
+		if r.Body == nil || r.Body == http.NoBody {
+			ex.reqBody.ok = true
+		} else if r.ContentLength <= maxBodySize {
+			ex.reqBody.data, ex.reqBody.ok = readBody(r.Body, func(rc io.ReadCloser) { r.Body = rc })
+		}
+	}
+	return ex.reqBody.data, ex.reqBody.ok
+}
+
+// responseBody returns the response body in the response phase, it is read on first call.
+func (ex *exchange) responseBody() ([]byte, bool) {
+	if ex.resp == nil {
+		return nil, false
+	}
+	if ex.respBody == nil {
+		resp := ex.resp
+		ex.respBody = &body{}
+		if resp.Body == nil || resp.Body == http.NoBody {
+			ex.respBody.ok = true
+		} else if resp.ContentLength <= maxBodySize {
+			ex.respBody.data, ex.respBody.ok = readBody(resp.Body, func(rc io.ReadCloser) { resp.Body = rc })
+		}
+	}
+	return ex.respBody.data, ex.respBody.ok
+}
+
+// readBody reads up to maxBodySize, when it is larger the read part is put back with replace.
+func readBody(rc io.ReadCloser, replace func(io.ReadCloser)) ([]byte, bool) {
+	data, err := io.ReadAll(io.LimitReader(rc, maxBodySize+1))
+	if err != nil || len(data) > maxBodySize {
+		replace(struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), rc), rc})
+		return nil, false
+	}
+	rc.Close()
+	replace(io.NopCloser(bytes.NewReader(data)))
+	return data, true
+}
+
+// setRequestBody replaces the request body, it reports false when the body is too large to be replaced.
+func (ex *exchange) setRequestBody(data []byte) bool {
+	if _, ok := ex.requestBody(); !ok {
+		return false
+	}
+	ex.reqBody.data, ex.reqBody.changed = data, true
+	return true
+}
+
+// setResponseBody replaces the response body, it reports false when it is not the response phase
+// or the body is too large to be replaced.
+func (ex *exchange) setResponseBody(data []byte) bool {
+	if _, ok := ex.responseBody(); !ok {
+		return false
+	}
+	ex.respBody.data, ex.respBody.changed = data, true
+	return true
+}
+
+// responseHeader returns the response headers, or the local response headers in the request phase.
+func (ex *exchange) responseHeader() http.Header {
+	if ex.resp != nil {
+		return ex.resp.Header
+	}
+	if ex.localHeader == nil {
+		ex.localHeader = make(http.Header)
+	}
+	return ex.localHeader
+}
+
+// sendResponse ends the request with a response in the request phase, or replaces the response in the response phase.
+func (ex *exchange) sendResponse(status int, header http.Header, body []byte) {
+	if header == nil {
+		header = ex.responseHeader()
+	}
+	ex.local = &localResponse{status: status, header: header, body: body}
+}
+
+// setURI sets the path and query of the request.
+func (ex *exchange) setURI(uri string) bool {
+	u, err := url.ParseRequestURI(uri)
+	if err != nil {
+		return false
+	}
+	ex.req.URL.Path, ex.req.URL.RawPath, ex.req.URL.RawQuery = u.Path, u.RawPath, u.RawQuery
+	ex.req.RequestURI = u.RequestURI()
+	return true
+}
+
+// applyRequest sets the request body replaced by the plugin.
+func (ex *exchange) applyRequest() {
+	if ex.reqBody == nil || !ex.reqBody.changed {
+		return
+	}
+	r, data := ex.req, ex.reqBody.data
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r.ContentLength = int64(len(data))
+	r.TransferEncoding = nil
+	if r.Header.Get("Content-Length") != "" {
+		r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	}
+}
+
+// applyResponse sets the response body replaced by the plugin, or the response it sent.
+func (ex *exchange) applyResponse() {
+	resp := ex.resp
+	if local := ex.local; local != nil {
+		resp.StatusCode = local.status
+		resp.Status = strconv.Itoa(local.status) + " " + http.StatusText(local.status)
+		maps.Copy(resp.Header, local.header)
+		ex.setResponseBody(local.body)
+	}
+	if ex.respBody == nil || !ex.respBody.changed {
+		return
+	}
+	data := ex.respBody.data
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+}
+
+func (local *localResponse) writeTo(w http.ResponseWriter) {
+	maps.Copy(w.Header(), local.header)
+	w.Header().Set("Content-Length", strconv.Itoa(len(local.body)))
+	w.WriteHeader(local.status)
+	w.Write(local.body)
+}
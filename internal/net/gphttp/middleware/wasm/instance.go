@@ -0,0 +1,157 @@
+package wasm
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/tetratelabs/wazero/api"
+	"github.com/yusing/godoxy/internal/route/routes"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	// instance is an instantiated module, it handles one request at a time.
+	instance struct {
+		mod *module
+		api api.Module
+		ex  *exchange // the exchange being handled, nil between requests
+
+		nextContextID uint32 // proxy-wasm http context id
+		broken        bool   // a call failed, the instance may be closed or in a bad state
+	}
+	instanceKey struct{}
+
+	// pendingKey is the request value of an exchange waiting for the response hooks.
+	pendingKey struct{ plugin *Plugin }
+	pending    struct {
+		inst atomic.Pointer[instance]
+		ex   *exchange
+	}
+)
+
+func withInstance(ctx context.Context, inst *instance) context.Context {
+	return context.WithValue(ctx, instanceKey{}, inst)
+}
+
+func instanceFrom(ctx context.Context) *instance {
+	inst, _ := ctx.Value(instanceKey{}).(*instance)
+	return inst
+}
+
+// call calls an exported function of the instance with the plugin timeout, it returns nil results when it is not exported.
+// The instance is marked broken when the call fails, e.g. on a trap or timeout.
+func (inst *instance) call(ctx context.Context, name string, params ...uint64) ([]uint64, error) {
+	fn := inst.api.ExportedFunction(name)
+	if fn == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, inst.mod.plugin.cfg.Timeout)
+	defer cancel()
+	results, err := fn.Call(withInstance(ctx, inst), params...)
+	if err != nil {
+		inst.broken = true
+		return nil, gperr.PrependSubject(err, name)
+	}
+	return results, nil
+}
+
+func (inst *instance) close() {
+	inst.api.Close(context.Background())
+}
+
+// release ends the exchange and puts the instance back to the pool.
+func (inst *instance) release(ex *exchange) {
+	if !inst.broken {
+		ctx, cancel := context.WithTimeout(context.Background(), inst.mod.plugin.cfg.Timeout)
+		inst.ex = ex
+		inst.mod.abi.done(ctx, inst, ex)
+		cancel()
+	}
+	inst.ex = nil
+	inst.mod.put(inst)
+}
+
+// OnRequest runs the request hooks, it reports whether the request should be passed to the next handler.
+//
+// Within a route context the instance is kept for the response hooks of the same request,
+// so plugins can keep per request state between them.
+func (p *Plugin) OnRequest(w http.ResponseWriter, r *http.Request) (proceed bool) {
+	inst, err := p.instance()
+	if err != nil {
+		return p.fail(w, r, err)
+	}
+	mod := inst.mod
+	ex := newExchange(r)
+	inst.ex = ex
+	err = mod.abi.onRequest(r.Context(), inst, ex)
+	inst.ex = nil
+	if err != nil {
+		inst.release(ex)
+		return p.fail(w, r, err)
+	}
+	ex.applyRequest()
+	if ex.local != nil {
+		ex.local.writeTo(w)
+		inst.release(ex)
+		return false
+	}
+
+	if mod.abi.hasResponseHooks() {
+		pd := &pending{ex: ex}
+		pd.inst.Store(inst)
+		routes.SetRequestValue(r, pendingKey{p}, pd)
+		if routes.RequestValue(r, pendingKey{p}) != nil {
+			// release when the response hooks are not run, e.g. for streamed responses
+			context.AfterFunc(r.Context(), func() {
+				if inst := pd.inst.Swap(nil); inst != nil {
+					inst.release(pd.ex)
+				}
+			})
+			return true
+		}
+	}
+	inst.release(ex)
+	return true
+}
+
+// OnResponse runs the response hooks with the instance of the request hooks,
+// or a new instance outside a route context.
+func (p *Plugin) OnResponse(resp *http.Response) error {
+	r := resp.Request
+	var inst *instance
+	var ex *exchange
+	if pd, ok := routes.RequestValue(r, pendingKey{p}).(*pending); ok {
+		inst, ex = pd.inst.Swap(nil), pd.ex
+	}
+	if inst == nil {
+		if !p.module.Load().abi.hasResponseHooks() {
+			return nil
+		}
+		var err error
+		if inst, err = p.instance(); err != nil {
+			return err
+		}
+		ex = newExchange(r)
+	}
+	defer inst.release(ex)
+
+	ex.resp = resp
+	inst.ex = ex
+	err := inst.mod.abi.onResponse(r.Context(), inst, ex)
+	inst.ex = nil
+	if err != nil {
+		return err
+	}
+	ex.applyResponse()
+	return nil
+}
+
+func (p *Plugin) fail(w http.ResponseWriter, r *http.Request, err error) (proceed bool) {
+	p.logger().Err(err).Str("host", r.Host).Str("path", r.URL.Path).Msg("plugin request hook failed")
+	if p.cfg.FailOpen {
+		return true
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	return false
+}
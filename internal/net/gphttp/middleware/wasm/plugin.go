@@ -0,0 +1,426 @@
+package wasm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/watcher"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+	gperr "github.com/yusing/goutils/errs"
+	"github.com/yusing/goutils/eventqueue"
+	"github.com/yusing/goutils/task"
+)
+
+type (
+	// Config is the configuration of a wasm plugin.
+	Config struct {
+		// File is the name of the .wasm file in config/plugins.
+		File string `json:"file" validate:"required"`
+		// Config is passed to the plugin as is when it is a string, JSON encoded otherwise.
+		Config any `json:"config"`
+		// MemoryLimitMB is the maximum linear memory of an instance.
+		MemoryLimitMB uint32 `json:"memory_limit_mb" validate:"omitempty,min=1,max=4096"`
+		// Timeout is the maximum time a hook may run, the instance is killed when it is exceeded.
+		Timeout time.Duration `json:"timeout"`
+		// FailOpen lets requests through when a request hook fails instead of responding 500.
+		FailOpen bool `json:"fail_open"`
+	}
+
+	// Plugin is a loaded wasm module, it is reloaded when its file changes.
+	//
+	// Each request is handled by an instance of the module taken from a pool,
+	// so plugins do not need to be thread safe.
+	Plugin struct {
+		cfg    Config
+		config []byte
+		key    string // key in plugins
+		refs   int    // middlewares using the plugin, guarded by pluginsMu
+		rt     wazero.Runtime
+		module atomic.Pointer[module]
+
+		loadMu   sync.Mutex
+		released bool // no middleware uses the plugin, guarded by loadMu
+
+		shared  sharedData
+		metrics metrics
+	}
+
+	// module is a compiled version of the plugin file.
+	module struct {
+		plugin   *Plugin
+		compiled wazero.CompiledModule
+		abi      abi
+		start    []string
+
+		mu           sync.Mutex
+		pool         []*instance
+		inUse        int  // instances taken from the pool or being created
+		closed       bool // replaced by a reload or released, no instances are taken anymore
+		closeRuntime bool // close the runtime with the module, when the plugin is released
+	}
+)
+
+const (
+	defaultMemoryLimitMB = 64
+	defaultTimeout       = 100 * time.Millisecond
+	instantiateTimeout   = 10 * time.Second
+	reloadFlushInterval  = 500 * time.Millisecond
+
+	pagesPerMB = 16 // 64KiB wasm pages
+)
+
+var DefaultConfig = Config{
+	MemoryLimitMB: defaultMemoryLimitMB,
+	Timeout:       defaultTimeout,
+}
+
+var (
+	ErrInvalidFile = errors.New("invalid plugin file")
+	ErrUnknownABI  = errors.New("unknown plugin ABI, expect a proxy-wasm 0.2.x or GoDoxy plugin")
+
+	errModuleClosed = errors.New("module closed")
+)
+
+var (
+	// plugins are shared by middlewares with the same config, so route reloads do not recompile them.
+	plugins   = make(map[string]*Plugin)
+	pluginsMu sync.Mutex
+
+	// watchedFiles are the plugins of each watched file, a file stays watched without plugins.
+	watchedFiles = make(map[string][]*Plugin)
+	pluginsTask  *task.Task
+	dirWatcher   *watcher.DirWatcher
+
+	compilationCache = wazero.NewCompilationCache()
+)
+
+// Load returns the plugin of the config, the module is compiled on first load and watched for changes.
+// Each call must be paired with Release.
+func Load(cfg *Config) (*Plugin, error) {
+	if cfg.File == "" || filepath.Base(cfg.File) != cfg.File || filepath.Ext(cfg.File) != ".wasm" {
+		return nil, gperr.PrependSubject(fmt.Errorf("%w: expect a .wasm file name in %s", ErrInvalidFile, common.WasmPluginsBasePath), cfg.File)
+	}
+	if cfg.MemoryLimitMB == 0 {
+		cfg.MemoryLimitMB = defaultMemoryLimitMB
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	key, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+
+	if p, ok := plugins[string(key)]; ok {
+		p.refs++
+		return p, nil
+	}
+	p, err := newPlugin(cfg)
+	if err != nil {
+		return nil, gperr.PrependSubject(err, cfg.File)
+	}
+	if err := p.load(); err != nil {
+		p.rt.Close(context.Background())
+		return nil, gperr.PrependSubject(err, cfg.File)
+	}
+	p.key = string(key)
+	p.refs = 1
+	plugins[p.key] = p
+	watch(p)
+	return p, nil
+}
+
+// Release drops a reference of Load, the plugin is closed when none is left.
+func (p *Plugin) Release() {
+	pluginsMu.Lock()
+	if p.refs--; p.refs > 0 {
+		pluginsMu.Unlock()
+		return
+	}
+	delete(plugins, p.key)
+	watchedFiles[p.cfg.File] = slices.DeleteFunc(watchedFiles[p.cfg.File], func(watching *Plugin) bool {
+		return watching == p
+	})
+	pluginsMu.Unlock()
+
+	p.loadMu.Lock()
+	p.released = true
+	mod := p.module.Swap(nil)
+	p.loadMu.Unlock()
+	if mod != nil {
+		mod.close(true)
+	}
+}
+
+func newPlugin(cfg *Config) (*Plugin, error) {
+	p := &Plugin{cfg: *cfg}
+	switch config := cfg.Config.(type) {
+	case nil:
+	case string:
+		p.config = []byte(config)
+	default:
+		b, err := json.Marshal(config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid config: %w", err)
+		}
+		p.config = b
+	}
+
+	ctx := context.Background()
+	p.rt = wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(cfg.MemoryLimitMB*pagesPerMB).
+		WithCloseOnContextDone(true).
+		WithCompilationCache(compilationCache))
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, p.rt); err != nil {
+		p.rt.Close(ctx)
+		return nil, err
+	}
+	if err := instantiateHostModules(ctx, p.rt); err != nil {
+		p.rt.Close(ctx)
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *Plugin) logger() *zerolog.Logger {
+	l := log.With().Str("plugin", p.cfg.File).Logger()
+	return &l
+}
+
+// load compiles the plugin file and replaces the current module with it.
+// An instance is created to check the module, so a broken file does not replace a working one.
+func (p *Plugin) load() error {
+	p.loadMu.Lock()
+	defer p.loadMu.Unlock()
+	if p.released {
+		return nil
+	}
+
+	bin, err := os.ReadFile(filepath.Join(common.WasmPluginsBasePath, p.cfg.File))
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	compiled, err := p.rt.CompileModule(ctx, bin)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+	abi, err := detectABI(compiled)
+	if err != nil {
+		compiled.Close(ctx)
+		return err
+	}
+	mod := &module{plugin: p, compiled: compiled, abi: abi}
+	exports := compiled.ExportedFunctions()
+	if _, ok := exports["_initialize"]; ok {
+		mod.start = []string{"_initialize"}
+	} else if _, ok := exports["_start"]; ok {
+		mod.start = []string{"_start"}
+	}
+
+	inst, err := mod.get()
+	if err != nil {
+		compiled.Close(ctx)
+		return err
+	}
+	mod.put(inst)
+	if old := p.module.Swap(mod); old != nil {
+		old.close(false)
+	}
+	return nil
+}
+
+// instance takes an instance of the current module, retrying when a reload closed the module in between.
+func (p *Plugin) instance() (*instance, error) {
+	for {
+		inst, err := p.module.Load().get()
+		if !errors.Is(err, errModuleClosed) {
+			return inst, err
+		}
+	}
+}
+
+func watch(p *Plugin) {
+	if watching, ok := watchedFiles[p.cfg.File]; ok {
+		watchedFiles[p.cfg.File] = append(watching, p)
+		return
+	}
+	watchedFiles[p.cfg.File] = []*Plugin{p}
+
+	if pluginsTask == nil {
+		pluginsTask = task.RootTask("wasm_plugins", false)
+		dirWatcher = watcher.NewDirectoryWatcher(pluginsTask, common.WasmPluginsBasePath)
+	}
+	file := p.cfg.File
+	t := pluginsTask.Subtask("wasm_plugin_watcher("+file+")", false)
+	l := p.logger()
+	opts := eventqueue.Options[watcherEvents.Event]{
+		FlushInterval: reloadFlushInterval,
+		OnFlush: func(evs []watcherEvents.Event) {
+			if len(evs) == 0 {
+				return
+			}
+			if evs[len(evs)-1].Action == watcherEvents.ActionFileDeleted {
+				l.Warn().Msg("plugin file deleted, keeping the loaded module")
+				return
+			}
+			pluginsMu.Lock()
+			watching := watchedFiles[file]
+			pluginsMu.Unlock()
+			if len(watching) == 0 {
+				return
+			}
+			for _, p := range watching {
+				if err := p.load(); err != nil {
+					l.Err(err).Msg("failed to reload plugin, keeping the loaded module")
+					return
+				}
+			}
+			l.Info().Msg("plugin reloaded")
+		},
+		OnError: func(err error) {
+			l.Err(err).Msg("plugin watcher error")
+		},
+		Debug: common.IsDebug,
+	}
+	stream := dirWatcher.Add(file).Watch(t)
+	eventqueue.New(t, opts).Start(stream.Events, stream.Errors)
+}
+
+// get takes an idle instance from the pool, or creates one.
+// It returns errModuleClosed when the module is closed, the caller should retry with the current module.
+func (mod *module) get() (*instance, error) {
+	mod.mu.Lock()
+	if mod.closed {
+		mod.mu.Unlock()
+		return nil, errModuleClosed
+	}
+	mod.inUse++
+	if n := len(mod.pool); n > 0 {
+		inst := mod.pool[n-1]
+		mod.pool = mod.pool[:n-1]
+		mod.mu.Unlock()
+		return inst, nil
+	}
+	mod.mu.Unlock()
+	inst, err := mod.newInstance()
+	if err != nil {
+		mod.unref()
+		return nil, err
+	}
+	return inst, nil
+}
+
+// put returns an instance to the pool, it is closed when the pool is full or the module was closed.
+func (mod *module) put(inst *instance) {
+	mod.mu.Lock()
+	mod.inUse--
+	if !inst.broken && !mod.closed && len(mod.pool) < runtime.GOMAXPROCS(0) {
+		mod.pool = append(mod.pool, inst)
+		mod.mu.Unlock()
+		return
+	}
+	free := mod.closed && mod.inUse == 0
+	mod.mu.Unlock()
+	inst.close()
+	if free {
+		mod.free()
+	}
+}
+
+// unref drops an instance that was not created.
+func (mod *module) unref() {
+	mod.mu.Lock()
+	mod.inUse--
+	free := mod.closed && mod.inUse == 0
+	mod.mu.Unlock()
+	if free {
+		mod.free()
+	}
+}
+
+// close closes the idle instances, the compiled module is freed after the instances in use are put back.
+// closeRuntime closes the runtime of the plugin with it.
+func (mod *module) close(closeRuntime bool) {
+	mod.mu.Lock()
+	pool := mod.pool
+	mod.pool = nil
+	mod.closed = true
+	mod.closeRuntime = closeRuntime
+	free := mod.inUse == 0
+	mod.mu.Unlock()
+	for _, inst := range pool {
+		inst.close()
+	}
+	if free {
+		mod.free()
+	}
+}
+
+func (mod *module) free() {
+	ctx := context.Background()
+	mod.compiled.Close(ctx)
+	if mod.closeRuntime {
+		mod.plugin.rt.Close(ctx)
+	}
+}
+
+func (mod *module) newInstance() (*instance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), instantiateTimeout)
+	defer cancel()
+
+	inst := &instance{mod: mod, nextContextID: proxyRootContextID + 1}
+	ctx = withInstance(ctx, inst)
+	out := &logWriter{plugin: mod.plugin}
+	cfg := wazero.NewModuleConfig().
+		WithName(""). // anonymous, so the module can be instantiated more than once
+		WithStartFunctions(mod.start...).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader).
+		WithStdout(out).
+		WithStderr(out)
+	m, err := mod.plugin.rt.InstantiateModule(ctx, mod.compiled, cfg)
+	if err != nil {
+		return nil, err
+	}
+	inst.api = m
+	if err := mod.abi.init(ctx, inst); err != nil {
+		m.Close(context.Background())
+		return nil, err
+	}
+	return inst, nil
+}
+
+// logWriter logs the stdout and stderr of a plugin line by line.
+type logWriter struct {
+	plugin *Plugin
+}
+
+func (w *logWriter) Write(b []byte) (int, error) {
+	for line := range strings.Lines(string(b)) {
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			w.plugin.logger().Info().Msg(line)
+		}
+	}
+	return len(b), nil
+}
@@ -0,0 +1,116 @@
+// Command godoxy is a test plugin of the GoDoxy ABI.
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o godoxy.wasm
+package main
+
+import (
+	"strings"
+	"unsafe"
+)
+
+const (
+	kindRequest  = 0
+	kindResponse = 1
+)
+
+var version = "1" // set with -ldflags=-X main.version=...
+
+func main() {}
+
+//go:wasmimport godoxy get_config
+func getConfig(buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport godoxy get_method
+func getMethod(buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport godoxy get_header
+func getHeader(kind uint32, name unsafe.Pointer, nameLen uint32, buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport godoxy set_header
+func setHeader(kind uint32, name unsafe.Pointer, nameLen uint32, value unsafe.Pointer, valueLen uint32)
+
+//go:wasmimport godoxy get_body
+func getBody(kind uint32, buf unsafe.Pointer, bufLen uint32) int32
+
+//go:wasmimport godoxy set_body
+func setBody(kind uint32, ptr unsafe.Pointer, size uint32) int32
+
+//go:wasmimport godoxy send_response
+func sendResponse(status uint32, body unsafe.Pointer, bodyLen uint32)
+
+// read calls get with a buffer, and again with a larger one when it is too small.
+func read(get func(buf unsafe.Pointer, bufLen uint32) int32) (string, bool) {
+	buf := make([]byte, 256)
+	for {
+		n := get(unsafe.Pointer(unsafe.SliceData(buf)), uint32(len(buf)))
+		if n < 0 {
+			return "", false
+		}
+		if int(n) <= len(buf) {
+			return string(buf[:n]), true
+		}
+		buf = make([]byte, n)
+	}
+}
+
+func str(s string) (unsafe.Pointer, uint32) {
+	return unsafe.Pointer(unsafe.StringData(s)), uint32(len(s))
+}
+
+func header(kind uint32, name string) string {
+	v, _ := read(func(buf unsafe.Pointer, bufLen uint32) int32 {
+		p, n := str(name)
+		return getHeader(kind, p, n, buf, bufLen)
+	})
+	return v
+}
+
+func set(kind uint32, name, value string) {
+	np, nn := str(name)
+	vp, vn := str(value)
+	setHeader(kind, np, nn, vp, vn)
+}
+
+func config() string {
+	v, _ := read(getConfig)
+	return v
+}
+
+func body(kind uint32) (string, bool) {
+	return read(func(buf unsafe.Pointer, bufLen uint32) int32 {
+		return getBody(kind, buf, bufLen)
+	})
+}
+
+func replaceBody(kind uint32, s string) {
+	p, n := str(s)
+	setBody(kind, p, n)
+}
+
+//go:wasmexport godoxy_on_request
+func onRequest() {
+	if header(kindRequest, "X-Loop") != "" {
+		for {
+		}
+	}
+	if header(kindRequest, "X-Block") != "" {
+		set(kindResponse, "Content-Type", "text/plain")
+		p, n := str("blocked by " + config())
+		sendResponse(403, p, n)
+		return
+	}
+	method, _ := read(getMethod)
+	set(kindRequest, "X-Plugin-Version", version)
+	set(kindRequest, "X-Plugin-Method", method)
+	if b, ok := body(kindRequest); ok && b != "" {
+		replaceBody(kindRequest, strings.ToUpper(b))
+	}
+}
+
+//go:wasmexport godoxy_on_response
+func onResponse() {
+	set(kindResponse, "X-Plugin-Config", config())
+	if b, ok := body(kindResponse); ok {
+		replaceBody(kindResponse, b+"!")
+	}
+}
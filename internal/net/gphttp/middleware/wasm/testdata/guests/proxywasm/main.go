@@ -0,0 +1,154 @@
+// Command proxywasm is a test plugin of the proxy-wasm 0.2.1 ABI without an SDK.
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o proxywasm.wasm
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"unsafe"
+)
+
+const (
+	mapRequestHeaders  = 0
+	mapResponseHeaders = 2
+
+	bufferResponseBody        = 1
+	bufferPluginConfiguration = 7
+
+	actionContinue = 0
+	actionPause    = 1
+)
+
+var (
+	config string
+	// paths of the http contexts, kept from the request to the response
+	paths = map[uint32]string{}
+	// allocs keeps the memory allocated by the host alive until the hook returns
+	allocs [][]byte
+)
+
+func main() {}
+
+//go:wasmimport env proxy_log
+func proxyLog(level uint32, msg unsafe.Pointer, size uint32) uint32
+
+//go:wasmimport env proxy_get_buffer_bytes
+func proxyGetBufferBytes(bufferType, start, maxSize uint32, ptrPtr, sizePtr unsafe.Pointer) uint32
+
+//go:wasmimport env proxy_set_buffer_bytes
+func proxySetBufferBytes(bufferType, start, size uint32, data unsafe.Pointer, dataSize uint32) uint32
+
+//go:wasmimport env proxy_get_header_map_value
+func proxyGetHeaderMapValue(mapType uint32, key unsafe.Pointer, keySize uint32, ptrPtr, sizePtr unsafe.Pointer) uint32
+
+//go:wasmimport env proxy_replace_header_map_value
+func proxyReplaceHeaderMapValue(mapType uint32, key unsafe.Pointer, keySize uint32, value unsafe.Pointer, valueSize uint32) uint32
+
+//go:wasmimport env proxy_send_local_response
+func proxySendLocalResponse(status uint32, details unsafe.Pointer, detailsSize uint32, body unsafe.Pointer, bodySize uint32, headers unsafe.Pointer, headersSize uint32, grpcStatus int32) uint32
+
+//go:wasmexport proxy_abi_version_0_2_1
+func abiVersion() {}
+
+//go:wasmexport proxy_on_memory_allocate
+func allocate(size uint32) uint32 {
+	b := make([]byte, size)
+	allocs = append(allocs, b)
+	return uint32(uintptr(unsafe.Pointer(unsafe.SliceData(b))))
+}
+
+func str(s string) (unsafe.Pointer, uint32) {
+	return unsafe.Pointer(unsafe.StringData(s)), uint32(len(s))
+}
+
+// returned reads the bytes the host allocated and returned.
+func returned(ptr, size uint32) string {
+	if size == 0 {
+		return ""
+	}
+	return string(unsafe.Slice((*byte)(unsafe.Pointer(uintptr(ptr))), size))
+}
+
+func header(mapType uint32, key string) (string, bool) {
+	var ptr, size uint32
+	kp, kn := str(key)
+	if proxyGetHeaderMapValue(mapType, kp, kn, unsafe.Pointer(&ptr), unsafe.Pointer(&size)) != 0 {
+		return "", false
+	}
+	return returned(ptr, size), true
+}
+
+func setHeader(mapType uint32, key, value string) {
+	kp, kn := str(key)
+	vp, vn := str(value)
+	proxyReplaceHeaderMapValue(mapType, kp, kn, vp, vn)
+}
+
+//go:wasmexport proxy_on_context_create
+func onContextCreate(contextID, rootContextID uint32) {}
+
+//go:wasmexport proxy_on_vm_start
+func onVMStart(rootContextID, size uint32) uint32 { return 1 }
+
+//go:wasmexport proxy_on_configure
+func onConfigure(rootContextID, size uint32) uint32 {
+	var ptr, n uint32
+	if proxyGetBufferBytes(bufferPluginConfiguration, 0, size, unsafe.Pointer(&ptr), unsafe.Pointer(&n)) != 0 {
+		return 0
+	}
+	config = returned(ptr, n)
+	msg, msgLen := str("configured")
+	proxyLog(2, msg, msgLen)
+	return 1
+}
+
+//go:wasmexport proxy_on_request_headers
+func onRequestHeaders(contextID, numHeaders, endOfStream uint32) uint32 {
+	defer func() { allocs = nil }()
+	if _, ok := header(mapRequestHeaders, "x-block"); ok {
+		body, bodyLen := str("blocked by " + config)
+		headers := encodePairs([][2]string{{"content-type", "text/plain"}})
+		proxySendLocalResponse(403, nil, 0, body, bodyLen, unsafe.Pointer(unsafe.SliceData(headers)), uint32(len(headers)), -1)
+		return actionPause
+	}
+	path, _ := header(mapRequestHeaders, ":path")
+	paths[contextID] = path
+	setHeader(mapRequestHeaders, "x-plugin-path", path)
+	return actionContinue
+}
+
+//go:wasmexport proxy_on_response_headers
+func onResponseHeaders(contextID, numHeaders, endOfStream uint32) uint32 {
+	defer func() { allocs = nil }()
+	setHeader(mapResponseHeaders, "x-plugin-config", config)
+	setHeader(mapResponseHeaders, "x-plugin-request-path", paths[contextID])
+	return actionContinue
+}
+
+//go:wasmexport proxy_on_response_body
+func onResponseBody(contextID, size, endOfStream uint32) uint32 {
+	data, n := str("!")
+	proxySetBufferBytes(bufferResponseBody, math.MaxInt32, 0, data, n) // append
+	return actionContinue
+}
+
+//go:wasmexport proxy_on_done
+func onDone(contextID uint32) uint32 { return 1 }
+
+//go:wasmexport proxy_on_delete
+func onDelete(contextID uint32) {
+	delete(paths, contextID)
+}
+
+func encodePairs(pairs [][2]string) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(pairs)))
+	for _, p := range pairs {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(p[0])))
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(p[1])))
+	}
+	for _, p := range pairs {
+		b = append(append(append(append(b, p[0]...), 0), p[1]...), 0)
+	}
+	return b
+}
@@ -0,0 +1,319 @@
+package wasm
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/route/routes"
+)
+
+// guests are the test plugins in testdata/guests, built for wasip1 by TestMain.
+var guests = map[string][]byte{}
+
+func buildGuest(dir, out string, args ...string) error {
+	args = append([]string{"build", "-buildmode=c-shared", "-o", out}, args...)
+	cmd := exec.Command("go", append(args, "./"+filepath.Base(dir))...)
+	cmd.Dir = filepath.Dir(dir)
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "GOFLAGS=", "GOWORK=off")
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("build %s: %w\n%s", dir, err, b)
+	}
+	return nil
+}
+
+func TestMain(m *testing.M) {
+	os.Exit(func() int {
+		src, err := filepath.Abs("testdata/guests")
+		if err != nil {
+			panic(err)
+		}
+		tmp, err := os.MkdirTemp("", "godoxy-wasm-test")
+		if err != nil {
+			panic(err)
+		}
+		defer os.RemoveAll(tmp)
+
+		for name, args := range map[string][]string{
+			"godoxy":    nil,
+			"godoxy_v2": {"-ldflags=-X main.version=2"},
+			"proxywasm": nil,
+		} {
+			dir := filepath.Join(src, strings.TrimSuffix(name, "_v2"))
+			out := filepath.Join(tmp, name+".wasm")
+			if err := buildGuest(dir, out, args...); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+			if guests[name], err = os.ReadFile(out); err != nil {
+				panic(err)
+			}
+		}
+
+		// plugins are loaded from config/plugins relative to the working directory
+		if err := os.MkdirAll(filepath.Join(tmp, common.WasmPluginsBasePath), 0o755); err != nil {
+			panic(err)
+		}
+		if err := os.Chdir(tmp); err != nil {
+			panic(err)
+		}
+		return m.Run()
+	}())
+}
+
+func writePlugin(t *testing.T, file, guest string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(common.WasmPluginsBasePath, file), guests[guest], 0o644))
+}
+
+func loadPlugin(t *testing.T, cfg Config) *Plugin {
+	t.Helper()
+	p, err := Load(&cfg)
+	require.NoError(t, err)
+	return p
+}
+
+func newRequest(method string, body string, header http.Header) *http.Request {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, "/path?q=1", r)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return routes.WithRouteContext(req, nil)
+}
+
+func newResponse(req *http.Request, body string) *http.Response {
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        http.Header{"Content-Type": {"text/plain"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+func readAll(t *testing.T, r io.Reader) string {
+	t.Helper()
+	b, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestGoDoxyABI(t *testing.T) {
+	writePlugin(t, "godoxy.wasm", "godoxy")
+	p := loadPlugin(t, Config{File: "godoxy.wasm", Config: "cfg"})
+
+	t.Run("request", func(t *testing.T) {
+		req := newRequest(http.MethodPost, "hello", nil)
+		w := httptest.NewRecorder()
+		require.True(t, p.OnRequest(w, req))
+		require.Equal(t, "1", req.Header.Get("X-Plugin-Version"))
+		require.Equal(t, http.MethodPost, req.Header.Get("X-Plugin-Method"))
+		require.Equal(t, "HELLO", readAll(t, req.Body))
+		require.EqualValues(t, 5, req.ContentLength)
+	})
+
+	t.Run("local response", func(t *testing.T) {
+		req := newRequest(http.MethodGet, "", http.Header{"X-Block": {"1"}})
+		w := httptest.NewRecorder()
+		require.False(t, p.OnRequest(w, req))
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		require.Equal(t, "blocked by cfg", w.Body.String())
+	})
+
+	t.Run("response", func(t *testing.T) {
+		req := newRequest(http.MethodGet, "", nil)
+		require.True(t, p.OnRequest(httptest.NewRecorder(), req))
+		resp := newResponse(req, "hello")
+		require.NoError(t, p.OnResponse(resp))
+		require.Equal(t, "cfg", resp.Header.Get("X-Plugin-Config"))
+		require.Equal(t, "hello!", readAll(t, resp.Body))
+		require.EqualValues(t, 6, resp.ContentLength)
+	})
+}
+
+func TestProxyWasmABI(t *testing.T) {
+	writePlugin(t, "proxywasm.wasm", "proxywasm")
+	p := loadPlugin(t, Config{File: "proxywasm.wasm", Config: map[string]any{"key": "value"}})
+
+	t.Run("request and response", func(t *testing.T) {
+		req := newRequest(http.MethodGet, "", nil)
+		require.True(t, p.OnRequest(httptest.NewRecorder(), req))
+		require.Equal(t, "/path?q=1", req.Header.Get("X-Plugin-Path"))
+
+		resp := newResponse(req, "hello")
+		require.NoError(t, p.OnResponse(resp))
+		require.Equal(t, `{"key":"value"}`, resp.Header.Get("X-Plugin-Config"))
+		// state kept by the plugin from the request headers hook
+		require.Equal(t, "/path?q=1", resp.Header.Get("X-Plugin-Request-Path"))
+		require.Equal(t, "hello!", readAll(t, resp.Body))
+	})
+
+	t.Run("local response", func(t *testing.T) {
+		req := newRequest(http.MethodGet, "", http.Header{"X-Block": {"1"}})
+		w := httptest.NewRecorder()
+		require.False(t, p.OnRequest(w, req))
+		require.Equal(t, http.StatusForbidden, w.Code)
+		require.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		require.Equal(t, `blocked by {"key":"value"}`, w.Body.String())
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	writePlugin(t, "timeout.wasm", "godoxy")
+
+	t.Run("fail closed", func(t *testing.T) {
+		p := loadPlugin(t, Config{File: "timeout.wasm", Timeout: 50 * time.Millisecond})
+		w := httptest.NewRecorder()
+		require.False(t, p.OnRequest(w, newRequest(http.MethodGet, "", http.Header{"X-Loop": {"1"}})))
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+
+		// the killed instance is not reused
+		req := newRequest(http.MethodGet, "", nil)
+		require.True(t, p.OnRequest(httptest.NewRecorder(), req))
+		require.Equal(t, "1", req.Header.Get("X-Plugin-Version"))
+	})
+
+	t.Run("fail open", func(t *testing.T) {
+		p := loadPlugin(t, Config{File: "timeout.wasm", Timeout: 50 * time.Millisecond, FailOpen: true})
+		require.True(t, p.OnRequest(httptest.NewRecorder(), newRequest(http.MethodGet, "", http.Header{"X-Loop": {"1"}})))
+	})
+}
+
+func TestHotReload(t *testing.T) {
+	writePlugin(t, "reload.wasm", "godoxy")
+	p := loadPlugin(t, Config{File: "reload.wasm"})
+
+	version := func() string {
+		req := newRequest(http.MethodGet, "", nil)
+		require.True(t, p.OnRequest(httptest.NewRecorder(), req))
+		return req.Header.Get("X-Plugin-Version")
+	}
+	require.Equal(t, "1", version())
+
+	writePlugin(t, "reload.wasm", "godoxy_v2")
+	require.Eventually(t, func() bool { return version() == "2" }, 5*time.Second, 50*time.Millisecond)
+
+	// a broken file keeps the loaded module
+	require.NoError(t, os.WriteFile(filepath.Join(common.WasmPluginsBasePath, "reload.wasm"), []byte("not wasm"), 0o644))
+	time.Sleep(2 * reloadFlushInterval)
+	require.Equal(t, "2", version())
+}
+
+func TestReloadInFlight(t *testing.T) {
+	writePlugin(t, "inflight.wasm", "godoxy")
+	// compiling in the background slows down instances, do not fail on the timeout
+	p := loadPlugin(t, Config{File: "inflight.wasm", Timeout: 5 * time.Second})
+
+	// an instance taken before a reload keeps running on the old module
+	inst, err := p.instance()
+	require.NoError(t, err)
+	old := inst.mod
+	require.NoError(t, p.load())
+	require.True(t, old.closed)
+	require.NotSame(t, old, p.module.Load())
+
+	req := newRequest(http.MethodGet, "", nil)
+	require.True(t, p.OnRequest(httptest.NewRecorder(), req))
+	require.Equal(t, "1", req.Header.Get("X-Plugin-Version"))
+
+	old.put(inst)
+	require.Zero(t, old.inUse)
+
+	// requests during reloads never see a closed module
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for range 4 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				w := httptest.NewRecorder()
+				if !p.OnRequest(w, newRequest(http.MethodGet, "", nil)) {
+					t.Errorf("request failed with status %d", w.Code)
+					return
+				}
+			}
+		})
+	}
+	for range 10 {
+		require.NoError(t, p.load())
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestRelease(t *testing.T) {
+	writePlugin(t, "release.wasm", "godoxy")
+	cfg := Config{File: "release.wasm"}
+	p := loadPlugin(t, cfg)
+	require.Same(t, p, loadPlugin(t, cfg))
+
+	p.Release()
+	pluginsMu.Lock()
+	require.Same(t, p, plugins[p.key])
+	pluginsMu.Unlock()
+
+	p.Release()
+	pluginsMu.Lock()
+	require.NotContains(t, plugins, p.key)
+	require.NotContains(t, watchedFiles["release.wasm"], p)
+	pluginsMu.Unlock()
+	require.Nil(t, p.module.Load())
+	// a reload after release is a no-op
+	require.NoError(t, p.load())
+	require.Nil(t, p.module.Load())
+
+	// the file is loaded again by a new middleware
+	p2 := loadPlugin(t, cfg)
+	require.NotSame(t, p, p2)
+	req := newRequest(http.MethodGet, "", nil)
+	require.True(t, p2.OnRequest(httptest.NewRecorder(), req))
+	require.Equal(t, "1", req.Header.Get("X-Plugin-Version"))
+	pluginsMu.Lock()
+	require.Equal(t, []*Plugin{p2}, watchedFiles["release.wasm"])
+	pluginsMu.Unlock()
+}
+
+func TestLoadErrors(t *testing.T) {
+	require.NoError(t, os.WriteFile(filepath.Join(common.WasmPluginsBasePath, "invalid.wasm"), []byte("not wasm"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(common.WasmPluginsBasePath, "empty.wasm"), emptyModule, 0o644))
+
+	tests := []struct {
+		file string
+		err  error
+	}{
+		{"", ErrInvalidFile},
+		{"../godoxy.wasm", ErrInvalidFile},
+		{"plugin.so", ErrInvalidFile},
+		{"invalid.wasm", ErrInvalidFile},
+		{"empty.wasm", ErrUnknownABI},
+		{"missing.wasm", os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			_, err := Load(&Config{File: tt.file})
+			require.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+// emptyModule is a valid wasm module without exports.
+var emptyModule = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
@@ -0,0 +1,16 @@
+package middleware
+
+import (
+	"os"
+	"testing"
+
+	expect "github.com/yusing/goutils/testing"
+)
+
+func TestWasmMissingPlugin(t *testing.T) {
+	_, err := WASM.New(OptionsRaw{"file": "missing.wasm"})
+	expect.ErrorIs(t, os.ErrNotExist, err)
+
+	_, err = WASM.New(OptionsRaw{"file": "../plugin.wasm"})
+	expect.HasError(t, err)
+}
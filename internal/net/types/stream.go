@@ -15,4 +15,10 @@ type ConnProxy interface {
 	ProxyConn(ctx context.Context, conn net.Conn)
 }
 
+// SessionCounter is implemented by streams that can report
+// the number of currently open client sessions.
+type SessionCounter interface {
+	ActiveSessions() int
+}
+
 type HookFunc func(ctx context.Context) error
@@ -13,7 +13,7 @@ import (
 
 type ProviderBase struct {
 	Name   string    `json:"name" validate:"required"`
-	URL    string    `json:"url" validate:"url"`
+	URL    string    `json:"url" validate:"omitempty,url"`
 	Token  string    `json:"token"`
 	Format LogFormat `json:"format"`
 }
@@ -32,6 +32,22 @@ var (
 
 // Validate implements the utils.CustomValidator interface.
 func (base *ProviderBase) Validate() error {
+	if err := base.validateFormat(); err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(base.URL, "http://") && !strings.HasPrefix(base.URL, "https://") {
+		return ErrURLMissingScheme
+	}
+	u, err := url.Parse(base.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	base.URL = u.String()
+	return nil
+}
+
+func (base *ProviderBase) validateFormat() error {
 	switch base.Format {
 	case "":
 		base.Format = LogFormatMarkdown
@@ -44,16 +60,15 @@ func (base *ProviderBase) Validate() error {
 				LogFormatMarkdown,
 			)
 	}
+	return nil
+}
 
-	if !strings.HasPrefix(base.URL, "http://") && !strings.HasPrefix(base.URL, "https://") {
-		return ErrURLMissingScheme
+// validateDefaultURL sets the URL to defaultURL if empty, then validates the provider.
+func (base *ProviderBase) validateDefaultURL(defaultURL string) error {
+	if base.URL == "" {
+		base.URL = defaultURL
 	}
-	u, err := url.Parse(base.URL)
-	if err != nil {
-		return fmt.Errorf("invalid url: %w", err)
-	}
-	base.URL = u.String()
-	return nil
+	return base.Validate()
 }
 
 func (base *ProviderBase) GetName() string {
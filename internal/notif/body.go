@@ -2,7 +2,9 @@ package notif
 
 import (
 	"bytes"
+	"html"
 	"strings"
+	"unicode/utf8"
 
 	gperr "github.com/yusing/goutils/errs"
 	strutils "github.com/yusing/goutils/strings"
@@ -34,6 +36,7 @@ const (
 	LogFormatMarkdown LogFormat = "markdown"
 	LogFormatPlain    LogFormat = "plain"
 	LogFormatRawJSON  LogFormat = "json" // internal use only
+	LogFormatHTML     LogFormat = "html" // internal use only
 )
 
 func ErrorBody(err error) LogBody {
@@ -65,6 +68,16 @@ func (f FieldsBody) Format(format LogFormat) ([]byte, error) {
 			msg.WriteByte('\n')
 		}
 		return msg.Bytes(), nil
+	case LogFormatHTML:
+		var msg bytes.Buffer
+		for _, field := range f {
+			msg.WriteString("<strong>")
+			msg.WriteString(html.EscapeString(field.Name))
+			msg.WriteString("</strong><br>")
+			msg.WriteString(escapeHTMLLines(field.Value))
+			msg.WriteString("<br>")
+		}
+		return msg.Bytes(), nil
 	case LogFormatRawJSON:
 		return strutils.MarshalJSON(f)
 	}
@@ -83,6 +96,16 @@ func (l ListBody) Format(format LogFormat) ([]byte, error) {
 			msg.WriteByte('\n')
 		}
 		return msg.Bytes(), nil
+	case LogFormatHTML:
+		var msg bytes.Buffer
+		msg.WriteString("<ul>")
+		for _, item := range l {
+			msg.WriteString("<li>")
+			msg.WriteString(html.EscapeString(item))
+			msg.WriteString("</li>")
+		}
+		msg.WriteString("</ul>")
+		return msg.Bytes(), nil
 	case LogFormatRawJSON:
 		return strutils.MarshalJSON(l)
 	}
@@ -93,6 +116,8 @@ func (m MessageBody) Format(format LogFormat) ([]byte, error) {
 	switch format {
 	case LogFormatPlain, LogFormatMarkdown:
 		return []byte(m), nil
+	case LogFormatHTML:
+		return []byte(escapeHTMLLines(string(m))), nil
 	case LogFormatRawJSON:
 		return strutils.MarshalJSON(m)
 	}
@@ -103,6 +128,8 @@ func (m MessageBodyBytes) Format(format LogFormat) ([]byte, error) {
 	switch format {
 	case LogFormatRawJSON:
 		return strutils.MarshalJSON(string(m))
+	case LogFormatHTML:
+		return []byte(escapeHTMLLines(string(m))), nil
 	default:
 	}
 	return m, nil
@@ -116,6 +143,21 @@ func (e errorBody) Format(format LogFormat) ([]byte, error) {
 		return gperr.Plain(e.Error), nil
 	case LogFormatMarkdown:
 		return gperr.Markdown(e.Error), nil
+	case LogFormatHTML:
+		return []byte("<pre>" + html.EscapeString(string(gperr.Plain(e.Error))) + "</pre>"), nil
 	}
 	return gperr.Markdown(e.Error), nil
 }
+
+func escapeHTMLLines(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+// truncate shortens s to at most n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:n-1]) + "…"
+}
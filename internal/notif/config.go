@@ -43,6 +43,18 @@ func (cfg *NotificationConfig) UnmarshalMap(m map[string]any) (err error) {
 		cfg.Provider = &GotifyClient{}
 	case ProviderNtfy:
 		cfg.Provider = &Ntfy{}
+	case ProviderSMTP:
+		cfg.Provider = &SMTP{}
+	case ProviderTelegram:
+		cfg.Provider = &Telegram{}
+	case ProviderSlack:
+		cfg.Provider = &Slack{}
+	case ProviderMatrix:
+		cfg.Provider = &Matrix{}
+	case ProviderPushover:
+		cfg.Provider = &Pushover{}
+	case ProviderDiscord:
+		cfg.Provider = &Discord{}
 	default:
 		return gperr.PrependSubject(ErrUnknownNotifProvider, cfg.ProviderName).
 			Withf("expect %s", strings.Join(AvailableProviders, ", "))
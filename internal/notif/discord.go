@@ -0,0 +1,117 @@
+package notif
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Discord is a provider for Discord webhooks, rendered as an embed.
+//
+// See https://discord.com/developers/docs/resources/webhook#execute-webhook
+type Discord struct {
+	ProviderBase
+	Username  string `json:"username,omitempty"`
+	AvatarURL string `json:"avatar_url,omitempty" validate:"omitempty,url"`
+}
+
+type (
+	discordMessage struct {
+		Username  string         `json:"username,omitempty"`
+		AvatarURL string         `json:"avatar_url,omitempty"`
+		Embeds    []discordEmbed `json:"embeds"`
+	}
+	discordEmbed struct {
+		Title       string         `json:"title,omitempty"`
+		Description string         `json:"description,omitempty"`
+		Color       Color          `json:"color"`
+		Fields      []discordField `json:"fields,omitempty"`
+		Timestamp   string         `json:"timestamp"`
+	}
+	discordField struct {
+		Name   string `json:"name"`
+		Value  string `json:"value"`
+		Inline bool   `json:"inline,omitempty"`
+	}
+	discordError struct {
+		Code    int             `json:"code"`
+		Message string          `json:"message"`
+		Errors  json.RawMessage `json:"errors,omitempty"`
+	}
+)
+
+const (
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+	discordMaxFields      = 25
+	discordMaxFieldName   = 256
+	discordMaxFieldValue  = 1024
+	// discordInlineFieldLen is the longest field value rendered inline (side by side).
+	discordInlineFieldLen = 40
+)
+
+// GetToken implements Provider.
+//
+// Webhook URLs carry their own secret.
+func (d *Discord) GetToken() string {
+	return ""
+}
+
+// MarshalMessage implements Provider.
+func (d *Discord) MarshalMessage(logMsg *LogMessage) ([]byte, error) {
+	embed := discordEmbed{
+		Title:     truncate(logMsg.Title, discordMaxTitle),
+		Color:     logMsg.Color,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if fields, ok := logMsg.Body.(FieldsBody); ok && len(fields) <= discordMaxFields {
+		embed.Fields = make([]discordField, 0, len(fields))
+		for _, field := range fields {
+			value := field.Value
+			if value == "" {
+				value = "-" // empty values are rejected
+			}
+			embed.Fields = append(embed.Fields, discordField{
+				Name:   truncate(field.Name, discordMaxFieldName),
+				Value:  truncate(value, discordMaxFieldValue),
+				Inline: len(value) <= discordInlineFieldLen,
+			})
+		}
+	} else {
+		body, err := logMsg.Body.Format(d.Format)
+		if err != nil {
+			return nil, err
+		}
+		embed.Description = truncate(string(body), discordMaxDescription)
+	}
+
+	return strutils.MarshalJSON(&discordMessage{
+		Username:  d.Username,
+		AvatarURL: d.AvatarURL,
+		Embeds:    []discordEmbed{embed},
+	})
+}
+
+// fmtError implements Provider.
+func (d *Discord) fmtError(respBody io.Reader) error {
+	body, err := io.ReadAll(respBody)
+	if err != nil || len(body) == 0 {
+		return ErrUnknownError
+	}
+	var errm discordError
+	if err := json.Unmarshal(body, &errm); err != nil || errm.Message == "" {
+		return rawError(body)
+	}
+	if len(errm.Errors) > 0 {
+		var detail bytes.Buffer
+		if json.Compact(&detail, errm.Errors) == nil {
+			return fmt.Errorf("%s (code %d): %s", errm.Message, errm.Code, detail.String())
+		}
+	}
+	return fmt.Errorf("%s (code %d)", errm.Message, errm.Code)
+}
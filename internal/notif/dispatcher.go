@@ -1,10 +1,13 @@
 package notif
 
 import (
+	"crypto/rand"
 	"math"
-	"math/rand/v2"
+	mathrand "math/rand/v2"
 	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/puzpuzpuz/xsync/v4"
@@ -16,11 +19,12 @@ import (
 type (
 	Dispatcher struct {
 		task        *task.Task
-		providers   *xsync.Map[Provider, struct{}]
+		providers   *xsync.Map[string, Provider]
+		routing     *RoutingConfig
+		groups      *groups
 		logCh       chan *LogMessage
 		logChMu     sync.Mutex
 		logChClosed bool
-		retryMsg    *xsync.Map[*RetryMessage, struct{}]
 		retryTicker *time.Ticker
 	}
 	LogMessage struct {
@@ -29,7 +33,12 @@ type (
 		Body  LogBody
 		Color Color
 
+		Source string // component that sent the message, e.g. SourceHealth
+		Route  string // alias of the route the message is about, if any
+
 		To []string
+
+		id string // set when dispatched and kept across retries, so providers can deduplicate sends
 	}
 
 	NotifyFunc func(msg *LogMessage)
@@ -48,11 +57,11 @@ const (
 func NewDispatcher(parent task.Parent) *Dispatcher {
 	disp := &Dispatcher{
 		task:        parent.Subtask("notification", true),
-		providers:   xsync.NewMap[Provider, struct{}](),
+		providers:   xsync.NewMap[string, Provider](),
 		logCh:       make(chan *LogMessage, 100),
-		retryMsg:    xsync.NewMap[*RetryMessage, struct{}](),
 		retryTicker: time.NewTicker(retryInterval),
 	}
+	disp.groups = newGroups(disp.dispatch)
 	go disp.start()
 	return disp
 }
@@ -76,11 +85,29 @@ func (disp *Dispatcher) enqueue(msg *LogMessage) bool {
 }
 
 func (disp *Dispatcher) RegisterProvider(cfg *NotificationConfig) {
-	disp.providers.Store(cfg.Provider, struct{}{})
+	disp.providers.Store(cfg.Provider.GetName(), cfg.Provider)
+}
+
+// SetRouting sets how notifications are routed, grouped and deduplicated.
+//
+// It must be called after registering providers and before notifying.
+func (disp *Dispatcher) SetRouting(cfg *RoutingConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if err := cfg.validateProviders(func(name string) bool {
+		_, ok := disp.providers.Load(name)
+		return ok
+	}); err != nil {
+		return err
+	}
+	disp.routing = cfg
+	return nil
 }
 
 func (disp *Dispatcher) start() {
 	defer func() {
+		disp.groups.stop()
 		disp.providers.Clear()
 		disp.closeLogCh()
 		disp.retryTicker.Stop()
@@ -95,9 +122,10 @@ func (disp *Dispatcher) start() {
 			if !ok {
 				return
 			}
-			go disp.dispatch(msg)
+			disp.route(msg)
 		case <-disp.retryTicker.C:
 			disp.processRetries()
+			disp.groups.gc()
 		}
 	}
 }
@@ -112,7 +140,27 @@ func (disp *Dispatcher) closeLogCh() {
 	disp.logChClosed = true
 }
 
-func (disp *Dispatcher) dispatch(msg *LogMessage) {
+// route sends msg through its deliveries, unless it is silenced.
+func (disp *Dispatcher) route(msg *LogMessage) {
+	if s := silencedBy(msg, time.Now()); s != nil {
+		log.Debug().
+			Str("title", msg.Title).
+			Str("silence", s.ID).
+			Msg("notification silenced")
+		return
+	}
+	for _, d := range disp.routing.resolve(msg) {
+		disp.groups.add(msg, d)
+	}
+}
+
+// dispatch sends msg to the providers named in to, or all providers if to is empty.
+func (disp *Dispatcher) dispatch(msg *LogMessage, to []string) {
+	// each dispatch is a new delivery, retries share its id
+	dispatched := *msg
+	dispatched.id = newMessageID()
+	msg = &dispatched
+
 	task := disp.task.Subtask("dispatcher", true)
 	defer task.Finish("notif dispatched")
 
@@ -121,49 +169,59 @@ func (disp *Dispatcher) dispatch(msg *LogMessage) {
 		Str("title", msg.Title).Logger()
 
 	var wg sync.WaitGroup
-	for p := range disp.providers.Range {
-		if len(msg.To) > 0 && !slices.Contains(msg.To, p.GetName()) {
+	for name, p := range disp.providers.Range {
+		if len(to) > 0 && !slices.Contains(to, name) {
 			continue
 		}
-		wg.Add(1)
-		go func(p Provider) {
-			defer wg.Done()
+		wg.Go(func() {
 			if err := msg.notify(task.Context(), p); err != nil {
-				msg := &RetryMessage{
+				now := time.Now()
+				retry := &RetryMessage{
 					Message:   msg,
-					Trials:    0,
-					Provider:  p,
-					NextRetry: time.Now().Add(calculateBackoffDelay(0)),
+					Provider:  name,
+					NextRetry: now.Add(calculateBackoffDelay(0)),
+					CreatedAt: now,
 				}
-				disp.retryMsg.Store(msg, struct{}{})
-				l.Debug().Err(err).EmbedObject(msg).Msg("notification failed, scheduling retry")
+				retries.Store(rand.Text(), retry)
+				l.Debug().Err(err).EmbedObject(retry).Msg("notification failed, scheduling retry")
 			} else {
-				l.Debug().Str("provider", p.GetName()).Msg("notification sent successfully")
+				l.Debug().Str("provider", name).Msg("notification sent successfully")
 			}
-		}(p)
+		})
 	}
 	wg.Wait()
 }
 
 func (disp *Dispatcher) processRetries() {
-	if disp.retryMsg.Size() == 0 {
+	if retries.Size() == 0 {
 		return
 	}
 
 	now := time.Now()
 
-	readyMessages := make([]*RetryMessage, 0)
-	for msg := range disp.retryMsg.Range {
-		if now.After(msg.NextRetry) {
-			readyMessages = append(readyMessages, msg)
-			disp.retryMsg.Delete(msg)
+	ready := make(map[string]*RetryMessage)
+	for id, msg := range retries.Range {
+		if now.Sub(msg.CreatedAt) > maxRetryAge {
+			retries.Delete(id)
+			continue
+		}
+		if !now.After(msg.NextRetry) {
+			continue
+		}
+		// leave retries of providers this dispatcher does not have to their dispatcher
+		if _, ok := disp.providers.Load(msg.Provider); !ok {
+			continue
+		}
+		// claim the retry, another dispatcher may be processing it
+		if _, ok := retries.LoadAndDelete(id); ok {
+			ready[id] = msg
 		}
 	}
 
-	disp.retry(readyMessages)
+	disp.retry(ready)
 }
 
-func (disp *Dispatcher) retry(messages []*RetryMessage) {
+func (disp *Dispatcher) retry(messages map[string]*RetryMessage) {
 	if len(messages) == 0 {
 		return
 	}
@@ -174,31 +232,38 @@ func (disp *Dispatcher) retry(messages []*RetryMessage) {
 	successCount := 0
 	failureCount := 0
 
-	for _, msg := range messages {
+	for id, msg := range messages {
 		maxTrials := maxRetries[msg.Message.Level]
 		log.Debug().EmbedObject(msg).Msg("attempting notification retry")
 
-		err := msg.Message.notify(task.Context(), msg.Provider)
+		provider, ok := disp.providers.Load(msg.Provider)
+		if !ok { // removed since claimed
+			retries.Store(id, msg)
+			continue
+		}
+
+		err := msg.Message.notify(task.Context(), provider)
 		if err == nil {
-			msg.NextRetry = time.Time{}
 			successCount++
 			log.Debug().EmbedObject(msg).Msg("notification retry succeeded")
 			continue
 		}
 
-		msg.Trials++
 		failureCount++
 
-		if msg.Trials >= maxTrials {
-			log.Warn().Err(err).EmbedObject(msg).Msg("notification permanently failed after max retries")
+		// stored retries may be saved concurrently, so they are replaced instead of modified
+		next := *msg
+		next.Trials++
+		if next.Trials >= maxTrials {
+			log.Warn().Err(err).EmbedObject(&next).Msg("notification permanently failed after max retries")
 			continue
 		}
 
 		// Schedule next retry with exponential backoff
-		msg.NextRetry = time.Now().Add(calculateBackoffDelay(msg.Trials))
-		disp.retryMsg.Store(msg, struct{}{})
+		next.NextRetry = time.Now().Add(calculateBackoffDelay(next.Trials))
+		retries.Store(id, &next)
 
-		log.Debug().EmbedObject(msg).Msg("notification retry failed, scheduled for later")
+		log.Debug().EmbedObject(&next).Msg("notification retry failed, scheduled for later")
 	}
 
 	log.Info().
@@ -208,6 +273,14 @@ func (disp *Dispatcher) retry(messages []*RetryMessage) {
 		Msg("notification retry batch completed")
 }
 
+// messageSeq makes message IDs unique within the process,
+// the timestamp prefix makes them unique across restarts.
+var messageSeq atomic.Uint64
+
+func newMessageID() string {
+	return strconv.FormatInt(time.Now().UnixMilli(), 36) + "." + strconv.FormatUint(messageSeq.Add(1), 36)
+}
+
 // calculateBackoffDelay implements exponential backoff with jitter.
 func calculateBackoffDelay(trials int) time.Duration {
 	if trials == 0 {
@@ -219,6 +292,6 @@ func calculateBackoffDelay(trials int) time.Duration {
 
 	// Add 20% jitter to prevent thundering herd
 	//nolint:gosec
-	jitter := delay * 0.2 * (rand.Float64() - 0.5) // -10% to +10%
+	jitter := delay * 0.2 * (mathrand.Float64() - 0.5) // -10% to +10%
 	return time.Duration(delay + jitter)
 }
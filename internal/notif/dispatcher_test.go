@@ -1,10 +1,12 @@
 package notif
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/stretchr/testify/require"
 	"github.com/yusing/goutils/task"
 )
@@ -121,3 +123,72 @@ func TestNewDispatcherIsNotVisibleOutsideOwningContext(t *testing.T) {
 	require.Same(t, disp, FromCtx(runtime.Context()))
 	require.IsType(t, noopNotifier{}, FromCtx(root.Context()))
 }
+
+type fakeProvider struct {
+	ProviderBase
+	sent chan *LogMessage
+}
+
+func (p *fakeProvider) MarshalMessage(msg *LogMessage) ([]byte, error) {
+	return msg.Body.Format(LogFormatPlain)
+}
+
+func (p *fakeProvider) send(_ context.Context, msg *LogMessage) error {
+	p.sent <- msg
+	return nil
+}
+
+func testDispatcherWithProvider(t *testing.T, name string) (*Dispatcher, *fakeProvider) {
+	t.Helper()
+	disp := testDispatcher(t, task.GetTestTask(t), "notification", 1)
+	disp.providers = xsync.NewMap[string, Provider]()
+	disp.groups = newGroups(disp.dispatch)
+	p := &fakeProvider{ProviderBase: ProviderBase{Name: name}, sent: make(chan *LogMessage, 1)}
+	disp.RegisterProvider(&NotificationConfig{Provider: p})
+	return disp, p
+}
+
+func TestDispatcherProcessesStoredRetries(t *testing.T) {
+	disp, p := testDispatcherWithProvider(t, "fake")
+
+	now := time.Now()
+	retries.Store("test-ready", &RetryMessage{Message: &LogMessage{Title: "retry"}, Provider: "fake", NextRetry: now.Add(-time.Second), CreatedAt: now})
+	retries.Store("test-later", &RetryMessage{Message: &LogMessage{Title: "later"}, Provider: "fake", NextRetry: now.Add(time.Hour), CreatedAt: now})
+	retries.Store("test-other", &RetryMessage{Message: &LogMessage{Title: "other"}, Provider: "other", NextRetry: now.Add(-time.Second), CreatedAt: now})
+	retries.Store("test-expired", &RetryMessage{Message: &LogMessage{Title: "expired"}, Provider: "other", CreatedAt: now.Add(-maxRetryAge - time.Second)})
+	t.Cleanup(func() {
+		for _, id := range []string{"test-ready", "test-later", "test-other", "test-expired"} {
+			retries.Delete(id)
+		}
+	})
+
+	disp.processRetries()
+
+	require.Equal(t, "retry", (<-p.sent).Title)
+	_, ok := retries.Load("test-ready")
+	require.False(t, ok, "sent retries are removed")
+	_, ok = retries.Load("test-later")
+	require.True(t, ok, "retries are kept until due")
+	_, ok = retries.Load("test-other")
+	require.True(t, ok, "retries of other providers are left to their dispatcher")
+	_, ok = retries.Load("test-expired")
+	require.False(t, ok, "expired retries are dropped")
+}
+
+func TestDispatcherSkipsSilenced(t *testing.T) {
+	disp, p := testDispatcherWithProvider(t, "fake")
+
+	silence := &Silence{Match: NotificationMatcher{Route: []string{"nas"}}, EndsAt: time.Now().Add(time.Hour)}
+	require.NoError(t, AddSilence(silence))
+	t.Cleanup(func() { DeleteSilence(silence.ID) })
+
+	disp.route(&LogMessage{Title: "silenced", Route: "nas"})
+	disp.route(&LogMessage{Title: "sent", Route: "app"})
+
+	require.Equal(t, "sent", (<-p.sent).Title)
+	select {
+	case msg := <-p.sent:
+		t.Fatalf("unexpected notification %q", msg.Title)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
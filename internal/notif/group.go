@@ -0,0 +1,201 @@
+package notif
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+type (
+	// groups batches notifications of the same group within the group wait,
+	// and holds the ones following a sent notification until the repeat interval ends.
+	groups struct {
+		mu     sync.Mutex
+		groups map[string]*group
+		send   func(msg *LogMessage, to []string)
+	}
+	group struct {
+		pending *LogMessage
+		count   int // notifications received in the current window
+		timer   *time.Timer
+
+		lastState      string // state of the last sent notification
+		lastSentAt     time.Time
+		repeatInterval time.Duration
+
+		held        *LogMessage // latest notification within the repeat interval
+		heldCount   int
+		repeatTimer *time.Timer
+	}
+
+	// groupedBody notes how many notifications a grouped one replaces.
+	groupedBody struct {
+		LogBody
+		grouped int
+	}
+)
+
+func newGroups(send func(msg *LogMessage, to []string)) *groups {
+	return &groups{
+		groups: make(map[string]*group),
+		send:   send,
+	}
+}
+
+// groupKey identifies the group of msg, i.e. the same source and route.
+// Notifications not tied to a route are grouped by title.
+func groupKey(msg *LogMessage, d delivery) string {
+	key := strconv.Itoa(d.route) + "\x00" + msg.Source + "\x00" + msg.Route
+	if msg.Route == "" {
+		key += "\x00" + msg.Title
+	}
+	return key
+}
+
+// state identifies notifications of a group reporting the same state, e.g. down or up.
+func state(msg *LogMessage) string {
+	return msg.Level.String() + "\x00" + msg.Title
+}
+
+// add sends msg after the group wait of d, unless it is superseded or repeated.
+func (gs *groups) add(msg *LogMessage, d delivery) {
+	if d.groupWait <= 0 && d.repeatInterval <= 0 {
+		go gs.send(msg, d.to)
+		return
+	}
+
+	key := groupKey(msg, d)
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	g, ok := gs.groups[key]
+	if !ok {
+		g = new(group)
+		gs.groups[key] = g
+	}
+
+	if d.groupWait <= 0 {
+		gs.flushLocked(g, msg, 1, d)
+		return
+	}
+
+	g.pending = msg
+	g.count++
+	if g.timer == nil {
+		g.timer = time.AfterFunc(d.groupWait, func() {
+			gs.mu.Lock()
+			defer gs.mu.Unlock()
+			msg, count := g.pending, g.count
+			g.pending, g.count, g.timer = nil, 0, nil
+			if msg != nil {
+				gs.flushLocked(g, msg, count, d)
+			}
+		})
+	}
+}
+
+// flushLocked sends msg, or holds it until the repeat interval since the last sent notification of the group ends.
+//
+// Only the latest held notification is sent, and only when its state differs from the last sent one,
+// so a flapping monitor sends at most one notification per repeat interval.
+func (gs *groups) flushLocked(g *group, msg *LogMessage, count int, d delivery) {
+	now := time.Now()
+	if d.repeatInterval > 0 && !g.lastSentAt.IsZero() && now.Sub(g.lastSentAt) < d.repeatInterval {
+		g.held = msg
+		g.heldCount += count
+		if g.repeatTimer == nil {
+			g.repeatTimer = time.AfterFunc(g.lastSentAt.Add(d.repeatInterval).Sub(now), func() {
+				gs.mu.Lock()
+				defer gs.mu.Unlock()
+				msg, count := g.held, g.heldCount
+				g.held, g.heldCount, g.repeatTimer = nil, 0, nil
+				if msg == nil {
+					return
+				}
+				if state(msg) == g.lastState {
+					log.Debug().
+						Str("title", msg.Title).
+						Int("count", count).
+						Msg("notification suppressed as repeated")
+					return
+				}
+				gs.sendLocked(g, msg, count, d)
+			})
+		}
+		return
+	}
+	gs.sendLocked(g, msg, count, d)
+}
+
+func (gs *groups) sendLocked(g *group, msg *LogMessage, count int, d delivery) {
+	g.lastState, g.lastSentAt, g.repeatInterval = state(msg), time.Now(), d.repeatInterval
+
+	if count > 1 {
+		grouped := *msg
+		grouped.Body = withGroupedCount(msg.Body, count)
+		msg = &grouped
+	}
+	go gs.send(msg, d.to)
+}
+
+// gc removes groups with nothing pending that can no longer suppress anything.
+func (gs *groups) gc() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for key, g := range gs.groups {
+		if g.timer == nil && g.repeatTimer == nil && time.Since(g.lastSentAt) >= g.repeatInterval {
+			delete(gs.groups, key)
+		}
+	}
+}
+
+// stop cancels pending notifications.
+func (gs *groups) stop() {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	for _, g := range gs.groups {
+		if g.timer != nil {
+			g.timer.Stop()
+		}
+		if g.repeatTimer != nil {
+			g.repeatTimer.Stop()
+		}
+	}
+	clear(gs.groups)
+}
+
+func withGroupedCount(body LogBody, count int) LogBody {
+	if body == nil {
+		body = FieldsBody(nil)
+	}
+	// keep FieldsBody for providers that render fields natively
+	if fields, ok := body.(FieldsBody); ok {
+		grouped := make(FieldsBody, len(fields), len(fields)+1)
+		copy(grouped, fields)
+		grouped.Add("Grouped", fmt.Sprintf("latest of %d notifications", count))
+		return grouped
+	}
+	return groupedBody{LogBody: body, grouped: count}
+}
+
+func (b groupedBody) Format(format LogFormat) ([]byte, error) {
+	body, err := b.LogBody.Format(format)
+	if err != nil || format == LogFormatRawJSON {
+		return body, err
+	}
+	body = slices.Clip(body) // body may alias the original message
+	note := fmt.Sprintf("latest of %d notifications", b.grouped)
+	switch format {
+	case LogFormatHTML:
+		return fmt.Appendf(body, "<br><em>%s</em>", note), nil
+	case LogFormatMarkdown:
+		return fmt.Appendf(body, "\n\n_%s_", note), nil
+	default:
+		return fmt.Appendf(body, "\n\n%s", note), nil
+	}
+}
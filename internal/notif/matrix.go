@@ -0,0 +1,113 @@
+package notif
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Matrix is a provider for the Matrix client-server API.
+//
+// URL is the homeserver and Token is the access token of the sending user.
+//
+// See https://spec.matrix.org/latest/client-server-api/#put_matrixclientv3roomsroomidsendeventtypetxnid
+type Matrix struct {
+	ProviderBase
+	RoomID string `json:"room_id"`
+}
+
+type (
+	matrixMessage struct {
+		MsgType       string `json:"msgtype"`
+		Body          string `json:"body"`
+		Format        string `json:"format"`
+		FormattedBody string `json:"formatted_body"`
+	}
+	matrixError struct {
+		ErrCode string `json:"errcode"`
+		Error   string `json:"error"`
+	}
+)
+
+// Validate implements the utils.CustomValidator interface.
+func (m *Matrix) Validate() error {
+	var errs gperr.Builder
+	if err := m.ProviderBase.Validate(); err != nil {
+		errs.Add(err)
+	}
+	if m.Token == "" {
+		errs.Adds("token is required")
+	}
+	if m.RoomID == "" {
+		errs.Adds("room_id is required")
+	}
+	return errs.Error()
+}
+
+// GetURL implements Provider, it has a new transaction ID on every call.
+func (m *Matrix) GetURL() string {
+	return m.sendURL(newMessageID())
+}
+
+// messageURL uses the message ID as the transaction ID,
+// so the homeserver drops a retried message that was delivered before.
+func (m *Matrix) messageURL(logMsg *LogMessage) string {
+	if logMsg.id == "" {
+		return m.GetURL()
+	}
+	return m.sendURL(logMsg.id)
+}
+
+func (m *Matrix) sendURL(txnID string) string {
+	return m.URL + "/_matrix/client/v3/rooms/" + url.PathEscape(m.RoomID) + "/send/m.room.message/" + txnID
+}
+
+// GetMethod implements Provider.
+func (m *Matrix) GetMethod() string {
+	return http.MethodPut
+}
+
+// MarshalMessage implements Provider.
+func (m *Matrix) MarshalMessage(logMsg *LogMessage) ([]byte, error) {
+	plain, err := logMsg.Body.Format(LogFormatPlain)
+	if err != nil {
+		return nil, err
+	}
+	formatted, err := logMsg.Body.Format(LogFormatHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	title := html.EscapeString(logMsg.Title)
+	if logMsg.Color != 0 {
+		title = fmt.Sprintf(`<font data-mx-color="#%06x">%s</font>`, uint(logMsg.Color), title)
+	}
+
+	return strutils.MarshalJSON(&matrixMessage{
+		MsgType:       "m.notice",
+		Body:          logMsg.Title + "\n" + string(plain),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: "<strong>" + title + "</strong><br>" + string(formatted),
+	})
+}
+
+// fmtError implements Provider.
+func (m *Matrix) fmtError(respBody io.Reader) error {
+	var errm matrixError
+	if err := strutils.NewJSONDecoder(respBody).Decode(&errm); err != nil {
+		return fmt.Errorf("failed to decode err response: %w", err)
+	}
+	if errm.ErrCode == "" {
+		return ErrUnknownError
+	}
+	if errm.Error == "" {
+		return errors.New(errm.ErrCode)
+	}
+	return fmt.Errorf("%s: %s", errm.ErrCode, errm.Error)
+}
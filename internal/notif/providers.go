@@ -26,31 +26,64 @@ type (
 
 		fmtError(respBody io.Reader) error
 	}
+	// sender is implemented by providers that do not deliver over a single HTTP request.
+	sender interface {
+		send(ctx context.Context, logMsg *LogMessage) error
+	}
+	// messageURLer is implemented by providers whose URL depends on the message.
+	messageURLer interface {
+		messageURL(logMsg *LogMessage) string
+	}
 	ProviderCreateFunc func(map[string]any) (Provider, error)
 	ProviderConfig     map[string]any
 )
 
 const (
-	ProviderGotify  = "gotify"
-	ProviderNtfy    = "ntfy"
-	ProviderWebhook = "webhook"
+	ProviderGotify   = "gotify"
+	ProviderNtfy     = "ntfy"
+	ProviderWebhook  = "webhook"
+	ProviderSMTP     = "smtp"
+	ProviderTelegram = "telegram"
+	ProviderSlack    = "slack"
+	ProviderMatrix   = "matrix"
+	ProviderPushover = "pushover"
+	ProviderDiscord  = "discord"
 )
 
-var AvailableProviders = []string{ProviderGotify, ProviderNtfy, ProviderWebhook}
+var AvailableProviders = []string{
+	ProviderGotify, ProviderNtfy, ProviderWebhook,
+	ProviderSMTP, ProviderTelegram, ProviderSlack,
+	ProviderMatrix, ProviderPushover, ProviderDiscord,
+}
+
+const (
+	httpTimeout = 2 * time.Second
+	sendTimeout = 10 * time.Second
+)
 
 func (msg *LogMessage) notify(ctx context.Context, provider Provider) error {
+	if s, ok := provider.(sender); ok {
+		ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+		return s.send(ctx, msg)
+	}
+
 	body, err := provider.MarshalMessage(msg)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
 	defer cancel()
 
+	url := provider.GetURL()
+	if p, ok := provider.(messageURLer); ok {
+		url = p.messageURL(msg)
+	}
 	req, err := http.NewRequestWithContext(
 		ctx,
 		provider.GetMethod(),
-		provider.GetURL(),
+		url,
 		bytes.NewReader(body),
 	)
 	if err != nil {
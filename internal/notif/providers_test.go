@@ -0,0 +1,343 @@
+package notif
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+type capturedRequest struct {
+	method string
+	path   string
+	header http.Header
+	body   map[string]any
+}
+
+// serveProvider starts a server that captures the request and replies with status and respBody.
+func serveProvider(t *testing.T, status int, respBody string) (string, <-chan capturedRequest) {
+	t.Helper()
+	reqs := make(chan capturedRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		captured := capturedRequest{method: r.Method, path: r.URL.EscapedPath(), header: r.Header}
+		_ = json.NewDecoder(r.Body).Decode(&captured.body)
+		reqs <- captured
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, respBody)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, reqs
+}
+
+func testLogMessage() *LogMessage {
+	return &LogMessage{
+		Level: zerolog.ErrorLevel,
+		Title: "Service <app> is down",
+		Body: FieldsBody{
+			{Name: "Service", Value: "app"},
+			{Name: "Reason", Value: "connection refused"},
+		},
+		Color: ColorError,
+	}
+}
+
+func TestTelegram(t *testing.T) {
+	url, reqs := serveProvider(t, http.StatusOK, `{"ok":true}`)
+	provider := &Telegram{ProviderBase: ProviderBase{Name: "tg", URL: url, Token: "123:abc"}, ChatID: "-100"}
+	require.NoError(t, provider.Validate())
+	require.NoError(t, testLogMessage().notify(t.Context(), provider))
+
+	req := <-reqs
+	require.Equal(t, "/bot123:abc/sendMessage", req.path)
+	require.Empty(t, req.header.Get("Authorization"))
+	require.Equal(t, "-100", req.body["chat_id"])
+	require.Equal(t, "HTML", req.body["parse_mode"])
+	require.Equal(t, "<b>Service &lt;app&gt; is down</b>\nService: app\nReason: connection refused\n", req.body["text"])
+	require.Nil(t, req.body["disable_notification"])
+
+	url, _ = serveProvider(t, http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`)
+	provider.URL = url
+	require.ErrorContains(t, testLogMessage().notify(t.Context(), provider), "http status 400: Bad Request: chat not found")
+}
+
+func TestTelegramDefaultURL(t *testing.T) {
+	provider := &Telegram{ProviderBase: ProviderBase{Name: "tg", Token: "123:abc"}}
+	require.ErrorContains(t, provider.Validate(), "chat_id is required")
+	require.Equal(t, telegramDefaultURL, provider.URL)
+}
+
+func TestSlack(t *testing.T) {
+	url, reqs := serveProvider(t, http.StatusOK, "ok")
+	provider := &Slack{ProviderBase: ProviderBase{Name: "slack", URL: url, Token: "ignored"}}
+	require.NoError(t, provider.Validate())
+	require.NoError(t, testLogMessage().notify(t.Context(), provider))
+
+	req := <-reqs
+	require.Empty(t, req.header.Get("Authorization"))
+	require.Equal(t, "Service <app> is down", req.body["text"])
+	attachment := req.body["attachments"].([]any)[0].(map[string]any)
+	require.Equal(t, "#ff0000", attachment["color"])
+	blocks := attachment["blocks"].([]any)
+	require.Len(t, blocks, 2)
+	require.Equal(t, "header", blocks[0].(map[string]any)["type"])
+	fields := blocks[1].(map[string]any)["fields"].([]any)
+	require.Equal(t, "*Service*\napp", fields[0].(map[string]any)["text"])
+
+	url, _ = serveProvider(t, http.StatusBadRequest, "invalid_blocks\n")
+	provider.URL = url
+	require.ErrorContains(t, testLogMessage().notify(t.Context(), provider), "http status 400: invalid_blocks")
+}
+
+func TestSlackListBody(t *testing.T) {
+	provider := &Slack{ProviderBase: ProviderBase{Format: LogFormatMarkdown}}
+	data, err := provider.MarshalMessage(&LogMessage{Body: ListBody{"a<b", "c"}})
+	require.NoError(t, err)
+
+	var msg slackMessage
+	require.NoError(t, json.Unmarshal(data, &msg))
+	blocks := msg.Attachments[0].Blocks
+	require.Len(t, blocks, 1) // no header without title
+	require.Equal(t, "• a&lt;b\n• c\n", blocks[0].Text.Text)
+}
+
+func TestMatrix(t *testing.T) {
+	url, reqs := serveProvider(t, http.StatusOK, `{"event_id":"$1"}`)
+	provider := &Matrix{ProviderBase: ProviderBase{Name: "matrix", URL: url, Token: "syt_token"}, RoomID: "!room:example.org"}
+	require.NoError(t, provider.Validate())
+	require.NoError(t, testLogMessage().notify(t.Context(), provider))
+
+	req := <-reqs
+	require.Equal(t, http.MethodPut, req.method)
+	require.True(t, strings.HasPrefix(req.path, "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/"), req.path)
+	require.Equal(t, "Bearer syt_token", req.header.Get("Authorization"))
+	require.Equal(t, "m.notice", req.body["msgtype"])
+	require.Equal(t, "org.matrix.custom.html", req.body["format"])
+	require.Equal(t,
+		`<strong><font data-mx-color="#ff0000">Service &lt;app&gt; is down</font></strong><br><strong>Service</strong><br>app<br><strong>Reason</strong><br>connection refused<br>`,
+		req.body["formatted_body"],
+	)
+	txnID := path.Base(req.path)
+
+	// retries of a message reuse its transaction id
+	msg := testLogMessage()
+	msg.id = newMessageID()
+	require.NoError(t, msg.notify(t.Context(), provider))
+	first := <-reqs
+	require.NoError(t, msg.notify(t.Context(), provider))
+	retried := <-reqs
+	require.Equal(t, msg.id, path.Base(first.path))
+	require.Equal(t, first.path, retried.path)
+	require.NotEqual(t, txnID, msg.id, "messages must have unique transaction ids")
+
+	url, _ = serveProvider(t, http.StatusForbidden, `{"errcode":"M_FORBIDDEN","error":"not in room"}`)
+	provider.URL = url
+	require.ErrorContains(t, testLogMessage().notify(t.Context(), provider), "http status 403: M_FORBIDDEN: not in room")
+}
+
+func TestPushover(t *testing.T) {
+	url, reqs := serveProvider(t, http.StatusOK, `{"status":1}`)
+	provider := &Pushover{ProviderBase: ProviderBase{Name: "pushover", URL: url, Token: "app"}, User: "user"}
+	require.NoError(t, provider.Validate())
+
+	msg := testLogMessage()
+	msg.Level = zerolog.FatalLevel
+	require.NoError(t, msg.notify(t.Context(), provider))
+
+	req := <-reqs
+	require.Empty(t, req.header.Get("Authorization"))
+	require.Equal(t, "app", req.body["token"])
+	require.Equal(t, "user", req.body["user"])
+	require.InDelta(t, 2, req.body["priority"], 0)
+	require.InDelta(t, pushoverRetry, req.body["retry"], 0)
+	require.InDelta(t, pushoverExpire, req.body["expire"], 0)
+
+	url, _ = serveProvider(t, http.StatusBadRequest, `{"user":"invalid","errors":["user identifier is invalid"],"status":0}`)
+	provider.URL = url
+	require.ErrorContains(t, testLogMessage().notify(t.Context(), provider), "http status 400: user identifier is invalid")
+}
+
+func TestDiscord(t *testing.T) {
+	url, reqs := serveProvider(t, http.StatusNoContent, "")
+	provider := &Discord{ProviderBase: ProviderBase{Name: "discord", URL: url}}
+	require.NoError(t, provider.Validate())
+	require.NoError(t, testLogMessage().notify(t.Context(), provider))
+
+	req := <-reqs
+	embed := req.body["embeds"].([]any)[0].(map[string]any)
+	require.Equal(t, "Service <app> is down", embed["title"])
+	require.InDelta(t, float64(ColorError), embed["color"], 0)
+	require.Len(t, embed["fields"], 2)
+	require.Nil(t, embed["description"])
+
+	url, _ = serveProvider(t, http.StatusBadRequest, `{"message":"Invalid Form Body","code":50035}`)
+	provider.URL = url
+	require.ErrorContains(t, testLogMessage().notify(t.Context(), provider), "http status 400: Invalid Form Body (code 50035)")
+}
+
+func TestTruncate(t *testing.T) {
+	require.Equal(t, "abc", truncate("abc", 3))
+	require.Equal(t, "ab…", truncate("abcd", 3))
+	require.Equal(t, "日本…", truncate("日本語です", 3))
+}
+
+func TestSMTPValidate(t *testing.T) {
+	provider := &SMTP{ProviderBase: ProviderBase{Name: "mail"}, Host: "smtp.example.com", From: "GoDoxy <godoxy@example.com>", To: []string{"ops@example.com"}}
+	require.NoError(t, provider.Validate())
+	require.Equal(t, SMTPTLSStartTLS, provider.TLS)
+	require.Equal(t, 587, provider.Port)
+
+	provider = &SMTP{ProviderBase: ProviderBase{Name: "mail"}, Host: "smtp.example.com", TLS: "ssl", From: "invalid"}
+	err := provider.Validate()
+	require.ErrorContains(t, err, "invalid tls mode")
+	require.ErrorContains(t, err, "to is required")
+	require.ErrorContains(t, err, "from")
+}
+
+func TestSMTPSend(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	type envelope struct {
+		from, to string
+		data     string
+	}
+	received := make(chan envelope, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { _, _ = io.WriteString(conn, s+"\r\n") }
+		reply("220 localhost ESMTP")
+		var env envelope
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.TrimSpace(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				env.from = strings.TrimPrefix(cmd, "MAIL FROM:")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				env.to = strings.TrimPrefix(cmd, "RCPT TO:")
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				env.data = data.String()
+				reply("250 queued")
+				received <- env
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 unknown command")
+			}
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	provider := &SMTP{
+		ProviderBase: ProviderBase{Name: "mail"},
+		Host:         "127.0.0.1",
+		Port:         portNum,
+		TLS:          SMTPTLSNone,
+		From:         "GoDoxy <godoxy@example.com>",
+		To:           []string{"ops@example.com"},
+	}
+	require.NoError(t, provider.Validate())
+	require.NoError(t, testLogMessage().notify(t.Context(), provider))
+
+	env := <-received
+	require.Equal(t, "<godoxy@example.com>", env.from)
+	require.Equal(t, "<ops@example.com>", env.to)
+
+	msg, err := mail.ReadMessage(strings.NewReader(env.data))
+	require.NoError(t, err)
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+	require.Equal(t, "Service <app> is down", subject)
+	require.Equal(t, "1", msg.Header.Get("X-Priority"))
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/alternative", mediaType)
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		content, err := io.ReadAll(quotedprintable.NewReader(part))
+		require.NoError(t, err)
+		// line endings are normalized to CRLF on the wire
+		parts = append(parts, part.Header.Get("Content-Type")+"\n"+strings.ReplaceAll(string(content), "\r\n", "\n"))
+	}
+	require.Len(t, parts, 2)
+	require.Equal(t, "text/plain; charset=utf-8\nService: app\nReason: connection refused\n", parts[0])
+	require.Contains(t, parts[1], `<h3 style="color:#ff0000">Service &lt;app&gt; is down</h3>`)
+}
+
+func TestSMTPRequiresStartTLS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		_, _ = io.WriteString(conn, "220 localhost ESMTP\r\n")
+		_, _ = r.ReadString('\n') // EHLO
+		_, _ = io.WriteString(conn, "250 localhost\r\n")
+		_, _ = r.ReadString('\n')
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	portNum, _ := strconv.Atoi(port)
+	provider := &SMTP{
+		ProviderBase: ProviderBase{Name: "mail"},
+		Host:         "127.0.0.1",
+		Port:         portNum,
+		From:         "godoxy@example.com",
+		To:           []string{"ops@example.com"},
+	}
+	require.NoError(t, provider.Validate())
+	require.ErrorIs(t, testLogMessage().notify(t.Context(), provider), ErrSMTPNoStartTLS)
+}
@@ -0,0 +1,128 @@
+package notif
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rs/zerolog"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Pushover is a provider for the Pushover message API.
+//
+// Token is the application token, User is the user or group key.
+//
+// See https://pushover.net/api
+type Pushover struct {
+	ProviderBase
+	User   string `json:"user"`
+	Device string `json:"device,omitempty"`
+	Sound  string `json:"sound,omitempty"`
+}
+
+type (
+	pushoverMessage struct {
+		Token    string `json:"token"`
+		User     string `json:"user"`
+		Device   string `json:"device,omitempty"`
+		Title    string `json:"title,omitempty"`
+		Message  string `json:"message"`
+		Priority int    `json:"priority"`
+		Sound    string `json:"sound,omitempty"`
+		Retry    int    `json:"retry,omitempty"`
+		Expire   int    `json:"expire,omitempty"`
+	}
+	pushoverError struct {
+		Status int      `json:"status"`
+		Errors []string `json:"errors"`
+	}
+)
+
+const (
+	pushoverDefaultURL = "https://api.pushover.net/1/messages.json"
+	pushoverMaxTitle   = 250
+	pushoverMaxMessage = 1024
+
+	// emergency priority repeats the notification every pushoverRetry seconds
+	// until acknowledged or pushoverExpire seconds have passed.
+	pushoverPriorityEmergency = 2
+	pushoverRetry             = 60
+	pushoverExpire            = 3600
+)
+
+// Validate implements the utils.CustomValidator interface.
+func (p *Pushover) Validate() error {
+	var errs gperr.Builder
+	if err := p.validateDefaultURL(pushoverDefaultURL); err != nil {
+		errs.Add(err)
+	}
+	if p.Token == "" {
+		errs.Adds("token is required")
+	}
+	if p.User == "" {
+		errs.Adds("user is required")
+	}
+	return errs.Error()
+}
+
+// GetToken implements Provider.
+//
+// The application token is sent in the message body.
+func (p *Pushover) GetToken() string {
+	return ""
+}
+
+// MarshalMessage implements Provider.
+func (p *Pushover) MarshalMessage(logMsg *LogMessage) ([]byte, error) {
+	var priority int
+	switch logMsg.Level {
+	case zerolog.DebugLevel, zerolog.TraceLevel:
+		priority = -2
+	case zerolog.InfoLevel:
+		priority = -1
+	case zerolog.ErrorLevel:
+		priority = 1
+	case zerolog.FatalLevel, zerolog.PanicLevel:
+		priority = pushoverPriorityEmergency
+	}
+
+	// Pushover renders neither markdown nor block-level HTML
+	body, err := logMsg.Body.Format(LogFormatPlain)
+	if err != nil {
+		return nil, err
+	}
+	message := string(body)
+	if message == "" {
+		message = logMsg.Title // message is required
+	}
+
+	msg := &pushoverMessage{
+		Token:    p.Token,
+		User:     p.User,
+		Device:   p.Device,
+		Title:    truncate(logMsg.Title, pushoverMaxTitle),
+		Message:  truncate(message, pushoverMaxMessage),
+		Priority: priority,
+		Sound:    p.Sound,
+	}
+	if priority == pushoverPriorityEmergency {
+		msg.Retry = pushoverRetry
+		msg.Expire = pushoverExpire
+	}
+	return strutils.MarshalJSON(msg)
+}
+
+// fmtError implements Provider.
+func (p *Pushover) fmtError(respBody io.Reader) error {
+	var errm pushoverError
+	if err := strutils.NewJSONDecoder(respBody).Decode(&errm); err != nil {
+		return fmt.Errorf("failed to decode err response: %w", err)
+	}
+	if len(errm.Errors) == 0 {
+		return ErrUnknownError
+	}
+	return errors.New(strings.Join(errm.Errors, ", "))
+}
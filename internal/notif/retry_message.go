@@ -4,13 +4,43 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
+	"github.com/yusing/godoxy/internal/jsonstore"
+	strutils "github.com/yusing/goutils/strings"
 )
 
+// RetryMessage is a notification that failed to send to a provider.
+//
+// The provider is looked up by name when the retry is due,
+// so pending retries survive restarts and config reloads.
 type RetryMessage struct {
 	Message   *LogMessage
 	Trials    int
-	Provider  Provider
+	Provider  string
 	NextRetry time.Time
+	CreatedAt time.Time
+}
+
+// retryMessageJSON is the persisted form of RetryMessage.
+type retryMessageJSON struct {
+	ID        string     `json:"id,omitempty"`
+	Provider  string     `json:"provider"`
+	Trials    int        `json:"trials"`
+	NextRetry time.Time  `json:"next_retry"`
+	CreatedAt time.Time  `json:"created_at"`
+	Level     string     `json:"level"`
+	Title     string     `json:"title"`
+	Body      storedBody `json:"body"`
+	Color     Color      `json:"color,omitempty"`
+	Source    string     `json:"source,omitempty"`
+	Route     string     `json:"route,omitempty"`
+}
+
+// storedBody keeps the body types that providers render differently,
+// other bodies are stored as their plain text.
+type storedBody struct {
+	Fields FieldsBody `json:"fields,omitempty"`
+	List   ListBody   `json:"list,omitempty"`
+	Text   string     `json:"text,omitempty"`
 }
 
 var maxRetries = map[zerolog.Level]int{
@@ -22,8 +52,17 @@ var maxRetries = map[zerolog.Level]int{
 	zerolog.PanicLevel: 10,
 }
 
+// maxRetryAge drops pending retries, e.g. for providers removed from the config.
+const maxRetryAge = 24 * time.Hour
+
+// retries persist across restarts and config reloads.
+//
+// A dispatcher takes a retry out of the store while sending it,
+// so it is sent once even when dispatchers overlap during a reload.
+var retries = jsonstore.Store[*RetryMessage]("notification_retries")
+
 func (msg *RetryMessage) MarshalZerologObject(e *zerolog.Event) {
-	e.Str("provider", msg.Provider.GetName()).
+	e.Str("provider", msg.Provider).
 		Int("trial", msg.Trials+1).
 		Str("title", msg.Message.Title)
 	if !msg.NextRetry.IsZero() {
@@ -31,3 +70,70 @@ func (msg *RetryMessage) MarshalZerologObject(e *zerolog.Event) {
 			Time("next_retry", msg.NextRetry)
 	}
 }
+
+// MarshalJSON implements json.Marshaler.
+func (msg *RetryMessage) MarshalJSON() ([]byte, error) {
+	stored := retryMessageJSON{
+		ID:        msg.Message.id,
+		Provider:  msg.Provider,
+		Trials:    msg.Trials,
+		NextRetry: msg.NextRetry,
+		CreatedAt: msg.CreatedAt,
+		Level:     msg.Message.Level.String(),
+		Title:     msg.Message.Title,
+		Color:     msg.Message.Color,
+		Source:    msg.Message.Source,
+		Route:     msg.Message.Route,
+	}
+	switch body := msg.Message.Body.(type) {
+	case nil:
+	case FieldsBody:
+		stored.Body.Fields = body
+	case ListBody:
+		stored.Body.List = body
+	default:
+		text, err := body.Format(LogFormatPlain)
+		if err != nil {
+			return nil, err
+		}
+		stored.Body.Text = string(text)
+	}
+	return strutils.MarshalJSON(stored)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (msg *RetryMessage) UnmarshalJSON(data []byte) error {
+	var stored retryMessageJSON
+	if err := strutils.UnmarshalJSON(data, &stored); err != nil {
+		return err
+	}
+	level, err := zerolog.ParseLevel(stored.Level)
+	if err != nil {
+		return err
+	}
+	var body LogBody
+	switch {
+	case stored.Body.Fields != nil:
+		body = stored.Body.Fields
+	case stored.Body.List != nil:
+		body = stored.Body.List
+	default:
+		body = MessageBody(stored.Body.Text)
+	}
+	*msg = RetryMessage{
+		Message: &LogMessage{
+			Level:  level,
+			Title:  stored.Title,
+			Body:   body,
+			Color:  stored.Color,
+			Source: stored.Source,
+			Route:  stored.Route,
+			id:     stored.ID,
+		},
+		Trials:    stored.Trials,
+		Provider:  stored.Provider,
+		NextRetry: stored.NextRetry,
+		CreatedAt: stored.CreatedAt,
+	}
+	return nil
+}
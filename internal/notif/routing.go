@@ -0,0 +1,159 @@
+package notif
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"time"
+
+	"github.com/rs/zerolog"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	// RoutingConfig routes notifications to providers by their source, level and route,
+	// and controls how often they are sent.
+	RoutingConfig struct {
+		// GroupWait collects notifications of the same group for this long,
+		// then sends only the latest one. Zero sends immediately.
+		GroupWait time.Duration `json:"group_wait,omitempty"`
+		// RepeatInterval suppresses a notification identical to the last one
+		// sent for its group within this interval. Zero disables deduplication.
+		RepeatInterval time.Duration        `json:"repeat_interval,omitempty"`
+		Routes         []*NotificationRoute `json:"routes,omitempty"`
+	} // @name NotificationRoutingConfig
+
+	// NotificationRoute sends matching notifications to the listed providers.
+	//
+	// Routes are evaluated in order, the first match wins unless Continue is set.
+	// Notifications without any matching route are sent to all providers.
+	NotificationRoute struct {
+		Match NotificationMatcher `json:"match"`
+		// To lists the provider names, empty means all providers.
+		To []string `json:"to,omitempty"`
+		// Mute drops matching notifications.
+		Mute bool `json:"mute,omitempty"`
+		// Continue evaluates the following routes after this one matched.
+		Continue bool `json:"continue,omitempty"`
+		// GroupWait and RepeatInterval override the defaults when non-zero.
+		GroupWait      time.Duration `json:"group_wait,omitempty"`
+		RepeatInterval time.Duration `json:"repeat_interval,omitempty"`
+	} // @name NotificationRoute
+
+	// NotificationMatcher matches notifications, empty fields match anything.
+	NotificationMatcher struct {
+		Source []string `json:"source,omitempty"` // e.g. health, acl, config, rules, maxmind, autocert
+		Route  []string `json:"route,omitempty"`  // route alias glob patterns
+		Level  string   `json:"level,omitempty"`  // minimum level
+
+		minLevel zerolog.Level
+	} // @name NotificationMatcher
+
+	// delivery is where and how a notification is sent after routing.
+	delivery struct {
+		route          int      // index of the matched route, -1 for the default route
+		to             []string // provider names, nil means all
+		groupWait      time.Duration
+		repeatInterval time.Duration
+	}
+)
+
+const (
+	SourceHealth   = "health"
+	SourceACL      = "acl"
+	SourceConfig   = "config"
+	SourceRules    = "rules"
+	SourceMaxMind  = "maxmind"
+	SourceAutocert = "autocert"
+)
+
+// Validate implements the serialization.CustomValidator interface.
+func (m *NotificationMatcher) Validate() error {
+	var errs gperr.Builder
+	m.minLevel = zerolog.TraceLevel
+	if m.Level != "" {
+		level, err := zerolog.ParseLevel(m.Level)
+		if err != nil {
+			errs.AddSubject(err, "level")
+		} else {
+			m.minLevel = level
+		}
+	}
+	for _, pattern := range m.Route {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs.AddSubject(err, "route")
+		}
+	}
+	return errs.Error()
+}
+
+// Matches reports whether msg matches all non-empty fields.
+func (m *NotificationMatcher) Matches(msg *LogMessage) bool {
+	if msg.Level < m.minLevel {
+		return false
+	}
+	if len(m.Source) > 0 && !slices.Contains(m.Source, msg.Source) {
+		return false
+	}
+	if len(m.Route) > 0 {
+		return slices.ContainsFunc(m.Route, func(pattern string) bool {
+			ok, _ := path.Match(pattern, msg.Route)
+			return ok
+		})
+	}
+	return true
+}
+
+// validateProviders checks that every route sends to registered providers.
+func (cfg *RoutingConfig) validateProviders(isRegistered func(name string) bool) error {
+	var errs gperr.Builder
+	for i, route := range cfg.Routes {
+		for _, name := range route.To {
+			if !isRegistered(name) {
+				errs.AddSubject(fmt.Errorf("%w: %q", ErrUnknownNotifProvider, name), fmt.Sprintf("routes[%d].to", i))
+			}
+		}
+	}
+	return errs.Error()
+}
+
+// resolve returns the deliveries of msg, none if it is muted.
+func (cfg *RoutingConfig) resolve(msg *LogMessage) []delivery {
+	if cfg == nil {
+		return []delivery{{route: -1, to: msg.To}}
+	}
+
+	var deliveries []delivery
+	for i, route := range cfg.Routes {
+		if !route.Match.Matches(msg) {
+			continue
+		}
+		if route.Mute {
+			return deliveries
+		}
+		d := delivery{
+			route:          i,
+			to:             route.To,
+			groupWait:      cmp.Or(route.GroupWait, cfg.GroupWait),
+			repeatInterval: cmp.Or(route.RepeatInterval, cfg.RepeatInterval),
+		}
+		// explicit recipients, e.g. from the rules notify command, take precedence
+		if len(msg.To) > 0 {
+			d.to = msg.To
+		}
+		deliveries = append(deliveries, d)
+		if !route.Continue {
+			return deliveries
+		}
+	}
+	if len(deliveries) == 0 {
+		deliveries = append(deliveries, delivery{
+			route:          -1,
+			to:             msg.To,
+			groupWait:      cfg.GroupWait,
+			repeatInterval: cfg.RepeatInterval,
+		})
+	}
+	return deliveries
+}
@@ -0,0 +1,179 @@
+package notif
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func testRoutingConfig(t *testing.T, cfg *RoutingConfig) *RoutingConfig {
+	t.Helper()
+	for _, route := range cfg.Routes {
+		require.NoError(t, route.Match.Validate())
+	}
+	return cfg
+}
+
+func TestNotificationMatcher(t *testing.T) {
+	m := NotificationMatcher{Source: []string{SourceHealth}, Route: []string{"media-*"}, Level: "warn"}
+	require.NoError(t, m.Validate())
+
+	require.True(t, m.Matches(&LogMessage{Level: zerolog.WarnLevel, Source: SourceHealth, Route: "media-jellyfin"}))
+	require.True(t, m.Matches(&LogMessage{Level: zerolog.ErrorLevel, Source: SourceHealth, Route: "media-sonarr"}))
+	require.False(t, m.Matches(&LogMessage{Level: zerolog.InfoLevel, Source: SourceHealth, Route: "media-jellyfin"}))
+	require.False(t, m.Matches(&LogMessage{Level: zerolog.WarnLevel, Source: SourceACL, Route: "media-jellyfin"}))
+	require.False(t, m.Matches(&LogMessage{Level: zerolog.WarnLevel, Source: SourceHealth, Route: "nas"}))
+
+	require.Error(t, (&NotificationMatcher{Level: "loud"}).Validate())
+	require.Error(t, (&NotificationMatcher{Route: []string{"["}}).Validate())
+
+	var empty NotificationMatcher
+	require.NoError(t, empty.Validate())
+	require.True(t, empty.Matches(&LogMessage{Level: zerolog.DebugLevel}))
+}
+
+func TestRoutingResolve(t *testing.T) {
+	cfg := testRoutingConfig(t, &RoutingConfig{
+		GroupWait: time.Minute,
+		Routes: []*NotificationRoute{
+			{Match: NotificationMatcher{Source: []string{SourceMaxMind}}, Mute: true},
+			{Match: NotificationMatcher{Source: []string{SourceHealth}}, To: []string{"telegram"}, Continue: true, GroupWait: time.Second},
+			{Match: NotificationMatcher{Level: "error"}, To: []string{"email"}},
+		},
+	})
+
+	require.Empty(t, cfg.resolve(&LogMessage{Source: SourceMaxMind, Level: zerolog.ErrorLevel}))
+
+	deliveries := cfg.resolve(&LogMessage{Source: SourceHealth, Level: zerolog.ErrorLevel})
+	require.Len(t, deliveries, 2)
+	require.Equal(t, delivery{route: 1, to: []string{"telegram"}, groupWait: time.Second}, deliveries[0])
+	require.Equal(t, delivery{route: 2, to: []string{"email"}, groupWait: time.Minute}, deliveries[1])
+
+	deliveries = cfg.resolve(&LogMessage{Source: SourceConfig, Level: zerolog.WarnLevel})
+	require.Equal(t, []delivery{{route: -1, groupWait: time.Minute}}, deliveries)
+
+	// explicit recipients take precedence over the route's
+	deliveries = cfg.resolve(&LogMessage{Source: SourceRules, Level: zerolog.ErrorLevel, To: []string{"gotify"}})
+	require.Equal(t, []delivery{{route: 2, to: []string{"gotify"}, groupWait: time.Minute}}, deliveries)
+
+	var nilCfg *RoutingConfig
+	require.Equal(t, []delivery{{route: -1}}, nilCfg.resolve(&LogMessage{}))
+}
+
+func TestRoutingValidateProviders(t *testing.T) {
+	cfg := &RoutingConfig{Routes: []*NotificationRoute{{To: []string{"telegram", "pager"}}}}
+	err := cfg.validateProviders(func(name string) bool { return name == "telegram" })
+	require.ErrorIs(t, err, ErrUnknownNotifProvider)
+	require.ErrorContains(t, err, "pager")
+}
+
+type sentMessages struct {
+	mu   sync.Mutex
+	msgs []*LogMessage
+}
+
+func (s *sentMessages) send(msg *LogMessage, _ []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs = append(s.msgs, msg)
+}
+
+func (s *sentMessages) get() []*LogMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*LogMessage(nil), s.msgs...)
+}
+
+func TestGroupsSendLatestOfWindow(t *testing.T) {
+	var sent sentMessages
+	gs := newGroups(sent.send)
+	t.Cleanup(gs.stop)
+
+	d := delivery{groupWait: 50 * time.Millisecond}
+	down := &LogMessage{Level: zerolog.WarnLevel, Title: "down", Source: SourceHealth, Route: "app", Body: FieldsBody{{Name: "Service", Value: "app"}}}
+	up := &LogMessage{Level: zerolog.InfoLevel, Title: "up", Source: SourceHealth, Route: "app", Body: FieldsBody{{Name: "Service", Value: "app"}}}
+	other := &LogMessage{Level: zerolog.WarnLevel, Title: "down", Source: SourceHealth, Route: "db", Body: MessageBody("db")}
+
+	gs.add(down, d)
+	gs.add(up, d)
+	gs.add(down, d)
+	gs.add(up, d)
+	gs.add(other, d)
+
+	require.Eventually(t, func() bool { return len(sent.get()) == 2 }, time.Second, 10*time.Millisecond)
+	var appMsg *LogMessage
+	for _, msg := range sent.get() {
+		if msg.Route == "app" {
+			appMsg = msg
+		} else {
+			require.Same(t, other, msg, "single notifications are sent as is")
+		}
+	}
+	require.NotNil(t, appMsg)
+	require.Equal(t, "up", appMsg.Title)
+	require.Equal(t, FieldsBody{{Name: "Service", Value: "app"}, {Name: "Grouped", Value: "latest of 4 notifications"}}, appMsg.Body)
+	require.Len(t, up.Body, 1, "original body must not be modified")
+}
+
+func TestGroupsDeduplicate(t *testing.T) {
+	var sent sentMessages
+	gs := newGroups(sent.send)
+	t.Cleanup(gs.stop)
+
+	d := delivery{repeatInterval: 100 * time.Millisecond}
+	down := &LogMessage{Level: zerolog.WarnLevel, Title: "down", Source: SourceHealth, Route: "app"}
+	up := &LogMessage{Level: zerolog.InfoLevel, Title: "up", Source: SourceHealth, Route: "app"}
+
+	gs.add(down, d)
+	gs.add(down, d) // repeated, held
+	gs.add(up, d)   // held
+
+	require.Eventually(t, func() bool { return len(sent.get()) == 1 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, "down", sent.get()[0].Title)
+
+	// the latest held notification is sent when the repeat interval ends
+	require.Eventually(t, func() bool { return len(sent.get()) == 2 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, "up", sent.get()[1].Title)
+	require.Equal(t, FieldsBody{{Name: "Grouped", Value: "latest of 2 notifications"}}, sent.get()[1].Body)
+
+	gs.gc()
+	require.Len(t, gs.groups, 1, "groups within the repeat interval are kept")
+}
+
+func TestGroupsRepeatIntervalFlapping(t *testing.T) {
+	var sent sentMessages
+	gs := newGroups(sent.send)
+	t.Cleanup(gs.stop)
+
+	d := delivery{repeatInterval: 100 * time.Millisecond}
+	down := &LogMessage{Level: zerolog.WarnLevel, Title: "down", Source: SourceHealth, Route: "app"}
+	up := &LogMessage{Level: zerolog.InfoLevel, Title: "up", Source: SourceHealth, Route: "app"}
+
+	gs.add(down, d)
+	for range 5 {
+		gs.add(up, d)
+		gs.add(down, d)
+	}
+
+	// ends in the state already sent
+	time.Sleep(200 * time.Millisecond)
+	require.Len(t, sent.get(), 1)
+	require.Equal(t, "down", sent.get()[0].Title)
+}
+
+func TestGroupedBodyFormat(t *testing.T) {
+	body := withGroupedCount(MessageBody("line1\nline2"), 3)
+	for format, expected := range map[LogFormat]string{
+		LogFormatPlain:    "line1\nline2\n\nlatest of 3 notifications",
+		LogFormatMarkdown: "line1\nline2\n\n_latest of 3 notifications_",
+		LogFormatHTML:     "line1<br>line2<br><em>latest of 3 notifications</em>",
+		LogFormatRawJSON:  `"line1\nline2"`,
+	} {
+		formatted, err := body.Format(format)
+		require.NoError(t, err)
+		require.Equal(t, expected, string(formatted), format)
+	}
+}
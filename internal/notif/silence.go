@@ -0,0 +1,105 @@
+package notif
+
+import (
+	"cmp"
+	"crypto/rand"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/yusing/godoxy/internal/jsonstore"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Silence mutes matching notifications between StartsAt and EndsAt,
+// e.g. during a maintenance window.
+type Silence struct {
+	ID        string              `json:"id"`
+	Match     NotificationMatcher `json:"match"`
+	StartsAt  time.Time           `json:"starts_at"`
+	EndsAt    time.Time           `json:"ends_at"`
+	Comment   string              `json:"comment,omitempty"`
+	CreatedAt time.Time           `json:"created_at"`
+} // @name NotificationSilence
+
+var (
+	ErrSilenceEndsBeforeStart = errors.New("silence ends before it starts")
+	ErrSilenceExpired         = errors.New("silence has already ended")
+)
+
+// silences persist across restarts, and are shared by all dispatchers.
+var silences = jsonstore.Store[*Silence]("notification_silences")
+
+// UnmarshalJSON implements json.Unmarshaler.
+//
+// The matcher is validated again to restore its parsed fields.
+func (s *Silence) UnmarshalJSON(data []byte) error {
+	type silence Silence
+	if err := strutils.UnmarshalJSON(data, (*silence)(s)); err != nil {
+		return err
+	}
+	return s.Match.Validate()
+}
+
+// Active reports whether the silence is in effect at now.
+func (s *Silence) Active(now time.Time) bool {
+	return !now.Before(s.StartsAt) && now.Before(s.EndsAt)
+}
+
+// AddSilence validates s, assigns it an ID and stores it.
+//
+// StartsAt defaults to now.
+func AddSilence(s *Silence) error {
+	if err := s.Match.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return ErrSilenceEndsBeforeStart
+	}
+	if !s.EndsAt.After(now) {
+		return ErrSilenceExpired
+	}
+	s.ID = rand.Text()
+	s.CreatedAt = now
+	silences.Store(s.ID, s)
+	return nil
+}
+
+// DeleteSilence removes a silence, it reports whether it existed.
+func DeleteSilence(id string) bool {
+	_, ok := silences.LoadAndDelete(id)
+	return ok
+}
+
+// Silences returns the silences that have not ended, ordered by start time.
+//
+// Ended silences are removed.
+func Silences() []*Silence {
+	now := time.Now()
+	list := make([]*Silence, 0, silences.Size())
+	for id, s := range silences.Range {
+		if !now.Before(s.EndsAt) {
+			silences.Delete(id)
+			continue
+		}
+		list = append(list, s)
+	}
+	slices.SortFunc(list, func(a, b *Silence) int {
+		return cmp.Or(a.StartsAt.Compare(b.StartsAt), cmp.Compare(a.ID, b.ID))
+	})
+	return list
+}
+
+// silencedBy returns the active silence matching msg, if any.
+func silencedBy(msg *LogMessage, now time.Time) *Silence {
+	for _, s := range silences.Range {
+		if s.Active(now) && s.Match.Matches(msg) {
+			return s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package notif
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSilences(t *testing.T) {
+	now := time.Now()
+	silence := &Silence{
+		Match:   NotificationMatcher{Source: []string{SourceHealth}, Route: []string{"nas"}},
+		EndsAt:  now.Add(time.Hour),
+		Comment: "disk replacement",
+	}
+	require.NoError(t, AddSilence(silence))
+	t.Cleanup(func() { DeleteSilence(silence.ID) })
+	require.NotEmpty(t, silence.ID)
+	require.False(t, silence.StartsAt.IsZero())
+	require.Contains(t, Silences(), silence)
+
+	require.Same(t, silence, silencedBy(&LogMessage{Source: SourceHealth, Route: "nas"}, now.Add(time.Minute)))
+	require.Nil(t, silencedBy(&LogMessage{Source: SourceHealth, Route: "app"}, now.Add(time.Minute)))
+	require.Nil(t, silencedBy(&LogMessage{Source: SourceHealth, Route: "nas"}, now.Add(2*time.Hour)))
+
+	require.True(t, DeleteSilence(silence.ID))
+	require.False(t, DeleteSilence(silence.ID))
+	require.NotContains(t, Silences(), silence)
+}
+
+func TestAddSilenceValidation(t *testing.T) {
+	now := time.Now()
+	require.ErrorIs(t, AddSilence(&Silence{StartsAt: now, EndsAt: now.Add(-time.Minute)}), ErrSilenceEndsBeforeStart)
+	require.ErrorIs(t, AddSilence(&Silence{StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}), ErrSilenceExpired)
+	require.Error(t, AddSilence(&Silence{Match: NotificationMatcher{Level: "loud"}, EndsAt: now.Add(time.Hour)}))
+}
+
+func TestSilenceJSONRestoresMatcher(t *testing.T) {
+	data, err := json.Marshal(&Silence{Match: NotificationMatcher{Level: "error"}})
+	require.NoError(t, err)
+
+	var silence Silence
+	require.NoError(t, json.Unmarshal(data, &silence))
+	require.False(t, silence.Match.Matches(&LogMessage{Level: zerolog.WarnLevel}))
+	require.True(t, silence.Match.Matches(&LogMessage{Level: zerolog.ErrorLevel}))
+}
+
+func TestRetryMessageJSON(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	for _, body := range []LogBody{
+		FieldsBody{{Name: "Service", Value: "app"}},
+		ListBody{"a", "b"},
+		MessageBody("message"),
+	} {
+		msg := &RetryMessage{
+			Message: &LogMessage{
+				Level:  zerolog.ErrorLevel,
+				Title:  "title",
+				Body:   body,
+				Color:  ColorError,
+				Source: SourceHealth,
+				Route:  "app",
+				id:     "m0d.1",
+			},
+			Trials:    2,
+			Provider:  "telegram",
+			NextRetry: now.Add(time.Minute),
+			CreatedAt: now,
+		}
+		data, err := json.Marshal(msg)
+		require.NoError(t, err)
+
+		var decoded RetryMessage
+		require.NoError(t, json.Unmarshal(data, &decoded))
+		require.Equal(t, msg.Message, decoded.Message)
+		require.Equal(t, msg.Provider, decoded.Provider)
+		require.Equal(t, msg.Trials, decoded.Trials)
+		require.True(t, msg.NextRetry.Equal(decoded.NextRetry))
+		require.True(t, msg.CreatedAt.Equal(decoded.CreatedAt))
+	}
+}
@@ -0,0 +1,134 @@
+package notif
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Slack is a provider for Slack incoming webhooks, rendered with Block Kit.
+//
+// See https://api.slack.com/messaging/webhooks
+type Slack struct {
+	ProviderBase
+}
+
+type (
+	slackMessage struct {
+		Text        string            `json:"text"` // notification fallback
+		Attachments []slackAttachment `json:"attachments"`
+	}
+	slackAttachment struct {
+		Color  string       `json:"color"`
+		Blocks []slackBlock `json:"blocks"`
+	}
+	slackBlock struct {
+		Type   string       `json:"type"`
+		Text   *slackText   `json:"text,omitempty"`
+		Fields []*slackText `json:"fields,omitempty"`
+	}
+	slackText struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+)
+
+const (
+	slackMaxHeader        = 150
+	slackMaxSectionText   = 3000
+	slackMaxFieldText     = 2000
+	slackMaxSectionFields = 10
+)
+
+// GetToken implements Provider.
+//
+// Incoming webhook URLs carry their own secret.
+func (s *Slack) GetToken() string {
+	return ""
+}
+
+// MarshalMessage implements Provider.
+func (s *Slack) MarshalMessage(logMsg *LogMessage) ([]byte, error) {
+	var blocks []slackBlock
+	if logMsg.Title != "" {
+		blocks = append(blocks, slackBlock{
+			Type: "header",
+			Text: &slackText{Type: "plain_text", Text: truncate(logMsg.Title, slackMaxHeader)},
+		})
+	}
+
+	if fields, ok := logMsg.Body.(FieldsBody); ok {
+		for chunk := range slices.Chunk(fields, slackMaxSectionFields) {
+			section := slackBlock{Type: "section"}
+			for _, field := range chunk {
+				section.Fields = append(section.Fields, &slackText{
+					Type: "mrkdwn",
+					Text: truncate("*"+escapeSlack(field.Name)+"*\n"+escapeSlack(field.Value), slackMaxFieldText),
+				})
+			}
+			blocks = append(blocks, section)
+		}
+	} else {
+		text, err := slackMrkdwn(logMsg.Body, s.Format)
+		if err != nil {
+			return nil, err
+		}
+		if text != "" {
+			blocks = append(blocks, slackBlock{
+				Type: "section",
+				Text: &slackText{Type: "mrkdwn", Text: truncate(text, slackMaxSectionText)},
+			})
+		}
+	}
+
+	return strutils.MarshalJSON(&slackMessage{
+		Text: logMsg.Title,
+		Attachments: []slackAttachment{{
+			Color:  logMsg.Color.HexString(),
+			Blocks: blocks,
+		}},
+	})
+}
+
+// fmtError implements Provider.
+//
+// Slack responds with a plain text error code, e.g. "invalid_payload".
+func (s *Slack) fmtError(respBody io.Reader) error {
+	body, err := io.ReadAll(respBody)
+	if err != nil || len(body) == 0 {
+		return ErrUnknownError
+	}
+	return errors.New(strings.TrimSpace(string(body)))
+}
+
+// slackMrkdwn renders the body as Slack mrkdwn, which only shares
+// emphasis, code and links with markdown.
+func slackMrkdwn(body LogBody, format LogFormat) (string, error) {
+	if list, ok := body.(ListBody); ok {
+		var sb strings.Builder
+		for _, item := range list {
+			sb.WriteString("• ")
+			sb.WriteString(escapeSlack(item))
+			sb.WriteByte('\n')
+		}
+		return sb.String(), nil
+	}
+	text, err := body.Format(format)
+	if err != nil {
+		return "", err
+	}
+	if format == LogFormatPlain {
+		return escapeSlack(string(text)), nil
+	}
+	return string(text), nil
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// escapeSlack escapes the control characters of Slack mrkdwn.
+func escapeSlack(s string) string {
+	return slackEscaper.Replace(s)
+}
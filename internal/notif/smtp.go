@@ -0,0 +1,262 @@
+package notif
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// SMTP is a provider for email over SMTP, sent as a multipart
+// message with plain text and HTML alternatives.
+type SMTP struct {
+	ProviderBase
+	Host     string            `json:"host"`
+	Port     int               `json:"port,omitempty"`
+	Username string            `json:"username,omitempty"`
+	Password strutils.Redacted `json:"password,omitempty"`
+	From     string            `json:"from"`
+	To       []string          `json:"to"`
+	TLS      SMTPTLSMode       `json:"tls,omitempty"`
+	// InsecureSkipVerify skips verification of the server certificate.
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+type SMTPTLSMode string
+
+const (
+	SMTPTLSStartTLS SMTPTLSMode = "starttls" // upgrade a plain connection, default
+	SMTPTLSImplicit SMTPTLSMode = "tls"      // TLS from the first byte (SMTPS)
+	SMTPTLSNone     SMTPTLSMode = "none"
+)
+
+var ErrSMTPNoStartTLS = errors.New("server does not support STARTTLS")
+
+// Validate implements the utils.CustomValidator interface.
+func (s *SMTP) Validate() error {
+	var errs gperr.Builder
+	if err := s.validateFormat(); err != nil {
+		errs.Add(err)
+	}
+	if s.Host == "" {
+		errs.Adds("host is required")
+	}
+	switch s.TLS {
+	case "":
+		s.TLS = SMTPTLSStartTLS
+	case SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone:
+	default:
+		errs.Addf("invalid tls mode %q, expect %s, %s or %s", s.TLS, SMTPTLSStartTLS, SMTPTLSImplicit, SMTPTLSNone)
+	}
+	if s.Port == 0 {
+		switch s.TLS {
+		case SMTPTLSImplicit:
+			s.Port = 465
+		case SMTPTLSNone:
+			s.Port = 25
+		default:
+			s.Port = 587
+		}
+	}
+	if s.From == "" {
+		errs.Adds("from is required")
+	} else if _, err := mail.ParseAddress(s.From); err != nil {
+		errs.AddSubject(err, "from")
+	}
+	if len(s.To) == 0 {
+		errs.Adds("to is required")
+	}
+	for _, to := range s.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			errs.AddSubject(err, "to")
+		}
+	}
+	return errs.Error()
+}
+
+// GetURL implements Provider.
+func (s *SMTP) GetURL() string {
+	return "smtp://" + s.addr()
+}
+
+// GetToken implements Provider.
+func (s *SMTP) GetToken() string {
+	return ""
+}
+
+// GetMIMEType implements Provider.
+func (s *SMTP) GetMIMEType() string {
+	return "message/rfc822"
+}
+
+func (s *SMTP) addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// MarshalMessage implements Provider.
+//
+// It returns the complete RFC 5322 message including headers.
+func (s *SMTP) MarshalMessage(logMsg *LogMessage) ([]byte, error) {
+	plain, err := logMsg.Body.Format(LogFormatPlain)
+	if err != nil {
+		return nil, err
+	}
+	htmlBody, err := logMsg.Body.Format(LogFormatHTML)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	headers := [][2]string{
+		{"From", s.From},
+		{"To", strings.Join(s.To, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", logMsg.Title)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	}
+	if logMsg.Level >= zerolog.ErrorLevel {
+		headers = append(headers, [2]string{"X-Priority", "1"}, [2]string{"Importance", "high"})
+	}
+	for _, h := range headers {
+		buf.WriteString(h[0] + ": " + h[1] + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	title := html.EscapeString(logMsg.Title)
+	if logMsg.Color != 0 {
+		title = fmt.Sprintf(`<h3 style="color:#%06x">%s</h3>`, uint(logMsg.Color), title)
+	} else {
+		title = "<h3>" + title + "</h3>"
+	}
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", string(plain)},
+		{"text/html; charset=utf-8", "<html><body>" + title + string(htmlBody) + "</body></html>"},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(w)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// send implements sender.
+func (s *SMTP) send(ctx context.Context, logMsg *LogMessage) error {
+	msg, err := s.MarshalMessage(logMsg)
+	if err != nil {
+		return err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         s.Host,
+		InsecureSkipVerify: s.InsecureSkipVerify, //nolint:gosec
+	}
+	if s.TLS == SMTPTLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		return fmtSMTPError(err)
+	}
+	defer c.Close()
+
+	if s.TLS == SMTPTLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return ErrSMTPNoStartTLS
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmtSMTPError(err)
+		}
+	}
+	if s.Username != "" {
+		// PlainAuth refuses to send credentials over an unencrypted connection, except to localhost
+		if err := c.Auth(smtp.PlainAuth("", s.Username, string(s.Password), s.Host)); err != nil {
+			return fmtSMTPError(err)
+		}
+	}
+
+	if err := c.Mail(envelopeAddress(s.From)); err != nil {
+		return fmtSMTPError(err)
+	}
+	for _, to := range s.To {
+		if err := c.Rcpt(envelopeAddress(to)); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, fmtSMTPError(err))
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmtSMTPError(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return fmtSMTPError(err)
+	}
+	return fmtSMTPError(c.Quit())
+}
+
+// envelopeAddress returns the bare address of "Name <addr>",
+// addresses are validated beforehand.
+func envelopeAddress(addr string) string {
+	if a, err := mail.ParseAddress(addr); err == nil {
+		return a.Address
+	}
+	return addr
+}
+
+// fmtSMTPError reports SMTP replies with their status code.
+func fmtSMTPError(err error) error {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) {
+		return fmt.Errorf("smtp status %d: %s", tpErr.Code, tpErr.Msg)
+	}
+	return err
+}
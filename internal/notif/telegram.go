@@ -0,0 +1,105 @@
+package notif
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+
+	"github.com/rs/zerolog"
+	gperr "github.com/yusing/goutils/errs"
+	strutils "github.com/yusing/goutils/strings"
+)
+
+// Telegram is a provider for the Telegram Bot API.
+//
+// See https://core.telegram.org/bots/api#sendmessage
+type Telegram struct {
+	ProviderBase
+	ChatID   string `json:"chat_id"`
+	ThreadID int64  `json:"thread_id,omitempty"` // forum topic
+}
+
+type (
+	telegramMessage struct {
+		ChatID              string                     `json:"chat_id"`
+		MessageThreadID     int64                      `json:"message_thread_id,omitempty"`
+		Text                string                     `json:"text"`
+		ParseMode           string                     `json:"parse_mode"`
+		DisableNotification bool                       `json:"disable_notification,omitempty"`
+		LinkPreviewOptions  telegramLinkPreviewOptions `json:"link_preview_options"`
+	}
+	telegramLinkPreviewOptions struct {
+		IsDisabled bool `json:"is_disabled"`
+	}
+	telegramError struct {
+		ErrorCode   int    `json:"error_code"`
+		Description string `json:"description"`
+	}
+)
+
+const (
+	telegramDefaultURL = "https://api.telegram.org"
+	telegramMaxText    = 4096
+)
+
+// Validate implements the utils.CustomValidator interface.
+func (t *Telegram) Validate() error {
+	var errs gperr.Builder
+	if err := t.validateDefaultURL(telegramDefaultURL); err != nil {
+		errs.Add(err)
+	}
+	if t.Token == "" {
+		errs.Adds("token is required")
+	}
+	if t.ChatID == "" {
+		errs.Adds("chat_id is required")
+	}
+	return errs.Error()
+}
+
+// GetURL implements Provider.
+func (t *Telegram) GetURL() string {
+	return t.URL + "/bot" + t.Token + "/sendMessage"
+}
+
+// GetToken implements Provider.
+//
+// The bot token is part of the URL instead of the Authorization header.
+func (t *Telegram) GetToken() string {
+	return ""
+}
+
+// MarshalMessage implements Provider.
+//
+// Telegram only supports a small subset of HTML without lists or line breaks,
+// so the body is sent as escaped plain text below a bold title.
+func (t *Telegram) MarshalMessage(logMsg *LogMessage) ([]byte, error) {
+	body, err := logMsg.Body.Format(LogFormatPlain)
+	if err != nil {
+		return nil, err
+	}
+	title := "<b>" + html.EscapeString(logMsg.Title) + "</b>"
+	text := html.EscapeString(truncate(string(body), telegramMaxText-len(title)-1))
+
+	return strutils.MarshalJSON(&telegramMessage{
+		ChatID:              t.ChatID,
+		MessageThreadID:     t.ThreadID,
+		Text:                title + "\n" + text,
+		ParseMode:           "HTML",
+		DisableNotification: logMsg.Level < zerolog.WarnLevel,
+		LinkPreviewOptions:  telegramLinkPreviewOptions{IsDisabled: true},
+	})
+}
+
+// fmtError implements Provider.
+func (t *Telegram) fmtError(respBody io.Reader) error {
+	var errm telegramError
+	if err := strutils.NewJSONDecoder(respBody).Decode(&errm); err != nil {
+		return fmt.Errorf("failed to decode err response: %w", err)
+	}
+	if errm.Description == "" {
+		return ErrUnknownError
+	}
+	return errors.New(errm.Description)
+}
@@ -25,6 +25,9 @@ type (
 	nameOnly struct {
 		Name string `json:"name"`
 	}
+	cpuOnly struct {
+		CPU float64 `json:"cpu"` // fraction of allocated cores, 1 = 100%
+	}
 )
 
 const (
@@ -132,6 +135,15 @@ func (n *Node) LXCStatus(ctx context.Context, vmid uint64) (LXCStatus, error) {
 	return status.Status, nil
 }
 
+// LXCCPUUsage returns the current CPU usage of the container in percent.
+func (n *Node) LXCCPUUsage(ctx context.Context, vmid uint64) (float64, error) {
+	var cpu cpuOnly
+	if err := n.client.Get(ctx, fmt.Sprintf("/nodes/%s/lxc/%d/status/current", n.name, vmid), &cpu); err != nil {
+		return 0, err
+	}
+	return cpu.CPU * 100, nil
+}
+
 func (n *Node) LXCIsRunning(ctx context.Context, vmid uint64) (bool, error) {
 	status, err := n.LXCStatus(ctx, vmid)
 	return status == LXCStatusRunning, err
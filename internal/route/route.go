@@ -55,6 +55,8 @@ type (
 		InboundMTLSProfile       string                         `json:"inbound_mtls_profile,omitempty"` // HTTP-based routes only: must match a configured inbound_mtls_profiles entry and is ignored when entrypoint.inbound_mtls_profile is set
 		Rules                    rules.Rules                    `json:"rules,omitempty" extensions:"x-nullable"`
 		RuleFile                 string                         `json:"rule_file,omitempty" extensions:"x-nullable"`
+		RulePreset               string                         `json:"rule_preset,omitempty" aliases:"preset" extensions:"x-nullable"`
+		RuleTests                rules.Tests                    `json:"rule_tests,omitempty" extensions:"x-nullable"` // run against the rules when the route is validated
 		HealthCheck              health.HealthCheckConfig       `json:"healthcheck,omitzero" extensions:"x-nullable"` // null on load-balancer routes
 		LoadBalance              *loadbalancer.Config           `json:"load_balance,omitempty" extensions:"x-nullable"`
 		Middlewares              map[string]types.LabelMap      `json:"middlewares,omitempty" extensions:"x-nullable"`
@@ -79,6 +81,8 @@ type (
 
 		Provider string `json:"provider,omitempty" extensions:"x-nullable"` // for backward compatibility
 
+		RulePresets []string `json:"rule_presets,omitempty" extensions:"x-nullable"` // presets used by rule_preset, including the included presets
+
 		RootFS fs.FS `json:"-" deserialize:"-"`
 
 		// ForceConflictWin lets built-in routes intentionally replace user or
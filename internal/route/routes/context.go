@@ -2,11 +2,13 @@ package routes
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"net/url"
 	"reflect"
 	"unsafe"
 
+	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 )
 
@@ -21,13 +23,22 @@ type RouteContext struct {
 	context.Context
 
 	Route Route
+
+	ipInfo *maxmind.IPInfo // client IP info, caches GeoIP lookups for the request
+	vars   map[string]string
+	values map[any]any
 }
 
+type routeContextSelfKey struct{}
+
 var routeContextKey = RouteContextKey{}
 
 func (r *RouteContext) Value(key any) any {
-	if key == routeContextKey {
+	switch key {
+	case routeContextKey:
 		return r.Route
+	case routeContextSelfKey{}:
+		return r
 	}
 	return r.Context.Value(key)
 }
@@ -51,6 +62,86 @@ func TryGetRoute(r *http.Request) Route {
 	return nil
 }
 
+// ClientIPInfo returns the IP info of the request client from RemoteAddr, nil when it is not an IP.
+// Within a route context it is kept for the request, so GeoIP lookups filling it are done once.
+func ClientIPInfo(r *http.Request) *maxmind.IPInfo {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	rc := routeContext(r)
+	// RemoteAddr may be rewritten after the first lookup, e.g. by the real IP middleware
+	if rc != nil && rc.ipInfo != nil && rc.ipInfo.Str == host {
+		return rc.ipInfo
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	info := &maxmind.IPInfo{IP: ip, Str: host}
+	if rc != nil {
+		rc.ipInfo = info
+	}
+	return info
+}
+
+func routeContext(r *http.Request) *RouteContext {
+	rc, _ := r.Context().Value(routeContextSelfKey{}).(*RouteContext)
+	return rc
+}
+
+// SetRequestVar sets a variable for the rest of the request, e.g. later rules, middlewares and access logs.
+// It is a no-op outside a route context.
+func SetRequestVar(r *http.Request, name, value string) {
+	rc := routeContext(r)
+	if rc == nil {
+		return
+	}
+	if rc.vars == nil {
+		rc.vars = make(map[string]string)
+	}
+	rc.vars[name] = value
+}
+
+// RequestVar returns the value of a variable set by SetRequestVar.
+func RequestVar(r *http.Request, name string) (string, bool) {
+	rc := routeContext(r)
+	if rc == nil {
+		return "", false
+	}
+	value, ok := rc.vars[name]
+	return value, ok
+}
+
+// RequestVars returns the variables set by SetRequestVar, it must not be modified.
+func RequestVars(r *http.Request) map[string]string {
+	if rc := routeContext(r); rc != nil {
+		return rc.vars
+	}
+	return nil
+}
+
+// SetRequestValue stores a value for the rest of the request, like SetRequestVar but for values that are not strings.
+// It is a no-op outside a route context.
+func SetRequestValue(r *http.Request, key, value any) {
+	rc := routeContext(r)
+	if rc == nil {
+		return
+	}
+	if rc.values == nil {
+		rc.values = make(map[any]any)
+	}
+	rc.values[key] = value
+}
+
+// RequestValue returns the value stored by SetRequestValue, nil when it is not set.
+func RequestValue(r *http.Request, key any) any {
+	if rc := routeContext(r); rc != nil {
+		return rc.values[key]
+	}
+	return nil
+}
+
 func tryGetURL(r *http.Request) *url.URL {
 	if route := TryGetRoute(r); route != nil {
 		u := route.TargetURL()
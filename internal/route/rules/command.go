@@ -12,9 +12,11 @@ var errTerminateRule = errors.New("terminate rule")
 type (
 	HandlerFunc func(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error
 	Handler     struct {
-		fn        HandlerFunc
-		phase     PhaseFlag
-		terminate bool
+		fn         HandlerFunc
+		phase      PhaseFlag
+		terminate  bool
+		sideEffect bool   // skipped in rule tests
+		raw        string // the command, for traces
 	}
 
 	CommandHandler interface {
@@ -30,6 +32,19 @@ type (
 )
 
 func (h Handler) ServeHTTP(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+	if trace := traceFromRequest(r); trace != nil {
+		if h.sideEffect && trace.test {
+			trace.skip(h.raw)
+			if h.terminate {
+				return errTerminateRule
+			}
+			return nil
+		}
+		done := trace.do(h.raw)
+		err := h.fn(w, r, upstream)
+		done(err)
+		return err
+	}
 	return h.fn(w, r, upstream)
 }
 
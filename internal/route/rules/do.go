@@ -47,10 +47,13 @@ const (
 	CommandRedirect         = "redirect"
 	CommandRoute            = "route"
 	CommandError            = "error"
+	CommandRespond          = "respond"
 	CommandRequireBasicAuth = "require_basic_auth"
 	CommandSet              = "set"
 	CommandAdd              = "add"
 	CommandRemove           = "remove"
+	CommandSetVar           = "setvar"
+	CommandSubrequest       = "subrequest"
 	CommandLog              = "log"
 	CommandNotify           = "notify"
 )
@@ -77,6 +80,8 @@ var commands = map[string]struct {
 	validate  ValidateFunc
 	build     func(args any) HandlerFunc
 	terminate bool
+	// sideEffect commands reach outside of the request, they are skipped in rule tests.
+	sideEffect bool
 }{
 	CommandUpstream: {
 		help: Help{
@@ -324,7 +329,8 @@ var commands = map[string]struct {
 				return errTerminateRule
 			}
 		},
-		terminate: true,
+		terminate:  true,
+		sideEffect: true,
 	},
 	CommandError: {
 		help: Help{
@@ -373,6 +379,32 @@ var commands = map[string]struct {
 		},
 		terminate: true,
 	},
+	CommandRespond: {
+		help: Help{
+			command: CommandRespond,
+			description: makeLines(
+				"Respond with a page rendered from a Go template and terminate processing.",
+				"The template is inline, or a file when it starts with @. File templates have language variants",
+				"picked by Accept-Language, e.g. maintenance.de.html for maintenance.html.",
+				"Templates read .Status, .Lang, .Route, .Health, .Homepage and {{ .Var \"$req_path\" }},",
+				"and embed files next to the template with {{ asset \"logo.png\" }}.",
+				"Options are key=value: type (content type, default from the file extension or text/html)",
+				"and cache (max-age, default no-store), e.g.:",
+				helpExample(CommandRespond, "503", "@/app/pages/maintenance.html", "cache=1m"),
+				helpExample(CommandRespond, "503", "<h1>{{ .Homepage.Name }} is {{ .Health }}</h1>"),
+			),
+			args: helpArgs(
+				helpArg{"status", "the http status code to return"},
+				helpArg{"template", "the inline template, or @ followed by the template file path"},
+				helpArg{"[options]", "key=value options"},
+			),
+		},
+		validate: validateRespond,
+		build: func(args any) HandlerFunc {
+			return args.(*respond).ServeHTTP
+		},
+		terminate: true,
+	},
 	CommandRequireBasicAuth: {
 		help: Help{
 			command: CommandRequireBasicAuth,
@@ -444,7 +476,8 @@ var commands = map[string]struct {
 				return errTerminateRule
 			}
 		},
-		terminate: true,
+		terminate:  true,
+		sideEffect: true,
 	},
 	CommandSet: {
 		help: Help{
@@ -505,6 +538,69 @@ var commands = map[string]struct {
 			return args.(HandlerFunc)
 		},
 	},
+	CommandSetVar: {
+		help: Help{
+			command: CommandSetVar,
+			description: makeLines(
+				"Set a request variable from a template.",
+				"It is readable with $var(name) in later rules, middlewares, and access logs (fields.vars) of the same request, e.g.:",
+				helpExample(CommandSetVar, "tenant", "$map(tenants, $req_host)"),
+				helpExample(CommandSetVar, "client", "$header(X-Client-Id)"),
+			),
+			args: helpArgs(
+				helpArg{"name", "the variable name, letters, digits, _ and -"},
+				helpArg{"value", "the value template"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			if len(args) != 2 {
+				return phase, nil, ErrExpectTwoArgs
+			}
+			if !validRequestVarName(args[0]) {
+				return phase, nil, ErrInvalidArguments.Subject(args[0]).Withf("invalid variable name")
+			}
+			phase, tmpl, err := validateTemplate(args[1], false)
+			if err != nil {
+				return phase, nil, err
+			}
+			return phase, &keyValueTemplate{args[0], tmpl}, nil
+		},
+		build: func(args any) HandlerFunc {
+			name, tmpl := args.(*keyValueTemplate).Unpack()
+			return func(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+				value, _, err := tmpl.ExpandVarsToString(w, r)
+				if err != nil {
+					return err
+				}
+				routes.SetRequestVar(r, name, value)
+				return nil
+			}
+		},
+	},
+	CommandSubrequest: {
+		help: Help{
+			command: CommandSubrequest,
+			description: makeLines(
+				"Send a sub-request to a URL or another route, and keep its result for later rules of the request.",
+				"The result is read with $sub_status(name), $sub_header(name, Header) and $sub_json(name, .path),",
+				"and matched with sub_status and sub_json. Failed sub-requests have status 0.",
+				"Options are key=value: method, timeout (default 5s), cache (TTL, keyed by the request sent),",
+				"header=Name:value (repeatable) and body, e.g.:",
+				helpExample(CommandSubrequest, "entitlement", "https://auth.internal/check$req_path", "header=X-User:$header(X-User)", "cache=30s"),
+				helpExample(CommandSubrequest, "profile", "route://users/api/me", "method=POST", "timeout=2s"),
+			),
+			args: helpArgs(
+				helpArg{"name", "the result name, letters, digits, _ and -"},
+				helpArg{"target", "the URL template, http://, https:// or route://<route>/<path>"},
+				helpArg{"[options]", "key=value options"},
+			),
+		},
+		validate: validateSubrequest,
+		build: func(args any) HandlerFunc {
+			return args.(*subrequest).ServeHTTP
+		},
+		sideEffect: true,
+	},
 	CommandLog: {
 		help: Help{
 			command: CommandLog,
@@ -572,6 +668,7 @@ var commands = map[string]struct {
 				return err
 			}
 		},
+		sideEffect: true,
 	},
 	CommandNotify: {
 		help: Help{
@@ -631,14 +728,17 @@ var commands = map[string]struct {
 
 				s := respBuf.String()
 				notif.FromCtx(r.Context()).Notify(&notif.LogMessage{
-					Level: level,
-					Title: s[:titleLen],
-					Body:  notif.MessageBodyBytes(s[titleLen:]),
-					To:    to,
+					Level:  level,
+					Title:  s[:titleLen],
+					Body:   notif.MessageBodyBytes(s[titleLen:]),
+					Source: notif.SourceRules,
+					Route:  routes.TryGetUpstreamName(r),
+					To:     to,
 				})
 				return nil
 			}
 		},
+		sideEffect: true,
 	},
 }
 
@@ -36,7 +36,7 @@ func (c IfBlockCommand) ServeHTTP(w *httputils.ResponseModifier, r *http.Request
 	if c.On.checker == nil {
 		return Commands(c.Do).ServeHTTP(w, r, upstream)
 	}
-	if c.On.checker.Check(w, r) {
+	if traceFromRequest(r).check(&c.On, w, r) {
 		return Commands(c.Do).ServeHTTP(w, r, upstream)
 	}
 	return nil
@@ -72,7 +72,7 @@ func (c IfElseBlockCommand) ServeHTTP(w *httputils.ResponseModifier, r *http.Req
 			}
 			return Commands(br.Do).ServeHTTP(w, r, upstream)
 		}
-		if br.On.checker.Check(w, r) {
+		if traceFromRequest(r).check(&br.On, w, r) {
 			if br.Do == nil {
 				return nil
 			}
@@ -393,7 +393,7 @@ func parseDoWithBlocks(src string) (handlers []CommandHandler, err error) {
 		}
 
 		h := builder.build(validArgs)
-		handlers = append(handlers, Handler{fn: h, phase: phase, terminate: builder.terminate})
+		handlers = append(handlers, Handler{fn: h, phase: phase, terminate: builder.terminate, sideEffect: builder.sideEffect, raw: line})
 		return nil
 	}
 
@@ -431,7 +431,7 @@ func parseDoWithBlocks(src string) (handlers []CommandHandler, err error) {
 		}
 
 		h := builder.build(validArgs)
-		handlers = append(handlers, Handler{fn: h, phase: phase, terminate: builder.terminate})
+		handlers = append(handlers, Handler{fn: h, phase: phase, terminate: builder.terminate, sideEffect: builder.sideEffect, raw: directive + " { ... }"})
 		return true, nil
 	}
 
@@ -24,16 +24,18 @@ const (
 )
 
 const (
-	FieldHeader         = "header"
-	FieldResponseHeader = "resp_header"
-	FieldQuery          = "query"
-	FieldCookie         = "cookie"
-	FieldBody           = "body"
-	FieldResponseBody   = "resp_body"
-	FieldStatusCode     = "status"
+	FieldHeader           = "header"
+	FieldResponseHeader   = "resp_header"
+	FieldQuery            = "query"
+	FieldCookie           = "cookie"
+	FieldBody             = "body"
+	FieldResponseBody     = "resp_body"
+	FieldJSONBody         = "json_body"
+	FieldResponseJSONBody = "resp_json_body"
+	FieldStatusCode       = "status"
 )
 
-var AllFields = []string{FieldHeader, FieldResponseHeader, FieldQuery, FieldCookie, FieldBody, FieldResponseBody, FieldStatusCode}
+var AllFields = []string{FieldHeader, FieldResponseHeader, FieldQuery, FieldCookie, FieldBody, FieldResponseBody, FieldJSONBody, FieldResponseJSONBody, FieldStatusCode}
 
 // NOTE: should not use canonicalized header keys, respect to user's input
 var modFields = map[string]struct {
@@ -315,6 +317,52 @@ var modFields = map[string]struct {
 			}
 		},
 	},
+	FieldJSONBody: {
+		help: Help{
+			command: FieldJSONBody,
+			description: makeLines(
+				"Rewrite a value in the JSON request body sent to the upstream.",
+				"Only applies to uncompressed bodies up to 4MB with a JSON content type, others are forwarded as is.",
+				"Set replaces the value, add appends it to an array, remove deletes it.",
+				"Values that are valid JSON are inserted as JSON, e.g. 1, true or {\"a\":1}, others as strings, e.g.:",
+				helpExample(FieldJSONBody, ".user.id", "$header(X-User-Id)"),
+			),
+			args: helpArgs(
+				helpArg{"path", "the JSON path, e.g. .user.role, .items[0].id or .items[*].id"},
+				helpArg{"value", "the value template"},
+			),
+		},
+		validate: validatePreRequestJSONPathTemplate,
+		builder: func(args any) *FieldHandler {
+			path, tmpl := args.(*Tuple[*jsonPath, templateString]).Unpack()
+			return jsonBodyModifiers(path, tmpl, func(w *httputils.ResponseModifier, r *http.Request, modify func(doc any) (any, bool)) error {
+				return modifyRequestJSON(r, modify)
+			})
+		},
+	},
+	FieldResponseJSONBody: {
+		help: Help{
+			command: FieldResponseJSONBody,
+			description: makeLines(
+				"Rewrite a value in the JSON response body sent to the client.",
+				"Applies to responses with a JSON content type, others are sent as is. The upstream is asked for an uncompressed body,",
+				"JSON responses that are still compressed, invalid or larger than 4MB are replaced with 502 Bad Gateway.",
+				"Set replaces the value, add appends it to an array, remove deletes it, e.g.:",
+				helpExample(FieldResponseJSONBody, ".user.ssn", "redacted"),
+			),
+			args: helpArgs(
+				helpArg{"path", "the JSON path, e.g. .user.ssn, .items[0].id or .items[*].secret"},
+				helpArg{"value", "the value template"},
+			),
+		},
+		validate: validatePostResponseJSONPathTemplate,
+		builder: func(args any) *FieldHandler {
+			path, tmpl := args.(*Tuple[*jsonPath, templateString]).Unpack()
+			return jsonBodyModifiers(path, tmpl, func(w *httputils.ResponseModifier, r *http.Request, modify func(doc any) (any, bool)) error {
+				return modifyResponseJSON(w, modify)
+			})
+		},
+	},
 	FieldStatusCode: {
 		help: Help{
 			command: FieldStatusCode,
@@ -0,0 +1,104 @@
+package rules
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/route/routes"
+	rulemaps "github.com/yusing/godoxy/internal/route/rules/maps"
+	"github.com/yusing/goutils/task"
+)
+
+type valueContext struct{ context.Context }
+
+func (c *valueContext) SetValue(key, value any) {
+	c.Context = context.WithValue(c.Context, key, value)
+}
+
+func TestSetVarCommand(t *testing.T) {
+	maps, err := rulemaps.New(task.RootTask("test", false), map[string]*rulemaps.Config{
+		"tenants": {
+			Values: map[string]string{
+				"acme.example.com":   "acme",
+				"*.shop.example.com": "shop",
+			},
+			Default: "unknown",
+		},
+	})
+	require.NoError(t, err)
+	ctx := &valueContext{t.Context()}
+	rulemaps.SetCtx(ctx, maps)
+
+	var rules Rules
+	err = parseRules(`
+header X-Plan {
+	setvar plan $header(X-Plan)
+}
+{
+	setvar tenant '$map(tenants, $req_host)'
+	set header X-Tenant $var(tenant)
+	set header X-Plan '$var(plan, free)'
+	set header X-Missing '$map(missing, $req_host, none)'
+}`, &rules)
+	require.NoError(t, err)
+
+	var got http.Header
+	handler := rules.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		host   string
+		plan   string
+		tenant string
+	}{
+		{"acme.example.com", "", "acme"},
+		{"www.shop.example.com", "pro", "shop"},
+		{"example.org", "", "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(ctx, http.MethodGet, "http://"+tt.host+"/", nil)
+			if tt.plan != "" {
+				req.Header.Set("X-Plan", tt.plan)
+			}
+			req = routes.WithRouteContext(req, nil)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+
+			require.NotNil(t, got)
+			assert.Equal(t, tt.tenant, got.Get("X-Tenant"))
+			assert.Equal(t, "none", got.Get("X-Missing"))
+			if tt.plan != "" {
+				assert.Equal(t, tt.plan, got.Get("X-Plan"))
+				assert.Equal(t, tt.plan, routes.RequestVars(req)["plan"])
+			} else {
+				assert.Equal(t, "free", got.Get("X-Plan"))
+			}
+		})
+	}
+}
+
+func TestSetVarCommand_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		wantErr error
+	}{
+		{"missing value", `setvar tenant`, ErrExpectTwoArgs},
+		{"invalid name", `setvar 'bad name' value`, ErrInvalidArguments},
+		{"invalid name charset", `setvar bad.name value`, ErrInvalidArguments},
+		{"unknown variable", `setvar tenant $unknown`, ErrUnexpectedVar},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules Rules
+			err := parseRules("default {\n\t"+tt.rule+"\n}", &rules)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,442 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+)
+
+// maxJSONBodySize is the largest body json_body matchers and fields buffer, same as response modifying middlewares.
+const maxJSONBodySize = 4 * 1024 * 1024 // 4MB
+
+type (
+	// jsonPath is a path into a JSON document, e.g. .user.role, .items[0].id or .items[*].secret.
+	jsonPath struct {
+		raw  string
+		segs []jsonPathSeg
+	}
+	jsonPathSeg struct {
+		key   string
+		index int // -1 for [*]
+		isKey bool
+	}
+)
+
+func (p *jsonPath) String() string {
+	return p.raw
+}
+
+func parseJSONPath(s string) (*jsonPath, gperr.Error) {
+	if len(s) < 2 || (s[0] != '.' && s[0] != '[') {
+		return nil, ErrInvalidArguments.Subject(s).Withf("expect a JSON path, e.g. .user.role")
+	}
+	p := &jsonPath{raw: s}
+	for rest := s; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			key := rest[1:end]
+			if key == "" {
+				return nil, ErrInvalidArguments.Subject(s).Withf("empty key")
+			}
+			p.segs = append(p.segs, jsonPathSeg{key: key, isKey: true})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, ErrInvalidArguments.Subject(s).Withf("unterminated brackets")
+			}
+			index := rest[1:end]
+			if index == "*" {
+				p.segs = append(p.segs, jsonPathSeg{index: -1})
+			} else {
+				i, err := strconv.ParseUint(index, 10, 31)
+				if err != nil {
+					return nil, ErrInvalidArguments.Subject(s).Withf("invalid index %q, expect a number or *", index)
+				}
+				p.segs = append(p.segs, jsonPathSeg{index: int(i)})
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, ErrInvalidArguments.Subject(s).Withf("unexpected %q, expect . or [", rest[0])
+		}
+	}
+	return p, nil
+}
+
+// Values returns the values at the path, there can be more than one with [*].
+func (p *jsonPath) Values(doc any) []any {
+	nodes := []any{doc}
+	for _, seg := range p.segs {
+		var next []any
+		for _, node := range nodes {
+			switch node := node.(type) {
+			case map[string]any:
+				if !seg.isKey {
+					continue
+				}
+				if v, ok := node[seg.key]; ok {
+					next = append(next, v)
+				}
+			case []any:
+				if seg.isKey {
+					continue
+				}
+				if seg.index == -1 {
+					next = append(next, node...)
+				} else if seg.index < len(node) {
+					next = append(next, node[seg.index])
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// Update calls update with the current value at the path, and replaces it with the returned value.
+// Missing object keys are created on the way, it reports whether the document is changed.
+func (p *jsonPath) Update(doc any, update func(old any, exists bool) any) (any, bool) {
+	return updateJSON(doc, p.segs, update)
+}
+
+func updateJSON(node any, segs []jsonPathSeg, update func(old any, exists bool) any) (any, bool) {
+	seg, rest := segs[0], segs[1:]
+	if seg.isKey {
+		obj, ok := node.(map[string]any)
+		if !ok {
+			if node != nil {
+				return node, false
+			}
+			obj = make(map[string]any)
+		}
+		old, exists := obj[seg.key]
+		if len(rest) == 0 {
+			obj[seg.key] = update(old, exists)
+			return obj, true
+		}
+		v, changed := updateJSON(old, rest, update)
+		if changed {
+			obj[seg.key] = v
+		}
+		return obj, changed
+	}
+	arr, ok := node.([]any)
+	if !ok {
+		return node, false
+	}
+	changed := false
+	for i := range arr {
+		if seg.index != -1 && seg.index != i {
+			continue
+		}
+		if len(rest) == 0 {
+			arr[i] = update(arr[i], true)
+			changed = true
+			continue
+		}
+		var c bool
+		arr[i], c = updateJSON(arr[i], rest, update)
+		changed = changed || c
+	}
+	return arr, changed
+}
+
+// Delete removes the value at the path, it reports whether the document is changed.
+func (p *jsonPath) Delete(doc any) (any, bool) {
+	return deleteJSON(doc, p.segs)
+}
+
+func deleteJSON(node any, segs []jsonPathSeg) (any, bool) {
+	seg, rest := segs[0], segs[1:]
+	if seg.isKey {
+		obj, ok := node.(map[string]any)
+		if !ok {
+			return node, false
+		}
+		old, exists := obj[seg.key]
+		if !exists {
+			return obj, false
+		}
+		if len(rest) == 0 {
+			delete(obj, seg.key)
+			return obj, true
+		}
+		v, changed := deleteJSON(old, rest)
+		obj[seg.key] = v
+		return obj, changed
+	}
+	arr, ok := node.([]any)
+	if !ok {
+		return node, false
+	}
+	if len(rest) == 0 {
+		switch {
+		case seg.index == -1:
+			return arr[:0], len(arr) > 0
+		case seg.index < len(arr):
+			return append(arr[:seg.index], arr[seg.index+1:]...), true
+		}
+		return arr, false
+	}
+	changed := false
+	for i := range arr {
+		if seg.index != -1 && seg.index != i {
+			continue
+		}
+		var c bool
+		arr[i], c = deleteJSON(arr[i], rest)
+		changed = changed || c
+	}
+	return arr, changed
+}
+
+// jsonPathMatcher returns whether any value at the path matches, or whether the path exists when matcher is nil.
+func jsonPathMatcher(path *jsonPath, matcher Matcher) func(doc any) bool {
+	return func(doc any) bool {
+		values := path.Values(doc)
+		if matcher == nil {
+			return len(values) > 0
+		}
+		return slices.ContainsFunc(values, func(v any) bool {
+			return matcher(jsonValueString(v))
+		})
+	}
+}
+
+// jsonValueString returns the string of a JSON value for matching, strings are unquoted,
+// objects and arrays are compact JSON.
+func jsonValueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	}
+	b, err := marshalJSON(v)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// parseJSONValue returns the JSON value of s when it is valid JSON, e.g. 1, true or {"a":1}, otherwise s as a string.
+func parseJSONValue(s string) any {
+	if v, err := unmarshalJSON([]byte(s)); err == nil {
+		return v
+	}
+	return s
+}
+
+func unmarshalJSON(data []byte) (v any, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, ErrInvalidArguments.Withf("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+func marshalJSON(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// isJSONBody reports whether the body of a message with the header is uncompressed JSON.
+func isJSONBody(h http.Header) bool {
+	return isJSONContentType(h) && isIdentityEncoding(h)
+}
+
+// isJSONContentType reports whether the header has a JSON content type, e.g. application/json or application/problem+json.
+func isJSONContentType(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// isIdentityEncoding reports whether the body of a message with the header is not compressed.
+func isIdentityEncoding(h http.Header) bool {
+	for _, enc := range h.Values("Content-Encoding") {
+		if enc = strings.TrimSpace(enc); enc != "" && !strings.EqualFold(enc, "identity") {
+			return false
+		}
+	}
+	return true
+}
+
+// requestJSONBody is a request body read by readRequestJSON, it keeps the decoded document
+// so matchers and fields of a request decode the body once.
+type requestJSONBody struct {
+	io.Reader
+	io.Closer
+	doc any
+	ok  bool // whether doc is decoded
+}
+
+// readRequestJSON decodes the JSON request body and puts it back for the upstream.
+// It returns false without consuming the body when it is not JSON or larger than maxJSONBodySize.
+func readRequestJSON(r *http.Request) (any, bool) {
+	if body, ok := r.Body.(*requestJSONBody); ok {
+		return body.doc, body.ok
+	}
+	if r.Body == nil || r.Body == http.NoBody || r.ContentLength > maxJSONBodySize || !isJSONBody(r.Header) {
+		return nil, false
+	}
+	body := r.Body
+	data, err := io.ReadAll(io.LimitReader(body, maxJSONBodySize+1))
+	if err != nil || len(data) > maxJSONBodySize {
+		// let the upstream read the rest
+		r.Body = &requestJSONBody{Reader: io.MultiReader(bytes.NewReader(data), body), Closer: body}
+		return nil, false
+	}
+	body.Close()
+	doc, err := unmarshalJSON(data)
+	setRequestBody(r, data, doc, err == nil)
+	if err != nil {
+		return nil, false
+	}
+	return doc, true
+}
+
+func setRequestBody(r *http.Request, data []byte, doc any, ok bool) {
+	r.Body = &requestJSONBody{Reader: bytes.NewReader(data), Closer: http.NoBody, doc: doc, ok: ok}
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	r.ContentLength = int64(len(data))
+	r.TransferEncoding = nil
+	if r.Header.Get("Content-Length") != "" {
+		r.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	}
+}
+
+// modifyRequestJSON replaces the JSON request body with the result of modify when it reports a change.
+func modifyRequestJSON(r *http.Request, modify func(doc any) (any, bool)) error {
+	doc, ok := readRequestJSON(r)
+	if !ok {
+		return nil
+	}
+	doc, changed := modify(doc)
+	if !changed {
+		return nil
+	}
+	data, err := marshalJSON(doc)
+	if err != nil {
+		return err
+	}
+	setRequestBody(r, data, doc, true)
+	return nil
+}
+
+// modifyResponseJSON replaces the buffered JSON response body with the result of modify when it reports a change.
+// Non-JSON responses are left untouched. JSON responses that cannot be modified, i.e. compressed,
+// invalid or larger than maxJSONBodySize, are replaced with a 502 so the fields to remove never reach the client.
+// The response is always buffered, BuildHandler does not stream the response of rules modifying its body.
+func modifyResponseJSON(w *httputils.ResponseModifier, modify func(doc any) (any, bool)) error {
+	if !isJSONContentType(w.Header()) {
+		return nil
+	}
+	if !isIdentityEncoding(w.Header()) {
+		return failJSONResponse(w, fmt.Errorf("JSON response body is compressed (%s)", w.Header().Get("Content-Encoding")))
+	}
+	if w.ContentLength() > maxJSONBodySize {
+		return failJSONResponse(w, fmt.Errorf("JSON response body is larger than %d bytes", maxJSONBodySize))
+	}
+	body := w.BodyReader()
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 { // e.g. HEAD and 204
+		return w.SetBody(io.NopCloser(bytes.NewReader(data)))
+	}
+	doc, err := unmarshalJSON(data)
+	if err != nil {
+		return failJSONResponse(w, fmt.Errorf("invalid JSON response body: %w", err))
+	}
+	if doc, changed := modify(doc); changed {
+		if data, err = marshalJSON(doc); err != nil {
+			return failJSONResponse(w, err)
+		}
+	}
+	return w.SetBody(io.NopCloser(bytes.NewReader(data)))
+}
+
+// failJSONResponse replaces the response with a 502 and returns err.
+func failJSONResponse(w *httputils.ResponseModifier, err error) error {
+	w.ResetBody()
+	header := w.Header()
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusBadGateway)
+	_, _ = w.BodyBuffer().WriteString(http.StatusText(http.StatusBadGateway))
+	return err
+}
+
+// jsonBodyModifiers returns the set, add and remove handlers of a JSON path in a request or response body.
+func jsonBodyModifiers(path *jsonPath, tmpl templateString, modifyBody func(w *httputils.ResponseModifier, r *http.Request, modify func(doc any) (any, bool)) error) *FieldHandler {
+	return &FieldHandler{
+		set: func(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+			v, _, err := tmpl.ExpandVarsToString(w, r)
+			if err != nil {
+				return err
+			}
+			value := parseJSONValue(v)
+			return modifyBody(w, r, func(doc any) (any, bool) {
+				return path.Update(doc, func(any, bool) any {
+					return value
+				})
+			})
+		},
+		add: func(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+			v, _, err := tmpl.ExpandVarsToString(w, r)
+			if err != nil {
+				return err
+			}
+			value := parseJSONValue(v)
+			return modifyBody(w, r, func(doc any) (any, bool) {
+				return path.Update(doc, func(old any, _ bool) any {
+					switch old := old.(type) {
+					case []any:
+						return append(old, value)
+					case nil:
+						return []any{value}
+					default:
+						return []any{old, value}
+					}
+				})
+			})
+		},
+		remove: func(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+			return modifyBody(w, r, path.Delete)
+		},
+	}
+}
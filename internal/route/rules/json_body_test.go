@@ -0,0 +1,277 @@
+package rules
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		segs    []jsonPathSeg
+		wantErr bool
+	}{
+		{".user.role", []jsonPathSeg{{key: "user", isKey: true}, {key: "role", isKey: true}}, false},
+		{".items[0].id", []jsonPathSeg{{key: "items", isKey: true}, {index: 0}, {key: "id", isKey: true}}, false},
+		{".items[*]", []jsonPathSeg{{key: "items", isKey: true}, {index: -1}}, false},
+		{"[1]", []jsonPathSeg{{index: 1}}, false},
+		{".", nil, true},
+		{"user.role", nil, true},
+		{".user..role", nil, true},
+		{".items[", nil, true},
+		{".items[-1]", nil, true},
+		{".items[0]x", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := parseJSONPath(tt.path)
+			if tt.wantErr {
+				require.ErrorIs(t, err, ErrInvalidArguments)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.segs, p.segs)
+		})
+	}
+}
+
+func TestJSONPathOps(t *testing.T) {
+	const doc = `{"user":{"role":"admin","ssn":"123"},"items":[{"id":1,"secret":"a"},{"id":2,"secret":"b"}]}`
+	tests := []struct {
+		name string
+		path string
+		op   func(p *jsonPath, doc any) (any, bool)
+		want string
+	}{
+		{
+			name: "set",
+			path: ".user.role",
+			op: func(p *jsonPath, doc any) (any, bool) {
+				return p.Update(doc, func(any, bool) any { return "guest" })
+			},
+			want: `{"items":[{"id":1,"secret":"a"},{"id":2,"secret":"b"}],"user":{"role":"guest","ssn":"123"}}`,
+		},
+		{
+			name: "set creates objects",
+			path: ".meta.source",
+			op: func(p *jsonPath, doc any) (any, bool) {
+				return p.Update(doc, func(any, bool) any { return parseJSONValue(`{"via":"godoxy"}`) })
+			},
+			want: `{"items":[{"id":1,"secret":"a"},{"id":2,"secret":"b"}],"meta":{"source":{"via":"godoxy"}},"user":{"role":"admin","ssn":"123"}}`,
+		},
+		{
+			name: "delete",
+			path: ".user.ssn",
+			op:   (*jsonPath).Delete,
+			want: `{"items":[{"id":1,"secret":"a"},{"id":2,"secret":"b"}],"user":{"role":"admin"}}`,
+		},
+		{
+			name: "delete in all elements",
+			path: ".items[*].secret",
+			op:   (*jsonPath).Delete,
+			want: `{"items":[{"id":1},{"id":2}],"user":{"role":"admin","ssn":"123"}}`,
+		},
+		{
+			name: "delete element",
+			path: ".items[0]",
+			op:   (*jsonPath).Delete,
+			want: `{"items":[{"id":2,"secret":"b"}],"user":{"role":"admin","ssn":"123"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, pathErr := parseJSONPath(tt.path)
+			require.NoError(t, pathErr)
+			v, err := unmarshalJSON([]byte(doc))
+			require.NoError(t, err)
+			v, changed := tt.op(p, v)
+			assert.True(t, changed)
+			got, err := marshalJSON(v)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(got))
+		})
+	}
+
+	t.Run("missing path", func(t *testing.T) {
+		p, pathErr := parseJSONPath(".user.role.name")
+		require.NoError(t, pathErr)
+		v, err := unmarshalJSON([]byte(doc))
+		require.NoError(t, err)
+		_, changed := p.Delete(v)
+		assert.False(t, changed)
+		_, changed = p.Update(v, func(any, bool) any { return "x" })
+		assert.False(t, changed, "should not replace a string with an object")
+	})
+}
+
+func TestJSONBodyRules(t *testing.T) {
+	var rules Rules
+	err := parseRules(`
+json_body .user.role == admin {
+	set header X-Admin true
+	set json_body .user.verified true
+	remove json_body .user.password
+}
+{
+	remove resp_json_body .items[*].secret
+	add resp_json_body .tags '$req_method'
+}`, &rules)
+	require.NoError(t, err)
+
+	var gotBody string
+	var gotHeader http.Header
+	handler := rules.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		gotBody = string(b)
+		gotHeader = r.Header.Clone()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"items":[{"id":1,"secret":"a"}],"tags":["x"]}`))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user":{"role":"admin","password":"hunter2"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		assert.Equal(t, "true", gotHeader.Get("X-Admin"))
+		assert.Equal(t, "identity", gotHeader.Get("Accept-Encoding"), "resp_json_body needs an uncompressed response")
+		assert.JSONEq(t, `{"user":{"role":"admin","verified":true}}`, gotBody)
+		assert.JSONEq(t, `{"items":[{"id":1}],"tags":["x","POST"]}`, w.Body.String())
+	})
+
+	t.Run("not json", func(t *testing.T) {
+		const body = `{"user":{"role":"admin","password":"hunter2"}}`
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/plain")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Empty(t, gotHeader.Get("X-Admin"))
+		assert.Equal(t, body, gotBody)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		body := `{"user":{"role":"admin"},"pad":"` + strings.Repeat("a", maxJSONBodySize) + `"}`
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.ContentLength = -1 // unknown length, read up to the limit
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Empty(t, gotHeader.Get("X-Admin"))
+		assert.Equal(t, body, gotBody, "body should be forwarded as is")
+	})
+}
+
+func TestJSONBodyRules_ResponseFailClosed(t *testing.T) {
+	var rules Rules
+	require.NoError(t, parseRules(`{
+	remove resp_json_body .secret
+}`, &rules))
+
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        string
+		wantStatus  int
+	}{
+		{"compressed", "application/json", "gzip", `{"secret":"a"}`, http.StatusBadGateway},
+		{"too large", "application/json", "", `{"secret":"a","pad":"` + strings.Repeat("a", maxJSONBodySize) + `"}`, http.StatusBadGateway},
+		{"invalid", "application/problem+json", "", `{"secret":"a"`, http.StatusBadGateway},
+		{"empty", "application/json", "", "", http.StatusOK},
+		{"not json", "text/plain", "gzip", `{"secret":"a"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := rules.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tt.body))
+			})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			require.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusBadGateway {
+				assert.NotContains(t, w.Body.String(), "secret")
+				assert.Empty(t, w.Header().Get("Content-Encoding"))
+			} else {
+				assert.Equal(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestJSONBodyRules_ResponseOuterPassthrough(t *testing.T) {
+	var outer, inner Rules
+	require.NoError(t, parseRules(`{
+	set header X-Outer 1
+}`, &outer))
+	require.NoError(t, parseRules(`{
+	remove resp_json_body .secret
+}`, &inner))
+
+	// the outer rules have no post commands and stream the response
+	handler := outer.BuildHandler(inner.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":1,"secret":"a"}`))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":1}`, w.Body.String())
+}
+
+func TestReadRequestJSONCached(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user":{"role":"admin"}}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	doc, ok := readRequestJSON(req)
+	require.True(t, ok)
+	doc.(map[string]any)["cached"] = true
+
+	again, ok := readRequestJSON(req)
+	require.True(t, ok)
+	assert.Equal(t, true, again.(map[string]any)["cached"], "the body is decoded once per request")
+
+	b, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"user":{"role":"admin"}}`, string(b), "the body is kept for the upstream")
+
+	require.NoError(t, modifyRequestJSON(req, func(doc any) (any, bool) {
+		return (&jsonPath{segs: []jsonPathSeg{{key: "id", isKey: true}}}).Update(doc, func(any, bool) any { return 1 })
+	}))
+	again, ok = readRequestJSON(req)
+	require.True(t, ok)
+	assert.EqualValues(t, 1, again.(map[string]any)["id"], "modified documents are kept")
+}
+
+func TestJSONBodyRules_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"invalid matcher path", "json_body user.role {\n\tpass\n}"},
+		{"too many matcher args", "json_body .user.role admin guest {\n\tpass\n}"},
+		{"invalid field path", "{\n\tset json_body .user..role admin\n}"},
+		{"missing field value", "{\n\tset resp_json_body .user.role\n}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules Rules
+			require.ErrorIs(t, parseRules(tt.rule, &rules), ErrInvalidArguments)
+		})
+	}
+}
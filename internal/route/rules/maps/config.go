@@ -0,0 +1,41 @@
+package rulemaps
+
+import (
+	"path/filepath"
+
+	"github.com/gobwas/glob"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+// Config is a lookup map defined inline, in a file, or both.
+type Config struct {
+	// Values maps keys to values, keys may be glob patterns, e.g. *.example.com.
+	Values map[string]string `json:"values,omitempty"`
+	// File is a YAML or JSON file of `key: value` entries in the config directory, reloaded when it changes.
+	// Its entries take precedence over Values.
+	File string `json:"file,omitempty"`
+	// Default is the value of keys not in the map.
+	Default string `json:"default,omitempty"`
+}
+
+var ErrInvalidFile = gperr.New("invalid rule map file")
+
+func (cfg *Config) Validate() error {
+	if len(cfg.Values) == 0 && cfg.File == "" {
+		return gperr.New("values or file is required")
+	}
+	// only files directly in the config directory are watched
+	if cfg.File != "" && (filepath.Base(cfg.File) != cfg.File || cfg.File == "." || cfg.File == "..") {
+		return ErrInvalidFile.Subject(cfg.File).Withf("expect a file name in the config directory")
+	}
+	errs := gperr.NewBuilder("invalid values")
+	for key := range cfg.Values {
+		if !isPattern(key) {
+			continue
+		}
+		if _, err := glob.Compile(key); err != nil {
+			errs.Add(gperr.PrependSubject(err, key))
+		}
+	}
+	return errs.Error()
+}
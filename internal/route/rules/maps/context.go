@@ -0,0 +1,14 @@
+package rulemaps
+
+import "context"
+
+type contextKey struct{}
+
+func SetCtx(target interface{ SetValue(any, any) }, maps Maps) {
+	target.SetValue(contextKey{}, maps)
+}
+
+func FromCtx(ctx context.Context) Maps {
+	maps, _ := ctx.Value(contextKey{}).(Maps)
+	return maps
+}
@@ -0,0 +1,202 @@
+package rulemaps
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gobwas/glob"
+	"github.com/goccy/go-yaml"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/watcher"
+	watcherEvents "github.com/yusing/godoxy/internal/watcher/events"
+	gperr "github.com/yusing/goutils/errs"
+	"github.com/yusing/goutils/eventqueue"
+	"github.com/yusing/goutils/task"
+)
+
+type (
+	// Map is a named lookup map, it is safe for concurrent use while its file is reloaded.
+	Map struct {
+		name  string
+		cfg   *Config
+		table atomic.Pointer[table]
+	}
+	Maps map[string]*Map
+
+	table struct {
+		exact    map[string]string
+		patterns []pattern // longest first, so the most specific pattern wins
+	}
+	pattern struct {
+		expr  string
+		glob  glob.Glob
+		value string
+	}
+)
+
+const reloadFlushInterval = 500 * time.Millisecond
+
+// New loads the maps and watches their files for changes.
+//
+// A map whose file cannot be loaded is still returned with its inline values,
+// and its file is loaded once it is fixed.
+func New(parent task.Parent, cfgs map[string]*Config) (Maps, error) {
+	all := make(Maps, len(cfgs))
+	errs := gperr.NewBuilder("rule maps error")
+	for name, cfg := range cfgs {
+		m := &Map{name: name, cfg: cfg}
+		if err := m.load(); err != nil {
+			errs.Add(gperr.PrependSubject(err, name))
+		}
+		if cfg.File != "" {
+			m.watch(parent)
+		}
+		all[name] = m
+	}
+	return all, errs.Error()
+}
+
+// Lookup returns the value of the exact key, or of the longest glob pattern matching it.
+// It returns the default value and false when nothing matches.
+func (m *Map) Lookup(key string) (value string, ok bool) {
+	t := m.table.Load()
+	if value, ok := t.exact[key]; ok {
+		return value, true
+	}
+	for _, p := range t.patterns {
+		if p.glob.Match(key) {
+			return p.value, true
+		}
+	}
+	return m.cfg.Default, false
+}
+
+// Len returns the number of entries in the map.
+func (m *Map) Len() int {
+	t := m.table.Load()
+	return len(t.exact) + len(t.patterns)
+}
+
+func (m *Map) logger() *zerolog.Logger {
+	l := log.With().Str("map", m.name).Str("file", m.cfg.File).Logger()
+	return &l
+}
+
+// load builds the table from the inline values and the file.
+// When the file fails to load or has an invalid pattern, the current table is kept,
+// or the inline values are used on first load.
+func (m *Map) load() error {
+	entries := m.cfg.Values
+	var fileErr error
+	if m.cfg.File != "" {
+		fileEntries, err := readFile(m.cfg.File)
+		if err != nil {
+			if m.table.Load() != nil {
+				return err
+			}
+			fileErr = err
+		} else {
+			entries = maps.Clone(entries)
+			if entries == nil {
+				entries = make(map[string]string, len(fileEntries))
+			}
+			maps.Copy(entries, fileEntries)
+		}
+	}
+	t, err := newTable(entries)
+	if err != nil {
+		if m.table.Load() == nil {
+			// inline values are validated by Config.Validate, lookups need a table even on errors
+			inline, inlineErr := newTable(m.cfg.Values)
+			if inlineErr != nil {
+				inline = &table{}
+			}
+			m.table.Store(inline)
+		}
+		return err
+	}
+	m.table.Store(t)
+	return fileErr
+}
+
+func (m *Map) watch(parent task.Parent) {
+	t := parent.Subtask("rule_map_watcher("+m.name+")", false)
+	opts := eventqueue.Options[watcherEvents.Event]{
+		FlushInterval: reloadFlushInterval,
+		OnFlush: func(evs []watcherEvents.Event) {
+			if len(evs) == 0 {
+				return
+			}
+			if evs[len(evs)-1].Action == watcherEvents.ActionFileDeleted {
+				m.logger().Warn().Msg("rule map file deleted, keeping the last loaded entries")
+				return
+			}
+			if err := m.load(); err != nil {
+				m.logger().Err(err).Msg("failed to reload rule map, keeping the last loaded entries")
+				return
+			}
+			m.logger().Info().Int("entries", m.Len()).Msg("rule map reloaded")
+		},
+		OnError: func(err error) {
+			m.logger().Err(err).Msg("rule map watcher error")
+		},
+		Debug: common.IsDebug,
+	}
+	stream := watcher.NewConfigFileWatcher(m.cfg.File).Watch(t)
+	eventqueue.New(t, opts).Start(stream.Events, stream.Errors)
+}
+
+func readFile(name string) (map[string]string, error) {
+	data, err := os.ReadFile(filepath.Join(common.ConfigBasePath, name))
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, ErrInvalidFile.Subject(name).With(err)
+	}
+	entries := make(map[string]string, len(raw))
+	for key, value := range raw {
+		switch value := value.(type) {
+		case map[string]any, []any:
+			return nil, ErrInvalidFile.Subject(name).Withf("value of %q is not a scalar", key)
+		case nil:
+			entries[key] = ""
+		default:
+			entries[key] = fmt.Sprint(value)
+		}
+	}
+	return entries, nil
+}
+
+func newTable(entries map[string]string) (*table, error) {
+	t := &table{exact: make(map[string]string, len(entries))}
+	for key, value := range entries {
+		if !isPattern(key) {
+			t.exact[key] = value
+			continue
+		}
+		g, err := glob.Compile(key)
+		if err != nil {
+			return nil, gperr.PrependSubject(err, key)
+		}
+		t.patterns = append(t.patterns, pattern{expr: key, glob: g, value: value})
+	}
+	slices.SortFunc(t.patterns, func(a, b pattern) int {
+		return cmp.Or(len(b.expr)-len(a.expr), strings.Compare(a.expr, b.expr))
+	})
+	return t, nil
+}
+
+func isPattern(key string) bool {
+	return strings.ContainsAny(key, "*?[{")
+}
@@ -0,0 +1,114 @@
+package rulemaps
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/common"
+)
+
+func TestLookup(t *testing.T) {
+	m := &Map{name: "tenants", cfg: &Config{
+		Values: map[string]string{
+			"acme.example.com":     "acme",
+			"*.example.com":        "shared",
+			"*.shop.example.com":   "shop",
+			"api.shop.example.com": "shop-api",
+		},
+		Default: "unknown",
+	}}
+	require.NoError(t, m.load())
+	assert.Equal(t, 4, m.Len())
+
+	tests := []struct {
+		key   string
+		value string
+		ok    bool
+	}{
+		{"acme.example.com", "acme", true},
+		{"api.shop.example.com", "shop-api", true},
+		{"www.shop.example.com", "shop", true},
+		{"www.example.com", "shared", true},
+		{"example.org", "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			value, ok := m.Lookup(tt.key)
+			assert.Equal(t, tt.value, value)
+			assert.Equal(t, tt.ok, ok)
+		})
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.Mkdir(common.ConfigBasePath, 0o755))
+	file := filepath.Join(common.ConfigBasePath, "tenants.yml")
+
+	m := &Map{name: "tenants", cfg: &Config{
+		Values: map[string]string{"a": "inline", "b": "inline"},
+		File:   "tenants.yml",
+	}}
+
+	// missing file on first load falls back to the inline values
+	require.Error(t, m.load())
+	value, _ := m.Lookup("a")
+	assert.Equal(t, "inline", value)
+
+	require.NoError(t, os.WriteFile(file, []byte("a: file\nc: 1\n"), 0o644))
+	require.NoError(t, m.load())
+	value, _ = m.Lookup("a")
+	assert.Equal(t, "file", value)
+	value, _ = m.Lookup("b")
+	assert.Equal(t, "inline", value)
+	value, _ = m.Lookup("c")
+	assert.Equal(t, "1", value)
+
+	// an invalid file keeps the last loaded entries
+	require.NoError(t, os.WriteFile(file, []byte("a:\n  nested: value\n"), 0o644))
+	require.ErrorIs(t, m.load(), ErrInvalidFile)
+	value, _ = m.Lookup("a")
+	assert.Equal(t, "file", value)
+}
+
+func TestConfigValidate(t *testing.T) {
+	require.Error(t, (&Config{}).Validate())
+	require.NoError(t, (&Config{Values: map[string]string{"a": "b"}}).Validate())
+	require.NoError(t, (&Config{File: "tenants.yml"}).Validate())
+	require.ErrorIs(t, (&Config{File: "maps/tenants.yml"}).Validate(), ErrInvalidFile)
+	require.ErrorIs(t, (&Config{File: ".."}).Validate(), ErrInvalidFile)
+	require.NoError(t, (&Config{Values: map[string]string{"*.example.com": "b"}}).Validate())
+	require.Error(t, (&Config{Values: map[string]string{"[a": "b"}}).Validate())
+}
+
+func TestLoadInvalidPattern(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.Mkdir(common.ConfigBasePath, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(common.ConfigBasePath, "tenants.yml"), []byte("'[a': file\n"), 0o644))
+
+	m := &Map{name: "tenants", cfg: &Config{
+		Values:  map[string]string{"a": "inline"},
+		File:    "tenants.yml",
+		Default: "none",
+	}}
+	// an invalid pattern on first load falls back to the inline values
+	require.Error(t, m.load())
+	value, ok := m.Lookup("a")
+	assert.True(t, ok)
+	assert.Equal(t, "inline", value)
+	value, ok = m.Lookup("b")
+	assert.False(t, ok)
+	assert.Equal(t, "none", value)
+	assert.Equal(t, 1, m.Len())
+
+	// without valid inline values, the map is empty
+	m = &Map{name: "invalid", cfg: &Config{Values: map[string]string{"[b": "inline"}, Default: "none"}}
+	require.Error(t, m.load())
+	value, ok = m.Lookup("[b")
+	assert.False(t, ok)
+	assert.Equal(t, "none", value)
+	assert.Zero(t, m.Len())
+}
@@ -6,6 +6,7 @@ import (
 	"slices"
 	"strings"
 
+	"github.com/yusing/godoxy/internal/maxmind"
 	"github.com/yusing/godoxy/internal/route/routes"
 	gperr "github.com/yusing/goutils/errs"
 	httputils "github.com/yusing/goutils/http"
@@ -32,6 +33,7 @@ const (
 	OnCookie    = "cookie"
 	OnForm      = "form"
 	OnPostForm  = "postform"
+	OnJSONBody  = "json_body"
 	OnProto     = "proto"
 	OnMethod    = "method"
 	OnHost      = "host"
@@ -39,6 +41,15 @@ const (
 	OnRemote    = "remote"
 	OnBasicAuth = "basic_auth"
 	OnRoute     = "route"
+	OnCountry   = "country"
+	OnContinent = "continent"
+	OnCity      = "city"
+	OnASN       = "asn"
+	OnTime      = "time"
+	OnWeekday   = "weekday"
+	OnDate      = "date"
+	OnSubStatus = "sub_status"
+	OnSubJSON   = "sub_json"
 )
 
 // on response
@@ -266,6 +277,31 @@ var checkers = map[string]struct {
 			}
 		},
 	},
+	OnJSONBody: {
+		help: Help{
+			command: OnJSONBody,
+			description: makeLines(
+				"Match a value in the JSON request body, up to 4MB and only with a JSON content type.",
+				"Value supports string, glob pattern, or regex pattern, e.g.:",
+				helpExample(OnJSONBody, ".user.role", "admin"),
+				helpExample(OnJSONBody, ".user.role", "==", "admin"),
+				helpExample(OnJSONBody, ".items[*].sku", helpFuncCall("glob", "promo-*")),
+				"Without a value, matches when the path exists.",
+			),
+			args: helpArgs(
+				helpArg{"path", "the JSON path, e.g. .user.role, .items[0].id or .items[*].id"},
+				helpArg{"[value]", "the value, strings unquoted and objects or arrays as compact JSON"},
+			),
+		},
+		validate: validateJSONBodyMatcher,
+		builder: func(args any) CheckFunc {
+			match := jsonPathMatcher(args.(*Tuple[*jsonPath, Matcher]).Unpack())
+			return func(w *httputils.ResponseModifier, r *http.Request) bool {
+				doc, ok := readRequestJSON(r)
+				return ok && match(doc)
+			}
+		},
+	},
 	OnProto: {
 		help: Help{
 			command: OnProto,
@@ -437,6 +473,241 @@ var checkers = map[string]struct {
 			}
 		},
 	},
+	OnCountry: {
+		help: Help{
+			command: OnCountry,
+			description: makeLines(
+				"Match the remote client country from the MaxMind database.",
+				"Matches when the country is any of the given ISO 3166-1 alpha-2 codes.",
+				helpExample(OnCountry, "GB"),
+				helpExample(OnCountry, "GB", "US"),
+			),
+			args: helpArgs(
+				helpArg{"codes...", "ISO country codes, e.g. GB, US, DE"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			parsedArgs, err = validateGeoCodes(args, 2)
+			return
+		},
+		builder: func(args any) CheckFunc {
+			codes := args.([]string)
+			return func(w *httputils.ResponseModifier, r *http.Request) bool {
+				return slices.Contains(codes, maxmind.RequestCountry(r))
+			}
+		},
+	},
+	OnContinent: {
+		help: Help{
+			command: OnContinent,
+			description: makeLines(
+				"Match the remote client continent from the MaxMind database.",
+				"Matches when the continent is any of the given codes: AF, AN, AS, EU, NA, OC, SA.",
+				helpExample(OnContinent, "EU"),
+				helpExample(OnContinent, "NA", "SA"),
+			),
+			args: helpArgs(
+				helpArg{"codes...", "continent codes"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			parsedArgs, err = validateContinentCodes(args)
+			return
+		},
+		builder: func(args any) CheckFunc {
+			codes := args.([]string)
+			return func(w *httputils.ResponseModifier, r *http.Request) bool {
+				return slices.Contains(codes, maxmind.RequestContinent(r))
+			}
+		},
+	},
+	OnCity: {
+		help: Help{
+			command: OnCity,
+			description: makeLines(
+				"Match the remote client city from the MaxMind database, by its English name, case insensitive.",
+				"Requires the MaxMind City database (maxmind.city: true).",
+				helpExample(OnCity, "London"),
+				helpExample(OnCity, `"New York"`, "Toronto"),
+			),
+			args: helpArgs(
+				helpArg{"names...", "city names, quoted if they contain spaces"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			parsedArgs, err = validateCityNames(args)
+			return
+		},
+		builder: func(args any) CheckFunc {
+			names := args.([]string)
+			return func(w *httputils.ResponseModifier, r *http.Request) bool {
+				city := maxmind.RequestCityName(r)
+				return city != "" && slices.ContainsFunc(names, func(name string) bool {
+					return strings.EqualFold(name, city)
+				})
+			}
+		},
+	},
+	OnASN: {
+		help: Help{
+			command: OnASN,
+			description: makeLines(
+				"Match the remote client autonomous system number.",
+				"Requires the MaxMind ASN database (maxmind.asn: true).",
+				helpExample(OnASN, "13335"),
+				helpExample(OnASN, "AS13335", "AS15169"),
+			),
+			args: helpArgs(
+				helpArg{"numbers...", "AS numbers, with or without the AS prefix"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			parsedArgs, err = validateASNs(args)
+			return
+		},
+		builder: func(args any) CheckFunc {
+			numbers := args.([]uint)
+			return func(w *httputils.ResponseModifier, r *http.Request) bool {
+				asn := maxmind.RequestASN(r)
+				return asn != nil && slices.Contains(numbers, asn.Number)
+			}
+		},
+	},
+	OnTime: {
+		help: Help{
+			command: OnTime,
+			description: makeLines(
+				"Match the current time of day, from the start time (inclusive) to the end time (exclusive).",
+				"A range ending before it starts spans midnight. Uses the server time zone unless one is given.",
+				helpExample(OnTime, "09:00-18:00"),
+				helpExample(OnTime, "21:00-07:00", "Europe/London"),
+				helpExample(OnTime, "08:00-12:00,13:00-17:00"),
+			),
+			args: helpArgs(
+				helpArg{"ranges", "comma separated HH:MM-HH:MM time ranges"},
+				helpArg{"[timezone]", "IANA time zone, e.g. Europe/London"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			parsedArgs, err = validateTimeRanges(args)
+			return
+		},
+		builder: buildScheduleChecker,
+	},
+	OnWeekday: {
+		help: Help{
+			command: OnWeekday,
+			description: makeLines(
+				"Match the current day of the week.",
+				"A range ending before it starts wraps past Sunday. Uses the server time zone unless one is given.",
+				helpExample(OnWeekday, "mon-fri"),
+				helpExample(OnWeekday, "sat,sun", "America/New_York"),
+			),
+			args: helpArgs(
+				helpArg{"days", "comma separated weekdays or ranges, e.g. mon-fri,sun"},
+				helpArg{"[timezone]", "IANA time zone, e.g. Europe/London"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			parsedArgs, err = validateWeekdays(args)
+			return
+		},
+		builder: buildScheduleChecker,
+	},
+	OnDate: {
+		help: Help{
+			command: OnDate,
+			description: makeLines(
+				"Match the current date, date ranges are inclusive.",
+				"Uses the server time zone unless one is given.",
+				helpExample(OnDate, "2026-12-25"),
+				helpExample(OnDate, "2026-12-24..2026-12-26,2026-12-31", "Asia/Tokyo"),
+			),
+			args: helpArgs(
+				helpArg{"dates", "comma separated YYYY-MM-DD dates or YYYY-MM-DD..YYYY-MM-DD ranges"},
+				helpArg{"[timezone]", "IANA time zone, e.g. Europe/London"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			parsedArgs, err = validateDateRanges(args)
+			return
+		},
+		builder: buildScheduleChecker,
+	},
+	OnSubStatus: {
+		help: Help{
+			command: OnSubStatus,
+			description: makeLines(
+				"Match the status of a sub-request made earlier by the subrequest command (exact, range, or class).",
+				"A failed sub-request has status 0, one not made matches nothing.",
+				helpExample(OnSubStatus, "entitlement", "200"),
+				helpExample(OnSubStatus, "entitlement", "2xx"),
+				helpExample(OnSubStatus, "entitlement", "0"),
+			),
+			args: helpArgs(
+				helpArg{"name", "the sub-request name"},
+				helpArg{"status", "code (404), inclusive range (502-504), class (4xx), or 0 for failed"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			name, err := validateSubrequestName(args)
+			if err != nil {
+				return phase, nil, err
+			}
+			if len(args) == 2 && args[1] == "0" {
+				return phase, &Tuple[string, *IntTuple]{name, &IntTuple{0, 0}}, nil
+			}
+			statusRange, err := validateStatusRange(args[1:])
+			if err != nil {
+				return phase, nil, err
+			}
+			return phase, &Tuple[string, *IntTuple]{name, statusRange.(*IntTuple)}, nil
+		},
+		builder: func(args any) CheckFunc {
+			name, statusRange := args.(*Tuple[string, *IntTuple]).Unpack()
+			beg, end := statusRange.Unpack()
+			return func(w *httputils.ResponseModifier, r *http.Request) bool {
+				result := subrequestResultOf(r, name)
+				return result != nil && result.status >= beg && result.status <= end
+			}
+		},
+	},
+	OnSubJSON: {
+		help: Help{
+			command: OnSubJSON,
+			description: makeLines(
+				"Match a value in the JSON body of a sub-request made earlier by the subrequest command.",
+				"Value supports string, glob pattern, or regex pattern, e.g.:",
+				helpExample(OnSubJSON, "entitlement", ".allowed", "true"),
+				helpExample(OnSubJSON, "entitlement", ".paths[*]", helpFuncCall("glob", "/admin/*")),
+				"Without a value, matches when the path exists.",
+			),
+			args: helpArgs(
+				helpArg{"name", "the sub-request name"},
+				helpArg{"path", "the JSON path, e.g. .allowed or .roles[*]"},
+				helpArg{"[value]", "the value, strings unquoted and objects or arrays as compact JSON"},
+			),
+		},
+		validate: func(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+			name, err := validateSubrequestName(args)
+			if err != nil {
+				return phase, nil, err
+			}
+			_, parsedArgs, err = validateJSONBodyMatcher(args[1:])
+			if err != nil {
+				return phase, nil, err
+			}
+			return phase, &Tuple[string, *Tuple[*jsonPath, Matcher]]{name, parsedArgs.(*Tuple[*jsonPath, Matcher])}, nil
+		},
+		builder: func(args any) CheckFunc {
+			name, pathMatcher := args.(*Tuple[string, *Tuple[*jsonPath, Matcher]]).Unpack()
+			match := jsonPathMatcher(pathMatcher.Unpack())
+			return func(w *httputils.ResponseModifier, r *http.Request) bool {
+				result := subrequestResultOf(r, name)
+				return result != nil && match(result.json)
+			}
+		},
+	},
 	OnBasicAuth: {
 		help: Help{
 			command: OnBasicAuth,
@@ -8,12 +8,15 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"testing"
+	"time"
 
+	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
 	"github.com/yusing/godoxy/internal/route"
 	"github.com/yusing/godoxy/internal/route/routes"
 	. "github.com/yusing/godoxy/internal/route/rules"
 	"github.com/yusing/godoxy/internal/routeimpl"
 	httputils "github.com/yusing/goutils/http"
+	"github.com/yusing/goutils/mockable"
 	expect "github.com/yusing/goutils/testing"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -438,3 +441,110 @@ func TestOnPathMatchesCanonicalRequestPath(t *testing.T) {
 	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
 	expect.False(t, trailingSlash.Check(w, req), "/admin")
 }
+
+// newGeoRequest returns a request from a client with known geo info, as if looked up earlier in the request.
+func newGeoRequest(country, continent, city string, asn uint) *http.Request {
+	req := routes.WithRouteContext(httptest.NewRequest(http.MethodGet, "/admin", nil), nil)
+	req.RemoteAddr = "81.2.69.142:4321"
+	info := routes.ClientIPInfo(req)
+	info.City = &maxmind.City{}
+	info.City.Country.IsoCode = country
+	info.City.Continent.Code = continent
+	if city != "" {
+		info.City.City.Names = map[string]string{"en": city}
+	}
+	info.ASN = &maxmind.ASN{Number: asn}
+	return req
+}
+
+func TestOnGeo(t *testing.T) {
+	w := httputils.NewResponseModifier(httptest.NewRecorder())
+	gb := newGeoRequest("GB", "EU", "London", 13335)
+	us := newGeoRequest("US", "NA", "New York", 15169)
+	noCity := newGeoRequest("GB", "EU", "", 13335)
+
+	tests := []struct {
+		checker string
+		req     *http.Request
+		want    bool
+	}{
+		{"country GB", gb, true},
+		{"country gb us", us, true},
+		{"country GB", us, false},
+		{"!country GB", us, true},
+		{"continent EU", gb, true},
+		{"continent EU", us, false},
+		{"city London", gb, true},
+		{"city london paris", gb, true},
+		{`city "new york"`, us, true},
+		{"city London", us, false},
+		{"city London", noCity, false},
+		{"!city London", noCity, true},
+		{"asn 13335", gb, true},
+		{"asn AS13335 AS15169", us, true},
+		{"asn 13335", us, false},
+		{"!country GB & path /admin", us, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.checker, func(t *testing.T) {
+			var on RuleOn
+			expect.NoError(t, on.Parse(tt.checker))
+			expect.Equal(t, tt.want, on.Check(w, tt.req))
+		})
+	}
+
+	for _, checker := range []string{"country", "country GBR", "country G1", "continent XX", "city", `city ""`, "asn", "asn cloudflare", "asn 0"} {
+		t.Run("invalid "+checker, func(t *testing.T) {
+			var on RuleOn
+			expect.ErrorIs(t, ErrInvalidArguments, on.Parse(checker))
+		})
+	}
+}
+
+func TestOnSchedule(t *testing.T) {
+	// Thursday 2026-12-24 22:30 UTC, Friday 2026-12-25 07:30 in Tokyo
+	mockable.MockTimeNow(time.Date(2026, 12, 24, 22, 30, 0, 0, time.UTC))
+	w := httputils.NewResponseModifier(httptest.NewRecorder())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	tests := []struct {
+		checker string
+		want    bool
+	}{
+		{"time 21:00-07:00 UTC", true},
+		{"time 09:00-18:00 UTC", false},
+		{"time 22:30-23:00 UTC", true},
+		{"time 21:00-22:30 UTC", false},
+		{"time 08:00-12:00,22:00-24:00 UTC", true},
+		{"time 07:00-08:00 Asia/Tokyo", true},
+		{"!time 09:00-18:00 UTC", true},
+		{"weekday mon-fri UTC", true},
+		{"weekday Thursday UTC", true},
+		{"weekday sat,sun UTC", false},
+		{"weekday fri-mon UTC", false},
+		{"weekday fri Asia/Tokyo", true},
+		{"date 2026-12-24..2026-12-26 UTC", true},
+		{"date 2026-12-25 UTC", false},
+		{"date 2026-12-25..2026-12-26,2026-12-24 UTC", true},
+		{"date 2026-12-25 Asia/Tokyo", true},
+		{"weekday mon-fri UTC & time 21:00-07:00 UTC", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.checker, func(t *testing.T) {
+			var on RuleOn
+			expect.NoError(t, on.Parse(tt.checker))
+			expect.Equal(t, tt.want, on.Check(w, req))
+		})
+	}
+
+	for _, checker := range []string{
+		"time", "time 9:00-18:00", "time 09:00", "time 09:00-09:00", "time 24:00-06:00", "time 09:60-10:00",
+		"time 09:00-18:00 Mars/Olympus", "weekday funday", "weekday mon-xyz", "weekday mon-fri UTC extra",
+		"date 2026-13-01", "date 2026-12-26..2026-12-24", "date 2026-12-24..",
+	} {
+		t.Run("invalid "+checker, func(t *testing.T) {
+			var on RuleOn
+			expect.ErrorIs(t, ErrInvalidArguments, on.Parse(checker))
+		})
+	}
+}
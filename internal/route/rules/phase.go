@@ -8,6 +8,9 @@ const (
 	PhaseNone PhaseFlag = 0
 	PhasePre  PhaseFlag = 1 << (iota - 1)
 	PhasePost
+	// PhaseResponseBody marks commands that modify the upstream response body,
+	// the upstream is asked for an uncompressed one.
+	PhaseResponseBody
 )
 
 func (phase PhaseFlag) IsPostRule() bool {
@@ -29,5 +32,8 @@ func (phase PhaseFlag) String() string {
 	if phase&PhasePost != 0 {
 		flags = append(flags, "PhasePost")
 	}
+	if phase&PhaseResponseBody != 0 {
+		flags = append(flags, "PhaseResponseBody")
+	}
 	return strings.Join(flags, ",")
 }
@@ -0,0 +1,336 @@
+package rulepresets
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/goccy/go-yaml"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/route/rules"
+	"github.com/yusing/godoxy/internal/serialization"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	/*
+		presetFile is a user preset in config/rule_presets with params and includes,
+		preset files may also contain only the rules.
+
+			Example:
+
+				params:
+				  group: ~ # required
+				  login: /login # default value
+				include:
+				  - security_headers
+				rules: |
+				  !path ${params.login} {
+				    require_auth
+				  }
+	*/
+	presetFile struct {
+		Params  map[string]any `json:"params"`  // param name to default value, null for required params
+		Include []string       `json:"include"` // preset references, their rules come before the rules of the preset
+		Rules   rules.Rules    `json:"rules" validate:"required"`
+	}
+
+	// Ref is a preset reference, e.g. `sso_protected(group=admins, login="/sso/login")`.
+	Ref struct {
+		Name string
+		Args map[string]string
+	}
+)
+
+var (
+	ErrInvalidRef     = errors.New("invalid rule preset reference")
+	ErrPresetNotFound = errors.New("rule preset not found")
+	ErrIncludeCycle   = errors.New("rule preset include cycle")
+	ErrMissingParam   = errors.New("missing rule preset param")
+	ErrUnknownParam   = errors.New("unknown rule preset param")
+)
+
+var paramRegex = regexp.MustCompile(`\$\{params\.([^}]*)\}`)
+
+// paramMetaChars are characters of the rule syntax, they are rejected in param values
+// with whitespace, so an argument cannot add commands or conditions to the rules.
+const paramMetaChars = "\"'`\\$(){}|&,"
+
+// ParseRef parses a preset reference, param values may be quoted with `"` or `'`.
+// Values are inserted into the rules as is, so whitespace and paramMetaChars are rejected.
+func ParseRef(s string) (ref Ref, err error) {
+	s = strings.TrimSpace(s)
+	name, args, hasArgs := strings.Cut(s, "(")
+	ref.Name = strings.TrimSpace(name)
+	if !isValidName(ref.Name) {
+		return ref, fmt.Errorf("%w %q: invalid name", ErrInvalidRef, s)
+	}
+	if !hasArgs {
+		return ref, nil
+	}
+	args, ok := strings.CutSuffix(strings.TrimSpace(args), ")")
+	if !ok {
+		return ref, fmt.Errorf("%w %q: missing ')'", ErrInvalidRef, s)
+	}
+	ref.Args = make(map[string]string)
+	for _, arg := range splitArgs(args) {
+		key, value, ok := strings.Cut(arg, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return ref, fmt.Errorf("%w %q: expect key=value, got %q", ErrInvalidRef, s, arg)
+		}
+		if _, ok := ref.Args[key]; ok {
+			return ref, fmt.Errorf("%w %q: duplicated param %q", ErrInvalidRef, s, key)
+		}
+		value = unquote(strings.TrimSpace(value))
+		if strings.ContainsAny(value, paramMetaChars) || strings.ContainsFunc(value, isSpaceOrControl) {
+			return ref, fmt.Errorf("%w %q: param %q must not contain whitespace or any of %q", ErrInvalidRef, s, key, paramMetaChars)
+		}
+		ref.Args[key] = value
+	}
+	return ref, nil
+}
+
+// String returns the reference with its args sorted by name.
+func (ref Ref) String() string {
+	if len(ref.Args) == 0 {
+		return ref.Name
+	}
+	var sb strings.Builder
+	sb.WriteString(ref.Name)
+	sb.WriteByte('(')
+	for i, key := range slices.Sorted(maps.Keys(ref.Args)) {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(ref.Args[key]))
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+// splitArgs splits the args by commas outside of quotes, empty args are skipped.
+func splitArgs(s string) (args []string) {
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			args = append(args, s[start:i])
+			start = i + 1
+		}
+	}
+	args = append(args, s[start:])
+	return slices.DeleteFunc(args, func(arg string) bool {
+		return strings.TrimSpace(arg) == ""
+	})
+}
+
+func isSpaceOrControl(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsControl(r)
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func isValidName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\()=, `)
+}
+
+// Resolve resolves a preset reference to its rules, with the rules of its includes first.
+//
+// Presets are looked up in config/rule_presets (<name>.yml or <name>.yaml), then in the embedded presets.
+// Files are read on every call, so the latest content is used when routes are reloaded.
+//
+// The returned names are the presets used, the referenced preset first, then its includes in order.
+func Resolve(s string) (rules.Rules, []string, error) {
+	ref, err := ParseRef(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	var used []string
+	resolved, err := resolve(ref, nil, &used)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolved, used, nil
+}
+
+func resolve(ref Ref, stack []string, used *[]string) (rules.Rules, error) {
+	if slices.Contains(stack, ref.Name) {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrIncludeCycle, strings.Join(stack, " -> "), ref.Name)
+	}
+	if !slices.Contains(*used, ref.Name) {
+		*used = append(*used, ref.Name)
+	}
+	stack = append(stack, ref.Name)
+
+	content, path, err := readPreset(ref.Name)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, gperr.PrependSubject(err, ref.Name)
+		}
+		preset, ok := getEmbedded(ref.Name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrPresetNotFound, ref.Name)
+		}
+		if len(ref.Args) > 0 {
+			return nil, gperr.PrependSubject(fmt.Errorf("%w: embedded presets have no params", ErrUnknownParam), ref.Name)
+		}
+		return slices.Clone(preset), nil
+	}
+
+	preset, err := parsePreset(content, ref.Args)
+	if err != nil {
+		return nil, gperr.PrependSubject(err, path)
+	}
+	var result rules.Rules
+	for _, include := range preset.Include {
+		includeRef, err := ParseRef(include)
+		if err != nil {
+			return nil, gperr.PrependSubject(err, path)
+		}
+		included, err := resolve(includeRef, stack, used)
+		if err != nil {
+			return nil, gperr.PrependSubject(err, path)
+		}
+		result = append(result, included...)
+	}
+	return append(result, preset.Rules...), nil
+}
+
+func readPreset(name string) (content []byte, path string, err error) {
+	for _, ext := range []string{".yml", ".yaml"} {
+		path = filepath.Join(common.RulePresetsBasePath, name+ext)
+		content, err = os.ReadFile(path)
+		if !errors.Is(err, os.ErrNotExist) {
+			return content, path, err
+		}
+	}
+	return nil, "", err
+}
+
+func getEmbedded(name string) (rules.Rules, bool) {
+	if preset, ok := GetRulePreset(name); ok {
+		return preset, true
+	}
+	return GetRulePreset(name + ".yml")
+}
+
+// parsePreset parses a preset file and substitutes `${params.<name>}` with the args or the default values.
+func parsePreset(content []byte, args map[string]string) (*presetFile, error) {
+	var raw map[string]any
+	if yaml.Unmarshal(content, &raw) != nil || raw["rules"] == nil {
+		// rules only
+		if len(args) > 0 {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownParam, strings.Join(slices.Sorted(maps.Keys(args)), ", "))
+		}
+		text, err := substituteParams(string(content), nil)
+		if err != nil {
+			return nil, err
+		}
+		var preset presetFile
+		if _, err := serialization.ConvertString(text, reflect.ValueOf(&preset.Rules)); err != nil {
+			return nil, err
+		}
+		return &preset, nil
+	}
+
+	params, ok := raw["params"].(map[string]any)
+	if !ok && raw["params"] != nil {
+		return nil, errors.New("params: expect a mapping of param name to default value")
+	}
+	values := make(map[string]string, len(params))
+	errs := gperr.NewBuilder("invalid params")
+	for key, value := range args {
+		if _, ok := params[key]; !ok {
+			errs.Add(fmt.Errorf("%w: %q", ErrUnknownParam, key))
+			continue
+		}
+		values[key] = value
+	}
+	for key, value := range params {
+		if _, ok := values[key]; ok {
+			continue
+		}
+		if value == nil {
+			errs.Add(fmt.Errorf("%w: %q", ErrMissingParam, key))
+			continue
+		}
+		values[key] = fmt.Sprint(value)
+	}
+	if err := errs.Error(); err != nil {
+		return nil, err
+	}
+
+	for _, key := range []string{"include", "rules"} {
+		if raw[key] == nil {
+			continue
+		}
+		substituted, err := substituteAll(raw[key], values)
+		if err != nil {
+			return nil, gperr.PrependSubject(err, key)
+		}
+		raw[key] = substituted
+	}
+	var preset presetFile
+	if err := serialization.MapUnmarshalValidate(raw, &preset); err != nil {
+		return nil, err
+	}
+	return &preset, nil
+}
+
+// substituteAll substitutes the params in all strings of a YAML value.
+func substituteAll(v any, values map[string]string) (any, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return substituteParams(v, values)
+	case []any:
+		for i := range v {
+			if v[i], err = substituteAll(v[i], values); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]any:
+		for key := range v {
+			if v[key], err = substituteAll(v[key], values); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+func substituteParams(s string, values map[string]string) (string, error) {
+	var err error
+	s = paramRegex.ReplaceAllStringFunc(s, func(match string) string {
+		key := paramRegex.FindStringSubmatch(match)[1]
+		value, ok := values[key]
+		if !ok && err == nil {
+			err = fmt.Errorf("%w: %q is not declared in params", ErrUnknownParam, key)
+		}
+		return value
+	})
+	return s, err
+}
@@ -0,0 +1,165 @@
+package rulepresets
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/route/rules"
+)
+
+func writePreset(t *testing.T, name, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(filepath.Join(common.RulePresetsBasePath, name), []byte(content), 0o644))
+}
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Ref
+		err  bool
+	}{
+		{in: "sso", want: Ref{Name: "sso"}},
+		{in: "sso()", want: Ref{Name: "sso", Args: map[string]string{}}},
+		{in: "sso(group=admins)", want: Ref{Name: "sso", Args: map[string]string{"group": "admins"}}},
+		{in: ` sso( group = admins , login="/a/b" , x='y') `, want: Ref{Name: "sso", Args: map[string]string{"group": "admins", "login": "/a/b", "x": "y"}}},
+		{in: "", err: true},
+		{in: "../sso", err: true},
+		{in: "sso(group=admins", err: true},
+		{in: "sso(group)", err: true},
+		{in: "sso(a=1, a=2)", err: true},
+		// values must not change the rules they are inserted into
+		{in: `sso(login="/a, b")`, err: true},
+		{in: `sso(group="admins {\n  error 403 x\n}")`, err: true},
+		{in: `sso(group=admins|true)`, err: true},
+		{in: `sso(group=$(id))`, err: true},
+		{in: `sso(group='a"b')`, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			ref, err := ParseRef(tt.in)
+			if tt.err {
+				require.ErrorIs(t, err, ErrInvalidRef)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, ref)
+		})
+	}
+	require.Equal(t, `sso(group="admins", login="/login")`, Ref{Name: "sso", Args: map[string]string{"login": "/login", "group": "admins"}}.String())
+}
+
+func TestResolve(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll(common.RulePresetsBasePath, 0o755))
+
+	writePreset(t, "headers.yml", `
+path glob("/*") {
+  set resp_header X-Frame-Options DENY
+}
+`)
+	writePreset(t, "deny.yaml", `
+params:
+  path: ~
+  status: 403
+rules:
+  - name: deny ${params.path}
+    on: path ${params.path}
+    do: error ${params.status} Denied
+`)
+	writePreset(t, "protected.yml", `
+params:
+  group: ~
+include:
+  - headers
+  - deny(path=/${params.group})
+rules: |
+  path /login {
+    error 401 Unauthorized
+  }
+`)
+
+	t.Run("params and includes", func(t *testing.T) {
+		resolved, used, err := Resolve("protected(group=admins)")
+		require.NoError(t, err)
+		require.Equal(t, []string{"protected", "headers", "deny"}, used)
+		require.Len(t, resolved, 3)
+		require.Equal(t, "deny /admins", resolved[1].Name)
+
+		_, err = resolved.RunTests(rules.Tests{
+			{
+				Name:    "denied",
+				Request: rules.TestRequest{Path: "/admins"},
+				Expect:  rules.TestExpect{Status: http.StatusForbidden},
+			},
+			{
+				Name:    "headers",
+				Request: rules.TestRequest{Path: "/"},
+				Expect:  rules.TestExpect{Status: http.StatusOK, Headers: map[string]string{"X-Frame-Options": "DENY"}},
+			},
+			{
+				Name:    "login",
+				Request: rules.TestRequest{Path: "/login"},
+				Expect:  rules.TestExpect{Status: http.StatusUnauthorized},
+			},
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("default overridden", func(t *testing.T) {
+		resolved, _, err := Resolve("deny(path=/private, status=404)")
+		require.NoError(t, err)
+		_, err = resolved.RunTests(rules.Tests{{
+			Name:    "not found",
+			Request: rules.TestRequest{Path: "/private"},
+			Expect:  rules.TestExpect{Status: http.StatusNotFound},
+		}})
+		require.NoError(t, err)
+	})
+
+	t.Run("embedded", func(t *testing.T) {
+		resolved, used, err := Resolve("webui")
+		require.NoError(t, err)
+		require.NotEmpty(t, resolved)
+		require.Equal(t, []string{"webui"}, used)
+	})
+
+	t.Run("user preset takes precedence", func(t *testing.T) {
+		writePreset(t, "webui_dev.yml", `
+path /dev {
+  error 404 "Not Found"
+}
+`)
+		resolved, _, err := Resolve("webui_dev")
+		require.NoError(t, err)
+		require.Len(t, resolved, 1)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		writePreset(t, "cycle_a.yml", "include: [cycle_b]\nrules: |\n  path /a {\n    pass\n  }\n")
+		writePreset(t, "cycle_b.yml", "include: [cycle_a]\nrules: |\n  path /b {\n    pass\n  }\n")
+		writePreset(t, "undeclared.yml", "path ${params.path} {\n  pass\n}\n")
+
+		tests := []struct {
+			ref string
+			err error
+		}{
+			{"missing", ErrPresetNotFound},
+			{"deny", ErrMissingParam},
+			{"deny(path=/a, foo=bar)", ErrUnknownParam},
+			{"headers(foo=bar)", ErrUnknownParam},
+			{"webui(foo=bar)", ErrUnknownParam},
+			{"undeclared", ErrUnknownParam},
+			{"cycle_a", ErrIncludeCycle},
+		}
+		for _, tt := range tests {
+			t.Run(tt.ref, func(t *testing.T) {
+				_, _, err := Resolve(tt.ref)
+				require.ErrorIs(t, err, tt.err)
+			})
+		}
+	})
+}
@@ -0,0 +1,364 @@
+package rules
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/yusing/godoxy/internal/health"
+	"github.com/yusing/godoxy/internal/homepage"
+	"github.com/yusing/godoxy/internal/route/routes"
+	httputils "github.com/yusing/goutils/http"
+)
+
+const (
+	respondFilePrefix         = "@"
+	respondDefaultContentType = "text/html; charset=utf-8"
+	respondDefaultCache       = "no-store"
+	// maxRespondAssetSize is the largest file embedded into a page with asset.
+	maxRespondAssetSize = 1024 * 1024 // 1MB
+	// maxRespondAssets is the number of cached assets per respond command, later assets are read on each use.
+	maxRespondAssets = 64
+)
+
+type (
+	// respond is a parsed respond command.
+	respond struct {
+		status       int
+		contentType  string
+		cacheControl string
+		tmpl         respondTemplate
+		langs        map[string]respondTemplate // lowercase language tag to template, file templates only
+		dir          string                     // the directory of the template, assets are relative to it
+		assets       sync.Map                   // asset name to data URI
+		numAssets    atomic.Int32               // number of cached assets, up to maxRespondAssets
+	}
+	respondTemplate interface {
+		Execute(w io.Writer, data any) error
+	}
+	// respondData is the data of respond templates.
+	respondData struct {
+		Status   int
+		Lang     string        // language tag of the variant, empty for the default template
+		Route    string        // route name
+		Health   health.Status // StatusUnknown when the route has no health monitor
+		Homepage homepage.Item // homepage metadata of the route, e.g. .Homepage.Name and .Homepage.Icon
+
+		w *httputils.ResponseModifier
+		r *http.Request
+	}
+)
+
+// validateRespond parses 'status template [type=<content type>] [cache=<duration>]',
+// the template is inline, or a file when it starts with @.
+func validateRespond(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+	phase = PhasePre
+	if len(args) < 2 {
+		return phase, nil, ErrInvalidArguments.Withf("expect status, template and options")
+	}
+	status, err := strconv.Atoi(args[0])
+	if err != nil {
+		return phase, nil, ErrInvalidArguments.With(err)
+	}
+	if !httputils.IsStatusCodeValid(status) {
+		return phase, nil, ErrInvalidArguments.Subject(args[0])
+	}
+
+	resp := &respond{status: status, cacheControl: respondDefaultCache}
+	for _, opt := range args[2:] {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return phase, nil, ErrInvalidArguments.Subject(opt).Withf("expect key=value option")
+		}
+		switch key {
+		case "type":
+			if _, _, err := mime.ParseMediaType(value); err != nil {
+				return phase, nil, ErrInvalidArguments.Subject(opt).With(err)
+			}
+			resp.contentType = value
+		case "cache":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return phase, nil, ErrInvalidArguments.Subject(opt).Withf("expect a positive duration, e.g. 5m")
+			}
+			resp.cacheControl = "public, max-age=" + strconv.Itoa(int(d.Seconds()))
+		default:
+			return phase, nil, ErrInvalidArguments.Subject(opt).Withf("unknown option %q", key)
+		}
+	}
+
+	file, isFile := strings.CutPrefix(args[1], respondFilePrefix)
+	if !isFile {
+		if resp.contentType == "" {
+			resp.contentType = respondDefaultContentType
+		}
+		resp.tmpl, err = resp.parse("inline", args[1])
+		if err != nil {
+			return phase, nil, ErrInvalidArguments.With(err)
+		}
+		return phase, resp, nil
+	}
+
+	file = filepath.Clean(file)
+	if resp.contentType == "" {
+		resp.contentType = mime.TypeByExtension(filepath.Ext(file))
+		if resp.contentType == "" {
+			resp.contentType = respondDefaultContentType
+		}
+	}
+	resp.dir = filepath.Dir(file)
+	if resp.tmpl, err = resp.parseFile(file); err != nil {
+		return phase, nil, ErrInvalidArguments.With(err)
+	}
+	if err = resp.loadLangs(file); err != nil {
+		return phase, nil, ErrInvalidArguments.With(err)
+	}
+	return phase, resp, nil
+}
+
+// loadLangs loads the language variants of the template file, e.g. maintenance.de.html for maintenance.html.
+func (resp *respond) loadLangs(file string) error {
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(file, ext)
+	variants, err := filepath.Glob(base + ".*" + ext)
+	if err != nil {
+		return err
+	}
+	for _, variant := range variants {
+		lang := strings.TrimSuffix(strings.TrimPrefix(variant, base+"."), ext)
+		if !isLanguageTag(lang) {
+			continue
+		}
+		tmpl, err := resp.parseFile(variant)
+		if err != nil {
+			return err
+		}
+		if resp.langs == nil {
+			resp.langs = make(map[string]respondTemplate)
+		}
+		resp.langs[strings.ToLower(lang)] = tmpl
+	}
+	return nil
+}
+
+func (resp *respond) parseFile(file string) (respondTemplate, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return resp.parse(filepath.Base(file), string(content))
+}
+
+// parse parses the template with html/template for HTML content, text/template otherwise.
+func (resp *respond) parse(name, text string) (respondTemplate, error) {
+	funcs := map[string]any{"asset": resp.asset}
+	if mediaType, _, _ := mime.ParseMediaType(resp.contentType); mediaType == "text/html" {
+		return htmltemplate.New(name).Funcs(funcs).Parse(text)
+	}
+	return texttemplate.New(name).Funcs(funcs).Parse(text)
+}
+
+// asset returns a file relative to the template as a data URI, so pages need no static file server.
+func (resp *respond) asset(name string) (htmltemplate.URL, error) {
+	if uri, ok := resp.assets.Load(name); ok {
+		return uri.(htmltemplate.URL), nil
+	}
+	if resp.dir == "" {
+		return "", fmt.Errorf("asset %s: assets are only available in file templates", name)
+	}
+	if !filepath.IsLocal(name) {
+		return "", fmt.Errorf("asset %s is not in the template directory", name)
+	}
+	// symlinks cannot escape the template directory either
+	root, err := os.OpenRoot(resp.dir)
+	if err != nil {
+		return "", err
+	}
+	defer root.Close()
+	info, err := root.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxRespondAssetSize {
+		return "", fmt.Errorf("asset %s is larger than 1MB", name)
+	}
+	content, err := root.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" {
+		contentType = http.DetectContentType(content)
+	}
+	uri := htmltemplate.URL("data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(content))
+	if resp.numAssets.Add(1) > maxRespondAssets {
+		resp.numAssets.Add(-1)
+	} else if _, loaded := resp.assets.LoadOrStore(name, uri); loaded {
+		resp.numAssets.Add(-1)
+	}
+	return uri, nil
+}
+
+func (resp *respond) ServeHTTP(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+	data := &respondData{Status: resp.status, Route: routes.TryGetUpstreamName(r), w: w, r: r}
+	if route := routes.TryGetRoute(r); route != nil {
+		if route, ok := route.(interface{ HealthMonitor() health.HealthMonitor }); ok {
+			if mon := route.HealthMonitor(); mon != nil {
+				data.Health = mon.Status()
+			}
+		}
+		if route, ok := route.(interface{ HomepageItem() homepage.Item }); ok {
+			data.Homepage = route.HomepageItem()
+		}
+	}
+
+	tmpl := resp.tmpl
+	if len(resp.langs) > 0 {
+		data.Lang, tmpl = resp.selectLang(r.Header.Get("Accept-Language"))
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return err
+	}
+
+	// respond command should overwrite the response body
+	w.ResetBody()
+	header := w.Header()
+	header.Set("Content-Type", resp.contentType)
+	header.Set("Cache-Control", resp.cacheControl)
+	if len(resp.langs) > 0 {
+		header.Add("Vary", "Accept-Language")
+	}
+	if data.Lang != "" {
+		header.Set("Content-Language", data.Lang)
+	}
+	w.WriteHeader(resp.status)
+	if _, err := w.BodyBuffer().Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return errTerminateRule
+}
+
+// selectLang returns the variant that best matches the Accept-Language header,
+// the default template with an empty language when none matches.
+func (resp *respond) selectLang(acceptLanguage string) (string, respondTemplate) {
+	for _, lang := range parseAcceptLanguage(acceptLanguage) {
+		if lang == "*" {
+			break
+		}
+		if tmpl, ok := resp.langs[lang]; ok {
+			return lang, tmpl
+		}
+		// de-CH falls back to de, and de to the first de-* variant
+		primary, _, _ := strings.Cut(lang, "-")
+		if tmpl, ok := resp.langs[primary]; ok {
+			return primary, tmpl
+		}
+		for _, variant := range slices.Sorted(maps.Keys(resp.langs)) {
+			if strings.HasPrefix(variant, primary+"-") {
+				return variant, resp.langs[variant]
+			}
+		}
+	}
+	return "", resp.tmpl
+}
+
+// Var expands the variables in s, e.g. {{ .Var "$req_path" }} or {{ .Var "$header(User-Agent)" }}.
+func (data *respondData) Var(s string) (string, error) {
+	var sb strings.Builder
+	if _, err := ExpandVars(data.w, data.r, s, &sb); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// parseAcceptLanguage returns the lowercase language tags of the Accept-Language header by preference,
+// tags with q=0 are excluded.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	var langs []weighted
+	for part := range strings.SplitSeq(header, ",") {
+		lang, params, _ := strings.Cut(part, ";")
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" {
+			continue
+		}
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		langs = append(langs, weighted{lang, q})
+	}
+	slices.SortStableFunc(langs, func(a, b weighted) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	tags := make([]string, len(langs))
+	for i, lang := range langs {
+		tags[i] = lang.lang
+	}
+	return tags
+}
+
+// isLanguageTag reports whether s looks like a language tag, e.g. en, pt-BR or zh-Hant.
+func isLanguageTag(s string) bool {
+	primary, rest, hasSubtags := strings.Cut(s, "-")
+	if len(primary) < 2 || len(primary) > 3 || !isAlpha(primary) {
+		return false
+	}
+	if !hasSubtags {
+		return true
+	}
+	for sub := range strings.SplitSeq(rest, "-") {
+		if len(sub) == 0 || len(sub) > 8 || !isAlphanumeric(sub) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlpha(s string) bool {
+	for i := range len(s) {
+		if c := s[i] | 0x20; c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for i := range len(s) {
+		if c := s[i]; (c < '0' || c > '9') && !isAlpha(s[i:i+1]) {
+			return false
+		}
+	}
+	return true
+}
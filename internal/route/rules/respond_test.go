@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/route/routes"
+)
+
+func TestRespondCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeFile := func(name, content string) {
+		t.Helper()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	writeFile("maintenance.html", `<p>{{ .Status }} maintenance {{ .Var "$req_path" }}</p><img src="{{ asset "logo.svg" }}">`)
+	writeFile("maintenance.de.html", `<p>{{ .Status }} Wartung {{ .Lang }}</p>`)
+	writeFile("maintenance.pt-BR.html", `<p>{{ .Status }} manutenção {{ .Lang }}</p>`)
+	writeFile("maintenance.v2.html", `ignored`)
+	writeFile("logo.svg", `<svg></svg>`)
+
+	var rules Rules
+	err := parseRules(fmt.Sprintf(`
+path /inline {
+	respond 403 '<h1>{{ .Var "$req_method" }} {{ .Var "$req_path" }} & {{ .Route }}</h1>'
+}
+path /text {
+	respond 429 'slow down {{ .Var "$header(X-User)" }}' type=text/plain cache=1m
+}
+{
+	respond 503 @%s
+}`, filepath.Join(dir, "maintenance.html")), &rules)
+	require.NoError(t, err)
+
+	handler := rules.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("upstream should not be called")
+	})
+	serve := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req = routes.WithRouteContext(req, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("inline", func(t *testing.T) {
+		w := serve("/inline", nil)
+		require.Equal(t, http.StatusForbidden, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "<h1>GET /inline & </h1>", w.Body.String())
+	})
+
+	t.Run("text", func(t *testing.T) {
+		w := serve("/text", http.Header{"X-User": {"<alice>"}})
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "text/plain", w.Header().Get("Content-Type"))
+		assert.Equal(t, "public, max-age=60", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "slow down <alice>", w.Body.String())
+	})
+
+	t.Run("file", func(t *testing.T) {
+		w := serve("/app", nil)
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+		assert.Empty(t, w.Header().Get("Content-Language"))
+		assert.Equal(t, `<p>503 maintenance /app</p><img src="data:image/svg&#43;xml;base64,PHN2Zz48L3N2Zz4=">`, w.Body.String())
+	})
+
+	t.Run("languages", func(t *testing.T) {
+		tests := []struct {
+			acceptLanguage string
+			lang           string
+			body           string
+		}{
+			{"de-CH, en;q=0.8", "de", "<p>503 Wartung de</p>"},
+			{"fr, pt;q=0.5", "pt-br", "<p>503 manutenção pt-br</p>"},
+			{"en, de;q=0", "", "<p>503 maintenance /app</p>"},
+			{"*, de;q=0.1", "", "<p>503 maintenance /app</p>"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.acceptLanguage, func(t *testing.T) {
+				w := serve("/app", http.Header{"Accept-Language": {tt.acceptLanguage}})
+				require.Equal(t, http.StatusServiceUnavailable, w.Code)
+				assert.Equal(t, tt.lang, w.Header().Get("Content-Language"))
+				assert.Contains(t, w.Body.String(), tt.body)
+			})
+		}
+	})
+}
+
+func TestRespondCommand_Invalid(t *testing.T) {
+	tests := []string{
+		`respond 503`,
+		`respond 99 hello`,
+		`respond 503 hello cache=-1s`,
+		`respond 503 hello foo=bar`,
+		`respond 503 hello type=;`,
+		`respond 503 '{{ .Status'`,
+		`respond 503 @/nonexistent/maintenance.html`,
+	}
+	for _, cmd := range tests {
+		t.Run(cmd, func(t *testing.T) {
+			var rules Rules
+			require.Error(t, parseRules("{\n"+cmd+"\n}", &rules))
+		})
+	}
+}
+
+func TestRespondAsset(t *testing.T) {
+	dir := t.TempDir()
+	tplDir := filepath.Join(dir, "templates")
+	require.NoError(t, os.Mkdir(tplDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(tplDir, "logo.svg"), []byte("<svg></svg>"), 0o644))
+	require.NoError(t, os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(tplDir, "link.txt")))
+
+	resp := &respond{dir: tplDir}
+	uri, err := resp.asset("logo.svg")
+	require.NoError(t, err)
+	assert.EqualValues(t, "data:image/svg+xml;base64,PHN2Zz48L3N2Zz4=", uri)
+
+	for _, name := range []string{"../secret.txt", "/etc/passwd", "link.txt"} {
+		_, err := resp.asset(name)
+		assert.Error(t, err, name)
+	}
+	_, err = (&respond{}).asset("logo.svg")
+	assert.Error(t, err, "inline templates have no assets")
+
+	t.Run("cache is bounded", func(t *testing.T) {
+		resp := &respond{dir: tplDir}
+		for i := range maxRespondAssets + 10 {
+			name := fmt.Sprintf("%d.txt", i)
+			require.NoError(t, os.WriteFile(filepath.Join(tplDir, name), []byte(name), 0o644))
+			_, err := resp.asset(name)
+			require.NoError(t, err)
+		}
+		assert.EqualValues(t, maxRespondAssets, resp.numAssets.Load())
+		// uncached assets are still served
+		uri, err := resp.asset(fmt.Sprintf("%d.txt", maxRespondAssets+5))
+		require.NoError(t, err)
+		assert.Contains(t, string(uri), "data:text/plain")
+	})
+}
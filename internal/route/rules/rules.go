@@ -315,7 +315,7 @@ func hasTopLevelLBrace(s string) bool {
 // BuildHandler returns a http.HandlerFunc that implements the rules.
 func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 	if len(rules) == 0 {
-		return up
+		return withoutTraceHeader(up)
 	}
 
 	var defaultRule *Rule
@@ -332,10 +332,14 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 
 	if len(nonDefaultRules) == 0 {
 		if defaultRule == nil || defaultRule.Do.raw == CommandUpstream {
-			return up
+			return withoutTraceHeader(up)
 		}
 	}
 	usePassthrough := rulesCanUsePassthrough(nonDefaultRules, defaultRule)
+	// compressed bodies cannot be modified, e.g. remove resp_json_body
+	identityEncoding := slices.ContainsFunc(rules, func(rule Rule) bool {
+		return (rule.Do.pre.Phase()|rule.Do.post.Phase())&PhaseResponseBody != 0
+	})
 
 	execPreCommand := func(cmd Command, w *httputils.ResponseModifier, r *http.Request) error {
 		return cmd.pre.ServeHTTP(w, r, up)
@@ -349,12 +353,27 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		rm := httputils.GetInitResponseModifier(w)
 		if usePassthrough {
 			rm = httputils.NewPassthroughResponseModifier(w)
+		} else if identityEncoding && rm.IsPassthrough() {
+			// outer rules stream the response, buffer it so the body can be modified before it is sent
+			rm = httputils.NewResponseModifier(w)
+		}
+
+		// rule tests and nested rules share the trace of the request
+		trace := traceFromRequest(r)
+		startedTrace := false
+		if trace == nil {
+			trace = startTrace(rm, r, rules)
+			startedTrace = trace != nil
 		}
 		defer func() {
 			if _, err := rm.FlushRelease(); err != nil {
 				logFlushError(err, r)
 			}
 		}()
+		if startedTrace {
+			// before the response modifier is released
+			defer func() { trace.finish(r, rm.StatusCode()) }()
+		}
 
 		var hasError bool
 
@@ -363,10 +382,15 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		matchedNonDefaultPre := false
 		preTerminated := false
 		for i, rule := range nonDefaultRules {
-			if rule.On.phase.IsPostRule() || !rule.On.Check(rm, r) {
+			if rule.On.phase.IsPostRule() {
+				continue
+			}
+			trace.setRule(&nonDefaultRules[i])
+			if !trace.check(&nonDefaultRules[i].On, rm, r) {
 				continue
 			}
 			matchedNonDefaultPre = true
+			trace.match(&nonDefaultRules[i])
 			if preTerminated {
 				// Preserve post-only commands (e.g. logging) even after
 				// pre-phase termination.
@@ -394,17 +418,21 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		// Default rule is a fallback: run only when no non-default pre rule matched.
 		defaultExecutedPre := false
 		defaultTerminatedInPre := false
-		if defaultRule != nil && !matchedNonDefaultPre && !defaultRule.On.phase.IsPostRule() && defaultRule.On.Check(rm, r) {
-			defaultExecutedPre = true
-			if err := execPreCommand(defaultRule.Do, rm, r); err != nil {
-				if errors.Is(err, errTerminateRule) {
-					defaultTerminatedInPre = true
-				} else {
-					if httputils.IsUnexpectedError(err) {
-						// will logged by logFlushError after FlushRelease
-						rm.AppendError("executing pre rule (%s): %w", defaultRule.Do.raw, err)
+		if defaultRule != nil && !matchedNonDefaultPre && !defaultRule.On.phase.IsPostRule() {
+			trace.setRule(defaultRule)
+			if trace.check(&defaultRule.On, rm, r) {
+				defaultExecutedPre = true
+				trace.match(defaultRule)
+				if err := execPreCommand(defaultRule.Do, rm, r); err != nil {
+					if errors.Is(err, errTerminateRule) {
+						defaultTerminatedInPre = true
+					} else {
+						if httputils.IsUnexpectedError(err) {
+							// will logged by logFlushError after FlushRelease
+							rm.AppendError("executing pre rule (%s): %w", defaultRule.Do.raw, err)
+						}
+						hasError = true
 					}
-					hasError = true
 				}
 			}
 		}
@@ -413,16 +441,22 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			if hasError {
 				http.Error(rm, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			} else { // call upstream if no WriteHeader or Write was called and no error occurred
+				trace.setPhase(TracePhaseUpstream)
+				if identityEncoding {
+					r.Header.Set("Accept-Encoding", "identity")
+				}
 				up(rm, r)
 			}
 		}
 
 		// Run post commands for rules that actually executed in pre phase,
 		// unless that same rule terminated in pre phase.
+		trace.setPhase(TracePhasePost)
 		for i, rule := range nonDefaultRules {
 			if !executedPre[i] || terminatedInPre[i] {
 				continue
 			}
+			trace.setRule(&nonDefaultRules[i])
 			if err := execPostCommand(rule.Do, rm, r); err != nil {
 				if errors.Is(err, errTerminateRule) {
 					continue
@@ -434,6 +468,7 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 			}
 		}
 		if defaultExecutedPre && !defaultTerminatedInPre {
+			trace.setRule(defaultRule)
 			if err := execPostCommand(defaultRule.Do, rm, r); err != nil {
 				if !errors.Is(err, errTerminateRule) && httputils.IsUnexpectedError(err) {
 					// will logged by logFlushError after FlushRelease
@@ -443,10 +478,16 @@ func (rules Rules) BuildHandler(up http.HandlerFunc) http.HandlerFunc {
 		}
 
 		// Run true post-matcher rules after response is available.
-		for _, rule := range nonDefaultRules {
-			if !rule.On.phase.IsPostRule() || !rule.On.Check(rm, r) {
+		trace.setPhase(TracePhasePostRules)
+		for i, rule := range nonDefaultRules {
+			if !rule.On.phase.IsPostRule() {
+				continue
+			}
+			trace.setRule(&nonDefaultRules[i])
+			if !trace.check(&nonDefaultRules[i].On, rm, r) {
 				continue
 			}
+			trace.match(&nonDefaultRules[i])
 			// Post-rule matchers are only evaluated after upstream, so commands parsed
 			// as "pre" for requirement purposes still need to run in this phase.
 			if err := rule.Do.pre.ServeHTTP(rm, r, up); err != nil {
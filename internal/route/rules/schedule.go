@@ -0,0 +1,111 @@
+package rules
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yusing/godoxy/internal/timeofday"
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+	"github.com/yusing/goutils/mockable"
+)
+
+// Schedule matches the current time, in its location, against a set of time spans.
+type Schedule struct {
+	loc   *time.Location
+	match func(t time.Time) bool
+}
+
+func (s *Schedule) Match() bool {
+	return s.match(mockable.TimeNow().In(s.loc))
+}
+
+func buildScheduleChecker(args any) CheckFunc {
+	schedule := args.(*Schedule)
+	return func(w *httputils.ResponseModifier, r *http.Request) bool {
+		return schedule.Match()
+	}
+}
+
+// timeOfDayRange is [start, end) in minutes since midnight, it wraps past midnight when end <= start.
+type timeOfDayRange struct {
+	start, end int
+}
+
+func (r timeOfDayRange) contains(minutes int) bool {
+	if r.start < r.end {
+		return minutes >= r.start && minutes < r.end
+	}
+	return minutes >= r.start || minutes < r.end
+}
+
+// dateRange is an inclusive range of dates in the form of yyyymmdd.
+type dateRange struct {
+	start, end int
+}
+
+func dateOf(t time.Time) int {
+	return t.Year()*10000 + int(t.Month())*100 + t.Day()
+}
+
+func parseTimeOfDayRange(spec string) (timeOfDayRange, gperr.Error) {
+	start, end, ok := strings.Cut(spec, "-")
+	if !ok {
+		return timeOfDayRange{}, ErrInvalidArguments.Subject(spec).Withf("expect HH:MM-HH:MM")
+	}
+	var r timeOfDayRange
+	var err error
+	if r.start, err = timeofday.Parse(start, false); err != nil {
+		return timeOfDayRange{}, ErrInvalidArguments.Subject(spec).With(err)
+	}
+	if r.end, err = timeofday.Parse(end, true); err != nil {
+		return timeOfDayRange{}, ErrInvalidArguments.Subject(spec).With(err)
+	}
+	if r.end == timeofday.MinutesPerDay {
+		r.end = 0
+	}
+	if r.start == r.end {
+		return timeOfDayRange{}, ErrInvalidArguments.Subject(spec).Withf("empty time range")
+	}
+	return r, nil
+}
+
+// parseWeekdays parses a weekday or a range of weekdays (wrapping past Sunday when needed).
+func parseWeekdays(spec string) (timeofday.Weekdays, gperr.Error) {
+	days, err := timeofday.ParseWeekdays(spec)
+	if err != nil {
+		return 0, ErrInvalidArguments.Subject(spec).With(err)
+	}
+	return days, nil
+}
+
+func parseDateRange(spec string) (dateRange, gperr.Error) {
+	first, last, isRange := strings.Cut(spec, "..")
+	start, err := time.Parse(time.DateOnly, first)
+	if err != nil {
+		return dateRange{}, ErrInvalidArguments.Subject(spec).Withf("invalid date %q, expect YYYY-MM-DD", first)
+	}
+	end := start
+	if isRange {
+		if end, err = time.Parse(time.DateOnly, last); err != nil {
+			return dateRange{}, ErrInvalidArguments.Subject(spec).Withf("invalid date %q, expect YYYY-MM-DD", last)
+		}
+		if end.Before(start) {
+			return dateRange{}, ErrInvalidArguments.Subject(spec).Withf("end date is before start date")
+		}
+	}
+	return dateRange{dateOf(start), dateOf(end)}, nil
+}
+
+// parseLocation returns the location of an IANA time zone name, or the server's local time zone when name is empty.
+func parseLocation(name string) (*time.Location, gperr.Error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrInvalidArguments.Subject(name).Withf("unknown time zone")
+	}
+	return loc, nil
+}
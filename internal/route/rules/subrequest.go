@@ -0,0 +1,268 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yusing/godoxy/internal/net/gphttp"
+	"github.com/yusing/godoxy/internal/route/routes"
+	"github.com/yusing/godoxy/internal/routing"
+	"github.com/yusing/goutils/cache"
+	gperr "github.com/yusing/goutils/errs"
+	httputils "github.com/yusing/goutils/http"
+)
+
+const (
+	subrequestDefaultTimeout = 5 * time.Second
+	subrequestMaxCacheSize   = 1000
+	// maxSubrequestBodySize is the largest sub-request response body decoded for $sub_json and sub_json.
+	maxSubrequestBodySize = 1024 * 1024 // 1MB
+
+	subrequestSchemeRoute = "route"
+)
+
+type (
+	// subrequest is a parsed subrequest command.
+	subrequest struct {
+		name    string
+		method  string
+		target  templateString
+		headers []*keyValueTemplate
+		body    *templateString
+		timeout time.Duration
+		fetch   cache.CachedContextKeyFunc[*subrequestResult, subrequestKey]
+	}
+	// subrequestKey is the request sent, results are cached by it.
+	subrequestKey struct {
+		method string
+		url    string
+		header string // url encoded, values may contain any characters
+		body   string
+	}
+	// subrequestResult is the result of a sub-request, status is 0 when it fails.
+	subrequestResult struct {
+		status int
+		header http.Header
+		json   any // nil when the body is not JSON or too large
+	}
+	subrequestResultKey string
+)
+
+var subrequestClient = &http.Client{
+	Transport: gphttp.NewTransport(),
+	// the result is the response itself, not where it redirects to
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// validateSubrequest parses 'name target [method=M] [timeout=D] [cache=D] [header=Name:value]... [body=value]'.
+func validateSubrequest(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+	phase = PhasePre
+	if len(args) < 2 {
+		return phase, nil, ErrInvalidArguments.Withf("expect name, target and options")
+	}
+	name, target := args[0], args[1]
+	if !validRequestVarName(name) {
+		return phase, nil, ErrInvalidArguments.Subject(name).Withf("invalid sub-request name")
+	}
+	scheme, _, ok := strings.Cut(target, "://")
+	if !ok || (scheme != "http" && scheme != "https" && scheme != subrequestSchemeRoute) {
+		return phase, nil, ErrInvalidArguments.Subject(target).Withf("expect http://, https:// or route:// target")
+	}
+
+	sr := &subrequest{name: name, method: http.MethodGet, timeout: subrequestDefaultTimeout}
+	var tmplPhase PhaseFlag
+	tmplPhase, sr.target, err = validateTemplate(target, false)
+	if err != nil {
+		return phase, nil, err
+	}
+	phase |= tmplPhase
+
+	var ttl time.Duration
+	for _, opt := range args[2:] {
+		key, value, ok := strings.Cut(opt, "=")
+		if !ok {
+			return phase, nil, ErrInvalidArguments.Subject(opt).Withf("expect key=value option")
+		}
+		switch key {
+		case "method":
+			sr.method = strings.ToUpper(value)
+			if !httputils.IsMethodValid(sr.method) {
+				return phase, nil, ErrInvalidArguments.Subject(opt).Withf("invalid method")
+			}
+		case "timeout", "cache":
+			d, err := time.ParseDuration(value)
+			if err != nil || d <= 0 {
+				return phase, nil, ErrInvalidArguments.Subject(opt).Withf("expect a positive duration, e.g. 5s")
+			}
+			if key == "timeout" {
+				sr.timeout = d
+			} else {
+				ttl = d
+			}
+		case "header":
+			hdr, v, ok := strings.Cut(value, ":")
+			if !ok || strings.TrimSpace(hdr) == "" {
+				return phase, nil, ErrInvalidArguments.Subject(opt).Withf("expect header=Name:value")
+			}
+			tmplPhase, tmpl, err := validateTemplate(strings.TrimSpace(v), false)
+			if err != nil {
+				return phase, nil, err
+			}
+			phase |= tmplPhase
+			sr.headers = append(sr.headers, &keyValueTemplate{strings.TrimSpace(hdr), tmpl})
+		case "body":
+			tmplPhase, tmpl, err := validateTemplate(value, false)
+			if err != nil {
+				return phase, nil, err
+			}
+			phase |= tmplPhase
+			sr.body = &tmpl
+		default:
+			return phase, nil, ErrInvalidArguments.Subject(opt).Withf("unknown option %q", key)
+		}
+	}
+
+	if ttl > 0 {
+		sr.fetch = cache.NewKeyFunc(sr.do).WithMaxEntries(subrequestMaxCacheSize).WithTTL(ttl).Build()
+	} else {
+		sr.fetch = sr.do
+	}
+	return phase, sr, nil
+}
+
+func (sr *subrequest) ServeHTTP(w *httputils.ResponseModifier, r *http.Request, upstream http.HandlerFunc) error {
+	key, err := sr.key(w, r)
+	if err == nil {
+		var result *subrequestResult
+		result, err = sr.fetch(r.Context(), key)
+		if err == nil {
+			routes.SetRequestValue(r, subrequestResultKey(sr.name), result)
+			return nil
+		}
+	}
+	// the result of a failed sub-request has status 0, so status checks fail closed
+	routes.SetRequestValue(r, subrequestResultKey(sr.name), &subrequestResult{})
+	w.AppendError("subrequest %s: %w", sr.name, err)
+	return nil
+}
+
+// key expands the templates into the request to send.
+func (sr *subrequest) key(w *httputils.ResponseModifier, r *http.Request) (subrequestKey, error) {
+	target, _, err := sr.target.ExpandVarsToString(w, r)
+	if err != nil {
+		return subrequestKey{}, err
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return subrequestKey{}, err
+	}
+	if u.Scheme == subrequestSchemeRoute {
+		ep := routing.EntrypointFromCtx(r.Context())
+		if ep == nil {
+			return subrequestKey{}, errors.New("entrypoint not found")
+		}
+		route, ok := ep.HTTPRoutes().Get(u.Host)
+		if !ok || route.TargetURL() == nil {
+			return subrequestKey{}, fmt.Errorf("route %q not found", u.Host)
+		}
+		routeURL := route.TargetURL().URL
+		routeURL.Path, routeURL.RawPath = u.Path, u.RawPath
+		routeURL.RawQuery = u.RawQuery
+		u = &routeURL
+	}
+
+	key := subrequestKey{method: sr.method, url: u.String()}
+	header := make(url.Values, len(sr.headers))
+	for _, h := range sr.headers {
+		name, tmpl := h.Unpack()
+		v, _, err := tmpl.ExpandVarsToString(w, r)
+		if err != nil {
+			return subrequestKey{}, err
+		}
+		header.Add(name, v)
+	}
+	key.header = header.Encode()
+	if sr.body != nil {
+		if key.body, _, err = sr.body.ExpandVarsToString(w, r); err != nil {
+			return subrequestKey{}, err
+		}
+	}
+	return key, nil
+}
+
+func (sr *subrequest) do(ctx context.Context, key subrequestKey) (*subrequestResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, sr.timeout)
+	defer cancel()
+
+	var body io.Reader
+	if key.body != "" {
+		body = strings.NewReader(key.body)
+	}
+	req, err := http.NewRequestWithContext(ctx, key.method, key.url, body)
+	if err != nil {
+		return nil, err
+	}
+	header, err := url.ParseQuery(key.header)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		for _, v := range values {
+			req.Header.Add(name, v)
+		}
+	}
+
+	resp, err := subrequestClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &subrequestResult{status: resp.StatusCode, header: resp.Header}
+	if isJSONBody(resp.Header) && resp.ContentLength <= maxSubrequestBodySize {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxSubrequestBodySize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) <= maxSubrequestBodySize {
+			if doc, err := unmarshalJSON(bytes.TrimSpace(data)); err == nil {
+				result.json = doc
+			}
+		}
+	}
+	return result, nil
+}
+
+// subrequestResultOf returns the result of the named sub-request made earlier in the request, nil when there is none.
+func subrequestResultOf(r *http.Request, name string) *subrequestResult {
+	result, _ := routes.RequestValue(r, subrequestResultKey(name)).(*subrequestResult)
+	return result
+}
+
+// validateSubrequestName returns the name of a sub-request from the first of args.
+func validateSubrequestName(args []string) (string, gperr.Error) {
+	if len(args) == 0 {
+		return "", ErrNoArgProvided
+	}
+	if !validRequestVarName(args[0]) {
+		return "", ErrInvalidArguments.Subject(args[0]).Withf("invalid sub-request name")
+	}
+	return args[0], nil
+}
+
+func (result *subrequestResult) statusString() string {
+	if result == nil {
+		return ""
+	}
+	return strconv.Itoa(result.status)
+}
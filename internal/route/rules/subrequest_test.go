@@ -0,0 +1,122 @@
+package rules
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/route/routes"
+)
+
+func TestSubrequestCommand(t *testing.T) {
+	var hits atomic.Int32
+	entitlement := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if r.URL.Path != "/check/api" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Ent", "checked")
+		switch r.Header.Get("X-User") {
+		case "alice":
+			fmt.Fprint(w, `{"allowed":true,"plan":"pro"}`)
+		case "bob":
+			fmt.Fprint(w, `{"allowed":false}`)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer entitlement.Close()
+
+	var rules Rules
+	err := parseRules(fmt.Sprintf(`
+{
+	subrequest ent %s/check$req_path 'header=X-User:$header(X-User)' cache=1m
+}
+!sub_status ent 2xx | !sub_json ent .allowed true {
+	error 403 forbidden
+}
+{
+	set header X-Plan '$sub_json(ent, .plan)'
+	set header X-Status $sub_status(ent)
+	set header X-Ent '$sub_header(ent, X-Ent)'
+}`, entitlement.URL), &rules)
+	require.NoError(t, err)
+
+	var got http.Header
+	handler := rules.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+	})
+	serve := func(user string) int {
+		got = nil
+		req := httptest.NewRequest(http.MethodGet, "/api", nil)
+		req.Header.Set("X-User", user)
+		req = routes.WithRouteContext(req, nil)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, serve("alice"))
+	assert.Equal(t, "pro", got.Get("X-Plan"))
+	assert.Equal(t, "200", got.Get("X-Status"))
+	assert.Equal(t, "checked", got.Get("X-Ent"))
+
+	require.Equal(t, http.StatusOK, serve("alice"))
+	assert.EqualValues(t, 1, hits.Load(), "result should be cached")
+
+	assert.Equal(t, http.StatusForbidden, serve("bob"))
+	assert.Equal(t, http.StatusForbidden, serve("eve"))
+	assert.EqualValues(t, 3, hits.Load())
+	assert.Nil(t, got)
+}
+
+func TestSubrequestCommand_Failure(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	var rules Rules
+	err := parseRules(fmt.Sprintf(`
+{
+	subrequest ent %s/check timeout=1s
+}
+sub_status ent 0 {
+	error 503 "$sub_status(ent)"
+}`, down.URL), &rules)
+	require.NoError(t, err)
+
+	handler := rules.BuildHandler(mockUpstream(http.StatusOK, "ok"))
+	req := routes.WithRouteContext(httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "0\n", w.Body.String())
+}
+
+func TestSubrequestCommand_Validate(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+	}{
+		{"missing target", `subrequest ent`},
+		{"invalid name", `subrequest 'bad name' https://example.com`},
+		{"invalid scheme", `subrequest ent ftp://example.com`},
+		{"unknown option", `subrequest ent https://example.com retries=3`},
+		{"invalid option", `subrequest ent https://example.com cache`},
+		{"invalid duration", `subrequest ent https://example.com timeout=-1s`},
+		{"invalid method", `subrequest ent https://example.com method=G@T`},
+		{"invalid header", `subrequest ent https://example.com header=X-User`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rules Rules
+			require.ErrorIs(t, parseRules("{\n\t"+tt.rule+"\n}", &rules), ErrInvalidArguments)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+
+	"github.com/yusing/godoxy/internal/route/routes"
+	gperr "github.com/yusing/goutils/errs"
+)
+
+type (
+	/*
+		Tests are declarative test cases of a rule set, run against a mock upstream.
+		Commands with side effects (proxy, route, subrequest, log and notify) are skipped,
+		proxy and route end at the mock upstream.
+
+			Example:
+
+				rule_tests:
+				  - name: login page is public
+				    request:
+				      path: /login
+				    expect:
+				      status: 200
+				      upstream_called: true
+				  - name: admin requires auth
+				    request:
+				      path: /admin
+				    expect:
+				      status: 401
+				      matched_rules: [admin]
+	*/
+	Tests []Test
+	Test  struct {
+		Name     string       `json:"name" validate:"required"`
+		Request  TestRequest  `json:"request"`
+		Upstream TestResponse `json:"upstream"` // response of the mock upstream
+		Expect   TestExpect   `json:"expect"`
+	}
+	TestRequest struct {
+		Method   string            `json:"method,omitempty"`                                 // default GET
+		Path     string            `json:"path,omitempty" validate:"omitempty,startswith=/"` // path and query, default /
+		Host     string            `json:"host,omitempty"`                                   // default localhost
+		Headers  map[string]string `json:"headers,omitempty"`
+		Body     string            `json:"body,omitempty"`
+		RemoteIP string            `json:"remote_ip,omitempty" validate:"omitempty,ip"` // default 127.0.0.1
+	}
+	TestResponse struct {
+		Status  int               `json:"status,omitempty" validate:"omitempty,min=100,max=999"` // default 200
+		Headers map[string]string `json:"headers,omitempty"`
+		Body    string            `json:"body,omitempty"`
+	}
+	// TestExpect is the expected outcome of a test, unset fields are not checked.
+	TestExpect struct {
+		Status         int               `json:"status,omitempty" validate:"omitempty,min=100,max=999"`
+		Headers        map[string]string `json:"headers,omitempty"` // response headers, an empty value expects the header to be absent
+		BodyContains   string            `json:"body_contains,omitempty"`
+		MatchedRules   []string          `json:"matched_rules,omitempty"` // names of the matched rules in order
+		Path           string            `json:"path,omitempty"`          // path received by the upstream, with the query when it contains '?'
+		UpstreamCalled *bool             `json:"upstream_called,omitempty"`
+	}
+
+	TestResult struct {
+		Name           string       `json:"name"`
+		Passed         bool         `json:"passed"`
+		Failures       []string     `json:"failures,omitempty"`
+		Status         int          `json:"status"`
+		MatchedRules   []string     `json:"matched_rules"`
+		UpstreamCalled bool         `json:"upstream_called"`
+		UpstreamPath   string       `json:"upstream_path,omitempty"`
+		Trace          []TraceEvent `json:"trace,omitempty"` // execution trace of failed tests
+	}
+)
+
+// RunTests runs the tests against the rules and returns their results,
+// the error lists the failures of each failed test.
+func (rules Rules) RunTests(tests Tests) ([]TestResult, error) {
+	// name unnamed rules like Validate does, so tests can refer to them
+	rules = slices.Clone(rules)
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = fmt.Sprintf("rule[%d]", i)
+		}
+	}
+
+	results := make([]TestResult, len(tests))
+	errs := gperr.NewBuilder("rule tests failed")
+	for i := range tests {
+		results[i] = rules.runTest(&tests[i])
+		if !results[i].Passed {
+			errs.AddSubject(errors.New(strings.Join(results[i].Failures, ", ")), tests[i].Name)
+		}
+	}
+	return results, errs.Error()
+}
+
+func (rules Rules) runTest(test *Test) (result TestResult) {
+	result.Name = test.Name
+
+	w := httptest.NewRecorder()
+	r := test.Request.newRequest()
+	// matched rules are recorded by the trace
+	trace := newTrace(rules)
+	trace.test = true
+	trace.begin(r)
+	defer func() {
+		if err := recover(); err != nil {
+			result.Failures = append(result.Failures, fmt.Sprintf("panic: %v", err))
+		}
+		trace.end(r)
+		result.MatchedRules = trace.MatchedRules
+		result.Passed = len(result.Failures) == 0
+		if !result.Passed {
+			result.Trace = trace.Events
+		}
+	}()
+
+	up := func(w http.ResponseWriter, r *http.Request) {
+		result.UpstreamCalled = true
+		result.UpstreamPath = r.URL.RequestURI()
+		for k, v := range test.Upstream.Headers {
+			w.Header().Set(k, v)
+		}
+		status := test.Upstream.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(test.Upstream.Body))
+	}
+
+	rules.BuildHandler(up)(w, r)
+
+	result.Status = w.Code
+	result.MatchedRules = trace.MatchedRules
+	result.Failures = test.Expect.check(w, &result)
+	return result
+}
+
+func (req *TestRequest) newRequest() *http.Request {
+	method, path, host, remoteIP := req.Method, req.Path, req.Host, req.RemoteIP
+	if method == "" {
+		method = http.MethodGet
+	}
+	if path == "" {
+		path = "/"
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	if remoteIP == "" {
+		remoteIP = "127.0.0.1"
+	}
+	var body io.Reader
+	if req.Body != "" {
+		body = strings.NewReader(req.Body)
+	}
+	r := httptest.NewRequest(method, path, body)
+	r.Host = host
+	r.RemoteAddr = net.JoinHostPort(remoteIP, "0")
+	for k, v := range req.Headers {
+		r.Header.Set(k, v)
+	}
+	return routes.WithRouteContext(r, nil)
+}
+
+func (expect *TestExpect) check(w *httptest.ResponseRecorder, result *TestResult) (failures []string) {
+	if expect.Status != 0 && w.Code != expect.Status {
+		failures = append(failures, fmt.Sprintf("status: expect %d, got %d", expect.Status, w.Code))
+	}
+	for k, v := range expect.Headers {
+		got, ok := w.Header()[http.CanonicalHeaderKey(k)]
+		switch {
+		case v == "" && ok:
+			failures = append(failures, fmt.Sprintf("header %s: expect absent, got %q", k, strings.Join(got, ", ")))
+		case v != "" && w.Header().Get(k) != v:
+			failures = append(failures, fmt.Sprintf("header %s: expect %q, got %q", k, v, w.Header().Get(k)))
+		}
+	}
+	if expect.BodyContains != "" && !strings.Contains(w.Body.String(), expect.BodyContains) {
+		failures = append(failures, fmt.Sprintf("body: expect to contain %q", expect.BodyContains))
+	}
+	if expect.MatchedRules != nil && !slices.Equal(expect.MatchedRules, result.MatchedRules) {
+		failures = append(failures, fmt.Sprintf("matched rules: expect %v, got %v", expect.MatchedRules, result.MatchedRules))
+	}
+	if expect.UpstreamCalled != nil && *expect.UpstreamCalled != result.UpstreamCalled {
+		failures = append(failures, fmt.Sprintf("upstream called: expect %t, got %t", *expect.UpstreamCalled, result.UpstreamCalled))
+	}
+	if expect.Path != "" {
+		got, _, _ := strings.Cut(result.UpstreamPath, "?")
+		if strings.Contains(expect.Path, "?") {
+			got = result.UpstreamPath
+		}
+		switch {
+		case !result.UpstreamCalled:
+			failures = append(failures, fmt.Sprintf("path: expect %q, upstream not called", expect.Path))
+		case got != expect.Path:
+			failures = append(failures, fmt.Sprintf("path: expect %q, got %q", expect.Path, got))
+		}
+	}
+	return failures
+}
@@ -0,0 +1,217 @@
+package rules_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/yusing/godoxy/internal/route/rules"
+)
+
+func TestRunTests(t *testing.T) {
+	var rules Rules
+	err := parseRules(`
+- name: admin
+  on: path glob(/admin/*)
+  do: error 401 Unauthorized
+- name: api
+  on: path glob(/api/*)
+  do: |
+    rewrite /api/ /v1/
+    set resp_header X-API true
+- name: hide
+  on: status 5xx
+  do: remove resp_header X-Internal
+`, &rules)
+	require.NoError(t, err)
+
+	upstreamCalled := true
+	tests := Tests{
+		{
+			Name:    "admin requires auth",
+			Request: TestRequest{Path: "/admin/users"},
+			Expect: TestExpect{
+				Status:         http.StatusUnauthorized,
+				BodyContains:   "Unauthorized",
+				MatchedRules:   []string{"admin"},
+				UpstreamCalled: new(bool),
+			},
+		},
+		{
+			Name:    "api is rewritten",
+			Request: TestRequest{Method: http.MethodPost, Path: "/api/users?page=2", Body: "{}"},
+			Expect: TestExpect{
+				Status:         http.StatusOK,
+				Headers:        map[string]string{"X-API": "true"},
+				MatchedRules:   []string{"api"},
+				Path:           "/v1/users?page=2",
+				UpstreamCalled: &upstreamCalled,
+			},
+		},
+		{
+			Name:     "internal header is hidden on errors",
+			Request:  TestRequest{Path: "/"},
+			Upstream: TestResponse{Status: http.StatusBadGateway, Headers: map[string]string{"X-Internal": "1"}},
+			Expect: TestExpect{
+				Status:       http.StatusBadGateway,
+				Headers:      map[string]string{"X-Internal": ""},
+				MatchedRules: []string{"hide"},
+				Path:         "/",
+			},
+		},
+	}
+	results, err := rules.RunTests(tests)
+	require.NoError(t, err)
+	require.Len(t, results, len(tests))
+	for _, result := range results {
+		assert.True(t, result.Passed, result.Name)
+		assert.Empty(t, result.Failures, result.Name)
+	}
+}
+
+func TestRunTestsFailures(t *testing.T) {
+	var rules Rules
+	err := parseRules(`
+- name: login
+  on: path /login
+  do: error 403 Forbidden
+`, &rules)
+	require.NoError(t, err)
+
+	upstreamCalled := true
+	results, err := rules.RunTests(Tests{
+		{
+			Name:    "login page is public",
+			Request: TestRequest{Path: "/login"},
+			Expect: TestExpect{
+				Status:         http.StatusOK,
+				Headers:        map[string]string{"X-Login": "1"},
+				MatchedRules:   []string{},
+				Path:           "/login",
+				UpstreamCalled: &upstreamCalled,
+			},
+		},
+		{
+			Name:    "home page",
+			Request: TestRequest{Path: "/"},
+			Expect:  TestExpect{Status: http.StatusOK, MatchedRules: []string{}},
+		},
+	})
+	require.Error(t, err)
+	require.ErrorContains(t, err, "login page is public")
+	require.NotContains(t, err.Error(), "home page")
+
+	require.False(t, results[0].Passed)
+	assert.Equal(t, []string{
+		"status: expect 200, got 403",
+		`header X-Login: expect "1", got ""`,
+		"matched rules: expect [], got [login]",
+		"upstream called: expect true, got false",
+		`path: expect "/login", upstream not called`,
+	}, results[0].Failures)
+	assert.Equal(t, http.StatusForbidden, results[0].Status)
+	assert.Equal(t, []string{"login"}, results[0].MatchedRules)
+
+	require.True(t, results[1].Passed)
+	assert.True(t, results[1].UpstreamCalled)
+	assert.Equal(t, "/", results[1].UpstreamPath)
+}
+
+func TestRunTestsTrace(t *testing.T) {
+	var rules Rules
+	err := parseRules(`
+- name: echo
+  on: path /echo
+  do: |
+    set resp_header X-Path $req_path
+    set resp_header X-Auth $header(Authorization)
+`, &rules)
+	require.NoError(t, err)
+
+	results, err := rules.RunTests(Tests{
+		{
+			Name:    "passed tests have no trace",
+			Request: TestRequest{Path: "/echo"},
+			Expect:  TestExpect{Headers: map[string]string{"X-Path": "/echo"}},
+		},
+		{
+			Name:    "failed tests have the trace",
+			Request: TestRequest{Path: "/echo", Headers: map[string]string{"Authorization": "Bearer secret"}},
+			Expect:  TestExpect{Status: http.StatusTeapot},
+		},
+	})
+	require.Error(t, err)
+	require.Empty(t, results[0].Trace)
+
+	trace := results[1].Trace
+	require.NotEmpty(t, trace)
+	assert.Equal(t, TraceEventPhase, trace[0].Type)
+	assert.Equal(t, TracePhasePre, trace[0].Phase)
+	matched := true
+	assert.Contains(t, trace, TraceEvent{Type: TraceEventOn, Phase: TracePhasePre, Rule: "echo", Expr: "path /echo", Matched: &matched})
+
+	vars := map[string]string{}
+	var commands []string
+	for _, ev := range trace {
+		switch ev.Type {
+		case TraceEventVar:
+			assert.Equal(t, "echo", ev.Rule)
+			vars[ev.Expr] = ev.Value
+		case TraceEventDo:
+			commands = append(commands, ev.Expr)
+		}
+	}
+	assert.Equal(t, map[string]string{"$req_path": "/echo", "$header(Authorization)": "[REDACTED]"}, vars)
+	assert.Equal(t, []string{"set resp_header X-Path $req_path", "set resp_header X-Auth $header(Authorization)"}, commands)
+	assert.NotContains(t, fmt.Sprint(trace), "Bearer secret")
+}
+
+func TestRunTestsSkipSideEffects(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	var rules Rules
+	err := parseRules(fmt.Sprintf(`
+- name: sub
+  on: path /sub
+  do: subrequest check %[1]s/check
+- name: proxy
+  on: path /proxy
+  do: proxy %[1]s
+`, srv.URL), &rules)
+	require.NoError(t, err)
+
+	results, err := rules.RunTests(Tests{
+		{
+			Name:    "subrequest is skipped",
+			Request: TestRequest{Path: "/sub"},
+			Expect:  TestExpect{MatchedRules: []string{"sub"}, Path: "/sub"},
+		},
+		{
+			Name:    "proxy goes to the mock upstream",
+			Request: TestRequest{Path: "/proxy"},
+			Expect:  TestExpect{Status: http.StatusTeapot, MatchedRules: []string{"proxy"}},
+		},
+	})
+	require.Error(t, err)
+	assert.True(t, results[0].Passed)
+	require.False(t, results[1].Passed)
+	assert.True(t, results[1].UpstreamCalled)
+	assert.Equal(t, "/proxy", results[1].UpstreamPath)
+	assert.Contains(t, results[1].Trace, TraceEvent{
+		Type:    TraceEventDo,
+		Phase:   TracePhasePre,
+		Rule:    "proxy",
+		Expr:    "proxy " + srv.URL,
+		Skipped: true,
+	})
+	assert.Zero(t, hits.Load())
+}
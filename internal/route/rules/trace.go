@@ -0,0 +1,374 @@
+package rules
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/route/routes"
+	httputils "github.com/yusing/goutils/http"
+)
+
+const (
+	// TraceHeader enables tracing of a request, its value is a token from NewTraceToken,
+	// or `<unix expiry>.<hex hmac>` signed with GODOXY_RULES_TRACE_SECRET, see SignTrace.
+	// It is removed from the request before the rules run.
+	TraceHeader = "X-GoDoxy-Rules-Trace"
+	// TraceIDHeader is the response header of the trace ID of a traced request.
+	TraceIDHeader = "X-GoDoxy-Rules-Trace-Id"
+
+	MaxTraceTTL = time.Hour
+
+	maxTraceEvents   = 1000
+	maxStoredTraces  = 100
+	storedTracesTTL  = 15 * time.Minute
+	redactedVarValue = "[REDACTED]"
+)
+
+type (
+	// Trace is the execution trace of the rules on a request.
+	Trace struct {
+		ID           string       `json:"id"`
+		Route        string       `json:"route"`
+		Time         time.Time    `json:"time"`
+		Method       string       `json:"method"`
+		Host         string       `json:"host"`
+		URI          string       `json:"uri"`
+		Rules        []TraceRule  `json:"rules"`
+		MatchedRules []string     `json:"matched_rules"`
+		Events       []TraceEvent `json:"events"`
+		Truncated    bool         `json:"truncated,omitempty"` // events after the first 1000 are dropped
+		Status       int          `json:"status"`
+
+		mu    sync.Mutex
+		phase TracePhase
+		rule  string
+		test  bool // trace of a rule test, commands with side effects are skipped
+	}
+	TraceRule struct {
+		Name string `json:"name"`
+		On   string `json:"on"`
+		Do   string `json:"do"`
+	}
+	TraceEvent struct {
+		Type       TraceEventType `json:"type"`
+		Phase      TracePhase     `json:"phase"`
+		Rule       string         `json:"rule,omitempty"`
+		Expr       string         `json:"expr,omitempty"`    // on: the condition, do: the command, var: the variable
+		Matched    *bool          `json:"matched,omitempty"` // on only
+		Value      string         `json:"value,omitempty"`   // var only, sensitive values are redacted
+		Error      string         `json:"error,omitempty"`   // do only
+		Terminated bool           `json:"terminated,omitempty"`
+		Skipped    bool           `json:"skipped,omitempty"` // do only, commands with side effects in rule tests
+	}
+	TraceEventType string
+	TracePhase     string
+)
+
+const (
+	TraceEventPhase TraceEventType = "phase"
+	TraceEventOn    TraceEventType = "on"
+	TraceEventDo    TraceEventType = "do"
+	TraceEventVar   TraceEventType = "var"
+)
+
+const (
+	TracePhasePre       TracePhase = "pre"        // request rules
+	TracePhaseUpstream  TracePhase = "upstream"   // upstream called
+	TracePhasePost      TracePhase = "post"       // post commands of the matched request rules
+	TracePhasePostRules TracePhase = "post_rules" // rules with response matchers
+)
+
+type traceKey struct{}
+
+// activeTraces is the number of requests being traced, so untraced requests skip the lookup.
+var activeTraces atomic.Int64
+
+var (
+	traceTokens   = make(map[string]traceToken)
+	traceTokensMu sync.Mutex
+
+	storedTraces   = make(map[string]*Trace)
+	storedTraceIDs []string // oldest first
+	storedTracesMu sync.Mutex
+)
+
+type traceToken struct {
+	route   string
+	expires time.Time
+}
+
+var ErrInvalidTraceTTL = errors.New("trace ttl must be between 1s and 1h")
+
+// NewTraceToken returns a token for TraceHeader that enables tracing on the route until it expires.
+func NewTraceToken(route string, ttl time.Duration) (token string, expires time.Time, err error) {
+	if ttl < time.Second || ttl > MaxTraceTTL {
+		return "", time.Time{}, ErrInvalidTraceTTL
+	}
+	token = rand.Text()
+	expires = time.Now().Add(ttl)
+
+	traceTokensMu.Lock()
+	defer traceTokensMu.Unlock()
+	for t, info := range traceTokens {
+		if time.Now().After(info.expires) {
+			delete(traceTokens, t)
+		}
+	}
+	traceTokens[token] = traceToken{route: route, expires: expires}
+	return token, expires, nil
+}
+
+// SignTrace returns a TraceHeader value for the route signed with the secret.
+//
+// The signature is the hex encoded HMAC-SHA256 of `<route>.<unix expiry>`.
+func SignTrace(secret []byte, route string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	return exp + "." + signTrace(secret, route, exp)
+}
+
+func signTrace(secret []byte, route, exp string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(route + "." + exp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authorizeTrace reports whether the TraceHeader value enables tracing on the route.
+func authorizeTrace(value, route string) bool {
+	if exp, sig, ok := strings.Cut(value, "."); ok {
+		if len(common.RulesTraceSecret) == 0 {
+			return false
+		}
+		unix, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil {
+			return false
+		}
+		// signed values must be short-lived
+		if expires := time.Unix(unix, 0); time.Now().After(expires) || time.Until(expires) > MaxTraceTTL {
+			return false
+		}
+		return hmac.Equal([]byte(sig), []byte(signTrace(common.RulesTraceSecret, route, exp)))
+	}
+
+	traceTokensMu.Lock()
+	defer traceTokensMu.Unlock()
+	info, ok := traceTokens[value]
+	if !ok {
+		return false
+	}
+	if time.Now().After(info.expires) {
+		delete(traceTokens, value)
+		return false
+	}
+	return info.route == route
+}
+
+// GetTrace returns a stored trace by ID.
+func GetTrace(id string) (*Trace, bool) {
+	storedTracesMu.Lock()
+	defer storedTracesMu.Unlock()
+	t, ok := storedTraces[id]
+	if !ok || time.Since(t.Time) > storedTracesTTL {
+		return nil, false
+	}
+	return t, true
+}
+
+func newTrace(rules Rules) *Trace {
+	t := &Trace{
+		Time:         time.Now(),
+		Rules:        make([]TraceRule, len(rules)),
+		MatchedRules: []string{},
+		Events:       []TraceEvent{},
+		phase:        TracePhasePre,
+	}
+	for i := range rules {
+		t.Rules[i] = TraceRule{Name: rules[i].Name, On: rules[i].On.String(), Do: rules[i].Do.String()}
+	}
+	return t
+}
+
+// startTrace starts tracing the request when it has a valid TraceHeader, it returns nil otherwise.
+func startTrace(w *httputils.ResponseModifier, r *http.Request, rules Rules) *Trace {
+	value := r.Header.Get(TraceHeader)
+	if value == "" {
+		return nil
+	}
+	r.Header.Del(TraceHeader)
+	route := routes.TryGetUpstreamName(r)
+	if route == "" || !authorizeTrace(value, route) {
+		return nil
+	}
+
+	t := newTrace(rules)
+	t.ID = rand.Text()
+	t.Route = route
+	t.Method = r.Method
+	t.Host = r.Host
+	t.URI = r.URL.RequestURI()
+	t.begin(r)
+	w.Header().Set(TraceIDHeader, t.ID)
+	return t
+}
+
+// withoutTraceHeader removes TraceHeader from requests of routes without rules to trace,
+// so the token is not sent upstream.
+func withoutTraceHeader(up http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Del(TraceHeader)
+		up(w, r)
+	}
+}
+
+// begin makes the trace the trace of the request.
+func (t *Trace) begin(r *http.Request) {
+	activeTraces.Add(1)
+	routes.SetRequestValue(r, traceKey{}, t)
+	t.add(TraceEvent{Type: TraceEventPhase})
+}
+
+// end stops recording events of the trace.
+func (t *Trace) end(r *http.Request) {
+	routes.SetRequestValue(r, traceKey{}, nil)
+	activeTraces.Add(-1)
+}
+
+// finish ends the trace and stores it for GetTrace.
+func (t *Trace) finish(r *http.Request, status int) {
+	t.end(r)
+	t.Status = status
+
+	storedTracesMu.Lock()
+	defer storedTracesMu.Unlock()
+	for len(storedTraceIDs) > 0 {
+		oldest := storedTraces[storedTraceIDs[0]]
+		if len(storedTraceIDs) < maxStoredTraces && time.Since(oldest.Time) <= storedTracesTTL {
+			break
+		}
+		delete(storedTraces, storedTraceIDs[0])
+		storedTraceIDs = storedTraceIDs[1:]
+	}
+	storedTraces[t.ID] = t
+	storedTraceIDs = append(storedTraceIDs, t.ID)
+}
+
+// traceFromRequest returns the trace of the request, nil when it is not traced.
+func traceFromRequest(r *http.Request) *Trace {
+	if activeTraces.Load() == 0 {
+		return nil
+	}
+	t, _ := routes.RequestValue(r, traceKey{}).(*Trace)
+	return t
+}
+
+func (t *Trace) add(ev TraceEvent) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.Events) >= maxTraceEvents {
+		t.Truncated = true
+		return -1
+	}
+	ev.Phase = t.phase
+	if ev.Type != TraceEventPhase {
+		ev.Rule = t.rule
+	}
+	t.Events = append(t.Events, ev)
+	return len(t.Events) - 1
+}
+
+func (t *Trace) setPhase(phase TracePhase) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.phase = phase
+	t.rule = ""
+	t.mu.Unlock()
+	t.add(TraceEvent{Type: TraceEventPhase})
+}
+
+// setRule sets the rule of the following events.
+func (t *Trace) setRule(rule *Rule) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.rule = rule.Name
+	t.mu.Unlock()
+}
+
+// match records a matched rule.
+func (t *Trace) match(rule *Rule) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.MatchedRules = append(t.MatchedRules, rule.Name)
+	t.mu.Unlock()
+}
+
+// check checks the condition and records the result.
+func (t *Trace) check(on *RuleOn, w *httputils.ResponseModifier, r *http.Request) bool {
+	matched := on.Check(w, r)
+	if t != nil {
+		t.add(TraceEvent{Type: TraceEventOn, Expr: on.raw, Matched: &matched})
+	}
+	return matched
+}
+
+// skip records a command that was not run.
+func (t *Trace) skip(cmd string) {
+	t.add(TraceEvent{Type: TraceEventDo, Expr: cmd, Skipped: true})
+}
+
+// do records an executed command, call the returned function with its result.
+func (t *Trace) do(cmd string) func(err error) {
+	i := t.add(TraceEvent{Type: TraceEventDo, Expr: cmd})
+	return func(err error) {
+		if i < 0 || err == nil {
+			return
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if errors.Is(err, errTerminateRule) {
+			t.Events[i].Terminated = true
+		} else {
+			t.Events[i].Error = err.Error()
+		}
+	}
+}
+
+var sensitiveVarWords = []string{"auth", "cookie", "token", "secret", "password", "passwd", "session", "key", "credential", "signature"}
+
+// expandVar records an expanded variable, the value is redacted when the name or the args look sensitive.
+func (t *Trace) expandVar(name string, args []string, value string) {
+	expr := "$" + name
+	if len(args) > 0 {
+		expr += "(" + strings.Join(args, ", ") + ")"
+	}
+	if value != "" && isSensitiveVar(name, args) {
+		value = redactedVarValue
+	}
+	t.add(TraceEvent{Type: TraceEventVar, Expr: expr, Value: value})
+}
+
+func isSensitiveVar(name string, args []string) bool {
+	for _, s := range append([]string{name}, args...) {
+		s = strings.ToLower(s)
+		for _, word := range sensitiveVarWords {
+			if strings.Contains(s, word) {
+				return true
+			}
+		}
+	}
+	return false
+}
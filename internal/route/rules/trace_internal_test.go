@@ -0,0 +1,73 @@
+package rules
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/common"
+)
+
+func TestAuthorizeTrace(t *testing.T) {
+	t.Run("token", func(t *testing.T) {
+		token, expires, err := NewTraceToken("app", time.Minute)
+		require.NoError(t, err)
+		require.WithinDuration(t, time.Now().Add(time.Minute), expires, time.Second)
+		require.True(t, authorizeTrace(token, "app"))
+		require.False(t, authorizeTrace(token, "other"))
+		require.False(t, authorizeTrace("invalid", "app"))
+
+		_, _, err = NewTraceToken("app", 2*time.Hour)
+		require.ErrorIs(t, err, ErrInvalidTraceTTL)
+	})
+
+	t.Run("signed", func(t *testing.T) {
+		secret := []byte("secret")
+		value := SignTrace(secret, "app", time.Now().Add(time.Minute))
+		require.False(t, authorizeTrace(value, "app"), "signed values are rejected without a secret")
+
+		prev := common.RulesTraceSecret
+		common.RulesTraceSecret = secret
+		t.Cleanup(func() { common.RulesTraceSecret = prev })
+
+		require.True(t, authorizeTrace(value, "app"))
+		require.False(t, authorizeTrace(value, "other"))
+		require.False(t, authorizeTrace(SignTrace([]byte("wrong"), "app", time.Now().Add(time.Minute)), "app"))
+		require.False(t, authorizeTrace(SignTrace(secret, "app", time.Now().Add(-time.Second)), "app"), "expired")
+		require.False(t, authorizeTrace(SignTrace(secret, "app", time.Now().Add(2*time.Hour)), "app"), "not short-lived")
+		require.False(t, authorizeTrace(strconv.FormatInt(time.Now().Add(time.Minute).Unix(), 10)+".", "app"))
+	})
+}
+
+func TestIsSensitiveVar(t *testing.T) {
+	require.True(t, isSensitiveVar("header", []string{"Authorization"}))
+	require.True(t, isSensitiveVar("cookie", []string{"theme"}))
+	require.True(t, isSensitiveVar("arg", []string{"api_key"}))
+	require.False(t, isSensitiveVar("header", []string{"User-Agent"}))
+	require.False(t, isSensitiveVar("req_path", nil))
+}
+
+func TestBuildHandlerStripsTraceHeader(t *testing.T) {
+	var defaultUpstream Rules
+	require.NoError(t, parseRules(`
+- name: default
+  do: upstream
+`, &defaultUpstream))
+
+	for name, rules := range map[string]Rules{"no rules": nil, "default upstream": defaultUpstream} {
+		t.Run(name, func(t *testing.T) {
+			var header http.Header
+			handler := rules.BuildHandler(func(w http.ResponseWriter, r *http.Request) {
+				header = r.Header.Clone()
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(TraceHeader, "token")
+			handler(httptest.NewRecorder(), req)
+			require.NotNil(t, header)
+			require.Empty(t, header.Get(TraceHeader))
+		})
+	}
+}
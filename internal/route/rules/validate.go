@@ -6,12 +6,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/puzpuzpuz/xsync/v4"
 	"github.com/rs/zerolog"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
+	"github.com/yusing/godoxy/internal/timeofday"
 	gperr "github.com/yusing/goutils/errs"
 	httputils "github.com/yusing/goutils/http"
 )
@@ -88,6 +91,52 @@ func toKVOptionalVMatcher(args []string) (any, gperr.Error) {
 	}
 }
 
+// validateJSONBodyMatcher returns Tuple[*jsonPath, Matcher] from 'path', 'path value' or 'path == value'.
+func validateJSONBodyMatcher(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+	if len(args) == 3 && args[1] == "==" {
+		args = []string{args[0], args[2]}
+	}
+	if len(args) != 1 && len(args) != 2 {
+		return phase, nil, ErrExpectKVOptionalV
+	}
+	path, err := parseJSONPath(args[0])
+	if err != nil {
+		return phase, nil, err
+	}
+	var matcher Matcher
+	if len(args) == 2 {
+		matcher, err = ParseMatcher(args[1])
+		if err != nil {
+			return phase, nil, err
+		}
+	}
+	return phase, &Tuple[*jsonPath, Matcher]{path, matcher}, nil
+}
+
+func validatePreRequestJSONPathTemplate(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+	return validateJSONPathTemplate(PhasePre, args)
+}
+
+func validatePostResponseJSONPathTemplate(args []string) (phase PhaseFlag, parsedArgs any, err error) {
+	return validateJSONPathTemplate(PhasePost|PhaseResponseBody, args)
+}
+
+// validateJSONPathTemplate returns Tuple[*jsonPath, templateString] from 'path value'.
+func validateJSONPathTemplate(phase PhaseFlag, args []string) (PhaseFlag, any, error) {
+	if len(args) != 2 {
+		return phase, nil, ErrExpectTwoArgs
+	}
+	path, pathErr := parseJSONPath(args[0])
+	if pathErr != nil {
+		return phase, nil, pathErr
+	}
+	tmplReq, tmpl, err := validateTemplate(args[1], false)
+	if err != nil {
+		return phase, nil, err
+	}
+	return phase | tmplReq, &Tuple[*jsonPath, templateString]{path, tmpl}, nil
+}
+
 // validateURL returns types.URL with the URL validated.
 func validateURL(args []string) (any, gperr.Error) {
 	if len(args) != 1 {
@@ -225,6 +274,143 @@ func validateMethod(args []string) (any, gperr.Error) {
 	return method, nil
 }
 
+// validateGeoCodes validates and uppercases country or continent codes of the given length.
+func validateGeoCodes(args []string, length int) ([]string, gperr.Error) {
+	if len(args) == 0 {
+		return nil, ErrInvalidArguments.Withf("expect at least 1 code")
+	}
+	codes := make([]string, len(args))
+	for i, arg := range args {
+		if len(arg) != length || strings.IndexFunc(arg, func(r rune) bool {
+			return (r < 'A' || r > 'Z') && (r < 'a' || r > 'z')
+		}) >= 0 {
+			return nil, ErrInvalidArguments.Subject(arg)
+		}
+		codes[i] = strings.ToUpper(arg)
+	}
+	return codes, nil
+}
+
+var continentCodes = []string{"AF", "AN", "AS", "EU", "NA", "OC", "SA"}
+
+func validateContinentCodes(args []string) ([]string, gperr.Error) {
+	codes, err := validateGeoCodes(args, 2)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range codes {
+		if !slices.Contains(continentCodes, code) {
+			return nil, ErrInvalidArguments.Subject(code).Withf("expect one of %s", strings.Join(continentCodes, ", "))
+		}
+	}
+	return codes, nil
+}
+
+func validateCityNames(args []string) ([]string, gperr.Error) {
+	if len(args) == 0 {
+		return nil, ErrInvalidArguments.Withf("expect at least 1 city name")
+	}
+	names := make([]string, len(args))
+	for i, arg := range args {
+		names[i] = strings.TrimSpace(arg)
+		if names[i] == "" {
+			return nil, ErrInvalidArguments.Withf("empty city name")
+		}
+	}
+	return names, nil
+}
+
+func validateASNs(args []string) ([]uint, gperr.Error) {
+	if len(args) == 0 {
+		return nil, ErrInvalidArguments.Withf("expect at least 1 AS number")
+	}
+	numbers := make([]uint, len(args))
+	for i, arg := range args {
+		n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(arg), "AS"), 10, 32)
+		if err != nil || n == 0 {
+			return nil, ErrInvalidArguments.Subject(arg)
+		}
+		numbers[i] = uint(n)
+	}
+	return numbers, nil
+}
+
+// validateScheduleArgs splits the comma separated specs of a schedule matcher and loads its optional time zone.
+func validateScheduleArgs(args []string) (specs []string, loc *time.Location, err gperr.Error) {
+	var tz string
+	switch len(args) {
+	case 1:
+	case 2:
+		tz = args[1]
+	default:
+		return nil, nil, ErrExpectOneOrTwoArgs
+	}
+	loc, err = parseLocation(tz)
+	if err != nil {
+		return nil, nil, err
+	}
+	return strings.Split(args[0], ","), loc, nil
+}
+
+// validateTimeRanges returns *Schedule matching any of the HH:MM-HH:MM time ranges.
+func validateTimeRanges(args []string) (*Schedule, gperr.Error) {
+	specs, loc, err := validateScheduleArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]timeOfDayRange, len(specs))
+	for i, spec := range specs {
+		if ranges[i], err = parseTimeOfDayRange(spec); err != nil {
+			return nil, err
+		}
+	}
+	return &Schedule{loc, func(t time.Time) bool {
+		minutes := t.Hour()*60 + t.Minute()
+		return slices.ContainsFunc(ranges, func(r timeOfDayRange) bool {
+			return r.contains(minutes)
+		})
+	}}, nil
+}
+
+// validateWeekdays returns *Schedule matching any of the weekdays or weekday ranges.
+func validateWeekdays(args []string) (*Schedule, gperr.Error) {
+	specs, loc, err := validateScheduleArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	var mask timeofday.Weekdays
+	for _, spec := range specs {
+		days, err := parseWeekdays(spec)
+		if err != nil {
+			return nil, err
+		}
+		mask |= days
+	}
+	return &Schedule{loc, func(t time.Time) bool {
+		return mask.Has(t.Weekday())
+	}}, nil
+}
+
+// validateDateRanges returns *Schedule matching any of the YYYY-MM-DD dates or YYYY-MM-DD..YYYY-MM-DD ranges.
+func validateDateRanges(args []string) (*Schedule, gperr.Error) {
+	specs, loc, err := validateScheduleArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]dateRange, len(specs))
+	for i, spec := range specs {
+		if ranges[i], err = parseDateRange(spec); err != nil {
+			return nil, err
+		}
+	}
+	return &Schedule{loc, func(t time.Time) bool {
+		date := dateOf(t)
+		return slices.ContainsFunc(ranges, func(r dateRange) bool {
+			return date >= r.start && date <= r.end
+		})
+	}}, nil
+}
+
 func validateStatusCode(status string) (int, error) {
 	statusCode, err := strconv.Atoi(status)
 	if err != nil {
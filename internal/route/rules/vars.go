@@ -151,6 +151,7 @@ func ExpandVars(w *httputils.ResponseModifier, req *http.Request, src string, ds
 			isStatic := true
 
 			var actual string
+			var varArgs []string
 			if getter, ok := dynamicVarSubsMap[name]; ok {
 				// Function-like variables
 				isStatic = false
@@ -166,6 +167,7 @@ func ExpandVars(w *httputils.ResponseModifier, req *http.Request, src string, ds
 					return phase, err
 				}
 				phase |= argPhase
+				varArgs = args
 				actual, err = getter.get(args, w, req)
 				if err != nil {
 					return phase, err
@@ -178,6 +180,9 @@ func ExpandVars(w *httputils.ResponseModifier, req *http.Request, src string, ds
 			} else {
 				return phase, ErrUnexpectedVar.Subject(name)
 			}
+			if trace := traceFromRequest(req); trace != nil {
+				trace.expandVar(name, varArgs, actual)
+			}
 			if _, err := dst.WriteString(actual); err != nil {
 				return phase, err
 			}
@@ -4,8 +4,13 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/yusing/godoxy/internal/route/routes"
+	rulemaps "github.com/yusing/godoxy/internal/route/rules/maps"
 	httputils "github.com/yusing/goutils/http"
+	"github.com/yusing/goutils/mockable"
 	strutils "github.com/yusing/goutils/strings"
 )
 
@@ -17,6 +22,12 @@ const (
 	VarForm           = "form"
 	VarPostForm       = "postform"
 	VarRedacted       = "redacted"
+	VarNow            = "now"
+	VarVar            = "var"
+	VarMap            = "map"
+	VarSubStatus      = "sub_status"
+	VarSubHeader      = "sub_header"
+	VarSubJSON        = "sub_json"
 )
 
 type dynamicVarGetter struct {
@@ -198,6 +209,184 @@ var dynamicVarSubsMap = map[string]dynamicVarGetter{
 			return strutils.Redact(args[0]), nil
 		},
 	},
+	VarNow: {
+		help: Help{
+			command: "$" + VarNow,
+			description: makeLines(
+				"Current time in the server time zone, or in the given time zone.",
+				"Format is a Go time layout or one of rfc3339, rfc1123, http, unix, unix_ms; quote layouts with spaces or commas.",
+				"$"+VarNow+"(rfc3339)",
+				"$"+VarNow+`("2006-01-02 15:04", Europe/London)`,
+			),
+			args: helpArgs(
+				helpArg{"format", "Go time layout, e.g. 2006-01-02, or a named format."},
+				helpArg{"[timezone]", "Optional IANA time zone, e.g. Europe/London."},
+			),
+		},
+		phase: PhaseNone,
+		get: func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error) {
+			var tz string
+			switch len(args) {
+			case 1:
+			case 2:
+				tz = args[1]
+			default:
+				return "", ErrExpectOneOrTwoArgs
+			}
+			loc, err := parseLocation(tz)
+			if err != nil {
+				return "", err
+			}
+			return formatTime(mockable.TimeNow().In(loc), args[0]), nil
+		},
+	},
+	VarVar: {
+		help: Help{
+			command: "$" + VarVar,
+			description: makeLines(
+				"Request variable set by setvar earlier in the request.",
+				"Renders the default, or empty, when the variable is not set.",
+				"$"+VarVar+"(tenant)",
+				"$"+VarVar+"(tenant, unknown)",
+			),
+			args: helpArgs(
+				helpArg{"name", "Variable name."},
+				helpArg{"[default]", "Optional value when the variable is not set."},
+			),
+		},
+		phase: PhaseNone,
+		get: func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error) {
+			name, defaultValue, err := getKeyAndDefault(args)
+			if err != nil {
+				return "", err
+			}
+			if value, ok := routes.RequestVar(req, name); ok {
+				return value, nil
+			}
+			return defaultValue, nil
+		},
+	},
+	VarMap: {
+		help: Help{
+			command: "$" + VarMap,
+			description: makeLines(
+				"Lookup map value, maps are defined in rule_maps of the config file.",
+				"Keys match exactly, or by the longest glob pattern; otherwise renders the default, or the map default.",
+				"$"+VarMap+"(tenants, $req_host)",
+				"$"+VarMap+"(tenants, $header(X-Tenant), unknown)",
+			),
+			args: helpArgs(
+				helpArg{"name", "Map name under rule_maps."},
+				helpArg{"key", "Key to look up, usually another variable."},
+				helpArg{"[default]", "Optional value when no key matches, overrides the map default."},
+			),
+		},
+		phase: PhaseNone,
+		get: func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error) {
+			if len(args) != 2 && len(args) != 3 {
+				return "", ErrExpectTwoOrThreeArgs
+			}
+			m, ok := rulemaps.FromCtx(req.Context())[args[0]]
+			if !ok {
+				// maps are loaded after rules are validated, an unknown map renders as not found
+				if len(args) == 3 {
+					return args[2], nil
+				}
+				return "", nil
+			}
+			value, ok := m.Lookup(args[1])
+			if !ok && len(args) == 3 {
+				return args[2], nil
+			}
+			return value, nil
+		},
+	},
+	VarSubStatus: {
+		help: Help{
+			command: "$" + VarSubStatus,
+			description: makeLines(
+				"Status code of a sub-request made earlier by the subrequest command.",
+				"Renders 0 when it failed, empty when it was not made.",
+				"$"+VarSubStatus+"(entitlement)",
+			),
+			args: helpArgs(
+				helpArg{"name", "the sub-request name"},
+			),
+		},
+		phase: PhaseNone,
+		get: func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error) {
+			if len(args) != 1 {
+				return "", ErrExpectOneArg
+			}
+			return subrequestResultOf(req, args[0]).statusString(), nil
+		},
+	},
+	VarSubHeader: {
+		help: Help{
+			command: "$" + VarSubHeader,
+			description: makeLines(
+				"Response header value of a sub-request made earlier by the subrequest command.",
+				"$"+VarSubHeader+"(entitlement, X-User-Plan)",
+				"$"+VarSubHeader+"(entitlement, Set-Cookie, 1)",
+			),
+			args: helpArgs(
+				helpArg{"name", "the sub-request name"},
+				helpArg{"header", "the response header name"},
+				helpArg{"[index]", "Optional zero-based value index; defaults to 0."},
+			),
+		},
+		phase: PhaseNone,
+		get: func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error) {
+			if len(args) != 2 && len(args) != 3 {
+				return "", ErrExpectTwoOrThreeArgs
+			}
+			key, index, err := getKeyAndIndex(args[1:])
+			if err != nil {
+				return "", err
+			}
+			result := subrequestResultOf(req, args[0])
+			if result == nil {
+				return "", nil
+			}
+			if values := result.header.Values(key); index >= 0 && index < len(values) {
+				return values[index], nil
+			}
+			return "", nil
+		},
+	},
+	VarSubJSON: {
+		help: Help{
+			command: "$" + VarSubJSON,
+			description: makeLines(
+				"Value in the JSON body (up to 1MB) of a sub-request made earlier by the subrequest command.",
+				"Strings render unquoted, objects and arrays as compact JSON, the first value is used with [*].",
+				"$"+VarSubJSON+"(entitlement, .plan)",
+				"$"+VarSubJSON+"(profile, .roles[0])",
+			),
+			args: helpArgs(
+				helpArg{"name", "the sub-request name"},
+				helpArg{"path", "the JSON path, e.g. .plan or .roles[0]"},
+			),
+		},
+		phase: PhaseNone,
+		get: func(args []string, w *httputils.ResponseModifier, req *http.Request) (string, error) {
+			if len(args) != 2 {
+				return "", ErrExpectTwoArgs
+			}
+			path, err := parseJSONPath(args[1])
+			if err != nil {
+				return "", err
+			}
+			result := subrequestResultOf(req, args[0])
+			if result == nil {
+				return "", nil
+			}
+			if values := path.Values(result.json); len(values) > 0 {
+				return jsonValueString(values[0]), nil
+			}
+			return "", nil
+		},
+	},
 }
 
 func getValueByKeyAtIndex[Values http.Header | url.Values](values Values, key string, index int) (string, error) {
@@ -209,6 +398,48 @@ func getValueByKeyAtIndex[Values http.Header | url.Values](values Values, key st
 	return "", nil
 }
 
+// formatTime formats t with a named format or a Go time layout.
+func formatTime(t time.Time, format string) string {
+	switch strings.ToLower(format) {
+	case "rfc3339":
+		return t.Format(time.RFC3339)
+	case "rfc1123":
+		return t.Format(time.RFC1123Z)
+	case "http":
+		return t.UTC().Format(http.TimeFormat)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	case "unix_ms":
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	default:
+		return t.Format(format)
+	}
+}
+
+func getKeyAndDefault(args []string) (key string, defaultValue string, err error) {
+	switch len(args) {
+	case 1:
+		return args[0], "", nil
+	case 2:
+		return args[0], args[1], nil
+	default:
+		return "", "", ErrExpectOneOrTwoArgs
+	}
+}
+
+// validRequestVarName reports whether name is a valid setvar variable name.
+func validRequestVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		if !validVarNameCharset[c] && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
 func getKeyAndIndex(args []string) (key string, index int, err error) {
 	switch len(args) {
 	case 0:
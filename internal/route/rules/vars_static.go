@@ -1,11 +1,14 @@
 package rules
 
 import (
+	"crypto/x509"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"github.com/yusing/godoxy/internal/maxmind"
+	"github.com/yusing/godoxy/internal/net/clientcert"
 	"github.com/yusing/godoxy/internal/route/routes"
 	httputils "github.com/yusing/goutils/http"
 )
@@ -26,6 +29,19 @@ const (
 	VarRemotePort         = "remote_port"
 	VarRemoteAddr         = "remote_addr"
 
+	VarTLSClientSubject     = "tls_client_subject"
+	VarTLSClientIssuer      = "tls_client_issuer"
+	VarTLSClientSAN         = "tls_client_san"
+	VarTLSClientFingerprint = "tls_client_fingerprint"
+	VarTLSClientSerial      = "tls_client_serial"
+	VarTLSClientCert        = "tls_client_cert"
+
+	VarGeoCountry   = "geo_country"
+	VarGeoContinent = "geo_continent"
+	VarGeoCity      = "geo_city"
+	VarGeoASN       = "geo_asn"
+	VarGeoTimeZone  = "geo_tz"
+
 	VarUpstreamName   = "upstream_name"
 	VarUpstreamScheme = "upstream_scheme"
 	VarUpstreamHost   = "upstream_host"
@@ -219,6 +235,127 @@ var staticReqVarSubsMap = map[string]reqVar{
 		},
 		get: func(req *http.Request) string { return req.RemoteAddr },
 	},
+	VarTLSClientSubject: {
+		help: Help{
+			command: "$" + VarTLSClientSubject,
+			description: makeLines(
+				"Subject of the verified client certificate.",
+				"Distinguished name such as CN=device-1,OU=fleet,O=Example. Empty without inbound mTLS.",
+				"$"+VarTLSClientSubject,
+			),
+		},
+		get: clientCertVar(clientcert.Subject),
+	},
+	VarTLSClientIssuer: {
+		help: Help{
+			command: "$" + VarTLSClientIssuer,
+			description: makeLines(
+				"Issuer of the verified client certificate.",
+				"Distinguished name of the CA that issued it. Empty without inbound mTLS.",
+				"$"+VarTLSClientIssuer,
+			),
+		},
+		get: clientCertVar(clientcert.Issuer),
+	},
+	VarTLSClientSAN: {
+		help: Help{
+			command: "$" + VarTLSClientSAN,
+			description: makeLines(
+				"Subject alternative names of the verified client certificate.",
+				"DNS names, emails, IPs and URIs joined with commas. Empty without inbound mTLS.",
+				"$"+VarTLSClientSAN,
+			),
+		},
+		get: clientCertVar(func(cert *x509.Certificate) string { return strings.Join(clientcert.SANs(cert), ",") }),
+	},
+	VarTLSClientFingerprint: {
+		help: Help{
+			command: "$" + VarTLSClientFingerprint,
+			description: makeLines(
+				"SHA-256 fingerprint of the verified client certificate.",
+				"Lowercase hex without separators. Empty without inbound mTLS.",
+				"$"+VarTLSClientFingerprint,
+			),
+		},
+		get: clientCertVar(clientcert.Fingerprint),
+	},
+	VarTLSClientSerial: {
+		help: Help{
+			command: "$" + VarTLSClientSerial,
+			description: makeLines(
+				"Serial number of the verified client certificate.",
+				"Lowercase hex. Empty without inbound mTLS.",
+				"$"+VarTLSClientSerial,
+			),
+		},
+		get: clientCertVar(clientcert.Serial),
+	},
+	VarTLSClientCert: {
+		help: Help{
+			command: "$" + VarTLSClientCert,
+			description: makeLines(
+				"Verified client certificate as URL-encoded PEM.",
+				"Same format as nginx $ssl_client_escaped_cert. Empty without inbound mTLS.",
+				"$"+VarTLSClientCert,
+			),
+		},
+		get: clientCertVar(clientcert.EscapedPEM),
+	},
+	VarGeoCountry: {
+		help: Help{
+			command: "$" + VarGeoCountry,
+			description: makeLines(
+				"ISO country code of the remote client, e.g. GB.",
+				"Looked up in the MaxMind database once per request. Empty when unknown.",
+				"$"+VarGeoCountry,
+			),
+		},
+		get: maxmind.RequestCountry,
+	},
+	VarGeoContinent: {
+		help: Help{
+			command: "$" + VarGeoContinent,
+			description: makeLines(
+				"Continent code of the remote client, e.g. EU.",
+				"Looked up in the MaxMind database once per request. Empty when unknown.",
+				"$"+VarGeoContinent,
+			),
+		},
+		get: maxmind.RequestContinent,
+	},
+	VarGeoCity: {
+		help: Help{
+			command: "$" + VarGeoCity,
+			description: makeLines(
+				"English city name of the remote client.",
+				"Requires the MaxMind City database (maxmind.city: true). Empty when unknown.",
+				"$"+VarGeoCity,
+			),
+		},
+		get: maxmind.RequestCityName,
+	},
+	VarGeoASN: {
+		help: Help{
+			command: "$" + VarGeoASN,
+			description: makeLines(
+				"Autonomous system number of the remote client, e.g. 13335.",
+				"Requires the MaxMind ASN database (maxmind.asn: true). Empty when unknown.",
+				"$"+VarGeoASN,
+			),
+		},
+		get: maxmind.RequestASNumber,
+	},
+	VarGeoTimeZone: {
+		help: Help{
+			command: "$" + VarGeoTimeZone,
+			description: makeLines(
+				"Time zone of the remote client, e.g. Europe/London.",
+				"Looked up in the MaxMind database once per request. Empty when unknown.",
+				"$"+VarGeoTimeZone,
+			),
+		},
+		get: maxmind.RequestTimeZone,
+	},
 	VarUpstreamName: {
 		help: Help{
 			command: "$" + VarUpstreamName,
@@ -323,6 +460,17 @@ var staticRespVarSubsMap = map[string]respVar{
 	},
 }
 
+// clientCertVar returns a getter of the verified client certificate, empty without one.
+func clientCertVar(get func(cert *x509.Certificate) string) reqVarGetter {
+	return func(req *http.Request) string {
+		cert := clientcert.FromRequest(req)
+		if cert == nil {
+			return ""
+		}
+		return get(cert)
+	}
+}
+
 func stripFragment(s string) string {
 	before, _, ok := strings.Cut(s, "#")
 	if !ok {
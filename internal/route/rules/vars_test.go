@@ -2,15 +2,25 @@ package rules
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	maxmind "github.com/yusing/godoxy/internal/maxmind/types"
+	"github.com/yusing/godoxy/internal/route/routes"
 	httputils "github.com/yusing/goutils/http"
+	"github.com/yusing/goutils/mockable"
 )
 
 func TestExtractArgs(t *testing.T) {
@@ -684,6 +694,103 @@ func TestExpandVars_UpstreamVariables(t *testing.T) {
 	}
 }
 
+func TestExpandVars_TLSClientVariables(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(0x1f),
+		Subject:      pkix.Name{CommonName: "device-1", OrganizationalUnit: []string{"fleet"}},
+		DNSNames:     []string{"device-1.fleet.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	testResponseModifier := httputils.NewResponseModifier(httptest.NewRecorder())
+	expand := func(req *http.Request, src string) string {
+		var out strings.Builder
+		_, err := ExpandVars(testResponseModifier, req, src, &out)
+		require.NoError(t, err)
+		return out.String()
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	require.Empty(t, expand(req, "$tls_client_subject$tls_client_san$tls_client_serial"), "no client certificate")
+
+	req.TLS.PeerCertificates = []*x509.Certificate{cert}
+	require.Empty(t, expand(req, "$tls_client_subject"), "not verified")
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	require.Equal(t, "CN=device-1,OU=fleet", expand(req, "$tls_client_subject"))
+	require.Equal(t, "CN=device-1,OU=fleet", expand(req, "$tls_client_issuer"))
+	require.Equal(t, "device-1.fleet.example.com", expand(req, "$tls_client_san"))
+	require.Equal(t, "1f", expand(req, "$tls_client_serial"))
+	require.Len(t, expand(req, "$tls_client_fingerprint"), 64)
+	require.True(t, strings.HasPrefix(expand(req, "$tls_client_cert"), "-----BEGIN%20CERTIFICATE-----%0A"))
+}
+
+func TestExpandVars_GeoVariables(t *testing.T) {
+	testResponseModifier := httputils.NewResponseModifier(httptest.NewRecorder())
+	expand := func(req *http.Request, src string) string {
+		var out strings.Builder
+		_, err := ExpandVars(testResponseModifier, req, src, &out)
+		require.NoError(t, err)
+		return out.String()
+	}
+
+	req := routes.WithRouteContext(httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	req.RemoteAddr = "81.2.69.142:4321"
+	info := routes.ClientIPInfo(req)
+	info.City = &maxmind.City{}
+	info.City.Country.IsoCode = "GB"
+	info.City.Continent.Code = "EU"
+	info.City.City.Names = map[string]string{"en": "London"}
+	info.City.Location.TimeZone = "Europe/London"
+	info.ASN = &maxmind.ASN{Number: 13335}
+
+	require.Equal(t, "GB EU London 13335 Europe/London", expand(req, "$geo_country $geo_continent $geo_city $geo_asn $geo_tz"))
+
+	// cached per client IP, a rewritten RemoteAddr is looked up again
+	req.RemoteAddr = "not an ip"
+	require.Empty(t, expand(req, "$geo_country$geo_asn"))
+}
+
+func TestExpandVars_Now(t *testing.T) {
+	now := time.Date(2026, 12, 24, 22, 30, 5, 0, time.UTC)
+	mockable.MockTimeNow(now)
+	testResponseModifier := httputils.NewResponseModifier(httptest.NewRecorder())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"$now(rfc3339, UTC)", "2026-12-24T22:30:05Z"},
+		{"$now(http, Asia/Tokyo)", "Thu, 24 Dec 2026 22:30:05 GMT"},
+		{"$now(unix)", "1798151405"},
+		{`$now("2006-01-02 15:04", Asia/Tokyo)`, "2026-12-25 07:30"},
+		{"$now(Monday, Asia/Tokyo)", "Friday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			var out strings.Builder
+			_, err := ExpandVars(testResponseModifier, req, tt.src, &out)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, out.String())
+		})
+	}
+
+	for _, src := range []string{"$now()", "$now(rfc3339, Mars/Olympus)", "$now(rfc3339, UTC, extra)"} {
+		t.Run("invalid "+src, func(t *testing.T) {
+			_, err := ValidateVars(src)
+			require.ErrorIs(t, err, ErrInvalidArguments)
+		})
+	}
+}
+
 func TestExpandVars_NoHostPort(t *testing.T) {
 	// Test request without port in Host header
 	testRequest := httptest.NewRequest(http.MethodGet, "/", nil)
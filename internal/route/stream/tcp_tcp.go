@@ -30,7 +30,8 @@ type TCPTCPStream struct {
 	preDial nettypes.HookFunc
 	onRead  nettypes.HookFunc
 
-	closed atomic.Bool
+	sessions atomic.Int64
+	closed   atomic.Bool
 }
 
 func NewTCPTCPStream(network, dstNetwork, listenAddr, dstAddr string, agent *agentpool.Agent, relayProxyProtocolHeader bool) (nettypes.Stream, error) {
@@ -99,6 +100,11 @@ func (s *TCPTCPStream) LocalAddr() net.Addr {
 	return s.listener.Addr()
 }
 
+// ActiveSessions implements nettypes.SessionCounter.
+func (s *TCPTCPStream) ActiveSessions() int {
+	return int(s.sessions.Load())
+}
+
 func (s *TCPTCPStream) MarshalZerologObject(e *zerolog.Event) {
 	e.Str("protocol", s.network+"->"+s.dstNetwork)
 
@@ -143,6 +149,9 @@ func (s *TCPTCPStream) listen(ctx context.Context) {
 func (s *TCPTCPStream) ProxyConn(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
 
+	s.sessions.Inc()
+	defer s.sessions.Dec()
+
 	if s.preDial != nil {
 		if err := s.preDial(ctx); err != nil {
 			if !s.closed.Load() {
@@ -45,6 +45,9 @@ type udpUDPConn struct {
 	lastUsed atomic.Time
 	closed   atomic.Bool
 	mu       sync.Mutex
+
+	// datagrams received before dstConn is dialed
+	pending [][]byte
 }
 
 const (
@@ -52,6 +55,9 @@ const (
 	udpIdleTimeout     = 5 * time.Minute // Longer timeout for game sessions
 	udpCleanupInterval = 1 * time.Minute
 	udpReadTimeout     = 30 * time.Second
+
+	// udpMaxPendingDatagrams bounds datagrams buffered per client while dialing.
+	udpMaxPendingDatagrams = 64
 )
 
 var bufPool = synk.GetSizedBytesPool()
@@ -121,6 +127,13 @@ func (s *UDPUDPStream) LocalAddr() net.Addr {
 	return s.listener.LocalAddr()
 }
 
+// ActiveSessions implements nettypes.SessionCounter.
+func (s *UDPUDPStream) ActiveSessions() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.conns)
+}
+
 func (s *UDPUDPStream) MarshalZerologObject(e *zerolog.Event) {
 	e.Str("protocol", s.network+"->"+s.dstNetwork)
 	if s.dst != nil {
@@ -176,27 +189,41 @@ func (s *UDPUDPStream) getOrCreateConnection(ctx context.Context, srcAddr *net.U
 			delete(s.conns, key)
 		} else {
 			s.mu.Unlock()
-			// Forward packet for existing connection
+			// Forward packet for existing connection, or buffer it while the connection is dialing
 			go conn.forwardToDestination(initialData)
 			return
 		}
 	}
 
-	defer s.mu.Unlock()
-	// Create new connection with initial data
-	conn, ok := s.createConnection(ctx, srcAddr, initialData)
-	if ok && !conn.closed.Load() {
-		s.conns[key] = conn
-		go s.runConnUntilClosed(ctx, key, conn)
+	// Register the connection before dialing so datagrams arriving while
+	// pre-dial holds it (e.g. idlewatcher wake) are buffered and replayed in order.
+	conn := &udpUDPConn{
+		srcAddr:  srcAddr,
+		listener: s.listener,
+		pending:  [][]byte{initialData},
 	}
+	conn.lastUsed.Store(time.Now())
+	s.conns[key] = conn
+	s.mu.Unlock()
+
+	if !s.dialConnection(ctx, conn) {
+		conn.Close()
+		s.mu.Lock()
+		if s.conns[key] == conn {
+			delete(s.conns, key)
+		}
+		s.mu.Unlock()
+		return
+	}
+	go s.runConnUntilClosed(ctx, key, conn)
 }
 
-func (s *UDPUDPStream) createConnection(ctx context.Context, srcAddr *net.UDPAddr, initialData []byte) (*udpUDPConn, bool) {
+func (s *UDPUDPStream) dialConnection(ctx context.Context, conn *udpUDPConn) bool {
 	// Apply pre-dial if configured
 	if s.preDial != nil {
 		if err := s.preDial(ctx); err != nil {
 			logErr(s, err, "failed to pre-dial")
-			return nil, false
+			return false
 		}
 	}
 
@@ -212,24 +239,17 @@ func (s *UDPUDPStream) createConnection(ctx context.Context, srcAddr *net.UDPAdd
 	}
 	if err != nil {
 		logErr(s, err, "failed to dial dst")
-		return nil, false
+		return false
 	}
 
-	conn := &udpUDPConn{
-		srcAddr:  srcAddr,
-		dstConn:  dstConn,
-		listener: s.listener,
-	}
-	conn.lastUsed.Store(time.Now())
-
-	// Send initial data before starting response handler
-	if !conn.forwardToDestination(initialData) {
+	// Replay buffered datagrams before starting response handler
+	if !conn.setDestination(dstConn) {
 		_ = dstConn.Close()
-		return nil, false
+		return false
 	}
 
-	logDebugf(s, "created new connection from %s", srcAddr.String())
-	return conn, true
+	logDebugf(s, "created new connection from %s", conn.srcAddr.String())
+	return true
 }
 
 func (s *UDPUDPStream) runConnUntilClosed(ctx context.Context, key string, conn *udpUDPConn) {
@@ -243,7 +263,10 @@ func (s *UDPUDPStream) runConnUntilClosed(ctx context.Context, key string, conn
 }
 
 func (conn *udpUDPConn) MarshalZerologObject(e *zerolog.Event) {
-	e.Stringer("src", conn.srcAddr).Stringer("dst", conn.dstConn.RemoteAddr())
+	e.Stringer("src", conn.srcAddr)
+	if dstConn := conn.dstConn; dstConn != nil {
+		e.Stringer("dst", dstConn.RemoteAddr())
+	}
 }
 
 func (conn *udpUDPConn) handleResponses(ctx context.Context) {
@@ -329,6 +352,39 @@ func (conn *udpUDPConn) forwardToDestination(data []byte) bool {
 		return false
 	}
 
+	if conn.dstConn == nil {
+		if len(conn.pending) >= udpMaxPendingDatagrams {
+			logDebugf(conn, "dropped %d bytes, too many datagrams pending", len(data))
+			return false
+		}
+		conn.pending = append(conn.pending, data)
+		return true
+	}
+
+	return conn.writeLocked(data)
+}
+
+// setDestination attaches the dialed destination and replays pending datagrams in order.
+func (conn *udpUDPConn) setDestination(dstConn net.Conn) bool {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.closed.Load() {
+		return false
+	}
+
+	conn.dstConn = dstConn
+	pending := conn.pending
+	conn.pending = nil
+	for _, data := range pending {
+		if !conn.writeLocked(data) {
+			return false
+		}
+	}
+	return true
+}
+
+func (conn *udpUDPConn) writeLocked(data []byte) bool {
 	_, err := conn.dstConn.Write(data)
 	if err != nil {
 		logErrf(conn, err, "failed to write %d bytes to dst", len(data))
@@ -353,7 +409,9 @@ func (conn *udpUDPConn) Close() {
 	}
 
 	conn.closed.Store(true)
+	conn.pending = nil
 
-	_ = conn.dstConn.Close()
-	conn.dstConn = nil
+	if conn.dstConn != nil {
+		_ = conn.dstConn.Close()
+	}
 }
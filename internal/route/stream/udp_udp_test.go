@@ -34,3 +34,42 @@ func TestUDPUDPStreamRemovesConnectionWhenResponseHandlerExits(t *testing.T) {
 	require.False(t, ok)
 	require.True(t, conn.closed.Load())
 }
+
+func TestUDPUDPConnBuffersDatagramsUntilDialed(t *testing.T) {
+	conn := &udpUDPConn{
+		srcAddr: &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 12345},
+		pending: [][]byte{[]byte("0")},
+	}
+	for i := 1; i < udpMaxPendingDatagrams; i++ {
+		require.True(t, conn.forwardToDestination([]byte{byte('0' + i%10)}))
+	}
+	require.False(t, conn.forwardToDestination([]byte("dropped")))
+
+	dst := &recordingConn{}
+	require.True(t, conn.setDestination(dst))
+	require.True(t, conn.forwardToDestination([]byte("after")))
+
+	require.Len(t, dst.writes, udpMaxPendingDatagrams+1)
+	for i := range udpMaxPendingDatagrams {
+		require.Equal(t, []byte{byte('0' + i%10)}, dst.writes[i])
+	}
+	require.Equal(t, []byte("after"), dst.writes[udpMaxPendingDatagrams])
+	require.Nil(t, conn.pending)
+}
+
+func TestUDPUDPConnCloseWhileDialing(t *testing.T) {
+	conn := &udpUDPConn{pending: [][]byte{[]byte("data")}}
+	conn.Close()
+	require.False(t, conn.forwardToDestination([]byte("data")))
+	require.False(t, conn.setDestination(&recordingConn{}))
+}
+
+type recordingConn struct {
+	net.Conn
+	writes [][]byte
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.writes = append(c.writes, b)
+	return len(b), nil
+}
@@ -137,6 +137,9 @@ func NewFileServer(base *route.Route) (*FileServer, error) {
 func (s *FileServer) Start(parent task.Parent) error {
 	s.Init(parent, "fileserver."+s.Name(), false)
 	s.Task().SetValue(health.DisplayNameKey{}, s.DisplayName())
+	if s.middleware != nil {
+		s.Task().OnCancel("release_middlewares", s.middleware.Release)
+	}
 
 	if err := s.prepareHandler(); err != nil {
 		s.Task().Finish(err)
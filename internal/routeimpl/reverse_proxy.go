@@ -30,6 +30,8 @@ type ReverseProxyRoute struct {
 	loadBalancer *loadbalancer.LoadBalancer
 	handler      http.Handler
 	rp           *reverseproxy.ReverseProxy
+	middleware   *middleware.Middleware
+	connStats    *gphttp.ConnStats
 }
 
 var _ routing.ReverseProxyRoute = (*ReverseProxyRoute)(nil)
@@ -56,14 +58,8 @@ func NewReverseProxyRoute(base *route.Route) (*ReverseProxyRoute, error) {
 		}
 
 		trans = gphttp.NewTransportWithTLSConfig(tlsConfig)
-		if httpConfig.ResponseHeaderTimeout > 0 {
-			trans.ResponseHeaderTimeout = httpConfig.ResponseHeaderTimeout
-		}
-		if httpConfig.MaxConnsPerHost > 0 {
-			trans.MaxConnsPerHost = httpConfig.MaxConnsPerHost
-		}
-		if httpConfig.DisableCompression {
-			trans.DisableCompression = true
+		if err := httpConfig.ConfigureTransport(trans, base.ProxyURL.Scheme); err != nil {
+			return nil, err
 		}
 	}
 
@@ -86,13 +82,22 @@ func NewReverseProxyRoute(base *route.Route) (*ReverseProxyRoute, error) {
 		}
 	}
 
+	var mid *middleware.Middleware
 	if len(base.Middlewares) > 0 {
-		err := middleware.PatchReverseProxy(rp, base.Middlewares)
+		var err error
+		mid, err = middleware.PatchReverseProxy(rp, base.Middlewares)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	// for agent routes, these are the connections to the agent
+	connStats := new(gphttp.ConnStats)
+	handlerFunc := rp.HandlerFunc
+	rp.HandlerFunc = func(w http.ResponseWriter, r *http.Request) {
+		handlerFunc(w, r.WithContext(connStats.WithClientTrace(r.Context())))
+	}
+
 	if a != nil {
 		cfg := agentproxy.Config{
 			Scheme:     base.ProxyURL.Scheme,
@@ -112,8 +117,10 @@ func NewReverseProxyRoute(base *route.Route) (*ReverseProxyRoute, error) {
 	}
 
 	r := &ReverseProxyRoute{
-		Route: base,
-		rp:    rp,
+		Route:      base,
+		rp:         rp,
+		middleware: mid,
+		connStats:  connStats,
 	}
 	return r, nil
 }
@@ -149,6 +156,9 @@ func (r *ReverseProxyRoute) ShouldExclude() bool {
 func (r *ReverseProxyRoute) Start(parent task.Parent) error {
 	r.Init(parent, "http."+r.Name(), false)
 	r.Task().SetValue(health.DisplayNameKey{}, r.DisplayName())
+	if r.middleware != nil {
+		r.Task().OnCancel("release_middlewares", r.middleware.Release)
+	}
 
 	switch {
 	case r.UseIdleWatcher():
@@ -171,6 +181,7 @@ func (r *ReverseProxyRoute) Start(parent task.Parent) error {
 		if transport, ok := r.rp.Transport.(closeIdleConnectionsRoundTripper); ok {
 			r.Task().OnCancel("close_idle_connections", transport.CloseIdleConnections)
 		}
+		r.Task().OnCancel("unregister_conn_stats", gphttp.RegisterConnStats(r.Name(), r.connStats))
 	}
 
 	if r.UseAccessLog() {
@@ -182,9 +193,8 @@ func (r *ReverseProxyRoute) Start(parent task.Parent) error {
 		}
 	}
 
-	if len(r.Rules) > 0 {
-		r.handler = r.Rules.BuildHandler(r.handler.ServeHTTP)
-	}
+	// without rules, this only keeps the rules trace header from the upstream
+	r.handler = r.Rules.BuildHandler(r.handler.ServeHTTP)
 
 	if r.HealthMon != nil {
 		if err := r.HealthMon.Start(r.Task()); err != nil {
@@ -71,6 +71,10 @@ func ResolveProxmox(ctx context.Context, r *route.Route) proxmox.DiscoveryKind {
 	if r.Proxmox == nil || r.Idlewatcher == nil {
 		return discovery
 	}
+	if r.Idlewatcher.HasExplicitProvider() {
+		// explicitly managed by another idlewatcher provider
+		return discovery
+	}
 	r.Idlewatcher.Proxmox = &idlewatcher.ProxmoxConfig{
 		Node: r.Proxmox.Node,
 	}
@@ -7,15 +7,26 @@ import (
 	"os"
 	"reflect"
 
+	"github.com/goccy/go-yaml"
 	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/route/rules"
 	rulepresets "github.com/yusing/godoxy/internal/route/rules/presets"
 	"github.com/yusing/godoxy/internal/serialization"
+	gperr "github.com/yusing/goutils/errs"
 	strutils "github.com/yusing/goutils/strings"
 )
 
+// ruleFile is a rule file with tests, rule files may also contain only the rules.
+type ruleFile struct {
+	Rules rules.Rules `json:"rules" validate:"required"`
+	Tests rules.Tests `json:"tests"`
+}
+
 func validateRules(r *route.Route) error {
 	if r.RuleFile != "" && len(r.Rules) > 0 {
 		return errors.New("`rule_file` and `rules` cannot be used together")
+	} else if r.RuleFile != "" && r.RulePreset != "" {
+		return errors.New("`rule_file` and `rule_preset` cannot be used together")
 	} else if r.RuleFile != "" {
 		src, err := url.Parse(r.RuleFile)
 		if err != nil {
@@ -23,11 +34,12 @@ func validateRules(r *route.Route) error {
 		}
 		switch src.Scheme {
 		case "embed": // embed://<preset_file_name>
-			rules, ok := rulepresets.GetRulePreset(src.Host)
+			preset, ok := rulepresets.GetRulePreset(src.Host)
 			if !ok {
 				return fmt.Errorf("rule preset %q not found", src.Host)
 			}
-			r.Rules = rules
+			r.Rules = preset
+			r.RulePresets = []string{src.Host}
 		case "file", "":
 			if !strutils.IsValidFilename(src.Path) {
 				return fmt.Errorf("invalid rule file path %q", src.Path)
@@ -38,6 +50,17 @@ func validateRules(r *route.Route) error {
 				return fmt.Errorf("failed to read rule file %q: %w", src.Path, err)
 			}
 
+			var file map[string]any
+			if yaml.Unmarshal(content, &file) == nil && file["rules"] != nil {
+				var rf ruleFile
+				if err := serialization.MapUnmarshalValidate(file, &rf); err != nil {
+					return fmt.Errorf("failed to unmarshal rule file %q: %w", src.Path, err)
+				}
+				r.Rules = rf.Rules
+				r.RuleTests = append(rf.Tests, r.RuleTests...)
+				break
+			}
+
 			_, err = serialization.ConvertString(string(content), reflect.ValueOf(&r.Rules))
 			if err != nil {
 				return fmt.Errorf("failed to unmarshal rule file %q: %w", src.Path, err)
@@ -46,5 +69,24 @@ func validateRules(r *route.Route) error {
 			return fmt.Errorf("unsupported rule file scheme %q", src.Scheme)
 		}
 	}
+	if r.RulePreset != "" {
+		preset, used, err := rulepresets.Resolve(r.RulePreset)
+		if err != nil {
+			return gperr.PrependSubject(err, "rule_preset")
+		}
+		r.Rules = append(preset, r.Rules...)
+		r.RulePresets = used
+		if err := r.Rules.Validate(); err != nil {
+			return gperr.PrependSubject(err, "rule_preset")
+		}
+	}
+	if len(r.RuleTests) > 0 {
+		if len(r.Rules) == 0 {
+			return errors.New("`rule_tests` requires `rules`, `rule_file` or `rule_preset`")
+		}
+		if _, err := r.Rules.RunTests(r.RuleTests); err != nil {
+			return gperr.PrependSubject(err, "rule_tests")
+		}
+	}
 	return nil
 }
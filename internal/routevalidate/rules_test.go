@@ -0,0 +1,85 @@
+package routevalidate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/yusing/godoxy/internal/common"
+	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/route/rules"
+)
+
+const testRuleFile = `
+rules: |
+  path /admin {
+    error 403 Forbidden
+  }
+tests:
+  - name: admin is forbidden
+    request:
+      path: /admin
+    expect:
+      status: %d
+`
+
+func TestValidateRuleFileTests(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	t.Run("pass", func(t *testing.T) {
+		require.NoError(t, os.WriteFile("pass.yml", []byte(fmt.Sprintf(testRuleFile, 403)), 0o644))
+		r := &route.Route{RuleFile: "pass.yml"}
+		require.NoError(t, validateRules(r))
+		require.Len(t, r.Rules, 1)
+		require.Len(t, r.RuleTests, 1)
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		require.NoError(t, os.WriteFile("fail.yml", []byte(fmt.Sprintf(testRuleFile, 200)), 0o644))
+		err := validateRules(&route.Route{RuleFile: "fail.yml"})
+		require.ErrorContains(t, err, "admin is forbidden")
+		require.ErrorContains(t, err, "status: expect 200, got 403")
+	})
+
+	t.Run("tests without rules", func(t *testing.T) {
+		r := &route.Route{RuleTests: rules.Tests{{Name: "test"}}}
+		require.ErrorContains(t, validateRules(r), "rule_tests")
+	})
+}
+
+func TestValidateRulePreset(t *testing.T) {
+	t.Chdir(t.TempDir())
+	require.NoError(t, os.MkdirAll(common.RulePresetsBasePath, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(common.RulePresetsBasePath, "deny.yml"), []byte(`
+params:
+  path: ~
+rules: |
+  path ${params.path} {
+    error 403 Forbidden
+  }
+`), 0o644))
+
+	t.Run("preset rules come first", func(t *testing.T) {
+		r := &route.Route{RulePreset: "deny(path=/admin)", RuleTests: rules.Tests{{
+			Name:    "admin is forbidden",
+			Request: rules.TestRequest{Path: "/admin"},
+			Expect:  rules.TestExpect{Status: 403},
+		}}}
+		require.NoError(t, r.Rules.Parse("path /api {\n  pass\n}"))
+		require.NoError(t, validateRules(r))
+		require.Len(t, r.Rules, 2)
+		require.Equal(t, []string{"deny"}, r.RulePresets)
+	})
+
+	t.Run("with rule file", func(t *testing.T) {
+		err := validateRules(&route.Route{RulePreset: "deny(path=/admin)", RuleFile: "rules.yml"})
+		require.ErrorContains(t, err, "rule_preset")
+	})
+
+	t.Run("missing param", func(t *testing.T) {
+		err := validateRules(&route.Route{RulePreset: "deny"})
+		require.ErrorContains(t, err, "path")
+	})
+}
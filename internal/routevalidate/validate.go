@@ -14,6 +14,7 @@ import (
 	netutils "github.com/yusing/godoxy/internal/net"
 	nettypes "github.com/yusing/godoxy/internal/net/types"
 	"github.com/yusing/godoxy/internal/route"
+	"github.com/yusing/godoxy/internal/route/rules"
 	"github.com/yusing/godoxy/internal/routeimpl"
 	"github.com/yusing/godoxy/internal/routing"
 	gperr "github.com/yusing/goutils/errs"
@@ -70,6 +71,10 @@ func Validate(ctx context.Context, r *route.Route) (impl routing.Route, agent *a
 	var errs gperr.Builder
 	if r.Idlewatcher != nil {
 		errs.AddSubject(r.Idlewatcher.ValidateResolved(), "idlewatcher")
+		if q := r.Idlewatcher.Queue; q != nil && q.On != "" {
+			var on rules.RuleOn
+			errs.AddSubject(on.Parse(q.On), "idlewatcher.queue.on")
+		}
 	}
 
 	// return error if route is localhost:<godoxy_port> but route is not agent
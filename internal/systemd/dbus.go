@@ -0,0 +1,734 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file implements the subset of the D-Bus wire protocol needed to call
+// systemd: EXTERNAL auth, method calls and replies with basic types and variants.
+//
+// See https://dbus.freedesktop.org/doc/dbus-specification.html
+
+type MessageType byte
+
+const (
+	MessageTypeMethodCall   MessageType = 1
+	MessageTypeMethodReturn MessageType = 2
+	MessageTypeError        MessageType = 3
+	MessageTypeSignal       MessageType = 4
+)
+
+const (
+	fieldPath        byte = 1
+	fieldInterface   byte = 2
+	fieldMember      byte = 3
+	fieldErrorName   byte = 4
+	fieldReplySerial byte = 5
+	fieldDestination byte = 6
+	fieldSender      byte = 7
+	fieldSignature   byte = 8
+)
+
+const (
+	DefaultSystemBusAddress = "unix:path=/run/dbus/system_bus_socket"
+
+	maxMessageSize = 1 << 20 // well below the 128MiB protocol limit, replies we read are small
+)
+
+var (
+	ErrAuthRejected       = errors.New("dbus: authentication rejected")
+	ErrUnsupportedAddress = errors.New("dbus: unsupported address")
+	ErrUnsupportedType    = errors.New("dbus: unsupported type")
+	ErrMessageTooLarge    = errors.New("dbus: message too large")
+)
+
+// Message is a D-Bus message with a decoded header and body.
+type Message struct {
+	Type        MessageType
+	Flags       byte
+	Serial      uint32
+	Path        string
+	Interface   string
+	Member      string
+	ErrorName   string
+	ReplySerial uint32
+	Destination string
+	Sender      string
+	Signature   string
+	Body        []any
+}
+
+// Error is a D-Bus error reply.
+type Error struct {
+	Name    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return e.Name + ": " + e.Message
+}
+
+// ObjectPath is a D-Bus object path ("o").
+type ObjectPath string
+
+// Signature is a D-Bus type signature ("g").
+type Signature string
+
+// Variant is a D-Bus variant ("v").
+type Variant struct {
+	Signature string
+	Value     any
+}
+
+// Conn is a D-Bus connection that serializes method calls.
+type Conn struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	r      *bufio.Reader
+	serial uint32
+	name   string
+}
+
+// SystemBusAddress returns the system bus address from
+// DBUS_SYSTEM_BUS_ADDRESS, or the default one.
+func SystemBusAddress() string {
+	if addr := os.Getenv("DBUS_SYSTEM_BUS_ADDRESS"); addr != "" {
+		return addr
+	}
+	return DefaultSystemBusAddress
+}
+
+// Dial connects to a bus address, authenticates and sends Hello.
+//
+// Supported addresses are "unix:path=...", "unix:abstract=..." and "tcp:host=...,port=...".
+func Dial(ctx context.Context, address string) (*Conn, error) {
+	network, addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{conn: nc, r: bufio.NewReader(nc)}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+		defer nc.SetDeadline(time.Time{}) //nolint:errcheck
+	}
+	if err := c.auth(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	reply, err := c.Call(ctx, "org.freedesktop.DBus", "/org/freedesktop/DBus", "org.freedesktop.DBus", "Hello")
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	if len(reply) > 0 {
+		c.name, _ = reply[0].(string)
+	}
+	return c, nil
+}
+
+func parseAddress(address string) (network, addr string, err error) {
+	// only the first address is used if multiple are given
+	address, _, _ = strings.Cut(address, ";")
+	transport, params, ok := strings.Cut(address, ":")
+	if !ok {
+		return "", "", fmt.Errorf("%w: %q", ErrUnsupportedAddress, address)
+	}
+	kv := make(map[string]string)
+	for param := range strings.SplitSeq(params, ",") {
+		k, v, _ := strings.Cut(param, "=")
+		kv[k] = v
+	}
+	switch transport {
+	case "unix":
+		if path := kv["path"]; path != "" {
+			return "unix", path, nil
+		}
+		if abstract := kv["abstract"]; abstract != "" {
+			return "unix", "@" + abstract, nil
+		}
+	case "tcp":
+		if kv["host"] != "" && kv["port"] != "" {
+			return "tcp", net.JoinHostPort(kv["host"], kv["port"]), nil
+		}
+	}
+	return "", "", fmt.Errorf("%w: %q", ErrUnsupportedAddress, address)
+}
+
+func (c *Conn) auth() error {
+	uid := hex.EncodeToString([]byte(strconv.Itoa(os.Getuid())))
+	if _, err := io.WriteString(c.conn, "\x00AUTH EXTERNAL "+uid+"\r\n"); err != nil {
+		return err
+	}
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "OK ") {
+		return fmt.Errorf("%w: %s", ErrAuthRejected, strings.TrimSpace(line))
+	}
+	_, err = io.WriteString(c.conn, "BEGIN\r\n")
+	return err
+}
+
+// UniqueName returns the unique bus name assigned by Hello.
+func (c *Conn) UniqueName() string {
+	return c.name
+}
+
+// Call calls a method and returns the reply body.
+//
+// Signals and unrelated replies received while waiting are discarded.
+func (c *Conn) Call(ctx context.Context, dest string, path ObjectPath, iface, member string, args ...any) ([]any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = c.conn.SetDeadline(deadline)
+		defer c.conn.SetDeadline(time.Time{}) //nolint:errcheck
+	}
+
+	c.serial++
+	msg := &Message{
+		Type:        MessageTypeMethodCall,
+		Serial:      c.serial,
+		Path:        string(path),
+		Interface:   iface,
+		Member:      member,
+		Destination: dest,
+		Body:        args,
+	}
+	if err := WriteMessage(c.conn, msg); err != nil {
+		return nil, err
+	}
+	for {
+		reply, err := ReadMessage(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if reply.ReplySerial != msg.Serial {
+			continue
+		}
+		switch reply.Type {
+		case MessageTypeMethodReturn:
+			return reply.Body, nil
+		case MessageTypeError:
+			dbusErr := &Error{Name: reply.ErrorName}
+			if len(reply.Body) > 0 {
+				dbusErr.Message, _ = reply.Body[0].(string)
+			}
+			return nil, dbusErr
+		}
+	}
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// WriteMessage encodes and writes a message.
+//
+// The body signature is derived from the Go types of Body
+// (string, ObjectPath, Signature, bool, byte, int32, uint32, Variant).
+func WriteMessage(w io.Writer, msg *Message) error {
+	var body encoder
+	sig := msg.Signature
+	if sig == "" {
+		var err error
+		sig, err = signatureOf(msg.Body)
+		if err != nil {
+			return err
+		}
+	}
+	for _, arg := range msg.Body {
+		if err := body.value(arg); err != nil {
+			return err
+		}
+	}
+
+	var fields []headerField
+	addField := func(code byte, v any) {
+		fields = append(fields, headerField{code, v})
+	}
+	if msg.Path != "" {
+		addField(fieldPath, ObjectPath(msg.Path))
+	}
+	if msg.Interface != "" {
+		addField(fieldInterface, msg.Interface)
+	}
+	if msg.Member != "" {
+		addField(fieldMember, msg.Member)
+	}
+	if msg.ErrorName != "" {
+		addField(fieldErrorName, msg.ErrorName)
+	}
+	if msg.ReplySerial != 0 {
+		addField(fieldReplySerial, msg.ReplySerial)
+	}
+	if msg.Destination != "" {
+		addField(fieldDestination, msg.Destination)
+	}
+	if msg.Sender != "" {
+		addField(fieldSender, msg.Sender)
+	}
+	if sig != "" {
+		addField(fieldSignature, Signature(sig))
+	}
+
+	var hdr encoder
+	hdr.byte('l')
+	hdr.byte(byte(msg.Type))
+	hdr.byte(msg.Flags)
+	hdr.byte(1) // protocol version
+	hdr.uint32(uint32(body.buf.Len()))
+	hdr.uint32(msg.Serial)
+	// a(yv)
+	lenPos := hdr.buf.Len()
+	hdr.uint32(0)
+	hdr.align(8)
+	start := hdr.buf.Len()
+	for _, hf := range fields {
+		hdr.align(8)
+		hdr.byte(hf.code)
+		if err := hdr.value(Variant{Value: hf.value}); err != nil {
+			return err
+		}
+	}
+	binary.LittleEndian.PutUint32(hdr.buf.Bytes()[lenPos:], uint32(hdr.buf.Len()-start))
+	hdr.align(8)
+
+	if _, err := w.Write(hdr.buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := w.Write(body.buf.Bytes())
+	return err
+}
+
+type headerField struct {
+	code  byte
+	value any
+}
+
+// ReadMessage reads and decodes a message.
+func ReadMessage(r io.Reader) (*Message, error) {
+	fixed := make([]byte, 16)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, err
+	}
+	var order binary.ByteOrder
+	switch fixed[0] {
+	case 'l':
+		order = binary.LittleEndian
+	case 'B':
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("dbus: invalid endianness %q", fixed[0])
+	}
+	bodyLen := order.Uint32(fixed[4:])
+	fieldsLen := order.Uint32(fixed[12:])
+	headerLen := 16 + fieldsLen
+	headerLen += (8 - headerLen%8) % 8
+	if uint64(headerLen)+uint64(bodyLen) > maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	buf := make([]byte, headerLen+bodyLen)
+	copy(buf, fixed)
+	if _, err := io.ReadFull(r, buf[16:]); err != nil {
+		return nil, err
+	}
+
+	msg := &Message{
+		Type:   MessageType(fixed[1]),
+		Flags:  fixed[2],
+		Serial: order.Uint32(fixed[8:]),
+	}
+	dec := &decoder{buf: buf[:16+fieldsLen], pos: 16, order: order}
+	for dec.pos < len(dec.buf) {
+		dec.align(8)
+		code, err := dec.byte()
+		if err != nil {
+			return nil, err
+		}
+		v, err := dec.value("v")
+		if err != nil {
+			return nil, err
+		}
+		value := v.(Variant).Value
+		switch code {
+		case fieldPath:
+			msg.Path = stringOf(value)
+		case fieldInterface:
+			msg.Interface = stringOf(value)
+		case fieldMember:
+			msg.Member = stringOf(value)
+		case fieldErrorName:
+			msg.ErrorName = stringOf(value)
+		case fieldReplySerial:
+			msg.ReplySerial, _ = value.(uint32)
+		case fieldDestination:
+			msg.Destination = stringOf(value)
+		case fieldSender:
+			msg.Sender = stringOf(value)
+		case fieldSignature:
+			msg.Signature = stringOf(value)
+		}
+	}
+
+	body := &decoder{buf: buf[headerLen:], order: order}
+	for sig := msg.Signature; sig != ""; {
+		t, rest, err := nextType(sig)
+		if err != nil {
+			return nil, err
+		}
+		v, err := body.value(t)
+		if err != nil {
+			return nil, err
+		}
+		msg.Body = append(msg.Body, v)
+		sig = rest
+	}
+	return msg, nil
+}
+
+func stringOf(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case ObjectPath:
+		return string(v)
+	case Signature:
+		return string(v)
+	}
+	return ""
+}
+
+func signatureOf(args []any) (string, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sig, err := typeSignature(arg)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(sig)
+	}
+	return sb.String(), nil
+}
+
+func typeSignature(v any) (string, error) {
+	switch v.(type) {
+	case byte:
+		return "y", nil
+	case bool:
+		return "b", nil
+	case int32:
+		return "i", nil
+	case uint32:
+		return "u", nil
+	case string:
+		return "s", nil
+	case ObjectPath:
+		return "o", nil
+	case Signature:
+		return "g", nil
+	case Variant:
+		return "v", nil
+	}
+	return "", fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+}
+
+// nextType splits the first complete type off a signature.
+func nextType(sig string) (string, string, error) {
+	if sig == "" {
+		return "", "", fmt.Errorf("%w: empty signature", ErrUnsupportedType)
+	}
+	switch sig[0] {
+	case 'a':
+		elem, rest, err := nextType(sig[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return "a" + elem, rest, nil
+	case '(', '{':
+		closing := byte(')')
+		if sig[0] == '{' {
+			closing = '}'
+		}
+		inner := sig[1:]
+		for inner != "" && inner[0] != closing {
+			var err error
+			_, inner, err = nextType(inner)
+			if err != nil {
+				return "", "", err
+			}
+		}
+		if inner == "" {
+			return "", "", fmt.Errorf("%w: unterminated %q", ErrUnsupportedType, sig)
+		}
+		n := len(sig) - len(inner) + 1
+		return sig[:n], sig[n:], nil
+	default:
+		return sig[:1], sig[1:], nil
+	}
+}
+
+type encoder struct {
+	buf bytes.Buffer
+}
+
+func (e *encoder) align(n int) {
+	for e.buf.Len()%n != 0 {
+		e.buf.WriteByte(0)
+	}
+}
+
+func (e *encoder) byte(b byte) {
+	e.buf.WriteByte(b)
+}
+
+func (e *encoder) uint32(v uint32) {
+	e.align(4)
+	e.buf.Write(binary.LittleEndian.AppendUint32(nil, v))
+}
+
+func (e *encoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.buf.WriteString(s)
+	e.buf.WriteByte(0)
+}
+
+func (e *encoder) signature(s string) {
+	e.buf.WriteByte(byte(len(s)))
+	e.buf.WriteString(s)
+	e.buf.WriteByte(0)
+}
+
+func (e *encoder) value(v any) error {
+	switch v := v.(type) {
+	case byte:
+		e.byte(v)
+	case bool:
+		if v {
+			e.uint32(1)
+		} else {
+			e.uint32(0)
+		}
+	case int32:
+		e.uint32(uint32(v))
+	case uint32:
+		e.uint32(v)
+	case string:
+		e.string(v)
+	case ObjectPath:
+		e.string(string(v))
+	case Signature:
+		e.signature(string(v))
+	case Variant:
+		sig := v.Signature
+		if sig == "" {
+			var err error
+			sig, err = typeSignature(v.Value)
+			if err != nil {
+				return err
+			}
+		}
+		e.signature(sig)
+		return e.value(v.Value)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, v)
+	}
+	return nil
+}
+
+type decoder struct {
+	buf   []byte
+	pos   int
+	order binary.ByteOrder
+}
+
+var errShortBuffer = errors.New("dbus: short buffer")
+
+func (d *decoder) align(n int) {
+	d.pos += (n - d.pos%n) % n
+}
+
+func (d *decoder) next(n int) ([]byte, error) {
+	if d.pos+n > len(d.buf) {
+		return nil, errShortBuffer
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) byte() (byte, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *decoder) uint32() (uint32, error) {
+	d.align(4)
+	b, err := d.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return d.order.Uint32(b), nil
+}
+
+func (d *decoder) string() (string, error) {
+	n, err := d.uint32()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n]), nil
+}
+
+func (d *decoder) signature() (string, error) {
+	n, err := d.byte()
+	if err != nil {
+		return "", err
+	}
+	b, err := d.next(int(n) + 1)
+	if err != nil {
+		return "", err
+	}
+	return string(b[:n]), nil
+}
+
+func (d *decoder) value(sig string) (any, error) {
+	switch sig[0] {
+	case 'y':
+		return d.byte()
+	case 'b':
+		v, err := d.uint32()
+		return v != 0, err
+	case 'n', 'q':
+		d.align(2)
+		b, err := d.next(2)
+		if err != nil {
+			return nil, err
+		}
+		if sig[0] == 'n' {
+			return int16(d.order.Uint16(b)), nil
+		}
+		return d.order.Uint16(b), nil
+	case 'i':
+		v, err := d.uint32()
+		return int32(v), err
+	case 'u', 'h':
+		return d.uint32()
+	case 'x', 't', 'd':
+		d.align(8)
+		b, err := d.next(8)
+		if err != nil {
+			return nil, err
+		}
+		switch sig[0] {
+		case 'x':
+			return int64(d.order.Uint64(b)), nil
+		case 'd':
+			return math.Float64frombits(d.order.Uint64(b)), nil
+		}
+		return d.order.Uint64(b), nil
+	case 's':
+		return d.string()
+	case 'o':
+		s, err := d.string()
+		return ObjectPath(s), err
+	case 'g':
+		s, err := d.signature()
+		return Signature(s), err
+	case 'v':
+		s, err := d.signature()
+		if err != nil {
+			return nil, err
+		}
+		t, rest, err := nextType(s)
+		if err != nil {
+			return nil, err
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("%w: variant signature %q", ErrUnsupportedType, s)
+		}
+		v, err := d.value(t)
+		return Variant{Signature: s, Value: v}, err
+	case 'a':
+		n, err := d.uint32()
+		if err != nil {
+			return nil, err
+		}
+		elem := sig[1:]
+		d.align(alignment(elem[0]))
+		end := d.pos + int(n)
+		if end > len(d.buf) {
+			return nil, errShortBuffer
+		}
+		var values []any
+		for d.pos < end {
+			v, err := d.value(elem)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	case '(', '{':
+		d.align(8)
+		inner := sig[1 : len(sig)-1]
+		var values []any
+		for inner != "" {
+			t, rest, err := nextType(inner)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(t)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+			inner = rest
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedType, sig)
+}
+
+func alignment(t byte) int {
+	switch t {
+	case 'n', 'q':
+		return 2
+	case 'b', 'i', 'u', 'h', 's', 'o', 'a':
+		return 4
+	case 'x', 't', 'd', '(', '{':
+		return 8
+	default:
+		return 1
+	}
+}
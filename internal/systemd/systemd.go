@@ -0,0 +1,163 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	busName          = "org.freedesktop.systemd1"
+	managerPath      = ObjectPath("/org/freedesktop/systemd1")
+	managerInterface = "org.freedesktop.systemd1.Manager"
+	unitInterface    = "org.freedesktop.systemd1.Unit"
+	propsInterface   = "org.freedesktop.DBus.Properties"
+
+	// JobModeReplace queues the job and replaces conflicting jobs, like `systemctl start`.
+	JobModeReplace = "replace"
+)
+
+type (
+	// UnitState is the subset of unit properties used to derive its lifecycle state.
+	UnitState struct {
+		ActiveState  string `json:"active_state"`  // active, reloading, inactive, failed, activating, deactivating
+		FreezerState string `json:"freezer_state"` // running, freezing, frozen, thawing; empty if unsupported
+	}
+
+	// Client calls the systemd manager over D-Bus.
+	//
+	// The connection is established lazily and re-established after I/O errors.
+	Client struct {
+		address string
+
+		mu   sync.Mutex
+		conn *Conn
+	}
+)
+
+var ErrUnexpectedReply = errors.New("systemd: unexpected reply")
+
+// NewClient returns a client for the bus at address.
+// An empty address means the system bus.
+func NewClient(address string) *Client {
+	if address == "" {
+		address = SystemBusAddress()
+	}
+	return &Client{address: address}
+}
+
+func (c *Client) call(ctx context.Context, path ObjectPath, iface, member string, args ...any) ([]any, error) {
+	c.mu.Lock()
+	conn := c.conn
+	if conn == nil {
+		var err error
+		conn, err = Dial(ctx, c.address)
+		if err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		c.conn = conn
+	}
+	c.mu.Unlock()
+
+	reply, err := conn.Call(ctx, busName, path, iface, member, args...)
+	var dbusErr *Error
+	if err != nil && !errors.As(err, &dbusErr) {
+		// connection is in an unknown state, redial on next call
+		c.mu.Lock()
+		if c.conn == conn {
+			c.conn = nil
+		}
+		c.mu.Unlock()
+		conn.Close()
+	}
+	return reply, err
+}
+
+func (c *Client) managerCall(ctx context.Context, member string, args ...any) ([]any, error) {
+	return c.call(ctx, managerPath, managerInterface, member, args...)
+}
+
+// StartUnit starts a unit like `systemctl start`.
+func (c *Client) StartUnit(ctx context.Context, unit string) error {
+	_, err := c.managerCall(ctx, "StartUnit", unit, JobModeReplace)
+	return err
+}
+
+// StopUnit stops a unit like `systemctl stop`.
+func (c *Client) StopUnit(ctx context.Context, unit string) error {
+	_, err := c.managerCall(ctx, "StopUnit", unit, JobModeReplace)
+	return err
+}
+
+// KillUnit sends a signal to all processes of a unit like `systemctl kill`.
+func (c *Client) KillUnit(ctx context.Context, unit string, signal int32) error {
+	_, err := c.managerCall(ctx, "KillUnit", unit, "all", signal)
+	return err
+}
+
+// FreezeUnit freezes all processes of a unit with the cgroup freezer (systemd >= 246).
+func (c *Client) FreezeUnit(ctx context.Context, unit string) error {
+	_, err := c.managerCall(ctx, "FreezeUnit", unit)
+	return err
+}
+
+// ThawUnit thaws a frozen unit.
+func (c *Client) ThawUnit(ctx context.Context, unit string) error {
+	_, err := c.managerCall(ctx, "ThawUnit", unit)
+	return err
+}
+
+// UnitState returns the active and freezer state of a unit.
+func (c *Client) UnitState(ctx context.Context, unit string) (UnitState, error) {
+	var state UnitState
+	reply, err := c.managerCall(ctx, "LoadUnit", unit)
+	if err != nil {
+		return state, err
+	}
+	if len(reply) != 1 {
+		return state, fmt.Errorf("%w: LoadUnit returned %d values", ErrUnexpectedReply, len(reply))
+	}
+	path, ok := reply[0].(ObjectPath)
+	if !ok {
+		return state, fmt.Errorf("%w: LoadUnit returned %T", ErrUnexpectedReply, reply[0])
+	}
+
+	state.ActiveState, err = c.unitProperty(ctx, path, "ActiveState")
+	if err != nil {
+		return state, err
+	}
+	// FreezerState is missing on older systemd, treat it as running.
+	state.FreezerState, _ = c.unitProperty(ctx, path, "FreezerState")
+	return state, nil
+}
+
+func (c *Client) unitProperty(ctx context.Context, path ObjectPath, name string) (string, error) {
+	reply, err := c.call(ctx, path, propsInterface, "Get", unitInterface, name)
+	if err != nil {
+		return "", err
+	}
+	if len(reply) != 1 {
+		return "", fmt.Errorf("%w: Get(%s) returned %d values", ErrUnexpectedReply, name, len(reply))
+	}
+	v, ok := reply[0].(Variant)
+	if !ok {
+		return "", fmt.Errorf("%w: Get(%s) returned %T", ErrUnexpectedReply, name, reply[0])
+	}
+	s, ok := v.Value.(string)
+	if !ok {
+		return "", fmt.Errorf("%w: %s is %T", ErrUnexpectedReply, name, v.Value)
+	}
+	return s, nil
+}
+
+// Close closes the underlying connection, if any.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
@@ -0,0 +1,230 @@
+package systemd
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSystemd is a minimal D-Bus peer that implements the systemd manager
+// methods used by Client.
+type fakeSystemd struct {
+	mu    sync.Mutex
+	units map[string]*UnitState
+	kills []int32
+}
+
+func newFakeSystemd(t *testing.T, units ...string) (*fakeSystemd, string) {
+	t.Helper()
+
+	fake := &fakeSystemd{units: make(map[string]*UnitState)}
+	for _, unit := range units {
+		fake.units[unit] = &UnitState{ActiveState: "inactive", FreezerState: "running"}
+	}
+
+	sock := filepath.Join(t.TempDir(), "bus.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+	return fake, "unix:path=" + sock
+}
+
+func (f *fakeSystemd) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "\x00AUTH EXTERNAL ") {
+		return
+	}
+	if _, err := conn.Write([]byte("OK 0123456789abcdef0123456789abcdef\r\n")); err != nil {
+		return
+	}
+	if line, err = r.ReadString('\n'); err != nil || line != "BEGIN\r\n" {
+		return
+	}
+
+	var serial uint32
+	for {
+		call, err := ReadMessage(r)
+		if err != nil {
+			return
+		}
+		serial++
+		reply := &Message{
+			Type:        MessageTypeMethodReturn,
+			Serial:      serial,
+			ReplySerial: call.Serial,
+		}
+		body, errName := f.handle(call)
+		if errName != "" {
+			reply.Type = MessageTypeError
+			reply.ErrorName = errName
+			reply.Body = []any{"fake error"}
+		} else {
+			reply.Body = body
+		}
+		if err := WriteMessage(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeSystemd) handle(call *Message) (body []any, errName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if call.Member == "Hello" {
+		return []any{":1.42"}, ""
+	}
+	if call.Interface == propsInterface && call.Member == "Get" {
+		unit := f.units[strings.TrimPrefix(call.Path, "/unit/")]
+		switch call.Body[1] {
+		case "ActiveState":
+			return []any{Variant{Value: unit.ActiveState}}, ""
+		case "FreezerState":
+			return []any{Variant{Value: unit.FreezerState}}, ""
+		}
+		return nil, "org.freedesktop.DBus.Error.UnknownProperty"
+	}
+
+	name, _ := call.Body[0].(string)
+	unit, ok := f.units[name]
+	if !ok {
+		return nil, "org.freedesktop.systemd1.NoSuchUnit"
+	}
+	switch call.Member {
+	case "LoadUnit":
+		return []any{ObjectPath("/unit/" + name)}, ""
+	case "StartUnit":
+		unit.ActiveState = "active"
+		return []any{ObjectPath("/job/1")}, ""
+	case "StopUnit":
+		unit.ActiveState = "inactive"
+		return []any{ObjectPath("/job/2")}, ""
+	case "KillUnit":
+		f.kills = append(f.kills, call.Body[2].(int32))
+		unit.ActiveState = "failed"
+		return nil, ""
+	case "FreezeUnit":
+		unit.FreezerState = "frozen"
+		return nil, ""
+	case "ThawUnit":
+		unit.FreezerState = "running"
+		return nil, ""
+	}
+	return nil, "org.freedesktop.DBus.Error.UnknownMethod"
+}
+
+func TestClientUnitLifecycle(t *testing.T) {
+	fake, addr := newFakeSystemd(t, "game.service")
+	c := NewClient(addr)
+	t.Cleanup(c.Close)
+	ctx := t.Context()
+
+	state, err := c.UnitState(ctx, "game.service")
+	require.NoError(t, err)
+	require.Equal(t, UnitState{ActiveState: "inactive", FreezerState: "running"}, state)
+
+	require.NoError(t, c.StartUnit(ctx, "game.service"))
+	state, err = c.UnitState(ctx, "game.service")
+	require.NoError(t, err)
+	require.Equal(t, "active", state.ActiveState)
+
+	require.NoError(t, c.FreezeUnit(ctx, "game.service"))
+	state, err = c.UnitState(ctx, "game.service")
+	require.NoError(t, err)
+	require.Equal(t, "frozen", state.FreezerState)
+
+	require.NoError(t, c.ThawUnit(ctx, "game.service"))
+	require.NoError(t, c.KillUnit(ctx, "game.service", 15))
+	require.Equal(t, []int32{15}, fake.kills)
+
+	require.NoError(t, c.StopUnit(ctx, "game.service"))
+	state, err = c.UnitState(ctx, "game.service")
+	require.NoError(t, err)
+	require.Equal(t, "inactive", state.ActiveState)
+}
+
+func TestClientErrorReply(t *testing.T) {
+	_, addr := newFakeSystemd(t)
+	c := NewClient(addr)
+	t.Cleanup(c.Close)
+
+	err := c.StartUnit(t.Context(), "missing.service")
+	var dbusErr *Error
+	require.ErrorAs(t, err, &dbusErr)
+	require.Equal(t, "org.freedesktop.systemd1.NoSuchUnit", dbusErr.Name)
+	require.Equal(t, "fake error", dbusErr.Message)
+
+	// error replies keep the connection usable
+	require.NotNil(t, c.conn)
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	want := &Message{
+		Type:        MessageTypeMethodCall,
+		Serial:      7,
+		Path:        "/org/freedesktop/systemd1",
+		Interface:   managerInterface,
+		Member:      "KillUnit",
+		Destination: busName,
+		Body:        []any{"a.service", "all", int32(9), true, uint32(3), Variant{Value: "x"}},
+	}
+	go func() {
+		_ = WriteMessage(client, want)
+	}()
+	got, err := ReadMessage(server)
+	require.NoError(t, err)
+	require.Equal(t, "ssibuv", got.Signature)
+	want.Signature = got.Signature
+	want.Body[5] = Variant{Signature: "s", Value: "x"}
+	require.Equal(t, want, got)
+}
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		network string
+		addr    string
+		wantErr bool
+	}{
+		{address: "unix:path=/run/dbus/system_bus_socket", network: "unix", addr: "/run/dbus/system_bus_socket"},
+		{address: "unix:abstract=/tmp/dbus-x,guid=1234", network: "unix", addr: "@/tmp/dbus-x"},
+		{address: "tcp:host=10.0.0.2,port=55556;unix:path=/x", network: "tcp", addr: "10.0.0.2:55556"},
+		{address: "launchd:env=X", wantErr: true},
+		{address: "garbage", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.address, func(t *testing.T) {
+			network, addr, err := parseAddress(tc.address)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrUnsupportedAddress)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.network, network)
+			require.Equal(t, tc.addr, addr)
+		})
+	}
+}
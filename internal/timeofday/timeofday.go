@@ -0,0 +1,98 @@
+package timeofday
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Weekdays is a bit set of time.Weekday.
+type Weekdays uint8
+
+const (
+	MinutesPerDay = 24 * 60
+
+	AllWeekdays Weekdays = 1<<7 - 1
+)
+
+var (
+	ErrInvalidWeekday = errors.New("invalid weekday")
+	ErrInvalidTime    = errors.New("invalid time of day, expect HH:MM")
+)
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Has reports whether day is in the set.
+func (d Weekdays) Has(day time.Weekday) bool {
+	return d&(1<<day) != 0
+}
+
+// ParseWeekday parses a case insensitive weekday name, e.g. "mon" or "Monday".
+func ParseWeekday(s string) (time.Weekday, error) {
+	day, ok := weekdayNames[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidWeekday, s)
+	}
+	return day, nil
+}
+
+// ParseWeekdays parses a weekday or a range of weekdays, e.g. "mon-fri" or "fri-mon".
+func ParseWeekdays(s string) (Weekdays, error) {
+	first, last, isRange := strings.Cut(s, "-")
+	from, err := ParseWeekday(first)
+	if err != nil {
+		return 0, err
+	}
+	to := from
+	if isRange {
+		if to, err = ParseWeekday(last); err != nil {
+			return 0, err
+		}
+	}
+	return WeekdayRange(from, to), nil
+}
+
+// WeekdayRange returns days from..to inclusive, wrapping around the week.
+func WeekdayRange(from, to time.Weekday) Weekdays {
+	var days Weekdays
+	for day := from; ; day = (day + 1) % 7 {
+		days |= 1 << day
+		if day == to {
+			return days
+		}
+	}
+}
+
+// Parse parses HH:MM into minutes since midnight.
+// "24:00" is only accepted when allowEndOfDay is true, e.g. as the end of a range.
+func Parse(s string, allowEndOfDay bool) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	if !ok || len(hh) != 2 || len(mm) != 2 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTime, s)
+	}
+	h, errH := strconv.ParseUint(hh, 10, 8)
+	m, errM := strconv.ParseUint(mm, 10, 8)
+	if errH != nil || errM != nil || m > 59 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTime, s)
+	}
+	minutes := int(h*60 + m)
+	if minutes > MinutesPerDay || (minutes == MinutesPerDay && !allowEndOfDay) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidTime, s)
+	}
+	return minutes, nil
+}
+
+// Format formats minutes since midnight as HH:MM.
+func Format(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
@@ -0,0 +1,68 @@
+package timeofday
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseWeekdays(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Weekdays
+		wantErr bool
+	}{
+		{input: "mon", want: 1 << time.Monday},
+		{input: "Thursday", want: 1 << time.Thursday},
+		{input: "mon-fri", want: WeekdayRange(time.Monday, time.Friday)},
+		{input: "fri-mon", want: 1<<time.Friday | 1<<time.Saturday | 1<<time.Sunday | 1<<time.Monday},
+		{input: "sun-sat", want: AllWeekdays},
+		{input: "funday", wantErr: true},
+		{input: "mon-xyz", wantErr: true},
+		{input: "mon-", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			days, err := ParseWeekdays(tc.input)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidWeekday)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, days)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input         string
+		allowEndOfDay bool
+		want          int
+		wantErr       bool
+	}{
+		{input: "00:00", want: 0},
+		{input: "07:45", want: 7*60 + 45},
+		{input: "23:59", want: MinutesPerDay - 1},
+		{input: "24:00", allowEndOfDay: true, want: MinutesPerDay},
+		{input: "24:00", wantErr: true},
+		{input: "24:01", allowEndOfDay: true, wantErr: true},
+		{input: "9:00", wantErr: true},
+		{input: "09:60", wantErr: true},
+		{input: "+9:00", wantErr: true},
+		{input: "0900", wantErr: true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.input, func(t *testing.T) {
+			minutes, err := Parse(tc.input, tc.allowEndOfDay)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidTime)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, minutes)
+			require.Equal(t, tc.input, Format(minutes))
+		})
+	}
+}
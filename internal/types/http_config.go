@@ -4,11 +4,14 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
 	"time"
 
+	"github.com/yusing/godoxy/internal/autocert/localca"
+	gphttp "github.com/yusing/godoxy/internal/net/gphttp"
 	gperr "github.com/yusing/goutils/errs"
 )
 
@@ -18,12 +21,121 @@ type HTTPConfig struct {
 	MaxConnsPerHost       int           `json:"max_conns_per_host,omitempty"`
 	DisableCompression    bool          `json:"disable_compression,omitempty"`
 
+	// Upstream connection options
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host,omitempty"`
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout,omitempty" swaggertype:"primitive,integer"`
+	DisableKeepAlives   bool          `json:"disable_keep_alives,omitempty"`
+	DialTimeout         time.Duration `json:"dial_timeout,omitempty" swaggertype:"primitive,integer"`
+	TLSHandshakeTimeout time.Duration `json:"tls_handshake_timeout,omitempty" swaggertype:"primitive,integer"`
+	TCPKeepAlive        time.Duration `json:"tcp_keepalive,omitempty" swaggertype:"primitive,integer"` // negative disables TCP keep-alive probes
+	HTTP2               string        `json:"http2,omitempty" validate:"omitempty,oneof=auto on off" enums:"auto,on,off"`
+	HTTP2PingInterval   time.Duration `json:"http2_ping_interval,omitempty" swaggertype:"primitive,integer"` // ping idle HTTP/2 connections after this long without frames
+	HTTP2PingTimeout    time.Duration `json:"http2_ping_timeout,omitempty" swaggertype:"primitive,integer"`  // close HTTP/2 connections not answering a ping within this long
+	GRPC                bool          `json:"grpc,omitempty"`                                                // HTTP/2 to upstream, no response header timeout, HTTP/2 pings
+
 	// SSL/TLS proxy options (nginx-like)
 	SSLServerName         *string  `json:"ssl_server_name,omitempty"`         // SNI server name
 	SSLTrustedCertificate string   `json:"ssl_trusted_certificate,omitempty"` // Path to trusted CA certificates
 	SSLCertificate        string   `json:"ssl_certificate,omitempty"`         // Path to client certificate
 	SSLCertificateKey     string   `json:"ssl_certificate_key,omitempty"`     // Path to client certificate key
 	SSLProtocols          []string `json:"ssl_protocols,omitempty"`           // Allowed TLS protocols
+	SSLLocalCA            bool     `json:"ssl_local_ca,omitempty"`            // Trust the autocert local CA and present a client certificate issued by it
+}
+
+const (
+	HTTP2Auto = "auto"
+	HTTP2On   = "on"
+	HTTP2Off  = "off"
+)
+
+const (
+	grpcHTTP2PingInterval = 30 * time.Second
+	grpcHTTP2PingTimeout  = 15 * time.Second
+)
+
+// ConfigureTransport applies the upstream connection options to a transport
+// for an upstream with the given scheme.
+func (cfg *HTTPConfig) ConfigureTransport(tr *http.Transport, scheme string) error {
+	if cfg.ResponseHeaderTimeout > 0 {
+		tr.ResponseHeaderTimeout = cfg.ResponseHeaderTimeout
+	} else if cfg.GRPC {
+		// streaming calls may not send headers until the first message
+		tr.ResponseHeaderTimeout = 0
+	}
+	if cfg.MaxConnsPerHost > 0 {
+		tr.MaxConnsPerHost = cfg.MaxConnsPerHost
+	}
+	if cfg.DisableCompression {
+		tr.DisableCompression = true
+	}
+	if cfg.MaxIdleConnsPerHost > 0 {
+		tr.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+	}
+	if cfg.IdleConnTimeout > 0 {
+		tr.IdleConnTimeout = cfg.IdleConnTimeout
+	}
+	if cfg.DisableKeepAlives {
+		tr.DisableKeepAlives = true
+	}
+	if cfg.TLSHandshakeTimeout > 0 {
+		tr.TLSHandshakeTimeout = cfg.TLSHandshakeTimeout
+	}
+	if cfg.DialTimeout > 0 || cfg.TCPKeepAlive != 0 {
+		dialer := gphttp.DefaultDialer
+		if cfg.DialTimeout > 0 {
+			dialer.Timeout = cfg.DialTimeout
+		}
+		if cfg.TCPKeepAlive != 0 {
+			dialer.KeepAlive = cfg.TCPKeepAlive
+		}
+		tr.DialContext = dialer.DialContext
+	}
+
+	http2 := cfg.HTTP2
+	if cfg.GRPC {
+		if http2 == HTTP2Off {
+			return errors.New("grpc requires http2")
+		}
+		http2 = HTTP2On
+	}
+	switch http2 {
+	case HTTP2On:
+		switch scheme {
+		case "h2c": // already cleartext HTTP/2
+		case "https":
+			var protocols http.Protocols
+			protocols.SetHTTP2(true)
+			tr.Protocols = &protocols
+			tr.ForceAttemptHTTP2 = true
+		default:
+			return gperr.New("http2 requires an https upstream, use scheme h2c for cleartext HTTP/2").Subject(scheme)
+		}
+	case HTTP2Off:
+		if scheme == "h2c" {
+			return errors.New("http2 off conflicts with scheme h2c")
+		}
+		var protocols http.Protocols
+		protocols.SetHTTP1(true)
+		tr.Protocols = &protocols
+		tr.ForceAttemptHTTP2 = false
+	}
+
+	pingInterval, pingTimeout := cfg.HTTP2PingInterval, cfg.HTTP2PingTimeout
+	if cfg.GRPC {
+		if pingInterval == 0 {
+			pingInterval = grpcHTTP2PingInterval
+		}
+		if pingTimeout == 0 {
+			pingTimeout = grpcHTTP2PingTimeout
+		}
+	}
+	if pingInterval > 0 || pingTimeout > 0 {
+		tr.HTTP2 = &http.HTTP2Config{
+			SendPingTimeout: pingInterval,
+			PingTimeout:     pingTimeout,
+		}
+	}
+	return nil
 }
 
 // BuildTLSConfig creates a TLS configuration based on the HTTP config options.
@@ -81,6 +193,19 @@ func (cfg *HTTPConfig) BuildTLSConfig(targetURL *url.URL) (*tls.Config, error) {
 		return nil, errors.New("ssl_certificate is required when ssl_certificate_key is specified")
 	}
 
+	// Handle ssl_local_ca (upstream mTLS with the autocert local CA)
+	if cfg.SSLLocalCA {
+		ca := localca.Active()
+		if ca == nil {
+			return nil, errors.New("ssl_local_ca requires autocert.local_ca")
+		}
+		if len(tlsConfig.Certificates) > 0 {
+			return nil, errors.New("ssl_local_ca and ssl_certificate are mutually exclusive")
+		}
+		tlsConfig.RootCAs = ca.RootPool(tlsConfig.RootCAs)
+		tlsConfig.GetClientCertificate = ca.ClientCertificate
+	}
+
 	// Handle ssl_protocols (TLS versions)
 	if len(cfg.SSLProtocols) > 0 {
 		var minVersion, maxVersion uint16
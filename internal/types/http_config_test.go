@@ -1,10 +1,12 @@
 package types_test
 
 import (
+	"net/http"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/yusing/godoxy/internal/route"
 	"github.com/yusing/godoxy/internal/serialization"
 	. "github.com/yusing/godoxy/internal/types"
@@ -43,6 +45,32 @@ func TestHTTPConfigDeserialize(t *testing.T) {
 				MaxConnsPerHost: 256,
 			},
 		},
+		{
+			name: "connection pool",
+			input: map[string]any{
+				"max_idle_conns_per_host": "16",
+				"idle_conn_timeout":       "30s",
+				"tcp_keepalive":           "-1s",
+			},
+			expected: HTTPConfig{
+				MaxIdleConnsPerHost: 16,
+				IdleConnTimeout:     30 * time.Second,
+				TCPKeepAlive:        -time.Second,
+			},
+		},
+		{
+			name: "grpc",
+			input: map[string]any{
+				"http2":               "on",
+				"grpc":                "true",
+				"http2_ping_interval": "10s",
+			},
+			expected: HTTPConfig{
+				HTTP2:             HTTP2On,
+				GRPC:              true,
+				HTTP2PingInterval: 10 * time.Second,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -57,3 +85,81 @@ func TestHTTPConfigDeserialize(t *testing.T) {
 		})
 	}
 }
+
+func TestHTTPConfigDeserializeInvalidHTTP2(t *testing.T) {
+	cfg := route.Route{}
+	err := serialization.MapUnmarshalValidate(map[string]any{"host": "internal", "http2": "always"}, &cfg)
+	assert.Error(t, err)
+}
+
+func TestHTTPConfigConfigureTransport(t *testing.T) {
+	newTransport := func() *http.Transport {
+		return &http.Transport{ResponseHeaderTimeout: time.Minute, MaxIdleConnsPerHost: 1000}
+	}
+
+	t.Run("defaults untouched", func(t *testing.T) {
+		tr := newTransport()
+		require.NoError(t, (&HTTPConfig{}).ConfigureTransport(tr, "https"))
+		assert.Equal(t, newTransport(), tr)
+	})
+
+	t.Run("pool", func(t *testing.T) {
+		tr := newTransport()
+		cfg := HTTPConfig{
+			MaxIdleConnsPerHost: 8,
+			IdleConnTimeout:     5 * time.Second,
+			DisableKeepAlives:   true,
+			TLSHandshakeTimeout: 3 * time.Second,
+			DialTimeout:         2 * time.Second,
+		}
+		require.NoError(t, cfg.ConfigureTransport(tr, "http"))
+		assert.Equal(t, 8, tr.MaxIdleConnsPerHost)
+		assert.Equal(t, 5*time.Second, tr.IdleConnTimeout)
+		assert.True(t, tr.DisableKeepAlives)
+		assert.Equal(t, 3*time.Second, tr.TLSHandshakeTimeout)
+		assert.NotNil(t, tr.DialContext)
+		assert.Nil(t, tr.Protocols)
+	})
+
+	t.Run("http2 on", func(t *testing.T) {
+		tr := newTransport()
+		require.NoError(t, (&HTTPConfig{HTTP2: HTTP2On}).ConfigureTransport(tr, "https"))
+		require.NotNil(t, tr.Protocols)
+		assert.True(t, tr.Protocols.HTTP2())
+		assert.False(t, tr.Protocols.HTTP1())
+
+		assert.Error(t, (&HTTPConfig{HTTP2: HTTP2On}).ConfigureTransport(newTransport(), "http"))
+		assert.NoError(t, (&HTTPConfig{HTTP2: HTTP2On}).ConfigureTransport(newTransport(), "h2c"))
+	})
+
+	t.Run("http2 off", func(t *testing.T) {
+		tr := newTransport()
+		tr.ForceAttemptHTTP2 = true
+		require.NoError(t, (&HTTPConfig{HTTP2: HTTP2Off}).ConfigureTransport(tr, "https"))
+		require.NotNil(t, tr.Protocols)
+		assert.False(t, tr.Protocols.HTTP2())
+		assert.False(t, tr.ForceAttemptHTTP2)
+
+		assert.Error(t, (&HTTPConfig{HTTP2: HTTP2Off}).ConfigureTransport(newTransport(), "h2c"))
+	})
+
+	t.Run("grpc", func(t *testing.T) {
+		tr := newTransport()
+		require.NoError(t, (&HTTPConfig{GRPC: true}).ConfigureTransport(tr, "https"))
+		assert.Zero(t, tr.ResponseHeaderTimeout)
+		assert.True(t, tr.Protocols.HTTP2())
+		require.NotNil(t, tr.HTTP2)
+		assert.Equal(t, 30*time.Second, tr.HTTP2.SendPingTimeout)
+		assert.Equal(t, 15*time.Second, tr.HTTP2.PingTimeout)
+
+		tr = newTransport()
+		cfg := HTTPConfig{GRPC: true, ResponseHeaderTimeout: 5 * time.Second, HTTP2PingInterval: time.Minute}
+		require.NoError(t, cfg.ConfigureTransport(tr, "h2c"))
+		assert.Equal(t, 5*time.Second, tr.ResponseHeaderTimeout)
+		assert.Nil(t, tr.Protocols)
+		assert.Equal(t, time.Minute, tr.HTTP2.SendPingTimeout)
+
+		assert.Error(t, (&HTTPConfig{GRPC: true, HTTP2: HTTP2Off}).ConfigureTransport(newTransport(), "https"))
+		assert.Error(t, (&HTTPConfig{GRPC: true}).ConfigureTransport(newTransport(), "http"))
+	})
+}
@@ -1,15 +1,62 @@
 package types
 
-import "errors"
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+
+	gperr "github.com/yusing/goutils/errs"
+)
 
 type InboundMTLSProfile struct {
-	UseSystemCAs bool     `json:"use_system_cas,omitempty" yaml:"use_system_cas,omitempty"`
-	CAFiles      []string `json:"ca_files,omitempty" yaml:"ca_files,omitempty" validate:"omitempty,dive,filepath"`
+	UseSystemCAs bool                   `json:"use_system_cas,omitempty" yaml:"use_system_cas,omitempty"`
+	CAFiles      []string               `json:"ca_files,omitempty" yaml:"ca_files,omitempty" validate:"omitempty,dive,filepath"`
+	Revocation   *InboundMTLSRevocation `json:"revocation,omitempty" yaml:"revocation,omitempty"`
+}
+
+// InboundMTLSRevocation configures the revocation check of client certificates.
+type InboundMTLSRevocation struct {
+	CRLFiles []string `json:"crl_files,omitempty" yaml:"crl_files,omitempty" validate:"omitempty,dive,filepath"`
+	// OCSP checks client certificates with their OCSP responder, if they have one.
+	OCSP bool `json:"ocsp,omitempty" yaml:"ocsp,omitempty"`
+	// SoftFail accepts client certificates whose OCSP status cannot be fetched.
+	SoftFail bool `json:"soft_fail,omitempty" yaml:"soft_fail,omitempty"`
 }
 
 func (cfg InboundMTLSProfile) Validate() error {
 	if !cfg.UseSystemCAs && len(cfg.CAFiles) == 0 {
 		return errors.New("at least one trust source is required for inbound mTLS profile")
 	}
+	if cfg.Revocation != nil && len(cfg.Revocation.CRLFiles) == 0 && !cfg.Revocation.OCSP {
+		return errors.New("revocation requires crl_files or ocsp")
+	}
 	return nil
 }
+
+// CACerts parses the certificates in CAFiles, system CAs are not included.
+func (cfg InboundMTLSProfile) CACerts() ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for _, file := range cfg.CAFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, gperr.PrependSubject(err, file)
+		}
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, gperr.PrependSubject(err, file)
+			}
+			certs = append(certs, cert)
+		}
+	}
+	return certs, nil
+}
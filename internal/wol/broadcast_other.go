@@ -0,0 +1,9 @@
+//go:build !aix && !android && !darwin && !dragonfly && !freebsd && !hurd && !illumos && !ios && !linux && !netbsd && !openbsd && !solaris
+
+package wol
+
+import "syscall"
+
+func enableBroadcast(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
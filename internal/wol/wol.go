@@ -0,0 +1,73 @@
+package wol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+const (
+	// DefaultBroadcast is the limited broadcast address on the discard port.
+	DefaultBroadcast = "255.255.255.255:9"
+	// DefaultPort is the port used when the broadcast address has none.
+	DefaultPort = "9"
+
+	magicPacketSize = 6 + 16*6
+)
+
+var ErrInvalidMAC = errors.New("invalid MAC address, must be a 48-bit MAC")
+
+// ParseMAC parses a 48-bit MAC address like 00:11:22:33:44:55, 00-11-22-33-44-55 or 0011.2233.4455.
+func ParseMAC(s string) (net.HardwareAddr, error) {
+	mac, err := net.ParseMAC(s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMAC, err)
+	}
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidMAC, s)
+	}
+	return mac, nil
+}
+
+// MagicPacket returns the magic packet that wakes the machine with the given MAC:
+// 6 bytes of 0xFF followed by the MAC repeated 16 times.
+func MagicPacket(mac net.HardwareAddr) []byte {
+	packet := make([]byte, 0, magicPacketSize)
+	packet = append(packet, bytes.Repeat([]byte{0xFF}, 6)...)
+	for range 16 {
+		packet = append(packet, mac...)
+	}
+	return packet
+}
+
+// BroadcastAddr returns broadcast with the default port if it has none.
+// An empty broadcast means DefaultBroadcast.
+func BroadcastAddr(broadcast string) string {
+	if broadcast == "" {
+		return DefaultBroadcast
+	}
+	if _, _, err := net.SplitHostPort(broadcast); err != nil {
+		return net.JoinHostPort(broadcast, DefaultPort)
+	}
+	return broadcast
+}
+
+// Send sends the magic packet for mac to the broadcast address (host[:port]) over UDP.
+func Send(ctx context.Context, mac net.HardwareAddr, broadcast string) error {
+	if len(mac) != 6 {
+		return ErrInvalidMAC
+	}
+	dialer := net.Dialer{Control: enableBroadcast}
+	conn, err := dialer.DialContext(ctx, "udp", BroadcastAddr(broadcast))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+	_, err = conn.Write(MagicPacket(mac))
+	return err
+}
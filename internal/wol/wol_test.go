@@ -0,0 +1,54 @@
+package wol
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMAC(t *testing.T) {
+	for _, s := range []string{"00:11:22:aa:bb:cc", "00-11-22-AA-BB-CC", "0011.22aa.bbcc"} {
+		mac, err := ParseMAC(s)
+		require.NoError(t, err, s)
+		require.Equal(t, net.HardwareAddr{0x00, 0x11, 0x22, 0xaa, 0xbb, 0xcc}, mac)
+	}
+	for _, s := range []string{"", "00:11:22", "00:00:5e:00:53:01:02:03"} {
+		_, err := ParseMAC(s)
+		require.ErrorIs(t, err, ErrInvalidMAC, s)
+	}
+}
+
+func TestMagicPacket(t *testing.T) {
+	mac := net.HardwareAddr{1, 2, 3, 4, 5, 6}
+	packet := MagicPacket(mac)
+	require.Len(t, packet, 102)
+	require.Equal(t, bytes.Repeat([]byte{0xFF}, 6), packet[:6])
+	for i := range 16 {
+		require.Equal(t, []byte(mac), packet[6+i*6:12+i*6])
+	}
+}
+
+func TestBroadcastAddr(t *testing.T) {
+	require.Equal(t, DefaultBroadcast, BroadcastAddr(""))
+	require.Equal(t, "192.168.1.255:9", BroadcastAddr("192.168.1.255"))
+	require.Equal(t, "192.168.1.255:7", BroadcastAddr("192.168.1.255:7"))
+	require.Equal(t, "[ff02::1]:9", BroadcastAddr("ff02::1"))
+}
+
+func TestSend(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	mac := net.HardwareAddr{0xde, 0xad, 0xbe, 0xef, 0x00, 0x01}
+	require.NoError(t, Send(t.Context(), mac, conn.LocalAddr().String()))
+
+	buf := make([]byte, 256)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, MagicPacket(mac), buf[:n])
+}